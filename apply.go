@@ -0,0 +1,371 @@
+package patchutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/google/go-patchutils/textnorm"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// ApplyOptions configures how diffs are applied to sources.
+// The zero value requires context and deleted lines to match the source exactly,
+// at the position given in hunk headers.
+type ApplyOptions struct {
+	// Normalize is applied to lines of the source and of the diff before they are compared.
+	Normalize textnorm.Options
+	// Ignore tells which whitespace differences between lines of the source and of
+	// the diff are ignored when they are compared, so that patches reformatted by
+	// editors still apply. Its BlankLines option has no effect here.
+	Ignore textnorm.Ignore
+	// CollapseKeywords ignores expansions of RCS keywords such as $Id$ and $Revision$
+	// when lines of the source and of the diff are compared. Keywords in added lines
+	// are written with the expansion found in the source.
+	CollapseKeywords bool
+	// MaxOffset is how many lines away from the position given in its header a hunk
+	// may be applied, like patch(1) does when the source has changed elsewhere.
+	// Once a hunk is moved, the following hunks are looked for with the same offset first.
+	MaxOffset int
+	// Fuzz is how many context lines at the start and at the end of a hunk may be
+	// ignored if the hunk doesn't apply otherwise, like the fuzz factor of patch(1).
+	Fuzz int
+	// Report, if not nil, is called for every hunk once its position is found.
+	Report func(HunkResult)
+	// Quota limits the trees written by ApplyPathWithOptions, ExportTree and ExportTar.
+	// Other functions ignore it.
+	Quota Quota
+	// PortableNames rejects names of files Windows can't store, or which differ
+	// only in case, as they are on Windows, on every system, so that trees written
+	// elsewhere can be checked out there.
+	PortableNames bool
+	// Newlines tells how line endings of sources are compared and written.
+	Newlines NewlineMode
+	// Encoding is the character encoding of sources and of patched sources.
+	Encoding Encoding
+
+	// skipFailed, if set, is called for every hunk which doesn't apply, which is
+	// then skipped instead of failing the diff.
+	skipFailed func(HunkResult)
+}
+
+// HunkResult describes how a hunk was applied.
+type HunkResult struct {
+	Hunk *diff.Hunk
+	// Offset is the number of lines between the position given in the hunk header
+	// and the position the hunk was applied at.
+	Offset int
+	// Fuzz is the number of context lines ignored at the start or at the end of the hunk.
+	Fuzz int
+	// Err is why the hunk doesn't apply. Only Check reports such hunks.
+	Err error
+}
+
+// ApplyFileDiff returns the content of source patched with fileDiff.
+func ApplyFileDiff(source string, fileDiff *diff.FileDiff, opts ApplyOptions) (string, error) {
+	result, err := applyToSource(source, fileDiff, opts)
+	if err != nil {
+		return "", fmt.Errorf("applying diff for %q: %w", fileDiff.OrigName, err)
+	}
+	return result, nil
+}
+
+// ApplyHunk returns the content of source patched with the single hunk h.
+// Errors tell which line of source doesn't match the hunk.
+func ApplyHunk(source string, h *diff.Hunk) (string, error) {
+	return ApplyHunkWithOptions(source, h, ApplyOptions{})
+}
+
+// ApplyHunkWithOptions is like ApplyHunk, with the hunk applied as configured by opts.
+func ApplyHunkWithOptions(source string, h *diff.Hunk, opts ApplyOptions) (string, error) {
+	result, err := applyToSource(source, &diff.FileDiff{Hunks: []*diff.Hunk{h}}, opts)
+	if err != nil {
+		return "", fmt.Errorf("applying hunk %s: %w", hunkHeader(h), err)
+	}
+	return result, nil
+}
+
+// applyToSource returns source patched with fileDiff, with source decoded from
+// opts.Encoding and the result written with opts.Newlines line endings and
+// encoded again.
+func applyToSource(source string, fileDiff *diff.FileDiff, opts ApplyOptions) (string, error) {
+	if isBinaryFileDiff(fileDiff) {
+		return applyDiff(source, fileDiff, opts)
+	}
+	source, err := opts.Encoding.decode(source)
+	if err != nil {
+		return "", fmt.Errorf("decoding source: %w", err)
+	}
+	result, err := applyDiff(source, fileDiff, opts)
+	if err != nil {
+		return "", err
+	}
+	result, err = opts.Encoding.encode(opts.Newlines.result(result))
+	if err != nil {
+		return "", fmt.Errorf("encoding result: %w", err)
+	}
+	return result, nil
+}
+
+// hunkHeader returns the range line of h, as printed in unified diffs.
+func hunkHeader(h *diff.Hunk) string {
+	return fmt.Sprintf("@@ -%d,%d +%d,%d @@", h.OrigStartLine, h.OrigLines, h.NewStartLine, h.NewLines)
+}
+
+// ApplyPath applies patch, a unified diff of one or more files, to the directory tree at root.
+// Files are created, modified, renamed and deleted as described by the diff; names in
+// the diff are relative to root (patch -p0). The tree is left untouched if any file
+// diff doesn't apply, and restored if any file can't be written.
+func ApplyPath(root string, patch io.Reader) error {
+	return ApplyPathWithOptions(root, patch, ApplyOptions{})
+}
+
+// ApplyPathWithOptions is like ApplyPath, with lines compared as configured by opts.
+func ApplyPathWithOptions(root string, patch io.Reader, opts ApplyOptions) error {
+	return ApplyPathContext(context.Background(), root, patch, opts)
+}
+
+// ApplyPathContext is like ApplyPathWithOptions, but stops applying file diffs and
+// fails with the error of ctx once ctx is done. Once files are being written, ctx
+// is no longer checked, so that either all of them are written or none is.
+func ApplyPathContext(ctx context.Context, root string, patch io.Reader, opts ApplyOptions) error {
+	t, err := patchPathTree(ctx, root, patch, opts)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return writeTree(root, t)
+}
+
+// patchPathTree returns the tree at root patched with patch in memory, failing
+// like ApplyPathContext if a file diff doesn't apply or the quota of opts is exceeded.
+func patchPathTree(ctx context.Context, root string, patch io.Reader, opts ApplyOptions) (*patchTree, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return nil, ErrEmptyDiffFile
+	}
+
+	t := newPatchTree(func(name string) (string, error) {
+		content, err := ioutil.ReadFile(longPath(filepath.Join(root, filepath.FromSlash(name))))
+		return string(content), err
+	}, 0, opts)
+	for _, fd := range fileDiffs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := t.apply(fd); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Quota != (Quota{}) {
+		if err := t.checkQuota(opts.Quota); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// writeTree writes the changed files of t to the tree at root. Contents are first
+// written to temporary files next to the files they replace, which are only renamed
+// into place once all of them are written. Replaced and deleted files are moved aside
+// until all files are in place, so that the tree is restored if writing any file fails.
+func writeTree(root string, t *patchTree) (err error) {
+	writes := make([]*treeWrite, 0, len(t.names))
+	var dirs []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		for k := len(writes) - 1; k >= 0; k-- {
+			writes[k].undo()
+		}
+		// Directories are removed before their parents
+		sort.Slice(dirs, func(i, j int) bool { return len(dirs[i]) > len(dirs[j]) })
+		for _, dir := range dirs {
+			os.Remove(dir)
+		}
+	}()
+
+	for _, name := range t.names {
+		w := &treeWrite{name: longPath(filepath.Join(root, filepath.FromSlash(name)))}
+		writes = append(writes, w)
+		f := t.files[name]
+		if f.deleted {
+			continue
+		}
+		created, err := makeDirs(filepath.Dir(w.name))
+		dirs = append(dirs, created...)
+		if err != nil {
+			return fmt.Errorf("creating directory for %q: %w", w.name, err)
+		}
+		if err := w.writeTemp(f); err != nil {
+			return err
+		}
+	}
+	for _, w := range writes {
+		if err := w.replace(); err != nil {
+			return err
+		}
+	}
+	for _, w := range writes {
+		if w.backup != "" {
+			os.Remove(w.backup)
+		}
+	}
+	return nil
+}
+
+// treeWrite is a file written by writeTree.
+type treeWrite struct {
+	// name is the path of the file.
+	name string
+	// temp holds the new content of the file until it is renamed to name,
+	// it is empty for deleted files.
+	temp string
+	// backup holds the previous content of the file once it is moved aside,
+	// it is empty if there was no file.
+	backup string
+	// placed is set once temp is renamed to name.
+	placed bool
+}
+
+// writeTemp writes the content of f to a temporary file next to w.name, with the
+// permissions of f, or those of the file it replaces if f doesn't set them.
+func (w *treeWrite) writeTemp(f *treeFile) error {
+	var oldMode os.FileMode
+	if fi, err := os.Stat(w.name); err == nil {
+		oldMode = fi.Mode().Perm()
+	}
+	mode := newFileMode(f, oldMode)
+
+	temp, err := ioutil.TempFile(filepath.Dir(w.name), "."+filepath.Base(w.name)+".patch*")
+	if err != nil {
+		return fmt.Errorf("writing %q: %w", w.name, err)
+	}
+	w.temp = temp.Name()
+	_, err = temp.WriteString(f.content)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("writing %q: %w", w.name, err)
+	}
+	if err := os.Chmod(w.temp, mode); err != nil {
+		return fmt.Errorf("changing mode of %q: %w", w.name, err)
+	}
+	return nil
+}
+
+// replace moves the file at w.name, if any, aside to w.backup and renames w.temp,
+// if any, to w.name.
+func (w *treeWrite) replace() error {
+	if _, err := os.Lstat(w.name); err == nil {
+		// A free name is reserved for the file moved aside
+		f, err := ioutil.TempFile(filepath.Dir(w.name), "."+filepath.Base(w.name)+".orig*")
+		if err != nil {
+			return fmt.Errorf("moving %q aside: %w", w.name, err)
+		}
+		backup := f.Name()
+		f.Close()
+		os.Remove(backup)
+		if err := os.Rename(w.name, backup); err != nil {
+			return fmt.Errorf("moving %q aside: %w", w.name, err)
+		}
+		w.backup = backup
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("replacing %q: %w", w.name, err)
+	}
+
+	if w.temp == "" {
+		return nil
+	}
+	if err := os.Rename(w.temp, w.name); err != nil {
+		return fmt.Errorf("writing %q: %w", w.name, err)
+	}
+	w.placed = true
+	return nil
+}
+
+// undo restores the file at w.name as it was before w was written.
+func (w *treeWrite) undo() {
+	if w.placed {
+		os.Remove(w.name)
+	} else if w.temp != "" {
+		os.Remove(w.temp)
+	}
+	if w.backup != "" {
+		os.Rename(w.backup, w.name)
+	}
+}
+
+// makeDirs creates directory dir with its missing parents, and returns the
+// directories it created.
+func makeDirs(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || filepath.Dir(d) == d {
+			break
+		}
+		missing = append(missing, d)
+	}
+	return missing, os.MkdirAll(dir, 0755)
+}
+
+// linesMatch reports whether a line of the diff matches a line of the source.
+// A missing newline at the end of the file doesn't matter, like with patch.
+func linesMatch(diffLine, sourceLine string, opts ApplyOptions) bool {
+	diffLine, sourceLine = strings.TrimSuffix(diffLine, hunks.NoNewlineSuffix), strings.TrimSuffix(sourceLine, hunks.NoNewlineSuffix)
+	diffLine, sourceLine = textnorm.Line(diffLine, opts.Normalize), textnorm.Line(sourceLine, opts.Normalize)
+	diffLine, sourceLine = opts.Ignore.Key(diffLine), opts.Ignore.Key(sourceLine)
+	if opts.CollapseKeywords {
+		diffLine, sourceLine = collapseKeywords(diffLine), collapseKeywords(sourceLine)
+	}
+	return diffLine == sourceLine
+}
+
+// keywordRegexp matches RCS keywords, both collapsed ($Id$) and expanded ($Id: file.c,v 1.1 $).
+var keywordRegexp = regexp.MustCompile(
+	`\$(Author|Date|Header|Id|Locker|Log|Name|RCSfile|Revision|Source|State)(?::[^$\n]*)?\$`)
+
+// collapseKeywords replaces expanded RCS keywords in line with their collapsed form.
+func collapseKeywords(line string) string {
+	return keywordRegexp.ReplaceAllString(line, "$$$1$$")
+}
+
+// keywordExpansions returns the first expansion of every RCS keyword found in lines.
+func keywordExpansions(lines []string) map[string]string {
+	expansions := make(map[string]string)
+	for _, line := range lines {
+		for _, m := range keywordRegexp.FindAllStringSubmatch(line, -1) {
+			if _, ok := expansions[m[1]]; !ok {
+				expansions[m[1]] = m[0]
+			}
+		}
+	}
+	return expansions
+}
+
+// restoreKeywords replaces RCS keywords in line with their expansions.
+// Keywords without known expansion are left untouched.
+func restoreKeywords(line string, expansions map[string]string) string {
+	return keywordRegexp.ReplaceAllStringFunc(line, func(keyword string) string {
+		name := keywordRegexp.FindStringSubmatch(keyword)[1]
+		if expansion, ok := expansions[name]; ok {
+			return expansion
+		}
+		return keyword
+	})
+}
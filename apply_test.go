@@ -0,0 +1,490 @@
+package patchutils
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-patchutils/textnorm"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+var applyFileDiffTests = []struct {
+	name    string
+	source  string
+	diff    string
+	opts    ApplyOptions
+	result  string
+	wantErr error
+}{
+	{
+		name:    "expanded keyword mismatch",
+		source:  "/* $Id: foo.c,v 1.5 2020/01/02 alice $ */\nint x;\n",
+		diff:    "--- foo.c\n+++ foo.c\n@@ -1,2 +1,2 @@\n /* $Id: foo.c,v 1.4 2019/05/06 bob $ */\n-int x;\n+int y;\n",
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:   "expanded keyword collapsed",
+		source: "/* $Id: foo.c,v 1.5 2020/01/02 alice $ */\nint x;\n",
+		diff:   "--- foo.c\n+++ foo.c\n@@ -1,2 +1,2 @@\n /* $Id: foo.c,v 1.4 2019/05/06 bob $ */\n-int x;\n+int y;\n",
+		opts:   ApplyOptions{CollapseKeywords: true},
+		result: "/* $Id: foo.c,v 1.5 2020/01/02 alice $ */\nint y;\n",
+	},
+	{
+		name:   "keyword restored in added line",
+		source: "/* $Revision: 1.5 $ */\nint x;\n",
+		diff:   "--- foo.c\n+++ foo.c\n@@ -1,2 +1,2 @@\n-/* $Revision$ */\n+/* Revision $Revision$ */\n int x;\n",
+		opts:   ApplyOptions{CollapseKeywords: true},
+		result: "/* Revision $Revision: 1.5 $ */\nint x;\n",
+	},
+	{
+		name:   "space change ignored",
+		source: "if x {\n\treturn  y \n}\n",
+		diff:   "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n if x {\n-    return y\n+    return z\n }\n",
+		opts:   ApplyOptions{Ignore: textnorm.Ignore{SpaceChange: true}},
+		result: "if x {\n    return z\n}\n",
+	},
+	{
+		name:    "removed space with space change ignored",
+		source:  "a+b\nc\n",
+		diff:    "--- foo.c\n+++ foo.c\n@@ -1,2 +1,2 @@\n a + b\n-c\n+C\n",
+		opts:    ApplyOptions{Ignore: textnorm.Ignore{SpaceChange: true}},
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:   "all space ignored",
+		source: "a+b\nc\n",
+		diff:   "--- foo.c\n+++ foo.c\n@@ -1,2 +1,2 @@\n a + b\n-c\n+C\n",
+		opts:   ApplyOptions{Ignore: textnorm.Ignore{AllSpace: true}},
+		result: "a+b\nC\n",
+	},
+	{
+		name:    "moved hunk without offset",
+		source:  "new\na\nb\nc\n",
+		diff:    "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:   "moved hunk with offset",
+		source: "new\na\nb\nc\n",
+		diff:   "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		opts:   ApplyOptions{MaxOffset: 1},
+		result: "new\na\nB\nc\n",
+	},
+	{
+		name:    "hunk further than offset",
+		source:  "new\nnew\na\nb\nc\n",
+		diff:    "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		opts:    ApplyOptions{MaxOffset: 1},
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:    "changed context without fuzz",
+		source:  "a\nb\nC\n",
+		diff:    "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:   "changed context with fuzz",
+		source: "a\nb\nC\n",
+		diff:   "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		opts:   ApplyOptions{Fuzz: 1},
+		result: "a\nB\nC\n",
+	},
+	{
+		name:    "changed deleted line with fuzz",
+		source:  "a\nx\nc\n",
+		diff:    "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		opts:    ApplyOptions{Fuzz: 2},
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:   "newline removed at end of file",
+		source: "a\nb\n",
+		diff:   "--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n+B\n\\ No newline at end of file\n",
+		result: "a\nB",
+	},
+	{
+		name:   "newline added at end of file",
+		source: "a\nb",
+		diff:   "--- f\n+++ f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		result: "a\nb\n",
+	},
+	{
+		name:   "no newline at end of file kept",
+		source: "a\nb\nc",
+		diff:   "--- f\n+++ f\n@@ -1,3 +1,3 @@\n-a\n+A\n b\n c\n\\ No newline at end of file\n",
+		result: "A\nb\nc",
+	},
+	{
+		name:   "no newline at end of file untouched",
+		source: "a\nb\nc\nd\ne",
+		diff:   "--- f\n+++ f\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n",
+		result: "A\nb\nc\nd\ne",
+	},
+}
+
+func TestApplyFileDiff(t *testing.T) {
+	for _, tt := range applyFileDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := diff.ParseFileDiff([]byte(tt.diff))
+			if err != nil {
+				t.Fatalf("Error parsing diff: %v", err)
+			}
+
+			currentResult, err := ApplyFileDiff(tt.source, fd, tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ApplyFileDiff: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyFileDiff: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
+
+func TestApplyFileDiffReport(t *testing.T) {
+	source := "new\na\nb\nc\nd\ne\nf\ng\nh\nI\nj\n"
+	fd, err := diff.ParseFileDiff([]byte("--- foo.c\n+++ foo.c\n" +
+		"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n" +
+		"@@ -7,3 +7,3 @@\n g\n-h\n+H\n i\n"))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+
+	var got []HunkResult
+	opts := ApplyOptions{
+		MaxOffset: 1,
+		Fuzz:      1,
+		Report:    func(r HunkResult) { got = append(got, r) },
+	}
+	result, err := ApplyFileDiff(source, fd, opts)
+	if err != nil {
+		t.Fatalf("ApplyFileDiff: got error %v; want error nil", err)
+	}
+	if want := "new\na\nB\nc\nd\ne\nf\ng\nH\nI\nj\n"; result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+
+	want := []HunkResult{
+		{Hunk: fd.Hunks[0], Offset: 1},
+		{Hunk: fd.Hunks[1], Offset: 1, Fuzz: 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Reported hunks: got %+v; want %+v", got, want)
+	}
+}
+
+var applyHunkTests = []struct {
+	name    string
+	source  string
+	hunk    *diff.Hunk
+	result  string
+	wantErr string
+}{
+	{
+		name:   "second hunk alone",
+		source: "a\nb\nc\nd\ne\nf\ng\nh\ni\n",
+		hunk: &diff.Hunk{
+			OrigStartLine: 7, OrigLines: 3, NewStartLine: 7, NewLines: 3,
+			Body: []byte(" g\n-h\n+H\n i\n"),
+		},
+		result: "a\nb\nc\nd\ne\nf\ng\nH\ni\n",
+	},
+	{
+		name:   "mismatched line",
+		source: "a\nb\nc\n",
+		hunk: &diff.Hunk{
+			OrigStartLine: 1, OrigLines: 3, NewStartLine: 1, NewLines: 3,
+			Body: []byte(" a\n-x\n+X\n c\n"),
+		},
+		wantErr: `applying hunk @@ -1,3 +1,3 @@: line 2 in source ("b") and diff ("x"): content mismatch`,
+	},
+}
+
+func TestApplyHunk(t *testing.T) {
+	for _, tt := range applyHunkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := ApplyHunk(tt.source, tt.hunk)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("ApplyHunk: got error %v; want error %v", err, tt.wantErr)
+				}
+				if !errors.Is(err, ErrContentMismatch) {
+					t.Errorf("ApplyHunk: got error %v; want error %v", err, ErrContentMismatch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyHunk: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
+
+func TestCollapseKeywords(t *testing.T) {
+	line := "$Id: a.c,v 1.1 $ $Revision$ $Author: bob $ $NotAKeyword: x $"
+	want := "$Id$ $Revision$ $Author$ $NotAKeyword: x $"
+	if got := collapseKeywords(line); got != want {
+		t.Errorf("collapseKeywords(%q): got %q; want %q", line, got, want)
+	}
+	if got := collapseKeywords(strings.Repeat("$", 3)); got != "$$$" {
+		t.Errorf("collapseKeywords: got %q; want unchanged", got)
+	}
+}
+
+// writeTestTree creates files, keyed by slash-separated path, in a new temporary directory.
+func writeTestTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	root, err := ioutil.TempDir("", "patchutils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// readTestTree returns the content of all files under root, keyed by slash-separated path.
+func readTestTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+var applyPathTests = []struct {
+	name    string
+	files   map[string]string
+	patch   string
+	result  map[string]string
+	wantErr error
+}{
+	{
+		name: "create, modify and delete",
+		files: map[string]string{
+			"a.txt":     "one\ntwo\nthree\n",
+			"old/b.txt": "b\n",
+		},
+		patch: `--- a.txt
++++ a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+--- old/b.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-b
+--- /dev/null
++++ new/c.txt
+@@ -0,0 +1,2 @@
++c
++c
+`,
+		result: map[string]string{
+			"a.txt":     "one\nTWO\nthree\n",
+			"new/c.txt": "c\nc\n",
+		},
+	},
+	{
+		name:  "same file patched twice",
+		files: map[string]string{"a.txt": "one\ntwo\n"},
+		patch: `--- a.txt
++++ a.txt
+@@ -1 +1 @@
+-one
++ONE
+--- a.txt
++++ a.txt
+@@ -2 +2 @@
+-two
++TWO
+`,
+		result: map[string]string{"a.txt": "ONE\nTWO\n"},
+	},
+	{
+		name:  "failing file diff leaves tree untouched",
+		files: map[string]string{"a.txt": "one\n", "b.txt": "b\n"},
+		patch: `--- a.txt
++++ a.txt
+@@ -1 +1 @@
+-one
++ONE
+--- b.txt
++++ b.txt
+@@ -1 +1 @@
+-x
++X
+`,
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:    "modified file is missing",
+		files:   map[string]string{"a.txt": "one\n"},
+		patch:   "--- x.txt\n+++ x.txt\n@@ -1 +1 @@\n-one\n+ONE\n",
+		wantErr: ErrFileNotFound,
+	},
+	{
+		name:    "added file exists",
+		files:   map[string]string{"a.txt": "one\n"},
+		patch:   "--- /dev/null\n+++ a.txt\n@@ -0,0 +1 @@\n+one\n",
+		wantErr: ErrFileExists,
+	},
+	{
+		name:    "deleted content mismatch",
+		files:   map[string]string{"a.txt": "one\ntwo\n"},
+		patch:   "--- a.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-one\n",
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:    "path outside of root",
+		files:   map[string]string{"a.txt": "one\n"},
+		patch:   "--- /dev/null\n+++ ../evil.txt\n@@ -0,0 +1 @@\n+evil\n",
+		wantErr: ErrUnsafePath,
+	},
+	{
+		name:    "empty patch",
+		files:   map[string]string{"a.txt": "one\n"},
+		wantErr: ErrEmptyDiffFile,
+	},
+}
+
+func TestApplyPath(t *testing.T) {
+	for _, tt := range applyPathTests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeTestTree(t, tt.files)
+			defer os.RemoveAll(root)
+
+			err := ApplyPath(root, strings.NewReader(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ApplyPath: got error %v; want error %v", err, tt.wantErr)
+				}
+				if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, tt.files) {
+					t.Errorf("Tree changed after error.\nGot:\n%v\nWant:\n%v\n", currentFiles, tt.files)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyPath: got error %v; want error nil", err)
+			}
+			if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, tt.result) {
+				t.Errorf("Result mismatch.\nGot:\n%v\nWant:\n%v\n", currentFiles, tt.result)
+			}
+		})
+	}
+}
+
+// treeChange is a change of file name, recorded in a patchTree.
+type treeChange struct {
+	name string
+	file *treeFile
+}
+
+var writeTreeFailureTests = []struct {
+	name string
+	// changes are written in order
+	changes []treeChange
+}{
+	{
+		name: "directory can't be created",
+		changes: []treeChange{
+			{"a.txt", &treeFile{content: "A\n"}},
+			{"b.txt", &treeFile{deleted: true}},
+			{"new/dir/c.txt", &treeFile{content: "c\n"}},
+			{"f/x.txt", &treeFile{content: "x\n"}},
+		},
+	},
+	{
+		name: "file can't be replaced",
+		changes: []treeChange{
+			{"a.txt", &treeFile{content: "A\n"}},
+			{"b.txt", &treeFile{deleted: true}},
+			{"new/c.txt", &treeFile{content: "c\n"}},
+			{"f/x.txt", &treeFile{deleted: true}},
+		},
+	},
+}
+
+func TestWriteTreeFailure(t *testing.T) {
+	for _, tt := range writeTreeFailureTests {
+		t.Run(tt.name, func(t *testing.T) {
+			// f is a file, so files can't be written to or read from it
+			files := map[string]string{"a.txt": "a\n", "b.txt": "b\n", "f": "f\n"}
+			root := writeTestTree(t, files)
+			defer os.RemoveAll(root)
+
+			tree := newPatchTree(nil, 0, ApplyOptions{})
+			for _, c := range tt.changes {
+				tree.set(c.name, c.file)
+			}
+			if err := writeTree(root, tree); err == nil {
+				t.Errorf("writeTree: got error nil; want error non-nil")
+			}
+			if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, files) {
+				t.Errorf("Tree changed after error.\nGot:\n%v\nWant:\n%v\n", currentFiles, files)
+			}
+			if _, err := os.Stat(filepath.Join(root, "new")); !os.IsNotExist(err) {
+				t.Errorf("Created directory is left after error: %v", err)
+			}
+		})
+	}
+}
+
+func TestApplyPathContext(t *testing.T) {
+	files := map[string]string{"a.txt": "a\n"}
+	root := writeTestTree(t, files)
+	defer os.RemoveAll(root)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := ApplyPathContext(ctx, root, strings.NewReader(quotaPatch), ApplyOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ApplyPathContext: got error %v; want error %v", err, context.Canceled)
+	}
+	if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, files) {
+		t.Errorf("Tree changed after error.\nGot:\n%v\nWant:\n%v\n", currentFiles, files)
+	}
+}
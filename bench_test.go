@@ -0,0 +1,180 @@
+package patchutils_test
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/internal/fixtures"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// benchCorpus is a synthetic fixture set, generated by fixtures.Generate.
+type benchCorpus struct {
+	dir     string
+	name    string
+	oldDiff []byte
+	newDiff []byte
+}
+
+// newBenchCorpus generates a fixture set of a synthetic tree of numFiles files
+// with linesPerFile lines each, nested depth directories deep, and two versions
+// of it with the given number of random mutations in every file.
+func newBenchCorpus(b *testing.B, numFiles, depth, linesPerFile, mutations int) *benchCorpus {
+	b.Helper()
+
+	dir, err := ioutil.TempDir("", "patchutils-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	source := filepath.Join(dir, "source")
+	if err := fixtures.WriteTree(source, fixtures.Synthesize(1, numFiles, depth, linesPerFile)); err != nil {
+		b.Fatal(err)
+	}
+	c := &benchCorpus{dir: dir, name: "bench"}
+	if err := fixtures.Generate(source, dir, c.name,
+		fixtures.Profile{Seed: 2, RandomMutations: mutations},
+		fixtures.Profile{Seed: 3, RandomMutations: mutations}); err != nil {
+		b.Fatal(err)
+	}
+
+	if c.oldDiff, err = ioutil.ReadFile(filepath.Join(dir, c.name+"_a.diff")); err != nil {
+		b.Fatal(err)
+	}
+	if c.newDiff, err = ioutil.ReadFile(filepath.Join(dir, c.name+"_b.diff")); err != nil {
+		b.Fatal(err)
+	}
+	return c
+}
+
+// remove deletes the files of c.
+func (c *benchCorpus) remove() {
+	os.RemoveAll(c.dir)
+}
+
+func BenchmarkInterDiffMultiFile(b *testing.B) {
+	c := newBenchCorpus(b, 200, 2, 200, 5)
+	defer c.remove()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patchutils.InterDiff(bytes.NewReader(c.oldDiff), bytes.NewReader(c.newDiff)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInterDiffStatMultiFile(b *testing.B) {
+	c := newBenchCorpus(b, 200, 2, 200, 5)
+	defer c.remove()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patchutils.InterDiffStat(bytes.NewReader(c.oldDiff), bytes.NewReader(c.newDiff)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMixedModePathDeep(b *testing.B) {
+	c := newBenchCorpus(b, 64, 8, 100, 3)
+	defer c.remove()
+
+	// Names in diffs are relative to the corpus directory
+	opts := patchutils.MixedModeOptions{Dir: c.dir}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patchutils.MixedModePathWithOptions(c.name, c.name,
+			bytes.NewReader(c.oldDiff), bytes.NewReader(c.newDiff), opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkInterDiff10kFiles and BenchmarkMixedModePath10kFiles measure big patch
+// sets, whose results are written file by file: "writer" streams them to
+// io.Discard, "string" builds them in memory. Both cost about the same, as the
+// string is built by the same writer; they guard against regressions only.
+func BenchmarkInterDiff10kFiles(b *testing.B) {
+	c := newBenchCorpus(b, 10000, 3, 20, 1)
+	defer c.remove()
+
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := patchutils.InterDiff(bytes.NewReader(c.oldDiff), bytes.NewReader(c.newDiff)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("writer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := patchutils.InterDiffTo(ioutil.Discard, bytes.NewReader(c.oldDiff), bytes.NewReader(c.newDiff)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkMixedModePath10kFiles(b *testing.B) {
+	c := newBenchCorpus(b, 10000, 3, 20, 1)
+	defer c.remove()
+
+	opts := patchutils.MixedModeOptions{Dir: c.dir}
+	b.Run("string", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := patchutils.MixedModePathWithOptions(c.name, c.name,
+				bytes.NewReader(c.oldDiff), bytes.NewReader(c.newDiff), opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("writer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := patchutils.MixedModePathToWithOptions(ioutil.Discard, c.name, c.name,
+				bytes.NewReader(c.oldDiff), bytes.NewReader(c.newDiff), opts); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkApplyLargeFile(b *testing.B) {
+	const lines, step = 100000, 100
+
+	// The diff is built directly, as diffing a file this large is too slow for setup
+	var source []string
+	for _, content := range fixtures.Synthesize(1, 1, 0, lines) {
+		source = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	var patch strings.Builder
+	patch.WriteString("--- file_0.txt\n+++ file_0.txt\n")
+	for k := step / 2; k < len(source); k += step {
+		fmt.Fprintf(&patch, "@@ -%d,1 +%d,1 @@\n-%s\n+changed line %d\n", k+1, k+1, source[k], k+1)
+	}
+	fd, err := diff.ParseFileDiff([]byte(patch.String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	content := strings.Join(source, "\n") + "\n"
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := patchutils.ApplyFileDiff(content, fd, patchutils.ApplyOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
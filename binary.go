@@ -0,0 +1,448 @@
+package patchutils
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// binaryPatchHeader starts the data of a binary file diff made by git diff --binary.
+const binaryPatchHeader = "GIT binary patch"
+
+// DefaultMaxTextSize is the size in bytes of the largest sources mixed mode
+// compares as text by default.
+const DefaultMaxTextSize = 16 << 20
+
+// isBinaryContent reports whether content of a source is compared as a binary
+// file: if it contains a NUL byte, or is larger than maxSize, which stands for
+// DefaultMaxTextSize if it is 0 and for no limit if it is negative.
+func isBinaryContent(content string, maxSize int) bool {
+	if maxSize == 0 {
+		maxSize = DefaultMaxTextSize
+	}
+	return maxSize > 0 && len(content) > maxSize || strings.IndexByte(content, 0) >= 0
+}
+
+// isBinaryFileDiff reports whether fd changes a binary file, with or without data.
+func isBinaryFileDiff(fd *diff.FileDiff) bool {
+	for _, line := range fd.Extended {
+		if line == binaryPatchHeader || strings.HasPrefix(line, "Binary files ") {
+			return true
+		}
+	}
+	return false
+}
+
+// binaryHunk is one of the two parts of a "GIT binary patch": the content of
+// the file, or a delta to apply to the other version of it.
+type binaryHunk struct {
+	delta bool
+	// data is the inflated literal content or delta.
+	data []byte
+}
+
+// binaryPatch is the data of a "GIT binary patch".
+type binaryPatch struct {
+	// forward changes the original file into the new one, reverse undoes it.
+	forward, reverse binaryHunk
+}
+
+// parseBinaryPatch returns the data of the "GIT binary patch" in extended header
+// lines, and false if there is none.
+func parseBinaryPatch(extended []string) (*binaryPatch, bool, error) {
+	start := -1
+	for k, line := range extended {
+		if line == binaryPatchHeader {
+			start = k + 1
+			break
+		}
+	}
+	if start < 0 {
+		return nil, false, nil
+	}
+
+	var hunks []binaryHunk
+	lines := extended[start:]
+	for len(lines) > 0 {
+		if lines[0] == "" {
+			lines = lines[1:]
+			continue
+		}
+		fields := strings.Fields(lines[0])
+		if len(fields) != 2 || fields[0] != "literal" && fields[0] != "delta" {
+			return nil, true, fmt.Errorf("binary hunk header %q: %w", lines[0], ErrBadBinaryPatch)
+		}
+		size, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, true, fmt.Errorf("binary hunk header %q: %w", lines[0], ErrBadBinaryPatch)
+		}
+
+		var compressed []byte
+		k := 1
+		for ; k < len(lines) && lines[k] != ""; k++ {
+			decoded, err := decodeBase85Line(lines[k])
+			if err != nil {
+				return nil, true, err
+			}
+			compressed = append(compressed, decoded...)
+		}
+		lines = lines[k:]
+
+		data, err := inflate(compressed)
+		if err != nil {
+			return nil, true, fmt.Errorf("binary hunk %q: %w", fields[0]+" "+fields[1], err)
+		}
+		if len(data) != size {
+			return nil, true, fmt.Errorf("binary hunk %q has %d bytes: %w",
+				fields[0]+" "+fields[1], len(data), ErrBadBinaryPatch)
+		}
+		hunks = append(hunks, binaryHunk{delta: fields[0] == "delta", data: data})
+	}
+
+	switch len(hunks) {
+	case 1:
+		// Patches made without the reverse part can't be undone
+		return &binaryPatch{forward: hunks[0]}, true, nil
+	case 2:
+		return &binaryPatch{forward: hunks[0], reverse: hunks[1]}, true, nil
+	}
+	return nil, true, fmt.Errorf("%d binary hunks: %w", len(hunks), ErrBadBinaryPatch)
+}
+
+// inflate returns data decompressed with zlib.
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// apply returns source changed by h.
+func (h binaryHunk) apply(source []byte) ([]byte, error) {
+	if !h.delta {
+		return h.data, nil
+	}
+	return applyGitDelta(source, h.data)
+}
+
+// applyGitDelta returns source changed by delta in the format of git packs:
+// sizes of the source and of the result, followed by instructions copying
+// parts of source and inserting new data.
+func applyGitDelta(source, delta []byte) ([]byte, error) {
+	sourceSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+	if sourceSize != len(source) {
+		return nil, fmt.Errorf("delta applies to %d bytes, got %d: %w", sourceSize, len(source), ErrContentMismatch)
+	}
+	resultSize, delta, err := deltaSize(delta)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, resultSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// Copy from source, with offset and size bytes present as flagged by op
+			var offset, size int
+			for bit := uint(0); bit < 7; bit++ {
+				if op&(1<<bit) == 0 {
+					continue
+				}
+				if len(delta) == 0 {
+					return nil, fmt.Errorf("truncated delta copy: %w", ErrBadBinaryPatch)
+				}
+				if bit < 4 {
+					offset |= int(delta[0]) << (8 * bit)
+				} else {
+					size |= int(delta[0]) << (8 * (bit - 4))
+				}
+				delta = delta[1:]
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(source) {
+				return nil, fmt.Errorf("delta copies bytes %d-%d of %d: %w",
+					offset, offset+size, len(source), ErrBadBinaryPatch)
+			}
+			result = append(result, source[offset:offset+size]...)
+		case op != 0:
+			// Insert the next op bytes
+			if int(op) > len(delta) {
+				return nil, fmt.Errorf("truncated delta insert: %w", ErrBadBinaryPatch)
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, fmt.Errorf("reserved delta instruction: %w", ErrBadBinaryPatch)
+		}
+	}
+	if len(result) != resultSize {
+		return nil, fmt.Errorf("delta gives %d bytes instead of %d: %w", len(result), resultSize, ErrBadBinaryPatch)
+	}
+	return result, nil
+}
+
+// deltaSize returns a size from the header of a git delta, and the rest of delta.
+func deltaSize(delta []byte) (int, []byte, error) {
+	size := 0
+	for shift := uint(0); len(delta) > 0; shift += 7 {
+		b := delta[0]
+		delta = delta[1:]
+		size |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return size, delta, nil
+		}
+	}
+	return 0, nil, fmt.Errorf("truncated delta header: %w", ErrBadBinaryPatch)
+}
+
+// base85Alphabet is the alphabet of the base85 encoding used by git.
+const base85Alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// decodeBase85Line decodes a line of a binary hunk: a letter giving the number of
+// bytes in the line, 'A'-'Z' for 1-26 and 'a'-'z' for 27-52, followed by the bytes
+// encoded in groups of 4 as 5 characters.
+func decodeBase85Line(line string) ([]byte, error) {
+	if line == "" {
+		return nil, fmt.Errorf("empty binary data line: %w", ErrBadBinaryPatch)
+	}
+	var n int
+	switch c := line[0]; {
+	case c >= 'A' && c <= 'Z':
+		n = int(c-'A') + 1
+	case c >= 'a' && c <= 'z':
+		n = int(c-'a') + 27
+	default:
+		return nil, fmt.Errorf("binary data line %q: %w", line, ErrBadBinaryPatch)
+	}
+	encoded := line[1:]
+	if len(encoded) != (n+3)/4*5 {
+		return nil, fmt.Errorf("binary data line %q has wrong length: %w", line, ErrBadBinaryPatch)
+	}
+
+	decoded := make([]byte, 0, len(encoded)/5*4)
+	for ; len(encoded) > 0; encoded = encoded[5:] {
+		var acc uint64
+		for k := 0; k < 5; k++ {
+			v := strings.IndexByte(base85Alphabet, encoded[k])
+			if v < 0 {
+				return nil, fmt.Errorf("binary data line %q: %w", line, ErrBadBinaryPatch)
+			}
+			acc = acc*85 + uint64(v)
+		}
+		if acc > 0xffffffff {
+			return nil, fmt.Errorf("binary data line %q: %w", line, ErrBadBinaryPatch)
+		}
+		decoded = append(decoded, byte(acc>>24), byte(acc>>16), byte(acc>>8), byte(acc))
+	}
+	return decoded[:n], nil
+}
+
+// binaryHunkLines returns lines of a literal binary hunk with content data.
+func binaryHunkLines(data []byte) []string {
+	var compressed bytes.Buffer
+	w := zlib.NewWriter(&compressed)
+	w.Write(data)
+	w.Close()
+
+	lines := []string{fmt.Sprintf("literal %d", len(data))}
+	for rest := compressed.Bytes(); len(rest) > 0; {
+		n := len(rest)
+		if n > 52 {
+			n = 52
+		}
+		lines = append(lines, encodeBase85Line(rest[:n]))
+		rest = rest[n:]
+	}
+	return append(lines, "")
+}
+
+// encodeBase85Line returns a line of a binary hunk with up to 52 bytes of data,
+// see decodeBase85Line.
+func encodeBase85Line(data []byte) string {
+	var b strings.Builder
+	if len(data) <= 26 {
+		b.WriteByte(byte('A' + len(data) - 1))
+	} else {
+		b.WriteByte(byte('a' + len(data) - 27))
+	}
+	for k := 0; k < len(data); k += 4 {
+		var acc uint32
+		for i := k; i < k+4; i++ {
+			acc <<= 8
+			if i < len(data) {
+				acc |= uint32(data[i])
+			}
+		}
+		var group [5]byte
+		for i := 4; i >= 0; i-- {
+			group[i] = base85Alphabet[acc%85]
+			acc /= 85
+		}
+		b.Write(group[:])
+	}
+	return b.String()
+}
+
+// blobHash returns the hash git gives to a file with content.
+func blobHash(content []byte) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// applyBinary returns source changed by the binary file diff fd. If fd has a blob
+// hash of the original file, source must match it.
+func applyBinary(source string, fd *diff.FileDiff) (string, error) {
+	patch, ok, err := parseBinaryPatch(fd.Extended)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrNoBinaryData
+	}
+
+	if h, ok := parseGitHeader(fd.Extended); ok && h.oldHash != "" && strings.Trim(h.oldHash, "0") != "" {
+		if !strings.HasPrefix(blobHash([]byte(source)), h.oldHash) {
+			return "", fmt.Errorf("source doesn't have blob hash %s: %w", h.oldHash, ErrContentMismatch)
+		}
+	}
+
+	result, err := patch.forward.apply([]byte(source))
+	if err != nil {
+		return "", err
+	}
+	return string(result), nil
+}
+
+// reversedBinaryExtended returns git extended header lines of a binary file diff,
+// already reversed by reversedExtended, with the parts of the "GIT binary patch"
+// swapped and the names in "Binary files" lines swapped.
+func reversedBinaryExtended(extended []string) []string {
+	for k, line := range extended {
+		if strings.HasPrefix(line, "Binary files ") && strings.HasSuffix(line, " differ") {
+			names := strings.TrimSuffix(strings.TrimPrefix(line, "Binary files "), " differ")
+			if parts := strings.Split(names, " and "); len(parts) == 2 {
+				from, to := parts[0], parts[1]
+				if strings.HasPrefix(from, "a/") && strings.HasPrefix(to, "b/") {
+					from, to = "a/"+to[2:], "b/"+from[2:]
+				} else {
+					from, to = to, from
+				}
+				extended[k] = fmt.Sprintf("Binary files %s and %s differ", from, to)
+			}
+		}
+		if line != binaryPatchHeader {
+			continue
+		}
+
+		// Both parts end with an empty line
+		rest := extended[k+1:]
+		end := 0
+		for end < len(rest) && rest[end] != "" {
+			end++
+		}
+		if end == len(rest) {
+			break
+		}
+		forward, reverse := rest[:end+1], rest[end+1:]
+		if len(reverse) == 0 {
+			// Without the reverse part the patch can't be undone
+			break
+		}
+		swapped := append(append([]string{}, reverse...), forward...)
+		return append(extended[:k+1], swapped...)
+	}
+	return extended
+}
+
+// binaryResult returns the content of the file a binary file diff results in,
+// and false if it doesn't tell, since it has no data or only a delta.
+func binaryResult(fd *diff.FileDiff) ([]byte, bool) {
+	patch, ok, err := parseBinaryPatch(fd.Extended)
+	if err != nil || !ok || patch.forward.delta {
+		return nil, false
+	}
+	return patch.forward.data, true
+}
+
+// binaryInterFileDiff returns the diff between a file patched with oldFileDiff and
+// the same file patched with newFileDiff, if any of them is binary. The contents of
+// the patched files are compared if both diffs give them, their blob hashes otherwise.
+func binaryInterFileDiff(oldFileDiff, newFileDiff *diff.FileDiff) *diff.FileDiff {
+	oldContent, oldOK := binaryResult(oldFileDiff)
+	newContent, newOK := binaryResult(newFileDiff)
+	return binaryFileDiff(oldFileDiff, newFileDiff, oldContent, newContent, oldOK && newOK)
+}
+
+// binaryFileDiff returns a git binary file diff between the file patched with
+// oldFileDiff, with content oldContent, and the one patched with newFileDiff,
+// with content newContent. If contents aren't known, the diff tells that the files
+// differ only, unless blob hashes of oldFileDiff and newFileDiff match.
+// The FileDiff returned prints as nothing if the files are the same.
+func binaryFileDiff(oldFileDiff, newFileDiff *diff.FileDiff, oldContent, newContent []byte, known bool) *diff.FileDiff {
+	oldHeader, oldGit := parseGitHeader(oldFileDiff.Extended)
+	newHeader, newGit := parseGitHeader(newFileDiff.Extended)
+	from, to := stripPath(oldFileDiff.NewName, 1), stripPath(newFileDiff.NewName, 1)
+	if oldGit {
+		from = oldHeader.newName
+	}
+	if newGit {
+		to = newHeader.newName
+	}
+	result := &diff.FileDiff{OrigName: "a/" + from, NewName: "b/" + to}
+
+	oldHash, newHash := oldHeader.newHash, newHeader.newHash
+	if known {
+		oldHash, newHash = blobHash(oldContent), blobHash(newContent)
+	}
+	sameHash := oldHash != "" && newHash != "" &&
+		(strings.HasPrefix(oldHash, newHash) || strings.HasPrefix(newHash, oldHash))
+	if from == to && (known && bytes.Equal(oldContent, newContent) || !known && sameHash) {
+		return result
+	}
+
+	result.Extended = []string{fmt.Sprintf("diff --git a/%s b/%s", from, to)}
+	if from != to {
+		result.Extended = append(result.Extended, "rename from "+from, "rename to "+to)
+	}
+	if oldHash != "" && newHash != "" {
+		index := "index " + oldHash + ".." + newHash
+		if oldHeader.newMode != "" && oldHeader.newMode == newHeader.newMode {
+			index += " " + oldHeader.newMode
+		}
+		result.Extended = append(result.Extended, index)
+	}
+	if !known {
+		result.Extended = append(result.Extended, fmt.Sprintf("Binary files a/%s and b/%s differ", from, to))
+		return result
+	}
+	result.Extended = append(result.Extended, binaryPatchHeader)
+	result.Extended = append(result.Extended, binaryHunkLines(newContent)...)
+	result.Extended = append(result.Extended, binaryHunkLines(oldContent)...)
+	return result
+}
+
+// ErrBadBinaryPatch indicates that the data of a "GIT binary patch" is malformed.
+var ErrBadBinaryPatch = errors.New("bad binary patch")
+
+// ErrNoBinaryData indicates that a binary file diff can't be applied, since it
+// tells only that files differ ("Binary files ... differ").
+var ErrNoBinaryData = errors.New("binary diff without data")
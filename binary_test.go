@@ -0,0 +1,181 @@
+package patchutils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const (
+	binaryOld = "\x00\x01\x02abc\x00"
+
+	// binaryLiteralDiff changes binaryOld into "\x00\x01\x02abd\x00xyz"
+	binaryLiteralDiff = "diff --git a/b.bin b/b.bin\n" +
+		"index ffd672f3b574cfc40e6e61ab07f239cb765303cf..b098402d73a9c76f0dd66115a6097a4858aa3446 100644\n" +
+		"GIT binary patch\n" +
+		"literal 10\nRcmZQzWJ*j*VW_CA0ssl#0+s*(\n\n" +
+		"literal 7\nOcmZQzWJ*j*W&i*KhXE=8\n\n"
+	// binaryLiteralDiff2 changes binaryOld into "\x00\x09\x02abd\x00"
+	binaryLiteralDiff2 = "diff --git a/b.bin b/b.bin\n" +
+		"index ffd672f3b574cfc40e6e61ab07f239cb765303cf..9b36a12d3bc5bddd14763af39e4c9d2b0246eb00 100644\n" +
+		"GIT binary patch\n" +
+		"literal 7\nOcmZSJWJ*j*VE_OFxdAf(\n\n" +
+		"literal 7\nOcmZQzWJ*j*W&i*KhXE=8\n\n"
+	// binaryDeltaDiff changes byte 1000 of binaryBig to 0 and inserts "\x00inserted" after it
+	binaryDeltaDiff = "diff --git a/big.bin b/big.bin\n" +
+		"index e57fd5b4e8e07e39a62591e0851986e97116111c..2aba22db5edbbf39bcbb242721c875fdbeb9fc7e 100644\n" +
+		"GIT binary patch\n" +
+		"delta 22\ndcmZn==oHxSf|-kfAv3QywWuUDW#db6764aB2jTz#\n\n" +
+		"delta 14\nVcmeAaXb{-&f_dQ!=8Z2T7y&K61_J;9\n\n"
+	binaryTextDiff = "diff --git a/t.txt b/t.txt\nindex ce01362..94954ab 100644\n" +
+		"--- a/t.txt\n+++ b/t.txt\n@@ -1 +1,2 @@\n hello\n+world\n"
+)
+
+// binaryBig returns the content binaryDeltaDiff applies to.
+func binaryBig() string {
+	var b bytes.Buffer
+	for k := 0; k < 8; k++ {
+		for c := 0; c < 256; c++ {
+			b.WriteByte(byte(c))
+		}
+	}
+	return b.String()
+}
+
+var applyBinaryTests = []struct {
+	name   string
+	patch  string
+	source string
+	result string
+	err    error
+}{
+	{
+		name:   "literal",
+		patch:  binaryLiteralDiff,
+		source: binaryOld,
+		result: "\x00\x01\x02abd\x00xyz",
+	},
+	{
+		name:   "delta",
+		patch:  binaryDeltaDiff,
+		source: binaryBig(),
+		result: binaryBig()[:1000] + "\x00\x00inserted" + binaryBig()[1001:],
+	},
+	{
+		name:   "source with other hash",
+		patch:  binaryLiteralDiff,
+		source: "other",
+		err:    ErrContentMismatch,
+	},
+	{
+		name:   "no data",
+		patch:  "diff --git a/b.bin b/b.bin\nindex ffd672f..9b36a12 100644\nBinary files a/b.bin and b/b.bin differ\n",
+		source: binaryOld,
+		err:    ErrNoBinaryData,
+	},
+}
+
+func TestApplyBinary(t *testing.T) {
+	for _, tt := range applyBinaryTests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := diff.ParseFileDiff([]byte(tt.patch))
+			if err != nil {
+				t.Fatalf("parsing patch: %v", err)
+			}
+			result, err := ApplyFileDiff(tt.source, fd, ApplyOptions{})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ApplyFileDiff: got error %v; want error %v", err, tt.err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, tt.result)
+			}
+		})
+	}
+}
+
+func TestBase85Line(t *testing.T) {
+	for _, n := range []int{1, 4, 26, 27, 52} {
+		data := make([]byte, n)
+		for k := range data {
+			data[k] = byte(k * 37)
+		}
+		line := encodeBase85Line(data)
+		decoded, err := decodeBase85Line(line)
+		if err != nil {
+			t.Fatalf("decodeBase85Line(%q): got error %v; want error nil", line, err)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("decodeBase85Line(encodeBase85Line(%x)): got %x", data, decoded)
+		}
+	}
+	if _, err := decodeBase85Line("B0"); !errors.Is(err, ErrBadBinaryPatch) {
+		t.Errorf("decodeBase85Line(%q): got error %v; want error %v", "B0", err, ErrBadBinaryPatch)
+	}
+}
+
+func TestInterDiffBinary(t *testing.T) {
+	result, err := InterDiff(strings.NewReader(binaryLiteralDiff+binaryTextDiff),
+		strings.NewReader(binaryLiteralDiff2+binaryTextDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	fileDiffs, err := diff.NewMultiFileDiffReader(strings.NewReader(result)).ReadAllFiles()
+	if err != nil {
+		t.Fatalf("parsing result: %v", err)
+	}
+	if len(fileDiffs) == 0 || !isBinaryFileDiff(fileDiffs[0]) {
+		t.Fatalf("InterDiff: got %q; want a binary file diff first", result)
+	}
+
+	// The result changes the file patched with the old diff into the one patched with the new diff
+	applied, err := ApplyFileDiff("\x00\x01\x02abd\x00xyz", fileDiffs[0], ApplyOptions{})
+	if err != nil {
+		t.Fatalf("applying result: %v", err)
+	}
+	if want := "\x00\x09\x02abd\x00"; applied != want {
+		t.Errorf("Applied result mismatch.\nGot:\n%q\nWant:\n%q\n", applied, want)
+	}
+
+	result, err = InterDiff(strings.NewReader(binaryLiteralDiff), strings.NewReader(binaryLiteralDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	if result != "" {
+		t.Errorf("InterDiff of the same binary diffs: got %q; want none", result)
+	}
+}
+
+func TestInterDiffBinaryWithoutData(t *testing.T) {
+	oldDiff := "diff --git a/b.bin b/b.bin\nindex ffd672f..b098402 100644\nBinary files a/b.bin and b/b.bin differ\n"
+	newDiff := "diff --git a/b.bin b/b.bin\nindex ffd672f..9b36a12 100644\nBinary files a/b.bin and b/b.bin differ\n"
+	want := "diff --git a/b.bin b/b.bin\nindex b098402..9b36a12 100644\nBinary files a/b.bin and b/b.bin differ\n"
+
+	result, err := InterDiff(strings.NewReader(oldDiff), strings.NewReader(newDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestReverseBinary(t *testing.T) {
+	reversed, err := Reverse(strings.NewReader(binaryLiteralDiff))
+	if err != nil {
+		t.Fatalf("Reverse: got error %v; want error nil", err)
+	}
+	fd, err := diff.ParseFileDiff([]byte(reversed))
+	if err != nil {
+		t.Fatalf("parsing reversed patch: %v", err)
+	}
+	result, err := ApplyFileDiff("\x00\x01\x02abd\x00xyz", fd, ApplyOptions{})
+	if err != nil {
+		t.Fatalf("applying reversed patch: %v", err)
+	}
+	if result != binaryOld {
+		t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, binaryOld)
+	}
+}
@@ -0,0 +1,64 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// BisectHunks returns the first hunk of patch which makes test fail, that is
+// the hunk h for which test reports true for source patched with the hunks
+// before h, and false once h is applied too. test is called O(log n) times
+// for a patch of n hunks, and is expected to keep failing once it fails.
+//
+// ErrTestFailsWithoutPatch is returned if test fails for source itself,
+// and ErrNoFailingHunk if it passes for source patched with all of patch.
+func BisectHunks(patch *diff.FileDiff, test func(content string) bool, source string) (*diff.Hunk, error) {
+	if !test(source) {
+		return nil, ErrTestFailsWithoutPatch
+	}
+
+	// contents caches source patched with the first k hunks
+	contents := make(map[int]string)
+	var applyErr error
+	passes := func(k int) bool {
+		if applyErr != nil {
+			return false
+		}
+		content, ok := contents[k]
+		if !ok {
+			var err error
+			content, err = applyDiff(source, &diff.FileDiff{Hunks: patch.Hunks[:k]}, ApplyOptions{})
+			if err != nil {
+				applyErr = fmt.Errorf("applying first %d hunks: %w", k, err)
+				return false
+			}
+			contents[k] = content
+		}
+		return test(content)
+	}
+
+	if passes(len(patch.Hunks)) {
+		return nil, ErrNoFailingHunk
+	}
+	if applyErr != nil {
+		return nil, applyErr
+	}
+
+	// Smallest number of hunks for which test fails, at least 1 since source passes
+	k := 1 + sort.Search(len(patch.Hunks)-1, func(i int) bool {
+		return !passes(i + 1)
+	})
+	if applyErr != nil {
+		return nil, applyErr
+	}
+	return patch.Hunks[k-1], nil
+}
+
+// ErrTestFailsWithoutPatch indicates that a test used for bisection fails before any hunk is applied.
+var ErrTestFailsWithoutPatch = errors.New("test fails without patch")
+
+// ErrNoFailingHunk indicates that a test used for bisection passes with all hunks applied.
+var ErrNoFailingHunk = errors.New("test passes with all hunks")
@@ -0,0 +1,86 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+var bisectHunksTests = []struct {
+	name string
+	// breaks is the line which makes the test fail
+	breaks   string
+	wantHunk int
+	wantErr  error
+}{
+	{
+		name:     "first hunk",
+		breaks:   "B",
+		wantHunk: 0,
+	},
+	{
+		name:     "middle hunk",
+		breaks:   "E",
+		wantHunk: 1,
+	},
+	{
+		name:     "last hunk",
+		breaks:   "H",
+		wantHunk: 2,
+	},
+	{
+		name:    "no failing hunk",
+		breaks:  "X",
+		wantErr: ErrNoFailingHunk,
+	},
+	{
+		name:    "failing source",
+		breaks:  "a",
+		wantErr: ErrTestFailsWithoutPatch,
+	},
+}
+
+func TestBisectHunks(t *testing.T) {
+	source := "a\nb\nc\nd\ne\nf\ng\nh\ni\n"
+	fd, err := diff.ParseFileDiff([]byte("--- foo\n+++ foo\n" +
+		"@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n" +
+		"@@ -4,3 +4,3 @@\n d\n-e\n+E\n f\n" +
+		"@@ -7,3 +7,3 @@\n g\n-h\n+H\n i\n"))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+
+	for _, tt := range bisectHunksTests {
+		t.Run(tt.name, func(t *testing.T) {
+			test := func(content string) bool {
+				return !strings.Contains(content, tt.breaks+"\n")
+			}
+			h, err := BisectHunks(fd, test, source)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("BisectHunks: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BisectHunks: got error %v; want error nil", err)
+			}
+			if h != fd.Hunks[tt.wantHunk] {
+				t.Errorf("BisectHunks: got hunk %s; want hunk %s", hunkHeader(h), hunkHeader(fd.Hunks[tt.wantHunk]))
+			}
+		})
+	}
+}
+
+func TestBisectHunksMismatch(t *testing.T) {
+	fd, err := diff.ParseFileDiff([]byte("--- foo\n+++ foo\n@@ -1,1 +1,1 @@\n-x\n+X\n"))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+	_, err = BisectHunks(fd, func(string) bool { return true }, "a\n")
+	if !errors.Is(err, ErrContentMismatch) {
+		t.Errorf("BisectHunks: got error %v; want error %v", err, ErrContentMismatch)
+	}
+}
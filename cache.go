@@ -0,0 +1,126 @@
+package patchutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// resultCacheVersion is increased whenever results of the same inputs may change,
+// which invalidates all caches written before.
+const resultCacheVersion = 4
+
+// ResultCache stores results of mixed mode for pairs of files, keyed by a hash
+// of their sources, diffs and the options in use, so that pairs with unchanged
+// inputs aren't computed again. Changing any option invalidates all results.
+// It is safe for concurrent use.
+type ResultCache struct {
+	mu      sync.Mutex
+	entries map[string]string
+	// used holds keys looked up or stored since the cache was created or loaded.
+	used map[string]bool
+}
+
+// resultCacheFile is the serialized form of a ResultCache.
+type resultCacheFile struct {
+	Version int               `json:"version"`
+	Entries map[string]string `json:"entries"`
+}
+
+// NewResultCache returns an empty ResultCache.
+func NewResultCache() *ResultCache {
+	return &ResultCache{
+		entries: make(map[string]string),
+		used:    make(map[string]bool),
+	}
+}
+
+// LoadResultCache reads a cache written by Save.
+// A cache written by an incompatible version of this package is returned empty.
+func LoadResultCache(r io.Reader) (*ResultCache, error) {
+	var f resultCacheFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return nil, fmt.Errorf("reading result cache: %w", err)
+	}
+
+	c := NewResultCache()
+	if f.Version == resultCacheVersion {
+		for key, result := range f.Entries {
+			c.entries[key] = result
+		}
+	}
+	return c, nil
+}
+
+// Save writes the results looked up or stored since c was created or loaded to w,
+// so results of files that are gone don't pile up.
+func (c *ResultCache) Save(w io.Writer) error {
+	c.mu.Lock()
+	f := resultCacheFile{Version: resultCacheVersion, Entries: make(map[string]string, len(c.used))}
+	for key := range c.used {
+		f.Entries[key] = c.entries[key]
+	}
+	c.mu.Unlock()
+
+	if err := json.NewEncoder(w).Encode(f); err != nil {
+		return fmt.Errorf("writing result cache: %w", err)
+	}
+	return nil
+}
+
+// get returns the result stored for key.
+func (c *ResultCache) get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result, ok := c.entries[key]
+	if ok {
+		c.used[key] = true
+	}
+	return result, ok
+}
+
+// put stores result for key.
+func (c *ResultCache) put(key, result string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = result
+	c.used[key] = true
+}
+
+// mixedModeKey returns the cache key of mixed mode for the given inputs and opts.
+func mixedModeKey(oldSource, newSource string, oldFileDiff, newFileDiff *diff.FileDiff,
+	opts MixedModeOptions) (string, error) {
+	h := sha256.New()
+	opts.Cache = nil
+	opts.OnlyInFormatter = nil
+	opts.Resume = nil
+	opts.Symbols = nil
+	opts.Progress = nil
+	// Names mapped by PathMapper are part of the FileDiffs
+	opts.PathMapper = nil
+	writeKeyPart(h, fmt.Sprintf("%d %+v", resultCacheVersion, opts))
+	writeKeyPart(h, oldSource)
+	writeKeyPart(h, newSource)
+	for _, fd := range []*diff.FileDiff{oldFileDiff, newFileDiff} {
+		printed, err := diff.PrintFileDiff(fd)
+		if err != nil {
+			return "", fmt.Errorf("printing diff for file %q: %w", fd.OrigName, err)
+		}
+		writeKeyPart(h, string(printed))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeKeyPart writes s to h, prefixed with its length, so that parts can't run into each other.
+func writeKeyPart(h hash.Hash, s string) {
+	fmt.Fprintf(h, "%d:", len(s))
+	io.WriteString(h, s)
+}
@@ -0,0 +1,103 @@
+package patchutils
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+// mixedModeWithCache computes mixed mode of the source_1 test directories with cache.
+func mixedModeWithCache(t *testing.T, opts MixedModeOptions) string {
+	t.Helper()
+
+	oldDiff, err := os.Open(testFile("s1_a.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldDiff.Close()
+	newDiff, err := os.Open(testFile("s1_b_c.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newDiff.Close()
+
+	opts.Dir = testFilesDir
+	result, err := MixedModePathWithOptions("source_1", "source_1_b", oldDiff, newDiff, opts)
+	if err != nil {
+		t.Fatalf("MixedModePathWithOptions: got error %v; want error nil", err)
+	}
+	return result
+}
+
+func TestResultCache(t *testing.T) {
+	uncached := mixedModeWithCache(t, MixedModeOptions{})
+
+	cache := NewResultCache()
+	if result := mixedModeWithCache(t, MixedModeOptions{Cache: cache}); result != uncached {
+		t.Errorf("Result with empty cache mismatch.\nGot:\n%s\nWant:\n%s\n", result, uncached)
+	}
+	if len(cache.entries) == 0 {
+		t.Fatalf("Cache is empty after computing results")
+	}
+
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatalf("Save: got error %v; want error nil", err)
+	}
+	loaded, err := LoadResultCache(&buf)
+	if err != nil {
+		t.Fatalf("LoadResultCache: got error %v; want error nil", err)
+	}
+	if len(loaded.entries) != len(cache.entries) {
+		t.Fatalf("LoadResultCache: got %d entries; want %d", len(loaded.entries), len(cache.entries))
+	}
+
+	// Results must come from the cache
+	for key := range loaded.entries {
+		loaded.entries[key] = "cached\n"
+	}
+	if result := mixedModeWithCache(t, MixedModeOptions{Cache: loaded}); !strings.Contains(result, "cached\n") {
+		t.Errorf("Result wasn't served from cache:\n%s", result)
+	}
+
+	// Other options invalidate results
+	if result := mixedModeWithCache(t, MixedModeOptions{Cache: loaded, HunkBreakGap: 7}); strings.Contains(result, "cached\n") {
+		t.Errorf("Result computed with other options was served from cache:\n%s", result)
+	}
+}
+
+func TestLoadResultCacheOtherVersion(t *testing.T) {
+	cache, err := LoadResultCache(strings.NewReader(`{"version": 0, "entries": {"key": "result"}}`))
+	if err != nil {
+		t.Fatalf("LoadResultCache: got error %v; want error nil", err)
+	}
+	if len(cache.entries) != 0 {
+		t.Errorf("LoadResultCache of other version: got %d entries; want 0", len(cache.entries))
+	}
+
+	if _, err := LoadResultCache(strings.NewReader("{")); err == nil {
+		t.Errorf("LoadResultCache of truncated cache: got error nil; want error")
+	}
+}
+
+func TestResultCacheSaveUsedOnly(t *testing.T) {
+	cache := NewResultCache()
+	cache.entries["stale"] = "result"
+	cache.put("fresh", "result")
+
+	var buf bytes.Buffer
+	if err := cache.Save(&buf); err != nil {
+		t.Fatalf("Save: got error %v; want error nil", err)
+	}
+	loaded, err := LoadResultCache(&buf)
+	if err != nil {
+		t.Fatalf("LoadResultCache: got error %v; want error nil", err)
+	}
+	if _, ok := loaded.entries["stale"]; ok {
+		t.Errorf("Save kept an entry that wasn't used")
+	}
+	if _, ok := loaded.entries["fresh"]; !ok {
+		t.Errorf("Save dropped an entry that was used")
+	}
+}
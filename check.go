@@ -0,0 +1,92 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Report tells whether the file diffs of a patch apply, as found by Check.
+type Report struct {
+	// Files are the reports of the file diffs of the patch, in order.
+	Files []FileReport
+}
+
+// FileReport tells whether a file diff applies.
+type FileReport struct {
+	FileDiff *diff.FileDiff
+	// Hunks are the results of all hunks of FileDiff, in order, if the file
+	// could be patched.
+	Hunks []HunkResult
+	// Err is why the file can't be patched at all, e.g. ErrFileNotFound.
+	Err error
+}
+
+// OK reports whether the file diff applies, with all of its hunks.
+func (r FileReport) OK() bool {
+	if r.Err != nil {
+		return false
+	}
+	for _, h := range r.Hunks {
+		if h.Err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// OK reports whether the whole patch applies.
+func (r Report) OK() bool {
+	for _, f := range r.Files {
+		if !f.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// Check reports whether patch, a unified diff of one or more files, applies to
+// the directory tree at root as ApplyPath applies it, without writing anything,
+// like git apply --check. Unlike ApplyPath, it doesn't stop at the first hunk
+// which doesn't apply: such hunks are reported with their errors and skipped,
+// and later diffs of the same file are checked against it without them. Errors
+// are returned only for patches which can't be read.
+func Check(root string, patch io.Reader) (Report, error) {
+	return CheckWithOptions(root, patch, ApplyOptions{})
+}
+
+// CheckWithOptions is like Check, with hunks looked for as configured by opts, like
+// ApplyPathWithOptions does. opts.Report isn't called.
+func CheckWithOptions(root string, patch io.Reader, opts ApplyOptions) (Report, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return Report{}, fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return Report{}, ErrEmptyDiffFile
+	}
+
+	var report Report
+	var hunks []HunkResult
+	report.Files = make([]FileReport, len(fileDiffs))
+	opts.Report = func(r HunkResult) {
+		hunks = append(hunks, r)
+	}
+	opts.skipFailed = opts.Report
+	t := newPatchTree(func(name string) (string, error) {
+		content, err := ioutil.ReadFile(longPath(filepath.Join(root, filepath.FromSlash(name))))
+		return string(content), err
+	}, 0, opts)
+	for k, fd := range fileDiffs {
+		hunks = nil
+		err := t.apply(fd)
+		report.Files[k] = FileReport{FileDiff: fd, Err: err}
+		if err == nil {
+			report.Files[k].Hunks = hunks
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,105 @@
+package patchutils
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checkedHunk is the part of a HunkResult checked by tests.
+type checkedHunk struct {
+	offset, fuzz int
+	err          error
+}
+
+var checkTests = []struct {
+	name  string
+	files map[string]string
+	patch string
+	opts  ApplyOptions
+	// want are the results of the hunks of every file, nil for files failing as a whole
+	want    [][]checkedHunk
+	fileErr []error
+	ok      bool
+}{
+	{
+		name:  "applies",
+		files: map[string]string{"a.txt": "a\nb\nc\n"},
+		patch: "--- a.txt\n+++ a.txt\n@@ -2 +2 @@\n-b\n+B\n",
+		want:  [][]checkedHunk{{{}}},
+		ok:    true,
+	},
+	{
+		name:  "offset and fuzz",
+		files: map[string]string{"a.txt": "x\na\nb\nc\nd\ne\nf\ng\n"},
+		patch: "--- a.txt\n+++ a.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -5,3 +5,3 @@\n z\n-f\n+F\n g\n",
+		opts:  ApplyOptions{MaxOffset: 1, Fuzz: 1},
+		want:  [][]checkedHunk{{{offset: 1}, {offset: 1, fuzz: 1}}},
+		ok:    true,
+	},
+	{
+		name:  "failing hunk is skipped",
+		files: map[string]string{"a.txt": "a\nb\nc\nd\n"},
+		patch: "--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n-x\n+X\n@@ -4 +4 @@\n-d\n+D\n",
+		want:  [][]checkedHunk{{{err: ErrContentMismatch}, {}}},
+	},
+	{
+		name:    "missing file",
+		files:   map[string]string{"a.txt": "a\n"},
+		patch:   "--- b.txt\n+++ b.txt\n@@ -1 +1 @@\n-b\n+B\n--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n-a\n+A\n",
+		want:    [][]checkedHunk{nil, {{}}},
+		fileErr: []error{ErrFileNotFound, nil},
+	},
+}
+
+func TestCheck(t *testing.T) {
+	for _, tt := range checkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeTestTree(t, tt.files)
+			defer os.RemoveAll(root)
+
+			report, err := CheckWithOptions(root, strings.NewReader(tt.patch), tt.opts)
+			if err != nil {
+				t.Fatalf("Check: got error %v; want error nil", err)
+			}
+			if report.OK() != tt.ok {
+				t.Errorf("OK() = %t; want %t", report.OK(), tt.ok)
+			}
+			if len(report.Files) != len(tt.want) {
+				t.Fatalf("Got %d files; want %d", len(report.Files), len(tt.want))
+			}
+			for k, f := range report.Files {
+				var wantErr error
+				if tt.fileErr != nil {
+					wantErr = tt.fileErr[k]
+				}
+				if !errors.Is(f.Err, wantErr) {
+					t.Errorf("File %d: got error %v; want error %v", k, f.Err, wantErr)
+				}
+				var got []checkedHunk
+				for _, h := range f.Hunks {
+					got = append(got, checkedHunk{offset: h.Offset, fuzz: h.Fuzz, err: h.Err})
+				}
+				for i := range got {
+					if i < len(tt.want[k]) && errors.Is(got[i].err, tt.want[k][i].err) {
+						got[i].err = tt.want[k][i].err
+					}
+				}
+				if !reflect.DeepEqual(got, tt.want[k]) {
+					t.Errorf("File %d: got hunks %+v; want %+v", k, got, tt.want[k])
+				}
+			}
+			if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, tt.files) {
+				t.Errorf("Tree changed.\nGot:\n%v\nWant:\n%v\n", currentFiles, tt.files)
+			}
+		})
+	}
+}
+
+func TestCheckEmptyPatch(t *testing.T) {
+	if _, err := Check(".", strings.NewReader("")); !errors.Is(err, ErrEmptyDiffFile) {
+		t.Errorf("Check: got error %v; want error %v", err, ErrEmptyDiffFile)
+	}
+}
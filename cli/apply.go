@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+type applyCmd struct {
+	patch       string
+	dir         string
+	strip       int
+	dryRun      bool
+	reverse     bool
+	preview     bool
+	interactive bool
+	save        string
+}
+
+// answers reads answers to prompts from standard input.
+var answers = bufio.NewReader(os.Stdin)
+
+func init() {
+	subcommands.Register(&applyCmd{}, "")
+}
+
+func (*applyCmd) Name() string { return "apply" }
+func (*applyCmd) Synopsis() string {
+	return "apply a patch to a directory."
+}
+func (*applyCmd) Usage() string {
+	return "apply -patch=<patch path> -dir=<directory>: " +
+		"Apply the patch to the directory, like patch(1), leaving it untouched if any file of the patch doesn't apply. " +
+		"Exit with status 0 if it applies, 1 if it doesn't or isn't confirmed and 2 on errors.\n"
+}
+
+func (c *applyCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.patch, "patch", "", "path to the patch, or \"-\" for standard input")
+	f.StringVar(&c.dir, "dir", ".", "directory the patch is applied to")
+	f.IntVar(&c.strip, "p", 0, "number of leading path components to strip from file names in the patch")
+	f.BoolVar(&c.dryRun, "dry-run", false, "print hunks which don't apply or apply only at another position "+
+		"instead of applying the patch, like the check command")
+	f.BoolVar(&c.reverse, "reverse", false, "apply the patch reversed, undoing its changes")
+	f.BoolVar(&c.preview, "preview", false, "print the diff of the changes to the directory and ask for confirmation "+
+		"before applying the patch")
+	f.BoolVar(&c.interactive, "interactive", false, "ask for every hunk whether to apply it, skip it or edit it in $EDITOR, "+
+		"like git add -p")
+	f.StringVar(&c.save, "save", "", "path to save the patch of the hunks selected with -interactive to")
+}
+
+func (c *applyCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.patch == "" {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	if c.strip < 0 {
+		glog.Errorf("Error: -p must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	if c.dryRun && c.preview {
+		glog.Errorf("Error: -dry-run and -preview can't be combined")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	if c.interactive && c.patch == stdinPath {
+		glog.Errorf("Error: -interactive needs standard input for answers, the patch can't be read from it")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	if c.save != "" && !c.interactive {
+		glog.Errorf("Error: -save requires -interactive")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	p, err := openDiff(c.patch)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", c.patch)
+		return exitTrouble
+	}
+	defer p.Close()
+
+	patchSet, err := patchutils.ReadPatchSet(p)
+	if err != nil {
+		glog.Errorf("Failed to read patch %q: %v\n", c.patch, err)
+		return exitTrouble
+	}
+	patchSet = patchSet.Strip(c.strip)
+	if c.reverse {
+		patchSet = patchSet.Reverse()
+	}
+	var patch bytes.Buffer
+	if err := patchSet.Write(&patch); err != nil {
+		glog.Errorf("Failed to print patch %q: %v\n", c.patch, err)
+		return exitTrouble
+	}
+
+	if c.interactive {
+		selected, err := patchutils.SelectHunks(&patch, chooseHunk)
+		if err != nil {
+			glog.Errorf("Error during selecting hunks of %q: %v\n", c.patch, err)
+			return exitTrouble
+		}
+		if c.save != "" {
+			if err := ioutil.WriteFile(c.save, []byte(selected), 0644); err != nil {
+				glog.Errorf("Failed to save selected hunks to %q: %v\n", c.save, err)
+				return exitTrouble
+			}
+		}
+		if selected == "" {
+			fmt.Println("No hunks selected.")
+			return exitSame
+		}
+		patch.Reset()
+		patch.WriteString(selected)
+	}
+
+	if c.dryRun {
+		report, err := patchutils.Check(c.dir, &patch)
+		if err != nil {
+			glog.Errorf("Error during checking %q: %v\n", c.patch, err)
+			return exitTrouble
+		}
+		printReport(report)
+		if !report.OK() {
+			return exitDifferent
+		}
+		return exitSame
+	}
+
+	if c.preview {
+		preview, err := patchutils.PreviewPath(c.dir, bytes.NewReader(patch.Bytes()))
+		if err != nil {
+			return c.failure(err)
+		}
+		fmt.Print(preview)
+		if !confirm("Apply these changes [y,n]? ") {
+			fmt.Println("Patch not applied.")
+			return exitDifferent
+		}
+	}
+
+	if err := patchutils.ApplyPathContext(ctx, c.dir, &patch, patchutils.ApplyOptions{}); err != nil {
+		return c.failure(err)
+	}
+	return exitSame
+}
+
+// failure reports err, why the patch wasn't applied, and returns the exit status for it.
+func (c *applyCmd) failure(err error) subcommands.ExitStatus {
+	var applyErr *patchutils.ApplyError
+	if errors.As(err, &applyErr) || errors.Is(err, patchutils.ErrFileNotFound) || errors.Is(err, patchutils.ErrFileExists) {
+		fmt.Printf("%v\n", err)
+		return exitDifferent
+	}
+	glog.Errorf("Error during applying %q: %v\n", c.patch, err)
+	return exitTrouble
+}
+
+// ask prints prompt and returns the answer read from standard input in lower case,
+// or the error reading it, io.EOF at the end of input.
+func ask(prompt string) (string, error) {
+	fmt.Print(prompt)
+	answer, err := answers.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Println()
+		return "", err
+	}
+	return strings.ToLower(strings.TrimSpace(answer)), nil
+}
+
+// confirm prints prompt and reports whether the answer read from standard input
+// is yes. The end of input, as when the patch is read from it, counts as no.
+func confirm(prompt string) bool {
+	answer, err := ask(prompt)
+	return err == nil && (answer == "y" || answer == "yes")
+}
+
+// chooseHunk prints the i-th hunk of fd and asks whether to apply it, skip it or
+// edit it, like git add -p, returning the hunk to apply, if any. Hunks are skipped
+// once standard input ends.
+func chooseHunk(fd *diff.FileDiff, i int) (*diff.Hunk, error) {
+	if i == 0 {
+		fmt.Printf("--- %s\n+++ %s\n", fd.OrigName, fd.NewName)
+	}
+	h := fd.Hunks[i]
+	printed, err := diff.PrintHunks([]*diff.Hunk{h})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Print(string(printed))
+
+	for {
+		answer, err := ask(fmt.Sprintf("(%d/%d) Apply this hunk [y,n,e,?]? ", i+1, len(fd.Hunks)))
+		switch {
+		case err != nil || answer == "n":
+			return nil, nil
+		case answer == "y":
+			return h, nil
+		case answer == "e":
+			edited, err := editHunk(h)
+			if err != nil {
+				fmt.Printf("Hunk not edited: %v\n", err)
+				continue
+			}
+			return edited, nil
+		default:
+			fmt.Println("y - apply this hunk\nn - do not apply this hunk\ne - manually edit this hunk")
+		}
+	}
+}
+
+// editHunkHelp is appended to hunks edited by editHunk.
+const editHunkHelp = "# To remove '-' lines, make them ' ' lines (context).\n" +
+	"# To remove '+' lines, delete them.\n" +
+	"# Lines starting with # will be removed.\n"
+
+// editHunk opens h in $EDITOR, vi if it isn't set, and returns the edited copy.
+// Lines starting with # and the hunk header are ignored, and the header is recounted.
+func editHunk(h *diff.Hunk) (*diff.Hunk, error) {
+	printed, err := diff.PrintHunks([]*diff.Hunk{h})
+	if err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile("", "hunk*.diff")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(string(printed) + editHunkHelp)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{"vi"}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("running %s: %w", editor[0], err)
+	}
+	content, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []patchutils.Line
+	for _, text := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(text, "#") || strings.HasPrefix(text, "@@"):
+		case strings.HasPrefix(text, "\\"):
+			// "\ No newline at end of file" marks the line before it
+			if len(lines) > 0 {
+				lines[len(lines)-1].NoNewline = true
+			}
+		case text == "":
+			// Some editors strip the leading space of empty unchanged lines
+			lines = append(lines, patchutils.Line{Op: patchutils.OpContext})
+		default:
+			lines = append(lines, patchutils.Line{Op: patchutils.LineOp(text[0]), Text: text[1:]})
+		}
+	}
+	edited := *h
+	if err := patchutils.SetHunkLines(&edited, lines); err != nil {
+		return nil, err
+	}
+	return &edited, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+type benchCmd struct {
+	mode      string
+	oldDiff   string
+	newDiff   string
+	oldSource string
+	newSource string
+}
+
+func init() {
+	subcommands.Register(&benchCmd{}, "")
+}
+
+func (*benchCmd) Name() string { return "bench" }
+func (*benchCmd) Synopsis() string {
+	return "benchmark interdiff, mixed mode or apply " +
+		"on the given inputs."
+}
+func (*benchCmd) Usage() string {
+	return "bench -mode=interdiff -olddiff=<oldDiff path> -newdiff=<newDiff path>\n" +
+		"bench -mode=mixed -oldsource=<oldSource path> -olddiff=<oldDiff path> " +
+		"-newsource=<newSource path> -newdiff=<newDiff path>\n" +
+		"bench -mode=apply -oldsource=<source file path> -olddiff=<diff path>: " +
+		"Run the computation repeatedly and report its time and memory per run.\n"
+}
+
+func (c *benchCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.mode, "mode", "interdiff", "computation to benchmark: interdiff, mixed or apply")
+	f.StringVar(&c.oldDiff, "olddiff", "", "path to the old diff, or the diff to apply")
+	f.StringVar(&c.newDiff, "newdiff", "", "path to the new diff")
+	f.StringVar(&c.oldSource, "oldsource", "", "path to the old source, or the source file to patch")
+	f.StringVar(&c.newSource, "newsource", "", "path to the new source")
+}
+
+func (c *benchCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	var run func() error
+	var err error
+	switch c.mode {
+	case "interdiff":
+		run, err = c.interDiff()
+	case "mixed":
+		run, err = c.mixedMode()
+	case "apply":
+		run, err = c.apply()
+	default:
+		glog.Errorf("Error: unknown mode %q\n", c.mode)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	if err != nil {
+		glog.Error(err)
+		return subcommands.ExitFailure
+	}
+	if run == nil {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	// Fail early, instead of benchmarking an error path
+	if err := run(); err != nil {
+		glog.Errorf("Error during %s: %v\n", c.mode, err)
+		return subcommands.ExitFailure
+	}
+
+	result := testing.Benchmark(func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if err := run(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	fmt.Printf("%s\t%s\t%s\n", c.mode, result.String(), result.MemString())
+	return subcommands.ExitSuccess
+}
+
+// interDiff returns the benchmarked function of interdiff mode,
+// or nil if inputs are missing.
+func (c *benchCmd) interDiff() (func() error, error) {
+	if (c.oldDiff == "") || (c.newDiff == "") {
+		return nil, nil
+	}
+	oldD, newD, err := c.readDiffs()
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := patchutils.InterDiff(bytes.NewReader(oldD), bytes.NewReader(newD))
+		return err
+	}, nil
+}
+
+// mixedMode returns the benchmarked function of mixed mode,
+// or nil if inputs are missing.
+func (c *benchCmd) mixedMode() (func() error, error) {
+	if (c.oldSource == "") || (c.oldDiff == "") || (c.newSource == "") || (c.newDiff == "") {
+		return nil, nil
+	}
+	oldD, newD, err := c.readDiffs()
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		_, err := patchutils.MixedModePath(c.oldSource, c.newSource, bytes.NewReader(oldD), bytes.NewReader(newD))
+		return err
+	}, nil
+}
+
+// apply returns the benchmarked function of applying a diff to a file,
+// or nil if inputs are missing.
+func (c *benchCmd) apply() (func() error, error) {
+	if (c.oldSource == "") || (c.oldDiff == "") {
+		return nil, nil
+	}
+	source, err := ioutil.ReadFile(c.oldSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read source %q: %w", c.oldSource, err)
+	}
+	d, err := ioutil.ReadFile(c.oldDiff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read diff %q: %w", c.oldDiff, err)
+	}
+	fd, err := diff.ParseFileDiff(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse diff %q: %w", c.oldDiff, err)
+	}
+	return func() error {
+		_, err := patchutils.ApplyFileDiff(string(source), fd, patchutils.ApplyOptions{})
+		return err
+	}, nil
+}
+
+// readDiffs reads the old and new diffs into memory, so that reading them isn't benchmarked.
+func (c *benchCmd) readDiffs() ([]byte, []byte, error) {
+	oldD, err := ioutil.ReadFile(c.oldDiff)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read oldDiff %q: %w", c.oldDiff, err)
+	}
+	newD, err := ioutil.ReadFile(c.newDiff)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read newDiff %q: %w", c.newDiff, err)
+	}
+	return oldD, newD, nil
+}
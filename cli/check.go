@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type checkCmd struct {
+	root      string
+	patch     string
+	maxOffset int
+	fuzz      int
+}
+
+func init() {
+	subcommands.Register(&checkCmd{}, "")
+}
+
+func (*checkCmd) Name() string { return "check" }
+func (*checkCmd) Synopsis() string {
+	return "check whether a patch applies to a directory, without applying it."
+}
+func (*checkCmd) Usage() string {
+	return "check -root=<directory> -patch=<patch path>: " +
+		"Print how every hunk of the patch applies to the directory, like git apply --check. " +
+		"Exit with status 0 if all of them apply, 1 if some don't and 2 on errors.\n"
+}
+
+func (c *checkCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.root, "root", ".", "directory names in the patch are relative to")
+	f.StringVar(&c.patch, "patch", "", "path to the patch, or \"-\" for standard input")
+	f.IntVar(&c.maxOffset, "max-offset", 0, "how many lines away from the position in its header a hunk may apply")
+	f.IntVar(&c.fuzz, "fuzz", 0, "how many context lines at the start and end of hunks may be ignored")
+}
+
+func (c *checkCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.patch == "" {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	if c.maxOffset < 0 || c.fuzz < 0 {
+		glog.Errorf("Error: -max-offset and -fuzz must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	p, err := openDiff(c.patch)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", c.patch)
+		return exitTrouble
+	}
+	defer p.Close()
+
+	report, err := patchutils.CheckWithOptions(c.root, p, patchutils.ApplyOptions{MaxOffset: c.maxOffset, Fuzz: c.fuzz})
+	if err != nil {
+		glog.Errorf("Error during checking %q: %v\n", c.patch, err)
+		return exitTrouble
+	}
+	printReport(report)
+	if !report.OK() {
+		return exitDifferent
+	}
+	return exitSame
+}
+
+// printReport prints the files of report which can't be patched, and the hunks
+// which don't apply or apply only at another position.
+func printReport(report patchutils.Report) {
+	for _, file := range report.Files {
+		name := file.FileDiff.NewName
+		if file.Err != nil {
+			fmt.Printf("%s: %v\n", name, file.Err)
+			continue
+		}
+		for k, h := range file.Hunks {
+			switch {
+			case h.Err != nil:
+				fmt.Printf("%s: hunk #%d FAILED: %v\n", name, k+1, h.Err)
+			case h.Offset != 0 || h.Fuzz != 0:
+				fmt.Printf("%s: hunk #%d applies with offset %d and fuzz %d\n", name, k+1, h.Offset, h.Fuzz)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type compareCmd struct {
+	semantic bool
+}
+
+func init() {
+	subcommands.Register(&compareCmd{}, "")
+}
+
+func (*compareCmd) Name() string { return "compare" }
+func (*compareCmd) Synopsis() string {
+	return "report whether two patches are equal."
+}
+func (*compareCmd) Usage() string {
+	return "compare [-semantic] <patch path> <patch path>: " +
+		"Report whether the patches are equal, byte by byte or with -semantic by the changes they make, " +
+		"and exit with status 1 if they differ and 2 on errors.\n"
+}
+
+func (c *compareCmd) SetFlags(f *flag.FlagSet) {
+	f.BoolVar(&c.semantic, "semantic", false, "compare the changes of the patches, whatever the order of "+
+		"their files, the shape of their hunks and their context lines")
+}
+
+func (c *compareCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() != 2 {
+		glog.Error("Error: two patches must be given")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	if err := checkStdinDiffs(f.Args()...); err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	a, err := openDiff(f.Arg(0))
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", f.Arg(0))
+		return exitTrouble
+	}
+	defer a.Close()
+
+	b, err := openDiff(f.Arg(1))
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", f.Arg(1))
+		return exitTrouble
+	}
+	defer b.Close()
+
+	equal, err := patchutils.ComparePatches(a, b, patchutils.CompareOptions{Semantic: c.semantic})
+	if err != nil {
+		glog.Errorf("Error during comparing %q and %q: %v\n", f.Arg(0), f.Arg(1), err)
+		return exitTrouble
+	}
+	if !equal {
+		fmt.Printf("Patches %s and %s differ\n", f.Arg(0), f.Arg(1))
+		return exitDifferent
+	}
+	return exitSame
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type convertCmd struct {
+	patch string
+	to    string
+}
+
+func init() {
+	subcommands.Register(&convertCmd{}, "")
+}
+
+func (*convertCmd) Name() string { return "convert" }
+func (*convertCmd) Synopsis() string {
+	return "convert a patch between unified and context formats."
+}
+func (*convertCmd) Usage() string {
+	return "convert -patch=<patch path> [-to=unified|context]: " +
+		"Print the patch with file diffs converted to unified (diff -u) or context (diff -c) format.\n"
+}
+
+func (c *convertCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.patch, "patch", "", "path to the patch")
+	f.StringVar(&c.to, "to", "unified", "format to convert to, \"unified\" or \"context\"")
+}
+
+func (c *convertCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.patch == "" {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	convert := patchutils.ContextToUnified
+	switch c.to {
+	case "unified":
+	case "context":
+		convert = patchutils.UnifiedToContext
+	default:
+		glog.Errorf("Error: unknown format %q", c.to)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	p, err := os.Open(c.patch)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", c.patch)
+		return subcommands.ExitFailure
+	}
+	defer p.Close()
+
+	result, err := convert(p)
+	if err != nil {
+		glog.Errorf("Error during converting %q: %v\n", c.patch, err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Print(result)
+	return subcommands.ExitSuccess
+}
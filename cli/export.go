@@ -0,0 +1,130 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"flag"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type exportCmd struct {
+	source string
+	diff   string
+	out    string
+	strip  int
+	link   string
+	quota  patchutils.Quota
+}
+
+// linkModes maps values of -link to the modes they select.
+var linkModes = map[string]patchutils.LinkMode{
+	"copy":     patchutils.CopyFiles,
+	"hardlink": patchutils.HardLinkFiles,
+	"reflink":  patchutils.ReflinkFiles,
+}
+
+func init() {
+	subcommands.Register(&exportCmd{}, "")
+}
+
+func (*exportCmd) Name() string { return "export" }
+func (*exportCmd) Synopsis() string {
+	return "write a source tree patched with a diff, without modifying it."
+}
+func (*exportCmd) Usage() string {
+	return "export -source=<source path> -diff=<diff path> -out=<output dir or .tar, .tar.gz or .tgz path>: " +
+		"Write the source tree patched with the diff to a new directory or a tar archive.\n"
+}
+
+func (c *exportCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.source, "source", "", "path to the source tree")
+	f.StringVar(&c.diff, "diff", "", "path to the diff")
+	f.StringVar(&c.out, "out", "", "path to the directory to create, or to the tar archive to write "+
+		"if it ends in .tar, .tar.gz or .tgz")
+	f.IntVar(&c.strip, "p", 0, "number of leading path components to strip from file names in the diff")
+	f.IntVar(&c.quota.MaxFiles, "max-files", 0, "maximum number of files written, 0 for no limit")
+	f.Int64Var(&c.quota.MaxBytes, "max-bytes", 0, "maximum number of bytes of file content written, 0 for no limit")
+	f.IntVar(&c.quota.MaxDepth, "max-depth", 0, "maximum number of components of paths written, 0 for no limit")
+	f.StringVar(&c.link, "link", "copy", "how unchanged files are written to a directory: \"copy\", "+
+		"\"hardlink\" to the source or \"reflink\" with copy-on-write, copying them where that isn't possible")
+}
+
+func (c *exportCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if (c.source == "") || (c.diff == "") || (c.out == "") {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.quota.MaxFiles < 0 || c.quota.MaxBytes < 0 || c.quota.MaxDepth < 0 {
+		glog.Errorf("Error: -max-files, -max-bytes and -max-depth must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	link, ok := linkModes[c.link]
+	if !ok {
+		glog.Errorf("Error: unknown -link %q", c.link)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	d, err := os.Open(c.diff)
+	if err != nil {
+		glog.Errorf("Failed to open diff %q\n", c.diff)
+		return subcommands.ExitFailure
+	}
+	defer d.Close()
+
+	opts := patchutils.ExportOptions{
+		Link:       link,
+		Apply:      patchutils.ApplyOptions{Quota: c.quota},
+		StripLevel: c.strip,
+	}
+	gzipped := strings.HasSuffix(c.out, ".tar.gz") || strings.HasSuffix(c.out, ".tgz")
+	if !gzipped && !strings.HasSuffix(c.out, ".tar") {
+		if err := patchutils.ExportTree(c.source, d, c.out, opts); err != nil {
+			glog.Errorf("Error during exporting %q patched with %q: %v\n", c.source, c.diff, err)
+			return subcommands.ExitFailure
+		}
+		return subcommands.ExitSuccess
+	}
+
+	if err := exportTar(c.source, d, c.out, gzipped, opts); err != nil {
+		glog.Errorf("Error during exporting %q patched with %q: %v\n", c.source, c.diff, err)
+		os.Remove(c.out)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// exportTar writes the tree at source patched with patch as a tar archive to path.
+func exportTar(source string, patch io.Reader, path string, gzipped bool, opts patchutils.ExportOptions) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if gzipped {
+		zw = gzip.NewWriter(f)
+		w = zw
+	}
+	if err := patchutils.ExportTar(source, patch, w, opts); err != nil {
+		f.Close()
+		return err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
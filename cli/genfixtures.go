@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils/internal/fixtures"
+	"github.com/google/subcommands"
+)
+
+type genFixturesCmd struct {
+	source string
+	out    string
+	name   string
+	a      string
+	b      string
+}
+
+func init() {
+	subcommands.Register(&genFixturesCmd{}, "")
+}
+
+func (*genFixturesCmd) Name() string { return "gen-fixtures" }
+func (*genFixturesCmd) Synopsis() string {
+	return "generate source and diff fixtures " +
+		"by mutating a source tree with two profiles."
+}
+func (*genFixturesCmd) Usage() string {
+	return "gen-fixtures -source=<source dir> -out=<output dir> -name=<fixture name> -a=<profile> -b=<profile>: " +
+		"Generate source trees, their diffs and the interdiff of those, in the layout of test_examples.\n" +
+		"A profile is either random:SEED[:MUTATIONS] or the path to a mutation script.\n"
+}
+
+func (c *genFixturesCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.source, "source", "", "path to the source tree to mutate")
+	f.StringVar(&c.out, "out", ".", "directory to write fixtures to")
+	f.StringVar(&c.name, "name", "", "name of the fixture set")
+	f.StringVar(&c.a, "a", "", "mutation profile of the first version")
+	f.StringVar(&c.b, "b", "", "mutation profile of the second version")
+}
+
+func (c *genFixturesCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if (c.source == "") || (c.name == "") || (c.a == "") || (c.b == "") {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	a, err := fixtures.ParseProfile(c.a)
+	if err != nil {
+		glog.Errorf("Failed to parse profile a: %v\n", err)
+		return subcommands.ExitUsageError
+	}
+	b, err := fixtures.ParseProfile(c.b)
+	if err != nil {
+		glog.Errorf("Failed to parse profile b: %v\n", err)
+		return subcommands.ExitUsageError
+	}
+
+	if err := fixtures.Generate(c.source, c.out, c.name, a, b); err != nil {
+		glog.Errorf("Error during generating fixtures %q from %q: %v\n", c.name, c.source, err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Printf("Fixtures %q written to %q\n", c.name, c.out)
+	return subcommands.ExitSuccess
+}
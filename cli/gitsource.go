@@ -0,0 +1,19 @@
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"io"
+
+	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/gitpatch"
+)
+
+func init() {
+	mixedModeGit = func(repo string) mixedModeSources {
+		return func(oldRev, newRev string, oldDiff, newDiff io.Reader, opts patchutils.MixedModeOptions) (string, error) {
+			return gitpatch.MixedModeGitWithOptions(repo, oldRev, newRev, oldDiff, newDiff, opts)
+		}
+	}
+}
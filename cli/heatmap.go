@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type heatmapCmd struct {
+	target    string
+	format    string
+	strip     int
+	fuzz      int
+	maxOffset int
+	region    int
+}
+
+func init() {
+	subcommands.Register(&heatmapCmd{}, "")
+}
+
+func (*heatmapCmd) Name() string { return "heatmap" }
+func (*heatmapCmd) Synopsis() string {
+	return "report which files and regions of a tree a patch series conflicts or fuzzes in."
+}
+func (*heatmapCmd) Usage() string {
+	return "heatmap -target=<target path> <patch path>...: " +
+		"Apply the patches in order to the target tree and report where their hunks conflict, fuzz or move.\n"
+}
+
+func (c *heatmapCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.target, "target", "", "path to the tree the series is applied to")
+	f.StringVar(&c.format, "format", "json", "format of the report: \"json\" with files and regions, "+
+		"or \"csv\" with a row per region")
+	f.IntVar(&c.strip, "p", 0, "number of leading path components to strip from file names in the patches")
+	f.IntVar(&c.fuzz, "fuzz", 2, "number of context lines which may be ignored at the start and end of hunks")
+	f.IntVar(&c.maxOffset, "max-offset", 1000, "number of lines hunks may be moved from their positions")
+	f.IntVar(&c.region, "region-lines", patchutils.DefaultHeatMapRegionLines, "number of lines of the regions hunks are counted in")
+}
+
+func (c *heatmapCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.target == "" || f.NArg() == 0 {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.format != "json" && c.format != "csv" {
+		glog.Errorf("Error: unknown -format %q", c.format)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	var series []patchutils.SeriesPatch
+	for _, name := range f.Args() {
+		p, err := os.Open(name)
+		if err != nil {
+			glog.Errorf("Failed to open patch %q\n", name)
+			return subcommands.ExitFailure
+		}
+		defer p.Close()
+		series = append(series, patchutils.SeriesPatch{Name: name, Patch: p})
+	}
+
+	opts := patchutils.HeatMapOptions{
+		Apply:       patchutils.ApplyOptions{MaxOffset: c.maxOffset, Fuzz: c.fuzz},
+		StripLevel:  c.strip,
+		RegionLines: c.region,
+	}
+	m, err := patchutils.PatchHeatMap(c.target, series, opts)
+	if err != nil {
+		glog.Errorf("Error during applying series to %q: %v\n", c.target, err)
+		if c.format == "json" {
+			printJSONError(err)
+		}
+		return subcommands.ExitFailure
+	}
+
+	if c.format == "csv" {
+		err = m.WriteCSV(os.Stdout)
+	} else {
+		err = m.WriteJSON(os.Stdout)
+	}
+	if err != nil {
+		glog.Errorf("Error during printing report: %v\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils/patchindex"
+	"github.com/google/subcommands"
+)
+
+type indexCmd struct {
+	dir     string
+	index   string
+	file    string
+	symbol  string
+	patchID string
+}
+
+func init() {
+	subcommands.Register(&indexCmd{}, "")
+}
+
+func (*indexCmd) Name() string { return "index" }
+func (*indexCmd) Synopsis() string {
+	return "index a directory of patches " +
+		"and query it by touched file, added symbol or patch ID."
+}
+func (*indexCmd) Usage() string {
+	return "index [-dir=<patches dir>] [-index=<index path>] [-file=<path>] [-symbol=<identifier>] [-patchid=<id>]: " +
+		"Build the index of patches in dir, saving it to index if given, or load index.\n" +
+		"Then print the patches matching all given queries, or the number of indexed patches.\n"
+}
+
+func (c *indexCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.dir, "dir", "", "directory of .patch and .diff files to index")
+	f.StringVar(&c.index, "index", "", "path to the index file, written if dir is given, read otherwise")
+	f.StringVar(&c.file, "file", "", "query patches touching this file")
+	f.StringVar(&c.symbol, "symbol", "", "query patches adding lines with this identifier")
+	f.StringVar(&c.patchID, "patchid", "", "query patches with this patch ID or ID prefix")
+}
+
+func (c *indexCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if (c.dir == "") && (c.index == "") {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	ix, err := c.loadOrBuild()
+	if err != nil {
+		glog.Error(err)
+		return subcommands.ExitFailure
+	}
+
+	queries := []struct {
+		value string
+		run   func(string) []string
+	}{
+		{c.file, ix.Touching},
+		{c.symbol, ix.WithSymbol},
+		{c.patchID, ix.WithPatchID},
+	}
+	var result []string
+	queried := false
+	for _, q := range queries {
+		if q.value == "" {
+			continue
+		}
+		paths := q.run(q.value)
+		if queried {
+			paths = intersect(result, paths)
+		}
+		result, queried = paths, true
+	}
+
+	if !queried {
+		fmt.Printf("%d patches indexed\n", len(ix.Entries))
+		return subcommands.ExitSuccess
+	}
+	for _, p := range result {
+		fmt.Println(p)
+	}
+	return subcommands.ExitSuccess
+}
+
+// loadOrBuild builds the index of c.dir and saves it to c.index, if set,
+// or loads the index from c.index.
+func (c *indexCmd) loadOrBuild() (*patchindex.Index, error) {
+	if c.dir == "" {
+		f, err := os.Open(c.index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open index %q: %w", c.index, err)
+		}
+		defer f.Close()
+		return patchindex.Load(f)
+	}
+
+	ix, err := patchindex.Build(c.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to index %q: %w", c.dir, err)
+	}
+	if c.index != "" {
+		f, err := os.Create(c.index)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create index %q: %w", c.index, err)
+		}
+		defer f.Close()
+		if err := ix.Save(f); err != nil {
+			return nil, err
+		}
+	}
+	return ix, nil
+}
+
+// intersect returns the elements of a that are also in b, in the order of a.
+func intersect(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, s := range b {
+		inB[s] = true
+	}
+	var result []string
+	for _, s := range a {
+		if inB[s] {
+			result = append(result, s)
+		}
+	}
+	return result
+}
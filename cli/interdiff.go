@@ -4,16 +4,36 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/golang/glog"
 	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/impact"
 	"github.com/google/subcommands"
 )
 
 type interdiffCmd struct {
-	oldDiff string
-	newDiff string
+	oldDiff    string
+	newDiff    string
+	statOnly   bool
+	order      string
+	check      bool
+	spillMB    int64
+	jobs       int
+	json       bool
+	targets    string
+	format     string
+	root       string
+	conflicts  bool
+	algorithm  string
+	timestamps string
+	showFunc   bool
+	funcFile   string
+	keepGoing  bool
+	mail       bool
+	output     outputFlags
 }
 
 func init() {
@@ -27,41 +47,284 @@ func (*interdiffCmd) Synopsis() string {
 }
 func (*interdiffCmd) Usage() string {
 	return "interdiff -olddiff=<oldDiff path> -newdiff=<newDiff path>: " +
-		"Compute difference between source patched with oldDiff and same source patched with newDiff.\n"
+		"Compute difference between source patched with oldDiff and same source patched with newDiff. Exit with status 0 if there is none, 1 if there is and 2 on errors.\n"
 }
 
 func (c *interdiffCmd) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&c.oldDiff, "olddiff", "", "path to the old version of diff")
-	f.StringVar(&c.newDiff, "newdiff", "", "path to the new version of diff")
+	f.StringVar(&c.oldDiff, "olddiff", "", "path to the old version of diff, or \"-\" for standard input")
+	f.StringVar(&c.newDiff, "newdiff", "", "path to the new version of diff, or \"-\" for standard input")
+	f.BoolVar(&c.statOnly, "stat-only", false, "print only the number of changed lines per file, counted without building the hunks of the result")
+	f.BoolVar(&c.json, "json", false, "with -stat-only, print a JSON report of changed files")
+	f.StringVar(&c.targets, "targets", "", "with -json, path to a mapping of files to build targets, "+
+		"adding the targets impacted by every file to the report")
+	f.StringVar(&c.format, "targets-format", "lines", "format of -targets: \"lines\" of a file and its targets, "+
+		"or \"golist\" for the output of go list -json")
+	f.StringVar(&c.root, "targets-root", ".", "directory file names of -targets-format=golist are relative to")
+	f.StringVar(&c.order, "order", "", "sort files of the result in \"git\" or \"diff\" order")
+	f.BoolVar(&c.conflicts, "conflict-markers", false, "print both versions of hunks which disagree about the source "+
+		"between conflict markers instead of failing")
+	f.StringVar(&c.algorithm, "diff-algorithm", "lcs", "algorithm comparing lines added to the same place by both diffs: "+
+		"\"lcs\", \"patience\" or \"histogram\"")
+	f.StringVar(&c.timestamps, "timestamps", "keep", "timestamps of file headers of the result: \"keep\" them as in the diffs, \"omit\" them, "+
+		"or set them to the Unix \"epoch\"")
+	f.BoolVar(&c.keepGoing, "keep-going", false, "skip files which can't be merged and print the result of the others, "+
+		"exiting with status 2")
+	f.BoolVar(&c.showFunc, "show-function", false, "write the function or heading each hunk is in after its ranges, like diff -p")
+	f.StringVar(&c.funcFile, "function-patterns", "", "path to a file of lines of an extension, or \"*\" for other files, "+
+		"and a regular expression matching lines starting functions of such files; implies -show-function")
+	f.BoolVar(&c.mail, "format-patch", false, "print the result as a mail of git format-patch with the header and message "+
+		"of -newdiff, itself such a mail, replying to it if it has a Message-Id")
+	c.output.setFlags(f)
+	f.BoolVar(&c.check, "check-determinism", false, "compute the result twice and fail if the results differ")
+	f.Int64Var(&c.spillMB, "spill-mb", 0, "MiB of pending results kept in memory before spilling them to temporary files; "+
+		"0 keeps all of them in memory")
+	f.IntVar(&c.jobs, "jobs", 0, "maximum number of files merged at the same time; 0 stands for the number of CPUs")
 }
 
-func (c *interdiffCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (c *interdiffCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	if (c.oldDiff == "") || (c.newDiff == "") {
 		glog.Error("Error: necessary flags aren't assigned")
 		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
 		return subcommands.ExitUsageError
 	}
 
-	oldD, err := os.Open(c.oldDiff)
+	if err := checkStdinDiffs(c.oldDiff, c.newDiff); err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if err := c.output.validate(); err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.json && !c.statOnly {
+		glog.Errorf("Error: -json requires -stat-only")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.statOnly && (c.conflicts || c.order != "" || c.keepGoing || c.algorithm != "lcs" || c.check || c.jobs != 0) {
+		glog.Errorf("Error: -stat-only can't be combined with -conflict-markers, -order, -keep-going, -diff-algorithm, -check-determinism or -jobs")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.targets != "" && !c.json {
+		glog.Errorf("Error: -targets requires -json")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.format != "lines" && c.format != "golist" {
+		glog.Errorf("Error: unknown -targets-format %q", c.format)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.mail && (c.statOnly || c.output.whole()) {
+		glog.Errorf("Error: -format-patch can't be combined with -stat-only, -format=json, -color-moved or -side-by-side")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.spillMB < 0 {
+		glog.Errorf("Error: -spill-mb must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.jobs < 0 {
+		glog.Errorf("Error: -jobs must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	differ, err := patchutils.ParseLineDiffer(c.algorithm)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	timestamps, err := patchutils.ParseTimestampMode(c.timestamps)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	sections, err := loadSectionPatterns(c.showFunc, c.funcFile)
+	if err != nil {
+		glog.Errorf("Failed to load function patterns %q: %v\n", c.funcFile, err)
+		return exitTrouble
+	}
+
+	var conflicts int
+	opts := patchutils.InterDiffOptions{
+		SpillThreshold:  c.spillMB << 20,
+		ConflictMarkers: c.conflicts,
+		ConflictCount:   &conflicts,
+		Differ:          differ,
+		Concurrency:     c.jobs,
+		Timestamps:      timestamps,
+		Sections:        sections,
+		KeepGoing:       c.keepGoing,
+	}
+	if c.order != "" {
+		var err error
+		opts.Sort = true
+		opts.Order, err = patchutils.ParseFileOrder(c.order)
+		if err != nil {
+			glog.Errorf("Error: %v", err)
+			glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+			return subcommands.ExitUsageError
+		}
+	}
+
+	oldD, err := openDiff(c.oldDiff)
 	if err != nil {
 		glog.Errorf("Failed to open oldDiffFile: %q\n", c.oldDiff)
-		return subcommands.ExitFailure
+		return exitTrouble
 	}
 	defer oldD.Close()
 
-	newD, err := os.Open(c.newDiff)
+	newD, err := openDiff(c.newDiff)
 	if err != nil {
 		glog.Errorf("Failed to open newDiffFile %q\n", c.newDiff)
-		return subcommands.ExitFailure
+		return exitTrouble
 	}
 	defer newD.Close()
 
-	result, err := patchutils.InterDiff(oldD, newD)
+	var mail *patchutils.MailPatch
+	if c.mail {
+		mail, err = patchutils.ParseMailPatch(newD)
+		if err == nil {
+			err = rewind(newD)
+		}
+		if err != nil {
+			glog.Errorf("Failed to read the mail header of %q: %v\n", c.newDiff, err)
+			return exitTrouble
+		}
+	}
+
+	out, err := c.output.create()
 	if err != nil {
+		glog.Errorf("Failed to create output %q: %v\n", c.output.out, err)
+		return exitTrouble
+	}
+	defer out.abort()
+
+	if c.statOnly {
+		stats, err := patchutils.InterDiffStat(oldD, newD)
+		if err != nil {
+			glog.Errorf("Error during computing stats for %q and %q: %v\n", c.oldDiff, c.newDiff, err)
+			if c.json {
+				printJSONError(err)
+			}
+			return exitTrouble
+		}
+		if !c.json {
+			fmt.Fprint(out, patchutils.FormatStat(stats))
+			return commitResult(out, statsDiffer(stats))
+		}
+
+		var m impact.Map
+		if c.targets != "" {
+			m, err = c.loadTargets()
+			if err != nil {
+				glog.Errorf("Failed to load targets %q: %v\n", c.targets, err)
+				printJSONError(err)
+				return exitTrouble
+			}
+		}
+		if err := impact.NewReport(stats, m).Write(out); err != nil {
+			glog.Errorf("Error during printing report: %v\n", err)
+			return exitTrouble
+		}
+		return commitResult(out, statsDiffer(stats))
+	}
+
+	if c.check || c.output.whole() || mail != nil {
+		var result string
+		if c.check {
+			result, err = checkDeterminism(func() (string, error) {
+				if err := rewind(oldD, newD); err != nil {
+					return "", err
+				}
+				return patchutils.InterDiffContext(ctx, oldD, newD, opts)
+			})
+		} else {
+			result, err = patchutils.InterDiffContext(ctx, oldD, newD, opts)
+		}
+		skipped := skippedFiles(err)
+		if err != nil && !skipped {
+			glog.Errorf("Error during computing diff for %q and %q: %v\n", c.oldDiff, c.newDiff, err)
+			c.output.reportError(err)
+			return exitTrouble
+		}
+		different := hasDifferences(result)
+		result, err = c.output.render(result)
+		if err != nil {
+			glog.Errorf("Error during rendering result: %v\n", err)
+			c.output.reportError(err)
+			return exitTrouble
+		}
+		if mail != nil {
+			if err := mail.WriteFormatPatch(out, result); err != nil {
+				glog.Errorf("Error during writing the result as a mail: %v\n", err)
+				return exitTrouble
+			}
+		} else {
+			fmt.Fprintln(out, result)
+		}
+		warnConflicts(conflicts)
+		status := commitResult(out, different)
+		if skipped {
+			return exitTrouble
+		}
+		return status
+	}
+
+	// Files are written as soon as they and, with -order, all files before them are done
+	diffs := &differences{}
+	err = patchutils.InterDiffToContext(ctx, io.MultiWriter(out, diffs), oldD, newD, opts)
+	skipped := skippedFiles(err)
+	if err != nil && !skipped {
 		glog.Errorf("Error during computing diff for %q and %q: %v\n", c.oldDiff, c.newDiff, err)
-		return subcommands.ExitFailure
+		return exitTrouble
 	}
 
-	fmt.Println(result)
-	return subcommands.ExitSuccess
+	fmt.Fprintln(out)
+	warnConflicts(conflicts)
+	status := commitResult(out, diffs.differ())
+	if skipped {
+		return exitTrouble
+	}
+	return status
+}
+
+// warnConflicts logs the number of hunks marked as conflicts, if any.
+func warnConflicts(conflicts int) {
+	if conflicts > 0 {
+		glog.Warningf("Marked %d conflicting hunks\n", conflicts)
+	}
+}
+
+// loadTargets reads the mapping of files to build targets in c.targets.
+func (c *interdiffCmd) loadTargets() (impact.Map, error) {
+	f, err := os.Open(c.targets)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if c.format == "golist" {
+		root, err := filepath.Abs(c.root)
+		if err != nil {
+			return nil, err
+		}
+		return impact.ParseGoList(f, root)
+	}
+	return impact.ParseLines(f)
 }
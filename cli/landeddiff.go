@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils/gitpatch"
+	"github.com/google/subcommands"
+)
+
+type landedDiffCmd struct {
+	repo  string
+	patch string
+	from  string
+	to    string
+}
+
+func init() {
+	subcommands.Register(&landedDiffCmd{}, "")
+}
+
+func (*landedDiffCmd) Name() string { return "landed-diff" }
+func (*landedDiffCmd) Synopsis() string {
+	return "compute difference between " +
+		"a pending patch and the commits it landed as."
+}
+func (*landedDiffCmd) Usage() string {
+	return "landed-diff -repo=<repository path> -patch=<patch path> -from=<revision> -to=<revision>: " +
+		"Compute difference between source patched with patch and the same source changed by commits from..to.\n"
+}
+
+func (c *landedDiffCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.repo, "repo", ".", "path to the git repository")
+	f.StringVar(&c.patch, "patch", "", "path to the pending patch")
+	f.StringVar(&c.from, "from", "", "revision the landed commits are based on")
+	f.StringVar(&c.to, "to", "HEAD", "last landed revision")
+}
+
+func (c *landedDiffCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if (c.patch == "") || (c.from == "") {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	patch, err := os.Open(c.patch)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", c.patch)
+		return subcommands.ExitFailure
+	}
+	defer patch.Close()
+
+	result, err := gitpatch.LandedDiff(c.repo, patch, c.from, c.to)
+	if err != nil {
+		glog.Errorf("Error during computing diff for %q and %s..%s: %v\n", c.patch, c.from, c.to, err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Println(result)
+	return subcommands.ExitSuccess
+}
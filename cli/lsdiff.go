@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type lsdiffCmd struct {
+	patch   string
+	strip   int
+	status  bool
+	null    bool
+	include string
+	exclude string
+}
+
+func init() {
+	subcommands.Register(&lsdiffCmd{}, "")
+}
+
+// statusLetters are the prefixes -status prints for statuses of files.
+var statusLetters = map[string]string{
+	patchutils.FileAdded:    "A",
+	patchutils.FileDeleted:  "D",
+	patchutils.FileRenamed:  "R",
+	patchutils.FileModified: "M",
+	patchutils.FileBinary:   "B",
+}
+
+func (*lsdiffCmd) Name() string { return "lsdiff" }
+func (*lsdiffCmd) Synopsis() string {
+	return "list the files a patch changes."
+}
+func (*lsdiffCmd) Usage() string {
+	return "lsdiff [-patch=<patch path> | <patch path>]: " +
+		"Print the names of the files changed by the patch, read from standard input without a path or with \"-\", one per line, " +
+		"like lsdiff. Files added or renamed are listed by their new names, files deleted by their old names.\n"
+}
+
+func (c *lsdiffCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.patch, "patch", "", "path to the patch, or \"-\" for standard input; the patch can be given as an argument instead")
+	f.IntVar(&c.strip, "p", 0, "number of leading path components to strip from file names")
+	f.BoolVar(&c.status, "status", false, "prefix names with the status of their file: A for added, M for modified, "+
+		"D for deleted, R for renamed and B for binary")
+	f.BoolVar(&c.null, "null", false, "end names with NUL bytes instead of newlines, e.g. for xargs -0")
+	f.StringVar(&c.include, "include", "", "comma-separated patterns of files to list, matched against names after -p; "+
+		"patterns use the syntax of path.Match and match whole directories, e.g. \"drivers/net,include/*.h\"")
+	f.StringVar(&c.exclude, "exclude", "", "comma-separated patterns of files not to list, like -include")
+}
+
+func (c *lsdiffCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.strip < 0 {
+		glog.Errorf("Error: -p must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	path := c.patch
+	if f.NArg() > 0 {
+		if f.NArg() > 1 || path != "" {
+			glog.Errorf("Error: expected one patch, given by -patch or as an argument")
+			glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+			return subcommands.ExitUsageError
+		}
+		path = f.Arg(0)
+	}
+	if path == "" {
+		path = stdinPath
+	}
+	patch, err := openDiff(path)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", path)
+		return exitTrouble
+	}
+	defer patch.Close()
+
+	patchSet, err := patchutils.ReadPatchSet(patch)
+	if err != nil {
+		glog.Errorf("Failed to read patch: %v\n", err)
+		return exitTrouble
+	}
+	var opts patchutils.FilterOptions
+	if c.include != "" {
+		opts.Include = strings.Split(c.include, ",")
+	}
+	if c.exclude != "" {
+		opts.Exclude = strings.Split(c.exclude, ",")
+	}
+	patchSet, err = patchSet.Strip(c.strip).Filter(opts)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	end := "\n"
+	if c.null {
+		end = "\x00"
+	}
+	w := bufio.NewWriter(os.Stdout)
+	for _, fd := range patchSet.Files() {
+		status := patchutils.FileStatus(fd)
+		if status == patchutils.FileOnlyIn {
+			// "Only in" entries don't change files
+			continue
+		}
+		name := fd.NewName
+		if status == patchutils.FileDeleted {
+			name = fd.OrigName
+		}
+		if c.status {
+			w.WriteString(statusLetters[status] + " ")
+		}
+		w.WriteString(name + end)
+	}
+	if err := w.Flush(); err != nil {
+		glog.Errorf("Failed to write file names: %v\n", err)
+		return exitTrouble
+	}
+	return exitSame
+}
@@ -2,11 +2,25 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"strings"
 
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/schema"
 	"github.com/google/subcommands"
+	"github.com/sourcegraph/go-diff/diff"
 )
 
 func main() {
@@ -14,7 +28,416 @@ func main() {
 	subcommands.Register(subcommands.FlagsCommand(), "")
 	subcommands.Register(subcommands.CommandsCommand(), "")
 
+	printSchema := flag.String("print-schema", "", "print the JSON schema of an output and exit: "+
+		strings.Join(schema.Names(), ", "))
 	flag.Parse()
-	ctx := context.Background()
+	if *printSchema != "" {
+		s, err := schema.Get(*printSchema)
+		if err != nil {
+			glog.Errorf("Error: %v", err)
+			os.Exit(int(subcommands.ExitUsageError))
+		}
+		fmt.Print(s)
+		os.Exit(int(subcommands.ExitSuccess))
+	}
+
+	// The first interrupt cancels the command, so that it can remove partial output
+	ctx, cancel := context.WithCancel(context.Background())
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		<-interrupts
+		signal.Stop(interrupts)
+		cancel()
+	}()
 	os.Exit(int(subcommands.Execute(ctx)))
 }
+
+// outputFlags select renderings of results shared by interdiff and mixed mode.
+type outputFlags struct {
+	moved      bool
+	sideBySide bool
+	width      int
+	format     string
+	out        string
+	appendOut  bool
+}
+
+func (o *outputFlags) setFlags(f *flag.FlagSet) {
+	f.BoolVar(&o.moved, "color-moved", false, "color lines of blocks moved within a file like git diff --color-moved")
+	f.BoolVar(&o.sideBySide, "side-by-side", false, "print the result in two columns like diff -y")
+	f.IntVar(&o.width, "width", patchutils.DefaultSideBySideWidth, "width of -side-by-side output in characters")
+	f.StringVar(&o.format, "format", "unified", "format of the result, \"unified\" diff or \"json\"")
+	f.StringVar(&o.out, "o", "", "path to a file the result replaces once complete, instead of printing it")
+	f.StringVar(&o.out, "output", "", "same as -o")
+	f.BoolVar(&o.appendOut, "append", false, "append the result to the file of -o instead of replacing it")
+}
+
+// validate returns an error for flags which can't be combined.
+func (o *outputFlags) validate() error {
+	if o.moved && o.sideBySide {
+		return errors.New("-color-moved can't be combined with -side-by-side")
+	}
+	if o.format != "unified" && o.format != "json" {
+		return fmt.Errorf("unknown -format %q", o.format)
+	}
+	if o.format == "json" && (o.moved || o.sideBySide) {
+		return errors.New("-format=json can't be combined with -color-moved or -side-by-side")
+	}
+	if o.width <= 0 {
+		return errors.New("-width must be positive")
+	}
+	if o.appendOut && o.out == "" {
+		return errors.New("-append requires -o")
+	}
+	return nil
+}
+
+// create returns the writer of the result, which is stdout without -o.
+func (o *outputFlags) create() (*resultWriter, error) {
+	if o.out == "" {
+		return &resultWriter{w: os.Stdout}, nil
+	}
+
+	// The result is written next to the file, so that renaming replaces it atomically
+	tmp, err := ioutil.TempFile(filepath.Dir(o.out), "."+filepath.Base(o.out)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	w := &resultWriter{w: tmp, tmp: tmp, path: o.out}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(o.out); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		w.abort()
+		return nil, err
+	}
+	if o.appendOut {
+		if err := copyFile(tmp, o.out); err != nil && !os.IsNotExist(err) {
+			w.abort()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// Exit statuses of commands comparing patches, which mirror diff(1): exitSame if
+// the patches are equivalent, exitDifferent if they aren't and exitTrouble on errors.
+const (
+	exitSame      = subcommands.ExitSuccess
+	exitDifferent = subcommands.ExitStatus(1)
+	exitTrouble   = subcommands.ExitStatus(2)
+)
+
+// commitResult commits the result written to out, and returns the exit status
+// of the command, exitDifferent if the result has differences.
+func commitResult(out *resultWriter, different bool) subcommands.ExitStatus {
+	if err := out.commit(); err != nil {
+		glog.Errorf("Failed to write result: %v\n", err)
+		return exitTrouble
+	}
+	if different {
+		return exitDifferent
+	}
+	return exitSame
+}
+
+// differences tells whether diffs written to it have differences: lines other than
+// file headers, which are printed for files without changes too.
+type differences struct {
+	found bool
+	// line is the start of the line being written.
+	line []byte
+}
+
+func (d *differences) Write(p []byte) (int, error) {
+	n := len(p)
+	for !d.found && len(p) > 0 {
+		k := bytes.IndexByte(p, '\n')
+		if k < 0 {
+			d.line = append(d.line, p...)
+			break
+		}
+		d.line = append(d.line, p[:k]...)
+		d.found = !isFileHeader(string(d.line))
+		d.line = d.line[:0]
+		p = p[k+1:]
+	}
+	return n, nil
+}
+
+// differ reports whether the diffs written to d have differences.
+func (d *differences) differ() bool {
+	return d.found || len(d.line) > 0 && !isFileHeader(string(d.line))
+}
+
+// hasDifferences reports whether result, a diff computed by interdiff or mixed mode,
+// has differences.
+func hasDifferences(result string) bool {
+	var d differences
+	io.WriteString(&d, result)
+	return d.differ()
+}
+
+// isFileHeader reports whether line is empty or a header line of a file of a diff.
+// Lines of hunks come after a "@@" line, which isn't one, so they are never
+// mistaken for headers.
+func isFileHeader(line string) bool {
+	for _, prefix := range []string{"--- ", "+++ ", "diff --git ", "index "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return line == ""
+}
+
+// statsDiffer reports whether stats count changed lines or files present in one
+// version only.
+func statsDiffer(stats []patchutils.FileStat) bool {
+	for _, s := range stats {
+		if s.Only || s.Added > 0 || s.Deleted > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFile appends the content of the file at path to w.
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// skippedFiles logs the files of err, if it wraps the errors of files skipped
+// with -keep-going, and reports whether it does, so that the result of the other
+// files is kept.
+func skippedFiles(err error) bool {
+	var fileErrs patchutils.FileErrors
+	if !errors.As(err, &fileErrs) {
+		return false
+	}
+	for _, fe := range fileErrs {
+		glog.Errorf("Skipped %v\n", fe)
+	}
+	return true
+}
+
+// loadSectionPatterns returns the patterns finding sections of hunks: none unless
+// show is set or path is given, patchutils.DefaultSectionPatterns otherwise, with
+// those of extensions given in the file at path replaced. Lines of the file are an
+// extension, or "*" for other files, and a regular expression separated by space.
+func loadSectionPatterns(show bool, path string) (patchutils.SectionPatterns, error) {
+	if !show && path == "" {
+		return nil, nil
+	}
+	patterns := make(patchutils.SectionPatterns)
+	for ext, re := range patchutils.DefaultSectionPatterns {
+		patterns[ext] = re
+	}
+	if path == "" {
+		return patterns, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	for n, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want an extension and a regular expression", n+1)
+		}
+		re, err := regexp.Compile(strings.TrimSpace(fields[1]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n+1, err)
+		}
+		ext := fields[0]
+		if ext == "*" {
+			ext = ""
+		}
+		patterns[ext] = re
+	}
+	return patterns, nil
+}
+
+// resultWriter receives the result of a command. Written to a file, the result
+// only replaces it once commit is called, so that failed runs leave it untouched.
+type resultWriter struct {
+	w    io.Writer
+	err  error
+	tmp  *os.File
+	path string
+}
+
+func (w *resultWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.err = err
+	return n, err
+}
+
+// commit moves the result to its file, if any.
+func (w *resultWriter) commit() error {
+	if w.tmp == nil {
+		return w.err
+	}
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.tmp.Name(), w.path); err != nil {
+		return err
+	}
+	w.tmp = nil
+	return nil
+}
+
+// abort discards the result unless it was committed.
+func (w *resultWriter) abort() {
+	if w.tmp != nil {
+		w.tmp.Close()
+		os.Remove(w.tmp.Name())
+		w.tmp = nil
+	}
+}
+
+// whole reports whether the renderings need the whole result, instead of files
+// written as soon as they are done.
+func (o *outputFlags) whole() bool {
+	return o.moved || o.sideBySide || o.format == "json"
+}
+
+// render returns result rendered as selected.
+func (o *outputFlags) render(result string) (string, error) {
+	switch {
+	case o.moved:
+		return patchutils.ColorMoved(strings.NewReader(result), 0)
+	case o.sideBySide:
+		return patchutils.SideBySide(strings.NewReader(result), o.width)
+	case o.format == "json":
+		fileDiffs, err := diff.NewMultiFileDiffReader(strings.NewReader(result)).ReadAllFiles()
+		if err != nil {
+			return "", fmt.Errorf("parsing result: %w", err)
+		}
+		var b strings.Builder
+		if err := patchutils.WriteJSON(&b, fileDiffs); err != nil {
+			return "", err
+		}
+		return b.String(), nil
+	}
+	return result, nil
+}
+
+// reportError writes err to stdout following schema.Error if the result is JSON,
+// so that consumers of JSON output get an error they can parse.
+func (o *outputFlags) reportError(err error) {
+	if o.format == "json" {
+		printJSONError(err)
+	}
+}
+
+// printJSONError writes err to stdout following schema.Error.
+func printJSONError(err error) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(struct {
+		SchemaVersion int    `json:"schema_version"`
+		Error         string `json:"error"`
+	}{schema.Version, err.Error()})
+}
+
+// checkDeterminism runs compute twice and returns its result, or an error if the
+// results or errors of both runs differ.
+func checkDeterminism(compute func() (string, error)) (string, error) {
+	first, firstErr := compute()
+	second, secondErr := compute()
+	if fmt.Sprint(firstErr) != fmt.Sprint(secondErr) {
+		return "", fmt.Errorf("%w: first run failed with %v, second run with %v", errNondeterministic, firstErr, secondErr)
+	}
+	if firstErr != nil {
+		// The result of files skipped with -keep-going is kept
+		return first, firstErr
+	}
+	if first != second {
+		k := 0
+		for k < len(first) && k < len(second) && first[k] == second[k] {
+			k++
+		}
+		return "", fmt.Errorf("%w: results of %d and %d bytes differ from byte %d on",
+			errNondeterministic, len(first), len(second), k)
+	}
+	return first, nil
+}
+
+// stdinPath is the path of diffs standing for standard input.
+const stdinPath = "-"
+
+// diffFile is a diff opened by openDiff.
+type diffFile interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// openDiff opens the diff at path, or reads it from standard input if path is
+// stdinPath. Standard input is read into memory, so that it can be rewound too.
+func openDiff(path string) (diffFile, error) {
+	if path != stdinPath {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	data, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	return stdinDiff{bytes.NewReader(data)}, nil
+}
+
+// stdinDiff is a diff read from standard input.
+type stdinDiff struct {
+	*bytes.Reader
+}
+
+func (stdinDiff) Close() error { return nil }
+
+// checkStdinDiffs fails if more than one of paths is stdinPath.
+func checkStdinDiffs(paths ...string) error {
+	n := 0
+	for _, path := range paths {
+		if path == stdinPath {
+			n++
+		}
+	}
+	if n > 1 {
+		return errors.New("only one diff can be read from standard input")
+	}
+	return nil
+}
+
+// rewind seeks all files back to their start, so that they can be read again.
+func rewind(files ...io.Seeker) error {
+	for _, f := range files {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errNondeterministic indicates that computing the same result twice gave different results.
+var errNondeterministic = errors.New("nondeterministic result")
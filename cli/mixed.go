@@ -4,24 +4,69 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/golang/glog"
 	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/textnorm"
 	"github.com/google/subcommands"
 )
 
 type mixedCmd struct {
-	oldSource string
-	oldDiff   string
-	newSource string
-	newDiff   string
+	oldSource   string
+	oldDiff     string
+	newSource   string
+	newDiff     string
+	cache       string
+	strip       int
+	order       string
+	strict      bool
+	resume      string
+	repo        string
+	context     int
+	check       bool
+	spaceChange bool
+	allSpace    bool
+	blankLines  bool
+	symbols     bool
+	newlines    string
+	encoding    string
+	algorithm   string
+	progress    bool
+	exclude     string
+	excludeFrom string
+	timestamps  string
+	showFunc    bool
+	funcFile    string
+	keepGoing   bool
+	newFile     bool
+	oldPrefix   string
+	text        bool
+	maxTextSize int
+	newPrefix   string
+	output      outputFlags
 }
 
 func init() {
 	subcommands.Register(&mixedCmd{}, "")
 }
 
+// mixedModeSources computes mixed mode for sources which aren't paths of the OS
+// filesystem.
+type mixedModeSources func(oldSource, newSource string, oldDiff, newDiff io.Reader,
+	opts patchutils.MixedModeOptions) (string, error)
+
+// mixedModeZip and mixedModeGit compute mixed mode for sources in zip archives and
+// for revisions of the git repository at repo. They are nil if the toolchain the
+// tool is built with lacks io/fs.
+var (
+	mixedModeZip mixedModeSources
+	mixedModeGit func(repo string) mixedModeSources
+)
+
 func (*mixedCmd) Name() string { return "mixed" }
 func (*mixedCmd) Synopsis() string {
 	return "compute difference between " +
@@ -29,44 +74,436 @@ func (*mixedCmd) Synopsis() string {
 }
 func (*mixedCmd) Usage() string {
 	return "mixed -oldsource=<oldSource path> -olddiff=<oldDiff path> -newsource=<newSource path> -newdiff=<newDiff path>: " +
-		"Compute difference between oldSource patched with oldDiff and newSource patched with newDiff.\n"
+		"Compute difference between oldSource patched with oldDiff and newSource patched with newDiff. Exit with status 0 if there is none, 1 if there is and 2 on errors.\n"
 }
 
 func (c *mixedCmd) SetFlags(f *flag.FlagSet) {
 	f.StringVar(&c.oldSource, "oldsource", "", "path to the old version of source")
-	f.StringVar(&c.oldDiff, "olddiff", "", "path to the old version of diff")
+	f.StringVar(&c.oldDiff, "olddiff", "", "path to the old version of diff, or \"-\" for standard input")
 	f.StringVar(&c.newSource, "newsource", "", "path to the new version of source")
-	f.StringVar(&c.newDiff, "newdiff", "", "path to the new version of diff")
+	f.StringVar(&c.newDiff, "newdiff", "", "path to the new version of diff, or \"-\" for standard input")
+	f.StringVar(&c.repo, "repo", "", "path to a git repository, of which -oldsource and -newsource are revisions")
+	f.IntVar(&c.context, "U", patchutils.DefaultContextLines, "number of unchanged lines shown around changes")
+	f.BoolVar(&c.spaceChange, "b", false, "ignore changes in the amount of whitespace, like diff -b")
+	f.BoolVar(&c.allSpace, "w", false, "ignore all whitespace, like diff -w")
+	f.BoolVar(&c.blankLines, "B", false, "ignore changes which only add or delete blank lines, like diff -B")
+	f.IntVar(&c.strip, "p", 0, "number of leading path components to strip from file names in diffs")
+	f.StringVar(&c.oldPrefix, "old-prefix", "", "FROM=TO to replace the prefix FROM of file names in the old diff, "+
+		"after -p, with TO, e.g. to match a diff made in a build root with sources checked out elsewhere")
+	f.StringVar(&c.newPrefix, "new-prefix", "", "FROM=TO to replace the prefix FROM of file names in the new diff "+
+		"like -old-prefix")
+	f.StringVar(&c.newlines, "newlines", "exact", "line endings of sources: \"exact\" to compare them byte by byte, "+
+		"\"preserve\" to ignore \\r and keep them, or \"lf\" or \"crlf\" to convert them and the result")
+	f.StringVar(&c.encoding, "encoding", "utf-8", "character encoding of sources: \"utf-8\", \"latin-1\", \"utf-16le\" or \"utf-16be\"")
+	f.StringVar(&c.algorithm, "diff-algorithm", "lcs", "algorithm comparing the patched sources: \"lcs\", \"patience\" or \"histogram\"")
+	f.BoolVar(&c.text, "a", false, "compare all files as text, like diff -a, instead of writing \"Binary files\" lines "+
+		"for files containing NUL bytes or larger than -max-text-size")
+	f.IntVar(&c.maxTextSize, "max-text-size", patchutils.DefaultMaxTextSize, "size in bytes above which files are compared "+
+		"as binary files, or 0 for no limit")
+	f.BoolVar(&c.newFile, "N", false, "write files present in one side only as diffs against /dev/null, like diff -N, "+
+		"instead of \"Only in\" lines")
+	f.BoolVar(&c.strict, "strict", false, "fail on diffs changing a file in more than one entry instead of merging them")
+	f.StringVar(&c.order, "order", "", "sort files of the result in \"git\" or \"diff\" order")
+	f.StringVar(&c.cache, "cache", "", "path to a cache of results of unchanged files, created if missing")
+	c.output.setFlags(f)
+	f.BoolVar(&c.check, "check-determinism", false, "compute the result twice, the second time without -cache, "+
+		"and fail if the results differ")
+	f.BoolVar(&c.symbols, "go-symbols", false, "print the top-level declarations of Go files added, removed "+
+		"or modified after the diff")
+	f.StringVar(&c.resume, "resume", "", "path to a state file recording files done, so that an interrupted run "+
+		"continues where it left off; removed once all files are done")
+	f.StringVar(&c.exclude, "exclude", "", "comma-separated gitignore-style patterns of files and directories "+
+		"of source directories to skip, e.g. \".git,*.o,/vendor\"")
+	f.StringVar(&c.excludeFrom, "exclude-from", "", "path to a file of patterns like -exclude, a pattern per line; "+
+		"empty lines and lines starting with # are skipped")
+	f.StringVar(&c.timestamps, "timestamps", "keep", "timestamps of file headers of the result: \"keep\" them as in the diffs, \"omit\" them, "+
+		"or set them to the Unix \"epoch\"")
+	f.BoolVar(&c.keepGoing, "keep-going", false, "skip files which can't be compared and print the result of the others, "+
+		"exiting with status 2")
+	f.BoolVar(&c.showFunc, "show-function", false, "write the function or heading each hunk is in after its ranges, like diff -p")
+	f.StringVar(&c.funcFile, "function-patterns", "", "path to a file of lines of an extension, or \"*\" for other files, "+
+		"and a regular expression matching lines starting functions of such files; implies -show-function")
+	f.BoolVar(&c.progress, "progress", false, "show a progress bar of files compared on standard error")
 }
 
-func (c *mixedCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+func (c *mixedCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
 	if (c.oldSource == "") || (c.oldDiff == "") || (c.newSource == "") || (c.newDiff == "") {
 		glog.Errorf("Error: necessary flags aren't assigned")
 		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
 		return subcommands.ExitUsageError
 	}
 
-	oldD, err := os.Open(c.oldDiff)
+	if err := checkStdinDiffs(c.oldDiff, c.newDiff); err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.maxTextSize < 0 {
+		glog.Errorf("Error: -max-text-size must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.context < 0 {
+		glog.Errorf("Error: -U must not be negative")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.resume != "" && c.check {
+		glog.Errorf("Error: -resume can't be combined with -check-determinism, which needs the whole result")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if err := c.output.validate(); err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.symbols && c.output.format == "json" {
+		glog.Errorf("Error: -go-symbols can't be combined with -format=json")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.resume != "" && c.output.whole() {
+		glog.Errorf("Error: -resume can't be combined with -color-moved, -side-by-side or -format=json, which need the whole result")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.resume != "" && c.output.out != "" {
+		glog.Errorf("Error: -resume can't be combined with -o, which keeps only results of complete runs")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.resume != "" && c.order != "" {
+		glog.Errorf("Error: -resume can't be combined with -order, which needs the whole result")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	var sources mixedModeSources
+	switch {
+	case c.repo != "":
+		if mixedModeGit == nil {
+			glog.Errorf("Error: -repo needs a build with Go 1.16 or later")
+			return subcommands.ExitUsageError
+		}
+		sources = mixedModeGit(c.repo)
+	case strings.HasSuffix(c.oldSource, ".zip") || strings.HasSuffix(c.newSource, ".zip"):
+		if !strings.HasSuffix(c.oldSource, ".zip") || !strings.HasSuffix(c.newSource, ".zip") {
+			glog.Errorf("Error: a zip archive can only be compared with another zip archive")
+			glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+			return subcommands.ExitUsageError
+		}
+		if mixedModeZip == nil {
+			glog.Errorf("Error: zip archive sources need a build with Go 1.16 or later")
+			return subcommands.ExitUsageError
+		}
+		sources = mixedModeZip
+	}
+	if sources != nil && c.resume != "" {
+		glog.Errorf("Error: -resume can't be combined with -repo or zip archive sources, which need the whole result")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	newlines, err := patchutils.ParseNewlineMode(c.newlines)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	encoding, err := patchutils.ParseEncoding(c.encoding)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	differ, err := patchutils.ParseLineDiffer(c.algorithm)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	timestamps, err := patchutils.ParseTimestampMode(c.timestamps)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	pathMapper, err := prefixMapper(c.oldPrefix, c.newPrefix)
+	if err != nil {
+		glog.Errorf("Error: %v", err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+	sections, err := loadSectionPatterns(c.showFunc, c.funcFile)
+	if err != nil {
+		glog.Errorf("Failed to load function patterns %q: %v\n", c.funcFile, err)
+		return exitTrouble
+	}
+
+	var order patchutils.FileOrder
+	if c.order != "" {
+		var err error
+		order, err = patchutils.ParseFileOrder(c.order)
+		if err != nil {
+			glog.Errorf("Error: %v", err)
+			glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+			return subcommands.ExitUsageError
+		}
+	}
+
+	oldD, err := openDiff(c.oldDiff)
 	if err != nil {
 		glog.Errorf("Failed to open oldDiffFile %q\n", c.oldDiff)
-		return subcommands.ExitFailure
+		return exitTrouble
 	}
 	defer oldD.Close()
 
-	newD, err := os.Open(c.newDiff)
+	newD, err := openDiff(c.newDiff)
 	if err != nil {
 		glog.Errorf("Failed to open newDiffFile %q\n", c.newDiff)
-		return subcommands.ExitFailure
+		return exitTrouble
 	}
 	defer newD.Close()
 
-	result, err := patchutils.MixedModePath(c.oldSource, c.newSource, oldD, newD)
+	opts := patchutils.MixedModeOptions{StripLevel: c.strip, Strict: c.strict, Newlines: newlines, Encoding: encoding,
+		Differ: differ, Timestamps: timestamps, Sections: sections, KeepGoing: c.keepGoing, NewFile: c.newFile,
+		PathMapper: pathMapper, Text: c.text, MaxTextSize: c.maxTextSize}
+	if c.maxTextSize == 0 {
+		opts.MaxTextSize = -1
+	}
+	if c.progress {
+		opts.Progress = progressBar(os.Stderr)
+	}
+	if c.exclude != "" {
+		opts.ExcludeGlobs = strings.Split(c.exclude, ",")
+	}
+	if c.excludeFrom != "" {
+		globs, err := loadExcludeGlobs(c.excludeFrom)
+		if err != nil {
+			glog.Errorf("Failed to load exclude patterns %q: %v\n", c.excludeFrom, err)
+			return exitTrouble
+		}
+		opts.ExcludeGlobs = append(opts.ExcludeGlobs, globs...)
+	}
+	opts.ContextLines = c.context
+	opts.Ignore = textnorm.Ignore{SpaceChange: c.spaceChange, AllSpace: c.allSpace, BlankLines: c.blankLines}
+	if c.context == 0 {
+		opts.ContextLines = patchutils.NoContext
+	}
+	if c.cache != "" {
+		opts.Cache, err = loadCache(c.cache)
+		if err != nil {
+			glog.Errorf("Failed to load cache %q: %v\n", c.cache, err)
+			return exitTrouble
+		}
+	}
+
+	if c.symbols {
+		opts.Symbols = patchutils.NewSymbolSummary()
+	}
+
+	if c.resume != "" {
+		state, err := os.OpenFile(c.resume, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			glog.Errorf("Failed to open resume state %q: %v\n", c.resume, err)
+			return exitTrouble
+		}
+		defer state.Close()
+		opts.Resume, err = patchutils.NewResumeState(state)
+		if err != nil {
+			glog.Errorf("Failed to load resume state %q: %v\n", c.resume, err)
+			return exitTrouble
+		}
+	}
+
+	mixedMode := func(opts patchutils.MixedModeOptions) (string, error) {
+		return patchutils.MixedModePathContext(ctx, c.oldSource, c.newSource, oldD, newD, opts)
+	}
+	if sources != nil {
+		mixedMode = func(opts patchutils.MixedModeOptions) (string, error) {
+			return sources(c.oldSource, c.newSource, oldD, newD, opts)
+		}
+	}
+
+	out, err := c.output.create()
 	if err != nil {
+		glog.Errorf("Failed to create output %q: %v\n", c.output.out, err)
+		return exitTrouble
+	}
+	defer out.abort()
+
+	var result string
+	diffs := &differences{}
+	switch {
+	case c.check:
+		runs := 0
+		result, err = checkDeterminism(func() (string, error) {
+			runOpts := opts
+			if runs++; runs > 1 {
+				// Compute results again instead of taking them from the cache
+				runOpts.Cache = nil
+			}
+			if opts.Symbols != nil {
+				// Symbols of the last run are printed
+				runOpts.Symbols = patchutils.NewSymbolSummary()
+				opts.Symbols = runOpts.Symbols
+			}
+			if err := rewind(oldD, newD); err != nil {
+				return "", err
+			}
+			return mixedMode(runOpts)
+		})
+	case c.order == "" && !c.output.whole() && sources == nil:
+		// Without reordering, files are written as soon as they are done
+		err = patchutils.MixedModePathToContext(ctx, io.MultiWriter(out, diffs), c.oldSource, c.newSource, oldD, newD, opts)
+	default:
+		result, err = mixedMode(opts)
+	}
+	skipped := skippedFiles(err)
+	if err != nil && !skipped {
 		glog.Errorf("Error during computing diff for (%q + %q) and (%q + %q): %v\n",
 			c.oldSource, c.oldDiff, c.newSource, c.newDiff, err)
-		return subcommands.ExitFailure
+		c.output.reportError(err)
+		return exitTrouble
+	}
+
+	// Streamed files are written to diffs, others are in result
+	different := diffs.differ() || hasDifferences(result)
+
+	// Skipped files are left to be done when resuming
+	if c.resume != "" && !skipped {
+		if err := os.Remove(c.resume); err != nil {
+			glog.Errorf("Failed to remove resume state %q: %v\n", c.resume, err)
+			return exitTrouble
+		}
+	}
+
+	if opts.Cache != nil {
+		if err := saveCache(c.cache, opts.Cache); err != nil {
+			glog.Errorf("Failed to save cache %q: %v\n", c.cache, err)
+			return exitTrouble
+		}
 	}
 
-	fmt.Println(result)
-	return subcommands.ExitSuccess
+	if c.order != "" {
+		result, err = patchutils.SortPatch(strings.NewReader(result), order)
+		if err != nil {
+			glog.Errorf("Error during sorting result: %v\n", err)
+			c.output.reportError(err)
+			return exitTrouble
+		}
+	}
+
+	result, err = c.output.render(result)
+	if err != nil {
+		glog.Errorf("Error during rendering result: %v\n", err)
+		c.output.reportError(err)
+		return exitTrouble
+	}
+
+	fmt.Fprintln(out, result)
+	if opts.Symbols != nil {
+		fmt.Fprintf(out, "Go symbols:\n%s", opts.Symbols)
+	}
+	status := commitResult(out, different)
+	if skipped {
+		return exitTrouble
+	}
+	return status
+}
+
+// loadCache reads the result cache at path, or returns an empty one if there is no such file.
+func loadCache(path string) (*patchutils.ResultCache, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return patchutils.NewResultCache(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return patchutils.LoadResultCache(f)
+}
+
+// saveCache writes cache to path.
+func saveCache(path string, cache *patchutils.ResultCache) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := cache.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadExcludeGlobs reads exclude patterns from path, a pattern per line like in
+// .gitignore files. Empty lines and lines starting with # are skipped.
+func loadExcludeGlobs(path string) ([]string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var globs []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		globs = append(globs, line)
+	}
+	return globs, nil
+}
+
+// progressBarWidth is the number of characters of the bar drawn by progressBar.
+const progressBarWidth = 30
+
+// progressBar returns a ProgressFunc drawing a bar of files done, followed by the
+// last file done, on a line of w, which is ended once all files are done.
+func progressBar(w io.Writer) patchutils.ProgressFunc {
+	return func(file string, done, total int) {
+		filled := progressBarWidth * done / total
+		// "\x1b[K" clears the rest of longer lines drawn before
+		fmt.Fprintf(w, "\r[%s%s] %d/%d %s\x1b[K", strings.Repeat("=", filled),
+			strings.Repeat(" ", progressBarWidth-filled), done, total, file)
+		if done == total {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// prefixMapper returns a PathMapper replacing prefixes of file names in the old and
+// the new diff as given by -old-prefix and -new-prefix, or nil if neither is set.
+func prefixMapper(oldPrefix, newPrefix string) (patchutils.PathMapper, error) {
+	if oldPrefix == "" && newPrefix == "" {
+		return nil, nil
+	}
+	replacements := make(map[patchutils.Side][2]string)
+	for side, prefix := range map[patchutils.Side]string{patchutils.OldSide: oldPrefix, patchutils.NewSide: newPrefix} {
+		if prefix == "" {
+			continue
+		}
+		k := strings.Index(prefix, "=")
+		if k < 0 {
+			return nil, fmt.Errorf("-%s-prefix %q isn't FROM=TO", side, prefix)
+		}
+		replacements[side] = [2]string{prefix[:k], prefix[k+1:]}
+	}
+	return func(name string, side patchutils.Side) string {
+		r, ok := replacements[side]
+		if !ok || !strings.HasPrefix(name, r[0]) {
+			return name
+		}
+		return r[1] + strings.TrimPrefix(name, r[0])
+	}, nil
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type portcheckCmd struct {
+	oldSource string
+	newSource string
+	diff      string
+	strip     int
+	fuzz      int
+	maxOffset int
+	all       bool
+}
+
+func init() {
+	subcommands.Register(&portcheckCmd{}, "")
+}
+
+func (*portcheckCmd) Name() string { return "portcheck" }
+func (*portcheckCmd) Synopsis() string {
+	return "preview forward-porting a diff from oldSource to newSource."
+}
+func (*portcheckCmd) Usage() string {
+	return "portcheck -oldsource=<oldSource path> -newsource=<newSource path> -diff=<diff path>: " +
+		"Apply every hunk of the diff to oldSource and to newSource and print the hunks which apply differently.\n"
+}
+
+func (c *portcheckCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.oldSource, "oldsource", "", "path to the version of source the diff was made for")
+	f.StringVar(&c.newSource, "newsource", "", "path to the version of source to port the diff to")
+	f.StringVar(&c.diff, "diff", "", "path to the diff")
+	f.IntVar(&c.strip, "p", 0, "number of leading path components to strip from file names in the diff")
+	f.IntVar(&c.fuzz, "fuzz", 2, "number of context lines which may be ignored at the start and end of hunks")
+	f.IntVar(&c.maxOffset, "max-offset", 1000, "number of lines hunks may be moved from their positions")
+	f.BoolVar(&c.all, "all", false, "print all hunks, not only those which apply differently")
+}
+
+func (c *portcheckCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if (c.oldSource == "") || (c.newSource == "") || (c.diff == "") {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	d, err := os.Open(c.diff)
+	if err != nil {
+		glog.Errorf("Failed to open diff %q\n", c.diff)
+		return subcommands.ExitFailure
+	}
+	defer d.Close()
+
+	opts := patchutils.PortCheckOptions{
+		Apply:      patchutils.ApplyOptions{MaxOffset: c.maxOffset, Fuzz: c.fuzz},
+		StripLevel: c.strip,
+	}
+	ports, err := patchutils.PortCheck(c.oldSource, c.newSource, d, opts)
+	if err != nil {
+		glog.Errorf("Error during checking %q: %v\n", c.diff, err)
+		return subcommands.ExitFailure
+	}
+
+	differing := 0
+	for _, p := range ports {
+		if p.Differs() {
+			differing++
+		} else if !c.all {
+			continue
+		}
+		h := p.Hunk
+		fmt.Printf("%s @@ -%d,%d +%d,%d @@\n\told: %v\n\tnew: %v\n",
+			p.File, h.OrigStartLine, h.OrigLines, h.NewStartLine, h.NewLines, p.Old, p.New)
+	}
+	fmt.Printf("%d of %d hunks apply differently\n", differing, len(ports))
+	return subcommands.ExitSuccess
+}
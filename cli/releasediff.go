@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type releaseDiffCmd struct {
+	oldTar     string
+	oldPatches string
+	newTar     string
+	newPatches string
+}
+
+func init() {
+	subcommands.Register(&releaseDiffCmd{}, "")
+}
+
+func (*releaseDiffCmd) Name() string { return "release-diff" }
+func (*releaseDiffCmd) Synopsis() string {
+	return "compute difference between " +
+		"oldTar release patched with oldPatches and newTar release patched with newPatches."
+}
+func (*releaseDiffCmd) Usage() string {
+	return "release-diff -oldtar=<oldTar path> -oldpatches=<patch paths> -newtar=<newTar path> -newpatches=<patch paths>: " +
+		"Compute difference between oldTar release patched with oldPatches and newTar release patched with newPatches.\n" +
+		"Patches are comma-separated and applied in order.\n"
+}
+
+func (c *releaseDiffCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.oldTar, "oldtar", "", "path to the old release tarball")
+	f.StringVar(&c.oldPatches, "oldpatches", "", "comma-separated paths to the patch series of the old release")
+	f.StringVar(&c.newTar, "newtar", "", "path to the new release tarball")
+	f.StringVar(&c.newPatches, "newpatches", "", "comma-separated paths to the patch series of the new release")
+}
+
+func (c *releaseDiffCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if (c.oldTar == "") || (c.newTar == "") {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	oldT, err := os.Open(c.oldTar)
+	if err != nil {
+		glog.Errorf("Failed to open oldTar %q\n", c.oldTar)
+		return subcommands.ExitFailure
+	}
+	defer oldT.Close()
+
+	newT, err := os.Open(c.newTar)
+	if err != nil {
+		glog.Errorf("Failed to open newTar %q\n", c.newTar)
+		return subcommands.ExitFailure
+	}
+	defer newT.Close()
+
+	oldP, err := openSeries(c.oldPatches)
+	if err != nil {
+		glog.Errorf("Failed to open oldPatches: %v\n", err)
+		return subcommands.ExitFailure
+	}
+	defer closeSeries(oldP)
+
+	newP, err := openSeries(c.newPatches)
+	if err != nil {
+		glog.Errorf("Failed to open newPatches: %v\n", err)
+		return subcommands.ExitFailure
+	}
+	defer closeSeries(newP)
+
+	result, err := patchutils.CompareReleases(oldT, readers(oldP), newT, readers(newP))
+	if err != nil {
+		glog.Errorf("Error during comparing releases %q and %q: %v\n", c.oldTar, c.newTar, err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Println(result)
+	return subcommands.ExitSuccess
+}
+
+// openSeries opens the comma-separated patch paths of a series.
+func openSeries(paths string) ([]*os.File, error) {
+	var files []*os.File
+	if paths == "" {
+		return files, nil
+	}
+	for _, p := range strings.Split(paths, ",") {
+		file, err := os.Open(p)
+		if err != nil {
+			closeSeries(files)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// closeSeries closes all files of a series.
+func closeSeries(files []*os.File) {
+	for _, file := range files {
+		file.Close()
+	}
+}
+
+// readers returns files as io.Readers.
+func readers(files []*os.File) []io.Reader {
+	var result []io.Reader
+	for _, file := range files {
+		result = append(result, file)
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type seriesGraphCmd struct {
+	format string
+	strip  int
+}
+
+func init() {
+	subcommands.Register(&seriesGraphCmd{}, "")
+}
+
+func (*seriesGraphCmd) Name() string { return "series-graph" }
+func (*seriesGraphCmd) Synopsis() string {
+	return "print a graph of the patches of a series changing the same files."
+}
+func (*seriesGraphCmd) Usage() string {
+	return "series-graph [-format=dot|mermaid] <patch path>...: " +
+		"Print a graph linking every two patches of the series which change a common file, labeled by the files.\n"
+}
+
+func (c *seriesGraphCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.format, "format", "dot", "format of the graph: \"dot\" for Graphviz, or \"mermaid\"")
+	f.IntVar(&c.strip, "p", 0, "number of leading path components to strip from file names in the patches")
+}
+
+func (c *seriesGraphCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if f.NArg() == 0 {
+		glog.Error("Error: no patches given")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	if c.format != "dot" && c.format != "mermaid" {
+		glog.Errorf("Error: unknown -format %q", c.format)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	var series []patchutils.SeriesPatch
+	for _, name := range f.Args() {
+		p, err := os.Open(name)
+		if err != nil {
+			glog.Errorf("Failed to open patch %q\n", name)
+			return subcommands.ExitFailure
+		}
+		defer p.Close()
+		series = append(series, patchutils.SeriesPatch{Name: name, Patch: p})
+	}
+
+	g, err := patchutils.PatchSeriesGraph(series, patchutils.SeriesGraphOptions{StripLevel: c.strip})
+	if err != nil {
+		glog.Errorf("Error during reading series: %v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	if c.format == "mermaid" {
+		err = g.WriteMermaid(os.Stdout)
+	} else {
+		err = g.WriteDOT(os.Stdout)
+	}
+	if err != nil {
+		glog.Errorf("Error during printing graph: %v\n", err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
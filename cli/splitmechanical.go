@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type splitMechanicalCmd struct {
+	patch      string
+	rules      string
+	gofmt      bool
+	mechanical string
+	manual     string
+}
+
+func init() {
+	subcommands.Register(&splitMechanicalCmd{}, "")
+}
+
+func (*splitMechanicalCmd) Name() string { return "split-mechanical" }
+func (*splitMechanicalCmd) Synopsis() string {
+	return "classify hunks of a patch as mechanical or manual, and split it accordingly."
+}
+func (*splitMechanicalCmd) Usage() string {
+	return "split-mechanical -patch=<patch path> [-rules=<rules path>] [-gofmt] " +
+		"[-mechanical=<output path> -manual=<output path>]: " +
+		"Print whether every hunk of the patch is reproducible by the rewrite rules and gofmt, " +
+		"or write the mechanical hunks and the manual ones, applying on top of them, to separate patches.\n"
+}
+
+func (c *splitMechanicalCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.patch, "patch", "", "path to the patch")
+	f.StringVar(&c.rules, "rules", "", "path to rewrite rules, a line per rule like s/pattern/replacement/ "+
+		"with any delimiter after s")
+	f.BoolVar(&c.gofmt, "gofmt", false, "treat changes of white space in .go files as mechanical")
+	f.StringVar(&c.mechanical, "mechanical", "", "path to write the patch of mechanical hunks to")
+	f.StringVar(&c.manual, "manual", "", "path to write the patch of manual hunks to")
+}
+
+func (c *splitMechanicalCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.patch == "" || (c.mechanical == "") != (c.manual == "") {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	rules := patchutils.MechanicalRules{Gofmt: c.gofmt}
+	if c.rules != "" {
+		var err error
+		rules.Rewrites, err = loadRewriteRules(c.rules)
+		if err != nil {
+			glog.Errorf("Failed to load rules %q: %v\n", c.rules, err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	p, err := os.Open(c.patch)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", c.patch)
+		return subcommands.ExitFailure
+	}
+	defer p.Close()
+
+	if c.mechanical == "" {
+		classes, err := patchutils.ClassifyHunks(p, rules)
+		if err != nil {
+			glog.Errorf("Error during classifying hunks of %q: %v\n", c.patch, err)
+			return subcommands.ExitFailure
+		}
+		for _, class := range classes {
+			kind := "manual"
+			if class.Mechanical {
+				kind = "mechanical"
+			}
+			fmt.Printf("%s hunk %d: %s\n", class.File, class.Hunk+1, kind)
+		}
+		return subcommands.ExitSuccess
+	}
+
+	mechanical, manual, err := patchutils.SplitMechanical(p, rules)
+	if err != nil {
+		glog.Errorf("Error during splitting %q: %v\n", c.patch, err)
+		return subcommands.ExitFailure
+	}
+	if err := ioutil.WriteFile(c.mechanical, []byte(mechanical), 0644); err != nil {
+		glog.Errorf("Failed to write %q: %v\n", c.mechanical, err)
+		return subcommands.ExitFailure
+	}
+	if err := ioutil.WriteFile(c.manual, []byte(manual), 0644); err != nil {
+		glog.Errorf("Failed to write %q: %v\n", c.manual, err)
+		return subcommands.ExitFailure
+	}
+	return subcommands.ExitSuccess
+}
+
+// loadRewriteRules reads rewrite rules from path, a line per rule like s/pattern/replacement/,
+// where the character after s delimits the parts. Empty lines and lines starting with # are skipped.
+func loadRewriteRules(path string) ([]patchutils.RewriteRule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []patchutils.RewriteRule
+	s := bufio.NewScanner(f)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if len(line) < 2 || line[0] != 's' {
+			return nil, fmt.Errorf("line %d: %q isn't like s/pattern/replacement/", n, line)
+		}
+		parts := strings.Split(line[2:], line[1:2])
+		if len(parts) != 3 || parts[2] != "" {
+			return nil, fmt.Errorf("line %d: %q isn't like s/pattern/replacement/", n, line)
+		}
+		pattern, err := regexp.Compile(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		rules = append(rules, patchutils.RewriteRule{Pattern: pattern, Replacement: parts[1]})
+	}
+	return rules, s.Err()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type transformCmd struct {
+	pipeline string
+	patch    string
+}
+
+func init() {
+	subcommands.Register(&transformCmd{}, "")
+}
+
+func (*transformCmd) Name() string { return "transform" }
+func (*transformCmd) Synopsis() string {
+	return "transform a patch by a pipeline of filter, strip, recount, reverse and stat steps."
+}
+func (*transformCmd) Usage() string {
+	return "transform -pipeline=<pipeline path> [-patch=<patch path>]: " +
+		"Print the patch, read from standard input without -patch, transformed by the steps of the YAML pipeline in order.\n"
+}
+
+func (c *transformCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.pipeline, "pipeline", "", "path to the YAML description of the pipeline")
+	f.StringVar(&c.patch, "patch", "", "path to the patch, read from standard input if empty")
+}
+
+func (c *transformCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.pipeline == "" {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	pf, err := os.Open(c.pipeline)
+	if err != nil {
+		glog.Errorf("Failed to open pipeline %q\n", c.pipeline)
+		return subcommands.ExitFailure
+	}
+	defer pf.Close()
+	pipeline, err := patchutils.ParsePipeline(pf)
+	if err != nil {
+		glog.Errorf("Error: pipeline %q: %v", c.pipeline, err)
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	var patch io.Reader = os.Stdin
+	if c.patch != "" {
+		p, err := os.Open(c.patch)
+		if err != nil {
+			glog.Errorf("Failed to open patch %q\n", c.patch)
+			return subcommands.ExitFailure
+		}
+		defer p.Close()
+		patch = p
+	}
+
+	result, err := pipeline.Run(patch)
+	if err != nil {
+		glog.Errorf("Error during transforming patch: %v\n", err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Print(result)
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type unwrapCmd struct {
+	patch string
+}
+
+func init() {
+	subcommands.Register(&unwrapCmd{}, "")
+}
+
+func (*unwrapCmd) Name() string { return "unwrap" }
+func (*unwrapCmd) Synopsis() string {
+	return "repair a patch whose lines were wrapped by a mail client."
+}
+func (*unwrapCmd) Usage() string {
+	return "unwrap -patch=<patch path>: " +
+		"Print the patch with lines of hunks wrapped by a mail client joined again, using the line counts of hunk headers.\n"
+}
+
+func (c *unwrapCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.patch, "patch", "", "path to the patch, or \"-\" for standard input")
+}
+
+func (c *unwrapCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.patch == "" {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	p, err := openDiff(c.patch)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", c.patch)
+		return subcommands.ExitFailure
+	}
+	defer p.Close()
+
+	result, err := patchutils.UnwrapDiff(p)
+	if err != nil {
+		glog.Errorf("Error during unwrapping %q: %v\n", c.patch, err)
+		return subcommands.ExitFailure
+	}
+
+	fmt.Print(result)
+	return subcommands.ExitSuccess
+}
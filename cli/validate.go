@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+	"github.com/google/go-patchutils"
+	"github.com/google/subcommands"
+)
+
+type validateCmd struct {
+	patch string
+}
+
+func init() {
+	subcommands.Register(&validateCmd{}, "")
+}
+
+func (*validateCmd) Name() string { return "validate" }
+func (*validateCmd) Synopsis() string {
+	return "report malformed hunks and headers of a patch."
+}
+func (*validateCmd) Usage() string {
+	return "validate -patch=<patch path>: " +
+		"Print problems of the patch, such as wrong hunk counts, truncated hunks or missing headers, with their lines. " +
+		"Exit with status 0 if there are none, 1 if there are and 2 on errors.\n"
+}
+
+func (c *validateCmd) SetFlags(f *flag.FlagSet) {
+	f.StringVar(&c.patch, "patch", "", "path to the patch, or \"-\" for standard input")
+}
+
+func (c *validateCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if c.patch == "" {
+		glog.Error("Error: necessary flags aren't assigned")
+		glog.Infof("Usage: %s %s", os.Args[0], c.Usage())
+		return subcommands.ExitUsageError
+	}
+
+	p, err := openDiff(c.patch)
+	if err != nil {
+		glog.Errorf("Failed to open patch %q\n", c.patch)
+		return exitTrouble
+	}
+	defer p.Close()
+
+	problems := patchutils.Validate(p)
+	for _, problem := range problems {
+		fmt.Printf("%s: %v\n", c.patch, problem)
+	}
+	if len(problems) > 0 {
+		return exitDifferent
+	}
+	return exitSame
+}
@@ -0,0 +1,41 @@
+//go:build go1.16
+// +build go1.16
+
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+
+	"github.com/google/go-patchutils"
+)
+
+func init() {
+	mixedModeZip = mixedModeZipArchives
+}
+
+// mixedModeZipArchives computes mixed mode for the trees of the zip archives at
+// oldZip and newZip.
+func mixedModeZipArchives(oldZip, newZip string, oldDiff, newDiff io.Reader, opts patchutils.MixedModeOptions) (string, error) {
+	oldR, err := zip.OpenReader(oldZip)
+	if err != nil {
+		return "", fmt.Errorf("open %q: %w", oldZip, err)
+	}
+	defer oldR.Close()
+	newR, err := zip.OpenReader(newZip)
+	if err != nil {
+		return "", fmt.Errorf("open %q: %w", newZip, err)
+	}
+	defer newR.Close()
+
+	oldFS, err := patchutils.ZipFS(&oldR.Reader)
+	if err != nil {
+		return "", fmt.Errorf("read %q: %w", oldZip, err)
+	}
+	newFS, err := patchutils.ZipFS(&newR.Reader)
+	if err != nil {
+		return "", fmt.Errorf("read %q: %w", newZip, err)
+	}
+	return patchutils.MixedModeFSWithOptions(oldFS, newFS, oldDiff, newDiff, opts)
+}
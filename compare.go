@@ -0,0 +1,60 @@
+package patchutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// CompareOptions configures ComparePatches.
+type CompareOptions struct {
+	// Semantic compares the changes patches make instead of their text. Both are
+	// normalized: files are matched by name whatever their order, and hunks are
+	// applied and diffed again, so that patches which list files in another order,
+	// split changes into other hunks or have other context lines are equal.
+	Semantic bool
+}
+
+// ComparePatches reports whether patches a and b are equal, byte by byte unless
+// opts.Semantic is set. Patches whose context lines disagree apply to different
+// sources, so they aren't semantically equal.
+func ComparePatches(a, b io.Reader, opts CompareOptions) (bool, error) {
+	if !opts.Semantic {
+		aContent, err := ioutil.ReadAll(a)
+		if err != nil {
+			return false, fmt.Errorf("reading a: %w", err)
+		}
+		bContent, err := ioutil.ReadAll(b)
+		if err != nil {
+			return false, fmt.Errorf("reading b: %w", err)
+		}
+		return bytes.Equal(aContent, bContent), nil
+	}
+
+	// The interdiff of the patches has no changes if they make the same ones
+	fileDiffs, notes, err := InterDiffFiles(a, b)
+	if errors.Is(err, ErrContentMismatch) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("comparing patches: %w", err)
+	}
+	if len(notes) > 0 {
+		return false, nil
+	}
+	for _, fd := range fileDiffs {
+		if len(fd.Hunks) > 0 {
+			return false, nil
+		}
+		for _, line := range fd.Extended {
+			// Other extended headers, such as mode changes or binary files, are differences
+			if !strings.HasPrefix(line, "diff --git ") && !strings.HasPrefix(line, "index ") {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,110 @@
+package patchutils
+
+import (
+	"strings"
+	"testing"
+)
+
+const comparePatch = `--- a/f.txt
++++ b/f.txt
+@@ -1,7 +1,7 @@
+ 1
+-2
++two
+ 3
+ 4
+ 5
+-6
++six
+ 7
+--- a/g.txt
++++ b/g.txt
+@@ -1,2 +1,2 @@
+-x
++X
+ y
+`
+
+// compareReordered makes the changes of comparePatch with files in another order
+// and other hunks.
+const compareReordered = `--- a/g.txt
++++ b/g.txt
+@@ -1,1 +1,1 @@
+-x
++X
+--- a/f.txt
++++ b/f.txt
+@@ -2,1 +2,1 @@
+-2
++two
+@@ -5,3 +5,3 @@
+ 5
+-6
++six
+ 7
+`
+
+var comparePatchesTests = []struct {
+	name     string
+	other    string
+	semantic bool
+	equal    bool
+}{
+	{
+		name:     "same text",
+		other:    comparePatch,
+		semantic: false,
+		equal:    true,
+	},
+	{
+		name:     "files reordered and hunks split",
+		other:    compareReordered,
+		semantic: true,
+		equal:    true,
+	},
+	{
+		name:     "files reordered and hunks split byte by byte",
+		other:    compareReordered,
+		semantic: false,
+		equal:    false,
+	},
+	{
+		name:     "other change",
+		other:    strings.Replace(comparePatch, "+six", "+SIX", 1),
+		semantic: true,
+		equal:    false,
+	},
+	{
+		name: "file missing",
+		other: `--- a/g.txt
++++ b/g.txt
+@@ -1,2 +1,2 @@
+-x
++X
+ y
+`,
+		semantic: true,
+		equal:    false,
+	},
+	{
+		name:     "other source",
+		other:    strings.Replace(comparePatch, " 3\n", " three\n", 1),
+		semantic: true,
+		equal:    false,
+	},
+}
+
+func TestComparePatches(t *testing.T) {
+	for _, tt := range comparePatchesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			equal, err := ComparePatches(strings.NewReader(comparePatch), strings.NewReader(tt.other),
+				CompareOptions{Semantic: tt.semantic})
+			if err != nil {
+				t.Fatalf("ComparePatches: got error %v; want error nil", err)
+			}
+			if equal != tt.equal {
+				t.Errorf("ComparePatches = %v; want %v", equal, tt.equal)
+			}
+		})
+	}
+}
@@ -0,0 +1,378 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-patchutils/hunkmath"
+	"github.com/google/go-patchutils/hunks"
+	"github.com/google/go-patchutils/textnorm"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// mergeSamePathFileDiffs returns fileDiffs with every FileDiff changing a file
+// changed by an earlier FileDiff merged into the earlier one, so that each file
+// is changed by one FileDiff only. Later FileDiffs apply to the result of earlier
+// ones, as some tools split changes of a file into several entries of one patch,
+// and concatenated patches may delete a file in one entry and add it again in
+// another. Files are the same regardless of a/ and b/ prefixes, see composedPath.
+func mergeSamePathFileDiffs(fileDiffs []*diff.FileDiff) ([]*diff.FileDiff, error) {
+	var result []*diff.FileDiff
+	// index of the merged FileDiff in result by path
+	index := make(map[string]int)
+	for _, fd := range fileDiffs {
+		if fd.NewName == "" {
+			// "Only in" entries don't change files
+			result = append(result, fd)
+			continue
+		}
+		path := composedPath(fd)
+		k, ok := index[path]
+		if !ok {
+			index[path] = len(result)
+			result = append(result, fd)
+			continue
+		}
+		composed, err := composeFileDiffs(result[k], fd)
+		if err != nil {
+			return nil, fmt.Errorf("merging changes of %q: %w", fileDiffPath(fd), err)
+		}
+		result[k] = composed
+	}
+	return result, nil
+}
+
+// ComposeDiffs returns a patch with the changes of patches, each applying to the
+// result of the ones before it like the patches of a patch queue, so that the
+// result applies to the source the first one applies to. It fails with
+// ErrContentMismatch if a patch doesn't apply on top of the previous ones: if it
+// disagrees with them about lines both change, adds a file they leave in place
+// or changes a file they delete.
+func ComposeDiffs(patches ...io.Reader) (string, error) {
+	if len(patches) == 0 {
+		return "", ErrEmptyDiffFile
+	}
+	var result []*diff.FileDiff
+	// index of the composed FileDiff in result by path
+	index := make(map[string]int)
+	for n, patch := range patches {
+		fileDiffs, err := readPatch(patch)
+		if err != nil {
+			return "", fmt.Errorf("parsing patch %d: %w", n+1, err)
+		}
+		if len(fileDiffs) == 0 {
+			return "", fmt.Errorf("patch %d: %w", n+1, ErrEmptyDiffFile)
+		}
+		for _, fd := range fileDiffs {
+			if fd.NewName == "" {
+				// "Only in" entries don't change files
+				continue
+			}
+			path := composedPath(fd)
+			k, ok := index[path]
+			if !ok {
+				index[path] = len(result)
+				result = append(result, fd)
+				continue
+			}
+			switch {
+			case isDevNull(fd.OrigName) && !isDevNull(result[k].NewName):
+				return "", fmt.Errorf("patch %d adds %q, which exists: %w", n+1, path, ErrContentMismatch)
+			case !isDevNull(fd.OrigName) && isDevNull(result[k].NewName):
+				return "", fmt.Errorf("patch %d changes %q, which is deleted: %w", n+1, path, ErrContentMismatch)
+			}
+			composed, err := composeFileDiffs(result[k], fd)
+			if err != nil {
+				return "", fmt.Errorf("patch %d: composing changes of %q: %w", n+1, path, err)
+			}
+			result[k] = composed
+		}
+	}
+
+	var fileDiffs []*diff.FileDiff
+	for _, fd := range result {
+		if isDevNull(fd.OrigName) && isDevNull(fd.NewName) {
+			// Files added and deleted again aren't changed
+			continue
+		}
+		fileDiffs = append(fileDiffs, fd)
+	}
+	composed, err := diff.PrintMultiFileDiff(fileDiffs)
+	if err != nil {
+		return "", fmt.Errorf("printing composed patch: %w", err)
+	}
+	return string(composed), nil
+}
+
+// composedPath returns the name of the file changed by fd without an a/ or b/
+// prefix, so that a file deleted by one FileDiff and added again by another one
+// is the same file when FileDiffs are composed.
+func composedPath(fd *diff.FileDiff) string {
+	path := fileDiffPath(fd)
+	if strings.HasPrefix(path, "a/") || strings.HasPrefix(path, "b/") {
+		return path[2:]
+	}
+	return path
+}
+
+// checkDuplicatePaths returns a *DuplicatePathError listing all files changed
+// by more than one FileDiff of fileDiffs, or nil if there are none.
+func checkDuplicatePaths(fileDiffs []*diff.FileDiff) error {
+	// paths are the names of files as reported, by the path they are compared by
+	var keys []string
+	paths := make(map[string]string)
+	indices := make(map[string][]int)
+	for k, fd := range fileDiffs {
+		if fd.NewName == "" {
+			continue
+		}
+		key := composedPath(fd)
+		if _, ok := indices[key]; !ok {
+			keys = append(keys, key)
+			paths[key] = fileDiffPath(fd)
+		}
+		indices[key] = append(indices[key], k)
+	}
+
+	var duplicates []DuplicatePath
+	for _, key := range keys {
+		if len(indices[key]) > 1 {
+			duplicates = append(duplicates, DuplicatePath{Path: paths[key], Indices: indices[key]})
+		}
+	}
+	if len(duplicates) == 0 {
+		return nil
+	}
+	return &DuplicatePathError{Duplicates: duplicates}
+}
+
+// DuplicatePath is a file changed by more than one FileDiff of a diff.
+type DuplicatePath struct {
+	// Path is the name of the file.
+	Path string
+	// Indices are positions of the FileDiffs changing the file in the diff, counted from 0.
+	Indices []int
+}
+
+// DuplicatePathError is returned in strict mode for diffs changing some files in
+// more than one FileDiff, instead of merging them.
+type DuplicatePathError struct {
+	// Duplicates lists the files in the order they first appear in the diff.
+	Duplicates []DuplicatePath
+}
+
+func (e *DuplicatePathError) Error() string {
+	var parts []string
+	for _, d := range e.Duplicates {
+		indices := make([]string, len(d.Indices))
+		for k, i := range d.Indices {
+			indices[k] = strconv.Itoa(i)
+		}
+		parts = append(parts, fmt.Sprintf("%q (entries %s)", d.Path, strings.Join(indices, ", ")))
+	}
+	return fmt.Sprintf("%v: %s", ErrDuplicatePath, strings.Join(parts, ", "))
+}
+
+// Unwrap returns ErrDuplicatePath, so that errors.Is(err, ErrDuplicatePath) holds.
+func (e *DuplicatePathError) Unwrap() error {
+	return ErrDuplicatePath
+}
+
+// fileDiffPath returns the name of the file changed by fd: the name after the
+// change, or before it if the file is deleted.
+func fileDiffPath(fd *diff.FileDiff) string {
+	if h, ok := parseGitHeader(fd.Extended); ok {
+		return h.newName
+	}
+	if isDevNull(fd.NewName) {
+		return fd.OrigName
+	}
+	return fd.NewName
+}
+
+// composedHunk is a hunk of one of two FileDiffs being composed.
+type composedHunk struct {
+	hunk  *diff.Hunk
+	lines []Line
+	// first is set for hunks of the FileDiff applied first.
+	first bool
+}
+
+// midRange returns the lines of the file between the two FileDiffs covered by c:
+// the new side of hunks applied first, the original side of the others.
+// Empty ranges start at the line before which lines are added or deleted.
+func (c composedHunk) midRange() hunkmath.Range {
+	r := hunkmath.HunkOrigRange(c.hunk)
+	if c.first {
+		r = hunkmath.HunkNewRange(c.hunk)
+	}
+	if r.Len() == 0 {
+		r.Start++
+		r.End++
+	}
+	return r
+}
+
+// composeFileDiffs returns a FileDiff with the changes of first followed by the
+// changes of second, which applies to the file patched with first.
+// Hunks of both that don't overlap are kept as they are, only moved; overlapping ones
+// are replaced by the diff of their original lines and the lines they result in.
+func composeFileDiffs(first, second *diff.FileDiff) (*diff.FileDiff, error) {
+	var hunks []composedHunk
+	for _, fd := range []*diff.FileDiff{first, second} {
+		for _, h := range fd.Hunks {
+			lines, err := HunkLines(h)
+			if err != nil {
+				return nil, fmt.Errorf("hunk %s: %w", hunkHeader(h), err)
+			}
+			hunks = append(hunks, composedHunk{hunk: h, lines: lines, first: fd == first})
+		}
+	}
+	// Lines added or deleted before a line go before hunks starting at it
+	sort.SliceStable(hunks, func(i, j int) bool {
+		ri, rj := hunks[i].midRange(), hunks[j].midRange()
+		if ri.Start != rj.Start {
+			return ri.Start < rj.Start
+		}
+		return ri.Len() == 0 && rj.Len() > 0
+	})
+
+	result := &diff.FileDiff{
+		OrigName: first.OrigName,
+		OrigTime: first.OrigTime,
+		NewName:  second.NewName,
+		NewTime:  second.NewTime,
+		Extended: composedExtended(first.Extended, second.Extended),
+		Hunks:    []*diff.Hunk{},
+	}
+	// firstDelta and secondDelta are the numbers of lines added by hunks done so far
+	var firstDelta, secondDelta int32
+	for k := 0; k < len(hunks); {
+		group, r := hunks[k:k+1], hunks[k].midRange()
+		for k+len(group) < len(hunks) && composedTogether(hunks[k+len(group)].midRange(), r) {
+			if end := hunks[k+len(group)].midRange().End; end > r.End {
+				r.End = end
+			}
+			group = hunks[k : k+len(group)+1]
+		}
+		k += len(group)
+
+		if len(group) == 1 {
+			h := *group[0].hunk
+			if group[0].first {
+				h.NewStartLine += secondDelta
+				firstDelta += hunkmath.HunkDelta(&h)
+			} else {
+				h.OrigStartLine -= firstDelta
+				secondDelta += hunkmath.HunkDelta(&h)
+			}
+			result.Hunks = append(result.Hunks, &h)
+			continue
+		}
+
+		composed, err := composeHunks(group, r, r.Start-firstDelta, r.Start+secondDelta)
+		if err != nil {
+			return nil, err
+		}
+		result.Hunks = append(result.Hunks, composed...)
+		for _, c := range group {
+			if c.first {
+				firstDelta += hunkmath.HunkDelta(c.hunk)
+			} else {
+				secondDelta += hunkmath.HunkDelta(c.hunk)
+			}
+		}
+	}
+	return result, nil
+}
+
+// composedTogether reports whether a hunk covering r joins a group of hunks covering
+// group: if they overlap, or if both are empty at the same line, such as lines of
+// a file deleted by the first FileDiff and added again by the second one.
+func composedTogether(r, group hunkmath.Range) bool {
+	return r.Overlaps(group) || r.Len() == 0 && group.Len() == 0 && r.Start == group.Start
+}
+
+// composeHunks returns hunks changing the lines the overlapping hunks of group apply
+// to into the lines they result in. r is the range of the file between the FileDiffs
+// covered by group, which starts at origStart in the original file and at newStart
+// in the new one.
+func composeHunks(group []composedHunk, r hunkmath.Range, origStart, newStart int32) ([]*diff.Hunk, error) {
+	// Lines of the file between the FileDiffs, as seen by both
+	mid := make([]string, r.Len())
+	known := make([]bool, r.Len())
+	for _, c := range group {
+		k := c.midRange().Start - r.Start
+		for _, line := range c.lines {
+			if c.first && line.Op == OpDelete || !c.first && line.Op == OpAdd {
+				continue
+			}
+			if known[k] && mid[k] != line.Text {
+				return nil, fmt.Errorf("line %d is %q in the first change and %q in the second one: %w",
+					r.Start+k, mid[k], line.Text, ErrContentMismatch)
+			}
+			mid[k], known[k] = line.Text, true
+			k++
+		}
+	}
+
+	// side returns the lines of r with hunks of group selected by first replaced
+	// by their lines skipping op
+	side := func(first bool, skip LineOp) []string {
+		var lines []string
+		pos := r.Start
+		for _, c := range group {
+			if c.first != first {
+				continue
+			}
+			cr := c.midRange()
+			lines = append(lines, mid[pos-r.Start:cr.Start-r.Start]...)
+			for _, line := range c.lines {
+				if line.Op != skip {
+					lines = append(lines, line.Text)
+				}
+			}
+			pos = cr.End
+		}
+		return append(lines, mid[pos-r.Start:]...)
+	}
+	origLines := side(true, OpAdd)
+	newLines := side(false, OpDelete)
+
+	fd := &diff.FileDiff{}
+	hunks.ChunksToFileDiff(diffLines(origLines, newLines, textnorm.Options{}, textnorm.Ignore{}, nil), fd, 0, 0)
+	for _, h := range fd.Hunks {
+		h.OrigStartLine += origStart - 1
+		h.NewStartLine += newStart - 1
+	}
+	return fd.Hunks, nil
+}
+
+// composedExtended returns git extended header lines of the composition of FileDiffs
+// with extended header lines first and second: those of first, with the blob hash
+// of the result taken from second.
+func composedExtended(first, second []string) []string {
+	firstHeader, ok := parseGitHeader(first)
+	secondHeader, secondOK := parseGitHeader(second)
+	if !ok || !secondOK || firstHeader.oldHash == "" || secondHeader.newHash == "" {
+		return first
+	}
+
+	extended := make([]string, len(first))
+	for k, line := range first {
+		if strings.HasPrefix(line, "index ") {
+			fields := strings.Fields(line)
+			fields[1] = firstHeader.oldHash + ".." + secondHeader.newHash
+			line = strings.Join(fields, " ")
+		}
+		extended[k] = line
+	}
+	return extended
+}
+
+// ErrDuplicatePath indicates that a diff changes a file in more than one FileDiff.
+var ErrDuplicatePath = errors.New("file changed by more than one entry")
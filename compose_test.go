@@ -0,0 +1,212 @@
+package patchutils
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const composeSource = "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"
+
+var composeFileDiffsTests = []struct {
+	name   string
+	first  string
+	second string
+	result string
+}{
+	{
+		name:   "separate hunks",
+		first:  "--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n 1\n+1a\n 2\n 3\n",
+		second: "--- a/f\n+++ b/f\n@@ -9,3 +9,2 @@\n 8\n-9\n 10\n",
+		result: "--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n 1\n+1a\n 2\n 3\n@@ -8,3 +9,2 @@\n 8\n-9\n 10\n",
+	},
+	{
+		name:   "overlapping hunks",
+		first:  "--- a/f\n+++ b/f\n@@ -4,3 +4,3 @@\n 4\n-5\n+five\n 6\n",
+		second: "--- a/f\n+++ b/f\n@@ -3,5 +3,5 @@\n 3\n 4\n-five\n+FIVE\n 6\n 7\n",
+		result: "--- a/f\n+++ b/f\n@@ -3,5 +3,5 @@\n 3\n 4\n-5\n+FIVE\n 6\n 7\n",
+	},
+	{
+		name:   "added line deleted again",
+		first:  "--- a/f\n+++ b/f\n@@ -6,2 +6,3 @@\n 6\n+x\n 7\n",
+		second: "--- a/f\n+++ b/f\n@@ -6,3 +6,2 @@\n 6\n-x\n 7\n",
+		result: "--- a/f\n+++ b/f\n",
+	},
+}
+
+func TestComposeFileDiffs(t *testing.T) {
+	for _, tt := range composeFileDiffsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			first, err := diff.ParseFileDiff([]byte(tt.first))
+			if err != nil {
+				t.Fatalf("parsing first: %v", err)
+			}
+			second, err := diff.ParseFileDiff([]byte(tt.second))
+			if err != nil {
+				t.Fatalf("parsing second: %v", err)
+			}
+
+			composed, err := composeFileDiffs(first, second)
+			if err != nil {
+				t.Fatalf("composeFileDiffs: got error %v; want error nil", err)
+			}
+			result, err := diff.PrintFileDiff(composed)
+			if err != nil {
+				t.Fatalf("printing result: %v", err)
+			}
+			if string(result) != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+
+			patched, err := ApplyFileDiff(composeSource, first, ApplyOptions{})
+			if err != nil {
+				t.Fatalf("applying first: %v", err)
+			}
+			want, err := ApplyFileDiff(patched, second, ApplyOptions{})
+			if err != nil {
+				t.Fatalf("applying second: %v", err)
+			}
+			got, err := ApplyFileDiff(composeSource, composed, ApplyOptions{})
+			if err != nil {
+				t.Fatalf("applying result: %v", err)
+			}
+			if got != want {
+				t.Errorf("Applied result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+			}
+		})
+	}
+}
+
+func TestComposeFileDiffsMismatch(t *testing.T) {
+	first, err := diff.ParseFileDiff([]byte("--- a/f\n+++ b/f\n@@ -4,3 +4,3 @@\n 4\n-5\n+five\n 6\n"))
+	if err != nil {
+		t.Fatalf("parsing first: %v", err)
+	}
+	second, err := diff.ParseFileDiff([]byte("--- a/f\n+++ b/f\n@@ -4,3 +4,3 @@\n 4\n-5\n+FIVE\n 6\n"))
+	if err != nil {
+		t.Fatalf("parsing second: %v", err)
+	}
+	if _, err := composeFileDiffs(first, second); !errors.Is(err, ErrContentMismatch) {
+		t.Errorf("composeFileDiffs: got error %v; want error %v", err, ErrContentMismatch)
+	}
+}
+
+func TestInterDiffSamePathEntries(t *testing.T) {
+	oldDiff := "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n" +
+		"--- a/g\n+++ b/g\n@@ -1 +1 @@\n-g\n+G\n" +
+		"--- a/f\n+++ b/f\n@@ -9,3 +9,3 @@\n 8\n-9\n+nine\n 10\n"
+	newDiff := "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n@@ -9,3 +9,3 @@\n 8\n-9\n+NINE\n 10\n" +
+		"--- a/g\n+++ b/g\n@@ -1 +1 @@\n-g\n+GG\n"
+	want := "--- b/f\n+++ b/f\n@@ -9,3 +9,3 @@\n 8\n-nine\n+NINE\n 10\n" +
+		"--- b/g\n+++ b/g\n@@ -1,1 +1,1 @@\n-G\n+GG\n"
+
+	result, err := InterDiff(strings.NewReader(oldDiff), strings.NewReader(newDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestCheckDuplicatePaths(t *testing.T) {
+	patch := "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-1\n+one\n" +
+		"--- a/g\n+++ b/g\n@@ -1 +1 @@\n-g\n+G\n" +
+		"Only in a: h\n" +
+		"--- a/f\n+++ b/f\n@@ -9 +9 @@\n-9\n+nine\n"
+	fileDiffs, err := diff.NewMultiFileDiffReader(strings.NewReader(patch)).ReadAllFiles()
+	if err != nil {
+		t.Fatalf("parsing patch: %v", err)
+	}
+
+	err = checkDuplicatePaths(fileDiffs)
+	var dupErr *DuplicatePathError
+	if !errors.As(err, &dupErr) {
+		t.Fatalf("checkDuplicatePaths: got error %v; want *DuplicatePathError", err)
+	}
+	if !errors.Is(err, ErrDuplicatePath) {
+		t.Errorf("checkDuplicatePaths: got error %v; want error %v", err, ErrDuplicatePath)
+	}
+	want := []DuplicatePath{{Path: "b/f", Indices: []int{0, 3}}}
+	if !reflect.DeepEqual(dupErr.Duplicates, want) {
+		t.Errorf("checkDuplicatePaths: got duplicates %+v; want %+v", dupErr.Duplicates, want)
+	}
+
+	if err := checkDuplicatePaths(fileDiffs[:3]); err != nil {
+		t.Errorf("checkDuplicatePaths without duplicates: got error %v; want error nil", err)
+	}
+}
+
+func TestComposeDiffs(t *testing.T) {
+	patches := []string{
+		"--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n 1\n+1a\n 2\n 3\n" +
+			"--- /dev/null\n+++ b/g\n@@ -0,0 +1,2 @@\n+g1\n+g2\n",
+		"--- a/f\n+++ b/f\n@@ -1,4 +1,4 @@\n 1\n-1a\n+1b\n 2\n 3\n@@ -9,3 +9,2 @@\n 8\n-9\n 10\n" +
+			"--- a/g\n+++ b/g\n@@ -1,2 +1,2 @@\n g1\n-g2\n+G2\n",
+		"--- a/h\n+++ /dev/null\n@@ -1 +0,0 @@\n-h\n",
+	}
+	want := "--- a/f\n+++ b/f\n@@ -1,3 +1,4 @@\n 1\n+1b\n 2\n 3\n@@ -8,3 +9,2 @@\n 8\n-9\n 10\n" +
+		"--- /dev/null\n+++ b/g\n@@ -0,0 +1,2 @@\n+g1\n+G2\n" +
+		"--- a/h\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-h\n"
+
+	var readers []io.Reader
+	for _, p := range patches {
+		readers = append(readers, strings.NewReader(p))
+	}
+	result, err := ComposeDiffs(readers...)
+	if err != nil {
+		t.Fatalf("ComposeDiffs: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestComposeDiffsMismatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		first, second string
+	}{
+		{
+			name:   "different lines",
+			first:  "--- a/f\n+++ b/f\n@@ -4,3 +4,3 @@\n 4\n-5\n+five\n 6\n",
+			second: "--- a/f\n+++ b/f\n@@ -4,3 +4,3 @@\n 4\n-5\n+FIVE\n 6\n",
+		},
+		{
+			name:   "file added twice",
+			first:  "--- /dev/null\n+++ b/f\n@@ -0,0 +1 @@\n+f\n",
+			second: "--- /dev/null\n+++ b/f\n@@ -0,0 +1 @@\n+f\n",
+		},
+		{
+			name:   "deleted file changed",
+			first:  "--- a/f\n+++ /dev/null\n@@ -1 +0,0 @@\n-f\n",
+			second: "--- a/f\n+++ b/f\n@@ -1 +1 @@\n-f\n+F\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ComposeDiffs(strings.NewReader(tt.first), strings.NewReader(tt.second))
+			if !errors.Is(err, ErrContentMismatch) {
+				t.Errorf("ComposeDiffs: got error %v; want error %v", err, ErrContentMismatch)
+			}
+		})
+	}
+}
+
+func TestInterDiffDeletedAndAddedEntries(t *testing.T) {
+	oldDiff := "--- a/f\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-1\n-2\n" +
+		"--- /dev/null\n+++ b/f\n@@ -0,0 +1,2 @@\n+1\n+two\n"
+	newDiff := "--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n 1\n-2\n+two\n"
+
+	result, err := InterDiff(strings.NewReader(oldDiff), strings.NewReader(newDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	if strings.Contains(result, "@@") || strings.Contains(result, "Only in") {
+		t.Errorf("InterDiff: got %q; want no changes", result)
+	}
+}
@@ -0,0 +1,375 @@
+package patchutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// contextHunkSeparator starts every hunk of a diff in context format.
+const contextHunkSeparator = "***************"
+
+// noNewlineMarker follows the last line of a file without a trailing newline.
+const noNewlineMarker = `\ No newline at end of file`
+
+var (
+	// contextOrigRangeRegexp matches the line starting the original lines of a context hunk.
+	contextOrigRangeRegexp = regexp.MustCompile(`^\*\*\* (\d+)(?:,(\d+))? \*\*\*\*$`)
+	// contextNewRangeRegexp matches the line starting the new lines of a context hunk.
+	contextNewRangeRegexp = regexp.MustCompile(`^--- (\d+)(?:,(\d+))? ----$`)
+)
+
+// ContextToUnified returns patch with every file diff in context format (diff -c)
+// converted to unified format (diff -u). Other text of patch is kept as it is.
+func ContextToUnified(patch io.Reader) (string, error) {
+	content, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return "", fmt.Errorf("reading patch: %w", err)
+	}
+	return contextToUnified(string(content))
+}
+
+// unifiedDiff returns d with every file diff in context format converted to
+// unified format, so that diffs in both formats are accepted.
+func unifiedDiff(d io.Reader) (io.Reader, error) {
+	content, err := ioutil.ReadAll(d)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(content, []byte("\n"+contextHunkSeparator)) {
+		return bytes.NewReader(content), nil
+	}
+	converted, err := contextToUnified(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("converting context diff: %w", err)
+	}
+	return strings.NewReader(converted), nil
+}
+
+// contextToUnified is ContextToUnified for the content of a patch.
+func contextToUnified(patch string) (string, error) {
+	lines := strings.SplitAfter(patch, "\n")
+	var result strings.Builder
+	for k := 0; k < len(lines); {
+		if !isContextFileHeader(lines[k:]) {
+			result.WriteString(lines[k])
+			k++
+			continue
+		}
+
+		result.WriteString(unifiedFileHeader("--- ", strings.TrimPrefix(lines[k], "*** ")))
+		result.WriteString(unifiedFileHeader("+++ ", strings.TrimPrefix(lines[k+1], "--- ")))
+		k += 2
+		for k < len(lines) && strings.HasPrefix(lines[k], contextHunkSeparator) {
+			hunk, next, err := contextHunkToUnified(lines, k)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(hunk)
+			k = next
+		}
+	}
+	return result.String(), nil
+}
+
+// unifiedFileHeader returns a file header line of a unified diff for the name and
+// timestamp in header, the rest of a file header line of a context diff. Timestamps
+// in the format of ctime, used by diff -c, are dropped, since unified diffs
+// give them in another format.
+func unifiedFileHeader(prefix, header string) string {
+	header = strings.TrimRight(header, "\n")
+	if parts := strings.SplitN(header, "\t", 2); len(parts) == 2 {
+		if _, err := time.Parse("2006-01-02 15:04:05 -0700", parts[1]); err != nil {
+			header = parts[0]
+		}
+	}
+	return prefix + header + "\n"
+}
+
+// isContextFileHeader reports whether lines start with the file header of a diff
+// in context format, followed by its first hunk.
+func isContextFileHeader(lines []string) bool {
+	return len(lines) >= 3 &&
+		strings.HasPrefix(lines[0], "*** ") && !contextOrigRangeRegexp.MatchString(strings.TrimRight(lines[0], "\n")) &&
+		strings.HasPrefix(lines[1], "--- ") &&
+		strings.HasPrefix(lines[2], contextHunkSeparator)
+}
+
+// contextLine is a line of one side of a context hunk.
+type contextLine struct {
+	// op is ' ' for unchanged lines, '-' or '+' for deleted or added lines,
+	// and '!' for changed ones.
+	op   byte
+	text string
+	// noNewline is set for the last line of a file without a trailing newline.
+	noNewline bool
+}
+
+// contextHunkToUnified returns the hunk of a context diff starting with the separator
+// at lines[k] in unified format, and the index of the line following it.
+func contextHunkToUnified(lines []string, k int) (string, int, error) {
+	// Text after the separator is the section heading, as with diff -p
+	section := strings.TrimSpace(strings.TrimPrefix(strings.TrimRight(lines[k], "\n"), contextHunkSeparator))
+	k++
+
+	if k >= len(lines) {
+		return "", 0, fmt.Errorf("context hunk without ranges: %w", ErrBadContextDiff)
+	}
+	origStart, err := contextRangeStart(contextOrigRangeRegexp, lines[k])
+	if err != nil {
+		return "", 0, err
+	}
+	origLines, k := contextHunkLines(lines, k+1)
+
+	if k >= len(lines) {
+		return "", 0, fmt.Errorf("context hunk without new lines: %w", ErrBadContextDiff)
+	}
+	newStart, err := contextRangeStart(contextNewRangeRegexp, lines[k])
+	if err != nil {
+		return "", 0, err
+	}
+	newLines, k := contextHunkLines(lines, k+1)
+
+	// Sides without changes are omitted, their lines are the unchanged lines of the other side
+	if len(origLines) == 0 {
+		origLines = unchangedContextLines(newLines)
+	}
+	if len(newLines) == 0 {
+		newLines = unchangedContextLines(origLines)
+	}
+
+	var body []string
+	emit := func(op byte, line contextLine) {
+		body = append(body, string(op)+line.text)
+		if line.noNewline {
+			body = append(body, noNewlineMarker)
+		}
+	}
+	i, j := 0, 0
+	for i < len(origLines) || j < len(newLines) {
+		switch {
+		case i < len(origLines) && origLines[i].op == '-':
+			emit('-', origLines[i])
+			i++
+		case j < len(newLines) && newLines[j].op == '+':
+			emit('+', newLines[j])
+			j++
+		case i < len(origLines) && origLines[i].op == '!' || j < len(newLines) && newLines[j].op == '!':
+			for ; i < len(origLines) && origLines[i].op == '!'; i++ {
+				emit('-', origLines[i])
+			}
+			for ; j < len(newLines) && newLines[j].op == '!'; j++ {
+				emit('+', newLines[j])
+			}
+		case i < len(origLines) && j < len(newLines):
+			emit(' ', newLines[j])
+			i++
+			j++
+		default:
+			return "", 0, fmt.Errorf("context hunk at %q has different unchanged lines: %w",
+				strings.TrimRight(lines[k-1], "\n"), ErrBadContextDiff)
+		}
+	}
+
+	var origCount, newCount int32
+	for _, line := range origLines {
+		if line.op != '+' {
+			origCount++
+		}
+	}
+	for _, line := range newLines {
+		if line.op != '-' {
+			newCount++
+		}
+	}
+	hunk := &diff.Hunk{
+		OrigStartLine: origStart,
+		OrigLines:     origCount,
+		NewStartLine:  newStart,
+		NewLines:      newCount,
+		Section:       section,
+		Body:          []byte(strings.Join(body, "\n") + "\n"),
+	}
+	printed, err := diff.PrintHunks([]*diff.Hunk{hunk})
+	if err != nil {
+		return "", 0, err
+	}
+	return string(printed), k, nil
+}
+
+// contextRangeStart returns the first line number of the range in line, matched by re.
+func contextRangeStart(re *regexp.Regexp, line string) (int32, error) {
+	m := re.FindStringSubmatch(strings.TrimRight(line, "\n"))
+	if m == nil {
+		return 0, fmt.Errorf("context hunk range %q: %w", strings.TrimRight(line, "\n"), ErrBadContextDiff)
+	}
+	start, err := strconv.ParseInt(m[1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("context hunk range %q: %w", strings.TrimRight(line, "\n"), ErrBadContextDiff)
+	}
+	return int32(start), nil
+}
+
+// contextHunkLines returns the lines of one side of a context hunk starting at lines[k],
+// and the index of the line following them.
+func contextHunkLines(lines []string, k int) ([]contextLine, int) {
+	var result []contextLine
+	for ; k < len(lines); k++ {
+		line := strings.TrimRight(lines[k], "\n")
+		if line == noNewlineMarker && len(result) > 0 {
+			result[len(result)-1].noNewline = true
+			continue
+		}
+		if len(line) < 2 || line[1] != ' ' || !strings.ContainsRune(" -+!", rune(line[0])) {
+			break
+		}
+		result = append(result, contextLine{op: line[0], text: line[2:]})
+	}
+	return result, k
+}
+
+// unchangedContextLines returns lines of an omitted side of a context hunk,
+// which are the unchanged lines of the other side.
+func unchangedContextLines(lines []contextLine) []contextLine {
+	var result []contextLine
+	for _, line := range lines {
+		if line.op == ' ' {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// UnifiedToContext returns patch with every file diff converted to context format
+// (diff -c). Git extended headers and "Only in" entries are kept as they are.
+func UnifiedToContext(patch io.Reader) (string, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+
+	var result strings.Builder
+	for _, fd := range fileDiffs {
+		for _, line := range fd.Extended {
+			result.WriteString(line + "\n")
+		}
+		if fd.NewName == "" {
+			fmt.Fprintf(&result, "Only in %s: %s\n", filepath.ToSlash(filepath.Dir(fd.OrigName)), filepath.Base(fd.OrigName))
+			continue
+		}
+		if fd.Hunks == nil {
+			continue
+		}
+
+		result.WriteString(contextFileHeader("*** ", fd.OrigName, fd.OrigTime))
+		result.WriteString(contextFileHeader("--- ", fd.NewName, fd.NewTime))
+		for _, h := range fd.Hunks {
+			hunk, err := unifiedHunkToContext(h)
+			if err != nil {
+				return "", fmt.Errorf("converting hunk %s of %q: %w", hunkHeader(h), fd.OrigName, err)
+			}
+			result.WriteString(hunk)
+		}
+	}
+	return result.String(), nil
+}
+
+// contextFileHeader returns a file header line of a context diff.
+func contextFileHeader(prefix, name string, t *time.Time) string {
+	if t == nil {
+		return prefix + name + "\n"
+	}
+	return prefix + name + "\t" + t.Format("2006-01-02 15:04:05.000000000 -0700") + "\n"
+}
+
+// unifiedHunkToContext returns h in context format. Lines of blocks of changes
+// with both deleted and added lines are marked as changed ('!'); a side without
+// changes is omitted.
+func unifiedHunkToContext(h *diff.Hunk) (string, error) {
+	lines, err := HunkLines(h)
+	if err != nil {
+		return "", err
+	}
+
+	var origLines, newLines []contextLine
+	origChanged, newChanged := false, false
+	for k := 0; k < len(lines); {
+		if lines[k].Op == OpContext {
+			line := contextLine{op: ' ', text: lines[k].Text, noNewline: lines[k].NoNewline}
+			origLines = append(origLines, line)
+			newLines = append(newLines, line)
+			k++
+			continue
+		}
+
+		// Block of changed lines
+		end := k
+		hasDeleted, hasAdded := false, false
+		for ; end < len(lines) && lines[end].Op != OpContext; end++ {
+			hasDeleted = hasDeleted || lines[end].Op == OpDelete
+			hasAdded = hasAdded || lines[end].Op == OpAdd
+		}
+		for _, line := range lines[k:end] {
+			op := byte(line.Op)
+			if hasDeleted && hasAdded {
+				op = '!'
+			}
+			cl := contextLine{op: op, text: line.Text, noNewline: line.NoNewline}
+			if line.Op == OpDelete {
+				origLines = append(origLines, cl)
+				origChanged = true
+			} else {
+				newLines = append(newLines, cl)
+				newChanged = true
+			}
+		}
+		k = end
+	}
+
+	var b strings.Builder
+	b.WriteString(contextHunkSeparator)
+	if h.Section != "" {
+		b.WriteString(" " + h.Section)
+	}
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "*** %s ****\n", contextRange(h.OrigStartLine, h.OrigLines))
+	if origChanged {
+		writeContextLines(&b, origLines)
+	}
+	fmt.Fprintf(&b, "--- %s ----\n", contextRange(h.NewStartLine, h.NewLines))
+	if newChanged {
+		writeContextLines(&b, newLines)
+	}
+	return b.String(), nil
+}
+
+// contextRange returns a range of lines as printed in context hunks: the first and
+// the last line, only one of them if they are the same, or the line before an empty range.
+func contextRange(start, count int32) string {
+	if count <= 1 {
+		return strconv.Itoa(int(start))
+	}
+	return fmt.Sprintf("%d,%d", start, start+count-1)
+}
+
+// writeContextLines writes lines of one side of a context hunk to b.
+func writeContextLines(b *strings.Builder, lines []contextLine) {
+	for _, line := range lines {
+		b.WriteString(string(line.op) + " " + line.text + "\n")
+		if line.noNewline {
+			b.WriteString(noNewlineMarker + "\n")
+		}
+	}
+}
+
+// ErrBadContextDiff indicates that a diff in context format is malformed.
+var ErrBadContextDiff = errors.New("bad context diff")
@@ -0,0 +1,62 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	contextDiff = "*** a/f.txt\tFri Oct 16 01:37:33 2026\n--- b/f.txt\tFri Oct 16 01:37:33 2026\n" +
+		"***************\n*** 1,6 ****\n  1\n  2\n! 3\n  4\n  5\n  6\n--- 1,6 ----\n  1\n  2\n! three\n  4\n  5\n  6\n" +
+		"***************\n*** 11,15 ****\n--- 11,16 ----\n  11\n  12\n  13\n+ 13a\n  14\n  15\n" +
+		"*** a/g.txt\n--- b/g.txt\n" +
+		"***************\n*** 1,2 ****\n  x\n- y\n--- 1 ----\n" +
+		"*** a/n.txt\n--- b/n.txt\n" +
+		"***************\n*** 1,2 ****\n  a\n! b\n\\ No newline at end of file\n--- 1,2 ----\n  a\n! c\n\\ No newline at end of file\n"
+	unifiedDiffText = "--- a/f.txt\n+++ b/f.txt\n" +
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+		"@@ -11,5 +11,6 @@\n 11\n 12\n 13\n+13a\n 14\n 15\n" +
+		"--- a/g.txt\n+++ b/g.txt\n" +
+		"@@ -1,2 +1,1 @@\n x\n-y\n" +
+		"--- a/n.txt\n+++ b/n.txt\n" +
+		"@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n"
+)
+
+func TestContextToUnified(t *testing.T) {
+	result, err := ContextToUnified(strings.NewReader("Some description\n\n" + contextDiff))
+	if err != nil {
+		t.Fatalf("ContextToUnified: got error %v; want error nil", err)
+	}
+	if want := "Some description\n\n" + unifiedDiffText; result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+
+	if _, err := ContextToUnified(strings.NewReader("*** a\n--- b\n***************\n*** x ****\n")); !errors.Is(err, ErrBadContextDiff) {
+		t.Errorf("ContextToUnified of bad range: got error %v; want error %v", err, ErrBadContextDiff)
+	}
+}
+
+func TestUnifiedToContext(t *testing.T) {
+	result, err := UnifiedToContext(strings.NewReader(unifiedDiffText))
+	if err != nil {
+		t.Fatalf("UnifiedToContext: got error %v; want error nil", err)
+	}
+	want := strings.Replace(contextDiff, "\tFri Oct 16 01:37:33 2026", "", 2)
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestInterDiffContextFormat(t *testing.T) {
+	newDiff := strings.Replace(unifiedDiffText, "+13a", "+13b", 1)
+	result, err := InterDiff(strings.NewReader(contextDiff), strings.NewReader(newDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	want := "--- b/f.txt\n+++ b/f.txt\n@@ -11,6 +11,6 @@\n 11\n 12\n 13\n-13a\n+13b\n 14\n 15\n" +
+		"--- b/g.txt\n+++ b/g.txt\n--- b/n.txt\n+++ b/n.txt\n"
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
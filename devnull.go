@@ -0,0 +1,53 @@
+package patchutils
+
+import (
+	"time"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// isEpoch reports whether t is the Unix epoch, which diff -N writes as the time
+// of files missing on one side.
+func isEpoch(t *time.Time) bool {
+	return t != nil && t.Unix() == 0 && t.Nanosecond() == 0
+}
+
+// setDevNullNames names the side of fd which has no file /dev/null, as git does,
+// if fd adds or deletes a file like diff -N: its timestamp on that side is the
+// epoch and all of its hunks have empty ranges there. "Only in" entries are left
+// untouched.
+func setDevNullNames(fd *diff.FileDiff) {
+	if fd.NewName == "" || len(fd.Hunks) == 0 {
+		return
+	}
+	origEmpty, newEmpty := true, true
+	for _, h := range fd.Hunks {
+		origEmpty = origEmpty && h.OrigLines == 0
+		newEmpty = newEmpty && h.NewLines == 0
+	}
+	switch {
+	case origEmpty && isEpoch(fd.OrigTime) && !isDevNull(fd.NewName):
+		fd.OrigName = "/dev/null"
+	case newEmpty && isEpoch(fd.NewTime) && !isDevNull(fd.OrigName):
+		fd.NewName = "/dev/null"
+	}
+}
+
+// pairName returns the name fd is paired by with the FileDiff of the same file in
+// another diff: its OrigName, or its NewName if it adds the file, as OrigName is
+// /dev/null then.
+func pairName(fd *diff.FileDiff) string {
+	if isDevNull(fd.OrigName) {
+		return fd.NewName
+	}
+	return fd.OrigName
+}
+
+// setPairName sets the name fd is paired by, as returned by pairName, to name.
+func setPairName(fd *diff.FileDiff, name string) {
+	if isDevNull(fd.OrigName) {
+		fd.NewName = name
+		return
+	}
+	fd.OrigName = name
+}
@@ -0,0 +1,108 @@
+package patchutils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+func TestSetDevNullNames(t *testing.T) {
+	epoch := time.Unix(0, 0).UTC()
+	later := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name              string
+		fd                *diff.FileDiff
+		wantOrig, wantNew string
+	}{
+		{
+			name: "added by diff -N",
+			fd: &diff.FileDiff{OrigName: "a/f", OrigTime: &epoch, NewName: "b/f", NewTime: &later,
+				Hunks: []*diff.Hunk{{NewStartLine: 1, NewLines: 2}}},
+			wantOrig: "/dev/null",
+			wantNew:  "b/f",
+		},
+		{
+			name: "deleted by diff -N",
+			fd: &diff.FileDiff{OrigName: "a/f", OrigTime: &later, NewName: "b/f", NewTime: &epoch,
+				Hunks: []*diff.Hunk{{OrigStartLine: 1, OrigLines: 2}}},
+			wantOrig: "a/f",
+			wantNew:  "/dev/null",
+		},
+		{
+			name: "changed with epoch timestamps",
+			fd: &diff.FileDiff{OrigName: "a/f", OrigTime: &epoch, NewName: "b/f", NewTime: &epoch,
+				Hunks: []*diff.Hunk{{OrigStartLine: 1, OrigLines: 1, NewStartLine: 1, NewLines: 1}}},
+			wantOrig: "a/f",
+			wantNew:  "b/f",
+		},
+		{
+			name: "added without timestamps",
+			fd: &diff.FileDiff{OrigName: "a/f", NewName: "b/f",
+				Hunks: []*diff.Hunk{{NewStartLine: 1, NewLines: 2}}},
+			wantOrig: "a/f",
+			wantNew:  "b/f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setDevNullNames(tt.fd)
+			if tt.fd.OrigName != tt.wantOrig || tt.fd.NewName != tt.wantNew {
+				t.Errorf("setDevNullNames: got names %q and %q; want %q and %q",
+					tt.fd.OrigName, tt.fd.NewName, tt.wantOrig, tt.wantNew)
+			}
+		})
+	}
+}
+
+func TestInterDiffAddedFiles(t *testing.T) {
+	oldDiff := `diff --git a/x b/x
+new file mode 100644
+--- /dev/null
++++ b/x
+@@ -0,0 +1 @@
++x
+diff --git a/z b/z
+new file mode 100644
+--- /dev/null
++++ b/z
+@@ -0,0 +1 @@
++z
+`
+	newDiff := `--- a/f	1970-01-01 00:00:00.000000000 +0000
++++ b/f	2020-01-01 00:00:00.000000000 +0000
+@@ -0,0 +1 @@
++f
+diff --git a/z b/z
+new file mode 100644
+--- /dev/null
++++ b/z
+@@ -0,0 +1 @@
++z2
+`
+	want := `--- /dev/null	1970-01-01 00:00:00.000000000 +0000
++++ b/f	2020-01-01 00:00:00.000000000 +0000
+@@ -0,0 +1,1 @@
++f
+diff --git a/x b/x
+deleted file mode 100644
+--- b/x
++++ /dev/null
+@@ -1,1 +0,0 @@
+-x
+diff --git a/z b/z
+--- a/z
++++ b/z
+@@ -1,1 +1,1 @@
+-z
++z2
+`
+	result, err := InterDiff(strings.NewReader(oldDiff), strings.NewReader(newDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
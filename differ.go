@@ -0,0 +1,304 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-patchutils/hunks"
+	dbd "github.com/kylelemons/godebug/diff"
+)
+
+// Chunk is a piece of the difference between two lists of lines: lines added,
+// lines deleted, then lines equal in both lists. Chunks returned by a LineDiffer
+// don't have both added and deleted lines.
+type Chunk = hunks.Chunk
+
+// LineDiffer computes the difference between two lists of lines.
+type LineDiffer = hunks.LineDiffer
+
+// LCSDiffer is the default LineDiffer, which finds a longest common subsequence
+// of lines with the Myers algorithm.
+type LCSDiffer = hunks.LCSDiffer
+
+// PatienceDiffer is a LineDiffer which matches lines occurring once in both lists
+// first, and diffs the lines between them recursively, so that reordered blocks
+// of common lines like braces don't get matched up with each other.
+type PatienceDiffer struct{}
+
+// HistogramDiffer is a LineDiffer which, like git diff --histogram, matches
+// the longest run of common lines around the line occurring least often first,
+// and diffs the lines around the run recursively.
+type HistogramDiffer struct{}
+
+// ParseLineDiffer returns the LineDiffer named name, "lcs", "patience" or "histogram".
+func ParseLineDiffer(name string) (LineDiffer, error) {
+	switch name {
+	case "lcs":
+		return LCSDiffer{}, nil
+	case "patience":
+		return PatienceDiffer{}, nil
+	case "histogram":
+		return HistogramDiffer{}, nil
+	}
+	return nil, fmt.Errorf("%q: %w", name, ErrUnknownLineDiffer)
+}
+
+// String returns the name ParseLineDiffer accepts for the differ.
+func (PatienceDiffer) String() string { return "patience" }
+
+// String returns the name ParseLineDiffer accepts for the differ.
+func (HistogramDiffer) String() string { return "histogram" }
+
+// DiffChunks implements LineDiffer.
+func (PatienceDiffer) DiffChunks(a, b []string) []Chunk {
+	return chunksFromMatches(a, b, patienceMatches(a, b, span{0, len(a), 0, len(b)}, nil))
+}
+
+// DiffChunks implements LineDiffer.
+func (HistogramDiffer) DiffChunks(a, b []string) []Chunk {
+	return chunksFromMatches(a, b, histogramMatches(a, b, span{0, len(a), 0, len(b)}, nil))
+}
+
+// lineDiffer returns d, or LCSDiffer if d is nil.
+func lineDiffer(d LineDiffer) LineDiffer {
+	if d == nil {
+		return LCSDiffer{}
+	}
+	return d
+}
+
+// lineMatch is a pair of indices of equal lines in two lists.
+type lineMatch struct {
+	a, b int
+}
+
+// span is the range of lines [aLo, aHi) and [bLo, bHi) of two lists being diffed.
+type span struct {
+	aLo, aHi, bLo, bHi int
+}
+
+// trim appends matches of the common prefix of s to matches, and returns s without
+// its common prefix and suffix, and the matches of the suffix.
+func (s span) trim(a, b []string, matches []lineMatch) (span, []lineMatch, []lineMatch) {
+	for s.aLo < s.aHi && s.bLo < s.bHi && a[s.aLo] == b[s.bLo] {
+		matches = append(matches, lineMatch{s.aLo, s.bLo})
+		s.aLo++
+		s.bLo++
+	}
+	n := 0
+	for s.aLo < s.aHi-n && s.bLo < s.bHi-n && a[s.aHi-1-n] == b[s.bHi-1-n] {
+		n++
+	}
+	s.aHi -= n
+	s.bHi -= n
+	suffix := make([]lineMatch, n)
+	for k := range suffix {
+		suffix[k] = lineMatch{s.aHi + k, s.bHi + k}
+	}
+	return s, matches, suffix
+}
+
+// patienceMatches appends matches of lines in s to matches, in order, and returns them.
+func patienceMatches(a, b []string, s span, matches []lineMatch) []lineMatch {
+	s, matches, suffix := s.trim(a, b, matches)
+	if s.aLo == s.aHi || s.bLo == s.bHi {
+		return append(matches, suffix...)
+	}
+
+	anchors := uniqueMatches(a, b, s)
+	if len(anchors) == 0 {
+		return append(lcsMatches(a, b, s, matches), suffix...)
+	}
+	for _, m := range anchors {
+		matches = patienceMatches(a, b, span{s.aLo, m.a, s.bLo, m.b}, matches)
+		matches = append(matches, m)
+		s.aLo, s.bLo = m.a+1, m.b+1
+	}
+	matches = patienceMatches(a, b, s, matches)
+	return append(matches, suffix...)
+}
+
+// uniqueMatches returns the longest increasing sequence of matches of lines
+// occurring exactly once in both ranges of s.
+func uniqueMatches(a, b []string, s span) []lineMatch {
+	type occurrence struct {
+		countA, countB int
+		a, b           int
+	}
+	lines := make(map[string]*occurrence)
+	for i := s.aLo; i < s.aHi; i++ {
+		o := lines[a[i]]
+		if o == nil {
+			o = &occurrence{}
+			lines[a[i]] = o
+		}
+		o.countA++
+		o.a = i
+	}
+	for j := s.bLo; j < s.bHi; j++ {
+		if o := lines[b[j]]; o != nil {
+			o.countB++
+			o.b = j
+		}
+	}
+
+	var candidates []lineMatch
+	for i := s.aLo; i < s.aHi; i++ {
+		if o := lines[a[i]]; o.countA == 1 && o.countB == 1 {
+			candidates = append(candidates, lineMatch{i, o.b})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Patience sorting: tails[k] is the candidate ending the best increasing
+	// sequence of length k+1 found so far, prev links candidates to their predecessors.
+	var tails []int
+	prev := make([]int, len(candidates))
+	for k, c := range candidates {
+		n := sort.Search(len(tails), func(t int) bool { return candidates[tails[t]].b > c.b })
+		prev[k] = -1
+		if n > 0 {
+			prev[k] = tails[n-1]
+		}
+		if n == len(tails) {
+			tails = append(tails, k)
+		} else {
+			tails[n] = k
+		}
+	}
+	sequence := make([]lineMatch, len(tails))
+	for k, n := tails[len(tails)-1], len(tails)-1; n >= 0; k, n = prev[k], n-1 {
+		sequence[n] = candidates[k]
+	}
+	return sequence
+}
+
+// maxHistogramChain is the number of occurrences in a of a line above which
+// histogramMatches doesn't use it to match lines, as in git.
+const maxHistogramChain = 64
+
+// histogramMatches appends matches of lines in s to matches, in order, and returns them.
+func histogramMatches(a, b []string, s span, matches []lineMatch) []lineMatch {
+	s, matches, suffix := s.trim(a, b, matches)
+	if s.aLo == s.aHi || s.bLo == s.bHi {
+		return append(matches, suffix...)
+	}
+
+	occurrences := make(map[string][]int)
+	for i := s.aLo; i < s.aHi; i++ {
+		occurrences[a[i]] = append(occurrences[a[i]], i)
+	}
+
+	// Find the longest run of common lines among those with the least often occurring line
+	var best span
+	bestCount := maxHistogramChain + 1
+	common := false
+	for j := s.bLo; j < s.bHi; {
+		positions := occurrences[b[j]]
+		next := j + 1
+		if len(positions) > 0 {
+			common = true
+		}
+		if len(positions) == 0 || len(positions) > bestCount {
+			j = next
+			continue
+		}
+		for _, i := range positions {
+			run := span{i, i + 1, j, j + 1}
+			for run.aLo > s.aLo && run.bLo > s.bLo && a[run.aLo-1] == b[run.bLo-1] {
+				run.aLo--
+				run.bLo--
+			}
+			for run.aHi < s.aHi && run.bHi < s.bHi && a[run.aHi] == b[run.bHi] {
+				run.aHi++
+				run.bHi++
+			}
+			count := len(positions)
+			for k := run.aLo; k < run.aHi; k++ {
+				if n := len(occurrences[a[k]]); n < count {
+					count = n
+				}
+			}
+			if count < bestCount || count == bestCount && run.aHi-run.aLo > best.aHi-best.aLo {
+				best, bestCount = run, count
+			}
+			if run.bHi > next {
+				next = run.bHi
+			}
+		}
+		j = next
+	}
+
+	switch {
+	case bestCount <= maxHistogramChain:
+		matches = histogramMatches(a, b, span{s.aLo, best.aLo, s.bLo, best.bLo}, matches)
+		for k := 0; k < best.aHi-best.aLo; k++ {
+			matches = append(matches, lineMatch{best.aLo + k, best.bLo + k})
+		}
+		matches = histogramMatches(a, b, span{best.aHi, s.aHi, best.bHi, s.bHi}, matches)
+	case common:
+		// Only lines occurring too often are common, as git does, fall back to LCS
+		matches = lcsMatches(a, b, s, matches)
+	}
+	return append(matches, suffix...)
+}
+
+// lcsMatches appends matches of lines in s found by LCSDiffer to matches, and returns them.
+func lcsMatches(a, b []string, s span, matches []lineMatch) []lineMatch {
+	i, j := s.aLo, s.bLo
+	for _, c := range dbd.DiffChunks(a[s.aLo:s.aHi], b[s.bLo:s.bHi]) {
+		i += len(c.Deleted)
+		j += len(c.Added)
+		for range c.Equal {
+			matches = append(matches, lineMatch{i, j})
+			i++
+			j++
+		}
+	}
+	if i == s.aLo && j == s.bLo {
+		// Equal ranges have no chunks
+		for k := 0; k < s.aHi-s.aLo; k++ {
+			matches = append(matches, lineMatch{s.aLo + k, s.bLo + k})
+		}
+	}
+	return matches
+}
+
+// chunksFromMatches returns chunks turning a into b which keep the lines matched
+// by matches, in order, or nil if all lines are matched.
+func chunksFromMatches(a, b []string, matches []lineMatch) []Chunk {
+	if len(matches) == len(a) && len(matches) == len(b) {
+		return nil
+	}
+
+	var chunks []Chunk
+	i, j, k := 0, 0, 0
+	for {
+		done := k == len(matches)
+		nextA, nextB := len(a), len(b)
+		if !done {
+			nextA, nextB = matches[k].a, matches[k].b
+		}
+		run := 0
+		for k+run < len(matches) && matches[k+run] == (lineMatch{nextA + run, nextB + run}) {
+			run++
+		}
+
+		deleted, added, equal := a[i:nextA], b[j:nextB], a[nextA:nextA+run]
+		if len(deleted) > 0 && len(added) > 0 {
+			chunks = append(chunks, Chunk{Deleted: deleted}, Chunk{Added: added, Equal: equal})
+		} else if len(deleted) > 0 || len(added) > 0 || len(equal) > 0 {
+			chunks = append(chunks, Chunk{Added: added, Deleted: deleted, Equal: equal})
+		}
+		if done {
+			return chunks
+		}
+		i, j, k = nextA+run, nextB+run, k+run
+	}
+}
+
+// ErrUnknownLineDiffer is returned by ParseLineDiffer for unknown names.
+var ErrUnknownLineDiffer = errors.New("unknown diff algorithm")
@@ -0,0 +1,108 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var lineDiffers = []LineDiffer{LCSDiffer{}, PatienceDiffer{}, HistogramDiffer{}}
+
+var lineDifferTests = []struct {
+	name string
+	a, b string
+}{
+	{name: "equal", a: "a b c", b: "a b c"},
+	{name: "empty", a: "", b: ""},
+	{name: "added", a: "", b: "a b"},
+	{name: "deleted", a: "a b", b: ""},
+	{name: "replaced", a: "a b c", b: "a x c"},
+	{name: "moved", a: "a b c d e", b: "d e a b c"},
+	{name: "repeated", a: "} } a } b } }", b: "} b } } a } c }"},
+	{name: "nothing common", a: "a b", b: "c d e"},
+	{name: "only repeated lines common", a: "x } } y", b: "} z }"},
+}
+
+// applyChunks returns a changed by chunks, and fails t if they don't match a.
+func applyChunks(t *testing.T, a []string, chunks []Chunk) []string {
+	var result []string
+	for _, c := range chunks {
+		if len(c.Added) > 0 && len(c.Deleted) > 0 {
+			t.Errorf("Chunk %q has both added and deleted lines", c)
+		}
+		result = append(result, c.Added...)
+		for _, line := range append(c.Deleted, c.Equal...) {
+			if len(a) == 0 || a[0] != line {
+				t.Fatalf("Chunk %q doesn't match remaining lines %q", c, a)
+			}
+			a = a[1:]
+		}
+		result = append(result, c.Equal...)
+	}
+	return append(result, a...)
+}
+
+func TestLineDiffers(t *testing.T) {
+	for _, d := range lineDiffers {
+		for _, tt := range lineDifferTests {
+			t.Run(fmt.Sprint(d)+"/"+tt.name, func(t *testing.T) {
+				a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+				chunks := d.DiffChunks(a, b)
+				if tt.a == tt.b {
+					if chunks != nil {
+						t.Errorf("DiffChunks(%q, %q) = %q; want nil", a, b, chunks)
+					}
+					return
+				}
+				if result := applyChunks(t, a, chunks); strings.Join(result, " ") != tt.b {
+					t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, b)
+				}
+			})
+		}
+	}
+}
+
+func TestPatienceAndHistogramDiffers(t *testing.T) {
+	a := []string{"func a() {", "\treturn 1", "}", "", "func b() {", "\treturn 2", "}"}
+	b := []string{"func b() {", "\treturn 2", "}", "", "func a() {", "\treturn 1", "}"}
+	want := []Chunk{
+		{Deleted: []string{"func a() {", "\treturn 1", "}", ""}, Equal: []string{"func b() {", "\treturn 2"}},
+		{Added: []string{"}", "", "func a() {", "\treturn 1"}, Equal: []string{"}"}},
+	}
+	for _, d := range []LineDiffer{PatienceDiffer{}, HistogramDiffer{}} {
+		// Empty parts of chunks may be nil or not
+		if chunks := d.DiffChunks(a, b); fmt.Sprintf("%q", chunks) != fmt.Sprintf("%q", want) {
+			t.Errorf("%v: Result mismatch.\nGot:\n%q\nWant:\n%q\n", d, chunks, want)
+		}
+	}
+}
+
+func TestParseLineDiffer(t *testing.T) {
+	for _, d := range lineDiffers {
+		name := fmt.Sprint(d)
+		if got, err := ParseLineDiffer(name); err != nil || got != d {
+			t.Errorf("ParseLineDiffer(%q) = %v, %v; want %v, nil", name, got, err, d)
+		}
+	}
+	if _, err := ParseLineDiffer("myers"); !errors.Is(err, ErrUnknownLineDiffer) {
+		t.Errorf("ParseLineDiffer: got error %v; want error %v", err, ErrUnknownLineDiffer)
+	}
+}
+
+func TestMixedModeDiffer(t *testing.T) {
+	oldSource := "package p\nfunc a() {\n\treturn 1\n}\n\nfunc b() {\n\treturn 2\n}\n"
+	newSource := "package q\nfunc b() {\n\treturn 2\n}\n\nfunc a() {\n\treturn 1\n}\n"
+	oldDiff := "--- f\n+++ f\n@@ -1 +1 @@\n-package p\n+package q\n"
+	newDiff := "--- f\n+++ f\n@@ -1 +1 @@\n-package q\n+package q\n"
+	want := "--- f\n+++ f\n@@ -1,8 +1,8 @@\n package q\n-func a() {\n-\treturn 1\n-}\n-\n func b() {\n \treturn 2\n" +
+		"+}\n+\n+func a() {\n+\treturn 1\n }\n"
+	result, err := MixedModeFileWithOptions(strings.NewReader(oldSource), strings.NewReader(newSource),
+		strings.NewReader(oldDiff), strings.NewReader(newDiff), MixedModeOptions{Differ: PatienceDiffer{}})
+	if err != nil {
+		t.Fatalf("MixedModeFile: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
@@ -0,0 +1,96 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DiffPath computes the diff of the oldPath and newPath files, or of all files
+// in the oldPath and newPath directory trees, like diff -ru.
+// Files present in only one of the trees are reported as "Only in" entries.
+func DiffPath(oldPath, newPath string) (string, error) {
+	return DiffPathWithOptions(oldPath, newPath, DiffPathOptions{})
+}
+
+// DiffPathOptions configures DiffPathWithOptions.
+type DiffPathOptions struct {
+	// Dir, if set, is the directory relative paths are resolved in, instead of the
+	// working directory. Names in the result stay relative, as given.
+	Dir string
+}
+
+// DiffPathWithOptions is like DiffPath, configured by opts.
+func DiffPathWithOptions(oldPath, newPath string, opts DiffPathOptions) (string, error) {
+	files := osFiles{dir: opts.Dir}
+	oldStat, err := os.Stat(files.path(oldPath))
+	if err != nil {
+		return "", fmt.Errorf("get stat from oldPath %q: %w", oldPath, err)
+	}
+	newStat, err := os.Stat(files.path(newPath))
+	if err != nil {
+		return "", fmt.Errorf("get stat from newPath %q: %w", newPath, err)
+	}
+
+	switch {
+	case !oldStat.IsDir() && !newStat.IsDir():
+		// Both paths are files
+		oldContent, err := ioutil.ReadFile(files.path(oldPath))
+		if err != nil {
+			return "", fmt.Errorf("reading oldPath %q: %w", oldPath, err)
+		}
+		newContent, err := ioutil.ReadFile(files.path(newPath))
+		if err != nil {
+			return "", fmt.Errorf("reading newPath %q: %w", newPath, err)
+		}
+		if string(oldContent) == string(newContent) {
+			return "", nil
+		}
+		return diffContents(filepath.ToSlash(oldPath), filepath.ToSlash(newPath), string(oldContent), string(newContent))
+
+	case oldStat.IsDir() && newStat.IsDir():
+		// Both paths are directories
+		oldTree, err := readDirTree(files.path(oldPath), oldPath)
+		if err != nil {
+			return "", fmt.Errorf("reading oldPath: %w", err)
+		}
+		newTree, err := readDirTree(files.path(newPath), newPath)
+		if err != nil {
+			return "", fmt.Errorf("reading newPath: %w", err)
+		}
+		return diffReleaseTrees(oldTree, newTree)
+	}
+
+	return "", errors.New("paths should be both dirs or files")
+}
+
+// readDirTree reads all regular files under root, naming the tree name.
+func readDirTree(root, name string) (*releaseTree, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk into %q: %w", p, err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("reading %q: %w", p, err)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &releaseTree{root: filepath.ToSlash(filepath.Clean(name)), files: files}, nil
+}
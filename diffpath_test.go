@@ -0,0 +1,86 @@
+package patchutils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var diffPathTests = []struct {
+	name     string
+	oldFiles map[string]string
+	newFiles map[string]string
+	result   string
+}{
+	{
+		name:     "same trees",
+		oldFiles: map[string]string{"a.txt": "one\n"},
+		newFiles: map[string]string{"a.txt": "one\n"},
+		result:   "",
+	},
+	{
+		name: "changed, added and deleted files",
+		oldFiles: map[string]string{
+			"a.txt":     "one\ntwo\nthree\n",
+			"dir/b.txt": "b\n",
+		},
+		newFiles: map[string]string{
+			"a.txt":     "one\nTWO\nthree\n",
+			"dir/c.txt": "c\n",
+		},
+		result: `--- old/a.txt
++++ new/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+Only in old/dir: b.txt
+Only in new/dir: c.txt
+`,
+	},
+}
+
+func TestDiffPath(t *testing.T) {
+	for _, tt := range diffPathTests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeTestTree(t, nil)
+			defer os.RemoveAll(root)
+			for dir, files := range map[string]map[string]string{"old": tt.oldFiles, "new": tt.newFiles} {
+				for name, content := range files {
+					p := filepath.Join(root, dir, filepath.FromSlash(name))
+					if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+
+			// Names in the result are relative to root
+			currentResult, err := DiffPathWithOptions("old", "new", DiffPathOptions{Dir: root})
+			if err != nil {
+				t.Fatalf("DiffPath: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
+
+func TestDiffPathFiles(t *testing.T) {
+	currentResult, err := DiffPathWithOptions("source_1/file_1.txt", "source_1/file_1.txt", DiffPathOptions{Dir: testFilesDir})
+	if err != nil {
+		t.Fatalf("DiffPath: got error %v; want error nil", err)
+	}
+	if currentResult != "" {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant empty diff\n", currentResult)
+	}
+
+	if _, err := DiffPathWithOptions("source_1", "source_1/file_1.txt", DiffPathOptions{Dir: testFilesDir}); err == nil {
+		t.Errorf("DiffPath of a dir and a file: got error nil; want error")
+	}
+}
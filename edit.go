@@ -0,0 +1,207 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-patchutils/hunkmath"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// LineOp is the kind of change a hunk line describes.
+type LineOp byte
+
+// Kinds of hunk lines, identified by their prefix in a unified diff.
+const (
+	OpContext LineOp = ' '
+	OpAdd     LineOp = '+'
+	OpDelete  LineOp = '-'
+)
+
+// Line is a single line of a hunk body.
+type Line struct {
+	// Op tells whether the line is unchanged, added or deleted.
+	Op LineOp
+	// Text is the content of the line without prefix and trailing newline.
+	Text string
+	// NoNewline marks the last line of a file that isn't terminated by a newline
+	// ("\ No newline at end of file").
+	NoNewline bool
+}
+
+// String returns the line as it appears in a hunk body, without trailing newline.
+func (l Line) String() string {
+	return string(l.Op) + l.Text
+}
+
+// HunkLines returns the body of hunk split into lines.
+func HunkLines(hunk *diff.Hunk) ([]Line, error) {
+	body := string(hunk.Body)
+	if body == "" {
+		return nil, nil
+	}
+	noNewlineAtEnd := !strings.HasSuffix(body, "\n")
+
+	var lines []Line
+	offset := 0
+	for _, raw := range strings.Split(strings.TrimSuffix(body, "\n"), "\n") {
+		offset += len(raw) + 1
+		line := Line{Op: OpContext}
+		if raw != "" {
+			// Some tools strip the leading space of empty unchanged lines
+			switch LineOp(raw[0]) {
+			case OpContext, OpAdd, OpDelete:
+				line.Op = LineOp(raw[0])
+				line.Text = raw[1:]
+			default:
+				return nil, fmt.Errorf("line %d of hunk body (%q): %w", len(lines)+1, raw, ErrBadHunkLine)
+			}
+		}
+		if hunk.OrigNoNewlineAt > 0 && int32(offset) == hunk.OrigNoNewlineAt {
+			line.NoNewline = true
+		}
+		lines = append(lines, line)
+	}
+	if noNewlineAtEnd {
+		lines[len(lines)-1].NoNewline = true
+	}
+
+	return lines, nil
+}
+
+// SetHunkLines replaces the body of hunk with lines and recounts
+// OrigLines and NewLines accordingly.
+func SetHunkLines(hunk *diff.Hunk, lines []Line) error {
+	var body strings.Builder
+	var origNoNewlineAt int32
+	for k, line := range lines {
+		switch line.Op {
+		case OpContext, OpAdd, OpDelete:
+		default:
+			return fmt.Errorf("line %d (%q): %w", k+1, line.String(), ErrBadHunkLine)
+		}
+		body.WriteString(line.String())
+		if line.NoNewline && line.Op != OpDelete {
+			// Only the last line of the new file can miss the newline
+			if k != len(lines)-1 {
+				return fmt.Errorf("line %d (%q) has no newline, but isn't last: %w",
+					k+1, line.String(), ErrBadHunkLine)
+			}
+			continue
+		}
+		body.WriteString("\n")
+		if line.NoNewline {
+			origNoNewlineAt = int32(body.Len())
+		}
+	}
+
+	hunk.Body = []byte(body.String())
+	hunk.OrigNoNewlineAt = origNoNewlineAt
+	RecountHunk(hunk)
+	return nil
+}
+
+// RecountHunk recomputes OrigLines and NewLines of hunk from its body.
+func RecountHunk(hunk *diff.Hunk) {
+	var origLines, newLines int32
+	for _, line := range strings.Split(strings.TrimSuffix(string(hunk.Body), "\n"), "\n") {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			newLines++
+		case strings.HasPrefix(line, "-"):
+			origLines++
+		default:
+			origLines++
+			newLines++
+		}
+	}
+	if len(hunk.Body) == 0 {
+		origLines, newLines = 0, 0
+	}
+	hunk.OrigLines = origLines
+	hunk.NewLines = newLines
+}
+
+// EditHunk replaces the lines of the i-th hunk in fileDiff with the result of edit.
+// Header of the edited hunk is recounted and NewStartLine of the following hunks
+// is shifted by the change in the number of lines the hunk adds.
+func EditHunk(fileDiff *diff.FileDiff, i int, edit func([]Line) []Line) error {
+	if i < 0 || i >= len(fileDiff.Hunks) {
+		return fmt.Errorf("hunk %d of %d in %q: %w", i, len(fileDiff.Hunks), fileDiff.OrigName, ErrHunkOutOfRange)
+	}
+	hunk := fileDiff.Hunks[i]
+
+	lines, err := HunkLines(hunk)
+	if err != nil {
+		return fmt.Errorf("reading hunk %d in %q: %w", i, fileDiff.OrigName, err)
+	}
+
+	oldDelta := hunkmath.HunkDelta(hunk)
+	if err := SetHunkLines(hunk, edit(lines)); err != nil {
+		return fmt.Errorf("writing hunk %d in %q: %w", i, fileDiff.OrigName, err)
+	}
+
+	if shift := hunkmath.HunkDelta(hunk) - oldDelta; shift != 0 {
+		for _, h := range fileDiff.Hunks[i+1:] {
+			h.NewStartLine += shift
+		}
+	}
+
+	return nil
+}
+
+// SelectHunks returns patch with every hunk replaced by the hunk choose returns for
+// it, like git add -p does: the hunk itself to keep it, nil to leave it out, or an
+// edited copy of it. Hunk headers are recounted, so that the result applies to the
+// files patch applies to. File diffs left without hunks are left out, and those
+// without hunks in patch, such as changes of modes, are kept. choose is called for
+// every hunk in order, with its file diff and its index in it; patch isn't changed.
+func SelectHunks(patch io.Reader, choose func(fileDiff *diff.FileDiff, i int) (*diff.Hunk, error)) (string, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	var selected []*diff.FileDiff
+	for _, fd := range fileDiffs {
+		if len(fd.Hunks) == 0 {
+			selected = append(selected, fd)
+			continue
+		}
+		var chosen []*diff.Hunk
+		for i := range fd.Hunks {
+			h, err := choose(fd, i)
+			if err != nil {
+				return "", fmt.Errorf("choosing hunk %d in %q: %w", i, fd.OrigName, err)
+			}
+			if h != nil {
+				copied := *h
+				chosen = append(chosen, &copied)
+			}
+		}
+		if len(chosen) == 0 {
+			continue
+		}
+		result := *fd
+		result.Hunks = chosen
+		RecountFileDiff(&result)
+		selected = append(selected, &result)
+	}
+
+	result, err := diff.PrintMultiFileDiff(selected)
+	if err != nil {
+		return "", fmt.Errorf("printing selected patch: %w", err)
+	}
+	return string(result), nil
+}
+
+// ErrBadHunkLine indicates that a hunk line doesn't start with ' ', '+' or '-'.
+var ErrBadHunkLine = errors.New("bad hunk line")
+
+// ErrHunkOutOfRange indicates that a requested hunk doesn't exist.
+var ErrHunkOutOfRange = errors.New("hunk index out of range")
@@ -0,0 +1,210 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const editTestDiff = `--- a.txt
++++ a.txt
+@@ -1,3 +1,4 @@
+ one
++two
+ three
+ four
+@@ -10,3 +11,3 @@
+ ten
+-eleven
++Eleven
+ twelve
+`
+
+var editHunkTests = []struct {
+	name   string
+	hunk   int
+	edit   func([]Line) []Line
+	result string
+	errIs  error
+}{
+	{
+		name: "drop added line",
+		hunk: 0,
+		edit: func(lines []Line) []Line {
+			return append(lines[:1], lines[2:]...)
+		},
+		result: `--- a.txt
++++ a.txt
+@@ -1,3 +1,3 @@
+ one
+ three
+ four
+@@ -10,3 +10,3 @@
+ ten
+-eleven
++Eleven
+ twelve
+`,
+	},
+	{
+		name: "rewrite added text",
+		hunk: 1,
+		edit: func(lines []Line) []Line {
+			for k := range lines {
+				if lines[k].Op == OpAdd {
+					lines[k].Text = strings.ToUpper(lines[k].Text)
+				}
+			}
+			return lines
+		},
+		result: `--- a.txt
++++ a.txt
+@@ -1,3 +1,4 @@
+ one
++two
+ three
+ four
+@@ -10,3 +11,3 @@
+ ten
+-eleven
++ELEVEN
+ twelve
+`,
+	},
+	{
+		name: "add lines to first hunk",
+		hunk: 0,
+		edit: func(lines []Line) []Line {
+			return append(lines, Line{Op: OpAdd, Text: "five"}, Line{Op: OpAdd, Text: "six"})
+		},
+		result: `--- a.txt
++++ a.txt
+@@ -1,3 +1,6 @@
+ one
++two
+ three
+ four
++five
++six
+@@ -10,3 +13,3 @@
+ ten
+-eleven
++Eleven
+ twelve
+`,
+	},
+	{
+		name:  "hunk out of range",
+		hunk:  2,
+		edit:  func(lines []Line) []Line { return lines },
+		errIs: ErrHunkOutOfRange,
+	},
+	{
+		name: "invalid op",
+		hunk: 0,
+		edit: func(lines []Line) []Line {
+			return append(lines, Line{Op: '?', Text: "x"})
+		},
+		errIs: ErrBadHunkLine,
+	},
+}
+
+func TestEditHunk(t *testing.T) {
+	for _, tt := range editHunkTests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := diff.ParseFileDiff([]byte(editTestDiff))
+			if err != nil {
+				t.Fatalf("Error parsing diff: %v", err)
+			}
+
+			err = EditHunk(fd, tt.hunk, tt.edit)
+			if tt.errIs != nil {
+				if !errors.Is(err, tt.errIs) {
+					t.Errorf("EditHunk: got error %v; want error %v", err, tt.errIs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("EditHunk: got error %v; want error nil", err)
+			}
+
+			result, err := diff.PrintFileDiff(fd)
+			if err != nil {
+				t.Fatalf("Error printing diff: %v", err)
+			}
+			if string(result) != tt.result {
+				t.Errorf("Diff mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
+
+func TestHunkLinesRoundTrip(t *testing.T) {
+	const noNewlineDiff = `--- a.txt
++++ a.txt
+@@ -1,2 +1,2 @@
+ one
+-two
+\ No newline at end of file
++two
+`
+	fd, err := diff.ParseFileDiff([]byte(noNewlineDiff))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+
+	lines, err := HunkLines(fd.Hunks[0])
+	if err != nil {
+		t.Fatalf("HunkLines: got error %v; want error nil", err)
+	}
+	if len(lines) != 3 || !lines[1].NoNewline || lines[2].NoNewline {
+		t.Fatalf("HunkLines: got %+v; want no newline marker only on deleted line", lines)
+	}
+
+	if err := SetHunkLines(fd.Hunks[0], lines); err != nil {
+		t.Fatalf("SetHunkLines: got error %v; want error nil", err)
+	}
+	result, err := diff.PrintFileDiff(fd)
+	if err != nil {
+		t.Fatalf("Error printing diff: %v", err)
+	}
+	if string(result) != noNewlineDiff {
+		t.Errorf("Diff mismatch.\nGot:\n%s\nWant:\n%s\n", result, noNewlineDiff)
+	}
+}
+
+func TestSelectHunks(t *testing.T) {
+	patch := editTestDiff + "--- b.txt\n+++ b.txt\n@@ -1,1 +1,1 @@\n-b\n+B\n"
+	// The first hunk of a.txt is left out, its second hunk is edited and b.txt is left out
+	choose := func(fd *diff.FileDiff, i int) (*diff.Hunk, error) {
+		if fd.OrigName != "a.txt" || i == 0 {
+			return nil, nil
+		}
+		edited := *fd.Hunks[i]
+		err := SetHunkLines(&edited, []Line{{Op: OpContext, Text: "ten"}, {Op: OpDelete, Text: "eleven"},
+			{Op: OpAdd, Text: "11"}, {Op: OpAdd, Text: "eleven"}, {Op: OpContext, Text: "twelve"}})
+		return &edited, err
+	}
+	want := "--- a.txt\n+++ a.txt\n@@ -10,3 +10,4 @@\n ten\n-eleven\n+11\n+eleven\n twelve\n"
+
+	got, err := SelectHunks(strings.NewReader(patch), choose)
+	if err != nil {
+		t.Fatalf("SelectHunks: got error %v; want error nil", err)
+	}
+	if got != want {
+		t.Errorf("Diff mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+
+	// Hunks of the patch are unchanged
+	again, err := SelectHunks(strings.NewReader(patch), func(fd *diff.FileDiff, i int) (*diff.Hunk, error) {
+		return fd.Hunks[i], nil
+	})
+	if err != nil {
+		t.Fatalf("SelectHunks: got error %v; want error nil", err)
+	}
+	if again != patch {
+		t.Errorf("Diff mismatch.\nGot:\n%s\nWant:\n%s\n", again, patch)
+	}
+}
@@ -0,0 +1,111 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// Encoding is the character encoding of sources. Sources are decoded into UTF-8
+// before diffs are applied to them and before they are compared, and patched
+// sources are encoded again when they are returned or written. Diffs are read
+// and written in UTF-8.
+type Encoding int
+
+const (
+	// UTF8 leaves sources as they are.
+	UTF8 Encoding = iota
+	// Latin1 is ISO 8859-1, whose bytes are the first 256 code points of Unicode.
+	Latin1
+	// UTF16LE and UTF16BE are UTF-16 with bytes in little and big endian order.
+	// A byte order mark at the start of sources is removed when they are decoded,
+	// and one is written when they are encoded.
+	UTF16LE
+	UTF16BE
+)
+
+// ParseEncoding returns the Encoding named name, "utf-8", "latin-1" (or
+// "iso-8859-1"), "utf-16le" or "utf-16be", in any case.
+func ParseEncoding(name string) (Encoding, error) {
+	switch strings.ToLower(name) {
+	case "utf-8":
+		return UTF8, nil
+	case "latin-1", "iso-8859-1":
+		return Latin1, nil
+	case "utf-16le":
+		return UTF16LE, nil
+	case "utf-16be":
+		return UTF16BE, nil
+	}
+	return 0, fmt.Errorf("%q: %w", name, ErrUnknownEncoding)
+}
+
+// decode returns content, encoded in e, in UTF-8.
+func (e Encoding) decode(content string) (string, error) {
+	switch e {
+	case Latin1:
+		var b strings.Builder
+		for k := 0; k < len(content); k++ {
+			b.WriteRune(rune(content[k]))
+		}
+		return b.String(), nil
+	case UTF16LE, UTF16BE:
+		if len(content)%2 != 0 {
+			return "", fmt.Errorf("odd number of bytes in UTF-16: %w", ErrInvalidEncoding)
+		}
+		units := make([]uint16, 0, len(content)/2)
+		for k := 0; k < len(content); k += 2 {
+			if e == UTF16LE {
+				units = append(units, uint16(content[k])|uint16(content[k+1])<<8)
+			} else {
+				units = append(units, uint16(content[k])<<8|uint16(content[k+1]))
+			}
+		}
+		if len(units) > 0 && units[0] == byteOrderMark {
+			units = units[1:]
+		}
+		return string(utf16.Decode(units)), nil
+	}
+	return content, nil
+}
+
+// encode returns content, in UTF-8, encoded in e.
+func (e Encoding) encode(content string) (string, error) {
+	switch e {
+	case Latin1:
+		var b strings.Builder
+		for k, r := range content {
+			if r > 0xff {
+				return "", fmt.Errorf("%q at byte %d can't be written in Latin-1: %w", r, k, ErrInvalidEncoding)
+			}
+			b.WriteByte(byte(r))
+		}
+		return b.String(), nil
+	case UTF16LE, UTF16BE:
+		if content == "" {
+			return "", nil
+		}
+		units := utf16.Encode([]rune(content))
+		b := make([]byte, 0, 2*len(units)+2)
+		for _, u := range append([]uint16{byteOrderMark}, units...) {
+			if e == UTF16LE {
+				b = append(b, byte(u), byte(u>>8))
+			} else {
+				b = append(b, byte(u>>8), byte(u))
+			}
+		}
+		return string(b), nil
+	}
+	return content, nil
+}
+
+// byteOrderMark is the code point starting UTF-16 text to tell its byte order.
+const byteOrderMark = 0xfeff
+
+// ErrUnknownEncoding indicates that a name of Encoding isn't known.
+var ErrUnknownEncoding = errors.New("unknown encoding")
+
+// ErrInvalidEncoding indicates that content can't be decoded from or encoded in
+// its Encoding.
+var ErrInvalidEncoding = errors.New("invalid encoding")
@@ -0,0 +1,90 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+var encodingTests = []struct {
+	name     string
+	encoding Encoding
+	encoded  string
+	decoded  string
+}{
+	{
+		name:     "latin-1",
+		encoding: Latin1,
+		encoded:  "caf\xe9\n",
+		decoded:  "café\n",
+	},
+	{
+		name:     "utf-16le",
+		encoding: UTF16LE,
+		encoded:  "\xff\xfec\x00a\x00f\x00\xe9\x00\n\x00",
+		decoded:  "café\n",
+	},
+	{
+		name:     "utf-16be",
+		encoding: UTF16BE,
+		encoded:  "\xfe\xff\x00c\x00a\x00f\x00\xe9\x00\n",
+		decoded:  "café\n",
+	},
+}
+
+func TestEncoding(t *testing.T) {
+	for _, tt := range encodingTests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := tt.encoding.decode(tt.encoded)
+			if err != nil || decoded != tt.decoded {
+				t.Errorf("decode(%q) = %q, %v; want %q, nil", tt.encoded, decoded, err, tt.decoded)
+			}
+			encoded, err := tt.encoding.encode(tt.decoded)
+			if err != nil || encoded != tt.encoded {
+				t.Errorf("encode(%q) = %q, %v; want %q, nil", tt.decoded, encoded, err, tt.encoded)
+			}
+		})
+	}
+}
+
+func TestEncodingErrors(t *testing.T) {
+	if _, err := UTF16LE.decode("a\x00b"); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("decode of odd bytes: got error %v; want error %v", err, ErrInvalidEncoding)
+	}
+	if _, err := Latin1.encode("€"); !errors.Is(err, ErrInvalidEncoding) {
+		t.Errorf("encode of %q: got error %v; want error %v", "€", err, ErrInvalidEncoding)
+	}
+	if _, err := ParseEncoding("ebcdic"); !errors.Is(err, ErrUnknownEncoding) {
+		t.Errorf("ParseEncoding(%q): got error %v; want error %v", "ebcdic", err, ErrUnknownEncoding)
+	}
+}
+
+func TestApplyFileDiffEncoding(t *testing.T) {
+	fd, err := diff.ParseFileDiff([]byte("--- f\n+++ f\n@@ -1,1 +1,1 @@\n-café\n+thé\n"))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+	source := "\xff\xfec\x00a\x00f\x00\xe9\x00\n\x00"
+	result, err := ApplyFileDiff(source, fd, ApplyOptions{Encoding: UTF16LE})
+	if err != nil {
+		t.Fatalf("ApplyFileDiff: got error %v; want error nil", err)
+	}
+	if want := "\xff\xfet\x00h\x00\xe9\x00\n\x00"; result != want {
+		t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, want)
+	}
+}
+
+func TestMixedModeEncoding(t *testing.T) {
+	oldDiff := "--- a\n+++ a\n@@ -1,2 +1,2 @@\n café\n-thé\n+tea\n"
+	newDiff := "--- b\n+++ b\n@@ -1,2 +1,2 @@\n café\n thé\n"
+	result, err := MixedModeFileWithOptions(strings.NewReader("caf\xe9\nth\xe9\n"), strings.NewReader("caf\xe9\nth\xe9\n"),
+		strings.NewReader(oldDiff), strings.NewReader(newDiff), MixedModeOptions{Encoding: Latin1})
+	if err != nil {
+		t.Fatalf("MixedModeFileWithOptions: got error %v; want error nil", err)
+	}
+	if want := "--- a\n+++ b\n@@ -1,2 +1,2 @@\n café\n-tea\n+thé\n"; result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
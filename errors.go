@@ -0,0 +1,177 @@
+package patchutils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// ParseError tells where a diff can't be parsed. Errors of functions parsing
+// diffs wrap it, so that errors.As finds it.
+type ParseError struct {
+	// Line is the line of the diff, counted from 1, the error is found at, or 0
+	// if it isn't known.
+	Line int
+	// Err is the error of the parser, such as diff.ErrNoFileHeader.
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns Err.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns err, an error of the parser of go-diff for content, as a
+// *ParseError. Errors without a line, such as of bad hunk headers, get the line
+// of the first problem Validate finds in content, if any. It returns nil and
+// io.EOF as they are.
+func parseError(err error, content []byte) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	var pe *diff.ParseError
+	if errors.As(err, &pe) {
+		return &ParseError{Line: pe.Line, Err: pe.Err}
+	}
+	parseErr := &ParseError{Err: err}
+	if problems := Validate(bytes.NewReader(content)); len(problems) > 0 {
+		parseErr.Line = problems[0].Line
+	}
+	return parseErr
+}
+
+// ParsePatch returns the file diffs of patch the way functions of this package
+// read them: with slash-separated names, and errors of the parser as *ParseError.
+func ParsePatch(patch io.Reader) ([]*diff.FileDiff, error) {
+	return readPatch(patch)
+}
+
+// readPatch returns the file diffs of patch, with errors of the parser as *ParseError.
+func readPatch(patch io.Reader) ([]*diff.FileDiff, error) {
+	content, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return nil, err
+	}
+	fileDiffs, err := diff.NewMultiFileDiffReader(bytes.NewReader(content)).ReadAllFiles()
+	for _, fd := range fileDiffs {
+		slashFileDiffNames(fd)
+	}
+	return fileDiffs, parseError(err, content)
+}
+
+// readFileDiff returns the single file diff of d, with errors of the parser as *ParseError.
+func readFileDiff(d io.Reader) (*diff.FileDiff, error) {
+	content, err := ioutil.ReadAll(d)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := diff.ParseFileDiff(content)
+	if fd != nil {
+		slashFileDiffNames(fd)
+	}
+	return fd, parseError(err, content)
+}
+
+// ApplyError tells where a hunk doesn't match the source it is applied to.
+// Errors of functions applying diffs wrap it, so that errors.As finds it, and
+// errors.Is(err, ErrContentMismatch) holds for it.
+type ApplyError struct {
+	// File is the original name of the file diff of Hunk, if it has one.
+	File string
+	// Hunk is the hunk which doesn't apply. If it doesn't apply anywhere, the
+	// error is the one at the position given in its header.
+	Hunk *diff.Hunk
+	// Line is the line of the source, counted from 1, which doesn't match.
+	Line int
+	// Expected is the line of the hunk, without its prefix, and Got is the line
+	// of the source.
+	Expected, Got string
+	// Outside is set if Line is past the end of the source, or in lines of an
+	// earlier hunk, with Got empty.
+	Outside bool
+}
+
+func (e *ApplyError) Error() string {
+	if e.Outside {
+		return fmt.Sprintf("line %d (%q) is out of source content: %v", e.Line, e.Expected, ErrContentMismatch)
+	}
+	return fmt.Sprintf("line %d in source (%q) and diff (%q): %v", e.Line, e.Got, e.Expected, ErrContentMismatch)
+}
+
+// Unwrap returns ErrContentMismatch, so that errors.Is(err, ErrContentMismatch) holds.
+func (e *ApplyError) Unwrap() error {
+	return ErrContentMismatch
+}
+
+// FileError is the error of a file skipped with the KeepGoing option.
+type FileError struct {
+	// File is the name of the file, as in the diffs for InterDiff or the path of
+	// the file in the old source for MixedModePath.
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s: %v", e.File, e.Err)
+}
+
+// Unwrap returns Err.
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// FileErrors are the errors of all files skipped with the KeepGoing option, in
+// the order of the files. Results of the other files are complete.
+type FileErrors []*FileError
+
+func (e FileErrors) Error() string {
+	parts := make([]string, len(e))
+	for k, fe := range e {
+		parts[k] = fe.Error()
+	}
+	return fmt.Sprintf("%d files failed: %s", len(e), strings.Join(parts, "; "))
+}
+
+// Is reports whether the error of any of the files is target, so that errors.Is
+// looks through all of them.
+func (e FileErrors) Is(target error) bool {
+	for _, fe := range e {
+		if errors.Is(fe, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the files matching target, so that errors.As looks
+// through all of them.
+func (e FileErrors) As(target interface{}) bool {
+	for _, fe := range e {
+		if errors.As(fe, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// keptResult returns result and err, with result dropped unless err wraps
+// FileErrors of files skipped with the KeepGoing option.
+func keptResult(result string, err error) (string, error) {
+	var fileErrs FileErrors
+	if err != nil && !errors.As(err, &fileErrs) {
+		return "", err
+	}
+	return result, err
+}
@@ -0,0 +1,60 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseError(t *testing.T) {
+	patch := "--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n-a\n+b\n@@ -x +2 @@\n"
+	_, err := InterDiff(strings.NewReader(patch), strings.NewReader(patch))
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) {
+		t.Fatalf("InterDiff: got error %v; want a *ParseError", err)
+	}
+	if parseErr.Line != 6 {
+		t.Errorf("Line = %d; want 6", parseErr.Line)
+	}
+}
+
+var applyErrorTests = []struct {
+	name   string
+	source string
+	want   ApplyError
+}{
+	{
+		name:   "mismatch",
+		source: "a\nx\nc\n",
+		want:   ApplyError{File: "a.txt", Line: 2, Expected: "b", Got: "x"},
+	},
+	{
+		name:   "past the end",
+		source: "a\n",
+		want:   ApplyError{File: "a.txt", Line: 2, Expected: "b", Outside: true},
+	},
+}
+
+func TestApplyError(t *testing.T) {
+	fd, err := readFileDiff(strings.NewReader("--- a.txt\n+++ a.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"))
+	if err != nil {
+		t.Fatalf("readFileDiff: got error %v; want error nil", err)
+	}
+	for _, tt := range applyErrorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ApplyFileDiff(tt.source, fd, ApplyOptions{})
+			if !errors.Is(err, ErrContentMismatch) {
+				t.Errorf("ApplyFileDiff: got error %v; want error %v", err, ErrContentMismatch)
+			}
+			var applyErr *ApplyError
+			if !errors.As(err, &applyErr) {
+				t.Fatalf("ApplyFileDiff: got error %v; want an *ApplyError", err)
+			}
+			want := tt.want
+			want.Hunk = fd.Hunks[0]
+			if *applyErr != want {
+				t.Errorf("Got error %+v; want %+v", *applyErr, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package patchutils
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// excludePattern is a compiled pattern of MixedModeOptions.ExcludeGlobs.
+type excludePattern struct {
+	// parts are the patterns of consecutive path components, where "**" matches
+	// any number of components.
+	parts []string
+	// negate re-includes paths matched by the pattern.
+	negate bool
+	// dirOnly matches directories only.
+	dirOnly bool
+}
+
+// excludePatterns are the patterns of MixedModeOptions.ExcludeGlobs, of which
+// the last one matching a path decides whether it is excluded.
+type excludePatterns []excludePattern
+
+// compileExcludes compiles globs, gitignore-style patterns described at
+// MixedModeOptions.ExcludeGlobs.
+func compileExcludes(globs []string) (excludePatterns, error) {
+	var patterns excludePatterns
+	for _, glob := range globs {
+		var p excludePattern
+		pattern := glob
+		if strings.HasPrefix(pattern, "!") {
+			p.negate = true
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			p.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		// Patterns without a slash match at any depth, others relative to the root
+		if !strings.Contains(pattern, "/") {
+			pattern = "**/" + pattern
+		}
+		p.parts = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+		for _, part := range p.parts {
+			if _, err := path.Match(part, ""); err != nil || part == "" {
+				return nil, fmt.Errorf("exclude pattern %q: %w", glob, path.ErrBadPattern)
+			}
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// excluded reports whether the file or, if isDir is set, the directory at name,
+// a slash-separated path relative to the root of a source, is excluded. Files of
+// excluded directories aren't considered, as they are skipped with the directory.
+func (ps excludePatterns) excluded(name string, isDir bool) bool {
+	components := strings.Split(name, "/")
+	excluded := false
+	for _, p := range ps {
+		if (isDir || !p.dirOnly) && matchComponents(p.parts, components) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
+
+// excludedFile reports whether the file at name, a slash-separated path relative
+// to the root of a source, or one of its parent directories is excluded.
+func (ps excludePatterns) excludedFile(name string) bool {
+	if len(ps) == 0 {
+		return false
+	}
+	for k := 0; k < len(name); k++ {
+		if name[k] == '/' && ps.excluded(name[:k], true) {
+			return true
+		}
+	}
+	return ps.excluded(name, false)
+}
+
+// fileDiffs returns fileDiffs without those of files excluded by ps, given their
+// names below root.
+func (ps excludePatterns) fileDiffs(fileDiffs []*diff.FileDiff, root string) []*diff.FileDiff {
+	if len(ps) == 0 {
+		return fileDiffs
+	}
+	var kept []*diff.FileDiff
+	for _, fd := range fileDiffs {
+		if !ps.excludedFile(relativeSourcePath(fd.OrigName, root)) {
+			kept = append(kept, fd)
+		}
+	}
+	return kept
+}
+
+// relativeSourcePath returns the slash-separated path of name, a path below
+// root, relative to root.
+func relativeSourcePath(name, root string) string {
+	name, root = filepath.ToSlash(name), filepath.ToSlash(filepath.Clean(root))
+	if root == "." {
+		return strings.TrimPrefix(name, "./")
+	}
+	return strings.TrimPrefix(strings.TrimPrefix(name, root), "/")
+}
+
+// matchComponents reports whether the path components match the patterns of parts.
+func matchComponents(parts, components []string) bool {
+	if len(parts) == 0 {
+		return len(components) == 0
+	}
+	if parts[0] == "**" {
+		for k := 0; k <= len(components); k++ {
+			if matchComponents(parts[1:], components[k:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(components) == 0 {
+		return false
+	}
+	matched, _ := path.Match(parts[0], components[0])
+	return matched && matchComponents(parts[1:], components[1:])
+}
@@ -0,0 +1,83 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+var excludeTests = []struct {
+	globs    []string
+	name     string
+	isDir    bool
+	excluded bool
+}{
+	{globs: []string{"*.o"}, name: "main.o", excluded: true},
+	{globs: []string{"*.o"}, name: "lib/deep/util.o", excluded: true},
+	{globs: []string{"*.o"}, name: "main.c", excluded: false},
+	{globs: []string{".git"}, name: ".git", isDir: true, excluded: true},
+	{globs: []string{"/build"}, name: "build", isDir: true, excluded: true},
+	{globs: []string{"/build"}, name: "src/build", isDir: true, excluded: false},
+	{globs: []string{"third_party/vendor"}, name: "third_party/vendor", isDir: true, excluded: true},
+	{globs: []string{"third_party/vendor"}, name: "x/third_party/vendor", isDir: true, excluded: false},
+	{globs: []string{"out/"}, name: "out", isDir: true, excluded: true},
+	{globs: []string{"out/"}, name: "out", excluded: false},
+	{globs: []string{"docs/**/*.html"}, name: "docs/index.html", excluded: true},
+	{globs: []string{"docs/**/*.html"}, name: "docs/api/v1/index.html", excluded: true},
+	{globs: []string{"*.gen.go", "!keep.gen.go"}, name: "pkg/keep.gen.go", excluded: false},
+	{globs: []string{"!keep.gen.go", "*.gen.go"}, name: "pkg/keep.gen.go", excluded: true},
+}
+
+func TestExcludePatterns(t *testing.T) {
+	for _, tt := range excludeTests {
+		t.Run(fmt.Sprintf("%q %s", tt.globs, tt.name), func(t *testing.T) {
+			patterns, err := compileExcludes(tt.globs)
+			if err != nil {
+				t.Fatalf("compileExcludes: got error %v; want error nil", err)
+			}
+			if excluded := patterns.excluded(tt.name, tt.isDir); excluded != tt.excluded {
+				t.Errorf("excluded(%q, %t) = %t; want %t", tt.name, tt.isDir, excluded, tt.excluded)
+			}
+		})
+	}
+}
+
+func TestExcludeBadPattern(t *testing.T) {
+	for _, glob := range []string{"[", "", "a//b"} {
+		if _, err := compileExcludes([]string{glob}); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("compileExcludes(%q): got error %v; want error %v", glob, err, path.ErrBadPattern)
+		}
+	}
+}
+
+func TestMixedModePathExclude(t *testing.T) {
+	files := map[string]string{
+		"a.c":               "a\n",
+		"a.o":               "binary\n",
+		".git/HEAD":         "ref\n",
+		"vendor/lib/lib.go": "package lib\n",
+	}
+	oldRoot := writeTestTree(t, files)
+	defer os.RemoveAll(oldRoot)
+	files["a.o"] = "other binary\n"
+	delete(files, ".git/HEAD")
+	newRoot := writeTestTree(t, files)
+	defer os.RemoveAll(newRoot)
+
+	// Changes of excluded files are dropped along with them
+	oldDiff := fmt.Sprintf("--- %[1]s/a.c\n+++ %[1]s/a.c\n@@ -1 +1 @@\n-a\n+b\n"+
+		"--- %[1]s/vendor/lib/lib.go\n+++ %[1]s/vendor/lib/lib.go\n@@ -1 +1 @@\n-package lib\n+package lib2\n", oldRoot)
+	newDiff := fmt.Sprintf("--- %[1]s/a.c\n+++ %[1]s/a.c\n@@ -1 +1 @@\n-a\n+c\n", newRoot)
+	opts := MixedModeOptions{ExcludeGlobs: []string{"*.o", ".git/", "/vendor"}}
+	result, err := MixedModePathWithOptions(oldRoot, newRoot, strings.NewReader(oldDiff), strings.NewReader(newDiff), opts)
+	if err != nil {
+		t.Fatalf("MixedModePath: got error %v; want error nil", err)
+	}
+	want := fmt.Sprintf("--- %s/a.c\n+++ %s/a.c\n@@ -1,1 +1,1 @@\n-b\n+c\n", oldRoot, newRoot)
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
@@ -0,0 +1,332 @@
+package patchutils
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// LinkMode tells how ExportTree writes files which the patch leaves unchanged.
+type LinkMode int
+
+const (
+	// CopyFiles copies unchanged files.
+	CopyFiles LinkMode = iota
+	// HardLinkFiles hard-links unchanged files to those of the source, copying them
+	// where links aren't possible, such as across filesystems. Linked files share
+	// their content and mode with the source: changing one changes the other.
+	HardLinkFiles
+	// ReflinkFiles clones unchanged files with copy-on-write on filesystems supporting
+	// it, such as Btrfs and XFS on Linux, copying them elsewhere. Cloned files take no
+	// space until either of them is changed.
+	ReflinkFiles
+)
+
+// ExportOptions configures ExportTree and ExportTar.
+type ExportOptions struct {
+	// Link tells how ExportTree writes unchanged files. ExportTar always copies them.
+	Link LinkMode
+	// Apply configures how file diffs are applied.
+	Apply ApplyOptions
+	// StripLevel is the number of leading path components removed from file names
+	// in the patch, like patch -p.
+	StripLevel int
+}
+
+// ExportTree writes the tree at source patched with patch to the new directory out,
+// leaving source untouched. Files added and deleted by patch are added and left out,
+// and modes set by git extended headers are honored. Nothing is written unless
+// all file diffs apply.
+func ExportTree(source string, patch io.Reader, out string, opts ExportOptions) error {
+	absSource, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	absOut, err := filepath.Abs(out)
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(absSource, absOut); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("output directory %q is inside of %q: %w", out, source, ErrUnsafePath)
+	}
+	if err := os.Mkdir(out, 0755); err != nil {
+		return fmt.Errorf("creating output directory: %w", err)
+	}
+	return exportTree(source, patch, &dirExporter{root: out, link: opts.Link}, opts)
+}
+
+// ExportTar is like ExportTree, writing the patched tree as a tar archive to w.
+func ExportTar(source string, patch io.Reader, w io.Writer, opts ExportOptions) error {
+	tw := tar.NewWriter(w)
+	if err := exportTree(source, patch, &tarExporter{w: tw}, opts); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("writing tar archive: %w", err)
+	}
+	return nil
+}
+
+// exporter writes files of an exported tree. Names are slash-separated and
+// relative to the root of the tree. Directories are written before their files.
+type exporter interface {
+	// dir writes directory name.
+	dir(name string, mode os.FileMode) error
+	// file writes file name with content.
+	file(name string, content string, mode os.FileMode) error
+	// copy writes file name with the content of the unchanged file at path.
+	copy(name, path string, info os.FileInfo) error
+	// symlink writes symbolic link name pointing to target.
+	symlink(name, target string) error
+}
+
+// exportTree writes the tree at source patched with patch to e.
+func exportTree(source string, patch io.Reader, e exporter, opts ExportOptions) error {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return fmt.Errorf("parsing patch: %w", err)
+	}
+
+	t := newPatchTree(func(name string) (string, error) {
+		content, err := ioutil.ReadFile(longPath(filepath.Join(source, filepath.FromSlash(name))))
+		return string(content), err
+	}, opts.StripLevel, opts.Apply)
+	for _, fd := range fileDiffs {
+		if err := t.apply(fd); err != nil {
+			return err
+		}
+	}
+
+	if opts.Apply.Quota != (Quota{}) {
+		// Counted before anything is written
+		if err := writeExport(source, t, &quotaExporter{usage: quotaUsage{quota: opts.Apply.Quota}}); err != nil {
+			return err
+		}
+	}
+	return writeExport(source, t, e)
+}
+
+// writeExport writes the tree at source with the changes of t to e.
+func writeExport(source string, t *patchTree, e exporter) error {
+	// dirs holds directories written, so that added files get their parents
+	dirs := map[string]bool{".": true}
+	// Below an absolute root, paths of deep files aren't limited in length on Windows
+	root, err := filepath.Abs(source)
+	if err != nil {
+		return err
+	}
+	root = longPath(root)
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk into %q: %w", p, err)
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if name == "." {
+			return nil
+		}
+
+		f, changed := t.files[name]
+		switch {
+		case info.IsDir():
+			dirs[name] = true
+			return e.dir(name, info.Mode().Perm())
+		case changed && f.deleted:
+			return nil
+		case changed:
+			mode := f.mode
+			if mode == 0 {
+				mode = info.Mode().Perm()
+			}
+			return e.file(name, f.content, mode)
+		case info.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(p)
+			if err != nil {
+				return fmt.Errorf("reading link %q: %w", p, err)
+			}
+			return e.symlink(name, target)
+		case info.Mode().IsRegular():
+			return e.copy(name, p, info)
+		}
+		// Other files, such as devices and sockets, aren't exported
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Files added by patch
+	var added []string
+	for _, name := range t.names {
+		if f := t.files[name]; !f.deleted {
+			if _, err := os.Lstat(longPath(filepath.Join(source, filepath.FromSlash(name)))); os.IsNotExist(err) {
+				added = append(added, name)
+			}
+		}
+	}
+	sort.Strings(added)
+	for _, name := range added {
+		if err := exportParents(e, dirs, name); err != nil {
+			return err
+		}
+		f := t.files[name]
+		mode := f.mode
+		if mode == 0 {
+			mode = 0644
+		}
+		if err := e.file(name, f.content, mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// exportParents writes the parent directories of file name missing from dirs.
+func exportParents(e exporter, dirs map[string]bool, name string) error {
+	parts := strings.Split(name, "/")
+	for k := 1; k < len(parts); k++ {
+		dir := strings.Join(parts[:k], "/")
+		if dirs[dir] {
+			continue
+		}
+		if err := e.dir(dir, 0755); err != nil {
+			return err
+		}
+		dirs[dir] = true
+	}
+	return nil
+}
+
+// dirExporter writes an exported tree into directory root.
+type dirExporter struct {
+	root string
+	link LinkMode
+}
+
+func (d *dirExporter) path(name string) string {
+	return longPath(filepath.Join(d.root, filepath.FromSlash(name)))
+}
+
+func (d *dirExporter) dir(name string, mode os.FileMode) error {
+	if err := os.Mkdir(d.path(name), mode|0700); err != nil {
+		return fmt.Errorf("creating directory %q: %w", name, err)
+	}
+	return nil
+}
+
+func (d *dirExporter) file(name string, content string, mode os.FileMode) error {
+	if err := ioutil.WriteFile(d.path(name), []byte(content), mode); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	return nil
+}
+
+func (d *dirExporter) copy(name, path string, info os.FileInfo) error {
+	if d.link == HardLinkFiles {
+		if err := os.Link(path, d.path(name)); err == nil {
+			return nil
+		}
+		// Copied where links aren't possible
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", path, err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(d.path(name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("creating %q: %w", name, err)
+	}
+	if d.link == ReflinkFiles && reflink(dst, src) == nil {
+		return dst.Close()
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("copying %q: %w", name, err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("copying %q: %w", name, err)
+	}
+	return nil
+}
+
+func (d *dirExporter) symlink(name, target string) error {
+	if err := os.Symlink(target, d.path(name)); err != nil {
+		return fmt.Errorf("creating link %q: %w", name, err)
+	}
+	return nil
+}
+
+// tarExporter writes an exported tree as a tar archive.
+type tarExporter struct {
+	w *tar.Writer
+}
+
+// exportModTime is the modification time of files changed by the patch and of
+// directories in tar archives, so that archives of the same tree are the same.
+var exportModTime = time.Unix(0, 0)
+
+func (t *tarExporter) dir(name string, mode os.FileMode) error {
+	hdr := &tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: int64(mode), ModTime: exportModTime}
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	return nil
+}
+
+func (t *tarExporter) file(name string, content string, mode os.FileMode) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode),
+		Size:     int64(len(content)),
+		ModTime:  exportModTime,
+	}
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	if _, err := io.WriteString(t.w, content); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	return nil
+}
+
+func (t *tarExporter) copy(name, path string, info os.FileInfo) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", path, err)
+	}
+	defer src.Close()
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(info.Mode().Perm()),
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+	}
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	if _, err := io.Copy(t.w, src); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	return nil
+}
+
+func (t *tarExporter) symlink(name, target string) error {
+	hdr := &tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target, ModTime: exportModTime}
+	if err := t.w.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("writing %q: %w", name, err)
+	}
+	return nil
+}
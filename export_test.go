@@ -0,0 +1,165 @@
+package patchutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// exportSource is the tree exported by tests, in a source directory so that
+// outputs can be written next to it.
+var exportSource = map[string]string{
+	"source/a.txt":      "one\ntwo\n",
+	"source/b.txt":      "unchanged\n",
+	"source/sub/gone.c": "x\n",
+}
+
+const exportPatch = `--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+ one
+-two
++TWO
+--- a/sub/gone.c
++++ /dev/null
+@@ -1,1 +0,0 @@
+-x
+diff --git a/new/run.sh b/new/run.sh
+new file mode 100755
+--- /dev/null
++++ b/new/run.sh
+@@ -0,0 +1,1 @@
++echo hi
+`
+
+// exportResult is the tree exportSource patched with exportPatch, by file name
+// with the mode of each file.
+var exportResult = map[string]string{
+	"a.txt":      "-rw-r--r-- one\nTWO\n",
+	"b.txt":      "-rw-r--r-- unchanged\n",
+	"new/run.sh": "-rwxr-xr-x echo hi\n",
+}
+
+func TestExportTree(t *testing.T) {
+	dir := writeTestTree(t, exportSource)
+	defer os.RemoveAll(dir)
+	source, out := filepath.Join(dir, "source"), filepath.Join(dir, "out")
+
+	if err := ExportTree(source, strings.NewReader(exportPatch), out, ExportOptions{StripLevel: 1}); err != nil {
+		t.Fatalf("ExportTree: got error %v; want error nil", err)
+	}
+
+	got := make(map[string]string)
+	err := filepath.Walk(out, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(out, p)
+		got[filepath.ToSlash(rel)] = info.Mode().String() + " " + string(content)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, exportResult) {
+		t.Errorf("Exported tree mismatch.\nGot:\n%q\nWant:\n%q\n", got, exportResult)
+	}
+
+	// Source is untouched
+	content, err := ioutil.ReadFile(filepath.Join(source, "a.txt"))
+	if err != nil || string(content) != exportSource["source/a.txt"] {
+		t.Errorf("Source a.txt changed: %q, %v", content, err)
+	}
+}
+
+func TestExportTreeInsideSource(t *testing.T) {
+	dir := writeTestTree(t, exportSource)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source")
+
+	err := ExportTree(source, strings.NewReader(exportPatch), filepath.Join(source, "out"), ExportOptions{StripLevel: 1})
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("ExportTree: got error %v; want error %v", err, ErrUnsafePath)
+	}
+}
+
+func TestExportTar(t *testing.T) {
+	dir := writeTestTree(t, exportSource)
+	defer os.RemoveAll(dir)
+
+	var b bytes.Buffer
+	if err := ExportTar(filepath.Join(dir, "source"), strings.NewReader(exportPatch), &b, ExportOptions{StripLevel: 1}); err != nil {
+		t.Fatalf("ExportTar: got error %v; want error nil", err)
+	}
+
+	got := make(map[string]string)
+	tr := tar.NewReader(&b)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Error reading archive: %v", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatalf("Error reading archive: %v", err)
+		}
+		got[hdr.Name] = hdr.FileInfo().Mode().String() + " " + string(content)
+	}
+	if !reflect.DeepEqual(got, exportResult) {
+		t.Errorf("Exported tree mismatch.\nGot:\n%q\nWant:\n%q\n", got, exportResult)
+	}
+}
+
+func TestExportTreeLinks(t *testing.T) {
+	dir := writeTestTree(t, exportSource)
+	defer os.RemoveAll(dir)
+	source := filepath.Join(dir, "source")
+
+	for _, link := range []LinkMode{HardLinkFiles, ReflinkFiles} {
+		out := filepath.Join(dir, fmt.Sprintf("out%d", link))
+		if err := ExportTree(source, strings.NewReader(exportPatch), out, ExportOptions{Link: link, StripLevel: 1}); err != nil {
+			t.Fatalf("ExportTree with LinkMode %d: got error %v; want error nil", link, err)
+		}
+		for name, want := range map[string]string{"a.txt": "one\nTWO\n", "b.txt": "unchanged\n"} {
+			content, err := ioutil.ReadFile(filepath.Join(out, name))
+			if err != nil || string(content) != want {
+				t.Errorf("LinkMode %d: %s: got %q, %v; want %q", link, name, content, err, want)
+			}
+		}
+
+		// Only unchanged files are linked
+		sourceInfo, err := os.Stat(filepath.Join(source, "b.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		outInfo, err := os.Stat(filepath.Join(out, "b.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked := os.SameFile(sourceInfo, outInfo); linked != (link == HardLinkFiles) {
+			t.Errorf("LinkMode %d: b.txt linked: %v; want %v", link, linked, link == HardLinkFiles)
+		}
+		content, err := ioutil.ReadFile(filepath.Join(source, "a.txt"))
+		if err != nil || string(content) != exportSource["source/a.txt"] {
+			t.Errorf("LinkMode %d: source a.txt changed: %q, %v", link, content, err)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package patchutils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// gitHeader is the information carried by git extended header lines of a FileDiff.
+type gitHeader struct {
+	// oldName and newName are names from the "diff --git" line, without a/ and b/ prefixes.
+	oldName, newName string
+	// oldHash and newHash are blob hashes from the "index" line.
+	oldHash, newHash string
+	// oldMode and newMode are modes of the file before and after the change.
+	oldMode, newMode string
+}
+
+// parseGitHeader returns the information carried by git extended header lines,
+// and false if there is no "diff --git" line among them.
+func parseGitHeader(extended []string) (gitHeader, bool) {
+	var h gitHeader
+	found := false
+	for _, line := range extended {
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			fields := strings.Fields(line)
+			if len(fields) == 4 {
+				h.oldName = strings.TrimPrefix(fields[2], "a/")
+				h.newName = strings.TrimPrefix(fields[3], "b/")
+				found = true
+			}
+		case strings.HasPrefix(line, "index "):
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				break
+			}
+			if hashes := strings.Split(fields[1], ".."); len(hashes) == 2 {
+				h.oldHash, h.newHash = hashes[0], hashes[1]
+			}
+			if len(fields) == 3 {
+				// Mode is unchanged
+				h.oldMode, h.newMode = fields[2], fields[2]
+			}
+		case strings.HasPrefix(line, "old mode "):
+			h.oldMode = strings.TrimPrefix(line, "old mode ")
+		case strings.HasPrefix(line, "new mode "):
+			h.newMode = strings.TrimPrefix(line, "new mode ")
+		case strings.HasPrefix(line, "new file mode "):
+			h.newMode = strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "deleted file mode "):
+			h.oldMode = strings.TrimPrefix(line, "deleted file mode ")
+		}
+	}
+	return h, found
+}
+
+// setInterExtended sets git extended header lines of result, the diff between a file
+// patched with oldFileDiff and a file patched with newFileDiff, if any of them has
+// git headers. The result then names files with a/ and b/ prefixes and carries mode
+// changes, renames and blob hashes of both patched files, so that git apply accepts it.
+// Hunks of result are dropped if there are none, so that a change of mode only is
+// printed as git does.
+func setInterExtended(result, oldFileDiff, newFileDiff *diff.FileDiff) {
+	oldHeader, oldGit := parseGitHeader(oldFileDiff.Extended)
+	newHeader, newGit := parseGitHeader(newFileDiff.Extended)
+	if !oldGit && !newGit {
+		return
+	}
+
+	from, to := oldHeader.newName, newHeader.newName
+	if !oldGit {
+		from = to
+	}
+	if !newGit {
+		to = from
+	}
+	fromMode, toMode := oldHeader.newMode, newHeader.newMode
+
+	var extended []string
+	if fromMode != "" && toMode != "" && fromMode != toMode {
+		extended = append(extended, "old mode "+fromMode, "new mode "+toMode)
+	}
+	if from != to {
+		if len(result.Hunks) == 0 {
+			// Contents are the same, as in renames found by git
+			extended = append(extended, "similarity index 100%")
+		}
+		extended = append(extended, "rename from "+from, "rename to "+to)
+	}
+	if len(result.Hunks) == 0 {
+		if len(extended) == 0 {
+			// Nothing changed
+			return
+		}
+		result.Hunks = nil
+	} else if oldHeader.newHash != "" && newHeader.newHash != "" {
+		index := "index " + oldHeader.newHash + ".." + newHeader.newHash
+		if fromMode != "" && fromMode == toMode {
+			index += " " + fromMode
+		}
+		extended = append(extended, index)
+	}
+
+	result.Extended = append([]string{fmt.Sprintf("diff --git a/%s b/%s", from, to)}, extended...)
+	result.OrigName, result.NewName = "a/"+from, "b/"+to
+}
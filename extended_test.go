@@ -0,0 +1,91 @@
+package patchutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseGitHeader(t *testing.T) {
+	extended := []string{
+		"diff --git a/old.c b/new.c",
+		"old mode 100644",
+		"new mode 100755",
+		"similarity index 90%",
+		"rename from old.c",
+		"rename to new.c",
+		"index 1111111..2222222",
+	}
+	want := gitHeader{
+		oldName: "old.c",
+		newName: "new.c",
+		oldHash: "1111111",
+		newHash: "2222222",
+		oldMode: "100644",
+		newMode: "100755",
+	}
+
+	got, ok := parseGitHeader(extended)
+	if !ok {
+		t.Fatalf("parseGitHeader: got no git header; want one")
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGitHeader: got %+v; want %+v", got, want)
+	}
+	if _, ok := parseGitHeader([]string{"Index: foo.c"}); ok {
+		t.Errorf("parseGitHeader: got git header for non-git lines; want none")
+	}
+}
+
+var interDiffExtendedTests = []struct {
+	name    string
+	oldDiff string
+	newDiff string
+	result  string
+}{
+	{
+		name: "index hashes of patched files",
+		oldDiff: "diff --git a/foo.c b/foo.c\nindex 1111111..2222222 100644\n" +
+			"--- a/foo.c\n+++ b/foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		newDiff: "diff --git a/foo.c b/foo.c\nindex 1111111..3333333 100644\n" +
+			"--- a/foo.c\n+++ b/foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+X\n c\n",
+		result: "diff --git a/foo.c b/foo.c\nindex 2222222..3333333 100644\n" +
+			"--- a/foo.c\n+++ b/foo.c\n@@ -1,3 +1,3 @@\n a\n-B\n+X\n c\n",
+	},
+	{
+		name: "mode change only",
+		oldDiff: "diff --git a/foo.c b/foo.c\nindex 1111111..2222222 100644\n" +
+			"--- a/foo.c\n+++ b/foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		newDiff: "diff --git a/foo.c b/foo.c\nold mode 100644\nnew mode 100755\nindex 1111111..2222222\n" +
+			"--- a/foo.c\n+++ b/foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		result: "diff --git a/foo.c b/foo.c\nold mode 100644\nnew mode 100755\n",
+	},
+	{
+		name: "renamed file",
+		oldDiff: "diff --git a/foo.c b/foo.c\n" +
+			"--- a/foo.c\n+++ b/foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		newDiff: "diff --git a/foo.c b/bar.c\nrename from foo.c\nrename to bar.c\n" +
+			"--- a/foo.c\n+++ b/bar.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		result: "diff --git a/foo.c b/bar.c\nsimilarity index 100%\nrename from foo.c\nrename to bar.c\n",
+	},
+	{
+		name:    "no git headers",
+		oldDiff: "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		newDiff: "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+X\n c\n",
+		result:  "--- foo.c\n+++ foo.c\n@@ -1,3 +1,3 @@\n a\n-B\n+X\n c\n",
+	},
+}
+
+func TestInterDiffExtended(t *testing.T) {
+	for _, tt := range interDiffExtendedTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := InterDiff(strings.NewReader(tt.oldDiff), strings.NewReader(tt.newDiff))
+			if err != nil {
+				t.Fatalf("InterDiff: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
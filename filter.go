@@ -0,0 +1,101 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// FilterOptions selects files of a patch by their paths.
+// Patterns use the syntax of path.Match. A pattern also matches all files
+// below the directories it matches, so "drivers/net" and "drivers/*" select
+// whole subtrees.
+type FilterOptions struct {
+	// Include keeps only files matching at least one of the patterns.
+	// All files are kept if it is empty.
+	Include []string
+	// Exclude drops files matching any of the patterns, even if they are included.
+	Exclude []string
+	// Strip is the number of leading path components removed from file names
+	// before they are matched, as in patch -p.
+	Strip int
+}
+
+// FilterDiff returns the files of patch selected by opts.
+// A file is matched by both its old and its new name, so renamed files are
+// selected by either of them, and added or deleted files by their only name.
+func FilterDiff(patch io.Reader, opts FilterOptions) (string, error) {
+	if err := checkFilterPatterns(opts); err != nil {
+		return "", err
+	}
+
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	result, err := diff.PrintMultiFileDiff(filterFileDiffs(fileDiffs, opts))
+	if err != nil {
+		return "", fmt.Errorf("printing filtered patch: %w", err)
+	}
+	return string(result), nil
+}
+
+// checkFilterPatterns returns an error if a pattern of opts is malformed.
+func checkFilterPatterns(opts FilterOptions) error {
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// filterFileDiffs returns the FileDiffs of fileDiffs selected by opts, whose
+// patterns must be valid.
+func filterFileDiffs(fileDiffs []*diff.FileDiff, opts FilterOptions) []*diff.FileDiff {
+	var selected []*diff.FileDiff
+	for _, fd := range fileDiffs {
+		names := fileDiffNames(fd, opts.Strip)
+		if len(opts.Include) > 0 && !matchAny(opts.Include, names) {
+			continue
+		}
+		if matchAny(opts.Exclude, names) {
+			continue
+		}
+		selected = append(selected, fd)
+	}
+	return selected
+}
+
+// fileDiffNames returns the names of the file fd changes, with strip leading components removed.
+func fileDiffNames(fd *diff.FileDiff, strip int) []string {
+	var names []string
+	for _, name := range []string{fd.OrigName, fd.NewName} {
+		if name == "" || isDevNull(name) {
+			continue
+		}
+		names = append(names, stripPath(name, strip))
+	}
+	return names
+}
+
+// matchAny reports whether any of names, or any of their parent directories,
+// matches any of patterns. Patterns must be valid.
+func matchAny(patterns, names []string) bool {
+	for _, name := range names {
+		for dir := name; dir != "." && dir != "/"; dir = path.Dir(dir) {
+			for _, pattern := range patterns {
+				if ok, _ := path.Match(pattern, dir); ok {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
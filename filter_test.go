@@ -0,0 +1,104 @@
+package patchutils
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"testing"
+)
+
+const filterTestPatch = `--- a/drivers/net/eth.c
++++ b/drivers/net/eth.c
+@@ -1 +1 @@
+-old
++new
+--- a/drivers/usb/core.c
++++ b/drivers/usb/core.c
+@@ -1 +1 @@
+-old
++new
+--- /dev/null
++++ b/docs/README
+@@ -0,0 +1 @@
++docs
+--- a/Makefile
++++ /dev/null
+@@ -1 +0,0 @@
+-all:
+`
+
+var filterDiffTests = []struct {
+	name    string
+	opts    FilterOptions
+	files   []string
+	wantErr error
+}{
+	{
+		name:  "no patterns",
+		opts:  FilterOptions{},
+		files: []string{"a/drivers/net/eth.c", "a/drivers/usb/core.c", "/dev/null", "a/Makefile"},
+	},
+	{
+		name:  "include subtree",
+		opts:  FilterOptions{Include: []string{"drivers"}, Strip: 1},
+		files: []string{"a/drivers/net/eth.c", "a/drivers/usb/core.c"},
+	},
+	{
+		name:  "include glob without strip",
+		opts:  FilterOptions{Include: []string{"*/drivers/*/*.c"}},
+		files: []string{"a/drivers/net/eth.c", "a/drivers/usb/core.c"},
+	},
+	{
+		name:  "exclude wins over include",
+		opts:  FilterOptions{Include: []string{"drivers/*"}, Exclude: []string{"drivers/usb"}, Strip: 1},
+		files: []string{"a/drivers/net/eth.c"},
+	},
+	{
+		name:  "added and deleted files",
+		opts:  FilterOptions{Include: []string{"docs/*", "Makefile"}, Strip: 1},
+		files: []string{"/dev/null", "a/Makefile"},
+	},
+	{
+		name:  "nothing selected",
+		opts:  FilterOptions{Include: []string{"tools"}, Strip: 1},
+		files: nil,
+	},
+	{
+		name:    "bad pattern",
+		opts:    FilterOptions{Exclude: []string{"["}},
+		wantErr: path.ErrBadPattern,
+	},
+}
+
+func TestFilterDiff(t *testing.T) {
+	for _, tt := range filterDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := FilterDiff(strings.NewReader(filterTestPatch), tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("FilterDiff: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FilterDiff: got error %v; want error nil", err)
+			}
+
+			var files []string
+			for _, line := range strings.Split(currentResult, "\n") {
+				if strings.HasPrefix(line, "--- ") {
+					files = append(files, strings.TrimPrefix(line, "--- "))
+				}
+			}
+			if strings.Join(files, ",") != strings.Join(tt.files, ",") {
+				t.Errorf("Files mismatch.\nGot:\n%v\nWant:\n%v\nResult:\n%s\n", files, tt.files, currentResult)
+			}
+		})
+	}
+}
+
+func TestFilterDiffEmptyPatch(t *testing.T) {
+	if _, err := FilterDiff(strings.NewReader(""), FilterOptions{}); !errors.Is(err, ErrEmptyDiffFile) {
+		t.Errorf("FilterDiff: got error %v; want error %v", err, ErrEmptyDiffFile)
+	}
+}
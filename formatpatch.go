@@ -0,0 +1,139 @@
+package patchutils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// MailPatch is the mail header and the commit message of a patch made by git
+// format-patch. Header values are kept as they appear in the mail, unfolded, with
+// MIME encoded words left encoded, so that they are written back unchanged.
+type MailPatch struct {
+	// Commit is the hash of the "From <hash> Mon Sep 17 00:00:00 2001" line.
+	Commit string
+	// From, Date and Subject are the headers of the mail. Subject keeps its
+	// "[PATCH]" prefix.
+	From, Date, Subject string
+	// MessageID is the Message-Id header, if the mail has one.
+	MessageID string
+	// Body is the commit message after the subject, up to the "---" line before
+	// the diffstat and the diff.
+	Body string
+}
+
+// mboxFromDate is the date git format-patch writes in the first line of all mails.
+const mboxFromDate = "Mon Sep 17 00:00:00 2001"
+
+// ParseMailPatch returns the mail header and the commit message of patch, a mail
+// made by git format-patch. It fails with ErrNotMailPatch if patch doesn't start
+// with the header of such a mail.
+func ParseMailPatch(patch io.Reader) (*MailPatch, error) {
+	s := bufio.NewScanner(patch)
+	s.Buffer(nil, 1<<20)
+	if !s.Scan() {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		return nil, ErrNotMailPatch
+	}
+	fields := strings.Fields(s.Text())
+	if len(fields) < 2 || fields[0] != "From" {
+		return nil, fmt.Errorf("first line %q: %w", s.Text(), ErrNotMailPatch)
+	}
+	m := &MailPatch{Commit: fields[1]}
+
+	// Header lines until the empty line before the message; lines starting with
+	// whitespace continue the header before them
+	var headers []string
+	for s.Scan() && s.Text() != "" {
+		line := s.Text()
+		if k := len(headers) - 1; k >= 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			headers[k] += " " + strings.TrimSpace(line)
+			continue
+		}
+		headers = append(headers, line)
+	}
+	for _, h := range headers {
+		k := strings.Index(h, ":")
+		if k < 0 {
+			continue
+		}
+		value := strings.TrimSpace(h[k+1:])
+		switch strings.ToLower(h[:k]) {
+		case "from":
+			m.From = value
+		case "date":
+			m.Date = value
+		case "subject":
+			m.Subject = value
+		case "message-id":
+			m.MessageID = value
+		}
+	}
+	if m.Subject == "" {
+		return nil, fmt.Errorf("no Subject header: %w", ErrNotMailPatch)
+	}
+
+	var body []string
+	for s.Scan() {
+		line := s.Text()
+		if line == "---" || strings.HasPrefix(line, "diff --git ") || strings.HasPrefix(line, "--- ") {
+			break
+		}
+		body = append(body, line)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	m.Body = strings.TrimSpace(strings.Join(body, "\n"))
+	return m, nil
+}
+
+// WriteFormatPatch writes patch to w as a mail of git format-patch with the header
+// and the commit message of m, followed by the diffstat of patch, so that a result
+// such as the interdiff of two versions of m can be sent as a reply to them. The
+// mail replies to m if m has a Message-Id header.
+func (m *MailPatch) WriteFormatPatch(w io.Writer, patch string) error {
+	commit := m.Commit
+	if commit == "" {
+		commit = strings.Repeat("0", 40)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From %s %s\n", commit, mboxFromDate)
+	if m.From != "" {
+		fmt.Fprintf(&b, "From: %s\n", m.From)
+	}
+	if m.Date != "" {
+		fmt.Fprintf(&b, "Date: %s\n", m.Date)
+	}
+	fmt.Fprintf(&b, "Subject: %s\n", m.Subject)
+	if m.MessageID != "" {
+		fmt.Fprintf(&b, "In-Reply-To: %s\nReferences: %s\n", m.MessageID, m.MessageID)
+	}
+	b.WriteString("\n")
+	if m.Body != "" {
+		b.WriteString(m.Body + "\n")
+	}
+	b.WriteString("---\n")
+
+	stats, err := Stat(strings.NewReader(patch))
+	if err != nil {
+		return fmt.Errorf("counting changed lines: %w", err)
+	}
+	if len(stats) > 0 {
+		b.WriteString(FormatStat(stats) + "\n")
+	}
+	b.WriteString(patch)
+	if patch != "" && !strings.HasSuffix(patch, "\n") {
+		b.WriteString("\n")
+	}
+	b.WriteString("-- \ngo-patchutils\n")
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// ErrNotMailPatch indicates that a patch isn't a mail made by git format-patch.
+var ErrNotMailPatch = errors.New("not a format-patch mail")
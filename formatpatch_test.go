@@ -0,0 +1,85 @@
+package patchutils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mailPatchV1 = "From 1234567890abcdef1234567890abcdef12345678 Mon Sep 17 00:00:00 2001\n" +
+	"From: A U Thor <author@example.com>\n" +
+	"Date: Fri, 1 Oct 2021 10:00:00 +0200\n" +
+	"Subject: [PATCH] Change a line of a.txt\n" +
+	" and fold the subject\n" +
+	"Message-Id: <v1@example.com>\n" +
+	"\n" +
+	"Explain the change.\n" +
+	"---\n" +
+	" a.txt | 2 +-\n" +
+	" 1 file changed, 1 insertion(+), 1 deletion(-)\n" +
+	"\n" +
+	"diff --git a/a.txt b/a.txt\n" +
+	"--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n-a\n+b\n c\n" +
+	"-- \n2.30.0\n"
+
+func TestParseMailPatch(t *testing.T) {
+	m, err := ParseMailPatch(strings.NewReader(mailPatchV1))
+	if err != nil {
+		t.Fatalf("ParseMailPatch: got error %v; want error nil", err)
+	}
+	want := &MailPatch{
+		Commit:    "1234567890abcdef1234567890abcdef12345678",
+		From:      "A U Thor <author@example.com>",
+		Date:      "Fri, 1 Oct 2021 10:00:00 +0200",
+		Subject:   "[PATCH] Change a line of a.txt and fold the subject",
+		MessageID: "<v1@example.com>",
+		Body:      "Explain the change.",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ParseMailPatch: got %+v; want %+v", m, want)
+	}
+
+	if _, err := ParseMailPatch(strings.NewReader("--- a/a.txt\n+++ b/a.txt\n")); !errors.Is(err, ErrNotMailPatch) {
+		t.Errorf("ParseMailPatch of a plain diff: got error %v; want error %v", err, ErrNotMailPatch)
+	}
+}
+
+func TestWriteFormatPatch(t *testing.T) {
+	m, err := ParseMailPatch(strings.NewReader(mailPatchV1))
+	if err != nil {
+		t.Fatalf("ParseMailPatch: %v", err)
+	}
+	var b strings.Builder
+	if err := m.WriteFormatPatch(&b, "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-b\n+B\n"); err != nil {
+		t.Fatalf("WriteFormatPatch: got error %v; want error nil", err)
+	}
+	want := "From 1234567890abcdef1234567890abcdef12345678 Mon Sep 17 00:00:00 2001\n" +
+		"From: A U Thor <author@example.com>\n" +
+		"Date: Fri, 1 Oct 2021 10:00:00 +0200\n" +
+		"Subject: [PATCH] Change a line of a.txt and fold the subject\n" +
+		"In-Reply-To: <v1@example.com>\n" +
+		"References: <v1@example.com>\n" +
+		"\n" +
+		"Explain the change.\n" +
+		"---\n" +
+		" b/a.txt | 2 +-\n" +
+		" 1 file changed, 1 insertion(+), 1 deletion(-)\n" +
+		"\n" +
+		"--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-b\n+B\n" +
+		"-- \ngo-patchutils\n"
+	if b.String() != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", b.String(), want)
+	}
+}
+
+func TestInterDiffMailPatches(t *testing.T) {
+	newPatch := strings.Replace(mailPatchV1, "+b\n", "+B\n", 1)
+	result, err := InterDiff(strings.NewReader(mailPatchV1), strings.NewReader(newPatch))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	if !strings.Contains(result, "-b\n+B\n") {
+		t.Errorf("InterDiff of mails: got %q; want the change of b to B", result)
+	}
+}
@@ -0,0 +1,68 @@
+package gitpatch
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Signature identifies the author of a commit.
+type Signature struct {
+	Name  string
+	Email string
+	// When is the author date. The current time is used if it is zero.
+	When time.Time
+}
+
+// Commit applies patch to the tree of HEAD in the repository at repoPath, commits
+// the result with message msg, authored and committed by author, and checks the new
+// commit out, updating the index and the worktree like git checkout does. Changes
+// staged before are kept in the index, but aren't committed. It returns the hash of
+// the new commit. Commit hooks aren't run.
+// The patch is applied to a temporary index with ApplyToTree, so if it doesn't apply
+// cleanly, or files it changes have local changes, the repository is left unchanged.
+func Commit(repoPath string, patch io.Reader, msg string, author Signature) (string, error) {
+	out, err := run(repoPath, nil, "rev-parse", "--verify", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("reading HEAD: %w", err)
+	}
+	head := strings.TrimSpace(string(out))
+
+	tree, err := ApplyToTree(repoPath, head, patch)
+	if err != nil {
+		return "", err
+	}
+
+	env := []string{"GIT_AUTHOR_NAME=" + author.Name, "GIT_AUTHOR_EMAIL=" + author.Email,
+		"GIT_COMMITTER_NAME=" + author.Name, "GIT_COMMITTER_EMAIL=" + author.Email}
+	if !author.When.IsZero() {
+		env = append(env, "GIT_AUTHOR_DATE="+author.When.Format(time.RFC3339))
+	}
+	out, err = runEnv(repoPath, env, strings.NewReader(msg), "commit-tree", tree, "-p", head)
+	if err != nil {
+		return "", fmt.Errorf("committing patch: %w", err)
+	}
+	commit := strings.TrimSpace(string(out))
+
+	// Checking out fails without changing anything if files have local changes
+	if _, err := run(repoPath, nil, "read-tree", "-m", "-u", head, commit); err != nil {
+		return "", fmt.Errorf("checking out new commit: %w", err)
+	}
+	// HEAD is only moved if it is still at head
+	if _, err := run(repoPath, nil, "update-ref", "-m", "commit: "+subject(msg), "HEAD", commit, head); err != nil {
+		if _, undoErr := run(repoPath, nil, "read-tree", "-m", "-u", commit, head); undoErr != nil {
+			return "", fmt.Errorf("updating HEAD: %w (restoring worktree: %v)", err, undoErr)
+		}
+		return "", fmt.Errorf("updating HEAD: %w", err)
+	}
+	return commit, nil
+}
+
+// subject returns the first line of commit message msg.
+func subject(msg string) string {
+	if k := strings.IndexByte(msg, '\n'); k >= 0 {
+		return msg[:k]
+	}
+	return msg
+}
@@ -0,0 +1,144 @@
+package gitpatch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommit(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"file.txt": "one\ntwo\nthree\n"})
+	defer os.RemoveAll(repo)
+
+	patch := `diff --git a/file.txt b/file.txt
+--- a/file.txt
++++ b/file.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+`
+	author := Signature{Name: "Jane Doe", Email: "jane@example.com",
+		When: time.Date(2020, 8, 26, 1, 17, 35, 0, time.UTC)}
+	hash, err := Commit(repo, strings.NewReader(patch), "Capitalize two", author)
+	if err != nil {
+		t.Fatalf("Commit: got error %v; want error nil", err)
+	}
+
+	out, err := run(repo, nil, "log", "-1", "--format=%H%n%an <%ae>%n%at%n%s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := hash + "\nJane Doe <jane@example.com>\n1598404655\nCapitalize two\n"
+	if string(out) != want {
+		t.Errorf("Commit mismatch.\nGot:\n%s\nWant:\n%s\n", out, want)
+	}
+
+	out, err = run(repo, nil, "show", "HEAD:file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\nTWO\nthree\n"; string(out) != want {
+		t.Errorf("File contents mismatch.\nGot:\n%s\nWant:\n%s\n", out, want)
+	}
+}
+
+func TestCommitConflict(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"file.txt": "one\ntwo\nthree\n"})
+	defer os.RemoveAll(repo)
+
+	head, err := run(repo, nil, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := "--- a/file.txt\n+++ b/file.txt\n@@ -1,2 +1,2 @@\n one\n-five\n+FIVE\n"
+	if _, err := Commit(repo, strings.NewReader(patch), "msg", Signature{Name: "A", Email: "a@example.com"}); err == nil {
+		t.Errorf("Commit: got error nil; want error non-nil")
+	}
+
+	after, err := run(repo, nil, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(head) {
+		t.Errorf("HEAD moved from %s to %s", head, after)
+	}
+}
+
+const capitalizePatch = "--- a/file.txt\n+++ b/file.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n"
+
+func TestCommitCheckout(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"file.txt": "one\ntwo\nthree\n", "other.txt": "other\n"})
+	defer os.RemoveAll(repo)
+
+	// A staged change of another file is kept, but not committed
+	if err := ioutil.WriteFile(filepath.Join(repo, "other.txt"), []byte("staged\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := run(repo, nil, "add", "other.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Commit(repo, strings.NewReader(capitalizePatch), "msg", Signature{Name: "A", Email: "a@example.com"}); err != nil {
+		t.Fatalf("Commit: got error %v; want error nil", err)
+	}
+
+	out, err := run(repo, nil, "show", "HEAD:other.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "other\n"; string(out) != want {
+		t.Errorf("Committed contents mismatch.\nGot:\n%s\nWant:\n%s\n", out, want)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(repo, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "one\nTWO\nthree\n"; string(got) != want {
+		t.Errorf("Worktree contents mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+	out, err = run(repo, nil, "status", "--porcelain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "M  other.txt\n"; string(out) != want {
+		t.Errorf("Status mismatch.\nGot:\n%s\nWant:\n%s\n", out, want)
+	}
+}
+
+func TestCommitLocalChanges(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"file.txt": "one\ntwo\nthree\n"})
+	defer os.RemoveAll(repo)
+
+	head, err := run(repo, nil, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := "one\ntwo\nthree\nfour\n"
+	if err := ioutil.WriteFile(filepath.Join(repo, "file.txt"), []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Commit(repo, strings.NewReader(capitalizePatch), "msg", Signature{Name: "A", Email: "a@example.com"}); err == nil {
+		t.Errorf("Commit: got error nil; want error non-nil")
+	}
+
+	after, err := run(repo, nil, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(head) {
+		t.Errorf("HEAD moved from %s to %s", head, after)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(repo, "file.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != local {
+		t.Errorf("Worktree contents mismatch.\nGot:\n%s\nWant:\n%s\n", got, local)
+	}
+}
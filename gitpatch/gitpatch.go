@@ -0,0 +1,47 @@
+// Package gitpatch connects patchutils to git repositories.
+// It drives the git command-line tool, which has to be available in PATH.
+package gitpatch
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// run executes git with args in the repository at repoPath and returns its standard output.
+func run(repoPath string, stdin io.Reader, args ...string) ([]byte, error) {
+	return runEnv(repoPath, nil, stdin, args...)
+}
+
+// runEnv is like run, with env added to the environment of git.
+func runEnv(repoPath string, env []string, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"-C", repoPath}, args...)...)
+	if env != nil {
+		cmd.Env = append(os.Environ(), env...)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err,
+			strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// checkRev returns an error if git would take rev, a revision given by the
+// caller, for an option.
+func checkRev(rev string) error {
+	if strings.HasPrefix(rev, "-") {
+		return fmt.Errorf("%q: %w", rev, ErrBadRevision)
+	}
+	return nil
+}
+
+// ErrBadRevision indicates that a revision starts with "-", like options of git.
+var ErrBadRevision = errors.New("revision starts with \"-\"")
@@ -0,0 +1,86 @@
+package gitpatch
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/go-patchutils"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// RangeDiff returns the unified diff between the trees of revisions from and to
+// in the repository at repoPath. File names in the result have no a/ and b/ prefixes.
+// It fails with ErrBadRevision if from or to starts with "-".
+func RangeDiff(repoPath, from, to string) (string, error) {
+	for _, rev := range []string{from, to} {
+		if err := checkRev(rev); err != nil {
+			return "", fmt.Errorf("diff %s..%s: %w", from, to, err)
+		}
+	}
+	out, err := run(repoPath, nil, "diff", "--no-color", "--no-ext-diff", "--no-renames",
+		"--no-prefix", from, to, "--")
+	if err != nil {
+		return "", fmt.Errorf("diff %s..%s: %w", from, to, err)
+	}
+	return string(out), nil
+}
+
+// LandedDiff computes how patch changed between its submission and landing
+// as the commits from..to in the repository at repoPath.
+// It is InterDiff of patch and the diff of the range, with files of both sides
+// paired by their path regardless of git's a/ and b/ prefixes.
+func LandedDiff(repoPath string, patch io.Reader, from, to string) (string, error) {
+	pending, err := patchutils.ParsePatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+
+	rangeDiff, err := RangeDiff(repoPath, from, to)
+	if err != nil {
+		return "", err
+	}
+	landed, err := patchutils.ParsePatch(strings.NewReader(rangeDiff))
+	if err != nil {
+		return "", fmt.Errorf("parsing diff of %s..%s: %w", from, to, err)
+	}
+
+	pendingContent, err := pairableDiff(pending)
+	if err != nil {
+		return "", fmt.Errorf("printing patch: %w", err)
+	}
+	landedContent, err := pairableDiff(landed)
+	if err != nil {
+		return "", fmt.Errorf("printing diff of %s..%s: %w", from, to, err)
+	}
+
+	result, err := patchutils.InterDiff(bytes.NewReader(pendingContent), bytes.NewReader(landedContent))
+	if err != nil {
+		return "", fmt.Errorf("interdiff of patch and %s..%s: %w", from, to, err)
+	}
+	return result, nil
+}
+
+// pairableDiff prints fileDiffs without git prefixes and sorted by name,
+// the order InterDiff pairs files in.
+func pairableDiff(fileDiffs []*diff.FileDiff) ([]byte, error) {
+	for _, fd := range fileDiffs {
+		if hasGitPrefixes(fd) {
+			fd.OrigName = strings.TrimPrefix(fd.OrigName, "a/")
+			fd.NewName = strings.TrimPrefix(fd.NewName, "b/")
+		}
+	}
+	sort.SliceStable(fileDiffs, func(i, j int) bool {
+		return fileDiffs[i].OrigName < fileDiffs[j].OrigName
+	})
+	return diff.PrintMultiFileDiff(fileDiffs)
+}
+
+// hasGitPrefixes reports whether names of fd carry git's a/ and b/ prefixes.
+func hasGitPrefixes(fd *diff.FileDiff) bool {
+	origOK := fd.OrigName == "/dev/null" || strings.HasPrefix(fd.OrigName, "a/")
+	newOK := fd.NewName == "/dev/null" || strings.HasPrefix(fd.NewName, "b/")
+	return origOK && newOK && fd.OrigName != fd.NewName
+}
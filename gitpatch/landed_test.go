@@ -0,0 +1,101 @@
+package gitpatch
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a repository with a commit per element of commits,
+// each mapping file names to their content. It returns the repository path.
+func newTestRepo(t *testing.T, commits ...map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "gitpatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	git := func(args ...string) {
+		t.Helper()
+		args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com",
+			"-c", "commit.gpgsign=false"}, args...)
+		if _, err := run(dir, nil, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	git("init", "-q")
+	for k, files := range commits {
+		for name, content := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		git("add", "-A")
+		git("commit", "-q", "-m", fmt.Sprintf("commit %d", k))
+	}
+	return dir
+}
+
+func TestLandedDiff(t *testing.T) {
+	repo := newTestRepo(t,
+		map[string]string{"file.txt": "one\ntwo\nthree\nfour\n"},
+		map[string]string{"file.txt": "one\ntwo\nthree and a half\nfour\n"},
+	)
+	defer os.RemoveAll(repo)
+
+	pending := `diff --git a/file.txt b/file.txt
+--- a/file.txt
++++ b/file.txt
+@@ -1,4 +1,4 @@
+ one
+ two
+-three
++three and more
+ four
+`
+	want := `diff --git a/file.txt b/file.txt
+--- a/file.txt
++++ b/file.txt
+@@ -1,4 +1,4 @@
+ one
+ two
+-three and more
++three and a half
+ four
+`
+
+	result, err := LandedDiff(repo, strings.NewReader(pending), "HEAD~1", "HEAD")
+	if err != nil {
+		t.Fatalf("LandedDiff: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestRangeDiffOption(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"file.txt": "one\n"})
+	defer os.RemoveAll(repo)
+
+	output := filepath.Join(repo, "output")
+	if _, err := RangeDiff(repo, "--output="+output, "HEAD"); !errors.Is(err, ErrBadRevision) {
+		t.Errorf("RangeDiff: got error %v; want error %v", err, ErrBadRevision)
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("RangeDiff wrote %q", output)
+	}
+}
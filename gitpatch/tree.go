@@ -0,0 +1,41 @@
+package gitpatch
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ApplyToTree applies patch to the tree of treeish in the repository at repoPath
+// and returns the hash of the resulting tree. Base contents are read from the object
+// store, checked against blob hashes of index lines, and patched files are written
+// to it as new blobs. Neither the worktree nor the index of the repository are used,
+// so it works in bare repositories too. It fails with ErrBadRevision if treeish
+// starts with "-".
+func ApplyToTree(repoPath, treeish string, patch io.Reader) (string, error) {
+	if err := checkRev(treeish); err != nil {
+		return "", fmt.Errorf("reading tree %s: %w", treeish, err)
+	}
+
+	dir, err := ioutil.TempDir("", "gitpatch")
+	if err != nil {
+		return "", fmt.Errorf("creating temporary index: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(dir, "index")}
+
+	if _, err := runEnv(repoPath, env, nil, "read-tree", treeish); err != nil {
+		return "", fmt.Errorf("reading tree %s: %w", treeish, err)
+	}
+	if _, err := runEnv(repoPath, env, patch, "apply", "--cached", "-"); err != nil {
+		return "", fmt.Errorf("applying patch: %w", err)
+	}
+	out, err := runEnv(repoPath, env, nil, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("writing tree: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,69 @@
+package gitpatch
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApplyToTree(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"file.txt": "one\ntwo\nthree\n", "dir/other.txt": "other\n"})
+	defer os.RemoveAll(repo)
+
+	bare := repo + ".git"
+	if _, err := run(repo, nil, "clone", "-q", "--bare", repo, bare); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bare)
+
+	patch := `diff --git a/file.txt b/file.txt
+index 4cb29ea..ddc897f 100644
+--- a/file.txt
++++ b/file.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+diff --git a/dir/new.txt b/dir/new.txt
+new file mode 100644
+--- /dev/null
++++ b/dir/new.txt
+@@ -0,0 +1 @@
++new
+`
+	tree, err := ApplyToTree(bare, "HEAD", strings.NewReader(patch))
+	if err != nil {
+		t.Fatalf("ApplyToTree: got error %v; want error nil", err)
+	}
+
+	for name, want := range map[string]string{
+		"file.txt":      "one\nTWO\nthree\n",
+		"dir/other.txt": "other\n",
+		"dir/new.txt":   "new\n",
+	} {
+		out, err := run(bare, nil, "cat-file", "blob", tree+":"+name)
+		if err != nil {
+			t.Errorf("Reading %q: %v", name, err)
+			continue
+		}
+		if string(out) != want {
+			t.Errorf("File contents mismatch for %q.\nGot:\n%s\nWant:\n%s\n", name, out, want)
+		}
+	}
+
+	// The patch doesn't apply twice
+	if _, err := ApplyToTree(bare, tree, strings.NewReader(patch)); err == nil {
+		t.Errorf("ApplyToTree on patched tree: got error nil; want error non-nil")
+	}
+}
+
+func TestApplyToTreeOption(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"file.txt": "one\n"})
+	defer os.RemoveAll(repo)
+
+	if _, err := ApplyToTree(repo, "--index-output=index", strings.NewReader("")); !errors.Is(err, ErrBadRevision) {
+		t.Errorf("ApplyToTree: got error %v; want error %v", err, ErrBadRevision)
+	}
+}
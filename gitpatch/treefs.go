@@ -0,0 +1,267 @@
+//go:build go1.16
+// +build go1.16
+
+package gitpatch
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-patchutils"
+)
+
+// MixedModeGit is like patchutils.MixedModePath for the trees of revisions oldRev
+// and newRev of the repository at repoPath instead of checked-out directories, so
+// that tags can be compared without extracting worktrees. Names in the diffs are
+// relative to the top of the repository.
+func MixedModeGit(repoPath, oldRev, newRev string, oldDiff, newDiff io.Reader) (string, error) {
+	return MixedModeGitWithOptions(repoPath, oldRev, newRev, oldDiff, newDiff, patchutils.MixedModeOptions{})
+}
+
+// MixedModeGitWithOptions is like MixedModeGit, but configured by opts.
+func MixedModeGitWithOptions(repoPath, oldRev, newRev string, oldDiff, newDiff io.Reader,
+	opts patchutils.MixedModeOptions) (string, error) {
+	oldTree, err := OpenTree(repoPath, oldRev)
+	if err != nil {
+		return "", err
+	}
+	defer oldTree.Close()
+	newTree, err := OpenTree(repoPath, newRev)
+	if err != nil {
+		return "", err
+	}
+	defer newTree.Close()
+	return patchutils.MixedModeFSWithOptions(oldTree, newTree, oldDiff, newDiff, opts)
+}
+
+// TreeFS is the tree of a revision of a git repository as a filesystem. It is
+// read from the object store, so it works in bare repositories too. Symbolic links
+// are files holding their targets, as in the object store, and submodules are
+// left out.
+type TreeFS struct {
+	entries map[string]*treeEntry
+
+	// mu guards the git cat-file process contents of files are read by.
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+// OpenTree returns the tree of revision rev of the repository at repoPath. It has
+// to be closed to stop the git process reading contents of files. It fails with
+// ErrBadRevision if rev starts with "-".
+func OpenTree(repoPath, rev string) (*TreeFS, error) {
+	if err := checkRev(rev); err != nil {
+		return nil, fmt.Errorf("reading tree %s: %w", rev, err)
+	}
+	out, err := run(repoPath, nil, "ls-tree", "-r", "-t", "-l", "-z", "--full-tree", rev)
+	if err != nil {
+		return nil, fmt.Errorf("reading tree %s: %w", rev, err)
+	}
+	t := &TreeFS{entries: map[string]*treeEntry{".": {path: ".", name: ".", mode: fs.ModeDir | 0755}}}
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		if line == "" {
+			continue
+		}
+		e, err := parseTreeEntry(line)
+		if err != nil {
+			return nil, fmt.Errorf("reading tree %s: %w", rev, err)
+		}
+		if e == nil {
+			continue
+		}
+		t.entries[e.path] = e
+	}
+	for name, e := range t.entries {
+		if name == "." {
+			continue
+		}
+		parent, ok := t.entries[path.Dir(name)]
+		if !ok {
+			return nil, fmt.Errorf("reading tree %s: %q has no parent directory", rev, name)
+		}
+		parent.children = append(parent.children, e)
+	}
+	for _, e := range t.entries {
+		sort.Slice(e.children, func(i, j int) bool { return e.children[i].name < e.children[j].name })
+	}
+
+	t.cmd = exec.Command("git", "-C", repoPath, "cat-file", "--batch")
+	if t.stdin, err = t.cmd.StdinPipe(); err != nil {
+		return nil, fmt.Errorf("reading tree %s: %w", rev, err)
+	}
+	stdout, err := t.cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("reading tree %s: %w", rev, err)
+	}
+	t.stdout = bufio.NewReader(stdout)
+	if err := t.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("reading tree %s: %w", rev, err)
+	}
+	return t, nil
+}
+
+// parseTreeEntry parses a line of git ls-tree -l, "<mode> <type> <object> <size>\t<path>".
+// It returns nil for submodules.
+func parseTreeEntry(line string) (*treeEntry, error) {
+	tab := strings.IndexByte(line, '\t')
+	if tab < 0 {
+		return nil, fmt.Errorf("%w: %q", errBadTreeEntry, line)
+	}
+	fields := strings.Fields(line[:tab])
+	if len(fields) != 4 {
+		return nil, fmt.Errorf("%w: %q", errBadTreeEntry, line)
+	}
+	e := &treeEntry{path: line[tab+1:], hash: fields[2]}
+	e.name = path.Base(e.path)
+	switch fields[1] {
+	case "tree":
+		e.mode = fs.ModeDir | 0755
+		return e, nil
+	case "blob":
+	default:
+		return nil, nil
+	}
+
+	switch fields[0] {
+	case "100755":
+		e.mode = 0755
+	case "120000":
+		e.mode = fs.ModeSymlink | 0777
+	default:
+		e.mode = 0644
+	}
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", errBadTreeEntry, line)
+	}
+	e.size = size
+	return e, nil
+}
+
+// Open opens the file or directory called name.
+func (t *TreeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	e, ok := t.entries[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if e.IsDir() {
+		return &treeDir{entry: e}, nil
+	}
+	data, err := t.readBlob(e.hash)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &treeFile{Reader: bytes.NewReader(data), entry: e}, nil
+}
+
+// readBlob returns the contents of the blob hash.
+func (t *TreeFS) readBlob(hash string) ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, err := fmt.Fprintln(t.stdin, hash); err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", hash, err)
+	}
+	header, err := t.stdout.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", hash, err)
+	}
+	// The header is "<object> <type> <size>", or "<object> missing"
+	fields := strings.Fields(header)
+	if len(fields) != 3 || fields[1] != "blob" {
+		return nil, fmt.Errorf("reading blob %s: unexpected object %q", hash, strings.TrimSpace(header))
+	}
+	size, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: unexpected object %q", hash, strings.TrimSpace(header))
+	}
+	// The contents are followed by a newline
+	data := make([]byte, size+1)
+	if _, err := io.ReadFull(t.stdout, data); err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", hash, err)
+	}
+	return data[:size], nil
+}
+
+// Close stops the git process reading contents of files.
+func (t *TreeFS) Close() error {
+	if err := t.stdin.Close(); err != nil {
+		return err
+	}
+	return t.cmd.Wait()
+}
+
+// treeEntry is a file or directory of a TreeFS, and both its fs.FileInfo and its
+// fs.DirEntry.
+type treeEntry struct {
+	path     string
+	name     string
+	mode     fs.FileMode
+	hash     string
+	size     int64
+	children []*treeEntry
+}
+
+func (e *treeEntry) Name() string               { return e.name }
+func (e *treeEntry) Size() int64                { return e.size }
+func (e *treeEntry) Mode() fs.FileMode          { return e.mode }
+func (e *treeEntry) ModTime() time.Time         { return time.Time{} }
+func (e *treeEntry) IsDir() bool                { return e.mode.IsDir() }
+func (e *treeEntry) Sys() interface{}           { return nil }
+func (e *treeEntry) Type() fs.FileMode          { return e.mode.Type() }
+func (e *treeEntry) Info() (fs.FileInfo, error) { return e, nil }
+
+type treeFile struct {
+	*bytes.Reader
+	entry *treeEntry
+}
+
+func (f *treeFile) Stat() (fs.FileInfo, error) { return f.entry, nil }
+func (f *treeFile) Close() error               { return nil }
+
+type treeDir struct {
+	entry  *treeEntry
+	offset int
+}
+
+func (d *treeDir) Stat() (fs.FileInfo, error) { return d.entry, nil }
+func (d *treeDir) Close() error               { return nil }
+
+func (d *treeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.entry.path, Err: errors.New("is a directory")}
+}
+
+func (d *treeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entry.children[d.offset:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	d.offset += len(rest)
+	entries := make([]fs.DirEntry, len(rest))
+	for i, e := range rest {
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// errBadTreeEntry indicates that git ls-tree printed a line which can't be parsed.
+var errBadTreeEntry = errors.New("malformed tree entry")
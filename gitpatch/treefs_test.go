@@ -0,0 +1,105 @@
+//go:build go1.16
+// +build go1.16
+
+package gitpatch
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-patchutils"
+)
+
+func TestMixedModeGit(t *testing.T) {
+	repo := newTestRepo(t,
+		map[string]string{"a.txt": "one\ntwo\nthree\n", "sub/b.txt": "x\ny\n"},
+		map[string]string{"a.txt": "zero\none\ntwo\nthree\n", "sub/c.txt": "c\n"},
+	)
+	defer os.RemoveAll(repo)
+
+	oldDiff := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+`
+	newDiff := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,4 +1,4 @@
+ zero
+ one
+-two
++TWO
+ three
+diff --git a/sub/b.txt b/sub/b.txt
+--- a/sub/b.txt
++++ b/sub/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+`
+	want := `diff --git a/a.txt b/a.txt
+--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,3 @@
++zero
+ one
+ TWO
+diff --git a/sub/b.txt b/sub/b.txt
+--- a/sub/b.txt
++++ b/sub/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+Only in sub: c.txt
+`
+
+	result, err := MixedModeGitWithOptions(repo, "HEAD~1", "HEAD",
+		strings.NewReader(oldDiff), strings.NewReader(newDiff), patchutils.MixedModeOptions{StripLevel: 1})
+	if err != nil {
+		t.Fatalf("MixedModeGit: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestOpenTree(t *testing.T) {
+	repo := newTestRepo(t, map[string]string{"a.txt": "a\n", "dir/b.txt": "b\n", "dir/sub/c.go": "package c\n"})
+	defer os.RemoveAll(repo)
+
+	tree, err := OpenTree(repo, "HEAD")
+	if err != nil {
+		t.Fatalf("OpenTree: got error %v; want error nil", err)
+	}
+	defer tree.Close()
+
+	if err := fstest.TestFS(tree, "a.txt", "dir/b.txt", "dir/sub/c.go"); err != nil {
+		t.Error(err)
+	}
+	f, err := tree.Open("dir/sub/c.go")
+	if err != nil {
+		t.Fatalf("Open: got error %v; want error nil", err)
+	}
+	defer f.Close()
+	if got, err := ioutil.ReadAll(f); err != nil || string(got) != "package c\n" {
+		t.Errorf("Contents of dir/sub/c.go: got %q, error %v; want %q", got, err, "package c\n")
+	}
+
+	if _, err := OpenTree(repo, "no-such-revision"); err == nil {
+		t.Errorf("OpenTree of unknown revision: got error nil; want error non-nil")
+	}
+	if _, err := OpenTree(repo, "--abbrev=4"); !errors.Is(err, ErrBadRevision) {
+		t.Errorf("OpenTree of option: got error %v; want error %v", err, ErrBadRevision)
+	}
+}
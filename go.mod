@@ -1,11 +1,10 @@
 module github.com/google/go-patchutils
 
-go 1.14
+go 1.16
 
 require (
 	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b
 	github.com/google/subcommands v1.2.0
 	github.com/kylelemons/godebug v1.1.0
 	github.com/sourcegraph/go-diff v0.6.0
-	golang.org/x/sync v0.0.0-20201020160332-67f06af15bc9
 )
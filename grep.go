@@ -0,0 +1,69 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// GrepDiff returns the names of files of patch which have an added or deleted line
+// matching re, in the order they appear in patch, like grepdiff.
+// The new name of a file is returned, or the old one if the file is deleted.
+func GrepDiff(patch io.Reader, re *regexp.Regexp) ([]string, error) {
+	fileDiffs, err := GrepFileDiffs(patch, re)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, fd := range fileDiffs {
+		name := fd.NewName
+		if name == "" || isDevNull(name) {
+			name = fd.OrigName
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// GrepFileDiffs is like GrepDiff, but returns the matching FileDiffs themselves,
+// so they can be printed with diff.PrintMultiFileDiff or processed further.
+func GrepFileDiffs(patch io.Reader, re *regexp.Regexp) ([]*diff.FileDiff, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return nil, fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	var matching []*diff.FileDiff
+	for _, fd := range fileDiffs {
+		ok, err := fileDiffMatches(fd, re)
+		if err != nil {
+			return nil, fmt.Errorf("grepping %q: %w", fd.OrigName, err)
+		}
+		if ok {
+			matching = append(matching, fd)
+		}
+	}
+	return matching, nil
+}
+
+// fileDiffMatches reports whether an added or deleted line of fd matches re.
+func fileDiffMatches(fd *diff.FileDiff, re *regexp.Regexp) (bool, error) {
+	for i, h := range fd.Hunks {
+		lines, err := HunkLines(h)
+		if err != nil {
+			return false, fmt.Errorf("hunk %d: %w", i, err)
+		}
+		for _, line := range lines {
+			if line.Op != OpContext && re.MatchString(line.Text) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,78 @@
+package patchutils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const grepTestPatch = `--- a/transport.go
++++ b/transport.go
+@@ -1,3 +1,3 @@
+ func roundTrip() {
+-	dial()
++	dialContext()
+ }
+--- a/client.go
++++ b/client.go
+@@ -1,2 +1,2 @@
+ // dialContext is mentioned in context only
+-old
++new
+--- a/conn.go
++++ /dev/null
+@@ -1 +0,0 @@
+-func dial() {}
+Only in a: docs
+`
+
+var grepDiffTests = []struct {
+	name    string
+	pattern string
+	result  []string
+}{
+	{
+		name:    "added and deleted lines",
+		pattern: `\bdial\(`,
+		result:  []string{"b/transport.go", "a/conn.go"},
+	},
+	{
+		name:    "context lines are ignored",
+		pattern: `dialContext is mentioned`,
+		result:  nil,
+	},
+	{
+		name:    "added line",
+		pattern: `^new$`,
+		result:  []string{"b/client.go"},
+	},
+}
+
+func TestGrepDiff(t *testing.T) {
+	for _, tt := range grepDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := GrepDiff(strings.NewReader(grepTestPatch), regexp.MustCompile(tt.pattern))
+			if err != nil {
+				t.Fatalf("GrepDiff: got error %v; want error nil", err)
+			}
+			if strings.Join(currentResult, ",") != strings.Join(tt.result, ",") {
+				t.Errorf("Result mismatch.\nGot:\n%v\nWant:\n%v\n", currentResult, tt.result)
+			}
+		})
+	}
+}
+
+func TestGrepFileDiffs(t *testing.T) {
+	fileDiffs, err := GrepFileDiffs(strings.NewReader(grepTestPatch), regexp.MustCompile(`dialContext\(`))
+	if err != nil {
+		t.Fatalf("GrepFileDiffs: got error %v; want error nil", err)
+	}
+	if len(fileDiffs) != 1 || fileDiffs[0].OrigName != "a/transport.go" || len(fileDiffs[0].Hunks) != 1 {
+		t.Errorf("GrepFileDiffs: got %+v; want the FileDiff of a/transport.go", fileDiffs)
+	}
+
+	if _, err := GrepFileDiffs(strings.NewReader(""), regexp.MustCompile(`x`)); !errors.Is(err, ErrEmptyDiffFile) {
+		t.Errorf("GrepFileDiffs: got error %v; want error %v", err, ErrEmptyDiffFile)
+	}
+}
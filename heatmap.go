@@ -0,0 +1,321 @@
+package patchutils
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-patchutils/schema"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// DefaultHeatMapRegionLines is the number of lines of the regions of files
+// PatchHeatMap counts hunks in.
+const DefaultHeatMapRegionLines = 50
+
+// SeriesPatch is a patch of a series, applied on top of the previous ones.
+type SeriesPatch struct {
+	// Name identifies the patch in reports, such as the name of its file.
+	Name  string
+	Patch io.Reader
+}
+
+// HeatMapOptions configures PatchHeatMap.
+type HeatMapOptions struct {
+	// Apply configures how hunks are applied, usually with MaxOffset and Fuzz set,
+	// so that hunks which no longer apply exactly are counted as fuzzed or moved
+	// rather than as conflicts. Its Report function isn't called.
+	Apply ApplyOptions
+	// StripLevel is the number of leading path components removed from file names
+	// in the patches before they are looked up in the target, like patch -p.
+	StripLevel int
+	// RegionLines is the number of lines of the regions hunks are counted in.
+	// 0 stands for DefaultHeatMapRegionLines.
+	RegionLines int
+}
+
+// HeatCounts counts how hunks applied.
+type HeatCounts struct {
+	Hunks int `json:"hunks"`
+	// Conflicts is the number of hunks which didn't apply.
+	Conflicts int `json:"conflicts"`
+	// Fuzzed is the number of hunks which applied with context lines ignored.
+	Fuzzed int `json:"fuzzed"`
+	// Moved is the number of hunks which applied away from the position in their header.
+	Moved int `json:"moved"`
+}
+
+// add counts a hunk applied as described by a.
+func (c *HeatCounts) add(a HunkApplication) {
+	c.Hunks++
+	switch {
+	case a.Err != nil:
+		c.Conflicts++
+	case a.Fuzz > 0:
+		c.Fuzzed++
+	case a.Offset != 0:
+		c.Moved++
+	}
+}
+
+// hotter reports whether c has more conflicts than d, or as many and more fuzzed
+// hunks, or as many of both and more moved hunks.
+func (c HeatCounts) hotter(d HeatCounts) bool {
+	if c.Conflicts != d.Conflicts {
+		return c.Conflicts > d.Conflicts
+	}
+	if c.Fuzzed != d.Fuzzed {
+		return c.Fuzzed > d.Fuzzed
+	}
+	return c.Moved > d.Moved
+}
+
+// HeatFile counts how hunks of a series applied to a file.
+type HeatFile struct {
+	File string `json:"file"`
+	HeatCounts
+}
+
+// HeatRegion counts how hunks of a series applied to a region of a file.
+type HeatRegion struct {
+	File string `json:"file"`
+	// StartLine and EndLine are the first and the last line of the region in the
+	// file as patched by the series up to each hunk.
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+	HeatCounts
+	// Patches lists the names of the patches with hunks which conflicted, fuzzed
+	// or moved in the region, in the order of the series.
+	Patches []string `json:"patches,omitempty"`
+}
+
+// HeatMap tells which files and regions of a target tree hunks of a patch series
+// conflict, fuzz or move in. Files and regions come hottest first: with the most
+// conflicts, then the most fuzzed hunks, then the most moved hunks.
+type HeatMap struct {
+	// SchemaVersion is the version of schema.HeatMap the heat map follows.
+	SchemaVersion int          `json:"schema_version"`
+	Files         []HeatFile   `json:"files"`
+	Regions       []HeatRegion `json:"regions"`
+}
+
+// PatchHeatMap applies series in order to the tree in target directory, hunk by
+// hunk, and counts how hunks applied per file and per region of
+// opts.RegionLines lines. Hunks which don't apply are skipped, like patch(1)
+// rejects them, and later patches apply on top of the others. It shows maintainers
+// of a patch stack which parts of it are the most costly to keep up to date.
+// The target isn't changed.
+func PatchHeatMap(target string, series []SeriesPatch, opts HeatMapOptions) (*HeatMap, error) {
+	regionLines := opts.RegionLines
+	if regionLines <= 0 {
+		regionLines = DefaultHeatMapRegionLines
+	}
+	t := newPatchTree(func(name string) (string, error) {
+		content, err := ioutil.ReadFile(filepath.Join(target, filepath.FromSlash(name)))
+		return string(content), err
+	}, opts.StripLevel, opts.Apply)
+
+	files := make(map[string]*HeatFile)
+	regions := make(map[string]*HeatRegion)
+	count := func(patch, file string, line int, a HunkApplication) {
+		if files[file] == nil {
+			files[file] = &HeatFile{File: file}
+		}
+		files[file].add(a)
+
+		start := 1
+		if line > 1 {
+			start = (line-1)/regionLines*regionLines + 1
+		}
+		key := file + ":" + strconv.Itoa(start)
+		r := regions[key]
+		if r == nil {
+			r = &HeatRegion{File: file, StartLine: start, EndLine: start + regionLines - 1}
+			regions[key] = r
+		}
+		r.add(a)
+		hot := a.Err != nil || a.Fuzz > 0 || a.Offset != 0
+		if hot && (len(r.Patches) == 0 || r.Patches[len(r.Patches)-1] != patch) {
+			r.Patches = append(r.Patches, patch)
+		}
+	}
+
+	for _, p := range series {
+		fileDiffs, err := readPatch(p.Patch)
+		if err != nil {
+			return nil, fmt.Errorf("parsing patch %q: %w", p.Name, err)
+		}
+		for _, fd := range fileDiffs {
+			if err := heatMapFileDiff(t, fd, func(file string, line int, a HunkApplication) {
+				count(p.Name, file, line, a)
+			}); err != nil {
+				return nil, fmt.Errorf("patch %q: %w", p.Name, err)
+			}
+		}
+	}
+
+	m := &HeatMap{SchemaVersion: schema.Version, Files: []HeatFile{}, Regions: []HeatRegion{}}
+	for _, f := range files {
+		m.Files = append(m.Files, *f)
+	}
+	sort.Slice(m.Files, func(i, j int) bool {
+		a, b := m.Files[i], m.Files[j]
+		if a.hotter(b.HeatCounts) || b.hotter(a.HeatCounts) {
+			return a.hotter(b.HeatCounts)
+		}
+		return a.File < b.File
+	})
+	for _, r := range regions {
+		m.Regions = append(m.Regions, *r)
+	}
+	sort.Slice(m.Regions, func(i, j int) bool {
+		a, b := m.Regions[i], m.Regions[j]
+		if a.hotter(b.HeatCounts) || b.hotter(a.HeatCounts) {
+			return a.hotter(b.HeatCounts)
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.StartLine < b.StartLine
+	})
+	return m, nil
+}
+
+// heatMapFileDiff applies the hunks of fd to t one by one, skipping those which
+// don't apply, and calls count for every hunk with the file and the line it
+// applies at, or would apply at if it conflicts.
+func heatMapFileDiff(t *patchTree, fd *diff.FileDiff, count func(file string, line int, a HunkApplication)) error {
+	if fd.NewName == "" {
+		return fmt.Errorf("%q: 'Only in' entries can't be applied", fd.OrigName)
+	}
+	origName, err := t.name(fd.OrigName)
+	if err != nil {
+		return err
+	}
+	newName, err := t.name(fd.NewName)
+	if err != nil {
+		return err
+	}
+	file := origName
+	if isDevNull(origName) {
+		file = newName
+	}
+
+	var current *treeFile
+	var currentErr error
+	if isDevNull(origName) {
+		if current, err = t.lookup(newName); err != nil {
+			return err
+		}
+		if current != nil {
+			currentErr = fmt.Errorf("adding %q: %w", newName, ErrFileExists)
+		}
+		current = &treeFile{mode: extendedMode(fd.Extended)}
+	} else {
+		if current, err = t.lookup(origName); err != nil {
+			return err
+		}
+		if current == nil {
+			currentErr = fmt.Errorf("patching %q: %w", origName, ErrFileNotFound)
+		}
+	}
+	if isBinaryFileDiff(fd) {
+		// Binary changes have no hunks to count
+		return nil
+	}
+
+	content := ""
+	if current != nil {
+		content = current.content
+	}
+	conflicts := false
+	// delta is how many lines hunks applied so far added, which moves the following ones
+	var delta int32
+	for _, h := range fd.Hunks {
+		moved := *h
+		moved.OrigStartLine += delta
+		if currentErr != nil {
+			count(file, int(moved.OrigStartLine), HunkApplication{Err: currentErr})
+			conflicts = true
+			continue
+		}
+		var a HunkApplication
+		opts := t.opts
+		opts.Report = func(r HunkResult) {
+			a.Offset, a.Fuzz = r.Offset, r.Fuzz
+		}
+		result, err := ApplyHunkWithOptions(content, &moved, opts)
+		if err != nil {
+			count(file, int(moved.OrigStartLine), HunkApplication{Err: err})
+			conflicts = true
+			continue
+		}
+		count(file, int(moved.OrigStartLine)+a.Offset, a)
+		content = result
+		delta += h.NewLines - h.OrigLines
+	}
+	if currentErr != nil {
+		return nil
+	}
+
+	switch {
+	case isDevNull(newName):
+		if !conflicts {
+			t.set(origName, &treeFile{deleted: true})
+		}
+	default:
+		mode := extendedMode(fd.Extended)
+		if mode == 0 {
+			mode = current.mode
+		}
+		if newName != origName && !isDevNull(origName) {
+			// File is renamed
+			t.set(origName, &treeFile{deleted: true})
+		}
+		t.set(newName, &treeFile{content: content, mode: mode})
+	}
+	return nil
+}
+
+// WriteJSON writes m to w as indented JSON.
+func (m *HeatMap) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return fmt.Errorf("writing JSON: %w", err)
+	}
+	return nil
+}
+
+// heatMapCSVHeader names the columns written by WriteCSV.
+var heatMapCSVHeader = []string{"file", "start_line", "end_line", "hunks", "conflicts", "fuzzed", "moved", "patches"}
+
+// WriteCSV writes the regions of m to w as CSV with a header line, one region per
+// row, with the names of its patches separated by spaces.
+func (m *HeatMap) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(heatMapCSVHeader)
+	for _, r := range m.Regions {
+		cw.Write([]string{
+			r.File,
+			strconv.Itoa(r.StartLine),
+			strconv.Itoa(r.EndLine),
+			strconv.Itoa(r.Hunks),
+			strconv.Itoa(r.Conflicts),
+			strconv.Itoa(r.Fuzzed),
+			strconv.Itoa(r.Moved),
+			strings.Join(r.Patches, " "),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("writing CSV: %w", err)
+	}
+	return nil
+}
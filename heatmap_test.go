@@ -0,0 +1,118 @@
+package patchutils
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const heatMapTarget = "l1\nl2\nl3\nl4\nl5\nl6\nl7\nl8\nl9\nl10\nl11\nl12\n"
+
+// heatMapSeries applies cleanly, then with a moved hunk, a conflicting hunk and
+// a missing file.
+var heatMapSeries = []struct {
+	name  string
+	patch string
+}{
+	{
+		name: "1.patch",
+		patch: `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ l1
+-l2
++L2
+ l3
+`,
+	},
+	{
+		name: "2.patch",
+		patch: `--- a/a.txt
++++ b/a.txt
+@@ -5,3 +5,3 @@
+ l8
+-l9
++L9
+ l10
+@@ -11,2 +11,2 @@
+ x
+-l12
++L12
+--- a/b.txt
++++ b/b.txt
+@@ -1,1 +1,1 @@
+-b
++B
+`,
+	},
+}
+
+func TestPatchHeatMap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "heatmap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "a.txt"), []byte(heatMapTarget), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var series []SeriesPatch
+	for _, p := range heatMapSeries {
+		series = append(series, SeriesPatch{Name: p.name, Patch: strings.NewReader(p.patch)})
+	}
+	opts := HeatMapOptions{Apply: ApplyOptions{MaxOffset: 10}, StripLevel: 1, RegionLines: 5}
+	m, err := PatchHeatMap(dir, series, opts)
+	if err != nil {
+		t.Fatalf("PatchHeatMap: got error %v; want error nil", err)
+	}
+
+	wantFiles := []HeatFile{
+		{File: "a.txt", HeatCounts: HeatCounts{Hunks: 3, Conflicts: 1, Moved: 1}},
+		{File: "b.txt", HeatCounts: HeatCounts{Hunks: 1, Conflicts: 1}},
+	}
+	if !reflect.DeepEqual(m.Files, wantFiles) {
+		t.Errorf("Files mismatch.\nGot:\n%+v\nWant:\n%+v\n", m.Files, wantFiles)
+	}
+	wantRegions := []HeatRegion{
+		{File: "a.txt", StartLine: 11, EndLine: 15, HeatCounts: HeatCounts{Hunks: 1, Conflicts: 1}, Patches: []string{"2.patch"}},
+		{File: "b.txt", StartLine: 1, EndLine: 5, HeatCounts: HeatCounts{Hunks: 1, Conflicts: 1}, Patches: []string{"2.patch"}},
+		{File: "a.txt", StartLine: 6, EndLine: 10, HeatCounts: HeatCounts{Hunks: 1, Moved: 1}, Patches: []string{"2.patch"}},
+		{File: "a.txt", StartLine: 1, EndLine: 5, HeatCounts: HeatCounts{Hunks: 1}},
+	}
+	if !reflect.DeepEqual(m.Regions, wantRegions) {
+		t.Errorf("Regions mismatch.\nGot:\n%+v\nWant:\n%+v\n", m.Regions, wantRegions)
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, "a.txt"))
+	if err != nil || string(content) != heatMapTarget {
+		t.Errorf("Target changed: got %q, %v; want %q", content, err, heatMapTarget)
+	}
+
+	var csv bytes.Buffer
+	if err := m.WriteCSV(&csv); err != nil {
+		t.Fatalf("WriteCSV: got error %v; want error nil", err)
+	}
+	wantCSV := `file,start_line,end_line,hunks,conflicts,fuzzed,moved,patches
+a.txt,11,15,1,1,0,0,2.patch
+b.txt,1,5,1,1,0,0,2.patch
+a.txt,6,10,1,0,0,1,2.patch
+a.txt,1,5,1,0,0,0,
+`
+	if csv.String() != wantCSV {
+		t.Errorf("CSV mismatch.\nGot:\n%s\nWant:\n%s\n", csv.String(), wantCSV)
+	}
+}
+
+func TestPatchHeatMapUnsafePath(t *testing.T) {
+	series := []SeriesPatch{{Name: "bad.patch", Patch: strings.NewReader("--- a/../x\n+++ b/../x\n@@ -1 +1 @@\n-a\n+b\n")}}
+	_, err := PatchHeatMap(".", series, HeatMapOptions{StripLevel: 1})
+	if !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("PatchHeatMap: got error %v; want error %v", err, ErrUnsafePath)
+	}
+}
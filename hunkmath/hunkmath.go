@@ -0,0 +1,64 @@
+// Package hunkmath provides line range arithmetic for go-diff hunks.
+package hunkmath
+
+import "github.com/sourcegraph/go-diff/diff"
+
+// Range is a half-open range [Start, End) of line numbers, counted from 1.
+type Range struct {
+	Start, End int32
+}
+
+// Len returns the number of lines in r.
+func (r Range) Len() int32 {
+	return r.End - r.Start
+}
+
+// Contains reports whether line is inside r.
+func (r Range) Contains(line int32) bool {
+	return line >= r.Start && line < r.End
+}
+
+// Overlaps reports whether r and other have at least one line in common.
+func (r Range) Overlaps(other Range) bool {
+	return r.Start < other.End && other.Start < r.End
+}
+
+// Touches reports whether r and other overlap or are adjacent,
+// so no unchanged line separates them.
+func (r Range) Touches(other Range) bool {
+	return r.Start <= other.End && other.Start <= r.End
+}
+
+// HunkOrigRange returns the lines of the original file covered by hunk.
+func HunkOrigRange(hunk *diff.Hunk) Range {
+	return Range{Start: hunk.OrigStartLine, End: hunk.OrigStartLine + hunk.OrigLines}
+}
+
+// HunkNewRange returns the lines of the new file covered by hunk.
+func HunkNewRange(hunk *diff.Hunk) Range {
+	return Range{Start: hunk.NewStartLine, End: hunk.NewStartLine + hunk.NewLines}
+}
+
+// HunkDelta returns the number of lines hunk adds to the file,
+// negative if it removes lines.
+func HunkDelta(hunk *diff.Hunk) int32 {
+	return hunk.NewLines - hunk.OrigLines
+}
+
+// ShiftHunk moves hunk by delta lines in both the original and the new file.
+func ShiftHunk(hunk *diff.Hunk, delta int32) {
+	hunk.OrigStartLine += delta
+	hunk.NewStartLine += delta
+}
+
+// HunksOverlap reports whether hunks a and b change or use
+// at least one common line of the original file.
+func HunksOverlap(a, b *diff.Hunk) bool {
+	return HunkOrigRange(a).Overlaps(HunkOrigRange(b))
+}
+
+// HunksTouch reports whether hunks a and b overlap or are adjacent
+// in the original file.
+func HunksTouch(a, b *diff.Hunk) bool {
+	return HunkOrigRange(a).Touches(HunkOrigRange(b))
+}
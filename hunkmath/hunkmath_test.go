@@ -0,0 +1,78 @@
+package hunkmath
+
+import (
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+var hunksOverlapTests = []struct {
+	name    string
+	a, b    *diff.Hunk
+	overlap bool
+	touch   bool
+}{
+	{
+		name:    "disjoint",
+		a:       &diff.Hunk{OrigStartLine: 1, OrigLines: 3},
+		b:       &diff.Hunk{OrigStartLine: 10, OrigLines: 3},
+		overlap: false,
+		touch:   false,
+	},
+	{
+		name:    "adjacent",
+		a:       &diff.Hunk{OrigStartLine: 1, OrigLines: 3},
+		b:       &diff.Hunk{OrigStartLine: 4, OrigLines: 3},
+		overlap: false,
+		touch:   true,
+	},
+	{
+		name:    "overlapping",
+		a:       &diff.Hunk{OrigStartLine: 1, OrigLines: 5},
+		b:       &diff.Hunk{OrigStartLine: 4, OrigLines: 3},
+		overlap: true,
+		touch:   true,
+	},
+	{
+		name:    "nested",
+		a:       &diff.Hunk{OrigStartLine: 4, OrigLines: 1},
+		b:       &diff.Hunk{OrigStartLine: 1, OrigLines: 10},
+		overlap: true,
+		touch:   true,
+	},
+}
+
+func TestHunksOverlap(t *testing.T) {
+	for _, tt := range hunksOverlapTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HunksOverlap(tt.a, tt.b); got != tt.overlap {
+				t.Errorf("HunksOverlap: got %v; want %v", got, tt.overlap)
+			}
+			if got := HunksOverlap(tt.b, tt.a); got != tt.overlap {
+				t.Errorf("HunksOverlap (swapped): got %v; want %v", got, tt.overlap)
+			}
+			if got := HunksTouch(tt.a, tt.b); got != tt.touch {
+				t.Errorf("HunksTouch: got %v; want %v", got, tt.touch)
+			}
+		})
+	}
+}
+
+func TestHunkRanges(t *testing.T) {
+	hunk := &diff.Hunk{OrigStartLine: 5, OrigLines: 6, NewStartLine: 7, NewLines: 8}
+
+	if got, want := HunkOrigRange(hunk), (Range{Start: 5, End: 11}); got != want {
+		t.Errorf("HunkOrigRange: got %v; want %v", got, want)
+	}
+	if got, want := HunkNewRange(hunk), (Range{Start: 7, End: 15}); got != want {
+		t.Errorf("HunkNewRange: got %v; want %v", got, want)
+	}
+	if got, want := HunkDelta(hunk), int32(2); got != want {
+		t.Errorf("HunkDelta: got %d; want %d", got, want)
+	}
+
+	ShiftHunk(hunk, -3)
+	if hunk.OrigStartLine != 2 || hunk.NewStartLine != 4 {
+		t.Errorf("ShiftHunk: got start lines %d and %d; want 2 and 4", hunk.OrigStartLine, hunk.NewStartLine)
+	}
+}
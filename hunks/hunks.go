@@ -0,0 +1,761 @@
+// Package hunks provides the building blocks of interdiffs of go-diff file diffs:
+// merging overlapping hunks of two diffs of the same source, reverting hunks, and
+// turning chunks of differing lines into hunks.
+package hunks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-patchutils/hunkmath"
+	dbd "github.com/kylelemons/godebug/diff"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// DefaultContextLines is the number of unchanged lines shown around changes in computed diffs.
+const DefaultContextLines = 2
+
+// NoContext as contextLines of ChunksToFileDiff gives diffs without unchanged lines.
+const NoContext = -1
+
+// DefaultHunkBreakGap is the minimum number of unchanged lines between two changes
+// that puts them into separate hunks of computed diffs.
+const DefaultHunkBreakGap = 2*DefaultContextLines + 2
+
+// NoNewlineSuffix marks the last line of a file without a terminating newline in
+// lines returned by Lines. Being split on newlines, lines can't end with it otherwise.
+const NoNewlineSuffix = "\n" + `\ No newline at end of file`
+
+// Chunk is a piece of the difference between two lists of lines: lines added,
+// lines deleted, then lines equal in both lists. Chunks returned by a LineDiffer
+// don't have both added and deleted lines.
+type Chunk struct {
+	Added   []string
+	Deleted []string
+	Equal   []string
+}
+
+// LineDiffer computes the difference between two lists of lines.
+type LineDiffer interface {
+	// DiffChunks returns chunks which turn a into b when applied in order,
+	// or nil if a and b are equal.
+	DiffChunks(a, b []string) []Chunk
+}
+
+// LCSDiffer is the default LineDiffer, which finds a longest common subsequence
+// of lines with the Myers algorithm.
+type LCSDiffer struct{}
+
+// String returns the name of the differ, "lcs".
+func (LCSDiffer) String() string { return "lcs" }
+
+// DiffChunks implements LineDiffer.
+func (LCSDiffer) DiffChunks(a, b []string) []Chunk {
+	dchunks := dbd.DiffChunks(a, b)
+	if dchunks == nil {
+		return nil
+	}
+	chunks := make([]Chunk, len(dchunks))
+	for k, c := range dchunks {
+		chunks[k] = Chunk(c)
+	}
+	return chunks
+}
+
+// lineDiffer returns d, or LCSDiffer if d is nil.
+func lineDiffer(d LineDiffer) LineDiffer {
+	if d == nil {
+		return LCSDiffer{}
+	}
+	return d
+}
+
+// MergeFunc merges overlapping oldHunks and newHunks, found by FindOverlappingHunkSet,
+// into one hunk, or returns nil if they make the same changes.
+type MergeFunc func(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, error)
+
+// InterFileDiff returns a new diff.FileDiff that is a diff of a source file patched
+// with oldFileDiff and the same source file patched with newFileDiff, with lines
+// added by both compared with LCSDiffer. It fails with ErrContentMismatch if
+// overlapping hunks disagree about the source.
+func InterFileDiff(oldFileDiff, newFileDiff *diff.FileDiff) (*diff.FileDiff, error) {
+	return InterFileDiffFunc(oldFileDiff, newFileDiff, func(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, error) {
+		return MergeOverlappingHunks(oldHunks, newHunks, nil)
+	})
+}
+
+// InterFileDiffFunc is like InterFileDiff, with overlapping hunks merged by merge,
+// e.g. to compare added lines with another LineDiffer or to resolve mismatches.
+func InterFileDiffFunc(oldFileDiff, newFileDiff *diff.FileDiff, merge MergeFunc) (*diff.FileDiff, error) {
+	// Configuration of result FileDiff
+	resultFileDiff := &diff.FileDiff{
+		OrigName: oldFileDiff.NewName,
+		OrigTime: oldFileDiff.NewTime,
+		NewName:  newFileDiff.NewName,
+		NewTime:  newFileDiff.NewTime,
+		Extended: []string{},
+		Hunks:    []*diff.Hunk{}}
+
+	// Iterating over hunks in order they start in origin
+	i, j := 0, 0
+	for i < len(oldFileDiff.Hunks) && j < len(newFileDiff.Hunks) {
+		switch {
+		case hunkmath.HunkOrigRange(oldFileDiff.Hunks[i]).End < newFileDiff.Hunks[j].OrigStartLine:
+			// Whole oldHunk is before starting of newHunk
+			resultFileDiff.Hunks = append(resultFileDiff.Hunks,
+				RevertedHunk(oldFileDiff.Hunks[i]))
+			i++
+		case hunkmath.HunkOrigRange(newFileDiff.Hunks[j]).End < oldFileDiff.Hunks[i].OrigStartLine:
+			// Whole newHunk is before starting of oldHunk
+			resultFileDiff.Hunks = append(resultFileDiff.Hunks, newFileDiff.Hunks[j])
+			j++
+		default:
+			// oldHunk and newHunk are overlapping somehow
+			// Collecting a whole set of overlapping hunks to produce one continuous hunk
+			oldHunks, newHunks := FindOverlappingHunkSet(oldFileDiff, newFileDiff, &i, &j)
+			mergedOverlappingHunk, err := merge(oldHunks, newHunks)
+			if err != nil {
+				return nil, fmt.Errorf("merging overlapping hunks: %w", err)
+			}
+
+			// In case opposite hunks aren't doing same changes.
+			if mergedOverlappingHunk != nil {
+				resultFileDiff.Hunks = append(resultFileDiff.Hunks, mergedOverlappingHunk)
+			}
+		}
+	}
+
+	// In case there are more hunks in oldFileDiff, while hunks of newFileDiff are run out
+	for i < len(oldFileDiff.Hunks) {
+		resultFileDiff.Hunks = append(resultFileDiff.Hunks,
+			RevertedHunk(oldFileDiff.Hunks[i]))
+		i++
+	}
+
+	// In case there are more hunks in newFileDiff, while hunks of oldFileDiff are run out
+	for j < len(newFileDiff.Hunks) {
+		resultFileDiff.Hunks = append(resultFileDiff.Hunks, newFileDiff.Hunks[j])
+		j++
+	}
+
+	return resultFileDiff, nil
+}
+
+// InterFileStat returns the number of lines added and deleted by the diff
+// InterFileDiffFunc returns for oldFileDiff and newFileDiff when overlapping hunks
+// are merged by MergeOverlappingHunks with differ. Lines are counted as they are
+// merged, without building the hunks of that diff.
+func InterFileStat(oldFileDiff, newFileDiff *diff.FileDiff, differ LineDiffer) (added, deleted int, err error) {
+	// Iterating over hunks in order they start in origin, like InterFileDiffFunc
+	i, j := 0, 0
+	for i < len(oldFileDiff.Hunks) && j < len(newFileDiff.Hunks) {
+		switch {
+		case hunkmath.HunkOrigRange(oldFileDiff.Hunks[i]).End < newFileDiff.Hunks[j].OrigStartLine:
+			// Lines of reverted hunks swap sides
+			d, a := CountLines(oldFileDiff.Hunks[i])
+			added, deleted = added+a, deleted+d
+			i++
+		case hunkmath.HunkOrigRange(newFileDiff.Hunks[j]).End < oldFileDiff.Hunks[i].OrigStartLine:
+			a, d := CountLines(newFileDiff.Hunks[j])
+			added, deleted = added+a, deleted+d
+			j++
+		default:
+			oldHunks, newHunks := FindOverlappingHunkSet(oldFileDiff, newFileDiff, &i, &j)
+			err := MergeOverlappingLines(oldHunks, newHunks, differ, func(op byte, _ string) {
+				switch op {
+				case '+':
+					added++
+				case '-':
+					deleted++
+				}
+			})
+			if err != nil {
+				return 0, 0, fmt.Errorf("merging overlapping hunks: %w", err)
+			}
+		}
+	}
+
+	for ; i < len(oldFileDiff.Hunks); i++ {
+		d, a := CountLines(oldFileDiff.Hunks[i])
+		added, deleted = added+a, deleted+d
+	}
+	for ; j < len(newFileDiff.Hunks); j++ {
+		a, d := CountLines(newFileDiff.Hunks[j])
+		added, deleted = added+a, deleted+d
+	}
+	return added, deleted, nil
+}
+
+// CountLines returns the number of lines added and deleted by hunk.
+func CountLines(hunk *diff.Hunk) (added, deleted int) {
+	for body := hunk.Body; len(body) > 0; {
+		switch body[0] {
+		case '+':
+			added++
+		case '-':
+			deleted++
+		}
+		k := bytes.IndexByte(body, '\n')
+		if k < 0 {
+			break
+		}
+		body = body[k+1:]
+	}
+	return added, deleted
+}
+
+// ResultHunk returns a new diff.Hunk without a body, with the start lines and the
+// numbers of lines of the hunk merging overlapping oldHunks and newHunks.
+func ResultHunk(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, error) {
+	h, _, err := resultHunk(oldHunks, newHunks)
+	return h, err
+}
+
+// MergeOverlappingLines merges the bodies of overlapping oldHunks and newHunks like
+// MergeOverlappingHunks does, and calls emit for every line of the merged body, with
+// its prefix as op and the rest of the line as text.
+func MergeOverlappingLines(oldHunks, newHunks []*diff.Hunk, differ LineDiffer, emit func(op byte, text string)) error {
+	_, currentOrgI, err := resultHunk(oldHunks, newHunks)
+	if err != nil {
+		return fmt.Errorf("configuring result hunk: %w", err)
+	}
+	return mergeLines(oldHunks, newHunks, currentOrgI, differ, emit)
+}
+
+// ChunksToFileDiff adds the given chunks to the fileDiff struct, with
+// contextLines unchanged lines around changes; 0 stands for DefaultContextLines
+// and NoContext for none. Changes separated by at least hunkBreakGap unchanged lines
+// go into separate hunks; 0 stands for 2*contextLines+2, the gap for which hunks are
+// merged if they would be only one line apart, and values below 2*contextLines+1
+// are raised to it, so that context lines of separate hunks don't overlap.
+func ChunksToFileDiff(chunks []Chunk, fileDiff *diff.FileDiff, contextLines, hunkBreakGap int) {
+	switch {
+	case contextLines == 0:
+		contextLines = DefaultContextLines
+	case contextLines < 0:
+		contextLines = 0
+	}
+	switch {
+	case hunkBreakGap == 0:
+		hunkBreakGap = 2*contextLines + 2
+	case hunkBreakGap < 2*contextLines+1:
+		hunkBreakGap = 2*contextLines + 1
+	}
+
+	var currentOldI, currentNewI int32 = 1, 1
+	currentHunk := &diff.Hunk{
+		OrigStartLine: currentOldI,
+		NewStartLine:  currentNewI,
+	}
+	// Delete empty chunks in the beginning
+	for len(chunks) > 0 && len(chunks[0].Added) == 0 && len(chunks[0].Deleted) == 0 && len(chunks[0].Equal) == 0 {
+		chunks = chunks[1:]
+	}
+	// Delete empty chunks in the end
+	last := len(chunks) - 1
+	for len(chunks) > 0 && len(chunks[last].Added) == 0 && len(chunks[last].Deleted) == 0 && len(chunks[last].Equal) == 0 {
+		chunks = chunks[:last]
+		last--
+	}
+
+	// If chunks contains only one element with only unchanged lines
+	if len(chunks) == 1 && len(chunks[0].Added) == 0 && len(chunks[0].Deleted) == 0 {
+		return
+	}
+
+	var currentHunkBody []string
+
+	// If array of chunks is already empty
+	if len(chunks) == 0 {
+		return
+	}
+
+	// If first chunk contains only equal lines, we are adding last contextLines to currentHunk
+	if len(chunks[0].Added) == 0 && len(chunks[0].Deleted) == 0 {
+		currentOldI += int32(len(chunks[0].Equal))
+		currentNewI += int32(len(chunks[0].Equal))
+		if len(chunks[0].Equal) > contextLines {
+			for _, line := range chunks[0].Equal[len(chunks[0].Equal)-contextLines:] {
+				currentHunkBody = append(currentHunkBody, " "+line)
+			}
+			currentHunk.OrigStartLine = currentOldI - int32(contextLines)
+			currentHunk.NewStartLine = currentNewI - int32(contextLines)
+		} else {
+			for _, line := range chunks[0].Equal {
+				currentHunkBody = append(currentHunkBody, " "+line)
+			}
+		}
+		// Removing processed first hunk
+		chunks = chunks[1:]
+	}
+
+	var lastLines []string
+	last = len(chunks) - 1
+	// If last chunk contains equal lines, save first contextLines of equal lines for further processing
+	if len(chunks[last].Equal) > 0 {
+		if len(chunks[last].Equal) > contextLines {
+			for _, line := range chunks[last].Equal[:contextLines] {
+				lastLines = append(lastLines, " "+line)
+			}
+		} else {
+			for _, line := range chunks[last].Equal {
+				lastLines = append(lastLines, " "+line)
+			}
+		}
+		// Removing processed equal lines from last chunk
+		chunks[last].Equal = []string{}
+	}
+
+	for _, c := range chunks {
+		// A chunk will not have both added and deleted lines.
+		for _, line := range c.Added {
+			currentHunkBody = append(currentHunkBody, "+"+line)
+			currentNewI++
+		}
+		for _, line := range c.Deleted {
+			currentHunkBody = append(currentHunkBody, "-"+line)
+			currentOldI++
+		}
+
+		// Next piece of content contains too many unchanged lines.
+		// Current hunk will be 'closed' and started new one.
+		if len(c.Equal) >= hunkBreakGap {
+			if len(currentHunkBody) > 0 {
+				for _, line := range c.Equal[:contextLines] {
+					currentHunkBody = append(currentHunkBody, " "+line)
+				}
+				currentHunk.OrigLines = currentOldI + int32(contextLines) - currentHunk.OrigStartLine
+				currentHunk.NewLines = currentNewI + int32(contextLines) - currentHunk.NewStartLine
+				SetLines(currentHunk, currentHunkBody)
+				fileDiff.Hunks = append(fileDiff.Hunks, emptyRangesBefore(currentHunk))
+			}
+
+			currentOldI += int32(len(c.Equal))
+			currentNewI += int32(len(c.Equal))
+
+			currentHunk = &diff.Hunk{
+				OrigStartLine: currentOldI - int32(contextLines),
+				NewStartLine:  currentNewI - int32(contextLines),
+			}
+
+			// Clean currentHunkBody
+			currentHunkBody = []string{}
+			for _, line := range c.Equal[len(c.Equal)-contextLines:] {
+				currentHunkBody = append(currentHunkBody, " "+line)
+			}
+
+		} else {
+			for _, line := range c.Equal {
+				currentHunkBody = append(currentHunkBody, " "+line)
+				currentOldI++
+				currentNewI++
+			}
+		}
+	}
+
+	// Add lastLines (equal) to last hunk
+	for _, line := range lastLines {
+		currentHunkBody = append(currentHunkBody, line)
+		currentOldI++
+		currentNewI++
+	}
+
+	// currentHunkBody contains some lines. It need to be 'closed' and added to fileDiff.Hunks
+	currentHunk.OrigLines = currentOldI - currentHunk.OrigStartLine
+	currentHunk.NewLines = currentNewI - currentHunk.NewStartLine
+	SetLines(currentHunk, currentHunkBody)
+	fileDiff.Hunks = append(fileDiff.Hunks, emptyRangesBefore(currentHunk))
+}
+
+// emptyRangesBefore returns h with empty ranges starting at the line before which
+// lines are added or deleted, as in unified diffs, instead of at the line after.
+func emptyRangesBefore(h *diff.Hunk) *diff.Hunk {
+	if h.OrigLines == 0 {
+		h.OrigStartLine--
+	}
+	if h.NewLines == 0 {
+		h.NewStartLine--
+	}
+	return h
+}
+
+// FindOverlappingHunkSet finds next set (two arrays: oldHunks and newHunks) of
+// overlapping hunks in oldFileDiff and newFileDiff, starting from position i, j relatively.
+func FindOverlappingHunkSet(oldFileDiff, newFileDiff *diff.FileDiff, i, j *int) (oldHunks, newHunks []*diff.Hunk) {
+	// Collecting overlapped hunks into two arrays
+
+	oldHunks = append(oldHunks, oldFileDiff.Hunks[*i])
+	newHunks = append(newHunks, newFileDiff.Hunks[*j])
+	*i++
+	*j++
+
+Loop:
+	for {
+		switch {
+		// Starting line of oldHunk is in previous newHunk body (between start and last lines)
+		case *i < len(oldFileDiff.Hunks) &&
+			hunkmath.HunkOrigRange(newFileDiff.Hunks[*j-1]).Contains(oldFileDiff.Hunks[*i].OrigStartLine):
+			oldHunks = append(oldHunks, oldFileDiff.Hunks[*i])
+			*i++
+		// Starting line of newHunk is in previous oldHunk body (between start and last lines)
+		case *j < len(newFileDiff.Hunks) &&
+			hunkmath.HunkOrigRange(oldFileDiff.Hunks[*i-1]).Contains(newFileDiff.Hunks[*j].OrigStartLine):
+			newHunks = append(newHunks, newFileDiff.Hunks[*j])
+			*j++
+		default:
+			// No overlapping hunks left
+			break Loop
+		}
+	}
+
+	return oldHunks, newHunks
+}
+
+// MergeOverlappingHunks returns a new diff.Hunk that is a diff hunk between overlapping oldHunks and newHunks,
+// related to the same source file, with lines added by both compared with differ.
+func MergeOverlappingHunks(oldHunks, newHunks []*diff.Hunk, differ LineDiffer) (*diff.Hunk, error) {
+	resultHunk, currentOrgI, err := resultHunk(oldHunks, newHunks)
+
+	if err != nil {
+		return nil, fmt.Errorf("configuring result hunk: %w", err)
+	}
+
+	var newBody []string
+	changed := false
+	err = mergeLines(oldHunks, newHunks, currentOrgI, differ, func(op byte, text string) {
+		newBody = append(newBody, string(op)+text)
+		if op != ' ' {
+			changed = true
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !changed {
+		// Opposite hunks are doing same changes
+		return nil, nil
+	}
+
+	SetLines(resultHunk, newBody)
+	return resultHunk, nil
+}
+
+// mergeLines merges bodies of overlapping oldHunks and newHunks, starting from
+// line currentOrgI of the origin, and calls emit for every line of the merged body,
+// with its prefix as op and the rest of the line as text. Lines added by both are compared with differ.
+func mergeLines(oldHunks, newHunks []*diff.Hunk, currentOrgI int32, differ LineDiffer,
+	emit func(op byte, text string)) error {
+	// Indexes of hunks
+	currentOldHunkI, currentNewHunkJ := 0, 0
+	// Indexes of lines in body hunks
+	// if indexes == -1 -- we don't have relevant hunk, which contains changes nearby currentOrgI
+	i, j := -1, -1
+
+	// Body of hunks
+	var oldHunkBody, newHunkBody []string
+
+	// Iterating through the hunks in the order they're appearing in origin file.
+	// Using number of line in origin (currentOrgI) as an anchor to process line by line.
+	// By using currentOrgI as anchor it is easier to see how changes have been applied step by step.
+
+	// Merge, while there are hunks to process
+	for currentOldHunkI < len(oldHunks) || currentNewHunkJ < len(newHunks) {
+
+		// Entering next hunk in oldHunks
+		if currentOldHunkI < len(oldHunks) && i == -1 && currentOrgI == oldHunks[currentOldHunkI].OrigStartLine {
+			i = 0
+			oldHunkBody = Lines(oldHunks[currentOldHunkI])
+		}
+
+		// Entering next hunk in newHunks
+		if currentNewHunkJ < len(newHunks) && j == -1 && currentOrgI == newHunks[currentNewHunkJ].OrigStartLine {
+			j = 0
+			newHunkBody = Lines(newHunks[currentNewHunkJ])
+		}
+
+		switch {
+		case i == -1 && j == -1:
+		case i >= 0 && j == -1:
+			// Changes are only in oldHunk
+			op, text := SplitLine(oldHunkBody[i])
+			emit(revertedOp(op), text)
+			// In case current line haven't been added, we have processed anchor line.
+			if op != '+' {
+				// Updating index of anchor line.
+				currentOrgI++
+			}
+			i++
+
+		case i == -1 && j >= 0:
+			// Changes are only in newHunk
+			op, text := SplitLine(newHunkBody[j])
+			emit(op, text)
+			// In case current line haven't been added, we have processed anchor line.
+			if op != '+' {
+				// Updating index of anchor line.
+				currentOrgI++
+			}
+			j++
+
+		default:
+			// Changes are in old and new hunks.
+			switch {
+			// Firstly proceeding added lines,
+			// because added lines are between previous currentOrgI and currentOrgI.
+			case strings.HasPrefix(oldHunkBody[i], "+") || strings.HasPrefix(newHunkBody[j], "+"):
+				interAddedLines(&i, &j, &oldHunkBody, &newHunkBody, differ, emit)
+			default:
+				// Checking if original content is the same
+				if oldHunkBody[i][1:] != newHunkBody[j][1:] {
+					return fmt.Errorf(
+						"line in original %d in oldDiff (%q) and newDiff (%q): %w",
+						currentOrgI, oldHunkBody[i][1:], newHunkBody[j][1:], ErrContentMismatch)
+				}
+				switch {
+				case strings.HasPrefix(oldHunkBody[i], " ") && strings.HasPrefix(newHunkBody[j], " "):
+					emit(' ', oldHunkBody[i][1:])
+				case strings.HasPrefix(oldHunkBody[i], "-") && strings.HasPrefix(newHunkBody[j], " "):
+					emit('+', oldHunkBody[i][1:])
+				case strings.HasPrefix(oldHunkBody[i], " ") && strings.HasPrefix(newHunkBody[j], "-"):
+					emit('-', newHunkBody[j][1:])
+					// If both have deleted same line, no need to emit it
+				}
+
+				// Updating currentOrgI since we have processed anchor line.
+				currentOrgI++
+				i++
+				j++
+			}
+		}
+
+		if i >= len(oldHunkBody) {
+			// Proceed whole oldHunkBody
+			i = -1
+			currentOldHunkI++
+		}
+
+		if j >= len(newHunkBody) {
+			// Proceed whole newHunkBody
+			j = -1
+			currentNewHunkJ++
+		}
+	}
+
+	return nil
+}
+
+// interAddedLines finds interdiff between added lines in oldHunkBody (after i) and newHunkBody (after j)
+// with differ, and calls emit for every line of it.
+func interAddedLines(i, j *int, oldHunkBody, newHunkBody *[]string, differ LineDiffer, emit func(op byte, text string)) {
+	var oldAddedLines, newAddedLines []string
+	// Collect added lines in oldHunkBody
+	for (*i < len(*oldHunkBody)) && (strings.HasPrefix((*oldHunkBody)[*i], "+")) {
+		oldAddedLines = append(oldAddedLines, (*oldHunkBody)[*i][1:])
+		*i++
+	}
+	// Collect added lines in newHunkBody
+	for (*j < len(*newHunkBody)) && (strings.HasPrefix((*newHunkBody)[*j], "+")) {
+		newAddedLines = append(newAddedLines, (*newHunkBody)[*j][1:])
+		*j++
+	}
+
+	// Difference between collected added lines
+	chunks := lineDiffer(differ).DiffChunks(oldAddedLines, newAddedLines)
+	for _, c := range chunks {
+		// A chunk will not have both added and deleted lines.
+		for _, line := range c.Added {
+			emit('+', line)
+		}
+		for _, line := range c.Deleted {
+			emit('-', line)
+		}
+		for _, line := range c.Equal {
+			emit(' ', line)
+		}
+	}
+}
+
+// resultHunk returns a new diff.Hunk (with configured StartLines and NumberLines)
+// and currentOrgI (number of anchor line) based on oldHunks and newHunks, for their further merge.
+func resultHunk(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, int32, error) {
+	if len(oldHunks) == 0 || len(newHunks) == 0 {
+		return nil, 0, errors.New("one of the hunks array is empty")
+	}
+
+	var currentOrgI int32
+	resultHunk := &diff.Hunk{
+		Body: []byte{0},
+	}
+
+	firstOldHunk, firstNewHunk := oldHunks[0], newHunks[0]
+	lastOldHunk, lastNewHunk := oldHunks[len(oldHunks)-1], newHunks[len(newHunks)-1]
+
+	// Calculate StartLine for origin and new in result
+	if firstOldHunk.OrigStartLine < firstNewHunk.OrigStartLine {
+		// Started with old hunk
+		currentOrgI = firstOldHunk.OrigStartLine
+		resultHunk.Section = firstOldHunk.Section
+		// As we started with this old hunk, OrigStartLine will be same as start line of hunk in old source
+		resultHunk.OrigStartLine = firstOldHunk.NewStartLine
+		// StartLine in firstNewHunk - number of origin lines between start of firstNewHunk and start of resultHunk
+		resultHunk.NewStartLine = currentOrgI +
+			firstNewHunk.NewStartLine - firstNewHunk.OrigStartLine
+	} else {
+		// Started with new hunk
+		currentOrgI = firstNewHunk.OrigStartLine
+		resultHunk.Section = firstNewHunk.Section
+		// StartLine in firstOldHunk - number of origin lines between start of firstOldHunk and start of resultHunk
+		resultHunk.OrigStartLine = currentOrgI +
+			firstOldHunk.NewStartLine - firstOldHunk.OrigStartLine
+		// As we started with this new hunk, NewStartLine will be same as start line of hunk in new source
+		resultHunk.NewStartLine = firstNewHunk.NewStartLine
+	}
+
+	// Calculate NumberLines for origin and new in result
+	if lastOldHunk.OrigStartLine+lastOldHunk.OrigLines >
+		lastNewHunk.OrigStartLine+lastNewHunk.OrigLines {
+		// Finished with old hunk
+		// Last line of lastOldHunk - first line of origin in resultHunk
+		resultHunk.OrigLines = lastOldHunk.NewStartLine + lastOldHunk.NewLines - resultHunk.OrigStartLine
+		// Last line of new in resultHunk - first line of new in resultHunk
+		// lastNewHunk.NewStartLine + lastNewHunk.NewLines = last line of lastNewHunk
+		resultHunk.NewLines = lastNewHunk.NewStartLine + lastNewHunk.NewLines +
+			// + number of origin lines between last line of lastNewHunk and lastOldHunk
+			lastOldHunk.OrigStartLine + lastOldHunk.OrigLines -
+			lastNewHunk.OrigStartLine - lastNewHunk.OrigLines -
+			// - first line of new in resultHunk
+			resultHunk.NewStartLine
+	} else {
+		// Finished with new hunk
+		// Last line of old in resultHunk - first line of old in resultHunk
+		// lastOldHunk.NewStartLine + lastOldHunk.NewLines = last line of lastOldHunk
+		resultHunk.OrigLines = lastOldHunk.NewStartLine + lastOldHunk.NewLines +
+			// + number of origin lines between last line of lastOldHunk and lastNewHunk
+			lastNewHunk.OrigStartLine + lastNewHunk.OrigLines -
+			lastOldHunk.OrigStartLine - lastOldHunk.OrigLines -
+			// - first line of old in resultHunk
+			resultHunk.OrigStartLine
+		// Last line of lastNewHunk - first line of new in resultHunk
+		resultHunk.NewLines = lastNewHunk.NewStartLine + lastNewHunk.NewLines - resultHunk.NewStartLine
+	}
+
+	resultHunk.StartPosition = firstOldHunk.StartPosition
+
+	return resultHunk, currentOrgI, nil
+}
+
+// RevertedHunk returns a copy of hunk with reverted lines of Body. Deleted
+// lines are moved before added lines they follow, as in diffs.
+func RevertedHunk(hunk *diff.Hunk) *diff.Hunk {
+	var newBody, added []string
+	for _, line := range Lines(hunk) {
+		line = revertedLine(line)
+		switch {
+		case strings.HasPrefix(line, "+"):
+			added = append(added, line)
+		case strings.HasPrefix(line, "-"):
+			newBody = append(newBody, line)
+		default:
+			newBody = append(append(newBody, added...), line)
+			added = nil
+		}
+	}
+	newBody = append(newBody, added...)
+
+	revertedHunk := &diff.Hunk{
+		OrigStartLine: hunk.OrigStartLine,
+		OrigLines:     hunk.OrigLines,
+		NewStartLine:  hunk.NewStartLine,
+		NewLines:      hunk.NewLines,
+		Section:       hunk.Section,
+		StartPosition: hunk.StartPosition,
+	}
+	SetLines(revertedHunk, newBody)
+
+	return revertedHunk
+}
+
+// revertedLine returns a reverted line.
+// `+` added lines are marked as `-` deleted and vise versa.
+// ` ` unchanged lines are left as unchanged.
+func revertedLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+"):
+		return "-" + line[1:]
+	case strings.HasPrefix(line, "-"):
+		return "+" + line[1:]
+	default:
+		return line
+	}
+}
+
+// Lines returns the lines of the body of h, each starting with its prefix,
+// with NoNewlineSuffix added to the last lines of the original and the new
+// version if they have no newline ("\ No newline at end of file").
+func Lines(h *diff.Hunk) []string {
+	lines := strings.Split(string(h.Body), "\n")
+	if last := len(lines) - 1; lines[last] == "" {
+		lines = lines[:last]
+	} else {
+		lines[last] += NoNewlineSuffix
+	}
+	if at := int(h.OrigNoNewlineAt); at > 0 && at <= len(h.Body) {
+		lines[strings.Count(string(h.Body[:at]), "\n")-1] += NoNewlineSuffix
+	}
+	for k, line := range lines {
+		if line == "" || strings.HasPrefix(line, "\n") {
+			// Empty unchanged line, which lost its leading space
+			lines[k] = " " + line
+		}
+	}
+	return lines
+}
+
+// SetLines sets the body of h to lines as returned by Lines, with the
+// no newline markers of the lines with NoNewlineSuffix. The suffix is dropped
+// from added and unchanged lines other than the last one.
+func SetLines(h *diff.Hunk, lines []string) {
+	var body strings.Builder
+	h.OrigNoNewlineAt = 0
+	for k, line := range lines {
+		text := strings.TrimSuffix(line, NoNewlineSuffix)
+		body.WriteString(text)
+		switch {
+		case text == line:
+			body.WriteByte('\n')
+		case strings.HasPrefix(text, "-"):
+			body.WriteByte('\n')
+			h.OrigNoNewlineAt = int32(body.Len())
+		case k < len(lines)-1:
+			body.WriteByte('\n')
+		}
+	}
+	h.Body = []byte(body.String())
+}
+
+// SplitLine returns the prefix and the rest of a line of a hunk body.
+func SplitLine(line string) (byte, string) {
+	if line == "" {
+		// Empty unchanged line, which lost its leading space
+		return ' ', ""
+	}
+	return line[0], line[1:]
+}
+
+// revertedOp returns the prefix of a reverted line with prefix op.
+func revertedOp(op byte) byte {
+	switch op {
+	case '+':
+		return '-'
+	case '-':
+		return '+'
+	default:
+		return op
+	}
+}
+
+// ErrContentMismatch indicates that compared content is not same.
+var ErrContentMismatch = errors.New("content mismatch")
@@ -0,0 +1,266 @@
+package hunks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+func parseFileDiff(t *testing.T, patch string) *diff.FileDiff {
+	t.Helper()
+	fd, err := diff.ParseFileDiff([]byte(patch))
+	if err != nil {
+		t.Fatalf("Parsing patch: %v", err)
+	}
+	return fd
+}
+
+func printHunks(t *testing.T, hunks []*diff.Hunk) string {
+	t.Helper()
+	text, err := diff.PrintHunks(hunks)
+	if err != nil {
+		t.Fatalf("Printing hunks: %v", err)
+	}
+	return string(text)
+}
+
+var interFileDiffTests = []struct {
+	name     string
+	oldPatch string
+	newPatch string
+	want     string
+}{
+	{
+		name: "separate hunks",
+		oldPatch: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		newPatch: `--- a/f
++++ b/f
+@@ -8,3 +8,3 @@
+ h
+-i
++I
+ j
+`,
+		want: `@@ -1,3 +1,3 @@
+ a
+-B
++b
+ c
+@@ -8,3 +8,3 @@
+ h
+-i
++I
+ j
+`,
+	},
+	{
+		name: "overlapping hunks",
+		oldPatch: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`,
+		newPatch: `--- a/f
++++ b/f
+@@ -1,3 +1,3 @@
+ a
+-b
++b2
+ c
+`,
+		want: `@@ -1,3 +1,3 @@
+ a
+-B
++b2
+ c
+`,
+	},
+	{
+		name: "same changes",
+		oldPatch: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+-a
++A
+ b
+`,
+		newPatch: `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+-a
++A
+ b
+`,
+		want: "",
+	},
+}
+
+func TestInterFileDiff(t *testing.T) {
+	for _, tt := range interFileDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := InterFileDiff(parseFileDiff(t, tt.oldPatch), parseFileDiff(t, tt.newPatch))
+			if err != nil {
+				t.Fatalf("InterFileDiff: %v", err)
+			}
+			if got := printHunks(t, result.Hunks); got != tt.want {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInterFileStat(t *testing.T) {
+	for _, tt := range interFileDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldFileDiff, newFileDiff := parseFileDiff(t, tt.oldPatch), parseFileDiff(t, tt.newPatch)
+			added, deleted, err := InterFileStat(oldFileDiff, newFileDiff, nil)
+			if err != nil {
+				t.Fatalf("InterFileStat: %v", err)
+			}
+
+			// Counts must agree with the hunks of InterFileDiff
+			result, err := InterFileDiff(oldFileDiff, newFileDiff)
+			if err != nil {
+				t.Fatalf("InterFileDiff: %v", err)
+			}
+			var wantAdded, wantDeleted int
+			for _, h := range result.Hunks {
+				a, d := CountLines(h)
+				wantAdded, wantDeleted = wantAdded+a, wantDeleted+d
+			}
+			if added != wantAdded || deleted != wantDeleted {
+				t.Errorf("InterFileStat: got %d added, %d deleted; want %d added, %d deleted",
+					added, deleted, wantAdded, wantDeleted)
+			}
+		})
+	}
+}
+
+func TestInterFileDiffMismatch(t *testing.T) {
+	oldFileDiff := parseFileDiff(t, `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+-a
++A
+ b
+`)
+	newFileDiff := parseFileDiff(t, `--- a/f
++++ b/f
+@@ -1,2 +1,2 @@
+-x
++X
+ b
+`)
+	if _, err := InterFileDiff(oldFileDiff, newFileDiff); !errors.Is(err, ErrContentMismatch) {
+		t.Errorf("InterFileDiff: got error %v; want %v", err, ErrContentMismatch)
+	}
+}
+
+func TestRevertedHunk(t *testing.T) {
+	fd := parseFileDiff(t, `--- a/f
++++ b/f
+@@ -1,3 +1,4 @@
+ a
++x
+-b
++y
+ c
+`)
+	want := `@@ -1,3 +1,4 @@
+ a
+-x
+-y
++b
+ c
+`
+	if got := printHunks(t, []*diff.Hunk{RevertedHunk(fd.Hunks[0])}); got != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+}
+
+var chunksToFileDiffTests = []struct {
+	name         string
+	chunks       []Chunk
+	contextLines int
+	want         string
+}{
+	{
+		name: "default context",
+		chunks: []Chunk{
+			{Equal: []string{"1", "2", "3", "4"}},
+			{Deleted: []string{"5"}},
+			{Added: []string{"five"}, Equal: []string{"6", "7", "8"}},
+		},
+		want: `@@ -3,5 +3,5 @@
+ 3
+ 4
+-5
++five
+ 6
+ 7
+`,
+	},
+	{
+		name: "no context",
+		chunks: []Chunk{
+			{Equal: []string{"1", "2"}},
+			{Added: []string{"x"}, Equal: []string{"3"}},
+		},
+		contextLines: NoContext,
+		want: `@@ -2,0 +3,1 @@
++x
+`,
+	},
+	{
+		name: "separate hunks",
+		chunks: []Chunk{
+			{Deleted: []string{"1"}},
+			{Equal: strings.Split("2 3 4 5 6 7 8", " ")},
+			{Deleted: []string{"9"}},
+		},
+		contextLines: 1,
+		want: `@@ -1,2 +1,1 @@
+-1
+ 2
+@@ -8,2 +7,1 @@
+ 8
+-9
+`,
+	},
+}
+
+func TestChunksToFileDiff(t *testing.T) {
+	for _, tt := range chunksToFileDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd := &diff.FileDiff{}
+			ChunksToFileDiff(tt.chunks, fd, tt.contextLines, 0)
+			if got := printHunks(t, fd.Hunks); got != tt.want {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLines(t *testing.T) {
+	h := &diff.Hunk{Body: []byte("-a\n+b")}
+	lines := Lines(h)
+	if len(lines) != 2 || lines[1] != "+b"+NoNewlineSuffix {
+		t.Fatalf("Lines: got %q; want the last line with NoNewlineSuffix", lines)
+	}
+	SetLines(h, lines)
+	if got, want := string(h.Body), "-a\n+b"; got != want {
+		t.Errorf("SetLines: got body %q; want %q", got, want)
+	}
+}
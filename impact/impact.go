@@ -0,0 +1,178 @@
+// Package impact maps files changed by a patch to the build targets they are
+// part of, so that CI can decide what to rebuild after a patch is refreshed.
+// Mappings of files to targets are read from the output of build tools such as
+// go list and Bazel queries.
+package impact
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/schema"
+)
+
+// Map maps slash-separated source file names to the build targets they are part of.
+type Map map[string][]string
+
+// add adds target to the targets of file, unless it is there already.
+func (m Map) add(file, target string) {
+	for _, t := range m[file] {
+		if t == target {
+			return
+		}
+	}
+	m[file] = append(m[file], target)
+}
+
+// Targets returns the sorted targets of file. file matches a file of m if it is
+// equal to it or if its trailing path components are, so that names in diffs with
+// prefixes such as "a/" or the name of the source directory match.
+func (m Map) Targets(file string) []string {
+	file = path.Clean(filepath.ToSlash(file))
+	for name := file; ; {
+		if targets, ok := m[name]; ok {
+			result := append([]string(nil), targets...)
+			sort.Strings(result)
+			return result
+		}
+		k := strings.Index(name, "/")
+		if k < 0 {
+			return nil
+		}
+		name = name[k+1:]
+	}
+}
+
+// ParseLines reads a mapping with a line per file: the name of the file followed
+// by the targets it is part of, separated by white space. Empty lines and lines
+// starting with "#" are skipped. It is easy to produce from any build tool, such as
+// a Bazel query for the srcs of every target.
+func ParseLines(r io.Reader) (Map, error) {
+	m := make(Map)
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("line %d: %q: %w", n, line, ErrNoTargets)
+		}
+		for _, target := range fields[1:] {
+			m.add(path.Clean(filepath.ToSlash(fields[0])), target)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading mapping: %w", err)
+	}
+	return m, nil
+}
+
+// goPackage is the part of a package printed by go list -json used by ParseGoList.
+type goPackage struct {
+	Dir          string
+	ImportPath   string
+	GoFiles      []string
+	CgoFiles     []string
+	CFiles       []string
+	HFiles       []string
+	SFiles       []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+	EmbedFiles   []string
+	OtherFiles   []string
+}
+
+// ParseGoList reads the output of go list -json, mapping files of every package to
+// its import path. File names are relative to root, usually the module root.
+// Files outside of root, such as those of the standard library, are skipped.
+func ParseGoList(r io.Reader, root string) (Map, error) {
+	m := make(Map)
+	dec := json.NewDecoder(r)
+	for {
+		var p goPackage
+		if err := dec.Decode(&p); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading go list output: %w", err)
+		}
+
+		dir, err := filepath.Rel(root, p.Dir)
+		if err != nil || dir == ".." || strings.HasPrefix(dir, ".."+string(filepath.Separator)) {
+			continue
+		}
+		for _, files := range [][]string{p.GoFiles, p.CgoFiles, p.CFiles, p.HFiles, p.SFiles,
+			p.TestGoFiles, p.XTestGoFiles, p.EmbedFiles, p.OtherFiles} {
+			for _, f := range files {
+				m.add(path.Clean(filepath.ToSlash(filepath.Join(dir, f))), p.ImportPath)
+			}
+		}
+	}
+	return m, nil
+}
+
+// File is the entry of a changed file in a Report.
+type File struct {
+	Name    string `json:"name"`
+	Added   int    `json:"added"`
+	Deleted int    `json:"deleted"`
+	// Only is set for files which are present in one version only.
+	Only bool `json:"only,omitempty"`
+	// Targets lists the build targets impacted by changes of the file.
+	Targets []string `json:"targets,omitempty"`
+}
+
+// Report lists changed files and the build targets they impact.
+type Report struct {
+	// SchemaVersion is the version of schema.ImpactReport the report follows.
+	SchemaVersion int    `json:"schema_version"`
+	Files         []File `json:"files"`
+	// Targets lists all impacted targets, sorted and without duplicates.
+	Targets []string `json:"targets"`
+	// Unmapped lists changed files without targets, which may impact anything.
+	Unmapped []string `json:"unmapped,omitempty"`
+}
+
+// NewReport returns the report of files in stats, annotated with their targets
+// in m. m may be nil, leaving all files without targets.
+func NewReport(stats []patchutils.FileStat, m Map) *Report {
+	r := &Report{SchemaVersion: schema.Version, Files: make([]File, 0, len(stats)), Targets: []string{}}
+	all := make(map[string]bool)
+	for _, s := range stats {
+		f := File{Name: s.Name, Added: s.Added, Deleted: s.Deleted, Only: s.Only, Targets: m.Targets(s.Name)}
+		for _, t := range f.Targets {
+			all[t] = true
+		}
+		if m != nil && len(f.Targets) == 0 {
+			r.Unmapped = append(r.Unmapped, s.Name)
+		}
+		r.Files = append(r.Files, f)
+	}
+	for t := range all {
+		r.Targets = append(r.Targets, t)
+	}
+	sort.Strings(r.Targets)
+	return r
+}
+
+// Write writes r to w in JSON format.
+func (r *Report) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+	return nil
+}
+
+// ErrNoTargets indicates that a line of a mapping names a file without targets.
+var ErrNoTargets = errors.New("file without targets")
@@ -0,0 +1,139 @@
+package impact
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-patchutils"
+)
+
+const testLines = `# file targets
+pkg/a.go //pkg:a //pkg:all
+pkg/b.go //pkg:all
+
+pkg/a.go //pkg:a
+`
+
+var targetsTests = []struct {
+	file    string
+	targets []string
+}{
+	{file: "pkg/a.go", targets: []string{"//pkg:a", "//pkg:all"}},
+	{file: "b/pkg/b.go", targets: []string{"//pkg:all"}},
+	{file: "source_1_b/pkg/a.go", targets: []string{"//pkg:a", "//pkg:all"}},
+	{file: "a.go"},
+	{file: "other/c.go"},
+}
+
+func TestParseLines(t *testing.T) {
+	m, err := ParseLines(strings.NewReader(testLines))
+	if err != nil {
+		t.Fatalf("ParseLines: got error %v; want error nil", err)
+	}
+	for _, tt := range targetsTests {
+		if got := m.Targets(tt.file); !reflect.DeepEqual(got, tt.targets) {
+			t.Errorf("Targets(%q): got %q; want %q", tt.file, got, tt.targets)
+		}
+	}
+}
+
+func TestParseLinesNoTargets(t *testing.T) {
+	_, err := ParseLines(strings.NewReader("pkg/a.go //pkg:a\npkg/b.go\n"))
+	if !errors.Is(err, ErrNoTargets) {
+		t.Errorf("ParseLines: got error %v; want error %v", err, ErrNoTargets)
+	}
+}
+
+const testGoList = `{
+	"Dir": "/src/mod/foo",
+	"ImportPath": "example.com/mod/foo",
+	"GoFiles": ["foo.go"],
+	"TestGoFiles": ["foo_test.go"]
+}
+{
+	"Dir": "/src/mod",
+	"ImportPath": "example.com/mod",
+	"GoFiles": ["mod.go"],
+	"EmbedFiles": ["testdata/x.txt"]
+}
+{
+	"Dir": "/usr/lib/go/src/fmt",
+	"ImportPath": "fmt",
+	"GoFiles": ["print.go"]
+}
+`
+
+func TestParseGoList(t *testing.T) {
+	m, err := ParseGoList(strings.NewReader(testGoList), "/src/mod")
+	if err != nil {
+		t.Fatalf("ParseGoList: got error %v; want error nil", err)
+	}
+	want := Map{
+		"foo/foo.go":      {"example.com/mod/foo"},
+		"foo/foo_test.go": {"example.com/mod/foo"},
+		"mod.go":          {"example.com/mod"},
+		"testdata/x.txt":  {"example.com/mod"},
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("Map mismatch.\nGot:\n%v\nWant:\n%v\n", m, want)
+	}
+}
+
+func TestReport(t *testing.T) {
+	m, err := ParseLines(strings.NewReader(testLines))
+	if err != nil {
+		t.Fatalf("ParseLines: got error %v; want error nil", err)
+	}
+	stats := []patchutils.FileStat{
+		{Name: "b/pkg/a.go", Added: 1, Deleted: 2},
+		{Name: "b/pkg/b.go", Added: 3},
+		{Name: "b/README", Only: true},
+	}
+
+	var b bytes.Buffer
+	if err := NewReport(stats, m).Write(&b); err != nil {
+		t.Fatalf("Write: got error %v; want error nil", err)
+	}
+	want := `{
+  "schema_version": 1,
+  "files": [
+    {
+      "name": "b/pkg/a.go",
+      "added": 1,
+      "deleted": 2,
+      "targets": [
+        "//pkg:a",
+        "//pkg:all"
+      ]
+    },
+    {
+      "name": "b/pkg/b.go",
+      "added": 3,
+      "deleted": 0,
+      "targets": [
+        "//pkg:all"
+      ]
+    },
+    {
+      "name": "b/README",
+      "added": 0,
+      "deleted": 0,
+      "only": true
+    }
+  ],
+  "targets": [
+    "//pkg:a",
+    "//pkg:all"
+  ],
+  "unmapped": [
+    "b/README"
+  ]
+}
+`
+	if b.String() != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", b.String(), want)
+	}
+}
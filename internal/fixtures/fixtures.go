@@ -0,0 +1,416 @@
+// Package fixtures generates source trees and diffs in the layout of test_examples,
+// by mutating a source tree according to random or scripted profiles.
+package fixtures
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-patchutils"
+)
+
+// Op is the kind of a Mutation.
+type Op string
+
+// Kinds of mutations, as written in scripts.
+const (
+	// OpReplace replaces line Line of file Path with Text.
+	OpReplace Op = "replace"
+	// OpInsert inserts Text before line Line of file Path.
+	OpInsert Op = "insert"
+	// OpDelete deletes line Line of file Path.
+	OpDelete Op = "delete"
+	// OpAdd adds file Path containing the single line Text.
+	OpAdd Op = "add"
+	// OpRemove removes file Path.
+	OpRemove Op = "remove"
+)
+
+// Mutation is a single scripted change of a source tree.
+type Mutation struct {
+	Op   Op
+	Path string
+	// Line is 1-based. Inserting at the line after the last one appends.
+	Line int
+	Text string
+}
+
+// Profile describes how a source tree is mutated.
+type Profile struct {
+	// Seed initializes the generator of random mutations.
+	Seed int64
+	// RandomMutations is the number of random line mutations in every file.
+	RandomMutations int
+	// Script lists mutations applied after the random ones.
+	Script []Mutation
+}
+
+// defaultRandomMutations is the number of random mutations of "random:SEED" profiles.
+const defaultRandomMutations = 3
+
+// ParseProfile parses a profile specification: either "random:SEED[:MUTATIONS]"
+// or the path to a script file, as read by ParseScript.
+func ParseProfile(spec string) (Profile, error) {
+	if strings.HasPrefix(spec, "random:") {
+		fields := strings.Split(strings.TrimPrefix(spec, "random:"), ":")
+		if len(fields) > 2 {
+			return Profile{}, fmt.Errorf("profile %q: %w", spec, ErrBadProfile)
+		}
+		seed, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return Profile{}, fmt.Errorf("profile %q: seed: %w", spec, ErrBadProfile)
+		}
+		p := Profile{Seed: seed, RandomMutations: defaultRandomMutations}
+		if len(fields) == 2 {
+			if p.RandomMutations, err = strconv.Atoi(fields[1]); err != nil || p.RandomMutations < 0 {
+				return Profile{}, fmt.Errorf("profile %q: number of mutations: %w", spec, ErrBadProfile)
+			}
+		}
+		return p, nil
+	}
+
+	f, err := os.Open(spec)
+	if err != nil {
+		return Profile{}, fmt.Errorf("opening script: %w", err)
+	}
+	defer f.Close()
+
+	script, err := ParseScript(f)
+	if err != nil {
+		return Profile{}, fmt.Errorf("script %q: %w", spec, err)
+	}
+	return Profile{Script: script}, nil
+}
+
+// ParseScript reads mutations, one per line:
+//
+//	replace PATH LINE TEXT
+//	insert PATH LINE TEXT
+//	delete PATH LINE
+//	add PATH TEXT
+//	remove PATH
+//
+// Empty lines and lines starting with '#' are ignored.
+func ParseScript(r io.Reader) ([]Mutation, error) {
+	var script []Mutation
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.SplitN(line, " ", 4)
+		m := Mutation{Op: Op(fields[0])}
+		var err error
+		switch {
+		case (m.Op == OpReplace || m.Op == OpInsert) && len(fields) == 4:
+			m.Path, m.Text = fields[1], fields[3]
+			m.Line, err = strconv.Atoi(fields[2])
+		case m.Op == OpDelete && len(fields) == 3:
+			m.Path = fields[1]
+			m.Line, err = strconv.Atoi(fields[2])
+		case m.Op == OpAdd && len(fields) >= 3:
+			m.Path, m.Text = fields[1], strings.Join(fields[2:], " ")
+		case m.Op == OpRemove && len(fields) == 2:
+			m.Path = fields[1]
+		default:
+			err = ErrBadProfile
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d (%q): %w", n, line, ErrBadProfile)
+		}
+		script = append(script, m)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading script: %w", err)
+	}
+	return script, nil
+}
+
+// Mutate returns a copy of files, keyed by slash-separated path, mutated according to p.
+func Mutate(files map[string]string, p Profile) (map[string]string, error) {
+	var names []string
+	result := make(map[string][]string, len(files))
+	for name, content := range files {
+		names = append(names, name)
+		result[name] = splitLines(content)
+	}
+	// Random mutations must not depend on map order
+	sort.Strings(names)
+
+	rnd := rand.New(rand.NewSource(p.Seed))
+	for _, name := range names {
+		for k := 0; k < p.RandomMutations; k++ {
+			result[name] = randomMutation(rnd, result[name])
+		}
+	}
+
+	for _, m := range p.Script {
+		lines, ok := result[m.Path]
+		if !ok && m.Op != OpAdd {
+			return nil, fmt.Errorf("%s %q: %w", m.Op, m.Path, patchutils.ErrFileNotFound)
+		}
+
+		switch m.Op {
+		case OpAdd:
+			if ok {
+				return nil, fmt.Errorf("%s %q: %w", m.Op, m.Path, patchutils.ErrFileExists)
+			}
+			result[m.Path] = []string{m.Text}
+		case OpRemove:
+			delete(result, m.Path)
+		case OpInsert:
+			if m.Line < 1 || m.Line > len(lines)+1 {
+				return nil, fmt.Errorf("%s %q line %d: %w", m.Op, m.Path, m.Line, ErrLineOutOfRange)
+			}
+			result[m.Path] = insertLine(lines, m.Line-1, m.Text)
+		case OpReplace, OpDelete:
+			if m.Line < 1 || m.Line > len(lines) {
+				return nil, fmt.Errorf("%s %q line %d: %w", m.Op, m.Path, m.Line, ErrLineOutOfRange)
+			}
+			if m.Op == OpReplace {
+				lines[m.Line-1] = m.Text
+			} else {
+				result[m.Path] = append(lines[:m.Line-1:m.Line-1], lines[m.Line:]...)
+			}
+		default:
+			return nil, fmt.Errorf("%q: %w", m.Op, ErrBadProfile)
+		}
+	}
+
+	mutated := make(map[string]string, len(result))
+	for name, lines := range result {
+		mutated[name] = joinLines(lines)
+	}
+	return mutated, nil
+}
+
+// vocabulary is the words synthesized files are made of.
+var vocabulary = strings.Fields(`in to am attended desirous raptures declared diverted confined at
+collected instantly remaining up certainly necessary as over walk dull into son boy door went new
+or happiness commanded daughters is handsome an received extended vicinity subjects miss on he
+been late pain only week bore what fat case left use match round scale now style far times`)
+
+// Synthesize returns a tree of numFiles files, keyed by slash-separated path,
+// spread over directories nested depth levels deep. Every file has linesPerFile
+// lines of random words. The same seed gives the same tree.
+func Synthesize(seed int64, numFiles, depth, linesPerFile int) map[string]string {
+	rnd := rand.New(rand.NewSource(seed))
+	files := make(map[string]string, numFiles)
+	for k := 0; k < numFiles; k++ {
+		dir := ""
+		for d := 0; d < depth; d++ {
+			// Files share directories, so that trees are both deep and wide
+			dir += fmt.Sprintf("dir_%d_%d/", d, (k>>uint(d))%2)
+		}
+
+		lines := make([]string, linesPerFile)
+		for l := range lines {
+			words := make([]string, 3+rnd.Intn(10))
+			for w := range words {
+				words[w] = vocabulary[rnd.Intn(len(vocabulary))]
+			}
+			lines[l] = strings.Join(words, " ") + "."
+		}
+		files[fmt.Sprintf("%sfile_%d.txt", dir, k)] = joinLines(lines)
+	}
+	return files
+}
+
+// wordRegexp matches words of a line, which random mutations shuffle around.
+var wordRegexp = regexp.MustCompile(`\w+`)
+
+// randomMutation returns lines with a random line replaced, inserted or deleted.
+// New lines are built of words found in lines, so they look like the rest of the file.
+func randomMutation(rnd *rand.Rand, lines []string) []string {
+	var words []string
+	for _, line := range lines {
+		words = append(words, wordRegexp.FindAllString(line, -1)...)
+	}
+	newLine := func() string {
+		if len(words) == 0 {
+			return strconv.Itoa(rnd.Int())
+		}
+		n := 1 + rnd.Intn(8)
+		parts := make([]string, n)
+		for k := range parts {
+			parts[k] = words[rnd.Intn(len(words))]
+		}
+		return strings.Join(parts, " ") + "."
+	}
+
+	if len(lines) == 0 {
+		return []string{newLine()}
+	}
+	k := rnd.Intn(len(lines))
+	switch rnd.Intn(3) {
+	case 0:
+		result := append([]string(nil), lines...)
+		result[k] = newLine()
+		return result
+	case 1:
+		return insertLine(lines, k, newLine())
+	default:
+		return append(lines[:k:k], lines[k+1:]...)
+	}
+}
+
+// insertLine returns a copy of lines with text inserted at index k.
+func insertLine(lines []string, k int, text string) []string {
+	result := make([]string, 0, len(lines)+1)
+	result = append(result, lines[:k]...)
+	result = append(result, text)
+	return append(result, lines[k:]...)
+}
+
+// splitLines splits content into lines without their newlines.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// joinLines joins lines, terminating each one with a newline.
+func joinLines(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Generate writes a fixture set named name into outDir:
+// the source tree at sourceDir copied to name, its mutations according to a and b
+// in name_a and name_b, their diffs to the source in name_a.diff and name_b.diff,
+// and the interdiff of those in name_a_b.diff.
+// Names in diffs are relative to outDir, as in test_examples.
+// Fixtures are kept even if computing the interdiff fails, so the failure can be reproduced.
+func Generate(sourceDir, outDir, name string, a, b Profile) error {
+	files, err := readTree(sourceDir)
+	if err != nil {
+		return fmt.Errorf("reading source tree: %w", err)
+	}
+	filesA, err := Mutate(files, a)
+	if err != nil {
+		return fmt.Errorf("mutating with profile a: %w", err)
+	}
+	filesB, err := Mutate(files, b)
+	if err != nil {
+		return fmt.Errorf("mutating with profile b: %w", err)
+	}
+
+	trees := []struct {
+		dir   string
+		files map[string]string
+	}{
+		{name, files},
+		{name + "_a", filesA},
+		{name + "_b", filesB},
+	}
+	for _, tree := range trees {
+		if _, err := os.Stat(filepath.Join(outDir, tree.dir)); err == nil {
+			return fmt.Errorf("%q: %w", tree.dir, patchutils.ErrFileExists)
+		}
+	}
+	for _, tree := range trees {
+		if err := WriteTree(filepath.Join(outDir, tree.dir), tree.files); err != nil {
+			return fmt.Errorf("writing %q: %w", tree.dir, err)
+		}
+	}
+
+	diffA, err := diffTrees(outDir, name, name+"_a")
+	if err != nil {
+		return err
+	}
+	diffB, err := diffTrees(outDir, name, name+"_b")
+	if err != nil {
+		return err
+	}
+	for diffName, content := range map[string]string{name + "_a.diff": diffA, name + "_b.diff": diffB} {
+		if err := ioutil.WriteFile(filepath.Join(outDir, diffName), []byte(content), 0644); err != nil {
+			return fmt.Errorf("writing %q: %w", diffName, err)
+		}
+	}
+
+	result, err := patchutils.InterDiff(strings.NewReader(diffA), strings.NewReader(diffB))
+	if err != nil {
+		return fmt.Errorf("computing interdiff of %s_a.diff and %s_b.diff: %w", name, name, err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outDir, name+"_a_b.diff"), []byte(result), 0644); err != nil {
+		return fmt.Errorf("writing %q: %w", name+"_a_b.diff", err)
+	}
+	return nil
+}
+
+// diffTrees returns the diff of the oldDir and newDir trees in outDir, with names relative to outDir.
+func diffTrees(outDir, oldDir, newDir string) (string, error) {
+	result, err := patchutils.DiffPath(filepath.Join(outDir, oldDir), filepath.Join(outDir, newDir))
+	if err != nil {
+		return "", fmt.Errorf("computing diff of %q and %q: %w", oldDir, newDir, err)
+	}
+
+	prefix := filepath.ToSlash(filepath.Clean(outDir)) + "/"
+	if result == "" || prefix == "./" {
+		return result, nil
+	}
+	result, err = patchutils.RewritePatch(strings.NewReader(result), []patchutils.RewriteRule{{
+		Pattern: regexp.MustCompile("^" + regexp.QuoteMeta(prefix)),
+		Paths:   true,
+	}})
+	if err != nil {
+		return "", fmt.Errorf("making names of diff of %q and %q relative: %w", oldDir, newDir, err)
+	}
+	return result, nil
+}
+
+// readTree reads all regular files under root, keyed by slash-separated path.
+func readTree(root string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(content)
+		return nil
+	})
+	return files, err
+}
+
+// WriteTree writes files, keyed by slash-separated path, under root.
+func WriteTree(root string, files map[string]string) error {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ErrBadProfile indicates a malformed profile specification or script.
+var ErrBadProfile = errors.New("bad mutation profile")
+
+// ErrLineOutOfRange indicates that a scripted mutation refers to a line a file doesn't have.
+var ErrLineOutOfRange = errors.New("line out of range")
@@ -0,0 +1,236 @@
+package fixtures
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-patchutils"
+)
+
+var parseScriptTests = []struct {
+	name    string
+	script  string
+	result  []Mutation
+	wantErr error
+}{
+	{
+		name: "all operations",
+		script: `# comment
+replace a.txt 2 new text
+
+insert a.txt 1 first
+delete a.txt 3
+add dir/b.txt hello world
+remove c.txt
+`,
+		result: []Mutation{
+			{Op: OpReplace, Path: "a.txt", Line: 2, Text: "new text"},
+			{Op: OpInsert, Path: "a.txt", Line: 1, Text: "first"},
+			{Op: OpDelete, Path: "a.txt", Line: 3},
+			{Op: OpAdd, Path: "dir/b.txt", Text: "hello world"},
+			{Op: OpRemove, Path: "c.txt"},
+		},
+	},
+	{
+		name:    "unknown operation",
+		script:  "rename a.txt b.txt\n",
+		wantErr: ErrBadProfile,
+	},
+	{
+		name:    "bad line number",
+		script:  "delete a.txt two\n",
+		wantErr: ErrBadProfile,
+	},
+}
+
+func TestParseScript(t *testing.T) {
+	for _, tt := range parseScriptTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := ParseScript(strings.NewReader(tt.script))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParseScript: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseScript: got error %v; want error nil", err)
+			}
+			if !reflect.DeepEqual(currentResult, tt.result) {
+				t.Errorf("Result mismatch.\nGot:\n%v\nWant:\n%v\n", currentResult, tt.result)
+			}
+		})
+	}
+}
+
+var parseProfileTests = []struct {
+	spec    string
+	result  Profile
+	wantErr error
+}{
+	{spec: "random:42", result: Profile{Seed: 42, RandomMutations: defaultRandomMutations}},
+	{spec: "random:7:10", result: Profile{Seed: 7, RandomMutations: 10}},
+	{spec: "random:x", wantErr: ErrBadProfile},
+	{spec: "random:1:-1", wantErr: ErrBadProfile},
+}
+
+func TestParseProfile(t *testing.T) {
+	for _, tt := range parseProfileTests {
+		currentResult, err := ParseProfile(tt.spec)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ParseProfile(%q): got error %v; want error %v", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseProfile(%q): got error %v; want error nil", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(currentResult, tt.result) {
+			t.Errorf("ParseProfile(%q): got %+v; want %+v", tt.spec, currentResult, tt.result)
+		}
+	}
+}
+
+var mutateTests = []struct {
+	name    string
+	files   map[string]string
+	script  []Mutation
+	result  map[string]string
+	wantErr error
+}{
+	{
+		name:  "scripted mutations",
+		files: map[string]string{"a.txt": "one\ntwo\nthree\n", "b.txt": "b\n"},
+		script: []Mutation{
+			{Op: OpReplace, Path: "a.txt", Line: 2, Text: "TWO"},
+			{Op: OpInsert, Path: "a.txt", Line: 4, Text: "four"},
+			{Op: OpDelete, Path: "a.txt", Line: 1},
+			{Op: OpAdd, Path: "c.txt", Text: "c"},
+			{Op: OpRemove, Path: "b.txt"},
+		},
+		result: map[string]string{"a.txt": "TWO\nthree\nfour\n", "c.txt": "c\n"},
+	},
+	{
+		name:    "missing file",
+		files:   map[string]string{"a.txt": "one\n"},
+		script:  []Mutation{{Op: OpDelete, Path: "x.txt", Line: 1}},
+		wantErr: patchutils.ErrFileNotFound,
+	},
+	{
+		name:    "line out of range",
+		files:   map[string]string{"a.txt": "one\n"},
+		script:  []Mutation{{Op: OpReplace, Path: "a.txt", Line: 2, Text: "two"}},
+		wantErr: ErrLineOutOfRange,
+	},
+}
+
+func TestMutate(t *testing.T) {
+	for _, tt := range mutateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := Mutate(tt.files, Profile{Script: tt.script})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Mutate: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Mutate: got error %v; want error nil", err)
+			}
+			if !reflect.DeepEqual(currentResult, tt.result) {
+				t.Errorf("Result mismatch.\nGot:\n%v\nWant:\n%v\n", currentResult, tt.result)
+			}
+		})
+	}
+}
+
+func TestMutateRandomIsReproducible(t *testing.T) {
+	files := map[string]string{
+		"a.txt": "In to am attended desirous raptures declared diverted confined at.\nOver walk dull into son.\n",
+		"b.txt": "Plenty season beyond by hardly giving of.\n",
+	}
+	p := Profile{Seed: 1, RandomMutations: 5}
+
+	first, err := Mutate(files, p)
+	if err != nil {
+		t.Fatalf("Mutate: got error %v; want error nil", err)
+	}
+	second, err := Mutate(files, p)
+	if err != nil {
+		t.Fatalf("Mutate: got error %v; want error nil", err)
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("Mutate with the same seed differs.\nFirst:\n%v\nSecond:\n%v\n", first, second)
+	}
+	if reflect.DeepEqual(first, files) {
+		t.Errorf("Mutate didn't change files")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sourceDir := filepath.Join(dir, "src")
+	if err := WriteTree(sourceDir, map[string]string{"a.txt": "one\ntwo\nthree\n", "b.txt": "b\n"}); err != nil {
+		t.Fatal(err)
+	}
+	outDir := filepath.Join(dir, "out")
+	a := Profile{Script: []Mutation{{Op: OpReplace, Path: "a.txt", Line: 1, Text: "ONE"}}}
+	b := Profile{Script: []Mutation{{Op: OpReplace, Path: "a.txt", Line: 3, Text: "THREE"}, {Op: OpRemove, Path: "b.txt"}}}
+
+	if err := Generate(sourceDir, outDir, "g1", a, b); err != nil {
+		t.Fatalf("Generate: got error %v; want error nil", err)
+	}
+
+	wantFiles := map[string]string{
+		"g1/a.txt":   "one\ntwo\nthree\n",
+		"g1/b.txt":   "b\n",
+		"g1_a/a.txt": "ONE\ntwo\nthree\n",
+		"g1_a/b.txt": "b\n",
+		"g1_b/a.txt": "one\ntwo\nTHREE\n",
+		"g1_a.diff":  "--- g1/a.txt\n+++ g1_a/a.txt\n@@ -1,3 +1,3 @@\n-one\n+ONE\n two\n three\n",
+		"g1_b.diff":  "--- g1/a.txt\n+++ g1_b/a.txt\n@@ -1,3 +1,3 @@\n one\n two\n-three\n+THREE\nOnly in g1: b.txt\n",
+		"g1_a_b.diff": "--- g1_a/a.txt\n+++ g1_b/a.txt\n@@ -1,3 +1,3 @@\n+one\n-ONE\n two\n-three\n+THREE\n" +
+			"Only in g1: b.txt\n",
+	}
+	currentFiles, err := readTree(outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(currentFiles, wantFiles) {
+		t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", currentFiles, wantFiles)
+	}
+
+	if err := Generate(sourceDir, outDir, "g1", a, b); !errors.Is(err, patchutils.ErrFileExists) {
+		t.Errorf("Generate over existing fixtures: got error %v; want error %v", err, patchutils.ErrFileExists)
+	}
+}
+
+func TestSynthesize(t *testing.T) {
+	files := Synthesize(1, 10, 3, 20)
+	if len(files) != 10 {
+		t.Fatalf("Synthesize: got %d files; want 10", len(files))
+	}
+	for name, content := range files {
+		if got := strings.Count(name, "/"); got != 3 {
+			t.Errorf("Synthesize: %q is %d directories deep; want 3", name, got)
+		}
+		if got := strings.Count(content, "\n"); got != 20 {
+			t.Errorf("Synthesize: %q has %d lines; want 20", name, got)
+		}
+	}
+	if !reflect.DeepEqual(files, Synthesize(1, 10, 3, 20)) {
+		t.Errorf("Synthesize with the same seed differs")
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+// +build !windows
+
+package patchutils
+
+// longPath returns path. Only paths of Windows are limited in length.
+func longPath(path string) string {
+	return path
+}
@@ -0,0 +1,27 @@
+package patchutils
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxShortPath is the length from which paths need the \\?\ prefix, the limit
+// of directory names without it.
+const maxShortPath = 248
+
+// longPath returns path with the \\?\ prefix if it is too long for Windows
+// functions otherwise, made absolute as the prefix requires.
+func longPath(path string) string {
+	if strings.HasPrefix(path, `\\?\`) || len(path) < maxShortPath {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		// UNC path, \\server\share
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
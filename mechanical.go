@@ -0,0 +1,163 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-patchutils/textnorm"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// MechanicalRules describe changes which tools make, so that hunks reproducible
+// by them can be told apart from changes made by hand.
+type MechanicalRules struct {
+	// Rewrites are applied in order to the old version of every hunk, its context
+	// and deleted lines. Their AddedLines and Paths settings are ignored.
+	Rewrites []RewriteRule
+	// Gofmt treats changes of white space and line breaks in .go files as mechanical,
+	// which are all that gofmt changes without -r and -s.
+	Gofmt bool
+}
+
+// HunkClass tells whether a hunk of a patch is mechanical.
+type HunkClass struct {
+	// File is the new name of the changed file, or its old name if it is deleted.
+	File string
+	// Hunk is the index of the hunk in the file diff.
+	Hunk int
+	// Mechanical is set for hunks reproducible by the rules.
+	Mechanical bool
+}
+
+// ClassifyHunks returns the class of every hunk of patch under rules,
+// in the order of the hunks in patch.
+func ClassifyHunks(patch io.Reader, rules MechanicalRules) ([]HunkClass, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing patch: %w", err)
+	}
+
+	var classes []HunkClass
+	for _, fd := range fileDiffs {
+		name := fd.NewName
+		if isDevNull(name) {
+			name = fd.OrigName
+		}
+		for k, h := range fd.Hunks {
+			mechanical, err := isMechanicalHunk(name, h, rules)
+			if err != nil {
+				return nil, fmt.Errorf("classifying hunk %d of %q: %w", k+1, name, err)
+			}
+			classes = append(classes, HunkClass{File: name, Hunk: k, Mechanical: mechanical})
+		}
+	}
+	return classes, nil
+}
+
+// SplitMechanical splits patch into a patch of the hunks reproducible by rules
+// and a patch of the other ones, to be applied on top of the first one.
+// Changes without hunks, such as changes of mode and binary files, are manual.
+// Files without hunks of a class are left out of the patch of that class.
+func SplitMechanical(patch io.Reader, rules MechanicalRules) (mechanical, manual string, err error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", "", fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	var mechanicalDiffs, manualDiffs []*diff.FileDiff
+	for _, fd := range fileDiffs {
+		name := fd.NewName
+		if isDevNull(name) {
+			name = fd.OrigName
+		}
+		if len(fd.Hunks) == 0 {
+			manualDiffs = append(manualDiffs, fd)
+			continue
+		}
+
+		mechanicalFD, manualFD := *fd, *fd
+		mechanicalFD.Hunks, manualFD.Hunks = nil, nil
+		// delta is the number of lines the mechanical hunks so far add to the file
+		var delta int32
+		for k, h := range fd.Hunks {
+			ok, err := isMechanicalHunk(name, h, rules)
+			if err != nil {
+				return "", "", fmt.Errorf("classifying hunk %d of %q: %w", k+1, name, err)
+			}
+			copied := *h
+			if !ok {
+				// The manual patch applies to the file patched with mechanical hunks
+				copied.OrigStartLine += delta
+				manualFD.Hunks = append(manualFD.Hunks, &copied)
+				continue
+			}
+
+			// The mechanical patch leaves out lines added and deleted by manual hunks
+			position := h.OrigStartLine
+			if h.OrigLines == 0 {
+				position++
+			}
+			copied.NewStartLine = position + delta
+			if h.NewLines == 0 {
+				copied.NewStartLine--
+			}
+			delta += h.NewLines - h.OrigLines
+			mechanicalFD.Hunks = append(mechanicalFD.Hunks, &copied)
+		}
+		if len(mechanicalFD.Hunks) > 0 {
+			mechanicalDiffs = append(mechanicalDiffs, &mechanicalFD)
+		}
+		if len(manualFD.Hunks) > 0 {
+			manualDiffs = append(manualDiffs, &manualFD)
+		}
+	}
+
+	mechanicalResult, err := diff.PrintMultiFileDiff(mechanicalDiffs)
+	if err != nil {
+		return "", "", fmt.Errorf("printing mechanical patch: %w", err)
+	}
+	manualResult, err := diff.PrintMultiFileDiff(manualDiffs)
+	if err != nil {
+		return "", "", fmt.Errorf("printing manual patch: %w", err)
+	}
+	return string(mechanicalResult), string(manualResult), nil
+}
+
+// isMechanicalHunk reports whether rules turn the old version of hunk of file name
+// into its new version.
+func isMechanicalHunk(name string, hunk *diff.Hunk, rules MechanicalRules) (bool, error) {
+	lines, err := HunkLines(hunk)
+	if err != nil {
+		return false, err
+	}
+	var oldLines, newLines []string
+	for _, line := range lines {
+		if line.Op != OpAdd {
+			oldLines = append(oldLines, line.Text)
+		}
+		if line.Op != OpDelete {
+			newLines = append(newLines, line.Text)
+		}
+	}
+
+	rewritten := strings.Join(oldLines, "\n")
+	for _, rule := range rules.Rewrites {
+		// Lines are rewritten one by one, as RewritePatch does
+		lines := strings.Split(rewritten, "\n")
+		for k, line := range lines {
+			lines[k] = rule.Pattern.ReplaceAllString(line, rule.Replacement)
+		}
+		rewritten = strings.Join(lines, "\n")
+	}
+	want := strings.Join(newLines, "\n")
+
+	if rules.Gofmt && strings.HasSuffix(name, ".go") {
+		ignore := textnorm.Ignore{AllSpace: true}
+		return ignore.Key(rewritten) == ignore.Key(want), nil
+	}
+	return rewritten == want, nil
+}
@@ -0,0 +1,84 @@
+package patchutils
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const mechanicalSource = "package p\n\nfunc a() { foo() }\n\nx\ny\nz\n\nfunc b() {\n\tfoo()\n}\n\nq\nr\ns\n\nfunc  c() {}\n"
+
+const mechanicalPatch = `--- a/p.go
++++ b/p.go
+@@ -2,3 +2,3 @@
+ 
+-func a() { foo() }
++func a() { bar() }
+ 
+@@ -6,1 +6,2 @@
+ y
++added by hand
+@@ -9,3 +10,3 @@
+ func b() {
+-	foo()
++	bar()
+ }
+@@ -14,2 +15,0 @@
+-r
+-s
+@@ -17,1 +16,1 @@
+-func  c() {}
++func c() {}
+`
+
+var mechanicalRules = MechanicalRules{
+	Rewrites: []RewriteRule{{Pattern: regexp.MustCompile(`\bfoo\(`), Replacement: "bar("}},
+	Gofmt:    true,
+}
+
+func TestClassifyHunks(t *testing.T) {
+	classes, err := ClassifyHunks(strings.NewReader(mechanicalPatch), mechanicalRules)
+	if err != nil {
+		t.Fatalf("ClassifyHunks: got error %v; want error nil", err)
+	}
+	want := []HunkClass{
+		{File: "b/p.go", Hunk: 0, Mechanical: true},
+		{File: "b/p.go", Hunk: 1},
+		{File: "b/p.go", Hunk: 2, Mechanical: true},
+		{File: "b/p.go", Hunk: 3},
+		{File: "b/p.go", Hunk: 4, Mechanical: true},
+	}
+	if !reflect.DeepEqual(classes, want) {
+		t.Errorf("ClassifyHunks: got %+v; want %+v", classes, want)
+	}
+}
+
+func TestSplitMechanical(t *testing.T) {
+	mechanical, manual, err := SplitMechanical(strings.NewReader(mechanicalPatch), mechanicalRules)
+	if err != nil {
+		t.Fatalf("SplitMechanical: got error %v; want error nil", err)
+	}
+
+	apply := func(source, patch string) string {
+		t.Helper()
+		fd, err := diff.ParseFileDiff([]byte(patch))
+		if err != nil {
+			t.Fatalf("Error parsing diff: %v", err)
+		}
+		result, err := ApplyFileDiff(source, fd, ApplyOptions{})
+		if err != nil {
+			t.Fatalf("ApplyFileDiff: got error %v; want error nil\n%s", err, patch)
+		}
+		return result
+	}
+	want := apply(mechanicalSource, mechanicalPatch)
+	if got := apply(apply(mechanicalSource, mechanical), manual); got != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+	if strings.Contains(mechanical, "by hand") || strings.Contains(manual, "bar()") {
+		t.Errorf("Hunks split into wrong patches.\nMechanical:\n%s\nManual:\n%s\n", mechanical, manual)
+	}
+}
@@ -0,0 +1,187 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/google/go-patchutils/textnorm"
+	dbd "github.com/kylelemons/godebug/diff"
+)
+
+// MergeConflict is a region of the base changed differently by both patches given
+// to Merge.
+type MergeConflict struct {
+	// StartLine and EndLine are the first and the last line of the region in the
+	// base, counted from 1. For changes which only add lines, EndLine is
+	// StartLine-1 and the lines are added before StartLine.
+	StartLine, EndLine int
+	// Base, Ours and Theirs are the lines of the region in the base and as patched
+	// by ours and by theirs.
+	Base, Ours, Theirs []string
+}
+
+// Merge merges the diffs ours and theirs, both made against the same base file,
+// like a three-way merge: the result is a diff of base with the changes of both.
+// Changes of the same lines made by both are kept once if they agree, and are
+// returned as conflicts otherwise, with the changes of ours in the result.
+func Merge(base, ours, theirs io.Reader) (string, []MergeConflict, error) {
+	baseContent, err := readContent(base, textnorm.Options{})
+	if err != nil {
+		return "", nil, fmt.Errorf("reading base: %w", err)
+	}
+	oursD, err := readFileDiff(ours)
+	if err != nil {
+		return "", nil, fmt.Errorf("parsing ours: %w", err)
+	}
+	theirsD, err := readFileDiff(theirs)
+	if err != nil {
+		return "", nil, fmt.Errorf("parsing theirs: %w", err)
+	}
+
+	oursContent, err := applyDiff(baseContent, oursD, ApplyOptions{})
+	if err != nil {
+		return "", nil, fmt.Errorf("applying ours: %w", err)
+	}
+	theirsContent, err := applyDiff(baseContent, theirsD, ApplyOptions{})
+	if err != nil {
+		return "", nil, fmt.Errorf("applying theirs: %w", err)
+	}
+
+	baseLines := sourceLines(baseContent)
+	merged, conflicts := mergeChanges(baseLines,
+		lineChanges(baseLines, sourceLines(oursContent)),
+		lineChanges(baseLines, sourceLines(theirsContent)))
+	mergedContent := joinLines(merged)
+	if mergedContent == baseContent {
+		return "", conflicts, nil
+	}
+	result, err := diffContents(oursD.OrigName, oursD.NewName, baseContent, mergedContent)
+	if err != nil {
+		return "", nil, err
+	}
+	return result, conflicts, nil
+}
+
+// lineChange replaces lines start to end, exclusive and counted from 0, of a base
+// with lines.
+type lineChange struct {
+	start, end int
+	lines      []string
+}
+
+// lineChanges returns the changes turning baseLines into lines, in order.
+func lineChanges(baseLines, lines []string) []lineChange {
+	var changes []lineChange
+	// Chunks without equal lines are joined with the next ones into one change
+	pending := false
+	i := 0
+	for _, c := range dbd.DiffChunks(baseLines, lines) {
+		if len(c.Deleted) > 0 || len(c.Added) > 0 {
+			if !pending {
+				changes = append(changes, lineChange{start: i, end: i})
+			}
+			last := &changes[len(changes)-1]
+			last.end += len(c.Deleted)
+			last.lines = append(last.lines, c.Added...)
+		}
+		pending = len(c.Equal) == 0 && len(changes) > 0
+		i += len(c.Deleted) + len(c.Equal)
+	}
+	return changes
+}
+
+// overlaps reports whether c and d change common lines, or add lines at the same place.
+func (c lineChange) overlaps(d lineChange) bool {
+	if c.start == d.start {
+		return true
+	}
+	return c.start < d.end && d.start < c.end
+}
+
+// mergeChanges returns baseLines with the changes ours and theirs, both in order,
+// applied. Overlapping changes are applied once if they give the same lines, and
+// ours are applied and a conflict returned otherwise.
+func mergeChanges(baseLines []string, ours, theirs []lineChange) ([]string, []MergeConflict) {
+	var merged []string
+	var conflicts []MergeConflict
+	i := 0 // next line of baseLines to copy
+	for len(ours) > 0 || len(theirs) > 0 {
+		// Take the first change and all changes overlapping it, directly or not
+		var groupOurs, groupTheirs []lineChange
+		start, end := 0, 0
+		take := func(changes *[]lineChange, group *[]lineChange) {
+			c := (*changes)[0]
+			*changes = (*changes)[1:]
+			if len(groupOurs)+len(groupTheirs) == 0 {
+				start, end = c.start, c.end
+			}
+			if c.end > end {
+				end = c.end
+			}
+			*group = append(*group, c)
+		}
+		if len(theirs) == 0 || len(ours) > 0 && ours[0].start <= theirs[0].start {
+			take(&ours, &groupOurs)
+		} else {
+			take(&theirs, &groupTheirs)
+		}
+		for {
+			region := lineChange{start: start, end: end}
+			if len(ours) > 0 && region.overlaps(ours[0]) {
+				take(&ours, &groupOurs)
+			} else if len(theirs) > 0 && region.overlaps(theirs[0]) {
+				take(&theirs, &groupTheirs)
+			} else {
+				break
+			}
+		}
+
+		merged = append(merged, baseLines[i:start]...)
+		i = end
+		oursLines := applyLineChanges(baseLines, start, end, groupOurs)
+		if len(groupTheirs) == 0 {
+			merged = append(merged, oursLines...)
+			continue
+		}
+		theirsLines := applyLineChanges(baseLines, start, end, groupTheirs)
+		if len(groupOurs) > 0 && !equalLines(oursLines, theirsLines) {
+			conflicts = append(conflicts, MergeConflict{
+				StartLine: start + 1,
+				EndLine:   end,
+				Base:      baseLines[start:end],
+				Ours:      oursLines,
+				Theirs:    theirsLines,
+			})
+			merged = append(merged, oursLines...)
+			continue
+		}
+		merged = append(merged, theirsLines...)
+	}
+	return append(merged, baseLines[i:]...), conflicts
+}
+
+// applyLineChanges returns lines start to end of baseLines with changes, which
+// are in order and within them, applied.
+func applyLineChanges(baseLines []string, start, end int, changes []lineChange) []string {
+	var lines []string
+	i := start
+	for _, c := range changes {
+		lines = append(lines, baseLines[i:c.start]...)
+		lines = append(lines, c.lines...)
+		i = c.end
+	}
+	return append(lines, baseLines[i:end]...)
+}
+
+// equalLines reports whether a and b are the same lines.
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k := range a {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,165 @@
+package patchutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const mergeBase = "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+
+var mergeTests = []struct {
+	name      string
+	ours      string
+	theirs    string
+	result    string
+	conflicts []MergeConflict
+}{
+	{
+		name: "changes of other lines",
+		ours: `--- a/f.txt
++++ b/f.txt
+@@ -1,3 +1,3 @@
+-1
++one
+ 2
+ 3
+`,
+		theirs: `--- a/f.txt
++++ b/f.txt
+@@ -7,3 +7,4 @@
+ 7
+ 8
++8.5
+ 9
+`,
+		result: `--- a/f.txt
++++ b/f.txt
+@@ -1,3 +1,3 @@
+-1
++one
+ 2
+ 3
+@@ -7,3 +7,4 @@
+ 7
+ 8
++8.5
+ 9
+`,
+	},
+	{
+		name: "same change in both",
+		ours: `--- a/f.txt
++++ b/f.txt
+@@ -4,3 +4,3 @@
+ 4
+-5
++five
+ 6
+`,
+		theirs: `--- a/f.txt
++++ b/f.txt
+@@ -5,1 +5,1 @@
+-5
++five
+`,
+		result: `--- a/f.txt
++++ b/f.txt
+@@ -3,5 +3,5 @@
+ 3
+ 4
+-5
++five
+ 6
+ 7
+`,
+	},
+	{
+		name: "different changes of the same line",
+		ours: `--- a/f.txt
++++ b/f.txt
+@@ -5,1 +5,1 @@
+-5
++five
+`,
+		theirs: `--- a/f.txt
++++ b/f.txt
+@@ -4,2 +4,2 @@
+-4
+-5
++FOUR
++FIVE
+`,
+		result: `--- a/f.txt
++++ b/f.txt
+@@ -3,5 +3,5 @@
+ 3
+ 4
+-5
++five
+ 6
+ 7
+`,
+		conflicts: []MergeConflict{{
+			StartLine: 4,
+			EndLine:   5,
+			Base:      []string{"4", "5"},
+			Ours:      []string{"4", "five"},
+			Theirs:    []string{"FOUR", "FIVE"},
+		}},
+	},
+	{
+		name: "lines added at the same place",
+		ours: `--- a/f.txt
++++ b/f.txt
+@@ -9,1 +9,2 @@
+ 9
++ours
+`,
+		theirs: `--- a/f.txt
++++ b/f.txt
+@@ -9,1 +9,2 @@
+ 9
++theirs
+`,
+		result: `--- a/f.txt
++++ b/f.txt
+@@ -8,2 +8,3 @@
+ 8
+ 9
++ours
+`,
+		conflicts: []MergeConflict{{
+			StartLine: 10,
+			EndLine:   9,
+			Base:      []string{},
+			Ours:      []string{"ours"},
+			Theirs:    []string{"theirs"},
+		}},
+	},
+}
+
+func TestMerge(t *testing.T) {
+	for _, tt := range mergeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, conflicts, err := Merge(strings.NewReader(mergeBase), strings.NewReader(tt.ours), strings.NewReader(tt.theirs))
+			if err != nil {
+				t.Fatalf("Merge: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+			if !reflect.DeepEqual(conflicts, tt.conflicts) {
+				t.Errorf("Conflicts mismatch.\nGot:\n%+v\nWant:\n%+v\n", conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMergeNotApplying(t *testing.T) {
+	ours := "--- a/f.txt\n+++ b/f.txt\n@@ -1,1 +1,1 @@\n-x\n+y\n"
+	_, _, err := Merge(strings.NewReader(mergeBase), strings.NewReader(ours), strings.NewReader(ours))
+	if err == nil {
+		t.Errorf("Merge of a diff not applying to base: got error nil; want error")
+	}
+}
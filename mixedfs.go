@@ -0,0 +1,73 @@
+//go:build go1.16
+// +build go1.16
+
+package patchutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+)
+
+// MixedModeFS is like MixedModePath for the trees of oldFS and newFS, such as an
+// embed.FS, a fstest.MapFS or the tree of a zip archive from ZipFS, instead of
+// directories of the OS filesystem. Names in the diffs are relative to the roots
+// of the filesystems, after StripLevel leading components are removed.
+func MixedModeFS(oldFS, newFS fs.FS, oldDiff, newDiff io.Reader) (string, error) {
+	return MixedModeFSWithOptions(oldFS, newFS, oldDiff, newDiff, MixedModeOptions{})
+}
+
+// MixedModeFSWithOptions is like MixedModeFS, but configured by opts.
+func MixedModeFSWithOptions(oldFS, newFS fs.FS, oldDiff, newDiff io.Reader, opts MixedModeOptions) (string, error) {
+	oldDiff, err := normalizedDiff(oldDiff, opts.Normalize)
+	if err != nil {
+		return "", fmt.Errorf("reading oldDiff: %w", err)
+	}
+	newDiff, err = normalizedDiff(newDiff, opts.Normalize)
+	if err != nil {
+		return "", fmt.Errorf("reading newDiff: %w", err)
+	}
+
+	var result strings.Builder
+	if err := mixedModeDirPath(context.Background(), &result, fsFiles{oldFS}, fsFiles{newFS}, "", "", oldDiff, newDiff, opts); err != nil {
+		return keptResult(opts.Newlines.result(result.String()), fmt.Errorf("compute diff: %w", err))
+	}
+	return opts.Newlines.result(result.String()), nil
+}
+
+// fsFiles are the files of fsys. Their paths are slash-separated, like paths of
+// osFiles, and the empty root stands for the root of fsys.
+type fsFiles struct {
+	fsys fs.FS
+}
+
+func (f fsFiles) walk(root string, exclude excludePatterns) ([]string, error) {
+	start := filepath.ToSlash(root)
+	if root == "" {
+		start = "."
+	}
+	var allFiles []string
+	err := fs.WalkDir(f.fsys, start, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk into %q: %w", path, err)
+		}
+		if path != start && exclude.excluded(relativeSourcePath(path, root), d.IsDir()) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			allFiles = append(allFiles, path)
+		}
+		return nil
+	})
+	return allFiles, err
+}
+
+func (f fsFiles) open(path string) (io.ReadCloser, error) {
+	return f.fsys.Open(filepath.ToSlash(path))
+}
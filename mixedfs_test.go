@@ -0,0 +1,274 @@
+//go:build go1.16
+// +build go1.16
+
+package patchutils
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+var mixedModeFSOld = fstest.MapFS{
+	"a.txt":     {Data: []byte("one\ntwo\nthree\n")},
+	"sub/b.txt": {Data: []byte("x\ny\n")},
+	"gone.txt":  {Data: []byte("gone\n")},
+}
+
+var mixedModeFSNew = fstest.MapFS{
+	"a.txt":     {Data: []byte("zero\none\ntwo\nthree\n")},
+	"sub/b.txt": {Data: []byte("x\ny\n")},
+	"sub/c.txt": {Data: []byte("c\n")},
+}
+
+const mixedModeFSOldDiff = `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+`
+
+const mixedModeFSNewDiff = `--- a/a.txt
++++ b/a.txt
+@@ -1,4 +1,4 @@
+ zero
+ one
+-two
++TWO
+ three
+--- a/sub/b.txt
++++ b/sub/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+`
+
+const mixedModeFSResult = `--- a.txt
++++ a.txt
+@@ -1,2 +1,3 @@
++zero
+ one
+ TWO
+Only in .: gone.txt
+--- 
++++ sub/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+Only in sub: c.txt
+`
+
+func TestMixedModeFS(t *testing.T) {
+	result, err := MixedModeFSWithOptions(mixedModeFSOld, mixedModeFSNew,
+		strings.NewReader(mixedModeFSOldDiff), strings.NewReader(mixedModeFSNewDiff), MixedModeOptions{StripLevel: 1})
+	if err != nil {
+		t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+	}
+	if result != mixedModeFSResult {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, mixedModeFSResult)
+	}
+}
+
+func TestMixedModeFSPathMapper(t *testing.T) {
+	// The old diff was made in a build root, where sources are in out/src
+	oldDiff := strings.ReplaceAll(mixedModeFSOldDiff, "a/a.txt", "a/out/src/a.txt")
+	oldDiff = strings.ReplaceAll(oldDiff, "b/a.txt", "b/out/src/a.txt")
+	mapper := func(name string, side Side) string {
+		if side == OldSide {
+			return strings.TrimPrefix(name, "out/src/")
+		}
+		return name
+	}
+	result, err := MixedModeFSWithOptions(mixedModeFSOld, mixedModeFSNew,
+		strings.NewReader(oldDiff), strings.NewReader(mixedModeFSNewDiff),
+		MixedModeOptions{StripLevel: 1, PathMapper: mapper})
+	if err != nil {
+		t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+	}
+	if result != mixedModeFSResult {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, mixedModeFSResult)
+	}
+}
+
+func TestMixedModeFSBackslashes(t *testing.T) {
+	// Diffs made on Windows separate path components with backslashes
+	oldDiff := strings.ReplaceAll(mixedModeFSOldDiff, "/", `\`)
+	newDiff := strings.ReplaceAll(mixedModeFSNewDiff, "/", `\`)
+	result, err := MixedModeFSWithOptions(mixedModeFSOld, mixedModeFSNew,
+		strings.NewReader(oldDiff), strings.NewReader(newDiff), MixedModeOptions{StripLevel: 1})
+	if err != nil {
+		t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+	}
+	if result != mixedModeFSResult {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, mixedModeFSResult)
+	}
+}
+
+var mixedModeFSBinaryTests = []struct {
+	name string
+	opts MixedModeOptions
+	want string
+}{
+	{
+		name: "NUL bytes",
+		want: `--- a.txt
++++ a.txt
+@@ -1,1 +1,2 @@
+ ONE
++two
+Binary files img.bin and img.bin differ
+`,
+	},
+	{
+		name: "size",
+		opts: MixedModeOptions{MaxTextSize: 6},
+		want: "Binary files a.txt and a.txt differ\nBinary files img.bin and img.bin differ\n",
+	},
+	{
+		name: "text",
+		opts: MixedModeOptions{MaxTextSize: 6, Text: true, ExcludeGlobs: []string{"*.bin", "same"}},
+		want: "--- a.txt\n+++ a.txt\n@@ -1,1 +1,2 @@\n ONE\n+two\n",
+	},
+}
+
+func TestMixedModeFSBinary(t *testing.T) {
+	oldFS := fstest.MapFS{
+		"a.txt":   {Data: []byte("one\n")},
+		"img.bin": {Data: []byte("\x00old\n")},
+		"same":    {Data: []byte("\x00same\n")},
+	}
+	newFS := fstest.MapFS{
+		"a.txt":   {Data: []byte("one\ntwo\n")},
+		"img.bin": {Data: []byte("\x00new\n")},
+		"same":    {Data: []byte("\x00same\n")},
+	}
+	for _, tt := range mixedModeFSBinaryTests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := "--- a.txt\n+++ a.txt\n@@ -1,1 +1,1 @@\n-one\n+ONE\n"
+			result, err := MixedModeFSWithOptions(oldFS, newFS, strings.NewReader(d), strings.NewReader(d), tt.opts)
+			if err != nil {
+				t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+			}
+			if result != tt.want {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestMixedModeFSMatchesPath(t *testing.T) {
+	open := func() (*os.File, *os.File) {
+		t.Helper()
+		oldDiff, err := os.Open(testFile("s1_a_git.diff"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		newDiff, err := os.Open(testFile("s1_b_c_git.diff"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return oldDiff, newDiff
+	}
+	opts := MixedModeOptions{StripLevel: 1}
+
+	oldDiff, newDiff := open()
+	defer oldDiff.Close()
+	defer newDiff.Close()
+	want, err := MixedModePathWithOptions("source_1", "source_1_b", oldDiff, newDiff,
+		MixedModeOptions{StripLevel: 1, Dir: testFilesDir})
+	if err != nil {
+		t.Fatalf("MixedModePath: got error %v; want error nil", err)
+	}
+
+	oldDiff, newDiff = open()
+	defer oldDiff.Close()
+	defer newDiff.Close()
+	result, err := MixedModeFSWithOptions(os.DirFS(testFile("source_1")), os.DirFS(testFile("source_1_b")), oldDiff, newDiff, opts)
+	if err != nil {
+		t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestMixedModeFSAddedFiles(t *testing.T) {
+	oldFS := fstest.MapFS{"a.txt": {Data: []byte("a\n")}}
+	newFS := fstest.MapFS{"a.txt": {Data: []byte("a\n")}, "b.txt": {Data: []byte("b\n")}}
+	oldDiff := `diff --git a/b.txt b/b.txt
+new file mode 100644
+--- /dev/null
++++ b/b.txt
+@@ -0,0 +1 @@
++b
+diff --git a/a.txt b/a.txt
+deleted file mode 100644
+--- a/a.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-a
+`
+	newDiff := `--- a/b.txt
++++ b/b.txt
+@@ -1 +1 @@
+-b
++B
+--- a/a.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-a
+`
+	want := `diff --git a/b.txt b/b.txt
+--- a/b.txt
++++ b/b.txt
+@@ -1,1 +1,1 @@
+-b
++B
+`
+	result, err := MixedModeFSWithOptions(oldFS, newFS,
+		strings.NewReader(oldDiff), strings.NewReader(newDiff), MixedModeOptions{StripLevel: 1})
+	if err != nil {
+		t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestMixedModeFSNewFile(t *testing.T) {
+	want := `--- a.txt
++++ a.txt
+@@ -1,2 +1,3 @@
++zero
+ one
+ TWO
+--- gone.txt
++++ /dev/null
+@@ -1,1 +0,0 @@
+-gone
+--- 
++++ sub/b.txt
+@@ -1,2 +1,2 @@
+ x
+-y
++Y
+--- /dev/null
++++ sub/c.txt
+@@ -0,0 +1,1 @@
++c
+`
+	result, err := MixedModeFSWithOptions(mixedModeFSOld, mixedModeFSNew,
+		strings.NewReader(mixedModeFSOldDiff), strings.NewReader(mixedModeFSNewDiff),
+		MixedModeOptions{StripLevel: 1, NewFile: true})
+	if err != nil {
+		t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
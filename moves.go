@@ -0,0 +1,194 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// DefaultMinMoveLines is the default minimum number of lines of a moved block.
+const DefaultMinMoveLines = 3
+
+// Move is a block of lines deleted in one place of a file diff and added
+// unchanged in another.
+type Move struct {
+	// OrigStart is the first line of the block in the original file,
+	// NewStart the first line in the new one.
+	OrigStart, NewStart int32
+	Lines               int
+}
+
+// movedLine is a line deleted or added by a file diff.
+type movedLine struct {
+	text string
+	// line is the number of the line in the original file for deleted lines,
+	// and in the new file for added lines
+	line  int32
+	moved bool
+}
+
+// FindMoves returns the blocks of at least minLines lines which fileDiff deletes
+// in one place and adds in another, longest first, like git diff --color-moved
+// finds them. Blocks of blank lines only aren't moves. A minLines of 0 stands for
+// DefaultMinMoveLines.
+func FindMoves(fileDiff *diff.FileDiff, minLines int) []Move {
+	if minLines <= 0 {
+		minLines = DefaultMinMoveLines
+	}
+
+	var deleted, added []*movedLine
+	for _, h := range fileDiff.Hunks {
+		origLine, newLine := h.OrigStartLine, h.NewStartLine
+		for _, line := range strings.Split(strings.TrimSuffix(string(h.Body), "\n"), "\n") {
+			switch {
+			case strings.HasPrefix(line, "-"):
+				deleted = append(deleted, &movedLine{text: line[1:], line: origLine})
+				origLine++
+			case strings.HasPrefix(line, "+"):
+				added = append(added, &movedLine{text: line[1:], line: newLine})
+				newLine++
+			case strings.HasPrefix(line, `\`):
+			default:
+				origLine++
+				newLine++
+			}
+		}
+	}
+
+	addedAt := make(map[string][]int)
+	for j, l := range added {
+		addedAt[l.text] = append(addedAt[l.text], j)
+	}
+	// length returns the number of lines of the block starting at deleted[i] and added[j]
+	length := func(i, j int) int {
+		n := 0
+		for i+n < len(deleted) && j+n < len(added) {
+			d, a := deleted[i+n], added[j+n]
+			if d.moved || a.moved || d.text != a.text ||
+				(n > 0 && (d.line != deleted[i+n-1].line+1 || a.line != added[j+n-1].line+1)) {
+				break
+			}
+			n++
+		}
+		return n
+	}
+
+	var moves []Move
+	for {
+		// Longest blocks are taken first, so that they aren't cut by shorter ones
+		best := Move{}
+		bestI, bestJ := 0, 0
+		for i := range deleted {
+			for _, j := range addedAt[deleted[i].text] {
+				if n := length(i, j); n > best.Lines && !blankLines(deleted[i:i+n]) {
+					best = Move{OrigStart: deleted[i].line, NewStart: added[j].line, Lines: n}
+					bestI, bestJ = i, j
+				}
+			}
+		}
+		if best.Lines < minLines {
+			return moves
+		}
+		for k := 0; k < best.Lines; k++ {
+			deleted[bestI+k].moved = true
+			added[bestJ+k].moved = true
+		}
+		moves = append(moves, best)
+	}
+}
+
+// blankLines reports whether all lines are blank.
+func blankLines(lines []*movedLine) bool {
+	for _, l := range lines {
+		if strings.TrimSpace(l.text) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Colors of moved lines, the defaults of git diff --color-moved.
+const (
+	colorOldMoved = "\x1b[1;35m"
+	colorNewMoved = "\x1b[1;36m"
+	colorReset    = "\x1b[m"
+)
+
+// ColorMoved returns patch with the lines of blocks moved within a file, found
+// by FindMoves, colored like git diff --color-moved does: deleted lines of moves
+// in bold magenta and added ones in bold cyan. Other text is left as it is.
+func ColorMoved(patch io.Reader, minLines int) (string, error) {
+	content, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return "", fmt.Errorf("reading patch: %w", err)
+	}
+
+	preamble, sections := splitPatch(string(content))
+	var result strings.Builder
+	result.WriteString(preamble)
+	for _, section := range sections {
+		fd, err := diff.ParseFileDiff([]byte(section))
+		if err != nil || len(fd.Hunks) == 0 {
+			// "Only in" entries and changes without hunks don't move lines
+			result.WriteString(section)
+			continue
+		}
+		result.WriteString(colorMovedLines(section, FindMoves(fd, minLines)))
+	}
+	return result.String(), nil
+}
+
+// colorMovedLines returns the text of a file diff with lines of moves colored.
+func colorMovedLines(section string, moves []Move) string {
+	if len(moves) == 0 {
+		return section
+	}
+	within := func(line, start int32, lines int) bool {
+		return line >= start && line < start+int32(lines)
+	}
+
+	var b strings.Builder
+	var origLine, newLine int32
+	inHunk := false
+	for _, line := range strings.SplitAfter(section, "\n") {
+		if m := hunkHeaderRegexp.FindString(line); m != "" {
+			fmt.Sscanf(m, "@@ -%d", &origLine)
+			fmt.Sscanf(m[strings.Index(m, "+"):], "+%d", &newLine)
+			inHunk = true
+			b.WriteString(line)
+			continue
+		}
+		color := ""
+		switch {
+		case !inHunk:
+		case strings.HasPrefix(line, "-"):
+			for _, m := range moves {
+				if within(origLine, m.OrigStart, m.Lines) {
+					color = colorOldMoved
+				}
+			}
+			origLine++
+		case strings.HasPrefix(line, "+"):
+			for _, m := range moves {
+				if within(newLine, m.NewStart, m.Lines) {
+					color = colorNewMoved
+				}
+			}
+			newLine++
+		case strings.HasPrefix(line, `\`):
+		default:
+			origLine++
+			newLine++
+		}
+		if color == "" {
+			b.WriteString(line)
+			continue
+		}
+		text := strings.TrimSuffix(line, "\n")
+		b.WriteString(color + text + colorReset + line[len(text):])
+	}
+	return b.String()
+}
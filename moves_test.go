@@ -0,0 +1,79 @@
+package patchutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const movesDiff = `--- a/f
++++ b/f
+@@ -1,7 +1,3 @@
+-one
+-two
+-three
+ x
+-changed
++CHANGED
+ y
+-
+-
+@@ -10,2 +6,7 @@
+ z
++one
++two
++three
++
++
+ end
+`
+
+var findMovesTests = []struct {
+	name     string
+	minLines int
+	moves    []Move
+}{
+	{
+		name:  "default minimum",
+		moves: []Move{{OrigStart: 1, NewStart: 7, Lines: 3}},
+	},
+	{
+		name:     "block shorter than minimum",
+		minLines: 4,
+	},
+}
+
+func TestFindMoves(t *testing.T) {
+	fd, err := diff.ParseFileDiff([]byte(movesDiff))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+	for _, tt := range findMovesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if moves := FindMoves(fd, tt.minLines); !reflect.DeepEqual(moves, tt.moves) {
+				t.Errorf("FindMoves: got %+v; want %+v", moves, tt.moves)
+			}
+		})
+	}
+}
+
+func TestColorMoved(t *testing.T) {
+	patch := "Only in dir: g\n" + movesDiff
+	result, err := ColorMoved(strings.NewReader(patch), 0)
+	if err != nil {
+		t.Fatalf("ColorMoved: got error %v; want error nil", err)
+	}
+	want := strings.NewReplacer(
+		"-one\n", "\x1b[1;35m-one\x1b[m\n",
+		"-two\n", "\x1b[1;35m-two\x1b[m\n",
+		"-three\n", "\x1b[1;35m-three\x1b[m\n",
+		"+one\n", "\x1b[1;36m+one\x1b[m\n",
+		"+two\n", "\x1b[1;36m+two\x1b[m\n",
+		"+three\n", "\x1b[1;36m+three\x1b[m\n",
+	).Replace(patch)
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, want)
+	}
+}
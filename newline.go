@@ -0,0 +1,103 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+)
+
+// NewlineMode tells how line endings of sources are compared to lines of diffs,
+// and how line endings of results are written. Diffs are parsed with "\r\n" line
+// endings read as "\n" in every mode.
+type NewlineMode int
+
+const (
+	// NewlineExact compares lines with their line endings byte by byte, so that
+	// lines of sources with "\r\n" line endings don't match lines of diffs, and
+	// leaves line endings as they are.
+	NewlineExact NewlineMode = iota
+	// NewlinePreserve ignores a "\r" at the end of lines when they are compared,
+	// and keeps the line endings of sources. Lines added to a source get the line
+	// ending of its first line.
+	NewlinePreserve
+	// NewlineLF converts "\r\n" line endings of sources into "\n" before they are
+	// patched, and writes results with "\n" line endings.
+	NewlineLF
+	// NewlineCRLF converts line endings of sources like NewlineLF, and writes
+	// results with "\r\n" line endings.
+	NewlineCRLF
+)
+
+// ParseNewlineMode returns the NewlineMode named name, "exact", "preserve", "lf"
+// or "crlf".
+func ParseNewlineMode(name string) (NewlineMode, error) {
+	switch name {
+	case "exact":
+		return NewlineExact, nil
+	case "preserve":
+		return NewlinePreserve, nil
+	case "lf":
+		return NewlineLF, nil
+	case "crlf":
+		return NewlineCRLF, nil
+	}
+	return 0, fmt.Errorf("%q: %w", name, ErrUnknownNewlineMode)
+}
+
+// source returns content of a source converted as configured by m.
+func (m NewlineMode) source(content string) string {
+	if m == NewlineLF || m == NewlineCRLF {
+		return strings.ReplaceAll(content, "\r\n", "\n")
+	}
+	return content
+}
+
+// result returns content of a result, with "\n" line endings, written as
+// configured by m.
+func (m NewlineMode) result(content string) string {
+	if m == NewlineCRLF {
+		return strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	return content
+}
+
+// writer returns a writer writing results to w as configured by m.
+func (m NewlineMode) writer(w io.Writer) io.Writer {
+	if m == NewlineCRLF {
+		return crlfWriter{w}
+	}
+	return w
+}
+
+// crlfWriter writes to w with "\n" line endings turned into "\r\n".
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (cw crlfWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(cw.w, strings.ReplaceAll(string(p), "\n", "\r\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// hasCRLF reports whether the first line of content ends with "\r\n".
+func hasCRLF(content string) bool {
+	end := strings.IndexByte(content, '\n')
+	return end > 0 && content[end-1] == '\r'
+}
+
+// withCR returns line, as returned by sourceLines or hunks.Lines, ending with "\r",
+// unless it is a last line without newline.
+func withCR(line string) string {
+	if strings.HasSuffix(line, "\r") || strings.HasSuffix(line, hunks.NoNewlineSuffix) {
+		return line
+	}
+	return line + "\r"
+}
+
+// ErrUnknownNewlineMode indicates that a name of NewlineMode isn't known.
+var ErrUnknownNewlineMode = errors.New("unknown newline mode")
@@ -0,0 +1,122 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+const newlineDiff = "--- f\n+++ f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"
+
+var newlineModeTests = []struct {
+	name    string
+	source  string
+	mode    NewlineMode
+	result  string
+	wantErr error
+}{
+	{
+		name:    "exact",
+		source:  "a\r\nb\r\nc\r\n",
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:   "preserve",
+		source: "a\r\nb\r\nc\r\n",
+		mode:   NewlinePreserve,
+		result: "a\r\nB\r\nc\r\n",
+	},
+	{
+		name:   "preserve unix newlines",
+		source: "a\nb\nc\n",
+		mode:   NewlinePreserve,
+		result: "a\nB\nc\n",
+	},
+	{
+		name:   "lf",
+		source: "a\r\nb\r\nc\n",
+		mode:   NewlineLF,
+		result: "a\nB\nc\n",
+	},
+	{
+		name:   "crlf",
+		source: "a\nb\r\nc\n",
+		mode:   NewlineCRLF,
+		result: "a\r\nB\r\nc\r\n",
+	},
+}
+
+func TestApplyFileDiffNewlines(t *testing.T) {
+	for _, tt := range newlineModeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			fd, err := diff.ParseFileDiff([]byte(newlineDiff))
+			if err != nil {
+				t.Fatalf("Error parsing diff: %v", err)
+			}
+
+			result, err := ApplyFileDiff(tt.source, fd, ApplyOptions{Newlines: tt.mode})
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ApplyFileDiff: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ApplyFileDiff: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, tt.result)
+			}
+		})
+	}
+}
+
+func TestMixedModeNewlines(t *testing.T) {
+	oldDiff := "--- a\r\n+++ a\r\n@@ -1,1 +1,1 @@\r\n-a\r\n+A\r\n"
+	newDiff := "--- b\n+++ b\n@@ -1,1 +1,1 @@\n-a\n+A\n"
+	for _, tt := range []struct {
+		mode   NewlineMode
+		result string
+	}{
+		{NewlinePreserve, "--- a\n+++ b\n@@ -1,3 +1,3 @@\n A\r\n b\r\n-c\r\n+C\n"},
+		{NewlineCRLF, "--- a\r\n+++ b\r\n@@ -1,3 +1,3 @@\r\n A\r\n b\r\n-c\r\n+C\r\n"},
+	} {
+		result, err := MixedModeFileWithOptions(strings.NewReader("a\r\nb\r\nc\r\n"), strings.NewReader("a\nb\nC\n"),
+			strings.NewReader(oldDiff), strings.NewReader(newDiff), MixedModeOptions{Newlines: tt.mode})
+		if err != nil {
+			t.Fatalf("MixedModeFileWithOptions: got error %v; want error nil", err)
+		}
+		if result != tt.result {
+			t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, tt.result)
+		}
+	}
+}
+
+func TestInterDiffNewlines(t *testing.T) {
+	result, err := InterDiffWithOptions(strings.NewReader("--- x\r\n+++ x\r\n@@ -1,1 +1,1 @@\r\n-1\r\n+2\r\n"),
+		strings.NewReader("--- x\n+++ x\n@@ -1,1 +1,1 @@\n-1\n+3\n"), InterDiffOptions{Newlines: NewlineCRLF})
+	if err != nil {
+		t.Fatalf("InterDiffWithOptions: got error %v; want error nil", err)
+	}
+	if want := "--- x\r\n+++ x\r\n@@ -1,1 +1,1 @@\r\n-2\r\n+3\r\n"; result != want {
+		t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", result, want)
+	}
+}
+
+func TestParseNewlineMode(t *testing.T) {
+	for name, want := range map[string]NewlineMode{
+		"exact":    NewlineExact,
+		"preserve": NewlinePreserve,
+		"lf":       NewlineLF,
+		"crlf":     NewlineCRLF,
+	} {
+		if got, err := ParseNewlineMode(name); err != nil || got != want {
+			t.Errorf("ParseNewlineMode(%q) = %v, %v; want %v, nil", name, got, err, want)
+		}
+	}
+	if _, err := ParseNewlineMode("dos"); !errors.Is(err, ErrUnknownNewlineMode) {
+		t.Errorf("ParseNewlineMode(%q): got error %v; want error %v", "dos", err, ErrUnknownNewlineMode)
+	}
+}
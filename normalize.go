@@ -0,0 +1,172 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// NormalizeOptions configures Normalize. The zero value sorts files in DiffOrder,
+// keeps DefaultContextLines unchanged lines around changes and names files with
+// a/ and b/ prefixes.
+type NormalizeOptions struct {
+	// Order is the order files are sorted in, by their names without prefixes.
+	Order FileOrder
+	// ContextLines is the number of unchanged lines kept around changes; 0 stands
+	// for DefaultContextLines and NoContext for none. Hunks never get more unchanged
+	// lines than they have, and are split where changes are farther apart.
+	ContextLines int
+	// NoPrefix names files without a/ and b/ prefixes, like git diff --no-prefix.
+	NoPrefix bool
+}
+
+// Normalize returns patch rewritten into a canonical form, so that patches making
+// the same changes the same way are byte-identical, e.g. to diff patches or to use
+// them as cache keys: files are sorted, hunks keep opts.ContextLines unchanged lines
+// and are recounted like Recount does, timestamps are dropped, and names lose the
+// leading component telling the sides of the diff apart, such as a/ and b/ or the
+// directories of diff -r, for a/ and b/ prefixes.
+func Normalize(patch io.Reader, opts NormalizeOptions) (string, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	names := make(map[*diff.FileDiff]string)
+	for _, fd := range fileDiffs {
+		if fd.NewName == "" {
+			// "Only in" entry
+			names[fd] = stripPath(fd.OrigName, 1)
+			continue
+		}
+		origName, newName := unprefixedNames(fd.OrigName, fd.NewName)
+		names[fd] = origName
+		if isDevNull(origName) {
+			names[fd] = newName
+		}
+		setNormalizedNames(fd, origName, newName, opts.NoPrefix)
+		TimestampsOmit.apply(fd)
+
+		var hunks []*diff.Hunk
+		for _, h := range fd.Hunks {
+			hunks = append(hunks, recontextHunk(h, opts.ContextLines)...)
+		}
+		fd.Hunks = hunks
+		RecountFileDiff(fd)
+	}
+	sort.SliceStable(fileDiffs, func(i, j int) bool {
+		return sortNameLess(names[fileDiffs[i]], names[fileDiffs[j]], opts.Order)
+	})
+
+	result, err := diff.PrintMultiFileDiff(fileDiffs)
+	if err != nil {
+		return "", fmt.Errorf("printing normalized patch: %w", err)
+	}
+	return string(result), nil
+}
+
+// unprefixedNames returns origName and newName without their first component if
+// it differs between them, as a/ and b/ of git diffs and the directories compared
+// by diff -r do. /dev/null is left untouched.
+func unprefixedNames(origName, newName string) (string, string) {
+	origParts := strings.SplitN(origName, "/", 2)
+	newParts := strings.SplitN(newName, "/", 2)
+	switch {
+	case isDevNull(origName):
+		if strings.HasPrefix(newName, "b/") {
+			return origName, newParts[1]
+		}
+		return origName, newName
+	case isDevNull(newName):
+		if strings.HasPrefix(origName, "a/") {
+			return origParts[1], newName
+		}
+		return origName, newName
+	case len(origParts) == 2 && len(newParts) == 2 && origParts[0] != newParts[0]:
+		return origParts[1], newParts[1]
+	}
+	return origName, newName
+}
+
+// setNormalizedNames sets the names of fd, and of its "diff --git" line if it has
+// one, to origName and newName, prefixed by a/ and b/ unless noPrefix is set.
+func setNormalizedNames(fd *diff.FileDiff, origName, newName string, noPrefix bool) {
+	if !noPrefix {
+		if !isDevNull(origName) {
+			origName = "a/" + origName
+		}
+		if !isDevNull(newName) {
+			newName = "b/" + newName
+		}
+	}
+	fd.OrigName, fd.NewName = origName, newName
+	if len(fd.Extended) == 0 || !strings.HasPrefix(fd.Extended[0], "diff --git ") {
+		return
+	}
+	// Both names of the git header are set, also for added and deleted files
+	if isDevNull(origName) {
+		origName = strings.TrimPrefix(newName, "b/")
+		if !noPrefix {
+			origName = "a/" + origName
+		}
+	}
+	if isDevNull(newName) {
+		newName = strings.TrimPrefix(origName, "a/")
+		if !noPrefix {
+			newName = "b/" + newName
+		}
+	}
+	fd.Extended[0] = "diff --git " + origName + " " + newName
+}
+
+// recontextHunk returns the hunks making the changes of h with contextLines
+// unchanged lines around them, as hunks.ChunksToFileDiff counts them. Changes
+// separated by more unchanged lines than kept around them go into separate hunks.
+func recontextHunk(h *diff.Hunk, contextLines int) []*diff.Hunk {
+	var chunks []Chunk
+	for _, line := range hunks.Lines(h) {
+		op, text := hunks.SplitLine(line)
+		last := len(chunks) - 1
+		switch {
+		case op == ' ' && last >= 0:
+			chunks[last].Equal = append(chunks[last].Equal, text)
+		case op == ' ':
+			chunks = append(chunks, Chunk{Equal: []string{text}})
+		case op == '-' && last >= 0 && len(chunks[last].Equal) == 0 && len(chunks[last].Added) == 0:
+			chunks[last].Deleted = append(chunks[last].Deleted, text)
+		case op == '-':
+			chunks = append(chunks, Chunk{Deleted: []string{text}})
+		case op == '+' && last >= 0 && len(chunks[last].Equal) == 0 && len(chunks[last].Deleted) == 0:
+			chunks[last].Added = append(chunks[last].Added, text)
+		default:
+			chunks = append(chunks, Chunk{Added: []string{text}})
+		}
+	}
+
+	fd := &diff.FileDiff{}
+	hunks.ChunksToFileDiff(chunks, fd, contextLines, 0)
+	// Lines of the hunk are counted from 1 by hunks.ChunksToFileDiff; empty
+	// ranges start at the line before the hunk
+	origOffset, newOffset := h.OrigStartLine-1, h.NewStartLine-1
+	if h.OrigLines == 0 {
+		origOffset++
+	}
+	if h.NewLines == 0 {
+		newOffset++
+	}
+	for k, r := range fd.Hunks {
+		r.OrigStartLine += origOffset
+		r.NewStartLine += newOffset
+		if k == 0 {
+			r.Section = h.Section
+		}
+	}
+	return fd.Hunks
+}
@@ -0,0 +1,56 @@
+package patchutils
+
+import (
+	"strings"
+	"testing"
+)
+
+var normalizeTests = []struct {
+	name   string
+	patch  string
+	opts   NormalizeOptions
+	result string
+}{
+	{
+		name: "sorted and unprefixed",
+		patch: "--- old/z\t2020-01-01 10:00:00.000000000 +0100\n+++ new/z\t2020-01-02 10:00:00.000000000 +0100\n" +
+			"@@ -1 +1 @@\n-z\n+Z\n" +
+			"--- old/a\n+++ new/a\n@@ -1 +1 @@\n-a\n+A\n",
+		result: "--- a/a\n+++ b/a\n@@ -1,1 +1,1 @@\n-a\n+A\n" +
+			"--- a/z\n+++ b/z\n@@ -1,1 +1,1 @@\n-z\n+Z\n",
+	},
+	{
+		name:   "context trimmed",
+		patch:  "--- a/f\n+++ b/f\n@@ -1,7 +1,7 @@\n 1\n 2\n 3\n-4\n+four\n 5\n 6\n 7\n",
+		opts:   NormalizeOptions{ContextLines: 1},
+		result: "--- a/f\n+++ b/f\n@@ -3,3 +3,3 @@\n 3\n-4\n+four\n 5\n",
+	},
+	{
+		name: "hunk split",
+		patch: "--- a/f\n+++ b/f\n@@ -1,10 +1,10 @@\n 1\n-2\n+two\n 3\n 4\n 5\n 6\n 7\n 8\n-9\n+nine\n 10\n" +
+			"@@ -20,3 +20,4 @@\n 20\n+20a\n 21\n 22\n",
+		opts: NormalizeOptions{ContextLines: 1},
+		result: "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n 1\n-2\n+two\n 3\n@@ -8,3 +8,3 @@\n 8\n-9\n+nine\n 10\n" +
+			"@@ -20,2 +20,3 @@\n 20\n+20a\n 21\n",
+	},
+	{
+		name:   "no prefix",
+		patch:  "diff --git a/f b/f\nnew file mode 100644\nindex 0000000..1234567\n--- /dev/null\n+++ b/f\n@@ -0,0 +1 @@\n+f\n",
+		opts:   NormalizeOptions{NoPrefix: true},
+		result: "diff --git f f\nnew file mode 100644\nindex 0000000..1234567\n--- /dev/null\n+++ f\n@@ -0,0 +1,1 @@\n+f\n",
+	},
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tt := range normalizeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Normalize(strings.NewReader(tt.patch), tt.opts)
+			if err != nil {
+				t.Fatalf("Normalize: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package patchutils
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// Side is one of the two versions compared by mixed mode.
+type Side int
+
+const (
+	// OldSide is the old source patched with the old diff.
+	OldSide Side = iota
+	// NewSide is the new source patched with the new diff.
+	NewSide
+)
+
+// String returns "old" or "new".
+func (s Side) String() string {
+	if s == NewSide {
+		return "new"
+	}
+	return "old"
+}
+
+// onlyIn returns the entry for a file with path present in side only, rendered
+// by format, or as "Only in dir: name" like diff -r does if format is nil.
+func onlyIn(format func(dir, name string, side Side) string, path string, side Side) string {
+	dir, name := filepath.ToSlash(filepath.Dir(path)), filepath.Base(path)
+	if format != nil {
+		return format(dir, name, side)
+	}
+	return fmt.Sprintf("Only in %s: %s\n", dir, name)
+}
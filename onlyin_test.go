@@ -0,0 +1,41 @@
+package patchutils
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestMixedModePathOnlyInFormatter(t *testing.T) {
+	oldDiffFile, err := os.Open(testFile("s1_a.diff"))
+	if err != nil {
+		t.Fatalf("Error opening oldDiffFile: %v", err)
+	}
+	defer oldDiffFile.Close()
+	newDiffFile, err := os.Open(testFile("s1_c_d.diff"))
+	if err != nil {
+		t.Fatalf("Error opening newDiffFile: %v", err)
+	}
+	defer newDiffFile.Close()
+
+	opts := MixedModeOptions{
+		OnlyInFormatter: func(dir, name string, side Side) string {
+			return fmt.Sprintf("%s only: %s/%s\n", side, dir, name)
+		},
+		Dir: testFilesDir,
+	}
+	result, err := MixedModePathWithOptions("source_1", "source_1_c", oldDiffFile, newDiffFile, opts)
+	if err != nil {
+		t.Fatalf("MixedModePathWithOptions: got error %v; want error nil", err)
+	}
+
+	for _, want := range []string{"old only: source_1_a/file_1.txt\n", "new only: source_1_d/file_3.txt\n"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("Result doesn't contain %q.\nGot:\n%s\n", want, result)
+		}
+	}
+	if strings.Contains(result, "Only in") {
+		t.Errorf("Result contains default Only in entries.\nGot:\n%s\n", result)
+	}
+}
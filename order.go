@@ -0,0 +1,216 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// FileOrder is an order of files in a patch.
+type FileOrder int
+
+const (
+	// DiffOrder compares file names component by component, the order diff -r
+	// walks directories in: "a/b" comes before "a.c".
+	DiffOrder FileOrder = iota
+	// GitOrder compares whole file names byte by byte, the order git uses for
+	// its index and diffs: "a.c" comes before "a/b".
+	GitOrder
+)
+
+// ParseFileOrder returns the FileOrder named name, "diff" or "git".
+func ParseFileOrder(name string) (FileOrder, error) {
+	switch name {
+	case "diff":
+		return DiffOrder, nil
+	case "git":
+		return GitOrder, nil
+	}
+	return 0, fmt.Errorf("%q: %w", name, ErrUnknownFileOrder)
+}
+
+// SortPatch returns patch with its files sorted in order, ignoring the leading
+// path component which differs between the two sides of diff -r and git diffs.
+// Text of every file diff is moved as it is, text before the first one stays first.
+// Files with the same name keep their relative order.
+func SortPatch(patch io.Reader, order FileOrder) (string, error) {
+	content, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return "", fmt.Errorf("reading patch: %w", err)
+	}
+
+	preamble, sections := splitPatch(string(content))
+	names := make([]string, len(sections))
+	for k, section := range sections {
+		name, err := sectionSortName(section)
+		if err != nil {
+			return "", err
+		}
+		names[k] = name
+	}
+
+	index := make([]int, len(sections))
+	for k := range index {
+		index[k] = k
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return sortNameLess(names[index[i]], names[index[j]], order)
+	})
+
+	var result strings.Builder
+	result.WriteString(preamble)
+	for _, k := range index {
+		result.WriteString(sections[k])
+	}
+	return result.String(), nil
+}
+
+// sortNameLess reports whether a file diff sorted by name a sorts before one
+// sorted by name b in order.
+func sortNameLess(a, b string, order FileOrder) bool {
+	if order == GitOrder {
+		return a < b
+	}
+	return lessComponents(strings.Split(a, "/"), strings.Split(b, "/"))
+}
+
+// diffOrderLess reports whether file name a sorts before b in DiffOrder.
+func diffOrderLess(a, b string) bool {
+	return lessComponents(strings.Split(filepath.ToSlash(a), "/"), strings.Split(filepath.ToSlash(b), "/"))
+}
+
+// lessComponents reports whether path components a sort before b.
+func lessComponents(a, b []string) bool {
+	for k := 0; k < len(a) && k < len(b); k++ {
+		if a[k] != b[k] {
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// sectionSortName returns the name a file diff is sorted by: the name of the
+// original file, or of the new one if it is added, without the leading path
+// component if it tells the sides of the diff apart.
+func sectionSortName(section string) (string, error) {
+	fd, err := diff.NewMultiFileDiffReader(strings.NewReader(section)).ReadFile()
+	if errors.Is(err, io.EOF) {
+		// Extended headers only, such as changes of mode
+		if h, ok := parseGitHeader(strings.Split(section, "\n")); ok {
+			return h.oldName, nil
+		}
+	}
+	if err != nil {
+		return "", fmt.Errorf("parsing file diff %q: %w", firstLine(section), err)
+	}
+
+	switch {
+	case fd.NewName == "":
+		// "Only in" entry
+		return stripPath(fd.OrigName, 1), nil
+	case isDevNull(fd.OrigName):
+		return strings.TrimPrefix(fd.NewName, "b/"), nil
+	case isDevNull(fd.NewName):
+		return strings.TrimPrefix(fd.OrigName, "a/"), nil
+	case strings.SplitN(fd.OrigName, "/", 2)[0] != strings.SplitN(fd.NewName, "/", 2)[0]:
+		return stripPath(fd.OrigName, 1), nil
+	}
+	return fd.OrigName, nil
+}
+
+// firstLine returns the first line of s.
+func firstLine(s string) string {
+	return strings.SplitN(s, "\n", 2)[0]
+}
+
+// hunkHeaderRegexp matches ranges of a hunk header.
+var hunkHeaderRegexp = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// splitPatch splits patch into the text before the first file diff and the text
+// of every file diff. Hunk bodies are skipped using line counts of hunk headers,
+// so that deleted lines looking like "--- name" don't start a new file diff.
+func splitPatch(patch string) (string, []string) {
+	lines := strings.SplitAfter(patch, "\n")
+	var starts []int
+	// inHeader is set between the start of a file diff and its first hunk
+	inHeader := false
+	for k := 0; k < len(lines); k++ {
+		line := lines[k]
+		switch {
+		case strings.HasPrefix(line, "Only in "):
+			starts = append(starts, k)
+			inHeader = false
+		case strings.HasPrefix(line, "diff "):
+			starts = append(starts, k)
+			inHeader = true
+		case strings.HasPrefix(line, "--- ") && k+1 < len(lines) && strings.HasPrefix(lines[k+1], "+++ "):
+			if !inHeader {
+				starts = append(starts, k)
+			}
+			inHeader = false
+			k++
+		case strings.HasPrefix(line, "@@ "):
+			inHeader = false
+			m := hunkHeaderRegexp.FindStringSubmatch(line)
+			if m == nil {
+				break
+			}
+			origLeft, newLeft := hunkRangeLines(m[1]), hunkRangeLines(m[2])
+			for (origLeft > 0 || newLeft > 0) && k+1 < len(lines) {
+				switch next := lines[k+1]; {
+				case strings.HasPrefix(next, "+"):
+					newLeft--
+				case strings.HasPrefix(next, "-"):
+					origLeft--
+				case strings.HasPrefix(next, `\`):
+				case strings.HasPrefix(next, " "), next == "\n":
+					origLeft--
+					newLeft--
+				default:
+					// Not a line of a hunk body, the header counts too many lines
+					origLeft, newLeft = 0, 0
+					continue
+				}
+				k++
+			}
+		}
+	}
+
+	if len(starts) == 0 {
+		return patch, nil
+	}
+	preamble := strings.Join(lines[:starts[0]], "")
+	sections := make([]string, len(starts))
+	for k, start := range starts {
+		end := len(lines)
+		if k+1 < len(starts) {
+			end = starts[k+1]
+		}
+		sections[k] = strings.Join(lines[start:end], "")
+	}
+	return preamble, sections
+}
+
+// hunkRangeLines returns the number of lines of a hunk range, given as the
+// optional part after the comma.
+func hunkRangeLines(count string) int {
+	if count == "" {
+		return 1
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// ErrUnknownFileOrder indicates that a name of FileOrder isn't known.
+var ErrUnknownFileOrder = errors.New("unknown file order")
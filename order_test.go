@@ -0,0 +1,72 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	orderDotFile = "diff --git a/a.c b/a.c\n--- a/a.c\n+++ b/a.c\n@@ -1 +1 @@\n-x\n+y\n"
+	orderDirFile = "diff --git a/a/b.c b/a/b.c\nold mode 100644\nnew mode 100755\n"
+	orderUpper   = "diff --git a/B.c b/B.c\n--- a/B.c\n+++ b/B.c\n@@ -1 +1 @@\n--- not a header\n+++ not a header either\n"
+)
+
+var sortPatchTests = []struct {
+	name   string
+	patch  string
+	order  FileOrder
+	result string
+}{
+	{
+		name:   "git order",
+		patch:  "From: someone\n\n" + orderDirFile + orderDotFile + orderUpper,
+		order:  GitOrder,
+		result: "From: someone\n\n" + orderUpper + orderDotFile + orderDirFile,
+	},
+	{
+		name:   "diff order",
+		patch:  "From: someone\n\n" + orderDotFile + orderUpper + orderDirFile,
+		order:  DiffOrder,
+		result: "From: someone\n\n" + orderUpper + orderDirFile + orderDotFile,
+	},
+	{
+		name: "diff -r with only in entries",
+		patch: "diff -u old/b.c new/b.c\n--- old/b.c\n+++ new/b.c\n@@ -1 +1 @@\n-x\n+y\n" +
+			"Only in new: a.c\n",
+		order: DiffOrder,
+		result: "Only in new: a.c\n" +
+			"diff -u old/b.c new/b.c\n--- old/b.c\n+++ new/b.c\n@@ -1 +1 @@\n-x\n+y\n",
+	},
+	{
+		name: "added and deleted files",
+		patch: "--- a/c.c\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n" +
+			"--- /dev/null\n+++ b/b.c\n@@ -0,0 +1 @@\n+x\n",
+		order: GitOrder,
+		result: "--- /dev/null\n+++ b/b.c\n@@ -0,0 +1 @@\n+x\n" +
+			"--- a/c.c\n+++ /dev/null\n@@ -1 +0,0 @@\n-x\n",
+	},
+}
+
+func TestSortPatch(t *testing.T) {
+	for _, tt := range sortPatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := SortPatch(strings.NewReader(tt.patch), tt.order)
+			if err != nil {
+				t.Fatalf("SortPatch: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
+
+func TestParseFileOrder(t *testing.T) {
+	if order, err := ParseFileOrder("git"); err != nil || order != GitOrder {
+		t.Errorf("ParseFileOrder(%q): got %v, %v; want %v, nil", "git", order, err, GitOrder)
+	}
+	if _, err := ParseFileOrder("svn"); !errors.Is(err, ErrUnknownFileOrder) {
+		t.Errorf("ParseFileOrder(%q): got error %v; want error %v", "svn", err, ErrUnknownFileOrder)
+	}
+}
@@ -0,0 +1,220 @@
+// Package patchindex indexes a corpus of patches by the files they touch,
+// the identifiers they add and their patch IDs, to answer queries such as
+// "which patches touch net/http/transport.go" without parsing every patch again.
+package patchindex
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/go-patchutils"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Entry describes a single patch of the corpus.
+type Entry struct {
+	// Path of the patch, relative to the indexed directory and slash-separated.
+	Path string `json:"path"`
+	// PatchID identifies the changes of the patch. It ignores line numbers and whitespace,
+	// so a patch rebased onto a slightly different source keeps its ID, as with git patch-id.
+	PatchID string `json:"patch_id"`
+	// Files lists the names of the files the patch touches, with "a/" and "b/" prefixes removed.
+	Files []string `json:"files"`
+	// Symbols lists the identifiers found in lines added by the patch.
+	Symbols []string `json:"symbols"`
+}
+
+// Index is an index of a corpus of patches.
+type Index struct {
+	// Entries are ordered by Path.
+	Entries []Entry `json:"entries"`
+}
+
+// patchExtensions are the extensions of files Build indexes.
+var patchExtensions = []string{".patch", ".diff"}
+
+// Build indexes all .patch and .diff files under dir.
+func Build(dir string) (*Index, error) {
+	ix := &Index{}
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return fmt.Errorf("walk into %q: %w", p, err)
+		}
+		if !info.Mode().IsRegular() || !hasPatchExtension(p) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return fmt.Errorf("opening %q: %w", p, err)
+		}
+		defer f.Close()
+
+		e, err := NewEntry(filepath.ToSlash(rel), f)
+		if err != nil {
+			return err
+		}
+		ix.Entries = append(ix.Entries, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(ix.Entries, func(i, j int) bool {
+		return ix.Entries[i].Path < ix.Entries[j].Path
+	})
+	return ix, nil
+}
+
+// hasPatchExtension reports whether name has one of patchExtensions.
+func hasPatchExtension(name string) bool {
+	for _, ext := range patchExtensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// identifierRegexp matches identifiers in source code.
+var identifierRegexp = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// NewEntry returns the index entry of patch, stored at path.
+func NewEntry(path string, patch io.Reader) (Entry, error) {
+	fileDiffs, err := diff.NewMultiFileDiffReader(patch).ReadAllFiles()
+	if err != nil {
+		return Entry{}, fmt.Errorf("parsing %q: %w", path, err)
+	}
+
+	e := Entry{Path: path}
+	files := make(map[string]bool)
+	symbols := make(map[string]bool)
+	id := sha1.New()
+	for _, fd := range fileDiffs {
+		origName, newName := trimGitPrefix(fd.OrigName), trimGitPrefix(fd.NewName)
+		io.WriteString(id, "--- "+origName+"\n+++ "+newName+"\n")
+		for _, name := range []string{origName, newName} {
+			if name == "" || name == "/dev/null" {
+				continue
+			}
+			if !files[name] {
+				files[name] = true
+				e.Files = append(e.Files, name)
+			}
+		}
+
+		for i, h := range fd.Hunks {
+			lines, err := patchutils.HunkLines(h)
+			if err != nil {
+				return Entry{}, fmt.Errorf("%q: %q: hunk %d: %w", path, fd.OrigName, i, err)
+			}
+			for _, line := range lines {
+				if line.Op == patchutils.OpContext {
+					continue
+				}
+				io.WriteString(id, string(line.Op)+withoutSpace(line.Text)+"\n")
+				if line.Op != patchutils.OpAdd {
+					continue
+				}
+				for _, symbol := range identifierRegexp.FindAllString(line.Text, -1) {
+					symbols[symbol] = true
+				}
+			}
+		}
+	}
+
+	for symbol := range symbols {
+		e.Symbols = append(e.Symbols, symbol)
+	}
+	sort.Strings(e.Symbols)
+	e.PatchID = hex.EncodeToString(id.Sum(nil))
+	return e, nil
+}
+
+// trimGitPrefix returns name without the "a/" or "b/" prefix of git diffs.
+func trimGitPrefix(name string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(name, "a/"), "b/")
+}
+
+// withoutSpace returns s with all white space removed.
+func withoutSpace(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// Touching returns the paths of patches touching file. file matches a touched file
+// if it is equal to it or to its trailing path components, so "transport.go"
+// matches "net/http/transport.go".
+func (ix *Index) Touching(file string) []string {
+	return ix.paths(func(e Entry) bool {
+		for _, name := range e.Files {
+			if name == file || strings.HasSuffix(name, "/"+file) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithSymbol returns the paths of patches adding lines with identifier symbol.
+func (ix *Index) WithSymbol(symbol string) []string {
+	return ix.paths(func(e Entry) bool {
+		k := sort.SearchStrings(e.Symbols, symbol)
+		return k < len(e.Symbols) && e.Symbols[k] == symbol
+	})
+}
+
+// WithPatchID returns the paths of patches with the given patch ID, or a prefix of it.
+func (ix *Index) WithPatchID(id string) []string {
+	return ix.paths(func(e Entry) bool {
+		return id != "" && strings.HasPrefix(e.PatchID, id)
+	})
+}
+
+// paths returns the paths of entries selected by match.
+func (ix *Index) paths(match func(Entry) bool) []string {
+	var paths []string
+	for _, e := range ix.Entries {
+		if match(e) {
+			paths = append(paths, e.Path)
+		}
+	}
+	return paths
+}
+
+// Save writes ix to w in JSON format.
+func (ix *Index) Save(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(ix); err != nil {
+		return fmt.Errorf("writing index: %w", err)
+	}
+	return nil
+}
+
+// Load reads an index written by Save.
+func Load(r io.Reader) (*Index, error) {
+	ix := &Index{}
+	if err := json.NewDecoder(r).Decode(ix); err != nil {
+		return nil, fmt.Errorf("reading index: %w", err)
+	}
+	return ix, nil
+}
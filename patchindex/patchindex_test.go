@@ -0,0 +1,147 @@
+package patchindex
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testPatches = map[string]string{
+	"net/0001-dial.patch": `--- a/net/http/transport.go
++++ b/net/http/transport.go
+@@ -10,3 +10,3 @@
+ func roundTrip() {
+-	dial()
++	dialContext(ctx)
+ }
+`,
+	// Same changes as 0001-dial.patch, at other lines and with other indentation
+	"net/0001-dial-rebased.diff": `--- a/net/http/transport.go
++++ b/net/http/transport.go
+@@ -20,3 +20,3 @@
+ func roundTrip() {
+-    dial()
++    dialContext(ctx)
+ }
+`,
+	"docs.patch": `--- /dev/null
++++ b/README
+@@ -0,0 +1 @@
++Transport docs
+`,
+	"notes.txt": "not a patch\n",
+}
+
+// writeTestCorpus writes testPatches into a new temporary directory.
+func writeTestCorpus(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "patchindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range testPatches {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestBuild(t *testing.T) {
+	dir := writeTestCorpus(t)
+	defer os.RemoveAll(dir)
+
+	ix, err := Build(dir)
+	if err != nil {
+		t.Fatalf("Build: got error %v; want error nil", err)
+	}
+
+	var paths []string
+	for _, e := range ix.Entries {
+		paths = append(paths, e.Path)
+	}
+	if want := []string{"docs.patch", "net/0001-dial-rebased.diff", "net/0001-dial.patch"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("Build: got entries %v; want %v", paths, want)
+	}
+
+	e := ix.Entries[2]
+	if want := []string{"net/http/transport.go"}; !reflect.DeepEqual(e.Files, want) {
+		t.Errorf("Files: got %v; want %v", e.Files, want)
+	}
+	if want := []string{"ctx", "dialContext"}; !reflect.DeepEqual(e.Symbols, want) {
+		t.Errorf("Symbols: got %v; want %v", e.Symbols, want)
+	}
+	if e.PatchID != ix.Entries[1].PatchID {
+		t.Errorf("PatchID of rebased patch: got %s; want %s", ix.Entries[1].PatchID, e.PatchID)
+	}
+	if e.PatchID == ix.Entries[0].PatchID {
+		t.Errorf("PatchID of different patches: both are %s", e.PatchID)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	dir := writeTestCorpus(t)
+	defer os.RemoveAll(dir)
+
+	ix, err := Build(dir)
+	if err != nil {
+		t.Fatalf("Build: got error %v; want error nil", err)
+	}
+
+	queries := []struct {
+		name   string
+		result []string
+		want   []string
+	}{
+		{"Touching full path", ix.Touching("net/http/transport.go"),
+			[]string{"net/0001-dial-rebased.diff", "net/0001-dial.patch"}},
+		{"Touching trailing components", ix.Touching("http/transport.go"),
+			[]string{"net/0001-dial-rebased.diff", "net/0001-dial.patch"}},
+		{"Touching partial component", ix.Touching("port.go"), nil},
+		{"Touching added file", ix.Touching("README"), []string{"docs.patch"}},
+		{"WithSymbol", ix.WithSymbol("Transport"), []string{"docs.patch"}},
+		{"WithSymbol deleted only", ix.WithSymbol("dial"), nil},
+		{"WithPatchID prefix", ix.WithPatchID(ix.Entries[0].PatchID[:7]), []string{"docs.patch"}},
+		{"WithPatchID empty", ix.WithPatchID(""), nil},
+	}
+	for _, q := range queries {
+		if !reflect.DeepEqual(q.result, q.want) {
+			t.Errorf("%s: got %v; want %v", q.name, q.result, q.want)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := writeTestCorpus(t)
+	defer os.RemoveAll(dir)
+
+	ix, err := Build(dir)
+	if err != nil {
+		t.Fatalf("Build: got error %v; want error nil", err)
+	}
+
+	var buf bytes.Buffer
+	if err := ix.Save(&buf); err != nil {
+		t.Fatalf("Save: got error %v; want error nil", err)
+	}
+	loaded, err := Load(&buf)
+	if err != nil {
+		t.Fatalf("Load: got error %v; want error nil", err)
+	}
+	if !reflect.DeepEqual(loaded, ix) {
+		t.Errorf("Loaded index mismatch.\nGot:\n%+v\nWant:\n%+v\n", loaded, ix)
+	}
+
+	if _, err := Load(strings.NewReader("{")); err == nil {
+		t.Errorf("Load of truncated index: got error nil; want error")
+	}
+}
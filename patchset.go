@@ -0,0 +1,105 @@
+package patchutils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// PatchSet is a patch parsed once, so that several operations can be applied to
+// it without parsing it again each time. Operations returning a PatchSet leave the
+// one they are called on unchanged, so that they can be chained:
+//
+//	stats := p.Strip(1).Reverse().Stat()
+type PatchSet struct {
+	fileDiffs []*diff.FileDiff
+}
+
+// ReadPatchSet parses patch into a PatchSet. It fails with ErrEmptyDiffFile if
+// patch has no files.
+func ReadPatchSet(patch io.Reader) (*PatchSet, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return nil, fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+	return &PatchSet{fileDiffs: fileDiffs}, nil
+}
+
+// Files returns the file diffs of p in order. "Only in" entries have an empty
+// NewName. The file diffs are shared with p and must not be modified.
+func (p *PatchSet) Files() []*diff.FileDiff {
+	return append([]*diff.FileDiff(nil), p.fileDiffs...)
+}
+
+// Filter returns the files of p selected by opts, like FilterDiff.
+func (p *PatchSet) Filter(opts FilterOptions) (*PatchSet, error) {
+	if err := checkFilterPatterns(opts); err != nil {
+		return nil, err
+	}
+	return &PatchSet{fileDiffs: filterFileDiffs(p.fileDiffs, opts)}, nil
+}
+
+// Reverse returns p reversed, like Reverse.
+func (p *PatchSet) Reverse() *PatchSet {
+	reversed := make([]*diff.FileDiff, 0, len(p.fileDiffs))
+	for _, fd := range p.fileDiffs {
+		reversed = append(reversed, ReverseFileDiff(fd))
+	}
+	return &PatchSet{fileDiffs: reversed}
+}
+
+// Stat returns the number of lines added and deleted in every file of p, like Stat.
+func (p *PatchSet) Stat() []FileStat {
+	return fileStats(p.fileDiffs)
+}
+
+// Strip returns p with n leading path components removed from its file names,
+// like StripDiff.
+func (p *PatchSet) Strip(n int) *PatchSet {
+	stripped := make([]*diff.FileDiff, 0, len(p.fileDiffs))
+	for _, fd := range p.fileDiffs {
+		// Names and extended headers are changed in a copy, hunks are shared
+		c := *fd
+		c.Extended = append([]string(nil), fd.Extended...)
+		stripFileDiff(&c, n)
+		stripped = append(stripped, &c)
+	}
+	return &PatchSet{fileDiffs: stripped}
+}
+
+// Write writes p to w in unified format.
+func (p *PatchSet) Write(w io.Writer) error {
+	result, err := diff.PrintMultiFileDiff(p.fileDiffs)
+	if err != nil {
+		return fmt.Errorf("printing patch: %w", err)
+	}
+	_, err = w.Write(result)
+	return err
+}
+
+// InterDiff returns the interdiff of p and other, the diff between the files p
+// results in and those other results in, like InterDiff with p as the old diff.
+func (p *PatchSet) InterDiff(other *PatchSet) (*PatchSet, error) {
+	var oldDiff, newDiff bytes.Buffer
+	if err := p.Write(&oldDiff); err != nil {
+		return nil, err
+	}
+	if err := other.Write(&newDiff); err != nil {
+		return nil, err
+	}
+	result, err := InterDiff(&oldDiff, &newDiff)
+	if err != nil {
+		return nil, err
+	}
+	fileDiffs, err := readPatch(strings.NewReader(result))
+	if err != nil {
+		return nil, fmt.Errorf("parsing result: %w", err)
+	}
+	return &PatchSet{fileDiffs: fileDiffs}, nil
+}
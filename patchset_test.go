@@ -0,0 +1,96 @@
+package patchutils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const patchSetPatch = `--- a/src/foo.c
++++ b/src/foo.c
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+--- a/doc/readme
++++ b/doc/readme
+@@ -1,1 +1,2 @@
+ x
++y
+`
+
+func readTestPatchSet(t *testing.T, patch string) *PatchSet {
+	t.Helper()
+	p, err := ReadPatchSet(strings.NewReader(patch))
+	if err != nil {
+		t.Fatalf("ReadPatchSet: got error %v; want error nil", err)
+	}
+	return p
+}
+
+func writePatchSet(t *testing.T, p *PatchSet) string {
+	t.Helper()
+	var b strings.Builder
+	if err := p.Write(&b); err != nil {
+		t.Fatalf("Write: got error %v; want error nil", err)
+	}
+	return b.String()
+}
+
+func TestPatchSet(t *testing.T) {
+	p := readTestPatchSet(t, patchSetPatch)
+	filtered, err := p.Filter(FilterOptions{Include: []string{"src"}, Strip: 1})
+	if err != nil {
+		t.Fatalf("Filter: got error %v; want error nil", err)
+	}
+	want := `--- src/foo.c
++++ src/foo.c
+@@ -1,3 +1,3 @@
+ a
+-B
++b
+ c
+`
+	if got := writePatchSet(t, filtered.Strip(1).Reverse()); got != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+
+	// Operations leave p unchanged
+	if got := writePatchSet(t, p); got != patchSetPatch {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, patchSetPatch)
+	}
+	wantStats := []FileStat{{Name: "b/src/foo.c", Added: 1, Deleted: 1}, {Name: "b/doc/readme", Added: 1}}
+	if got := p.Stat(); !reflect.DeepEqual(got, wantStats) {
+		t.Errorf("Stat: got %+v; want %+v", got, wantStats)
+	}
+	if got := len(p.Files()); got != 2 {
+		t.Errorf("Files: got %d files; want 2", got)
+	}
+}
+
+func TestPatchSetInterDiff(t *testing.T) {
+	p := readTestPatchSet(t, patchSetPatch)
+	other := readTestPatchSet(t, strings.Replace(patchSetPatch, "+y", "+z", 1))
+	result, err := p.InterDiff(other)
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	want := `--- b/doc/readme
++++ b/doc/readme
+@@ -1,2 +1,2 @@
+ x
+-y
++z
+`
+	if got := writePatchSet(t, result); got != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+}
+
+func TestReadPatchSetEmpty(t *testing.T) {
+	if _, err := ReadPatchSet(strings.NewReader("")); !errors.Is(err, ErrEmptyDiffFile) {
+		t.Errorf("ReadPatchSet: got error %v; want %v", err, ErrEmptyDiffFile)
+	}
+}
@@ -2,176 +2,655 @@
 package patchutils
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
 
-	dbd "github.com/kylelemons/godebug/diff"
+	"github.com/google/go-patchutils/hunkmath"
+	"github.com/google/go-patchutils/hunks"
+	"github.com/google/go-patchutils/textnorm"
 	"github.com/sourcegraph/go-diff/diff"
-	"golang.org/x/sync/errgroup"
 )
 
 // InterDiff computes the diff of a source file patched with oldDiff
 // and the same source file patched with newDiff.
 // oldDiff and newDiff should be in unified format.
 func InterDiff(oldDiff, newDiff io.Reader) (string, error) {
-	oldFileDiffs, err := diff.NewMultiFileDiffReader(oldDiff).ReadAllFiles()
+	return InterDiffWithOptions(oldDiff, newDiff, InterDiffOptions{})
+}
+
+// InterDiffTo is like InterDiff, but writes the result to w file by file as soon
+// as it is computed, instead of building it in memory.
+// If it fails, w may have received part of the result.
+func InterDiffTo(w io.Writer, oldDiff, newDiff io.Reader) error {
+	return InterDiffToWithOptions(w, oldDiff, newDiff, InterDiffOptions{})
+}
+
+// InterDiffOptions configures InterDiffWithOptions and InterDiffToWithOptions.
+// The zero value gives the behavior of InterDiff and InterDiffTo.
+type InterDiffOptions struct {
+	// StripLevel is the number of leading path components removed from file names
+	// in the diffs before files of both are matched, like patch -p.
+	StripLevel int
+	// Strict makes InterDiffWithOptions fail with a *DuplicatePathError for diffs
+	// changing a file in more than one FileDiff, instead of merging them.
+	Strict bool
+	// Sort sorts files of the result in Order, like SortPatch does, instead of by
+	// their original names byte by byte. InterDiffToWithOptions then writes the
+	// result only once it is complete.
+	Sort  bool
+	Order FileOrder
+	// SpillThreshold, if positive, is the number of bytes of results of files kept
+	// in memory until they are written. Results beyond it are kept in temporary
+	// files instead, so that sorted or out of order results don't have to fit in memory.
+	SpillThreshold int64
+	// OnlyInFormatter, if set, renders entries of files present in one side only,
+	// given the directory and the name of the file, instead of "Only in dir: name" lines.
+	OnlyInFormatter func(dir, name string, side Side) string
+	// ConflictMarkers turns overlapping hunks of both diffs which disagree about the
+	// original lines they change into a hunk replacing the lines of the old version
+	// with both versions between "<<<<<<<", "=======" and ">>>>>>>" lines, like
+	// merge tools do, instead of failing with ErrContentMismatch.
+	ConflictMarkers bool
+	// ConflictCount, if set, is set to the number of hunks marked as conflicts.
+	ConflictCount *int
+	// Conflicts, if set, is set to the hunks marked as conflicts, in the order of
+	// the result. Setting it implies ConflictMarkers.
+	Conflicts *[]Conflict
+	// Newlines tells how line endings of the result are written. Diffs are parsed
+	// with "\r\n" line endings read as "\n", so only NewlineCRLF changes them.
+	Newlines NewlineMode
+	// Differ compares lines added to the same place of the source by both diffs;
+	// nil stands for LCSDiffer.
+	Differ LineDiffer
+	// Concurrency is the maximum number of files merged at the same time;
+	// 0 stands for runtime.GOMAXPROCS(0).
+	Concurrency int
+	// Timestamps tells how timestamps of file headers of the result are written.
+	Timestamps TimestampMode
+	// KeepGoing skips files which can't be merged, instead of failing at the first
+	// one. The result of the other files is written, and FileErrors with the errors
+	// of the skipped files are returned. InterDiffWithOptions and InterDiffContext
+	// return the result with them.
+	KeepGoing bool
+	// Sections, if set, finds sections of hunks of the result without one. Sources
+	// aren't known, so hunks keep the sections of hunks of the diffs they come from,
+	// and the lines before other ones are taken from the hunks of oldDiff.
+	Sections SectionPatterns
+}
+
+// Conflict is a region of a file changed by overlapping hunks of both diffs given
+// to InterDiffWithOptions which disagree about its original content.
+type Conflict struct {
+	// File is the original name of the file in the old diff.
+	File string
+	// OrigStartLine and OrigEndLine are the first and the last line of the region in
+	// the original file, counted from 1. For hunks which only add lines, OrigEndLine
+	// is OrigStartLine-1 and the lines are added before OrigStartLine.
+	OrigStartLine, OrigEndLine int
+	// OldHunks and NewHunks are the overlapping hunks of the old and the new diff,
+	// in unified format.
+	OldHunks, NewHunks string
+}
+
+// InterDiffWithOptions is like InterDiff, but configured by opts.
+func InterDiffWithOptions(oldDiff, newDiff io.Reader, opts InterDiffOptions) (string, error) {
+	var result strings.Builder
+	err := InterDiffToWithOptions(&result, oldDiff, newDiff, opts)
+	return keptResult(result.String(), err)
+}
+
+// InterDiffToWithOptions is like InterDiffTo, but configured by opts.
+func InterDiffToWithOptions(w io.Writer, oldDiff, newDiff io.Reader, opts InterDiffOptions) error {
+	return InterDiffToContext(context.Background(), w, oldDiff, newDiff, opts)
+}
+
+// InterDiffContext is like InterDiffWithOptions, but stops merging files and fails
+// with the error of ctx once ctx is done.
+func InterDiffContext(ctx context.Context, oldDiff, newDiff io.Reader, opts InterDiffOptions) (string, error) {
+	var result strings.Builder
+	err := InterDiffToContext(ctx, &result, oldDiff, newDiff, opts)
+	return keptResult(result.String(), err)
+}
+
+// InterDiffToContext is like InterDiffToWithOptions, but stops merging files and
+// fails with the error of ctx once ctx is done.
+func InterDiffToContext(ctx context.Context, w io.Writer, oldDiff, newDiff io.Reader, opts InterDiffOptions) error {
+	w = opts.Newlines.writer(w)
+	files, err := readInterDiffFiles(oldDiff, newDiff, opts.StripLevel, opts.Strict)
 	if err != nil {
-		return "", fmt.Errorf("parsing oldDiff: %w", err)
+		return err
+	}
+	for _, f := range files {
+		for _, fd := range []*diff.FileDiff{f.oldFD, f.newFD} {
+			if fd != nil {
+				opts.Timestamps.apply(fd)
+			}
+		}
+	}
+
+	store := &spillStore{limit: opts.SpillThreshold}
+	defer store.close()
+	// complete sets r to content and marks it done. r is sorted by sortName,
+	// or by the name of the file diff in content if sortName is empty.
+	complete := func(r *interDiffResult, content, sortName string) {
+		defer close(r.done)
+		if opts.Sort && sortName == "" && content != "" {
+			var err error
+			if sortName, err = sectionSortName(content); err != nil {
+				r.err = fmt.Errorf("sorting result: %w", err)
+				return
+			}
+		}
+		r.sortName = sortName
+		r.part, r.err = store.keep(content)
+	}
+	// completed returns a result with content, sorted by sortName
+	completed := func(content, sortName string) *interDiffResult {
+		r := &interDiffResult{done: make(chan struct{})}
+		complete(r, content, sortName)
+		return r
+	}
+
+	results := make([]*interDiffResult, 0, len(files))
+	// Files are merged concurrently, but errors are reported in the order of files,
+	// so that results don't depend on scheduling
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	workers := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if fd, side, ok := f.single(); ok {
+			// File is changed in one version only, or added in one and deleted in the other
+			content, err := interPrintSingleFileDiff(fd, side, opts.OnlyInFormatter)
+			if err != nil {
+				return fmt.Errorf("printing %sDiff: %w", side, err)
+			}
+			r := completed(content, singleSortName(fd))
+			r.file = f.name
+			results = append(results, r)
+			continue
+		}
+
+		// interdiff of two versions
+		r := &interDiffResult{file: f.name, done: make(chan struct{})}
+		results = append(results, r)
+		f := f
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			if err := ctx.Err(); err != nil {
+				r.err = err
+				close(r.done)
+				return
+			}
+			interFileDiff, conflicts, err := interFileDiff(f.oldFD, f.newFD,
+				opts.ConflictMarkers || opts.Conflicts != nil, opts.Differ)
+			if err != nil {
+				r.err = fmt.Errorf("merging diffs for file %q: %w", f.name, err)
+				close(r.done)
+				return
+			}
+			opts.Sections.setSectionsFromHunks(interFileDiff, f.oldFD)
+
+			fileDiffContent, err := diff.PrintFileDiff(interFileDiff)
+			if err != nil {
+				r.err = fmt.Errorf("printing merged diffs for file %q: %w", f.name, err)
+				close(r.done)
+				return
+			}
+			r.conflicts = conflicts
+			complete(r, string(fileDiffContent), "")
+		}()
+	}
+
+	// keep reports whether the error of r, a file which failed, is kept among
+	// fileErrs instead of failing the whole merge
+	var fileErrs FileErrors
+	keep := func(r *interDiffResult, err error) bool {
+		if !opts.KeepGoing || ctx.Err() != nil {
+			return false
+		}
+		fileErrs = append(fileErrs, &FileError{File: r.file, Err: err})
+		return true
+	}
+
+	if opts.Sort {
+		// All results are needed before sorting them
+		for _, r := range results {
+			if err := r.wait(ctx); err != nil && (!opts.KeepGoing || ctx.Err() != nil) {
+				return err
+			}
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return sortNameLess(results[i].sortName, results[j].sortName, opts.Order)
+		})
+	}
+
+	// Write results in order, each as soon as it is done
+	var conflicts []Conflict
+	for k, r := range results {
+		if err := r.wait(ctx); err != nil {
+			if keep(r, err) {
+				continue
+			}
+			return err
+		}
+		if err := store.writeTo(w, r.part); err != nil {
+			return fmt.Errorf("writing result: %w", err)
+		}
+		conflicts = append(conflicts, r.conflicts...)
+		results[k] = nil
+	}
+	if opts.ConflictCount != nil {
+		*opts.ConflictCount = len(conflicts)
+	}
+	if opts.Conflicts != nil {
+		*opts.Conflicts = conflicts
+	}
+	if len(fileErrs) > 0 {
+		return fileErrs
+	}
+	return nil
+}
+
+// interDiffResult is the part of the result of InterDiffTo for one file,
+// or the error computing it. It is complete once done is closed.
+type interDiffResult struct {
+	part spilledPart
+	// sortName is the name the result is sorted by if InterDiffOptions.Sort is set.
+	sortName string
+	// conflicts are the hunks marked as conflicts.
+	conflicts []Conflict
+	// file is the name of the file in the diffs.
+	file string
+	err  error
+	done chan struct{}
+}
+
+// wait waits until r is complete or ctx is done, and returns the error of r or ctx.
+func (r *interDiffResult) wait(ctx context.Context) error {
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// singleSortName returns the name the result of fd, changed in one version only,
+// is sorted by if it is an "Only in" entry, or "" if it is sorted by its file diff.
+func singleSortName(fd *diff.FileDiff) string {
+	if fd.NewName == "" {
+		return stripPath(fd.OrigName, 1)
+	}
+	return ""
+}
+
+// interDiffFile is a file of the result of InterDiff, with its FileDiffs in the
+// old and the new diff, nil for a diff not changing it.
+type interDiffFile struct {
+	// name is the name the FileDiffs are paired by, as returned by pairName.
+	name         string
+	oldFD, newFD *diff.FileDiff
+}
+
+// readInterDiffFiles parses oldDiff and newDiff with strip leading path components
+// removed from names, and pairs the FileDiffs of the same file, following renames.
+// Files are returned in the order of the result of InterDiff, without those which
+// are "Only in" entries in both diffs.
+func readInterDiffFiles(oldDiff, newDiff io.Reader, strip int, strict bool) ([]interDiffFile, error) {
+	oldDiff, err := unifiedDiff(oldDiff)
+	if err != nil {
+		return nil, fmt.Errorf("reading oldDiff: %w", err)
+	}
+	newDiff, err = unifiedDiff(newDiff)
+	if err != nil {
+		return nil, fmt.Errorf("reading newDiff: %w", err)
+	}
+
+	oldFileDiffs, err := readFileDiffs(oldDiff, "", strip, nil, strict)
+	if err != nil {
+		return nil, fmt.Errorf("parsing oldDiff: %w", err)
 	}
 	if len(oldFileDiffs) == 0 {
-		return "", fmt.Errorf("oldDiff: %w", ErrEmptyDiffFile)
+		return nil, fmt.Errorf("oldDiff: %w", ErrEmptyDiffFile)
 	}
 
-	newFileDiffs, err := diff.NewMultiFileDiffReader(newDiff).ReadAllFiles()
+	newFileDiffs, err := readFileDiffs(newDiff, "", strip, nil, strict)
 	if err != nil {
-		return "", fmt.Errorf("parsing newDiff: %w", err)
+		return nil, fmt.Errorf("parsing newDiff: %w", err)
 	}
 	if len(newFileDiffs) == 0 {
-		return "", fmt.Errorf("newDiff: %w", ErrEmptyDiffFile)
+		return nil, fmt.Errorf("newDiff: %w", ErrEmptyDiffFile)
 	}
 
-	resultFiles := make(map[string]string)
-	// Iterate over files in FileDiff arrays
+	oldFileDiffs, newFileDiffs, err = followRenames(oldFileDiffs, newFileDiffs, func(a, b string) bool { return a < b })
+	if err != nil {
+		return nil, fmt.Errorf("following renames: %w", err)
+	}
+	pairFileDiffs(oldFileDiffs, newFileDiffs)
+
+	// Iterate over files in FileDiff arrays, both sorted by pairName
+	var files []interDiffFile
 	i, j := 0, 0
-	eg, _ := errgroup.WithContext(context.Background())
-Loop:
-	for i < len(oldFileDiffs) && j < len(newFileDiffs) {
+	for i < len(oldFileDiffs) || j < len(newFileDiffs) {
 		switch {
-		case oldFileDiffs[i].OrigName == newFileDiffs[j].OrigName:
-			switch {
-			case oldFileDiffs[i].NewName == "" && newFileDiffs[j].NewName == "":
-				// In both versions file has been added/deleted
-				i++
-				j++
-				continue Loop
-			case oldFileDiffs[i].NewName == "":
-				// File was deleted in old version
-				resultFiles[newFileDiffs[j].OrigName] = fmt.Sprintf("Only in %s: %s\n", filepath.Dir(newFileDiffs[j].NewName),
-					filepath.Base(newFileDiffs[j].NewName))
-			case newFileDiffs[j].NewName == "":
-				// File deleted in new version
-				resultFiles[oldFileDiffs[i].OrigName] = fmt.Sprintf("Only in %s: %s\n", filepath.Dir(oldFileDiffs[i].NewName),
-					filepath.Base(oldFileDiffs[i].NewName))
-			default:
-				// interdiff of two versions
-				var mu sync.Mutex
-				i, j := i, j
-				eg.Go(func() error {
-					interFileDiff, err := interFileDiff(oldFileDiffs[i], newFileDiffs[j])
-					if err != nil {
-						return fmt.Errorf("merging diffs for file %q: %w", oldFileDiffs[i].OrigName, err)
-					}
-
-					fileDiffContent, err := diff.PrintFileDiff(interFileDiff)
-					if err != nil {
-						return fmt.Errorf("printing merged diffs for file %q: %w", oldFileDiffs[i].OrigName, err)
-					}
-
-					mu.Lock()
-					defer mu.Unlock()
-					resultFiles[oldFileDiffs[i].OrigName] = string(fileDiffContent)
-					return nil
-				})
-			}
-			i++
-			j++
-		case oldFileDiffs[i].OrigName < newFileDiffs[j].OrigName:
+		case j == len(newFileDiffs) || i < len(oldFileDiffs) && pairName(oldFileDiffs[i]) < pairName(newFileDiffs[j]):
 			// current file is only mentioned in oldDiff
-			// determine if file has been added or just changed in only one version
-			revertHunks(oldFileDiffs[i])
-			oldD, err := interPrintSingleFileDiff(oldFileDiffs[i])
-			if err != nil {
-				return "", fmt.Errorf("printing oldDiff: %w", err)
-			}
-			resultFiles[oldFileDiffs[i].OrigName] = oldD
+			files = append(files, interDiffFile{name: pairName(oldFileDiffs[i]), oldFD: oldFileDiffs[i]})
 			i++
-		case oldFileDiffs[i].OrigName > newFileDiffs[j].OrigName:
+		case i == len(oldFileDiffs) || pairName(oldFileDiffs[i]) > pairName(newFileDiffs[j]):
 			// current file is only mentioned in newDiff
-			// determine if file has been added or just changed in only one version
-			newD, err := interPrintSingleFileDiff(newFileDiffs[j])
-			if err != nil {
-				return "", fmt.Errorf("printing newDiff: %w", err)
+			files = append(files, interDiffFile{name: pairName(newFileDiffs[j]), newFD: newFileDiffs[j]})
+			j++
+		default:
+			// In both versions file has been added/deleted if both are "Only in" entries
+			if oldFileDiffs[i].NewName != "" || newFileDiffs[j].NewName != "" {
+				files = append(files, interDiffFile{name: pairName(oldFileDiffs[i]), oldFD: oldFileDiffs[i], newFD: newFileDiffs[j]})
 			}
-			resultFiles[newFileDiffs[j].OrigName] = newD
+			i++
 			j++
 		}
 	}
+	return files, nil
+}
 
-	// In case there are more oldFileDiffs, while newFileDiffs are run out
-	for i < len(oldFileDiffs) {
-		oldD, err := interPrintSingleFileDiff(oldFileDiffs[i])
-		if err != nil {
-			return "", fmt.Errorf("printing oldDiff: %w", err)
+// single returns the FileDiff f is printed as if it isn't merged from two versions,
+// with the side it comes from, and whether that is the case. A file changed in the
+// old version only has its changes undone, in place, so single is called once per file.
+func (f interDiffFile) single() (*diff.FileDiff, Side, bool) {
+	switch {
+	case f.newFD == nil:
+		return revertedSingleFileDiff(f.oldFD), OldSide, true
+	case f.oldFD == nil:
+		return f.newFD, NewSide, true
+	case f.oldFD.NewName == "":
+		// File was deleted in old version
+		return &diff.FileDiff{OrigName: f.newFD.NewName}, NewSide, true
+	case f.newFD.NewName == "":
+		// File deleted in new version
+		return &diff.FileDiff{OrigName: f.oldFD.NewName}, OldSide, true
+	}
+	return nil, NewSide, false
+}
+
+// pairFileDiffs renames files in newFileDiffs, which have no counterpart in oldFileDiffs,
+// to the name of the file in oldFileDiffs, which differs from it only by a leading path
+// component (for example "a/file" and "file", or "a/file" and "source/file").
+// Files added in newFileDiffs keep their name, which the file in oldFileDiffs gets.
+// That way the file is compared once, instead of being reported as a different file
+// in each diff. Files are paired only if exactly one such candidate exists on both sides.
+func pairFileDiffs(oldFileDiffs, newFileDiffs []*diff.FileDiff) {
+	oldNames := make(map[string]bool)
+	for _, fd := range oldFileDiffs {
+		oldNames[pairName(fd)] = true
+	}
+	newNames := make(map[string]bool)
+	for _, fd := range newFileDiffs {
+		newNames[pairName(fd)] = true
+	}
+
+	// Candidates of every unmatched file of one diff in the other diff
+	oldCandidates := make(map[*diff.FileDiff][]*diff.FileDiff)
+	newCandidates := make(map[*diff.FileDiff][]*diff.FileDiff)
+	for _, oldFD := range oldFileDiffs {
+		if newNames[pairName(oldFD)] {
+			continue
+		}
+		for _, newFD := range newFileDiffs {
+			if oldNames[pairName(newFD)] || !sameFileName(pairName(oldFD), pairName(newFD)) {
+				continue
+			}
+			if oldFD.NewName == "" && newFD.NewName == "" {
+				// Both are "Only in" entries, that are reported as they are
+				continue
+			}
+			oldCandidates[oldFD] = append(oldCandidates[oldFD], newFD)
+			newCandidates[newFD] = append(newCandidates[newFD], oldFD)
 		}
-		resultFiles[oldFileDiffs[i].OrigName] = oldD
-		i++
 	}
 
-	// In case there are more newFileDiffs, while oldFileDiffs are run out
-	for j < len(newFileDiffs) {
-		newD, err := interPrintSingleFileDiff(newFileDiffs[j])
-		if err != nil {
-			return "", fmt.Errorf("printing newDiff: %w", err)
+	paired := false
+	for oldFD, candidates := range oldCandidates {
+		if len(candidates) != 1 || len(newCandidates[candidates[0]]) != 1 {
+			continue
+		}
+		if newFD := candidates[0]; isDevNull(newFD.OrigName) && !isDevNull(oldFD.OrigName) {
+			// The name of the added file is kept, as it is the name in the result
+			oldFD.OrigName = newFD.NewName
+		} else {
+			setPairName(newFD, pairName(oldFD))
 		}
-		resultFiles[newFileDiffs[j].OrigName] = newD
-		j++
+		paired = true
 	}
 
-	if err := eg.Wait(); err != nil {
-		return "", fmt.Errorf("wait all routines: %w", err)
+	if paired {
+		for _, fileDiffs := range [][]*diff.FileDiff{oldFileDiffs, newFileDiffs} {
+			fileDiffs := fileDiffs
+			sort.SliceStable(fileDiffs, func(i, j int) bool {
+				return pairName(fileDiffs[i]) < pairName(fileDiffs[j])
+			})
+		}
 	}
+}
 
-	// Add diff files to result in order
-	var originalFilenames []string
-	for f := range resultFiles {
-		originalFilenames = append(originalFilenames, f)
+// sameFileName reports whether different names a and b are equal
+// with at most one leading path component removed from each.
+func sameFileName(a, b string) bool {
+	if a == b || isDevNull(a) || isDevNull(b) {
+		return false
 	}
-	sort.Strings(originalFilenames)
-	var result string
-	for _, k := range originalFilenames {
-		result += resultFiles[k]
+	strippedA, strippedB := stripPath(a, 1), stripPath(b, 1)
+	return strippedA == b || a == strippedB || strippedA == strippedB
+}
+
+// MixedModeOptions configures MixedModeFileWithOptions and MixedModePathWithOptions.
+// The zero value gives the behavior of MixedModeFile and MixedModePath.
+type MixedModeOptions struct {
+	// Normalize is applied to sources and diffs before diffs are parsed and applied,
+	// and to the patched sources before they are compared.
+	Normalize textnorm.Options
+	// Ignore tells which whitespace differences are ignored, like diff -b, -w and -B,
+	// when diffs are applied to sources and when the patched sources are compared.
+	// Lines are shown as they are in the sources.
+	Ignore textnorm.Ignore
+	// ContextLines is the number of unchanged lines shown around changes.
+	// 0 stands for DefaultContextLines, NoContext for none.
+	ContextLines int
+	// HunkBreakGap is the minimum number of unchanged lines between two changes
+	// that puts them into separate hunks. 0 stands for 2*ContextLines+2, which is
+	// DefaultHunkBreakGap with the default context; values below 2*ContextLines+1
+	// are raised to it, so that hunks don't overlap.
+	HunkBreakGap int
+	// StripLevel is the number of leading path components removed from file names
+	// in the diffs before they are matched to sources, like patch -p. If it is positive,
+	// names left are relative to the source directories, so that diffs made by git
+	// with a/ and b/ prefixes can be used with -p1.
+	StripLevel int
+	// PathMapper, if set, maps names of files in the diffs, with StripLevel leading
+	// components removed, to the names they are matched to sources by, e.g. so that
+	// diffs made in a build root match sources checked out elsewhere. The result
+	// names files as mapped.
+	PathMapper PathMapper
+	// Strict makes MixedModePathWithOptions fail with a *DuplicatePathError for diffs
+	// changing a file in more than one FileDiff, instead of merging them.
+	Strict bool
+	// OnlyInFormatter, if set, renders entries of files present in one side only,
+	// given the directory and the name of the file, instead of "Only in dir: name" lines.
+	OnlyInFormatter func(dir, name string, side Side) string
+	// NewFile, like diff -N, writes files of directories present in one side only
+	// as diffs adding or deleting them against /dev/null instead of "Only in"
+	// entries, so that results can be applied with patch. Files only named by
+	// "Only in" entries of the diffs are still written as such.
+	NewFile bool
+	// Cache, if set, provides results of pairs of files computed before with the same
+	// sources, diffs and options, and stores the results of new ones.
+	Cache *ResultCache
+	// Symbols, if set, collects changes of top-level declarations of Go files
+	// between the patched sources.
+	Symbols *SymbolSummary
+	// Resume, if set, skips entries of directories written by an interrupted earlier
+	// run and records entries written by this one.
+	Resume *ResumeState
+	// Dir, if set, is the directory relative source paths of MixedModePathWithOptions
+	// are resolved in, instead of the working directory. Names in the result stay
+	// relative, as given.
+	Dir string
+	// Newlines tells how line endings of sources are compared to lines of the diffs
+	// and to each other, and how line endings of the result are written.
+	Newlines NewlineMode
+	// MaxTextSize is the size in bytes above which sources are compared as binary
+	// files, like sources containing NUL bytes: their lines aren't compared, but
+	// "Binary files X and Y differ" is written if the patched sources differ.
+	// 0 stands for DefaultMaxTextSize, a negative value for no limit.
+	MaxTextSize int
+	// Text compares all sources as text, like diff -a, whatever their size and content.
+	Text bool
+	// Encoding is the character encoding of sources, which are compared in UTF-8.
+	// The result is written in UTF-8.
+	Encoding Encoding
+	// Differ compares the patched sources; nil stands for LCSDiffer. Results are
+	// cached by the name Differ prints as with %v.
+	Differ LineDiffer
+	// Progress, if set, is called after every file of the sources is compared.
+	Progress ProgressFunc
+	// ExcludeGlobs are gitignore-style patterns of files and directories skipped in
+	// directories compared by MixedModePathWithOptions, together with changes of
+	// the diffs to them. Patterns use the syntax of path.Match for path components,
+	// with "**" matching any number of them. Patterns without a slash match names
+	// at any depth, e.g. "*.o" or ".git", other ones paths relative to the root of
+	// the sources, e.g. "/build" or "third_party/vendor". A trailing slash matches
+	// directories only, a leading "!" re-includes paths excluded by earlier patterns,
+	// except for those in excluded directories.
+	ExcludeGlobs []string
+	// Timestamps tells how timestamps of file headers of the result are written.
+	Timestamps TimestampMode
+	// KeepGoing skips files of directories which can't be compared, instead of
+	// failing at the first one. The result of the other files is written, and
+	// FileErrors with the errors of the skipped files are returned, wrapped in
+	// the error. MixedModePathWithOptions and MixedModePathContext return the
+	// result with them.
+	KeepGoing bool
+	// Sections, if set, sets the sections of hunks of the result to the lines of the
+	// patched old source before them matched by the patterns, instead of none.
+	Sections SectionPatterns
+}
+
+// PathMapper returns the name of the file of the source of side which name, the
+// name of a file in the diff of side, stands for.
+type PathMapper func(name string, side Side) string
+
+// forSide returns a function mapping names of the diff of side with m, or nil if m
+// isn't set.
+func (m PathMapper) forSide(side Side) func(string) string {
+	if m == nil {
+		return nil
 	}
+	return func(name string) string { return m(name, side) }
+}
 
-	return result, nil
+// ProgressFunc reports that file, the path of a file in the old source or, if it
+// is missing there, in the new source, is done, and with it done of total files
+// of both sources. Files are counted once if they are present in both sources.
+type ProgressFunc func(file string, done, total int)
+
+// report calls f, if it is set.
+func (f ProgressFunc) report(file string, done, total int) {
+	if f != nil {
+		f(file, done, total)
+	}
 }
 
 // mixedMode computes the diff of a oldSource file patched with oldDiff
 // and the newSource file patched with newDiff.
 // Check if files are added/deleted in old/new versions is skipped.
-func mixedMode(oldSource, newSource io.Reader, oldFileDiff, newFileDiff *diff.FileDiff) (string, error) {
+// oldPath and newPath, if set, name sources which are binary files in the result
+// if the diffs don't name them.
+// It fails with the error of ctx once ctx is done, without waiting for the patched sources to be compared.
+func mixedMode(ctx context.Context, oldSource, newSource io.Reader, oldPath, newPath string,
+	oldFileDiff, newFileDiff *diff.FileDiff, opts MixedModeOptions) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	opts.Timestamps.apply(oldFileDiff)
+	opts.Timestamps.apply(newFileDiff)
+	if isBinaryFileDiff(oldFileDiff) || isBinaryFileDiff(newFileDiff) {
+		return mixedModeBinary(oldSource, newSource, oldFileDiff, newFileDiff)
+	}
+
 	// Skip check if in some version the file has been added/deleted as this is already done in MixedModeFilePath,
 	// before opening oldSource and newSource files
-	oldSourceContent, err := readContent(oldSource)
+	oldSourceContent, err := readSource(oldSource, opts)
 	if err != nil {
 		return "", fmt.Errorf("reading content of OldSource: %w", err)
 	}
 
-	newSourceContent, err := readContent(newSource)
+	newSourceContent, err := readSource(newSource, opts)
 	if err != nil {
 		return "", fmt.Errorf("reading content of NewSource: %w", err)
 	}
 
-	updatedOldSource, err := applyDiff(oldSourceContent, oldFileDiff)
+	applyOpts := ApplyOptions{Normalize: opts.Normalize, Ignore: opts.Ignore, Newlines: opts.Newlines}
+	if !opts.Text && (isBinaryContent(oldSourceContent, opts.MaxTextSize) || isBinaryContent(newSourceContent, opts.MaxTextSize)) {
+		return mixedModeBinarySources(oldSourceContent, newSourceContent, oldPath, newPath, oldFileDiff, newFileDiff, applyOpts)
+	}
+
+	var cacheKey string
+	if opts.Cache != nil {
+		cacheKey, err = mixedModeKey(oldSourceContent, newSourceContent, oldFileDiff, newFileDiff, opts)
+		if err != nil {
+			return "", fmt.Errorf("computing cache key: %w", err)
+		}
+		// Symbols are collected from the patched sources, which cached results skip
+		if result, ok := opts.Cache.get(cacheKey); ok && opts.Symbols == nil {
+			return result, nil
+		}
+	}
+
+	updatedOldSource, err := applyDiff(oldSourceContent, oldFileDiff, applyOpts)
 	if err != nil {
 		return "", fmt.Errorf("applying diff to OldSource: %w", err)
 	}
 
-	updatedNewSource, err := applyDiff(newSourceContent, newFileDiff)
+	updatedNewSource, err := applyDiff(newSourceContent, newFileDiff, applyOpts)
 	if err != nil {
 		return "", fmt.Errorf("applying diff to NewSource: %w", err)
 	}
 
-	ch := dbd.DiffChunks(strings.Split(strings.TrimSuffix(updatedOldSource, "\n"), "\n"),
-		strings.Split(strings.TrimSuffix(updatedNewSource, "\n"), "\n"))
+	opts.Symbols.add(newFileDiff.NewName, updatedOldSource, updatedNewSource)
+
+	norm := opts.Normalize
+	if opts.Newlines != NewlineExact {
+		norm.Newlines = true
+	}
+	ch, err := diffLinesContext(ctx, sourceLines(updatedOldSource), sourceLines(updatedNewSource), norm, opts.Ignore, opts.Differ)
+	if err != nil {
+		return "", err
+	}
 
-	// TODO: something with extended (extended header lines)
 	resultFileDiff := &diff.FileDiff{
 		OrigName: oldFileDiff.NewName,
 		OrigTime: oldFileDiff.NewTime,
@@ -181,182 +660,723 @@ func mixedMode(oldSource, newSource io.Reader, oldFileDiff, newFileDiff *diff.Fi
 		Hunks:    []*diff.Hunk{},
 	}
 
-	convertChunksIntoFileDiff(ch, resultFileDiff)
+	hunks.ChunksToFileDiff(ch, resultFileDiff, opts.ContextLines, opts.HunkBreakGap)
+	if opts.Ignore.BlankLines {
+		removeBlankLineHunks(resultFileDiff)
+	}
+	opts.Sections.setSections(resultFileDiff, sourceLines(updatedOldSource))
+	setInterExtended(resultFileDiff, oldFileDiff, newFileDiff)
 	result, err := diff.PrintFileDiff(resultFileDiff)
 	if err != nil {
 		return "", fmt.Errorf("printing result diff for file %q: %w",
 			oldFileDiff.NewName, err)
 	}
 
+	if opts.Cache != nil {
+		opts.Cache.put(cacheKey, string(result))
+	}
+	return string(result), nil
+}
+
+// mixedModeBinary is mixedMode for files changed by binary file diffs.
+// Sources are patched as they are, without normalization.
+func mixedModeBinary(oldSource, newSource io.Reader, oldFileDiff, newFileDiff *diff.FileDiff) (string, error) {
+	oldSourceContent, err := readContent(oldSource, textnorm.Options{})
+	if err != nil {
+		return "", fmt.Errorf("reading content of OldSource: %w", err)
+	}
+	newSourceContent, err := readContent(newSource, textnorm.Options{})
+	if err != nil {
+		return "", fmt.Errorf("reading content of NewSource: %w", err)
+	}
+
+	updatedOldSource, err := applyDiff(oldSourceContent, oldFileDiff, ApplyOptions{})
+	if err != nil {
+		return "", fmt.Errorf("applying diff to OldSource: %w", err)
+	}
+	updatedNewSource, err := applyDiff(newSourceContent, newFileDiff, ApplyOptions{})
+	if err != nil {
+		return "", fmt.Errorf("applying diff to NewSource: %w", err)
+	}
+
+	result, err := diff.PrintFileDiff(binaryFileDiff(oldFileDiff, newFileDiff,
+		[]byte(updatedOldSource), []byte(updatedNewSource), true))
+	if err != nil {
+		return "", fmt.Errorf("printing result diff for file %q: %w", oldFileDiff.NewName, err)
+	}
 	return string(result), nil
 }
 
+// mixedModeBinarySources is mixedMode for sources which are binary, as told by
+// isBinaryContent. It tells only whether the patched sources differ.
+func mixedModeBinarySources(oldSourceContent, newSourceContent, oldPath, newPath string,
+	oldFileDiff, newFileDiff *diff.FileDiff, applyOpts ApplyOptions) (string, error) {
+	updatedOldSource, err := applyDiff(oldSourceContent, oldFileDiff, applyOpts)
+	if err != nil {
+		return "", fmt.Errorf("applying diff to OldSource: %w", err)
+	}
+	updatedNewSource, err := applyDiff(newSourceContent, newFileDiff, applyOpts)
+	if err != nil {
+		return "", fmt.Errorf("applying diff to NewSource: %w", err)
+	}
+	if updatedOldSource == updatedNewSource {
+		return "", nil
+	}
+
+	// Files the diffs leave unchanged are named by their paths
+	oldName, newName := oldFileDiff.NewName, newFileDiff.NewName
+	if oldName == "" {
+		oldName = oldPath
+	}
+	if newName == "" {
+		newName = newPath
+	}
+	return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName), nil
+}
+
 // MixedModeFile computes the diff of an oldSource file patched with oldDiff and
 // newSource file patched with newDiff.
 func MixedModeFile(oldSource, newSource, oldDiff, newDiff io.Reader) (string, error) {
-	oldD, err := diff.NewFileDiffReader(oldDiff).Read()
+	return MixedModeFileWithOptions(oldSource, newSource, oldDiff, newDiff, MixedModeOptions{})
+}
+
+// MixedModeFileWithOptions is like MixedModeFile, but configured by opts.
+func MixedModeFileWithOptions(oldSource, newSource, oldDiff, newDiff io.Reader, opts MixedModeOptions) (string, error) {
+	oldDiff, err := normalizedDiff(oldDiff, opts.Normalize)
+	if err != nil {
+		return "", fmt.Errorf("reading oldDiff: %w", err)
+	}
+	oldD, err := readFileDiff(oldDiff)
 	if err != nil {
 		return "", fmt.Errorf("parsing oldDiff: %w", err)
 	}
 
-	newD, err := diff.NewFileDiffReader(newDiff).Read()
+	newDiff, err = normalizedDiff(newDiff, opts.Normalize)
+	if err != nil {
+		return "", fmt.Errorf("reading newDiff: %w", err)
+	}
+	newD, err := readFileDiff(newDiff)
 	if err != nil {
 		return "", fmt.Errorf("parsing newDiff: %w", err)
 	}
 
-	result, err := mixedMode(oldSource, newSource, oldD, newD)
+	result, err := mixedMode(context.Background(), oldSource, newSource, "", "", oldD, newD, opts)
 	if err != nil {
 		return "", fmt.Errorf("mixedMode: %w", err)
 	}
 
-	return result, nil
+	return opts.Newlines.result(result), nil
 }
 
 // MixedModePath recursively computes the diff of an oldSource patched with oldDiff
 // and the newSource patched with newDiff, recursively if OldSource and NewSource are directories.
+// If one source is a file and the other one a directory, the file is compared to
+// the file of the same name in the directory or in one of its subdirectories,
+// which happens when it moved between both versions; the diff of the directory
+// may change other files, which are ignored.
 func MixedModePath(oldSourcePath, newSourcePath string, oldDiff, newDiff io.Reader) (string, error) {
+	return MixedModePathWithOptions(oldSourcePath, newSourcePath, oldDiff, newDiff, MixedModeOptions{})
+}
+
+// MixedModePathWithOptions is like MixedModePath, but configured by opts.
+func MixedModePathWithOptions(oldSourcePath, newSourcePath string, oldDiff, newDiff io.Reader,
+	opts MixedModeOptions) (string, error) {
+	var result strings.Builder
+	err := MixedModePathToWithOptions(&result, oldSourcePath, newSourcePath, oldDiff, newDiff, opts)
+	return keptResult(result.String(), err)
+}
+
+// MixedModePathTo is like MixedModePath, but writes the result to w file by file
+// as soon as it is computed, instead of building it in memory.
+// If it fails, w may have received part of the result.
+func MixedModePathTo(w io.Writer, oldSourcePath, newSourcePath string, oldDiff, newDiff io.Reader) error {
+	return MixedModePathToWithOptions(w, oldSourcePath, newSourcePath, oldDiff, newDiff, MixedModeOptions{})
+}
+
+// MixedModePathToWithOptions is like MixedModePathTo, but configured by opts.
+func MixedModePathToWithOptions(w io.Writer, oldSourcePath, newSourcePath string, oldDiff, newDiff io.Reader,
+	opts MixedModeOptions) error {
+	return MixedModePathToContext(context.Background(), w, oldSourcePath, newSourcePath, oldDiff, newDiff, opts)
+}
+
+// MixedModePathContext is like MixedModePathWithOptions, but stops comparing files
+// and fails with the error of ctx once ctx is done.
+func MixedModePathContext(ctx context.Context, oldSourcePath, newSourcePath string, oldDiff, newDiff io.Reader,
+	opts MixedModeOptions) (string, error) {
+	var result strings.Builder
+	err := MixedModePathToContext(ctx, &result, oldSourcePath, newSourcePath, oldDiff, newDiff, opts)
+	return keptResult(result.String(), err)
+}
+
+// MixedModePathToContext is like MixedModePathToWithOptions, but stops comparing
+// files and fails with the error of ctx once ctx is done. The comparison of a file
+// in progress is abandoned, but keeps running in the background until it's complete.
+func MixedModePathToContext(ctx context.Context, w io.Writer, oldSourcePath, newSourcePath string,
+	oldDiff, newDiff io.Reader, opts MixedModeOptions) error {
+	w = opts.Newlines.writer(w)
+	oldDiff, err := normalizedDiff(oldDiff, opts.Normalize)
+	if err != nil {
+		return fmt.Errorf("reading oldDiff: %w", err)
+	}
+
+	newDiff, err = normalizedDiff(newDiff, opts.Normalize)
+	if err != nil {
+		return fmt.Errorf("reading newDiff: %w", err)
+	}
+
+	files := osFiles{dir: opts.Dir}
+
 	// Get stats of sources
-	oldSourceStat, err := os.Stat(oldSourcePath)
+	oldSourceStat, err := os.Stat(files.path(oldSourcePath))
 	if err != nil {
-		return "", fmt.Errorf("get stat from oldSourcePath %q: %w",
+		return fmt.Errorf("get stat from oldSourcePath %q: %w",
 			oldSourcePath, err)
 	}
 
-	newSourceStat, err := os.Stat(newSourcePath)
+	newSourceStat, err := os.Stat(files.path(newSourcePath))
 	if err != nil {
-		return "", fmt.Errorf("get stat from newSourcePath %q: %w",
+		return fmt.Errorf("get stat from newSourcePath %q: %w",
 			newSourcePath, err)
 	}
 
-	// Check mode of sources
-	switch {
-	case !oldSourceStat.IsDir() && !newSourceStat.IsDir():
-		// Both sources are files
-		oldD, err := diff.NewFileDiffReader(oldDiff).Read()
+	if oldSourceStat.IsDir() && newSourceStat.IsDir() {
+		// Both paths are directories
+		if err := mixedModeDirPath(ctx, w, files, files, oldSourcePath, newSourcePath, oldDiff, newDiff, opts); err != nil {
+			return fmt.Errorf("compute diff for %q and %q: %w",
+				oldSourcePath, newSourcePath, err)
+		}
+		return nil
+	}
+
+	// At least one source is a file. The other one, if it is a directory, contains
+	// the file, moved there or out of there between both versions.
+	oldFilePath, newFilePath := oldSourcePath, newSourcePath
+	if oldSourceStat.IsDir() {
+		if oldFilePath, err = fileInDir(files, oldSourcePath, filepath.Base(newSourcePath)); err != nil {
+			return fmt.Errorf("finding %q in oldSourcePath: %w", filepath.Base(newSourcePath), err)
+		}
+	}
+	if newSourceStat.IsDir() {
+		if newFilePath, err = fileInDir(files, newSourcePath, filepath.Base(oldSourcePath)); err != nil {
+			return fmt.Errorf("finding %q in newSourcePath: %w", filepath.Base(oldSourcePath), err)
+		}
+	}
+
+	oldD, err := sourceFileDiff(oldDiff, oldFilePath, oldSourceStat.IsDir(), opts.StripLevel, opts.PathMapper.forSide(OldSide))
+	if err != nil {
+		return fmt.Errorf("oldDiff: %w", err)
+	}
+	newD, err := sourceFileDiff(newDiff, newFilePath, newSourceStat.IsDir(), opts.StripLevel, opts.PathMapper.forSide(NewSide))
+	if err != nil {
+		return fmt.Errorf("newDiff: %w", err)
+	}
+
+	resultString, err := mixedModeFilePath(ctx, files, files, oldFilePath, newFilePath, oldD, newD, opts)
+	if err != nil {
+		return err
+	}
+	opts.Progress.report(oldFilePath, 1, 1)
+	if _, err := io.WriteString(w, resultString); err != nil {
+		return fmt.Errorf("writing result: %w", err)
+	}
+	return nil
+}
+
+// fileInDir returns the path of the file called name in dir, or else in a
+// subdirectory of it, if exactly one file of the tree is called so.
+func fileInDir(files osFiles, dir, name string) (string, error) {
+	if info, err := os.Stat(files.path(filepath.Join(dir, name))); err == nil && !info.IsDir() {
+		return filepath.Join(dir, name), nil
+	}
+
+	fileNames, err := files.walk(dir, nil)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, f := range fileNames {
+		if filepath.Base(f) == name {
+			found = append(found, f)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", ErrFileNotFound
+	case 1:
+		return found[0], nil
+	}
+	return "", fmt.Errorf("%d files called so: %q", len(found), found)
+}
+
+// sourceFileDiff returns the FileDiff of d for the source file at path, with names
+// stripped of strip leading components and mapped by mapName. If the source is a
+// file of a directory, d is a diff of the directory, which leaves the file unchanged
+// unless it has a FileDiff for it. Otherwise d is a diff of the file only.
+func sourceFileDiff(d io.Reader, path string, inDir bool, strip int, mapName func(string) string) (*diff.FileDiff, error) {
+	if inDir {
+		fileDiffs, err := readFileDiffs(d, "", strip, mapName, false)
+		if err != nil {
+			return nil, fmt.Errorf("parsing diff for %q: %w", path, err)
+		}
+		for _, fd := range fileDiffs {
+			if sourceNameMatches(path, fd.OrigName, strip) {
+				return fd, nil
+			}
+		}
+		// Empty FileDiffs stand for files without updates
+		return &diff.FileDiff{}, nil
+	}
+
+	fd, err := readFileDiff(d)
+	if err != nil {
+		return nil, fmt.Errorf("parsing diff for %q: %w", path, err)
+	}
+	stripFileDiffNames(fd, "", strip, mapName)
+	if !sourceNameMatches(path, fd.OrigName, strip) {
+		return nil, fmt.Errorf("filenames mismatch for source %q and diff %q", path, fd.OrigName)
+	}
+	return fd, nil
+}
+
+// stripFileDiffNames removes strip leading path components from names of fd and
+// then maps them with mapName, if it is set. If root isn't empty and strip is
+// positive, OrigName is then made relative to root, so that it names a file there.
+func stripFileDiffNames(fd *diff.FileDiff, root string, strip int, mapName func(string) string) {
+	if strip > 0 {
+		fd.OrigName = stripPath(fd.OrigName, strip)
+		if fd.NewName != "" {
+			fd.NewName = stripPath(fd.NewName, strip)
+		}
+	}
+	if mapName != nil {
+		if fd.OrigName != "" && !isDevNull(fd.OrigName) {
+			fd.OrigName = mapName(fd.OrigName)
+		}
+		if fd.NewName != "" && !isDevNull(fd.NewName) {
+			fd.NewName = mapName(fd.NewName)
+		}
+	}
+	if strip > 0 && root != "" && !isDevNull(fd.OrigName) {
+		fd.OrigName = path.Join(root, fd.OrigName)
+	}
+}
+
+// sourceNameMatches reports whether name, the OrigName of a FileDiff stripped
+// of strip leading components, refers to the source file at sourcePath.
+func sourceNameMatches(sourcePath, name string, strip int) bool {
+	if strip <= 0 {
+		return sourcePath == name
+	}
+	sourcePath = filepath.ToSlash(filepath.Clean(sourcePath))
+	return sourcePath == name || strings.HasSuffix(sourcePath, "/"+name)
+}
+
+// readFileDiffs returns all FileDiffs of d, with /dev/null names set by setDevNullNames,
+// names stripped and mapped by stripFileDiffNames and FileDiffs of the same file merged by
+// mergeSamePathFileDiffs, or reported by checkDuplicatePaths if strict is set.
+func readFileDiffs(d io.Reader, root string, strip int, mapName func(string) string, strict bool) ([]*diff.FileDiff, error) {
+	fileDiffs, err := readPatch(d)
+	if err != nil {
+		return nil, err
+	}
+	for _, fd := range fileDiffs {
+		setDevNullNames(fd)
+		stripFileDiffNames(fd, root, strip, mapName)
+	}
+	if strict {
+		if err := checkDuplicatePaths(fileDiffs); err != nil {
+			return nil, err
+		}
+	}
+	return mergeSamePathFileDiffs(fileDiffs)
+}
+
+// fileDiffQueue returns FileDiffs one by one, like diff.MultiFileDiffReader.
+type fileDiffQueue struct {
+	fileDiffs []*diff.FileDiff
+}
+
+// ReadFile returns the next FileDiff, or io.EOF if there are no more.
+func (q *fileDiffQueue) ReadFile() (*diff.FileDiff, error) {
+	if len(q.fileDiffs) == 0 {
+		return nil, io.EOF
+	}
+	fd := q.fileDiffs[0]
+	q.fileDiffs = q.fileDiffs[1:]
+	return fd, nil
+}
+
+// readContent returns content of source as string, with line endings normalized if requested by norm.
+func readContent(source io.Reader, norm textnorm.Options) (string, error) {
+	buf := new(strings.Builder)
+	_, err := io.Copy(buf, source)
+	if err != nil {
+		return "", fmt.Errorf("copying source: %w", err)
+	}
+	if norm.Newlines {
+		return string(textnorm.Newlines([]byte(buf.String()))), nil
+	}
+	return buf.String(), nil
+}
+
+// readSource returns content of source decoded from opts.Encoding, with line
+// endings normalized if requested by opts.Normalize.
+func readSource(source io.Reader, opts MixedModeOptions) (string, error) {
+	content, err := readContent(source, textnorm.Options{})
+	if err != nil {
+		return "", err
+	}
+	content, err = opts.Encoding.decode(content)
+	if err != nil {
+		return "", fmt.Errorf("decoding source: %w", err)
+	}
+	if opts.Normalize.Newlines {
+		content = string(textnorm.Newlines([]byte(content)))
+	}
+	return content, nil
+}
+
+// normalizedDiff returns diffFile in unified format, with normalized line endings
+// if requested by norm.
+func normalizedDiff(diffFile io.Reader, norm textnorm.Options) (io.Reader, error) {
+	if norm.Newlines {
+		content, err := ioutil.ReadAll(diffFile)
 		if err != nil {
-			return "", fmt.Errorf("parsing oldDiff for %q: %w",
-				oldSourcePath, err)
+			return nil, err
 		}
+		diffFile = bytes.NewReader(textnorm.Newlines(content))
+	}
+	return unifiedDiff(diffFile)
+}
+
+// diffLines returns chunks of changes between oldLines and newLines found by differ, nil for LCSDiffer,
+// compared after normalization by norm, ignoring differences ignored by ignore. Chunks contain original
+// lines, with unchanged lines taken from oldLines.
+func diffLines(oldLines, newLines []string, norm textnorm.Options, ignore textnorm.Ignore, differ LineDiffer) []Chunk {
+	differ = lineDiffer(differ)
+	if norm.IsZero() && !ignore.SpaceChange && !ignore.AllSpace {
+		return differ.DiffChunks(oldLines, newLines)
+	}
+
+	normalize := func(lines []string) []string {
+		normalized := make([]string, len(lines))
+		for k, line := range lines {
+			normalized[k] = ignore.Key(textnorm.Line(line, norm))
+		}
+		return normalized
+	}
+	chunks := differ.DiffChunks(normalize(oldLines), normalize(newLines))
+
+	// Replace normalized lines in chunks with original ones
+	i, j := 0, 0
+	for k, c := range chunks {
+		chunks[k].Added = newLines[j : j+len(c.Added)]
+		j += len(c.Added)
+		chunks[k].Deleted = oldLines[i : i+len(c.Deleted)]
+		i += len(c.Deleted)
+		chunks[k].Equal = oldLines[i : i+len(c.Equal)]
+		i += len(c.Equal)
+		j += len(c.Equal)
+	}
+	return chunks
+}
+
+// diffLinesContext is diffLines, but fails with the error of ctx once ctx is done.
+// Differs can't be interrupted, so the diff then keeps running in the background
+// until it's complete.
+func diffLinesContext(ctx context.Context, oldLines, newLines []string, norm textnorm.Options, ignore textnorm.Ignore,
+	differ LineDiffer) ([]Chunk, error) {
+	if ctx.Done() == nil {
+		// ctx is never done
+		return diffLines(oldLines, newLines, norm, ignore, differ), nil
+	}
+	chunks := make(chan []Chunk, 1)
+	go func() {
+		chunks <- diffLines(oldLines, newLines, norm, ignore, differ)
+	}()
+	select {
+	case ch := <-chunks:
+		return ch, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// removeBlankLineHunks removes hunks of fileDiff which only add or delete blank lines.
+// Hunks with other changes keep their changes of blank lines, like they do with diff -B.
+func removeBlankLineHunks(fileDiff *diff.FileDiff) {
+	var hunks []*diff.Hunk
+	for _, h := range fileDiff.Hunks {
+		for _, line := range strings.Split(strings.TrimSuffix(string(h.Body), "\n"), "\n") {
+			if (strings.HasPrefix(line, "+") || strings.HasPrefix(line, "-")) && !textnorm.IsBlank(line[1:]) {
+				hunks = append(hunks, h)
+				break
+			}
+		}
+	}
+	fileDiff.Hunks = hunks
+}
+
+// applyDiff returns applied changes from diffFile to source.
+func applyDiff(source string, diffFile *diff.FileDiff, opts ApplyOptions) (string, error) {
+	if isBinaryFileDiff(diffFile) {
+		return applyBinary(source, diffFile)
+	}
+
+	source = opts.Newlines.source(source)
+	sourceBody := sourceLines(source)
+	if opts.Newlines != NewlineExact {
+		opts.Normalize.Newlines = true
+	}
+	addCR := opts.Newlines == NewlinePreserve && hasCRLF(source)
+
+	var keywords map[string]string
+	if opts.CollapseKeywords {
+		keywords = keywordExpansions(sourceBody)
+	}
+
+	// currentOrgSourceI = 1 -- In diff lines started counting from 1
+	var currentOrgSourceI int32 = 1
+	var newBody []string
+	// offset is how far previous hunks were moved, later hunks are looked for there first
+	var offset int32
+
+	for _, hunk := range diffFile.Hunks {
+		origStartLine := hunk.OrigStartLine
+		if hunk.OrigLines == 0 {
+			// Hunk without original lines is inserted after OrigStartLine
+			origStartLine++
+		}
+
+		hunkBody := hunks.Lines(hunk)
 
-		if oldSourcePath != oldD.OrigName {
-			return "", fmt.Errorf("filenames mismatch for oldSourcePath: %q and oldDiff: %q",
-				oldSourcePath, oldD.OrigName)
+		start, body, fuzz, err := findHunk(sourceBody, hunkBody, origStartLine, offset, currentOrgSourceI, opts)
+		var applyErr *ApplyError
+		if errors.As(err, &applyErr) {
+			applyErr.File, applyErr.Hunk = diffFile.OrigName, hunk
 		}
+		if err != nil && opts.skipFailed != nil {
+			opts.skipFailed(HunkResult{Hunk: hunk, Err: err})
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		offset = start - origStartLine - int32(fuzz.leading)
+		if opts.Report != nil {
+			opts.Report(HunkResult{Hunk: hunk, Offset: int(offset), Fuzz: fuzz.max()})
+		}
+
+		// Add untouched part of source
+		newBody = append(newBody, sourceBody[currentOrgSourceI-1:start-1]...)
+		currentOrgSourceI = start
+
+		for _, line := range body {
+			if strings.HasPrefix(line, "+") {
+				if keywords != nil {
+					line = restoreKeywords(line, keywords)
+				}
+				if addCR {
+					line = withCR(line)
+				}
+				newBody = append(newBody, line[1:])
+				continue
+			}
+			if strings.HasPrefix(line, " ") {
+				newBody = append(newBody, sourceBody[currentOrgSourceI-1])
+			}
+			currentOrgSourceI++
+		}
+	}
+
+	newBody = append(newBody, sourceBody[currentOrgSourceI-1:]...)
+
+	return joinLines(newBody), nil
+}
+
+// hunkFuzz is the number of context lines ignored at the start and at the end of a hunk.
+type hunkFuzz struct {
+	leading, trailing int
+}
+
+func (f hunkFuzz) max() int {
+	if f.leading > f.trailing {
+		return f.leading
+	}
+	return f.trailing
+}
+
+// findHunk looks for the place in sourceBody where hunkBody applies, trying the
+// position given by origStartLine and offset first, then positions at most
+// opts.MaxOffset lines away and then ignoring up to opts.Fuzz context lines.
+// It returns the line the hunk applies at and the part of hunkBody which matches there.
+// Hunks can't be applied before line min.
+func findHunk(sourceBody, hunkBody []string, origStartLine, offset, min int32, opts ApplyOptions) (int32, []string, hunkFuzz, error) {
+	// Error at the expected position is reported if the hunk isn't found anywhere
+	firstErr := matchHunk(sourceBody, hunkBody, origStartLine+offset, min, opts)
+	if firstErr == nil {
+		return origStartLine + offset, hunkBody, hunkFuzz{}, nil
+	}
+
+	var leadingContext, trailingContext int
+	for leadingContext < len(hunkBody) && strings.HasPrefix(hunkBody[leadingContext], " ") {
+		leadingContext++
+	}
+	for trailingContext < len(hunkBody)-leadingContext &&
+		strings.HasPrefix(hunkBody[len(hunkBody)-1-trailingContext], " ") {
+		trailingContext++
+	}
+
+	for f := 0; f <= opts.Fuzz; f++ {
+		fuzz := hunkFuzz{leading: f, trailing: f}
+		if fuzz.leading > leadingContext {
+			fuzz.leading = leadingContext
+		}
+		if fuzz.trailing > trailingContext {
+			fuzz.trailing = trailingContext
+		}
+		if f > 0 && fuzz.max() < f {
+			// No more context lines to ignore
+			break
+		}
+		body := hunkBody[fuzz.leading : len(hunkBody)-fuzz.trailing]
+		expected := origStartLine + offset + int32(fuzz.leading)
+
+		for distance := 0; distance <= opts.MaxOffset; distance++ {
+			for _, start := range []int32{expected + int32(distance), expected - int32(distance)} {
+				if matchHunk(sourceBody, body, start, min, opts) == nil {
+					return start, body, fuzz, nil
+				}
+				if distance == 0 {
+					break
+				}
+			}
+		}
+	}
+	return 0, nil, hunkFuzz{}, firstErr
+}
+
+// matchHunk returns an error unless context and deleted lines of body
+// match sourceBody from line start on.
+func matchHunk(sourceBody, body []string, start, min int32, opts ApplyOptions) error {
+	if start < min || start-1 > int32(len(sourceBody)) {
+		return &ApplyError{Line: int(start), Expected: firstOrigLine(body), Outside: true}
+	}
 
-		newD, err := diff.NewFileDiffReader(newDiff).Read()
-		if err != nil {
-			return "", fmt.Errorf("parsing newDiff for %q: %w",
-				newSourcePath, err)
+	i := start
+	for _, line := range body {
+		if strings.HasPrefix(line, "+") {
+			continue
 		}
-
-		if newSourcePath != newD.OrigName {
-			return "", fmt.Errorf("filenames mismatch for newSourcePath: %q and newDiff: %q",
-				newSourcePath, newD.OrigName)
+		if i > int32(len(sourceBody)) {
+			return &ApplyError{Line: int(i), Expected: line[1:], Outside: true}
 		}
-
-		resultString, err := mixedModeFilePath(oldSourcePath, newSourcePath, oldD, newD)
-		return resultString, err
-
-	case oldSourceStat.IsDir() && newSourceStat.IsDir():
-		// Both paths are directories
-		resultString, err := mixedModeDirPath(oldSourcePath, newSourcePath, oldDiff, newDiff)
-		if err != nil {
-			return "", fmt.Errorf("compute diff for %q and %q: %w",
-				oldSourcePath, newSourcePath, err)
+		if !linesMatch(line[1:], sourceBody[i-1], opts) {
+			return &ApplyError{Line: int(i), Expected: line[1:], Got: sourceBody[i-1]}
 		}
-
-		return resultString, nil
+		i++
 	}
-
-	return "", errors.New("sources should be both dirs or files")
+	return nil
 }
 
-// readContent returns content of source as string
-func readContent(source io.Reader) (string, error) {
-	buf := new(strings.Builder)
-	_, err := io.Copy(buf, source)
-	if err != nil {
-		return "", fmt.Errorf("copying source: %w", err)
+// firstOrigLine returns the first deleted or unchanged line of body without its
+// prefix, or "" if there is none.
+func firstOrigLine(body []string) string {
+	for _, line := range body {
+		if !strings.HasPrefix(line, "+") {
+			return line[1:]
+		}
 	}
-	return buf.String(), nil
+	return ""
 }
 
-// applyDiff returns applied changes from diffFile to source
-func applyDiff(source string, diffFile *diff.FileDiff) (string, error) {
-	sourceBody := strings.Split(source, "\n")
-
-	// currentOrgSourceI = 1 -- In diff lines started counting from 1
-	var currentOrgSourceI int32 = 1
-	var newBody []string
-
-	for _, hunk := range diffFile.Hunks {
-		// Add untouched part of source
-		newBody = append(newBody, sourceBody[currentOrgSourceI-1:hunk.OrigStartLine-1]...)
-		currentOrgSourceI = hunk.OrigStartLine
-
-		hunkBody := strings.Split(strings.TrimSuffix(string(hunk.Body), "\n"), "\n")
-
-		for _, line := range hunkBody {
-			if currentOrgSourceI > int32(len(sourceBody)) {
-				return "", errors.New("diff content is out of source content")
-			}
+// sourceFiles gives access to the files of a source tree.
+type sourceFiles interface {
+	// walk returns the slash-separated paths of all files under root, recursively and
+	// in lexical order, skipping files and directories excluded by exclude.
+	walk(root string, exclude excludePatterns) ([]string, error)
+	open(path string) (io.ReadCloser, error)
+}
 
-			if strings.HasPrefix(line, "+") {
-				newBody = append(newBody, line[1:])
-			} else {
-				if line[1:] != sourceBody[currentOrgSourceI-1] {
-					return "", fmt.Errorf(
-						"line %d in source (%q) and diff (%q): %w",
-						currentOrgSourceI, sourceBody[currentOrgSourceI-1], line[1:], ErrContentMismatch)
-				}
+// osFiles are the files of the OS filesystem, with relative paths resolved in dir,
+// or in the working directory if dir is empty.
+type osFiles struct {
+	dir string
+}
 
-				if strings.HasPrefix(line, " ") {
-					newBody = append(newBody, sourceBody[currentOrgSourceI-1])
-				}
+// path returns the path of the file at p, relative to the working directory or absolute.
+func (f osFiles) path(p string) string {
+	if f.dir == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(f.dir, p)
+}
 
-				currentOrgSourceI++
+func (f osFiles) walk(root string, exclude excludePatterns) ([]string, error) {
+	paths, err := getAllFileNamesInDir(f.path(root), exclude)
+	if err != nil {
+		return nil, err
+	}
+	for i, p := range paths {
+		if f.path(root) != root {
+			if p, err = filepath.Rel(f.dir, p); err != nil {
+				return nil, err
 			}
 		}
+		paths[i] = filepath.ToSlash(p)
 	}
+	return paths, nil
+}
 
-	newBody = append(newBody, sourceBody[currentOrgSourceI-1:]...)
-
-	return strings.Join(newBody, "\n"), nil
+func (f osFiles) open(path string) (io.ReadCloser, error) {
+	return os.Open(f.path(path))
 }
 
-// mixedModeFilePath computes the diff of a oldSourcePath file patched with oldFileDiff
-// and the newSourcePath file patched with newFileDiff.
-func mixedModeFilePath(oldSourcePath, newSourcePath string, oldFileDiff, newFileDiff *diff.FileDiff) (string, error) {
+// mixedModeFilePath computes the diff of a oldSourcePath file of oldFiles patched
+// with oldFileDiff and the newSourcePath file of newFiles patched with newFileDiff.
+func mixedModeFilePath(ctx context.Context, oldFiles, newFiles sourceFiles, oldSourcePath, newSourcePath string,
+	oldFileDiff, newFileDiff *diff.FileDiff, opts MixedModeOptions) (string, error) {
 	if oldFileDiff.OrigName != "" && oldFileDiff.NewName == "" && newFileDiff.OrigName != "" && newFileDiff.NewName == "" {
 		// In both updated version file has been deleted
 		return "", nil
 	}
 
+	if isDevNull(oldFileDiff.NewName) && isDevNull(newFileDiff.NewName) {
+		// Both diffs delete the file
+		return "", nil
+	}
+
 	if oldFileDiff.OrigName != "" && oldFileDiff.NewName == "" {
 		// File has been deleted in updated old version
-		return fmt.Sprintf("Only in %s: %s\n", filepath.Dir(newFileDiff.NewName),
-			filepath.Base(newFileDiff.NewName)), nil
+		if opts.NewFile {
+			return mixedModeNewFile(ctx, newFiles, newSourcePath, newFileDiff, NewSide, opts)
+		}
+		return onlyIn(opts.OnlyInFormatter, newFileDiff.NewName, NewSide), nil
 	}
 
 	if newFileDiff.OrigName != "" && newFileDiff.NewName == "" {
 		// File has been deleted in updated new version
-		return fmt.Sprintf("Only in %s: %s\n", filepath.Dir(oldFileDiff.NewName),
-			filepath.Base(oldFileDiff.NewName)), nil
+		if opts.NewFile {
+			return mixedModeNewFile(ctx, oldFiles, oldSourcePath, oldFileDiff, OldSide, opts)
+		}
+		return onlyIn(opts.OnlyInFormatter, oldFileDiff.NewName, OldSide), nil
 	}
 
-	oldSourceFile, err := os.Open(oldSourcePath)
+	oldSourceFile, err := oldFiles.open(oldSourcePath)
 	if err != nil {
 		return "", fmt.Errorf("opening oldSource file %q: %w",
 			oldSourcePath, err)
 	}
+	defer oldSourceFile.Close()
 
-	newSourceFile, err := os.Open(newSourcePath)
+	newSourceFile, err := newFiles.open(newSourcePath)
 	if err != nil {
 		return "", fmt.Errorf("opening newSource file %q: %w",
 			newSourcePath, err)
 	}
+	defer newSourceFile.Close()
 
-	resultString, err := mixedMode(oldSourceFile, newSourceFile, oldFileDiff, newFileDiff)
+	resultString, err := mixedMode(ctx, oldSourceFile, newSourceFile, oldSourcePath, newSourcePath, oldFileDiff, newFileDiff, opts)
 	if err != nil {
 		return "", fmt.Errorf("compute diff for %q: %w",
 			oldFileDiff.OrigName, err)
@@ -365,57 +1385,108 @@ func mixedModeFilePath(oldSourcePath, newSourcePath string, oldFileDiff, newFile
 	return resultString, nil
 }
 
-// mixedModeDirPath computes the diff of a oldSourcePath directory patched with oldDiff
-// and the newSourcePath directory patched with newDiff.
-func mixedModeDirPath(oldSourcePath, newSourcePath string, oldDiff, newDiff io.Reader) (string, error) {
-	oldFileNames, err := getAllFileNamesInDir(oldSourcePath)
+// mixedModeDirPath writes the diff of a oldSourcePath directory of oldFiles patched
+// with oldDiff and the newSourcePath directory of newFiles patched with newDiff to w.
+// It fails with the error of ctx once ctx is done.
+func mixedModeDirPath(ctx context.Context, w io.Writer, oldFiles, newFiles sourceFiles, oldSourcePath, newSourcePath string,
+	oldDiff, newDiff io.Reader, opts MixedModeOptions) error {
+	// Paths are compared and written slash-separated on all systems
+	oldSourcePath, newSourcePath = filepath.ToSlash(oldSourcePath), filepath.ToSlash(newSourcePath)
+	exclude, err := compileExcludes(opts.ExcludeGlobs)
 	if err != nil {
-		return "", fmt.Errorf("get all filenames for oldSource: %w", err)
+		return err
 	}
 
-	newFileNames, err := getAllFileNamesInDir(newSourcePath)
+	oldFileNames, err := oldFiles.walk(oldSourcePath, exclude)
 	if err != nil {
-		return "", fmt.Errorf("get all filenames for newSourcePath: %w", err)
+		return fmt.Errorf("get all filenames for oldSource: %w", err)
 	}
 
-	oldFileDiffReader := diff.NewMultiFileDiffReader(oldDiff)
-	newFileDiffReader := diff.NewMultiFileDiffReader(newDiff)
+	newFileNames, err := newFiles.walk(newSourcePath, exclude)
+	if err != nil {
+		return fmt.Errorf("get all filenames for newSourcePath: %w", err)
+	}
+
+	oldFileDiffs, err := readFileDiffs(oldDiff, oldSourcePath, opts.StripLevel, opts.PathMapper.forSide(OldSide), opts.Strict)
+	if err != nil {
+		return fmt.Errorf("parsing oldDiff: %w", err)
+	}
+	newFileDiffs, err := readFileDiffs(newDiff, newSourcePath, opts.StripLevel, opts.PathMapper.forSide(NewSide), opts.Strict)
+	if err != nil {
+		return fmt.Errorf("parsing newDiff: %w", err)
+	}
+	oldFileDiffs, newFileDiffs = exclude.fileDiffs(oldFileDiffs, oldSourcePath), exclude.fileDiffs(newFileDiffs, newSourcePath)
+	oldFileDiffs, newFileDiffs, err = followRenames(oldFileDiffs, newFileDiffs, diffOrderLess)
+	if err != nil {
+		return fmt.Errorf("following renames: %w", err)
+	}
+	oldFiles, oldFileNames = withAddedFiles(oldFiles, oldFileNames, oldFileDiffs, oldSourcePath, opts.StripLevel)
+	newFiles, newFileNames = withAddedFiles(newFiles, newFileNames, newFileDiffs, newSourcePath, opts.StripLevel)
+	oldFileDiffReader := &fileDiffQueue{fileDiffs: oldFileDiffs}
+	newFileDiffReader := &fileDiffQueue{fileDiffs: newFileDiffs}
 
 	lastOldFileDiff, err := oldFileDiffReader.ReadFile()
 	if err != nil && !errors.Is(err, io.EOF) {
-		return "", fmt.Errorf("parsing next FileDiff in oldDiff: %w", err)
+		return fmt.Errorf("parsing next FileDiff in oldDiff: %w", err)
 	}
 
 	lastNewFileDiff, err := newFileDiffReader.ReadFile()
 	if err != nil && !errors.Is(err, io.EOF) {
-		return "", fmt.Errorf("parsing next FileDiff in newDiff: %w", err)
+		return fmt.Errorf("parsing next FileDiff in newDiff: %w", err)
 	}
 
-	result := ""
+	result := &errWriter{w: w, resume: opts.Resume, formatOnlyIn: opts.OnlyInFormatter}
+	// fileErrs are the errors of files skipped with opts.KeepGoing
+	var fileErrs FileErrors
 	updateOldDiff, updateNewDiff := false, false
 	onlyOldFile, onlyNewFile := false, false
+	total := countFiles(oldFileNames, newFileNames, oldSourcePath, newSourcePath)
+
+	// writeOnlyFile writes the entry of the file at path of files, present in side
+	// only, which is patched with fileDiff
+	writeOnlyFile := func(files sourceFiles, path string, fileDiff *diff.FileDiff, side Side) error {
+		if !opts.NewFile {
+			result.writeOnlyIn(path, side)
+			return nil
+		}
+		entry := onlyInEntry(path, side)
+		if opts.Resume.isDone(entry) {
+			return nil
+		}
+		currentResult, err := mixedModeNewFile(ctx, files, path, fileDiff, side, opts)
+		switch {
+		case err != nil && opts.KeepGoing && ctx.Err() == nil:
+			fileErrs = append(fileErrs, &FileError{File: path, Err: err})
+		case err != nil:
+			return fmt.Errorf("mixedModeNewFile for %s file %q: %w", side, path, err)
+		default:
+			result.writeEntry(entry, currentResult)
+		}
+		return nil
+	}
 
 	// Iterate over files in FileDiff arrays
 	i, j := 0, 0
-	for i < len(oldFileNames) || j < len(newFileNames) {
+	for done := 1; i < len(oldFileNames) || j < len(newFileNames); done++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if lastOldFileDiff != nil && i < len(oldFileNames) && oldFileNames[i] > lastOldFileDiff.OrigName {
 			if lastOldFileDiff.NewName != "" {
-				return "", fmt.Errorf("oldFileDiff: %q doesn't have relative file in oldSource",
+				return fmt.Errorf("oldFileDiff: %q doesn't have relative file in oldSource",
 					lastOldFileDiff.OrigName)
 			}
 			// File has been added in old version
-			result += fmt.Sprintf("Only in %s: %s\n", filepath.Dir(lastOldFileDiff.OrigName),
-				filepath.Base(lastOldFileDiff.OrigName))
+			result.writeOnlyIn(lastOldFileDiff.OrigName, OldSide)
 		}
 
 		if lastNewFileDiff != nil && j < len(newFileNames) && newFileNames[j] > lastNewFileDiff.OrigName {
 			if lastNewFileDiff.NewName != "" {
-				return "", fmt.Errorf("newFileDiff: %q doesn't have relative file in newSource",
+				return fmt.Errorf("newFileDiff: %q doesn't have relative file in newSource",
 					lastNewFileDiff.OrigName)
 			}
 			// File has been added in new version
-			result += fmt.Sprintf("Only in %s: %s\n", filepath.Dir(lastNewFileDiff.OrigName),
-				filepath.Base(lastNewFileDiff.OrigName))
+			result.writeOnlyIn(lastNewFileDiff.OrigName, NewSide)
 		}
 
 		switch {
@@ -423,53 +1494,32 @@ func mixedModeDirPath(oldSourcePath, newSourcePath string, oldDiff, newDiff io.R
 			switch {
 			// Comparing parts after oldSourcePath and newSourcePath
 			case strings.TrimPrefix(oldFileNames[i], oldSourcePath) == strings.TrimPrefix(newFileNames[j], newSourcePath):
-				switch {
-				case lastOldFileDiff != nil && lastNewFileDiff != nil &&
-					oldFileNames[i] == lastOldFileDiff.OrigName && newFileNames[j] == lastNewFileDiff.OrigName:
-					// Both oldFile and newFile have updates
-					currentResult, err := mixedModeFilePath(oldFileNames[i], newFileNames[j], lastOldFileDiff, lastNewFileDiff)
-					if err != nil {
-						return "", fmt.Errorf("mixedModeFilePath for oldFile: %q and newFile: %q: %w",
-							oldFileNames[i], newFileNames[j], err)
-					}
-					result += currentResult
-
-					updateOldDiff = true
-					updateNewDiff = true
-
-				case lastOldFileDiff != nil && oldFileNames[i] == lastOldFileDiff.OrigName:
-					// Only oldFile has updates
-					// Empty FileDiff instead of lastNewFileDiff
-					currentResult, err := mixedModeFilePath(oldFileNames[i], newFileNames[j], lastOldFileDiff, &diff.FileDiff{})
-					if err != nil {
-						return "", fmt.Errorf("mixedModeFilePath for oldFile: %q and newFile: %q: %w",
-							oldFileNames[i], newFileNames[j], err)
-					}
-					result += currentResult
-
+				// Empty FileDiffs stand for files without updates
+				oldFileDiff, newFileDiff := &diff.FileDiff{}, &diff.FileDiff{}
+				if lastOldFileDiff != nil && oldFileNames[i] == lastOldFileDiff.OrigName {
+					oldFileDiff = lastOldFileDiff
 					updateOldDiff = true
-
-				case lastNewFileDiff != nil && newFileNames[j] == lastNewFileDiff.OrigName:
-					// Only newFile has updates
-					// Empty FileDiff instead of lastOldFileDiff
-					currentResult, err := mixedModeFilePath(oldFileNames[i], newFileNames[j], &diff.FileDiff{}, lastNewFileDiff)
-					if err != nil {
-						return "", fmt.Errorf("mixedModeFilePath for oldFile: %q and newFile: %q: %w",
-							oldFileNames[i], newFileNames[j], err)
-					}
-					result += currentResult
-
+				}
+				if lastNewFileDiff != nil && newFileNames[j] == lastNewFileDiff.OrigName {
+					newFileDiff = lastNewFileDiff
 					updateNewDiff = true
+				}
 
-				default:
-					// None of oldFile and newFile have updates
-					currentResult, err := mixedModeFilePath(oldFileNames[i], newFileNames[j], &diff.FileDiff{}, &diff.FileDiff{})
-					if err != nil {
-						return "", fmt.Errorf("mixedModeFilePath for oldFile: %q and newFile: %q: %w",
+				entry := resumeEntry{Old: oldFileNames[i], New: newFileNames[j]}
+				if !opts.Resume.isDone(entry) {
+					currentResult, err := mixedModeFilePath(ctx, oldFiles, newFiles, oldFileNames[i], newFileNames[j],
+						oldFileDiff, newFileDiff, opts)
+					switch {
+					case err != nil && opts.KeepGoing && ctx.Err() == nil:
+						fileErrs = append(fileErrs, &FileError{File: oldFileNames[i], Err: err})
+					case err != nil:
+						return fmt.Errorf("mixedModeFilePath for oldFile: %q and newFile: %q: %w",
 							oldFileNames[i], newFileNames[j], err)
+					default:
+						result.writeEntry(entry, currentResult)
 					}
-					result += currentResult
 				}
+				opts.Progress.report(oldFileNames[i], done, total)
 				i++
 				j++
 			case strings.TrimPrefix(oldFileNames[i], oldSourcePath) < strings.TrimPrefix(newFileNames[j], newSourcePath):
@@ -486,35 +1536,47 @@ func mixedModeDirPath(oldSourcePath, newSourcePath string, oldDiff, newDiff io.R
 		}
 
 		if onlyOldFile {
+			oldFileDiff := &diff.FileDiff{}
 			// mark to update oldFileDiff if last one was related to current oldFile
 			if lastOldFileDiff != nil && oldFileNames[i] == lastOldFileDiff.OrigName {
+				oldFileDiff = lastOldFileDiff
 				updateOldDiff = true
 				// If file was deleted in oldFileDiff, don't add "Only in" message later
-				if lastOldFileDiff.NewName == "" {
+				if lastOldFileDiff.NewName == "" || isDevNull(lastOldFileDiff.NewName) {
 					onlyOldFile = false
 				}
 			}
 			if onlyOldFile {
-				result += fmt.Sprintf("Only in %s: %s\n", filepath.Dir(oldFileNames[i]),
-					filepath.Base(oldFileNames[i]))
+				if err := writeOnlyFile(oldFiles, oldFileNames[i], oldFileDiff, OldSide); err != nil {
+					return err
+				}
 			}
+			opts.Progress.report(oldFileNames[i], done, total)
 			i++
 			onlyOldFile = false
 		}
 
 		if onlyNewFile {
+			newFileDiff := &diff.FileDiff{}
 			// mark to update newFileDiff if last one was related to current newFile
 			if lastNewFileDiff != nil && newFileNames[j] == lastNewFileDiff.OrigName {
+				newFileDiff = lastNewFileDiff
 				updateNewDiff = true
 				// If file was deleted in newFileDiff, don't add "Only in" message later
 				if lastNewFileDiff.NewName == "" {
 					onlyNewFile = true
 				}
+				if isDevNull(lastNewFileDiff.NewName) {
+					// Deleted with a /dev/null name, it is in neither version
+					onlyNewFile = false
+				}
 			}
 			if onlyNewFile {
-				result += fmt.Sprintf("Only in %s: %s\n", filepath.Dir(newFileNames[j]),
-					filepath.Base(newFileNames[j]))
+				if err := writeOnlyFile(newFiles, newFileNames[j], newFileDiff, NewSide); err != nil {
+					return err
+				}
 			}
+			opts.Progress.report(newFileNames[j], done, total)
 			j++
 			onlyNewFile = false
 		}
@@ -524,7 +1586,7 @@ func mixedModeDirPath(oldSourcePath, newSourcePath string, oldDiff, newDiff io.R
 			lastOldFileDiff, err = oldFileDiffReader.ReadFile()
 			if err != nil {
 				if !errors.Is(err, io.EOF) {
-					return "", fmt.Errorf("parsing next FileDiff in oldDiff: %w", err)
+					return fmt.Errorf("parsing next FileDiff in oldDiff: %w", err)
 				}
 				lastOldFileDiff = nil
 			}
@@ -536,29 +1598,32 @@ func mixedModeDirPath(oldSourcePath, newSourcePath string, oldDiff, newDiff io.R
 			lastNewFileDiff, err = newFileDiffReader.ReadFile()
 			if err != nil {
 				if !errors.Is(err, io.EOF) {
-					return "", fmt.Errorf("parsing next FileDiff in newDiff: %w", err)
+					return fmt.Errorf("parsing next FileDiff in newDiff: %w", err)
 				}
 				lastNewFileDiff = nil
 			}
 			updateNewDiff = false
 		}
+
+		if result.err != nil {
+			return fmt.Errorf("writing result: %w", result.err)
+		}
 	}
 
 	// Check if more files have been added in old version
 	for lastOldFileDiff != nil {
 		if lastOldFileDiff.NewName != "" {
-			return "", fmt.Errorf("oldFileDiff: %q doesn't have relative file in oldSource",
+			return fmt.Errorf("oldFileDiff: %q doesn't have relative file in oldSource",
 				lastOldFileDiff.OrigName)
 		}
 		// File has been added
-		result += fmt.Sprintf("Only in %s: %s\n", filepath.Dir(lastOldFileDiff.OrigName),
-			filepath.Base(lastOldFileDiff.OrigName))
+		result.writeOnlyIn(lastOldFileDiff.OrigName, OldSide)
 
 		// Update lastOldFileDiff
 		lastOldFileDiff, err = oldFileDiffReader.ReadFile()
 		if err != nil {
 			if !errors.Is(err, io.EOF) {
-				return "", fmt.Errorf("parsing next FileDiff in oldDiff: %w", err)
+				return fmt.Errorf("parsing next FileDiff in oldDiff: %w", err)
 			}
 			lastOldFileDiff = nil
 		}
@@ -567,179 +1632,205 @@ func mixedModeDirPath(oldSourcePath, newSourcePath string, oldDiff, newDiff io.R
 	// Check if more files have been added in new version
 	for lastNewFileDiff != nil {
 		if lastNewFileDiff.NewName != "" {
-			return "", fmt.Errorf("newFileDiff: %q doesn't have relative file in newSource",
+			return fmt.Errorf("newFileDiff: %q doesn't have relative file in newSource",
 				lastNewFileDiff.OrigName)
 		}
 		// File has been added
-		result += fmt.Sprintf("Only in %s: %s\n", filepath.Dir(lastNewFileDiff.OrigName),
-			filepath.Base(lastNewFileDiff.OrigName))
+		result.writeOnlyIn(lastNewFileDiff.OrigName, NewSide)
 
 		// Update lastNewFileDiff
 		lastNewFileDiff, err = newFileDiffReader.ReadFile()
 		if err != nil {
 			if !errors.Is(err, io.EOF) {
-				return "", fmt.Errorf("parsing next FileDiff in newDiff: %w", err)
+				return fmt.Errorf("parsing next FileDiff in newDiff: %w", err)
 			}
 			lastNewFileDiff = nil
 		}
 	}
 
-	return result, nil
+	if result.err != nil {
+		return fmt.Errorf("writing result: %w", result.err)
+	}
+	if len(fileErrs) > 0 {
+		return fileErrs
+	}
+	return nil
 }
 
-// getAllFileNamesInDir returns array of paths to files in root recursively.
-func getAllFileNamesInDir(root string) ([]string, error) {
-	var allFiles []string
-	err := filepath.Walk(root,
-		func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return fmt.Errorf("walk into %q: %w",
-					path, err)
-			}
-			if !info.IsDir() {
-				allFiles = append(allFiles, path)
-			}
-			return nil
-		})
-
-	return allFiles, err
+// countFiles returns the number of files of oldFileNames and newFileNames, sorted
+// paths of files in oldSourcePath and newSourcePath, counting files present in both once.
+func countFiles(oldFileNames, newFileNames []string, oldSourcePath, newSourcePath string) int {
+	n, i, j := 0, 0, 0
+	for ; i < len(oldFileNames) && j < len(newFileNames); n++ {
+		oldName, newName := strings.TrimPrefix(oldFileNames[i], oldSourcePath), strings.TrimPrefix(newFileNames[j], newSourcePath)
+		if oldName <= newName {
+			i++
+		}
+		if newName <= oldName {
+			j++
+		}
+	}
+	return n + len(oldFileNames) - i + len(newFileNames) - j
 }
 
-const contextLines = 2
+// errWriter writes entries of a result to w until the first error, which it keeps
+// in err. Entries written by an earlier run resumed with resume are skipped.
+type errWriter struct {
+	w            io.Writer
+	resume       *ResumeState
+	formatOnlyIn func(dir, name string, side Side) string
+	err          error
+}
 
-// convertChunksIntoFileDiff adds the given chunks to the fileDiff struct.
-func convertChunksIntoFileDiff(chunks []dbd.Chunk, fileDiff *diff.FileDiff) {
-	var currentOldI, currentNewI int32 = 1, 1
-	currentHunk := &diff.Hunk{
-		OrigStartLine: currentOldI,
-		NewStartLine:  currentNewI,
-	}
-	// Delete empty chunks in the beginning
-	for len(chunks) > 0 && len(chunks[0].Added) == 0 && len(chunks[0].Deleted) == 0 && len(chunks[0].Equal) == 0 {
-		chunks = chunks[1:]
+// writeEntry writes s, the result of entry e, and records it in ew.resume,
+// unless an earlier write failed or e was written by an earlier run.
+func (ew *errWriter) writeEntry(e resumeEntry, s string) {
+	if ew.err != nil || ew.resume.isDone(e) {
+		return
 	}
-	// Delete empty chunks in the end
-	last := len(chunks) - 1
-	for len(chunks) > 0 && len(chunks[last].Added) == 0 && len(chunks[last].Deleted) == 0 && len(chunks[last].Equal) == 0 {
-		chunks = chunks[:last]
-		last--
+	if _, ew.err = io.WriteString(ew.w, s); ew.err == nil {
+		ew.err = ew.resume.record(e)
 	}
+}
 
-	// If chunks contains only one element with only unchanged lines
-	if len(chunks) == 1 && len(chunks[0].Added) == 0 && len(chunks[0].Deleted) == 0 {
-		return
-	}
+// writeOnlyIn writes the entry of a file with path present in side only.
+func (ew *errWriter) writeOnlyIn(path string, side Side) {
+	ew.writeEntry(onlyInEntry(path, side), onlyIn(ew.formatOnlyIn, path, side))
+}
 
-	var currentHunkBody []string
+// onlyInEntry returns the resume entry of a file with path present in side only.
+func onlyInEntry(path string, side Side) resumeEntry {
+	if side == NewSide {
+		return resumeEntry{New: path}
+	}
+	return resumeEntry{Old: path}
+}
 
-	// If array of chunks is already empty
-	if len(chunks) == 0 {
-		return
+// mixedModeNewFile returns the diff of the file at path of files, present in side
+// only, patched with fileDiff, against /dev/null on the other side, like diff -N.
+func mixedModeNewFile(ctx context.Context, files sourceFiles, path string, fileDiff *diff.FileDiff,
+	side Side, opts MixedModeOptions) (string, error) {
+	source, err := files.open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening %s source file %q: %w", side, path, err)
 	}
+	defer source.Close()
 
-	// If first chunk contains only equal lines, we are adding last contextLines to currentHunk
-	if len(chunks[0].Added) == 0 && len(chunks[0].Deleted) == 0 {
-		currentOldI += int32(len(chunks[0].Equal))
-		currentNewI += int32(len(chunks[0].Equal))
-		if len(chunks[0].Equal) > contextLines {
-			for _, line := range chunks[0].Equal[len(chunks[0].Equal)-contextLines:] {
-				currentHunkBody = append(currentHunkBody, " "+line)
-				currentHunk.OrigStartLine = currentOldI - contextLines
-				currentHunk.NewStartLine = currentNewI - contextLines
-			}
-		} else {
-			for _, line := range chunks[0].Equal {
-				currentHunkBody = append(currentHunkBody, " "+line)
-			}
-		}
-		// Removing processed first hunk
-		chunks = chunks[1:]
+	if fileDiff.NewName == "" {
+		// Files not changed by the diffs are named by their paths
+		fileDiff = &diff.FileDiff{OrigName: path, NewName: path}
 	}
+	missing := &diff.FileDiff{OrigName: "/dev/null", NewName: "/dev/null"}
+	var result string
+	if side == OldSide {
+		result, err = mixedMode(ctx, source, strings.NewReader(""), "", "", fileDiff, missing, opts)
+	} else {
+		result, err = mixedMode(ctx, strings.NewReader(""), source, "", "", missing, fileDiff, opts)
+	}
+	if err != nil {
+		return "", fmt.Errorf("compute diff for %q: %w", path, err)
+	}
+	return result, nil
+}
 
-	var lastLines []string
-	last = len(chunks) - 1
-	// If last chunk contains equal lines, save first contextLines of equal lines for further processing
-	if len(chunks[last].Equal) > 0 {
-		if len(chunks[last].Equal) > contextLines {
-			for _, line := range chunks[last].Equal[:contextLines] {
-				lastLines = append(lastLines, " "+line)
-			}
-		} else {
-			for _, line := range chunks[last].Equal {
-				lastLines = append(lastLines, " "+line)
-			}
-		}
-		// Removing processed equal lines from last chunk
-		chunks[last].Equal = []string{}
+// addedFiles are the files of a source tree, with empty files at the paths of
+// files added by a diff, which are missing in the tree.
+type addedFiles struct {
+	sourceFiles
+	added map[string]bool
+}
+
+func (f addedFiles) open(path string) (io.ReadCloser, error) {
+	if f.added[path] {
+		return ioutil.NopCloser(strings.NewReader("")), nil
 	}
+	return f.sourceFiles.open(path)
+}
 
-	for _, c := range chunks {
-		// A chunk will not have both added and deleted lines.
-		for _, line := range c.Added {
-			currentHunkBody = append(currentHunkBody, "+"+line)
-			currentNewI++
+// withAddedFiles returns files and fileNames of the source tree at root with the
+// files added by fileDiffs, whose OrigName is /dev/null, as empty files if they are
+// missing there. The OrigName of those FileDiffs is set to the path of their file,
+// named like stripFileDiffNames names others, so that they are paired with it.
+func withAddedFiles(files sourceFiles, fileNames []string, fileDiffs []*diff.FileDiff,
+	root string, strip int) (sourceFiles, []string) {
+	existing := make(map[string]bool)
+	for _, name := range fileNames {
+		existing[name] = true
+	}
+	added := make(map[string]bool)
+	renamed := false
+	for _, fd := range fileDiffs {
+		if !isDevNull(fd.OrigName) || isDevNull(fd.NewName) {
+			continue
 		}
-		for _, line := range c.Deleted {
-			currentHunkBody = append(currentHunkBody, "-"+line)
-			currentOldI++
+		name := fd.NewName
+		if strip > 0 && root != "" {
+			name = path.Join(root, name)
 		}
+		fd.OrigName = name
+		renamed = true
+		if !existing[name] {
+			added[name] = true
+			fileNames = append(fileNames, name)
+		}
+	}
+	if !renamed {
+		return files, fileNames
+	}
+	sort.SliceStable(fileDiffs, func(i, j int) bool {
+		return diffOrderLess(fileDiffs[i].OrigName, fileDiffs[j].OrigName)
+	})
+	if len(added) == 0 {
+		return files, fileNames
+	}
+	sort.SliceStable(fileNames, func(i, j int) bool {
+		return diffOrderLess(fileNames[i], fileNames[j])
+	})
+	return addedFiles{sourceFiles: files, added: added}, fileNames
+}
 
-		// Next piece of content contains too many unchanged lines.
-		// Current hunk will be 'closed' and started new one.
-		if len(c.Equal) > 2*contextLines+1 {
-			if len(currentHunkBody) > 0 {
-				for _, line := range c.Equal[:contextLines] {
-					currentHunkBody = append(currentHunkBody, " "+line)
+// getAllFileNamesInDir returns array of paths to files in root recursively,
+// skipping files and directories excluded by exclude.
+func getAllFileNamesInDir(root string, exclude excludePatterns) ([]string, error) {
+	var allFiles []string
+	err := filepath.Walk(root,
+		func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return fmt.Errorf("walk into %q: %w",
+					path, err)
+			}
+			if path != root && exclude.excluded(relativeSourcePath(path, root), info.IsDir()) {
+				if info.IsDir() {
+					return filepath.SkipDir
 				}
-				currentHunk.OrigLines = currentOldI + contextLines + 1 - currentHunk.OrigStartLine
-				currentHunk.NewLines = currentNewI + contextLines + 1 - currentHunk.NewStartLine
-				currentHunk.Body = []byte(strings.Join(currentHunkBody, "\n") + "\n")
-				fileDiff.Hunks = append(fileDiff.Hunks, currentHunk)
+				return nil
 			}
-
-			currentOldI += int32(len(c.Equal))
-			currentNewI += int32(len(c.Equal))
-
-			currentHunk = &diff.Hunk{
-				OrigStartLine: currentOldI - contextLines,
-				NewStartLine:  currentNewI - contextLines,
+			if !info.IsDir() {
+				allFiles = append(allFiles, path)
 			}
+			return nil
+		})
 
-			// Clean currentHunkBody
-			currentHunkBody = []string{}
-			for _, line := range c.Equal[len(c.Equal)-contextLines-1:] {
-				currentHunkBody = append(currentHunkBody, " "+line)
-			}
+	return allFiles, err
+}
 
-		} else {
-			for _, line := range c.Equal {
-				currentHunkBody = append(currentHunkBody, " "+line)
-				currentOldI++
-				currentNewI++
-			}
-		}
-	}
+// DefaultContextLines is the number of unchanged lines shown around changes in computed diffs.
+const DefaultContextLines = hunks.DefaultContextLines
 
-	// Add lastLines (equal) to last hunk
-	for _, line := range lastLines {
-		currentHunkBody = append(currentHunkBody, line)
-		currentOldI++
-		currentNewI++
-	}
+// NoContext as ContextLines of MixedModeOptions gives diffs without unchanged lines.
+const NoContext = hunks.NoContext
 
-	// currentHunkBody contains some lines. It need to be 'closed' and added to fileDiff.Hunks
-	currentHunk.OrigLines = currentOldI - currentHunk.OrigStartLine
-	currentHunk.NewLines = currentNewI - currentHunk.NewStartLine
-	currentHunk.Body = []byte(strings.Join(currentHunkBody, "\n") + "\n")
-	fileDiff.Hunks = append(fileDiff.Hunks, currentHunk)
-}
+// DefaultHunkBreakGap is the minimum number of unchanged lines between two changes
+// that puts them into separate hunks of computed diffs.
+const DefaultHunkBreakGap = hunks.DefaultHunkBreakGap
 
 // interPrintSingleFileDiff returns printed version of diffFile, which was found only in one out of two versions.
-func interPrintSingleFileDiff(diffFile *diff.FileDiff) (string, error) {
+// "Only in" entries of side are rendered by formatOnlyIn, if it is set.
+func interPrintSingleFileDiff(diffFile *diff.FileDiff, side Side,
+	formatOnlyIn func(dir, name string, side Side) string) (string, error) {
 	if diffFile.NewName == "" {
 		// File has been added in current version
-		return fmt.Sprintf("Only in %s: %s\n", filepath.Dir(diffFile.OrigName),
-			filepath.Base(diffFile.OrigName)), nil
+		return onlyIn(formatOnlyIn, diffFile.OrigName, side), nil
 	}
 
 	// File has been changed in current version and left unchanged in other version
@@ -751,364 +1842,207 @@ func interPrintSingleFileDiff(diffFile *diff.FileDiff) (string, error) {
 	return string(oldD), nil
 }
 
-// interFileDiff returns a new diff.FileDiff that is a diff of a source file patched with oldFileDiff
-// and the same source file patched with newFileDiff.
-func interFileDiff(oldFileDiff, newFileDiff *diff.FileDiff) (*diff.FileDiff, error) {
-
-	// Configuration of result FileDiff
-	// TODO: something with extended (extended header lines)
-
-	resultFileDiff := &diff.FileDiff{
-		OrigName: oldFileDiff.NewName,
-		OrigTime: oldFileDiff.NewTime,
-		NewName:  newFileDiff.NewName,
-		NewTime:  newFileDiff.NewTime,
-		Extended: []string{},
-		Hunks:    []*diff.Hunk{}}
-
-	// Iterating over hunks in order they start in origin
-	i, j := 0, 0
-	for i < len(oldFileDiff.Hunks) && j < len(newFileDiff.Hunks) {
-		switch {
-		case oldFileDiff.Hunks[i].OrigStartLine+oldFileDiff.Hunks[i].OrigLines < newFileDiff.Hunks[j].OrigStartLine:
-			// Whole oldHunk is before starting of newHunk
-			resultFileDiff.Hunks = append(resultFileDiff.Hunks,
-				revertedHunkBody(oldFileDiff.Hunks[i]))
-			i++
-		case newFileDiff.Hunks[j].OrigStartLine+newFileDiff.Hunks[j].OrigLines < oldFileDiff.Hunks[i].OrigStartLine:
-			// Whole newHunk is before starting of oldHunk
-			resultFileDiff.Hunks = append(resultFileDiff.Hunks, newFileDiff.Hunks[j])
-			j++
-		default:
-			// oldHunk and newHunk are overlapping somehow
-			// Collecting a whole set of overlapping hunks to produce one continuous hunk
-			oldHunks, newHunks := findOverlappingHunkSet(oldFileDiff, newFileDiff, &i, &j)
-			mergedOverlappingHunk, err := mergeOverlappingHunks(oldHunks, newHunks)
-
-			if err != nil {
-				return nil, fmt.Errorf("merging overlapping hunks: %w", err)
-			}
-
-			// In case opposite hunks aren't doing same changes.
-			if mergedOverlappingHunk != nil {
-				resultFileDiff.Hunks = append(resultFileDiff.Hunks, mergedOverlappingHunk)
-			}
-		}
-	}
-
-	// In case there are more hunks in oldFileDiff, while hunks of newFileDiff are run out
-	for i < len(oldFileDiff.Hunks) {
-		resultFileDiff.Hunks = append(resultFileDiff.Hunks,
-			revertedHunkBody(oldFileDiff.Hunks[i]))
-		i++
-	}
-
-	// In case there are more hunks in newFileDiff, while hunks of oldFileDiff are run out
-	for j < len(newFileDiff.Hunks) {
-		resultFileDiff.Hunks = append(resultFileDiff.Hunks, newFileDiff.Hunks[j])
-		j++
+// revertedSingleFileDiff returns diffFile, which was found only in the old version,
+// with its changes undone. Files added or deleted by diffFile are deleted or added
+// back with their names swapped, so that /dev/null stays on the side without them.
+func revertedSingleFileDiff(diffFile *diff.FileDiff) *diff.FileDiff {
+	if isDevNull(diffFile.OrigName) || isDevNull(diffFile.NewName) {
+		return ReverseFileDiff(diffFile)
 	}
-
-	return resultFileDiff, nil
+	revertHunks(diffFile)
+	diffFile.Extended = reversedExtended(diffFile.Extended)
+	return diffFile
 }
 
-// findOverlappingHunkSet finds next set (two arrays: oldHunks and newHunks) of
-// overlapping hunks in oldFileDiff and newFileDiff, starting from position i, j relatively.
-func findOverlappingHunkSet(oldFileDiff, newFileDiff *diff.FileDiff, i, j *int) (oldHunks, newHunks []*diff.Hunk) {
-	// Collecting overlapped hunks into two arrays
-
-	oldHunks = append(oldHunks, oldFileDiff.Hunks[*i])
-	newHunks = append(newHunks, newFileDiff.Hunks[*j])
-	*i++
-	*j++
+// interFileDiff returns a new diff.FileDiff that is a diff of a source file patched with oldFileDiff
+// and the same source file patched with newFileDiff. If markers is set, overlapping hunks
+// which disagree about the source are turned into conflict hunks, which are returned.
+// Lines added by both diffs are compared with differ, nil for LCSDiffer.
+func interFileDiff(oldFileDiff, newFileDiff *diff.FileDiff, markers bool, differ LineDiffer) (*diff.FileDiff, []Conflict, error) {
+	if isBinaryFileDiff(oldFileDiff) || isBinaryFileDiff(newFileDiff) {
+		return binaryInterFileDiff(oldFileDiff, newFileDiff), nil, nil
+	}
+
+	var conflicts []Conflict
+	resultFileDiff, err := hunks.InterFileDiffFunc(oldFileDiff, newFileDiff,
+		func(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, error) {
+			mergedOverlappingHunk, err := hunks.MergeOverlappingHunks(oldHunks, newHunks, differ)
+			if markers && errors.Is(err, ErrContentMismatch) {
+				var conflict Conflict
+				mergedOverlappingHunk, conflict, err = conflictHunk(oldHunks, newHunks)
+				conflict.File = oldFileDiff.OrigName
+				conflicts = append(conflicts, conflict)
+			}
+			return mergedOverlappingHunk, err
+		})
+	if err != nil {
+		return nil, nil, err
+	}
 
-Loop:
-	for {
-		switch {
-		// Starting line of oldHunk is in previous newHunk body (between start and last lines)
-		case *i < len(oldFileDiff.Hunks) && oldFileDiff.Hunks[*i].OrigStartLine >= newFileDiff.Hunks[*j-1].OrigStartLine &&
-			oldFileDiff.Hunks[*i].OrigStartLine < newFileDiff.Hunks[*j-1].OrigStartLine+newFileDiff.Hunks[*j-1].OrigLines:
-			oldHunks = append(oldHunks, oldFileDiff.Hunks[*i])
-			*i++
-		// Starting line of newHunk is in previous oldHunk body (between start and last lines)
-		case *j < len(newFileDiff.Hunks) && newFileDiff.Hunks[*j].OrigStartLine >= oldFileDiff.Hunks[*i-1].OrigStartLine &&
-			newFileDiff.Hunks[*j].OrigStartLine < oldFileDiff.Hunks[*i-1].OrigStartLine+oldFileDiff.Hunks[*i-1].OrigLines:
-			newHunks = append(newHunks, newFileDiff.Hunks[*j])
-			*j++
-		default:
-			// No overlapping hunks left
-			break Loop
-		}
+	if len(conflicts) > 0 {
+		// The new version is the old one with both versions of conflicts in it
+		renumberNewLines(resultFileDiff.Hunks)
 	}
 
-	return oldHunks, newHunks
+	setInterExtended(resultFileDiff, oldFileDiff, newFileDiff)
+	return resultFileDiff, conflicts, nil
 }
 
-// mergeOverlappingHunks returns a new diff.Hunk that is a diff hunk between overlapping oldHunks and newHunks,
-// related to the same source file.
-func mergeOverlappingHunks(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, error) {
-	resultHunk, currentOrgI, err := configureResultHunk(oldHunks, newHunks)
-
+// conflictHunk returns a hunk replacing the lines of the old version changed by
+// overlapping oldHunks and newHunks, which disagree about the source, with the
+// lines of both versions between conflict markers, and the conflict without its
+// file. Source lines between hunks of one side are taken from the hunks of the
+// other side.
+func conflictHunk(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, Conflict, error) {
+	resultHunk, err := hunks.ResultHunk(oldHunks, newHunks)
 	if err != nil {
-		return nil, fmt.Errorf("configuring result hunk: %w", err)
+		return nil, Conflict{}, fmt.Errorf("configuring result hunk: %w", err)
 	}
 
-	// Indexes of hunks
-	currentOldHunkI, currentNewHunkJ := 0, 0
-	// Indexes of lines in body hunks
-	// if indexes == -1 -- we don't have relevant hunk, which contains changes nearby currentOrgI
-	i, j := -1, -1
-
-	// Body of hunks
-	var newBody []string
-	var oldHunkBody, newHunkBody []string
-
-	// Iterating through the hunks in the order they're appearing in origin file.
-	// Using number of line in origin (currentOrgI) as an anchor to process line by line.
-	// By using currentOrgI as anchor it is easier to see how changes have been applied step by step.
-
-	// Merge, while there are hunks to process
-	for currentOldHunkI < len(oldHunks) || currentNewHunkJ < len(newHunks) {
-
-		// Entering next hunk in oldHunks
-		if currentOldHunkI < len(oldHunks) && i == -1 && currentOrgI == oldHunks[currentOldHunkI].OrigStartLine {
-			i = 0
-			oldHunkBody = strings.Split(strings.TrimSuffix(string(oldHunks[currentOldHunkI].Body), "\n"), "\n")
-		}
-
-		// Entering next hunk in newHunks
-		if currentNewHunkJ < len(newHunks) && j == -1 && currentOrgI == newHunks[currentNewHunkJ].OrigStartLine {
-			j = 0
-			newHunkBody = strings.Split(strings.TrimSuffix(string(newHunks[currentNewHunkJ].Body), "\n"), "\n")
-		}
-
-		switch {
-		case i == -1 && j == -1:
-		case i >= 0 && j == -1:
-			// Changes are only in oldHunk
-			newBody = append(newBody, revertedLine(oldHunkBody[i]))
-			// In case current line haven't been added, we have processed anchor line.
-			if !strings.HasPrefix(oldHunkBody[i], "+") {
-				// Updating index of anchor line.
-				currentOrgI++
-			}
-			i++
-
-		case i == -1 && j >= 0:
-			// Changes are only in newHunk
-			newBody = append(newBody, newHunkBody[j])
-			// In case current line haven't been added, we have processed anchor line.
-			if !strings.HasPrefix(newHunkBody[j], "+") {
-				// Updating index of anchor line.
-				currentOrgI++
+	// Lines start to end, exclusive, of the source are changed by the hunks
+	start, end := hunkFirstLine(oldHunks[0]), hunkFirstLine(oldHunks[0])
+	for _, side := range [][]*diff.Hunk{oldHunks, newHunks} {
+		for _, h := range side {
+			if first := hunkFirstLine(h); first < start {
+				start = first
 			}
-			j++
-
-		default:
-			// Changes are in old and new hunks.
-			switch {
-			// Firstly proceeding added lines,
-			// because added lines are between previous currentOrgI and currentOrgI.
-			case strings.HasPrefix(oldHunkBody[i], "+") || strings.HasPrefix(newHunkBody[j], "+"):
-				newBody = append(newBody, interAddedLines(&i, &j, &oldHunkBody, &newHunkBody)...)
-			default:
-				// Checking if original content is the same
-				if oldHunkBody[i][1:] != newHunkBody[j][1:] {
-					return nil, fmt.Errorf(
-						"line in original %d in oldDiff (%q) and newDiff (%q): %w",
-						currentOrgI, oldHunkBody[i][1:], newHunkBody[j][1:], ErrContentMismatch)
-				}
-				switch {
-				case strings.HasPrefix(oldHunkBody[i], " ") && strings.HasPrefix(newHunkBody[j], " "):
-					newBody = append(newBody, oldHunkBody[i])
-				case strings.HasPrefix(oldHunkBody[i], "-") && strings.HasPrefix(newHunkBody[j], " "):
-					newBody = append(newBody, revertedLine(oldHunkBody[i]))
-				case strings.HasPrefix(oldHunkBody[i], " ") && strings.HasPrefix(newHunkBody[j], "-"):
-					newBody = append(newBody, newHunkBody[j])
-					// If both have deleted same line, no need to append it to newBody
-				}
-
-				// Updating currentOrgI since we have processed anchor line.
-				currentOrgI++
-				i++
-				j++
+			if last := hunkFirstLine(h) + h.OrigLines; last > end {
+				end = last
 			}
 		}
+	}
+	oldLines := patchedLines(oldHunks, newHunks, start, end)
+	newLines := patchedLines(newHunks, oldHunks, start, end)
 
-		if i >= len(oldHunkBody) {
-			// Proceed whole oldHunkBody
-			i = -1
-			currentOldHunkI++
-		}
-
-		if j >= len(newHunkBody) {
-			// Proceed whole newHunkBody
-			j = -1
-			currentNewHunkJ++
-		}
+	var body []string
+	for _, line := range oldLines {
+		body = append(body, "-"+line)
+	}
+	body = append(body, "+<<<<<<< oldDiff")
+	for _, line := range oldLines {
+		body = append(body, "+"+line)
 	}
+	body = append(body, "+=======")
+	for _, line := range newLines {
+		body = append(body, "+"+line)
+	}
+	body = append(body, "+>>>>>>> newDiff")
 
-	resultHunk.Body = []byte(strings.Join(newBody, "\n") + "\n")
+	resultHunk.OrigLines = int32(len(oldLines))
+	resultHunk.NewLines = int32(len(oldLines) + len(newLines) + 3)
+	hunks.SetLines(resultHunk, body)
 
-	for _, line := range newBody {
-		if !strings.HasPrefix(line, " ") {
-			// resultHunkBody contains some changes
-			return resultHunk, nil
-		}
+	oldText, err := diff.PrintHunks(oldHunks)
+	if err != nil {
+		return nil, Conflict{}, fmt.Errorf("printing old hunks: %w", err)
 	}
-
-	return nil, nil
+	newText, err := diff.PrintHunks(newHunks)
+	if err != nil {
+		return nil, Conflict{}, fmt.Errorf("printing new hunks: %w", err)
+	}
+	return resultHunk, Conflict{
+		OrigStartLine: int(start),
+		OrigEndLine:   int(end) - 1,
+		OldHunks:      string(oldText),
+		NewHunks:      string(newText),
+	}, nil
 }
 
-// interAddedLines finds interdiff between added lines in oldHunkBody (after i) and newHunkBody (after j)
-func interAddedLines(i, j *int, oldHunkBody, newHunkBody *[]string) []string {
-	var result, oldAddedLines, newAddedLines []string
-	// Collect added lines in oldHunkBody
-	for (*i < len(*oldHunkBody)) && (strings.HasPrefix((*oldHunkBody)[*i], "+")) {
-		oldAddedLines = append(oldAddedLines, (*oldHunkBody)[*i][1:])
-		*i++
-	}
-	// Collect added lines in newHunkBody
-	for (*j < len(*newHunkBody)) && (strings.HasPrefix((*newHunkBody)[*j], "+")) {
-		newAddedLines = append(newAddedLines, (*newHunkBody)[*j][1:])
-		*j++
+// hunkFirstLine returns the first line of the source h changes, or the line it
+// adds lines before if it only adds lines.
+func hunkFirstLine(h *diff.Hunk) int32 {
+	if h.OrigLines == 0 {
+		return h.OrigStartLine + 1
 	}
+	return h.OrigStartLine
+}
 
-	// Difference between collected added lines
-	chunks := dbd.DiffChunks(oldAddedLines, newAddedLines)
-	for _, c := range chunks {
-		// A chunk will not have both added and deleted lines.
-		for _, line := range c.Added {
-			result = append(result, "+"+line)
-		}
-		for _, line := range c.Deleted {
-			result = append(result, "-"+line)
-		}
-		for _, line := range c.Equal {
-			result = append(result, " "+line)
+// patchedLines returns lines start to end, exclusive, of the source patched with
+// sideHunks, which are in order and within them. Lines sideHunks don't cover are
+// taken from the other hunks.
+func patchedLines(sideHunks, other []*diff.Hunk, start, end int32) []string {
+	source := make(map[int32]string)
+	for _, h := range append(append([]*diff.Hunk{}, other...), sideHunks...) {
+		n := hunkFirstLine(h)
+		for _, line := range hunks.Lines(h) {
+			if op, text := hunks.SplitLine(line); op == ' ' || op == '-' {
+				source[n] = text
+				n++
+			}
 		}
 	}
 
-	return result
-}
-
-// configureResultHunk returns a new diff.Hunk (with configured StartLines and NumberLines)
-// and currentOrgI (number of anchor line) based on oldHunks and newHunks, for their further merge.
-func configureResultHunk(oldHunks, newHunks []*diff.Hunk) (*diff.Hunk, int32, error) {
-	if len(oldHunks) == 0 || len(newHunks) == 0 {
-		return nil, 0, errors.New("one of the hunks array is empty")
+	var lines []string
+	n := start
+	for _, h := range sideHunks {
+		for ; n < hunkFirstLine(h); n++ {
+			lines = append(lines, source[n])
+		}
+		for _, line := range hunks.Lines(h) {
+			if op, text := hunks.SplitLine(line); op == ' ' || op == '+' {
+				lines = append(lines, text)
+			}
+		}
+		n = hunkFirstLine(h) + h.OrigLines
 	}
-
-	var currentOrgI int32
-	resultHunk := &diff.Hunk{
-		// TODO: Concatenate sections
-		Section: "",
-		Body:    []byte{0},
+	for ; n < end; n++ {
+		lines = append(lines, source[n])
 	}
+	return lines
+}
 
-	firstOldHunk, firstNewHunk := oldHunks[0], newHunks[0]
-	lastOldHunk, lastNewHunk := oldHunks[len(oldHunks)-1], newHunks[len(newHunks)-1]
-
-	// Calculate StartLine for origin and new in result
-	if firstOldHunk.OrigStartLine < firstNewHunk.OrigStartLine {
-		// Started with old hunk
-		currentOrgI = firstOldHunk.OrigStartLine
-		// As we started with this old hunk, OrigStartLine will be same as start line of hunk in old source
-		resultHunk.OrigStartLine = firstOldHunk.NewStartLine
-		// StartLine in firstNewHunk - number of origin lines between start of firstNewHunk and start of resultHunk
-		resultHunk.NewStartLine = currentOrgI +
-			firstNewHunk.NewStartLine - firstNewHunk.OrigStartLine
-	} else {
-		// Started with new hunk
-		currentOrgI = firstNewHunk.OrigStartLine
-		// StartLine in firstOldHunk - number of origin lines between start of firstOldHunk and start of resultHunk
-		resultHunk.OrigStartLine = currentOrgI +
-			firstOldHunk.NewStartLine - firstOldHunk.OrigStartLine
-		// As we started with this new hunk, NewStartLine will be same as start line of hunk in new source
-		resultHunk.NewStartLine = firstNewHunk.NewStartLine
-	}
-
-	// Calculate NumberLines for origin and new in result
-	if lastOldHunk.OrigStartLine+lastOldHunk.OrigLines >
-		lastNewHunk.OrigStartLine+lastNewHunk.OrigLines {
-		// Finished with old hunk
-		// Last line of lastOldHunk - first line of origin in resultHunk
-		resultHunk.OrigLines = lastOldHunk.NewStartLine + lastOldHunk.NewLines - resultHunk.OrigStartLine
-		// Last line of new in resultHunk - first line of new in resultHunk
-		// lastNewHunk.NewStartLine + lastNewHunk.NewLines = last line of lastNewHunk
-		resultHunk.NewLines = lastNewHunk.NewStartLine + lastNewHunk.NewLines +
-			// + number of origin lines between last line of lastNewHunk and lastOldHunk
-			lastOldHunk.OrigStartLine + lastOldHunk.OrigLines -
-			lastNewHunk.OrigStartLine - lastNewHunk.OrigLines -
-			// - first line of new in resultHunk
-			resultHunk.NewStartLine
-	} else {
-		// Finished with new hunk
-		// Last line of old in resultHunk - first line of old in resultHunk
-		// lastOldHunk.NewStartLine + lastOldHunk.NewLines = last line of lastOldHunk
-		resultHunk.OrigLines = lastOldHunk.NewStartLine + lastOldHunk.NewLines +
-			// + number of origin lines between last line of lastOldHunk and lastNewHunk
-			lastNewHunk.OrigStartLine + lastNewHunk.OrigLines -
-			lastOldHunk.OrigStartLine - lastOldHunk.OrigLines -
-			// - first line of old in resultHunk
-			resultHunk.OrigStartLine
-		// Last line of lastNewHunk - first line of new in resultHunk
-		resultHunk.NewLines = lastNewHunk.NewStartLine + lastNewHunk.NewLines - resultHunk.NewStartLine
+// renumberNewLines sets the start lines in the new version of hunks, which are in
+// order, from their start lines in the original version and the lines added and
+// deleted by the hunks before them.
+func renumberNewLines(hunks []*diff.Hunk) {
+	var delta int32
+	for _, h := range hunks {
+		first := hunkFirstLine(h) + delta
+		if h.NewLines == 0 {
+			first--
+		}
+		h.NewStartLine = first
+		delta += hunkmath.HunkDelta(h)
 	}
-
-	resultHunk.OrigNoNewlineAt = 0
-	resultHunk.StartPosition = firstOldHunk.StartPosition
-
-	return resultHunk, currentOrgI, nil
 }
 
 // revertHunks reverts each hunk body in hunks in diffFile
 func revertHunks(diffFile *diff.FileDiff) {
 	for k, h := range diffFile.Hunks {
-		diffFile.Hunks[k] = revertedHunkBody(h)
+		diffFile.Hunks[k] = hunks.RevertedHunk(h)
 	}
 }
 
-// revertedHunkBody returns a copy of hunk with reverted lines of Body.
-func revertedHunkBody(hunk *diff.Hunk) *diff.Hunk {
-	var newBody []string
-
-	lines := strings.Split(string(hunk.Body), "\n")
-
-	for _, line := range lines {
-		newBody = append(newBody, revertedLine(line))
+// sourceLines returns the lines of content without their newlines, with
+// hunks.NoNewlineSuffix added to the last line if it has none.
+func sourceLines(content string) []string {
+	if content == "" {
+		return nil
 	}
-
-	revertedHunk := &diff.Hunk{
-		OrigStartLine:   hunk.OrigStartLine,
-		OrigLines:       hunk.OrigLines,
-		OrigNoNewlineAt: hunk.OrigNoNewlineAt,
-		NewStartLine:    hunk.NewStartLine,
-		NewLines:        hunk.NewLines,
-		Section:         hunk.Section,
-		StartPosition:   hunk.StartPosition,
-		Body:            []byte(strings.Join(newBody, "\n") + "\n"),
+	if strings.HasSuffix(content, "\n") {
+		return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
 	}
-
-	return revertedHunk
+	lines := strings.Split(content, "\n")
+	lines[len(lines)-1] += hunks.NoNewlineSuffix
+	return lines
 }
 
-// revertedLine returns a reverted line.
-// `+` added lines are marked as `-` deleted and vise versa.
-// ` ` unchanged lines are left as unchanged.
-func revertedLine(line string) string {
-	switch {
-	case strings.HasPrefix(line, "+"):
-		return "-" + line[1:]
-	case strings.HasPrefix(line, "-"):
-		return "+" + line[1:]
-	default:
-		return line
+// joinLines returns the content of lines as returned by sourceLines. Only the
+// last line is left without a newline if it has hunks.NoNewlineSuffix.
+func joinLines(lines []string) string {
+	var b strings.Builder
+	for k, line := range lines {
+		text := strings.TrimSuffix(line, hunks.NoNewlineSuffix)
+		b.WriteString(text)
+		if text == line || k < len(lines)-1 {
+			b.WriteByte('\n')
+		}
 	}
+	return b.String()
 }
 
 // ErrContentMismatch indicates that compared content is not same.
-var ErrContentMismatch = errors.New("content mismatch")
+var ErrContentMismatch = hunks.ErrContentMismatch
 
 // ErrEmptyDiffFile indicates that provided file doesn't contain any information about changes.
 var ErrEmptyDiffFile = errors.New("empty diff file")
@@ -2,14 +2,19 @@ package patchutils
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/google/go-patchutils/textnorm"
 	"github.com/sourcegraph/go-diff/diff"
 )
 
@@ -70,6 +75,12 @@ var interDiffFileTests = []struct {
 		diffBFile:  "s1_a_d.diff",
 		resultFile: "s1_c_d.diff",
 	},
+	// Same files with different path prefixes
+	{
+		diffAFile:  "p1_a.diff",
+		diffBFile:  "p1_b.diff",
+		resultFile: "p1_a_b.diff",
+	},
 }
 
 var applyDiffFileTests = []struct {
@@ -163,6 +174,7 @@ var mixedModePathFileTests = []struct {
 	oldDiffFile string
 	newSource   string
 	newDiffFile string
+	opts        MixedModeOptions
 	resultFile  string
 	wantErr     bool
 }{
@@ -201,6 +213,41 @@ var mixedModePathFileTests = []struct {
 		resultFile:  "s1_a_c.diff",
 		wantErr:     true,
 	},
+	// File and the directory it is in
+	{
+		oldSource:   "source_1/file_1.txt",
+		oldDiffFile: "f1_a.diff",
+		newSource:   "source_1_b",
+		newDiffFile: "s1_b_c.diff",
+		resultFile:  "f1_a_c.diff",
+		wantErr:     false,
+	},
+	{
+		oldSource:   "source_1",
+		oldDiffFile: "s1_a.diff",
+		newSource:   "source_1_b/file_1.txt",
+		newDiffFile: "f1_b_c.diff",
+		resultFile:  "f1_a_c.diff",
+		wantErr:     false,
+	},
+	// File moved into a subdirectory
+	{
+		oldSource:   "source_1/file_1.txt",
+		oldDiffFile: "f1_a.diff",
+		newSource:   "source_1_moved",
+		newDiffFile: "s1_moved_c.diff",
+		resultFile:  "f1_a_moved_c.diff",
+		wantErr:     false,
+	},
+	// File missing from the directory
+	{
+		oldSource:   "source_1_d/file_3.txt",
+		oldDiffFile: "f1_a.diff",
+		newSource:   "source_1_moved",
+		newDiffFile: "s1_moved_c.diff",
+		resultFile:  "f1_a_moved_c.diff",
+		wantErr:     true,
+	},
 	// Contains added and unchanged files
 	{
 		oldSource:   "source_1",
@@ -210,32 +257,39 @@ var mixedModePathFileTests = []struct {
 		resultFile:  "s1_a_d.diff",
 		wantErr:     false,
 	},
+	// Diffs made by git, with a/ and b/ prefixes
+	{
+		oldSource:   "source_1",
+		oldDiffFile: "s1_a_git.diff",
+		newSource:   "source_1_b",
+		newDiffFile: "s1_b_c_git.diff",
+		opts:        MixedModeOptions{StripLevel: 1},
+		resultFile:  "s1_a_c_git.diff",
+		wantErr:     false,
+	},
+	{
+		oldSource:   "source_1",
+		oldDiffFile: "s1_a_git.diff",
+		newSource:   "source_1_b",
+		newDiffFile: "s1_b_c_git.diff",
+		resultFile:  "s1_a_c_git.diff",
+		wantErr:     true,
+	},
 }
 
-// Reference: https://www.programming-books.io/essential/go/normalize-newlines-1d3abcf6f17c4186bb9617fa14074e48
-// NormalizeNewlines normalizes \r\n (windows) and \r (mac)
-// into \n (unix)
-func normalizeNewlines(d []byte) []byte {
-	// replace CR LF \r\n (windows) with LF \n (unix)
-	d = bytes.Replace(d, []byte{13, 10}, []byte{10}, -1)
-	// replace CF \r (mac) with LF \n (unix)
-	d = bytes.Replace(d, []byte{13}, []byte{10}, -1)
-	return d
-}
+// testFilesDir is the directory of the test files, which source paths are resolved in.
+const testFilesDir = "test_examples"
 
-func init() {
-	time.Local = time.UTC
-	testFilesDir := "test_examples"
-	if err := os.Chdir(testFilesDir); err != nil {
-		fmt.Println(fmt.Errorf("failed change dir to: %q: %w", testFilesDir, err))
-	}
+// testFile returns the path of the test file called name.
+func testFile(name string) string {
+	return filepath.Join(testFilesDir, name)
 }
 
 func TestInterDiffMode(t *testing.T) {
 	for _, tt := range interDiffFileTests {
 		t.Run(tt.resultFile, func(t *testing.T) {
-			var fileA, errA = os.Open(tt.diffAFile)
-			var fileB, errB = os.Open(tt.diffBFile)
+			var fileA, errA = os.Open(testFile(tt.diffAFile))
+			var fileB, errB = os.Open(testFile(tt.diffBFile))
 
 			if errA != nil {
 				t.Errorf("Error in opening %s file.", tt.diffAFile)
@@ -245,7 +299,7 @@ func TestInterDiffMode(t *testing.T) {
 				t.Errorf("Error in opening %s file.", tt.diffBFile)
 			}
 
-			correctResult, err := ioutil.ReadFile(tt.resultFile)
+			correctResult, err := ioutil.ReadFile(testFile(tt.resultFile))
 
 			if err != nil {
 				t.Error(err)
@@ -257,7 +311,7 @@ func TestInterDiffMode(t *testing.T) {
 			currentResult, err := InterDiff(readerA, readerB)
 
 			if (tt.wantErr == nil) && (err == nil) {
-				if !bytes.Equal(normalizeNewlines([]byte(currentResult)), normalizeNewlines(correctResult)) {
+				if !bytes.Equal(textnorm.Newlines([]byte(currentResult)), textnorm.Newlines(correctResult)) {
 					t.Errorf("File contents mismatch for %s.\nExpected:\n%s\nGot:\n%s\n",
 						tt.resultFile, correctResult, currentResult)
 				}
@@ -268,15 +322,317 @@ func TestInterDiffMode(t *testing.T) {
 	}
 }
 
+// failingWriter fails all writes with errWrite.
+type failingWriter struct{}
+
+var errWrite = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWrite
+}
+
+func TestInterDiffTo(t *testing.T) {
+	oldDiff, err := ioutil.ReadFile(testFile("s1_a_c.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDiff, err := ioutil.ReadFile(testFile("s1_a_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	correctResult, err := ioutil.ReadFile(testFile("s1_c_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result bytes.Buffer
+	if err := InterDiffTo(&result, bytes.NewReader(oldDiff), bytes.NewReader(newDiff)); err != nil {
+		t.Fatalf("InterDiffTo: got error %v; want error nil", err)
+	}
+	if !bytes.Equal(textnorm.Newlines(result.Bytes()), textnorm.Newlines(correctResult)) {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result.Bytes(), correctResult)
+	}
+
+	err = InterDiffTo(failingWriter{}, bytes.NewReader(oldDiff), bytes.NewReader(newDiff))
+	if !errors.Is(err, errWrite) {
+		t.Errorf("InterDiffTo to failing writer: got error %v; want error %v", err, errWrite)
+	}
+}
+
+var interDiffOptionsTests = []struct {
+	name    string
+	oldDiff string
+	newDiff string
+	opts    InterDiffOptions
+	result  string
+	wantErr error
+}{
+	{
+		name:    "strip level",
+		oldDiff: "--- a/x\n+++ b/x\n@@ -1,1 +1,1 @@\n-1\n+2\n",
+		newDiff: "--- c/x\n+++ d/x\n@@ -1,1 +1,1 @@\n-1\n+3\n",
+		opts:    InterDiffOptions{StripLevel: 1},
+		result:  "--- x\n+++ x\n@@ -1,1 +1,1 @@\n-2\n+3\n",
+	},
+	{
+		name:    "strict",
+		oldDiff: "--- x\n+++ x\n@@ -1,1 +1,1 @@\n-1\n+2\n--- x\n+++ x\n@@ -1,1 +1,1 @@\n-2\n+3\n",
+		newDiff: "--- x\n+++ x\n@@ -1,1 +1,1 @@\n-1\n+3\n",
+		opts:    InterDiffOptions{Strict: true},
+		wantErr: ErrDuplicatePath,
+	},
+	{
+		name:    "default order",
+		oldDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+2\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+2\n",
+		newDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+3\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+3\n",
+		result: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-2\n+3\n" +
+			"--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-2\n+3\n",
+	},
+	{
+		name:    "diff order",
+		oldDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+2\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+2\n",
+		newDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+3\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+3\n",
+		opts:    InterDiffOptions{Sort: true, Order: DiffOrder},
+		result: "--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-2\n+3\n" +
+			"--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-2\n+3\n",
+	},
+	{
+		name:    "spilled diff order",
+		oldDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+2\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+2\n",
+		newDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+3\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+3\n",
+		opts:    InterDiffOptions{Sort: true, Order: DiffOrder, SpillThreshold: 1},
+		result: "--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-2\n+3\n" +
+			"--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-2\n+3\n",
+	},
+	{
+		name:    "one file at a time",
+		oldDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+2\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+2\n",
+		newDiff: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-1\n+3\n--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-1\n+3\n",
+		opts:    InterDiffOptions{Concurrency: 1},
+		result: "--- a.c\n+++ a.c\n@@ -1,1 +1,1 @@\n-2\n+3\n" +
+			"--- a/b\n+++ a/b\n@@ -1,1 +1,1 @@\n-2\n+3\n",
+	},
+	{
+		name:    "only in formatter",
+		oldDiff: "Only in dir: f\n--- x\n+++ x\n@@ -1,1 +1,1 @@\n-1\n+2\n",
+		newDiff: "--- x\n+++ x\n@@ -1,1 +1,1 @@\n-1\n+3\n",
+		opts: InterDiffOptions{OnlyInFormatter: func(dir, name string, side Side) string {
+			return fmt.Sprintf("%s only: %s/%s\n", side, dir, name)
+		}},
+		result: "old only: dir/f\n--- x\n+++ x\n@@ -1,1 +1,1 @@\n-2\n+3\n",
+	},
+	{
+		name:    "newline removed at end of file",
+		oldDiff: "--- x\n+++ x\n@@ -2,2 +2,2 @@\n-2\n+two\n 3\n",
+		newDiff: "--- x\n+++ x\n@@ -2,2 +2,2 @@\n 2\n-3\n+3\n\\ No newline at end of file\n",
+		result: "--- x\n+++ x\n@@ -2,2 +2,2 @@\n+2\n-two\n-3\n+3\n" +
+			"\\ No newline at end of file\n",
+	},
+	{
+		name:    "newline added at end of file",
+		oldDiff: "--- x\n+++ x\n@@ -1,1 +1,1 @@\n-1\n+2\n\\ No newline at end of file\n",
+		newDiff: "--- x\n+++ x\n@@ -3,1 +3,1 @@\n-3\n+4\n",
+		result: "--- x\n+++ x\n@@ -1,1 +1,1 @@\n-2\n\\ No newline at end of file\n+1\n" +
+			"@@ -3,1 +3,1 @@\n-3\n+4\n",
+	},
+	{
+		name:    "contradictory hunks",
+		oldDiff: interDiffConflictOld,
+		newDiff: interDiffConflictNew,
+		wantErr: ErrContentMismatch,
+	},
+	{
+		name:    "contradictory hunks with conflict markers",
+		oldDiff: interDiffConflictOld,
+		newDiff: interDiffConflictNew,
+		opts:    InterDiffOptions{ConflictMarkers: true},
+		result: `--- f
++++ f
+@@ -1,3 +1,9 @@
+-a
+-B
+-c
++<<<<<<< oldDiff
++a
++B
++c
++=======
++a
++X
++c
++>>>>>>> newDiff
+@@ -8,1 +14,1 @@
+-h
++H
+`,
+	},
+}
+
+// interDiffConflictOld and interDiffConflictNew are diffs which disagree about the
+// second line of the source.
+const (
+	interDiffConflictOld = `--- f
++++ f
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+`
+	interDiffConflictNew = `--- f
++++ f
+@@ -1,3 +1,3 @@
+ a
+-x
++X
+ c
+@@ -8,1 +8,1 @@
+-h
++H
+`
+)
+
+func TestInterDiffWithOptions(t *testing.T) {
+	for _, tt := range interDiffOptionsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := InterDiffWithOptions(strings.NewReader(tt.oldDiff), strings.NewReader(tt.newDiff), tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("InterDiffWithOptions: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InterDiffWithOptions: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
+
+func TestInterDiffConflictCount(t *testing.T) {
+	var conflicts int
+	opts := InterDiffOptions{ConflictMarkers: true, ConflictCount: &conflicts}
+	if _, err := InterDiffWithOptions(strings.NewReader(interDiffConflictOld+"--- g\n+++ g\n@@ -1,1 +1,1 @@\n-1\n+2\n"),
+		strings.NewReader(interDiffConflictNew+"--- g\n+++ g\n@@ -1,1 +1,1 @@\n-0\n+2\n"), opts); err != nil {
+		t.Fatalf("InterDiffWithOptions: got error %v; want error nil", err)
+	}
+	if conflicts != 2 {
+		t.Errorf("ConflictCount = %d; want 2", conflicts)
+	}
+}
+
+func TestInterDiffConflicts(t *testing.T) {
+	var conflicts []Conflict
+	opts := InterDiffOptions{Conflicts: &conflicts}
+	if _, err := InterDiffWithOptions(strings.NewReader(interDiffConflictOld),
+		strings.NewReader(interDiffConflictNew), opts); err != nil {
+		t.Fatalf("InterDiffWithOptions: got error %v; want error nil", err)
+	}
+	want := []Conflict{{
+		File:          "f",
+		OrigStartLine: 1,
+		OrigEndLine:   3,
+		OldHunks:      "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		NewHunks:      "@@ -1,3 +1,3 @@\n a\n-x\n+X\n c\n",
+	}}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("Conflicts mismatch.\nGot:\n%+v\nWant:\n%+v\n", conflicts, want)
+	}
+}
+
+func TestInterDiffContext(t *testing.T) {
+	var oldDiff, newDiff strings.Builder
+	for k := 0; k < 20; k++ {
+		fmt.Fprintf(&oldDiff, "--- f%02d\n+++ f%02d\n@@ -1,1 +1,1 @@\n-a\n+b\n", k, k)
+		fmt.Fprintf(&newDiff, "--- f%02d\n+++ f%02d\n@@ -1,1 +1,1 @@\n-a\n+c\n", k, k)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := InterDiffContext(ctx, strings.NewReader(oldDiff.String()), strings.NewReader(newDiff.String()),
+		InterDiffOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("InterDiffContext: got error %v; want error %v", err, context.Canceled)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	result, err := InterDiffContext(ctx, strings.NewReader(oldDiff.String()), strings.NewReader(newDiff.String()),
+		InterDiffOptions{})
+	if err != nil {
+		t.Fatalf("InterDiffContext: got error %v; want error nil", err)
+	}
+	if want := strings.Count(oldDiff.String(), "+++"); strings.Count(result, "+++") != want {
+		t.Errorf("InterDiffContext: got %d files; want %d", strings.Count(result, "+++"), want)
+	}
+}
+
+func TestInterDiffKeepGoing(t *testing.T) {
+	// The diffs disagree about the content of a
+	oldDiff := "--- a\n+++ a\n@@ -1,1 +1,1 @@\n-x\n+y\n--- b\n+++ b\n@@ -1,1 +1,1 @@\n-a\n+b\n"
+	newDiff := "--- a\n+++ a\n@@ -1,1 +1,1 @@\n-z\n+w\n--- b\n+++ b\n@@ -1,1 +1,1 @@\n-a\n+c\n"
+	if _, err := InterDiff(strings.NewReader(oldDiff), strings.NewReader(newDiff)); !errors.Is(err, ErrContentMismatch) {
+		t.Fatalf("InterDiff: got error %v; want error %v", err, ErrContentMismatch)
+	}
+
+	result, err := InterDiffWithOptions(strings.NewReader(oldDiff), strings.NewReader(newDiff), InterDiffOptions{KeepGoing: true})
+	var fileErrs FileErrors
+	if !errors.As(err, &fileErrs) || len(fileErrs) != 1 || fileErrs[0].File != "a" {
+		t.Fatalf("InterDiff: got error %v; want FileErrors of a", err)
+	}
+	if !errors.Is(err, ErrContentMismatch) {
+		t.Errorf("InterDiff: got error %v; want error %v", err, ErrContentMismatch)
+	}
+	if want := "--- b\n+++ b\n@@ -1,1 +1,1 @@\n-b\n+c\n"; result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestInterDiffDeterministic(t *testing.T) {
+	// Merging of all files but the first one fails
+	var oldDiff, newDiff strings.Builder
+	oldDiff.WriteString("--- a\n+++ a\n@@ -1,1 +1,1 @@\n-1\n+2\n")
+	newDiff.WriteString("--- a\n+++ a\n@@ -1,1 +1,1 @@\n-1\n+3\n")
+	for k := 0; k < 20; k++ {
+		fmt.Fprintf(&oldDiff, "--- f%02d\n+++ f%02d\n@@ -1,1 +1,1 @@\n-a\n+b\n", k, k)
+		fmt.Fprintf(&newDiff, "--- f%02d\n+++ f%02d\n@@ -1,1 +1,1 @@\n-c\n+d\n", k, k)
+	}
+
+	var want string
+	for run := 0; run < 20; run++ {
+		var result strings.Builder
+		// Odd runs merge one file at a time
+		opts := InterDiffOptions{Concurrency: run % 2}
+		err := InterDiffToWithOptions(&result, strings.NewReader(oldDiff.String()), strings.NewReader(newDiff.String()), opts)
+		if !errors.Is(err, ErrContentMismatch) {
+			t.Fatalf("InterDiffTo: got error %v; want error %v", err, ErrContentMismatch)
+		}
+		got := result.String() + err.Error()
+		if run == 0 {
+			want = got
+			if !strings.Contains(want, `"f00"`) {
+				t.Errorf("InterDiffTo: got error %v; want error for file f00", err)
+			}
+			continue
+		}
+		if got != want {
+			t.Fatalf("Run %d mismatch.\nGot:\n%s\nWant:\n%s\n", run, got, want)
+		}
+	}
+}
+
 func TestApplyDiff(t *testing.T) {
 	for _, tt := range applyDiffFileTests {
 		t.Run(tt.resultFile, func(t *testing.T) {
-			source, err := ioutil.ReadFile(tt.sourceFile)
+			source, err := ioutil.ReadFile(testFile(tt.sourceFile))
 			if err != nil {
 				t.Errorf("Error reading sourceFile %q", tt.sourceFile)
 			}
 
-			diffFile, err := os.Open(tt.diffFile)
+			diffFile, err := os.Open(testFile(tt.diffFile))
 			if err != nil {
 				t.Errorf("Error opening diffFile %q", tt.diffFile)
 			}
@@ -286,14 +642,14 @@ func TestApplyDiff(t *testing.T) {
 				t.Errorf("Error parsing diffFile %q", tt.diffFile)
 			}
 
-			correctResult, err := ioutil.ReadFile(tt.resultFile)
+			correctResult, err := ioutil.ReadFile(testFile(tt.resultFile))
 			if err != nil {
 				t.Errorf("Error reading resultFile %q", tt.resultFile)
 			}
 
-			currentResult, err := applyDiff(string(source), d)
+			currentResult, err := applyDiff(string(source), d, ApplyOptions{})
 			if (tt.wantErr == nil) && (err == nil) {
-				if !bytes.Equal(normalizeNewlines([]byte(currentResult)), normalizeNewlines(correctResult)) {
+				if !bytes.Equal(textnorm.Newlines([]byte(currentResult)), textnorm.Newlines(correctResult)) {
 					t.Errorf("File contents mismatch for %s.\nGot:\n%s\nWant:\n%s\n",
 						tt.resultFile, currentResult, correctResult)
 				}
@@ -307,17 +663,17 @@ func TestApplyDiff(t *testing.T) {
 func TestMixedMode(t *testing.T) {
 	for _, tt := range mixedModeFileTests {
 		t.Run(tt.resultFile, func(t *testing.T) {
-			oldSource, err := os.Open(tt.oldSourceFile)
+			oldSource, err := os.Open(testFile(tt.oldSourceFile))
 			if err != nil {
 				t.Errorf("Error opening oldSourceFile %q", tt.oldSourceFile)
 			}
 
-			newSource, err := os.Open(tt.newSourceFile)
+			newSource, err := os.Open(testFile(tt.newSourceFile))
 			if err != nil {
 				t.Errorf("Error opening newSourceFile %q", tt.newSourceFile)
 			}
 
-			oldDiffFile, err := os.Open(tt.oldDiffFile)
+			oldDiffFile, err := os.Open(testFile(tt.oldDiffFile))
 			if err != nil {
 				t.Errorf("Error opening oldDiffFile %q", tt.oldDiffFile)
 			}
@@ -327,7 +683,7 @@ func TestMixedMode(t *testing.T) {
 				t.Errorf("Error parsing oldDiffFile %q", tt.oldDiffFile)
 			}
 
-			newDiffFile, err := os.Open(tt.newDiffFile)
+			newDiffFile, err := os.Open(testFile(tt.newDiffFile))
 			if err != nil {
 				t.Errorf("Error opening newDiffFile %q", tt.newDiffFile)
 			}
@@ -337,18 +693,18 @@ func TestMixedMode(t *testing.T) {
 				t.Errorf("Error parsing newDiffFile %q", tt.newDiffFile)
 			}
 
-			correctResult, err := ioutil.ReadFile(tt.resultFile)
+			correctResult, err := ioutil.ReadFile(testFile(tt.resultFile))
 			if err != nil {
 				t.Errorf("Error reading resultFile %q", tt.resultFile)
 			}
 
-			currentResult, err := mixedMode(oldSource, newSource, oldD, newD)
+			currentResult, err := mixedMode(context.Background(), oldSource, newSource, "", "", oldD, newD, MixedModeOptions{})
 
 			if err != nil {
 				t.Errorf("Mixed mode for %q: got error %v; want error nil", tt.resultFile, err)
 			}
 
-			if !bytes.Equal(normalizeNewlines([]byte(currentResult)), normalizeNewlines(correctResult)) {
+			if !bytes.Equal(textnorm.Newlines([]byte(currentResult)), textnorm.Newlines(correctResult)) {
 				t.Errorf("File contents mismatch for %s.\nGot:\n%s\nWant:\n%s\n",
 					tt.resultFile, currentResult, correctResult)
 			}
@@ -359,27 +715,27 @@ func TestMixedMode(t *testing.T) {
 func TestMixedModeFile(t *testing.T) {
 	for _, tt := range mixedModeFileTests {
 		t.Run(tt.resultFile, func(t *testing.T) {
-			oldSource, err := os.Open(tt.oldSourceFile)
+			oldSource, err := os.Open(testFile(tt.oldSourceFile))
 			if err != nil {
 				t.Errorf("Error opening oldSourceFile %q", tt.oldSourceFile)
 			}
 
-			newSource, err := os.Open(tt.newSourceFile)
+			newSource, err := os.Open(testFile(tt.newSourceFile))
 			if err != nil {
 				t.Errorf("Error opening newSourceFile %q", tt.newSourceFile)
 			}
 
-			oldDiffFile, err := os.Open(tt.oldDiffFile)
+			oldDiffFile, err := os.Open(testFile(tt.oldDiffFile))
 			if err != nil {
 				t.Errorf("Error opening oldDiffFile %q", tt.oldDiffFile)
 			}
 
-			newDiffFile, err := os.Open(tt.newDiffFile)
+			newDiffFile, err := os.Open(testFile(tt.newDiffFile))
 			if err != nil {
 				t.Errorf("Error opening newDiffFile %q", tt.newDiffFile)
 			}
 
-			correctResult, err := ioutil.ReadFile(tt.resultFile)
+			correctResult, err := ioutil.ReadFile(testFile(tt.resultFile))
 			if err != nil {
 				t.Errorf("Error reading resultFile %q", tt.resultFile)
 			}
@@ -390,7 +746,7 @@ func TestMixedModeFile(t *testing.T) {
 				t.Errorf("Mixed mode for %q: got error %v; want error nil", tt.resultFile, err)
 			}
 
-			if !bytes.Equal(normalizeNewlines([]byte(currentResult)), normalizeNewlines(correctResult)) {
+			if !bytes.Equal(textnorm.Newlines([]byte(currentResult)), textnorm.Newlines(correctResult)) {
 				t.Errorf("File contents mismatch for %s.\nGot:\n%s\nWant:\n%s\n",
 					tt.resultFile, currentResult, correctResult)
 			}
@@ -401,22 +757,24 @@ func TestMixedModeFile(t *testing.T) {
 func TestMixedModePath(t *testing.T) {
 	for _, tt := range mixedModePathFileTests {
 		t.Run(tt.resultFile, func(t *testing.T) {
-			oldDiffFile, err := os.Open(tt.oldDiffFile)
+			oldDiffFile, err := os.Open(testFile(tt.oldDiffFile))
 			if err != nil {
 				t.Errorf("Error opening oldDiffFile %q", tt.oldDiffFile)
 			}
 
-			newDiffFile, err := os.Open(tt.newDiffFile)
+			newDiffFile, err := os.Open(testFile(tt.newDiffFile))
 			if err != nil {
 				t.Errorf("Error opening newDiffFile %q", tt.newDiffFile)
 			}
 
-			correctResult, err := ioutil.ReadFile(tt.resultFile)
+			correctResult, err := ioutil.ReadFile(testFile(tt.resultFile))
 			if err != nil {
 				t.Errorf("Error reading resultFile %q", tt.resultFile)
 			}
 
-			currentResult, err := MixedModePath(tt.oldSource, tt.newSource, oldDiffFile, newDiffFile)
+			opts := tt.opts
+			opts.Dir = testFilesDir
+			currentResult, err := MixedModePathWithOptions(tt.oldSource, tt.newSource, oldDiffFile, newDiffFile, opts)
 
 			if tt.wantErr && err == nil {
 				t.Errorf("MixedModePath for %q: got error nil; want error non-nil", tt.resultFile)
@@ -425,7 +783,7 @@ func TestMixedModePath(t *testing.T) {
 					t.Errorf("MixedModePath for %q: got error %v; want error nil", tt.resultFile, err)
 				}
 
-				if !bytes.Equal(normalizeNewlines([]byte(currentResult)), normalizeNewlines(correctResult)) {
+				if !bytes.Equal(textnorm.Newlines([]byte(currentResult)), textnorm.Newlines(correctResult)) {
 					t.Errorf("File contents mismatch for %s.\nGot:\n%s\nWant:\n%s\n",
 						tt.resultFile, currentResult, correctResult)
 				}
@@ -433,3 +791,316 @@ func TestMixedModePath(t *testing.T) {
 		})
 	}
 }
+
+func TestMixedModePathTo(t *testing.T) {
+	open := func() (io.Reader, io.Reader) {
+		t.Helper()
+		oldDiff, err := ioutil.ReadFile(testFile("s1_a.diff"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		newDiff, err := ioutil.ReadFile(testFile("s1_c_d.diff"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.NewReader(oldDiff), bytes.NewReader(newDiff)
+	}
+	correctResult, err := ioutil.ReadFile(testFile("s1_a_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := MixedModeOptions{Dir: testFilesDir}
+	var result bytes.Buffer
+	oldDiff, newDiff := open()
+	if err := MixedModePathToWithOptions(&result, "source_1", "source_1_c", oldDiff, newDiff, opts); err != nil {
+		t.Fatalf("MixedModePathTo: got error %v; want error nil", err)
+	}
+	if !bytes.Equal(textnorm.Newlines(result.Bytes()), textnorm.Newlines(correctResult)) {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result.Bytes(), correctResult)
+	}
+
+	oldDiff, newDiff = open()
+	err = MixedModePathToWithOptions(failingWriter{}, "source_1", "source_1_c", oldDiff, newDiff, opts)
+	if !errors.Is(err, errWrite) {
+		t.Errorf("MixedModePathTo to failing writer: got error %v; want error %v", err, errWrite)
+	}
+}
+
+func TestMixedModePathProgress(t *testing.T) {
+	oldRoot := writeTestTree(t, map[string]string{"a": "a\n", "b": "b\n", "c": "c\n"})
+	defer os.RemoveAll(oldRoot)
+	newRoot := writeTestTree(t, map[string]string{"b": "b\n", "c": "c\n", "d": "d\n"})
+	defer os.RemoveAll(newRoot)
+	oldDiff := fmt.Sprintf("--- %[1]s/b\n+++ %[1]s/b\n@@ -1 +1 @@\n-b\n+B\n", oldRoot)
+	newDiff := fmt.Sprintf("--- %[1]s/b\n+++ %[1]s/b\n@@ -1 +1 @@\n-b\n+BB\n", newRoot)
+
+	var progress []string
+	opts := MixedModeOptions{Progress: func(file string, done, total int) {
+		progress = append(progress, fmt.Sprintf("%s %d/%d", filepath.Base(file), done, total))
+	}}
+	if _, err := MixedModePathWithOptions(oldRoot, newRoot, strings.NewReader(oldDiff), strings.NewReader(newDiff), opts); err != nil {
+		t.Fatalf("MixedModePath: got error %v; want error nil", err)
+	}
+	want := []string{"a 1/4", "b 2/4", "c 3/4", "d 4/4"}
+	if !reflect.DeepEqual(progress, want) {
+		t.Errorf("Progress mismatch.\nGot:\n%q\nWant:\n%q\n", progress, want)
+	}
+}
+
+func TestMixedModePathContext(t *testing.T) {
+	oldDiff, err := os.Open(testFile("s1_a.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldDiff.Close()
+	newDiff, err := os.Open(testFile("s1_c_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newDiff.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = MixedModePathContext(ctx, "source_1", "source_1_c", oldDiff, newDiff, MixedModeOptions{Dir: testFilesDir})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("MixedModePathContext: got error %v; want error %v", err, context.Canceled)
+	}
+}
+
+func TestMixedModePathKeepGoing(t *testing.T) {
+	files := map[string]string{"a.txt": "a\n", "b.txt": "b\n"}
+	oldRoot := writeTestTree(t, files)
+	defer os.RemoveAll(oldRoot)
+	newRoot := writeTestTree(t, files)
+	defer os.RemoveAll(newRoot)
+
+	// oldDiff doesn't apply to a.txt
+	oldDiff := fmt.Sprintf("--- %[1]s/a.txt\n+++ %[1]s/a.txt\n@@ -1 +1 @@\n-x\n+y\n"+
+		"--- %[1]s/b.txt\n+++ %[1]s/b.txt\n@@ -1 +1 @@\n-b\n+c\n", oldRoot)
+	newDiff := fmt.Sprintf("--- %[1]s/b.txt\n+++ %[1]s/b.txt\n@@ -1 +1 @@\n-b\n+d\n", newRoot)
+	result, err := MixedModePathWithOptions(oldRoot, newRoot, strings.NewReader(oldDiff), strings.NewReader(newDiff),
+		MixedModeOptions{KeepGoing: true})
+	var fileErrs FileErrors
+	if !errors.As(err, &fileErrs) || len(fileErrs) != 1 || fileErrs[0].File != filepath.Join(oldRoot, "a.txt") {
+		t.Fatalf("MixedModePath: got error %v; want FileErrors of a.txt", err)
+	}
+	var applyErr *ApplyError
+	if !errors.As(err, &applyErr) || applyErr.Line != 1 {
+		t.Errorf("MixedModePath: got error %v; want an *ApplyError at line 1", err)
+	}
+	want := fmt.Sprintf("--- %s/b.txt\n+++ %s/b.txt\n@@ -1,1 +1,1 @@\n-c\n+d\n", oldRoot, newRoot)
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+var mixedModeOptionsTests = []struct {
+	name      string
+	oldSource string
+	newSource string
+	oldDiff   string
+	newDiff   string
+	opts      MixedModeOptions
+	result    string
+	wantErr   error
+}{
+	{
+		name:      "trailing space mismatch",
+		oldSource: "one \ntwo\nthree\n",
+		newSource: "one\ntwo\nthree\n",
+		oldDiff:   "--- a\n+++ a\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n",
+		newDiff:   "--- b\n+++ b\n@@ -1,1 +1,1 @@\n-one\n+ONE\n",
+		wantErr:   ErrContentMismatch,
+	},
+	{
+		name:      "trailing space ignored",
+		oldSource: "one \ntwo\nthree\n",
+		newSource: "one\ntwo\nthree\n",
+		oldDiff:   "--- a\n+++ a\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n",
+		newDiff:   "--- b\n+++ b\n@@ -2,1 +2,1 @@\n-two\n+TWO\n",
+		opts:      MixedModeOptions{Normalize: textnorm.Options{TrailingSpace: true}},
+		result:    "--- a\n+++ b\n",
+	},
+	{
+		name:      "no newline at end of file",
+		oldSource: "one\ntwo\n",
+		newSource: "one\ntwo",
+		oldDiff:   "--- a\n+++ a\n@@ -1,1 +1,1 @@\n-one\n+ONE\n",
+		newDiff:   "--- b\n+++ b\n@@ -1,1 +1,1 @@\n-one\n+ONE\n",
+		result:    "--- a\n+++ b\n@@ -1,2 +1,2 @@\n ONE\n-two\n+two\n\\ No newline at end of file\n",
+	},
+	{
+		name:      "windows newlines",
+		oldSource: "one\r\ntwo\r\nthree\r\n",
+		newSource: "one\ntwo\nthree\n",
+		oldDiff:   "--- a\n+++ a\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n",
+		newDiff:   "--- b\n+++ b\n@@ -3,1 +3,1 @@\n-three\n+THREE\n",
+		opts:      MixedModeOptions{Normalize: textnorm.Options{Newlines: true}},
+		result: `--- a
++++ b
+@@ -1,3 +1,3 @@
+ one
+-TWO
+-three
++two
++THREE
+`,
+	},
+	{
+		name:      "space change ignored",
+		oldSource: "one\ntwo\nthree\n",
+		newSource: "one\n  two\nthree\n",
+		oldDiff:   "--- a\n+++ a\n@@ -1,2 +1,2 @@\n one\n-two\n+two  x\n",
+		newDiff:   "--- b\n+++ b\n@@ -2,1 +2,1 @@\n-  two\n+  two\tx\n",
+		opts:      MixedModeOptions{Ignore: textnorm.Ignore{SpaceChange: true}},
+		result: `--- a
++++ b
+@@ -1,3 +1,3 @@
+ one
+-two  x
++  two	x
+ three
+`,
+	},
+	{
+		name:      "all space ignored",
+		oldSource: "one\ntwo\nthree\n",
+		newSource: "one\n  two\nthree\n",
+		oldDiff:   "--- a\n+++ a\n@@ -1,2 +1,2 @@\n one\n-two\n+two  x\n",
+		newDiff:   "--- b\n+++ b\n@@ -2,1 +2,1 @@\n-  two\n+  two\tx\n",
+		opts:      MixedModeOptions{Ignore: textnorm.Ignore{AllSpace: true}},
+		result:    "--- a\n+++ b\n",
+	},
+	{
+		name:      "blank lines ignored",
+		oldSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		newSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		oldDiff:   "--- a\n+++ a\n@@ -2,0 +3,1 @@\n+\n",
+		newDiff:   "--- b\n+++ b\n@@ -9,1 +9,1 @@\n-9\n+X\n",
+		opts:      MixedModeOptions{Ignore: textnorm.Ignore{BlankLines: true}},
+		result: `--- a
++++ b
+@@ -8,4 +7,4 @@
+ 7
+ 8
+-9
++X
+ 10
+`,
+	},
+	{
+		name:      "changes within default hunk break gap",
+		oldSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		newSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		oldDiff:   "--- a\n+++ a\n@@ -2,1 +2,1 @@\n-2\n+X\n",
+		newDiff:   "--- b\n+++ b\n@@ -8,1 +8,1 @@\n-8\n+Y\n",
+		result: `--- a
++++ b
+@@ -1,10 +1,10 @@
+ 1
+-X
++2
+ 3
+ 4
+ 5
+ 6
+ 7
+-8
++Y
+ 9
+ 10
+`,
+	},
+	{
+		name:      "custom hunk break gap",
+		oldSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		newSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		oldDiff:   "--- a\n+++ a\n@@ -2,1 +2,1 @@\n-2\n+X\n",
+		newDiff:   "--- b\n+++ b\n@@ -8,1 +8,1 @@\n-8\n+Y\n",
+		opts:      MixedModeOptions{HunkBreakGap: 5},
+		result: `--- a
++++ b
+@@ -1,4 +1,4 @@
+ 1
+-X
++2
+ 3
+ 4
+@@ -6,5 +6,5 @@
+ 6
+ 7
+-8
++Y
+ 9
+ 10
+`,
+	},
+	{
+		name:      "no context",
+		oldSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		newSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		oldDiff:   "--- a\n+++ a\n@@ -2,1 +2,1 @@\n-2\n+X\n",
+		newDiff:   "--- b\n+++ b\n@@ -5,1 +4,0 @@\n-5\n@@ -8,1 +7,2 @@\n-8\n+Y\n+Z\n",
+		opts:      MixedModeOptions{ContextLines: NoContext},
+		result: `--- a
++++ b
+@@ -2,1 +2,1 @@
+-X
++2
+@@ -5,1 +4,0 @@
+-5
+@@ -8,1 +7,2 @@
+-8
++Y
++Z
+`,
+	},
+	{
+		name:      "three context lines",
+		oldSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		newSource: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+		oldDiff:   "--- a\n+++ a\n@@ -2,1 +2,1 @@\n-2\n+X\n",
+		newDiff:   "--- b\n+++ b\n@@ -5,1 +4,0 @@\n-5\n@@ -8,1 +7,2 @@\n-8\n+Y\n+Z\n",
+		opts:      MixedModeOptions{ContextLines: 3},
+		result: `--- a
++++ b
+@@ -1,10 +1,10 @@
+ 1
+-X
++2
+ 3
+ 4
+-5
+ 6
+ 7
+-8
++Y
++Z
+ 9
+ 10
+`,
+	},
+}
+
+func TestMixedModeFileWithOptions(t *testing.T) {
+	for _, tt := range mixedModeOptionsTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := MixedModeFileWithOptions(strings.NewReader(tt.oldSource), strings.NewReader(tt.newSource),
+				strings.NewReader(tt.oldDiff), strings.NewReader(tt.newDiff), tt.opts)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("MixedModeFileWithOptions: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MixedModeFileWithOptions: got error %v; want error nil", err)
+			}
+
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
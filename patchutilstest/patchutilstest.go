@@ -0,0 +1,131 @@
+// Package patchutilstest provides helpers for regression tests that compare
+// results of patchutils against golden files.
+package patchutilstest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/textnorm"
+)
+
+// Options configures how results are compared with golden files.
+type Options struct {
+	// Newlines ignores differences between "\r\n" and "\n" line endings.
+	Newlines bool
+	// Timestamps ignores timestamps in "---" and "+++" file headers.
+	Timestamps bool
+	// Update writes results to golden files instead of comparing them.
+	// It is usually set by a flag of the test binary, such as -update.
+	Update bool
+	// Dir, if set, is the directory relative paths of diffs, sources and golden
+	// files are resolved in, instead of the working directory, so that tests
+	// needn't change it.
+	Dir string
+}
+
+// path returns the path of the file at p, resolved in opts.Dir.
+func (opts Options) path(p string) string {
+	if opts.Dir == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(opts.Dir, p)
+}
+
+// headerTimestampRegexp matches file headers of unified diffs with a timestamp.
+var headerTimestampRegexp = regexp.MustCompile(`(?m)^((?:---|\+\+\+) [^\t\n]*)\t[^\n]*$`)
+
+// Normalize returns diff with the differences ignored by opts removed.
+func Normalize(diff string, opts Options) string {
+	if opts.Newlines {
+		diff = string(textnorm.Newlines([]byte(diff)))
+	}
+	if opts.Timestamps {
+		diff = headerTimestampRegexp.ReplaceAllString(diff, "$1")
+	}
+	return diff
+}
+
+// CheckGolden reports an error to t if result differs from the content of goldenPath.
+func CheckGolden(t testing.TB, result, goldenPath string, opts Options) {
+	t.Helper()
+
+	if opts.Update {
+		if err := ioutil.WriteFile(opts.path(goldenPath), []byte(result), 0644); err != nil {
+			t.Fatalf("Error updating golden file %q: %v", goldenPath, err)
+		}
+		return
+	}
+
+	golden, err := ioutil.ReadFile(opts.path(goldenPath))
+	if err != nil {
+		t.Fatalf("Error reading golden file %q: %v", goldenPath, err)
+		return
+	}
+	if Normalize(result, opts) != Normalize(string(golden), opts) {
+		t.Errorf("Result mismatch for %s.\nGot:\n%s\nWant:\n%s\n", goldenPath, result, golden)
+	}
+}
+
+// CheckInterDiff compares InterDiff of the oldDiffPath and newDiffPath files with goldenPath.
+func CheckInterDiff(t testing.TB, oldDiffPath, newDiffPath, goldenPath string, opts Options) {
+	t.Helper()
+
+	oldDiff, newDiff, ok := openDiffs(t, oldDiffPath, newDiffPath, opts)
+	if !ok {
+		return
+	}
+	defer oldDiff.Close()
+	defer newDiff.Close()
+
+	result, err := patchutils.InterDiff(oldDiff, newDiff)
+	if err != nil {
+		t.Errorf("InterDiff of %q and %q: got error %v; want error nil", oldDiffPath, newDiffPath, err)
+		return
+	}
+	CheckGolden(t, result, goldenPath, opts)
+}
+
+// CheckMixedModePath compares MixedModePath of oldSourcePath patched with the oldDiffPath file
+// and newSourcePath patched with the newDiffPath file with goldenPath.
+func CheckMixedModePath(t testing.TB, oldSourcePath, oldDiffPath, newSourcePath, newDiffPath, goldenPath string,
+	opts Options) {
+	t.Helper()
+
+	oldDiff, newDiff, ok := openDiffs(t, oldDiffPath, newDiffPath, opts)
+	if !ok {
+		return
+	}
+	defer oldDiff.Close()
+	defer newDiff.Close()
+
+	result, err := patchutils.MixedModePathWithOptions(oldSourcePath, newSourcePath, oldDiff, newDiff,
+		patchutils.MixedModeOptions{Dir: opts.Dir})
+	if err != nil {
+		t.Errorf("MixedModePath of %q and %q: got error %v; want error nil", oldSourcePath, newSourcePath, err)
+		return
+	}
+	CheckGolden(t, result, goldenPath, opts)
+}
+
+// openDiffs opens the oldDiffPath and newDiffPath files in opts.Dir, reporting failures to t.
+func openDiffs(t testing.TB, oldDiffPath, newDiffPath string, opts Options) (oldDiff, newDiff *os.File, ok bool) {
+	t.Helper()
+
+	oldDiff, err := os.Open(opts.path(oldDiffPath))
+	if err != nil {
+		t.Fatalf("Error opening %q: %v", oldDiffPath, err)
+		return nil, nil, false
+	}
+	newDiff, err = os.Open(opts.path(newDiffPath))
+	if err != nil {
+		oldDiff.Close()
+		t.Fatalf("Error opening %q: %v", newDiffPath, err)
+		return nil, nil, false
+	}
+	return oldDiff, newDiff, true
+}
@@ -0,0 +1,89 @@
+package patchutilstest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testFilesDir is the directory of the test files of patchutils.
+const testFilesDir = "../test_examples"
+
+// recorder is a testing.TB that records failures instead of reporting them.
+type recorder struct {
+	testing.TB
+	failed bool
+}
+
+func (r *recorder) Helper()                                   {}
+func (r *recorder) Errorf(format string, args ...interface{}) { r.failed = true }
+func (r *recorder) Fatalf(format string, args ...interface{}) { r.failed = true }
+
+var normalizeTests = []struct {
+	name   string
+	diff   string
+	opts   Options
+	result string
+}{
+	{
+		name:   "no normalization",
+		diff:   "--- a\t2020-07-28 12:54:18\r\n+++ b\r\n",
+		result: "--- a\t2020-07-28 12:54:18\r\n+++ b\r\n",
+	},
+	{
+		name:   "newlines",
+		diff:   "--- a\r\n+++ b\r\n-x\r\n",
+		opts:   Options{Newlines: true},
+		result: "--- a\n+++ b\n-x\n",
+	},
+	{
+		name:   "timestamps",
+		diff:   "--- a\t2020-07-28 12:54:18.000000000 +0000\n+++ b\t2020-08-26 01:17:35 +0000\n-x\tdata\n",
+		opts:   Options{Timestamps: true},
+		result: "--- a\n+++ b\n-x\tdata\n",
+	},
+}
+
+func TestNormalize(t *testing.T) {
+	for _, tt := range normalizeTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if currentResult := Normalize(tt.diff, tt.opts); currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%q\nWant:\n%q\n", currentResult, tt.result)
+			}
+		})
+	}
+}
+
+func TestCheckInterDiff(t *testing.T) {
+	CheckInterDiff(t, "s1_a.diff", "s1_b.diff", "s1_a_b.diff", Options{Newlines: true, Dir: testFilesDir})
+
+	r := &recorder{TB: t}
+	CheckInterDiff(r, "s1_a.diff", "s1_b.diff", "s2_a_b.diff", Options{Newlines: true, Dir: testFilesDir})
+	if !r.failed {
+		t.Errorf("CheckInterDiff with wrong golden file didn't fail")
+	}
+}
+
+func TestCheckMixedModePath(t *testing.T) {
+	CheckMixedModePath(t, "source_1", "s1_a.diff", "source_1_b", "s1_b_c.diff", "s1_a_c.diff",
+		Options{Newlines: true, Timestamps: true, Dir: testFilesDir})
+}
+
+func TestCheckGoldenUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "patchutilstest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	golden := filepath.Join(dir, "golden.diff")
+
+	CheckGolden(t, "--- a\n+++ b\n", golden, Options{Update: true})
+	CheckGolden(t, "--- a\n+++ b\n", golden, Options{})
+
+	r := &recorder{TB: t}
+	CheckGolden(r, "--- a\n+++ c\n", golden, Options{})
+	if !r.failed {
+		t.Errorf("CheckGolden with different result didn't fail")
+	}
+}
@@ -0,0 +1,274 @@
+package patchutils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// Step is an operation of a Pipeline.
+type Step struct {
+	// Op is the operation: "filter" keeps the files selected by Filter, "strip"
+	// removes Strip leading path components from file names like StripDiff,
+	// "recount" recomputes hunk headers like Recount, "reverse" reverses the patch
+	// like Reverse and "stat" replaces it with its diffstat, so it has to be last.
+	Op     string
+	Filter FilterOptions
+	Strip  int
+}
+
+// Pipeline is a sequence of steps transforming a patch, each applied to the
+// result of the previous one.
+type Pipeline struct {
+	Steps []Step
+}
+
+// Run returns patch transformed by all steps of p in order.
+func (p Pipeline) Run(patch io.Reader) (string, error) {
+	data, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return "", fmt.Errorf("reading patch: %w", err)
+	}
+
+	result := string(data)
+	for i, step := range p.Steps {
+		current := strings.NewReader(result)
+		switch step.Op {
+		case "filter":
+			result, err = FilterDiff(current, step.Filter)
+		case "strip":
+			result, err = StripDiff(current, step.Strip)
+		case "recount":
+			result, err = Recount(current)
+		case "reverse":
+			result, err = Reverse(current)
+		case "stat":
+			if i != len(p.Steps)-1 {
+				return "", fmt.Errorf("step %d: %w", i+1, ErrStatNotLast)
+			}
+			var stats []FileStat
+			stats, err = Stat(current)
+			result = FormatStat(stats)
+		default:
+			return "", fmt.Errorf("step %d: %q: %w", i+1, step.Op, ErrUnknownStep)
+		}
+		if err != nil {
+			return "", fmt.Errorf("step %d (%s): %w", i+1, step.Op, err)
+		}
+	}
+	return result, nil
+}
+
+// ParsePipeline reads a pipeline from its description in a small subset of YAML:
+// a list of steps, optionally under a "steps" key, each either the name of an
+// operation or a map from it to its arguments. strip takes the number of
+// components, and filter the lists include and exclude and the number strip.
+//
+//	steps:
+//	  - filter:
+//	      include: [drivers/net, "*.c"]
+//	      exclude:
+//	        - drivers/net/old
+//	  - strip: 1
+//	  - recount
+//	  - stat
+func ParsePipeline(r io.Reader) (Pipeline, error) {
+	lines, err := readYAMLLines(r)
+	if err != nil {
+		return Pipeline{}, err
+	}
+	if len(lines) > 0 && lines[0].indent == 0 && lines[0].text == "steps:" {
+		lines = lines[1:]
+	}
+
+	if len(lines) == 0 {
+		return Pipeline{}, fmt.Errorf("no steps: %w", ErrPipelineSyntax)
+	}
+
+	var p Pipeline
+	indent := lines[0].indent
+	for len(lines) > 0 {
+		item := lines[0]
+		if item.indent != indent || !isYAMLListItem(item.text) {
+			return Pipeline{}, fmt.Errorf("line %d: expected a step: %w", item.num, ErrPipelineSyntax)
+		}
+		end := 1
+		for end < len(lines) && lines[end].indent > item.indent {
+			end++
+		}
+		step, err := parseStep(item, lines[1:end])
+		if err != nil {
+			return Pipeline{}, err
+		}
+		p.Steps = append(p.Steps, step)
+		lines = lines[end:]
+	}
+	return p, nil
+}
+
+// yamlLine is a line of a pipeline description without comments and trailing
+// spaces.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// readYAMLLines returns the lines of r which aren't blank or comments.
+func readYAMLLines(r io.Reader) ([]yamlLine, error) {
+	var lines []yamlLine
+	scanner := bufio.NewScanner(r)
+	for num := 1; scanner.Scan(); num++ {
+		text := scanner.Text()
+		if i := strings.Index(text, "#"); i >= 0 && (i == 0 || text[i-1] == ' ') {
+			text = text[:i]
+		}
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs can't indent: %w", num, ErrPipelineSyntax)
+		}
+		trimmed = strings.TrimRight(trimmed, " \t")
+		if trimmed == "" {
+			continue
+		}
+		lines = append(lines, yamlLine{num: num, indent: len(text) - len(strings.TrimLeft(text, " ")), text: trimmed})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading pipeline: %w", err)
+	}
+	return lines, nil
+}
+
+// parseStep returns the step of the list item item, with its arguments in body.
+func parseStep(item yamlLine, body []yamlLine) (Step, error) {
+	content := strings.TrimSpace(strings.TrimPrefix(item.text, "-"))
+	op, value, hasArgs := cutYAMLKey(content)
+	step := Step{Op: op}
+	syntaxError := func(line yamlLine, msg string) error {
+		return fmt.Errorf("line %d: %s: %w", line.num, msg, ErrPipelineSyntax)
+	}
+
+	switch op {
+	case "recount", "reverse", "stat":
+		if hasArgs || len(body) > 0 {
+			return Step{}, syntaxError(item, op+" takes no arguments")
+		}
+	case "strip":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || len(body) > 0 {
+			return Step{}, syntaxError(item, "strip takes a number of components")
+		}
+		step.Strip = n
+	case "filter":
+		if value != "" || len(body) == 0 {
+			return Step{}, syntaxError(item, "filter takes include, exclude or strip")
+		}
+		indent := body[0].indent
+		for len(body) > 0 {
+			arg := body[0]
+			if arg.indent != indent {
+				return Step{}, syntaxError(arg, "unexpected indentation")
+			}
+			key, value, ok := cutYAMLKey(arg.text)
+			if !ok {
+				return Step{}, syntaxError(arg, "expected an argument")
+			}
+			end := 1
+			for end < len(body) && body[end].indent > arg.indent {
+				end++
+			}
+			values, err := parseYAMLList(value, body[1:end])
+			if err != nil {
+				return Step{}, err
+			}
+			body = body[end:]
+
+			switch key {
+			case "include":
+				step.Filter.Include = append(step.Filter.Include, values...)
+			case "exclude":
+				step.Filter.Exclude = append(step.Filter.Exclude, values...)
+			case "strip":
+				n, err := strconv.Atoi(value)
+				if err != nil || n < 0 || end > 1 {
+					return Step{}, syntaxError(arg, "strip takes a number of components")
+				}
+				step.Filter.Strip = n
+			default:
+				return Step{}, syntaxError(arg, fmt.Sprintf("unknown filter argument %q", key))
+			}
+		}
+	default:
+		return Step{}, fmt.Errorf("line %d: %q: %w", item.num, op, ErrUnknownStep)
+	}
+	return step, nil
+}
+
+// cutYAMLKey splits "key: value" or "key:" into key and value, and reports
+// whether text had a colon.
+func cutYAMLKey(text string) (key, value string, ok bool) {
+	i := strings.Index(text, ":")
+	if i < 0 {
+		return text, "", false
+	}
+	return strings.TrimSpace(text[:i]), strings.TrimSpace(text[i+1:]), true
+}
+
+// parseYAMLList returns the values of a flow list such as "[a, b]" or a scalar in
+// value, or of the block list in lines if value is empty.
+func parseYAMLList(value string, lines []yamlLine) ([]string, error) {
+	if value != "" {
+		if len(lines) > 0 {
+			return nil, fmt.Errorf("line %d: unexpected indentation: %w", lines[0].num, ErrPipelineSyntax)
+		}
+		if !strings.HasPrefix(value, "[") {
+			return []string{unquoteYAML(value)}, nil
+		}
+		if !strings.HasSuffix(value, "]") {
+			return nil, fmt.Errorf("unterminated list %q: %w", value, ErrPipelineSyntax)
+		}
+		var values []string
+		for _, v := range strings.Split(value[1:len(value)-1], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				values = append(values, unquoteYAML(v))
+			}
+		}
+		return values, nil
+	}
+
+	var values []string
+	for _, line := range lines {
+		if line.indent != lines[0].indent || !isYAMLListItem(line.text) {
+			return nil, fmt.Errorf("line %d: expected a list item: %w", line.num, ErrPipelineSyntax)
+		}
+		values = append(values, unquoteYAML(strings.TrimSpace(line.text[1:])))
+	}
+	return values, nil
+}
+
+// isYAMLListItem reports whether text is an item of a block list.
+func isYAMLListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// unquoteYAML removes the quotes around a scalar, if any.
+func unquoteYAML(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// ErrPipelineSyntax indicates that a pipeline description can't be parsed.
+var ErrPipelineSyntax = errors.New("malformed pipeline")
+
+// ErrUnknownStep indicates that a pipeline has a step of an unknown operation.
+var ErrUnknownStep = errors.New("unknown pipeline step")
+
+// ErrStatNotLast indicates that a stat step of a pipeline is followed by other
+// steps, which can't transform a diffstat.
+var ErrStatNotLast = errors.New("stat isn't the last step")
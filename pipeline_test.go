@@ -0,0 +1,173 @@
+package patchutils
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var parsePipelineTests = []struct {
+	name     string
+	pipeline string
+	want     Pipeline
+	wantErr  error
+}{
+	{
+		name: "all steps",
+		pipeline: `# Refresh the network part of a patch
+steps:
+  - filter:
+      include: [drivers/net, "*.c"]
+      exclude:
+        - drivers/net/old  # dropped upstream
+        - 'docs'
+      strip: 1
+  - strip: 1
+  - recount
+  - reverse
+  - stat
+`,
+		want: Pipeline{Steps: []Step{
+			{Op: "filter", Filter: FilterOptions{
+				Include: []string{"drivers/net", "*.c"},
+				Exclude: []string{"drivers/net/old", "docs"},
+				Strip:   1,
+			}},
+			{Op: "strip", Strip: 1},
+			{Op: "recount"},
+			{Op: "reverse"},
+			{Op: "stat"},
+		}},
+	},
+	{
+		name:     "list without steps key",
+		pipeline: "- reverse\n- strip: 2\n",
+		want:     Pipeline{Steps: []Step{{Op: "reverse"}, {Op: "strip", Strip: 2}}},
+	},
+	{
+		name:     "unknown step",
+		pipeline: "- sort\n",
+		wantErr:  ErrUnknownStep,
+	},
+	{
+		name:     "missing strip level",
+		pipeline: "- strip\n",
+		wantErr:  ErrPipelineSyntax,
+	},
+	{
+		name:     "unknown filter argument",
+		pipeline: "- filter:\n    only: [a]\n",
+		wantErr:  ErrPipelineSyntax,
+	},
+	{
+		name:     "not a list",
+		pipeline: "steps:\n  reverse\n",
+		wantErr:  ErrPipelineSyntax,
+	},
+	{
+		name:     "no steps",
+		pipeline: "steps:\n",
+		wantErr:  ErrPipelineSyntax,
+	},
+}
+
+func TestParsePipeline(t *testing.T) {
+	for _, tt := range parsePipelineTests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePipeline(strings.NewReader(tt.pipeline))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("ParsePipeline: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePipeline: got error %v; want error nil", err)
+			}
+			if !reflect.DeepEqual(p, tt.want) {
+				t.Errorf("Pipeline mismatch.\nGot:\n%+v\nWant:\n%+v\n", p, tt.want)
+			}
+		})
+	}
+}
+
+const pipelinePatch = `--- a/net/tcp.c
++++ b/net/tcp.c
+@@ -1,1 +1,1 @@
+ one
+-two
++TWO
++2
+--- a/docs/tcp.txt
++++ b/docs/tcp.txt
+@@ -1,1 +1,1 @@
+-old
++new
+`
+
+var pipelineRunTests = []struct {
+	name     string
+	pipeline Pipeline
+	result   string
+	wantErr  error
+}{
+	{
+		name: "filter, strip and recount",
+		pipeline: Pipeline{Steps: []Step{
+			{Op: "filter", Filter: FilterOptions{Include: []string{"net"}, Strip: 1}},
+			{Op: "strip", Strip: 1},
+			{Op: "recount"},
+		}},
+		result: `--- net/tcp.c
++++ net/tcp.c
+@@ -1,2 +1,3 @@
+ one
+-two
++TWO
++2
+`,
+	},
+	{
+		name: "reverse and stat",
+		pipeline: Pipeline{Steps: []Step{
+			{Op: "recount"},
+			{Op: "reverse"},
+			{Op: "stat"},
+		}},
+		result: ` a/net/tcp.c    | 3 +--
+ a/docs/tcp.txt | 2 +-
+ 2 files changed, 2 insertions(+), 3 deletions(-)
+`,
+	},
+	{
+		name:     "stat before other steps",
+		pipeline: Pipeline{Steps: []Step{{Op: "stat"}, {Op: "reverse"}}},
+		wantErr:  ErrStatNotLast,
+	},
+	{
+		name:     "unknown step",
+		pipeline: Pipeline{Steps: []Step{{Op: "sort"}}},
+		wantErr:  ErrUnknownStep,
+	},
+}
+
+func TestPipelineRun(t *testing.T) {
+	for _, tt := range pipelineRunTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := tt.pipeline.Run(strings.NewReader(pipelinePatch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Run: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Run: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// HunkApplication describes how a hunk applies to a source.
+type HunkApplication struct {
+	// Offset is the number of lines between the position given in the hunk header
+	// and the position the hunk applies at.
+	Offset int
+	// Fuzz is the number of context lines ignored at the start or at the end of the hunk.
+	Fuzz int
+	// Err is set if the hunk doesn't apply.
+	Err error
+}
+
+// String returns a description of a such as "offset 3, fuzz 0" or "failed: <error>".
+func (a HunkApplication) String() string {
+	if a.Err != nil {
+		return fmt.Sprintf("failed: %v", a.Err)
+	}
+	return fmt.Sprintf("offset %d, fuzz %d", a.Offset, a.Fuzz)
+}
+
+// HunkPort describes how a hunk of a diff applies to two versions of a source.
+type HunkPort struct {
+	// File is the name of the file in the diff.
+	File string
+	Hunk *diff.Hunk
+	Old  HunkApplication
+	New  HunkApplication
+}
+
+// Differs reports whether the hunk applies differently to the two versions:
+// to one of them only, or with another fuzz, or at another offset.
+func (p HunkPort) Differs() bool {
+	if (p.Old.Err == nil) != (p.New.Err == nil) {
+		return true
+	}
+	return p.Old.Err == nil && (p.Old.Offset != p.New.Offset || p.Old.Fuzz != p.New.Fuzz)
+}
+
+// PortCheckOptions configures PortCheck.
+type PortCheckOptions struct {
+	// Apply configures how hunks are applied, usually with MaxOffset and Fuzz set,
+	// so that hunks still apply to the new version where it changed elsewhere.
+	// Its Report function isn't called.
+	Apply ApplyOptions
+	// StripLevel is the number of leading path components removed from file names
+	// in the diff before they are looked up in source directories, like patch -p.
+	StripLevel int
+}
+
+// PortCheck applies every hunk of patch on its own to oldSourcePath and to
+// newSourcePath, two versions of the source patch was made for, and returns how
+// it applies to each of them, in the order of the hunks in patch. It previews
+// forward-porting patch from the old version to the new one: hunks which Differ
+// need attention. Sources are files if patch changes a single file, or
+// directories the names in patch are relative to.
+func PortCheck(oldSourcePath, newSourcePath string, patch io.Reader, opts PortCheckOptions) ([]HunkPort, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return nil, fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	var ports []HunkPort
+	for _, fd := range fileDiffs {
+		name := fd.OrigName
+		if isDevNull(name) {
+			name = fd.NewName
+		}
+		oldSource, oldErr := portSource(oldSourcePath, fd, opts.StripLevel)
+		newSource, newErr := portSource(newSourcePath, fd, opts.StripLevel)
+		for _, h := range fd.Hunks {
+			p := HunkPort{File: name, Hunk: h}
+			p.Old = applyHunkAlone(oldSource, oldErr, h, opts.Apply)
+			p.New = applyHunkAlone(newSource, newErr, h, opts.Apply)
+			ports = append(ports, p)
+		}
+	}
+	return ports, nil
+}
+
+// portSource returns the content of the file fd changes in the source at path,
+// empty for added files. path is the file itself if it isn't a directory.
+func portSource(path string, fd *diff.FileDiff, strip int) (string, error) {
+	if isDevNull(fd.OrigName) {
+		return "", nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		path = filepath.Join(path, filepath.FromSlash(stripPath(fd.OrigName, strip)))
+	}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("%q: %w", path, ErrFileNotFound)
+	}
+	return string(content), err
+}
+
+// applyHunkAlone returns how h applies to source on its own, or fails with
+// sourceErr if source couldn't be read.
+func applyHunkAlone(source string, sourceErr error, h *diff.Hunk, opts ApplyOptions) HunkApplication {
+	if sourceErr != nil {
+		return HunkApplication{Err: sourceErr}
+	}
+	var a HunkApplication
+	opts.Report = func(r HunkResult) {
+		a.Offset, a.Fuzz = r.Offset, r.Fuzz
+	}
+	if _, err := ApplyHunkWithOptions(source, h, opts); err != nil {
+		return HunkApplication{Err: err}
+	}
+	return a
+}
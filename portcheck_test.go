@@ -0,0 +1,67 @@
+package patchutils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const portCheckPatch = `--- a/f.txt
++++ b/f.txt
+@@ -1,3 +1,3 @@
+ a
+-b
++B
+ c
+@@ -6,3 +6,3 @@
+ f
+-g
++G
+ h
+--- a/gone.txt
++++ b/gone.txt
+@@ -1,1 +1,1 @@
+-x
++y
+`
+
+func TestPortCheck(t *testing.T) {
+	dir := writeTestTree(t, map[string]string{
+		"old/f.txt":    "a\nb\nc\nd\ne\nf\ng\nh\n",
+		"old/gone.txt": "x\n",
+		// The first hunk moved by a line, the second one lost its context
+		"new/f.txt": "new\na\nb\nc\nd\ne\nF\ng\nh\n",
+	})
+	defer os.RemoveAll(dir)
+
+	opts := PortCheckOptions{Apply: ApplyOptions{MaxOffset: 2, Fuzz: 1}, StripLevel: 1}
+	ports, err := PortCheck(filepath.Join(dir, "old"), filepath.Join(dir, "new"), strings.NewReader(portCheckPatch), opts)
+	if err != nil {
+		t.Fatalf("PortCheck: got error %v; want error nil", err)
+	}
+	if len(ports) != 3 {
+		t.Fatalf("PortCheck: got %d hunks; want 3", len(ports))
+	}
+
+	var got []string
+	for _, p := range ports {
+		got = append(got, p.Old.String()+"; "+p.New.String())
+	}
+	want := []string{
+		"offset 0, fuzz 0; offset 1, fuzz 0",
+		"offset 0, fuzz 0; offset 1, fuzz 1",
+	}
+	for k, w := range want {
+		if got[k] != w {
+			t.Errorf("Hunk %d: got %q; want %q", k+1, got[k], w)
+		}
+		if !ports[k].Differs() {
+			t.Errorf("Hunk %d: Differs() = false; want true", k+1)
+		}
+	}
+	if ports[2].Old.Err != nil || !errors.Is(ports[2].New.Err, ErrFileNotFound) {
+		t.Errorf("Hunk 3: got %q; want it to apply to the old version only", got[2])
+	}
+}
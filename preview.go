@@ -0,0 +1,123 @@
+package patchutils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/google/go-patchutils/textnorm"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// PreviewPath returns the changes ApplyPath would make to the directory tree at
+// root when applying patch, without writing anything. Changes are written as a
+// git diff of the files on disk, file by file in the order ApplyPath writes them:
+// renamed files are deleted and added, and mode changes are reported by "old mode"
+// and "new mode" headers. Binary files, with NUL bytes or larger than
+// DefaultMaxTextSize, are reported as "Binary files ... differ". It fails like
+// ApplyPath if a file diff doesn't apply.
+func PreviewPath(root string, patch io.Reader) (string, error) {
+	return PreviewPathWithOptions(root, patch, ApplyOptions{})
+}
+
+// PreviewPathWithOptions is like PreviewPath, with patch applied as configured
+// by opts, like ApplyPathWithOptions does.
+func PreviewPathWithOptions(root string, patch io.Reader, opts ApplyOptions) (string, error) {
+	t, err := patchPathTree(context.Background(), root, patch, opts)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	for _, name := range t.names {
+		// old is the file on disk, nil if there is none
+		var old *treeFile
+		if fi, err := os.Stat(longPath(filepath.Join(root, filepath.FromSlash(name)))); err == nil {
+			content, err := t.read(name)
+			if err != nil {
+				return "", fmt.Errorf("reading %q: %w", name, err)
+			}
+			old = &treeFile{content: content, mode: fi.Mode().Perm()}
+		} else if !os.IsNotExist(err) {
+			return "", fmt.Errorf("reading %q: %w", name, err)
+		}
+
+		fileDiff, err := previewFileDiff(name, old, t.files[name])
+		if err != nil {
+			return "", err
+		}
+		result.WriteString(fileDiff)
+	}
+	return result.String(), nil
+}
+
+// previewFileDiff returns the git diff of file name changing from old, nil if
+// there is no such file, to f. It returns "" if f doesn't change the file.
+func previewFileDiff(name string, old, f *treeFile) (string, error) {
+	fd := &diff.FileDiff{
+		OrigName: "a/" + name,
+		NewName:  "b/" + name,
+		Extended: []string{"diff --git a/" + name + " b/" + name},
+	}
+	var oldContent, newContent string
+	switch {
+	case old == nil && f.deleted:
+		return "", nil
+	case f.deleted:
+		fd.NewName = "/dev/null"
+		fd.Extended = append(fd.Extended, fmt.Sprintf("deleted file mode %o", gitFileMode(old.mode)))
+		oldContent = old.content
+	case old == nil:
+		fd.OrigName = "/dev/null"
+		fd.Extended = append(fd.Extended, fmt.Sprintf("new file mode %o", gitFileMode(newFileMode(f, 0))))
+		newContent = f.content
+	default:
+		if newMode := newFileMode(f, old.mode); newMode != old.mode {
+			fd.Extended = append(fd.Extended, fmt.Sprintf("old mode %o", gitFileMode(old.mode)),
+				fmt.Sprintf("new mode %o", gitFileMode(newMode)))
+		}
+		oldContent, newContent = old.content, f.content
+		if oldContent == newContent {
+			if len(fd.Extended) == 1 {
+				return "", nil
+			}
+			// Only the mode changes
+			return strings.Join(fd.Extended, "\n") + "\n", nil
+		}
+	}
+
+	if isBinaryContent(oldContent, 0) || isBinaryContent(newContent, 0) {
+		fd.Extended = append(fd.Extended, fmt.Sprintf("Binary files %s and %s differ", fd.OrigName, fd.NewName))
+		return strings.Join(fd.Extended, "\n") + "\n", nil
+	}
+	fd.Hunks = []*diff.Hunk{}
+	hunks.ChunksToFileDiff(diffLines(sourceLines(oldContent), sourceLines(newContent),
+		textnorm.Options{}, textnorm.Ignore{}, nil), fd, 0, 0)
+
+	result, err := diff.PrintFileDiff(fd)
+	if err != nil {
+		return "", fmt.Errorf("printing diff for file %q: %w", name, err)
+	}
+	return string(result), nil
+}
+
+// newFileMode returns the permissions writeTree gives f when writing it over a
+// file with oldMode, 0 if there is none.
+func newFileMode(f *treeFile, oldMode os.FileMode) os.FileMode {
+	switch {
+	case f.mode != 0:
+		return f.mode
+	case oldMode != 0:
+		return oldMode
+	}
+	return 0644
+}
+
+// gitFileMode returns perm as the mode of a regular file in git extended headers.
+func gitFileMode(perm os.FileMode) uint32 {
+	return 0100000 | uint32(perm)
+}
@@ -0,0 +1,85 @@
+package patchutils
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var previewPathTests = []struct {
+	name    string
+	files   map[string]string
+	patch   string
+	want    string
+	wantErr error
+}{
+	{
+		name:  "modify, add and delete",
+		files: map[string]string{"a.txt": "one\ntwo\nthree\n", "b.txt": "b\n"},
+		patch: "--- a.txt\n+++ a.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n" +
+			"--- /dev/null\n+++ dir/c.txt\n@@ -0,0 +1 @@\n+c\n" +
+			"--- b.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-b\n",
+		want: "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n" +
+			"diff --git a/dir/c.txt b/dir/c.txt\nnew file mode 100644\n--- /dev/null\n+++ b/dir/c.txt\n@@ -0,0 +1,1 @@\n+c\n" +
+			"diff --git a/b.txt b/b.txt\ndeleted file mode 100644\n--- a/b.txt\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-b\n",
+	},
+	{
+		name:  "rename and mode change",
+		files: map[string]string{"a.txt": "a\n", "run.sh": "echo\n"},
+		patch: "diff --git a.txt b.txt\nsimilarity index 90%\nrename from a.txt\nrename to b.txt\n" +
+			"--- a.txt\n+++ b.txt\n@@ -1 +1 @@\n-a\n+b\n" +
+			"diff --git run.sh run.sh\nold mode 100644\nnew mode 100755\n" +
+			"--- run.sh\n+++ run.sh\n@@ -1 +1 @@\n-echo\n+echo run\n",
+		want: "diff --git a/a.txt b/a.txt\ndeleted file mode 100644\n--- a/a.txt\n+++ /dev/null\n@@ -1,1 +0,0 @@\n-a\n" +
+			"diff --git a/b.txt b/b.txt\nnew file mode 100644\n--- /dev/null\n+++ b/b.txt\n@@ -0,0 +1,1 @@\n+b\n" +
+			"diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755\n--- a/run.sh\n+++ b/run.sh\n@@ -1,1 +1,1 @@\n-echo\n+echo run\n",
+	},
+	{
+		name:  "binary file",
+		files: map[string]string{"a.bin": "a\x00\n"},
+		patch: "--- a.bin\n+++ a.bin\n@@ -1 +1 @@\n-a\x00\n+b\x00\n",
+		want:  "diff --git a/a.bin b/a.bin\nBinary files a/a.bin and b/a.bin differ\n",
+	},
+	{
+		name:    "failing file diff",
+		files:   map[string]string{"a.txt": "one\n"},
+		patch:   "--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n-x\n+X\n",
+		wantErr: ErrContentMismatch,
+	},
+}
+
+func TestPreviewPath(t *testing.T) {
+	for _, tt := range previewPathTests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeTestTree(t, tt.files)
+			defer os.RemoveAll(root)
+
+			got, err := PreviewPath(root, strings.NewReader(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("PreviewPath: got error %v; want error %v", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatalf("PreviewPath: got error %v; want error nil", err)
+			} else if got != tt.want {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, tt.want)
+			}
+			if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, tt.files) {
+				t.Errorf("Tree changed by PreviewPath.\nGot:\n%v\nWant:\n%v\n", currentFiles, tt.files)
+			}
+		})
+	}
+}
+
+func TestPreviewFileDiffModeOnly(t *testing.T) {
+	// go-diff doesn't parse git diffs changing modes only with names of patch -p0
+	got, err := previewFileDiff("run.sh", &treeFile{content: "echo\n", mode: 0644}, &treeFile{content: "echo\n", mode: 0755})
+	if err != nil {
+		t.Fatalf("previewFileDiff: got error %v; want error nil", err)
+	}
+	if want := "diff --git a/run.sh b/run.sh\nold mode 100644\nnew mode 100755\n"; got != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Quota limits what writing a patched tree may create, protecting services
+// applying patches of untrusted users from patches creating huge trees.
+// Limits are checked before anything is written. Zero fields don't limit anything.
+type Quota struct {
+	// MaxFiles is the number of regular files and symbolic links which may be created,
+	// not counting directories.
+	MaxFiles int
+	// MaxBytes is the number of bytes of file content which may be written.
+	MaxBytes int64
+	// MaxDepth is the number of components paths of files written may have,
+	// relative to the root of the tree.
+	MaxDepth int
+}
+
+// QuotaLimit is one of the limits of a Quota.
+type QuotaLimit int
+
+const (
+	// QuotaFiles is the limit of Quota.MaxFiles.
+	QuotaFiles QuotaLimit = iota
+	// QuotaBytes is the limit of Quota.MaxBytes.
+	QuotaBytes
+	// QuotaDepth is the limit of Quota.MaxDepth.
+	QuotaDepth
+)
+
+// String returns "files", "bytes" or "depth".
+func (l QuotaLimit) String() string {
+	switch l {
+	case QuotaBytes:
+		return "bytes"
+	case QuotaDepth:
+		return "depth"
+	}
+	return "files"
+}
+
+// QuotaError is returned when writing a tree would exceed a limit of its Quota.
+type QuotaError struct {
+	Limit QuotaLimit
+	// Max is the value of the limit.
+	Max int64
+	// Name is the slash-separated name of the file which would exceed the limit.
+	Name string
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%v: %q exceeds the limit of %d %s", ErrQuotaExceeded, e.Name, e.Max, e.Limit)
+}
+
+// Unwrap returns ErrQuotaExceeded, so that errors.Is(err, ErrQuotaExceeded) holds.
+func (e *QuotaError) Unwrap() error {
+	return ErrQuotaExceeded
+}
+
+// quotaUsage counts what writing a tree creates against quota.
+type quotaUsage struct {
+	quota Quota
+	files int
+	bytes int64
+}
+
+// add counts writing size bytes to the file name, which is created unless it
+// exists already, and returns a *QuotaError if that exceeds the quota.
+func (u *quotaUsage) add(name string, size int64, created bool) error {
+	if err := u.addDir(name); err != nil {
+		return err
+	}
+	if created {
+		u.files++
+		if u.quota.MaxFiles > 0 && u.files > u.quota.MaxFiles {
+			return &QuotaError{Limit: QuotaFiles, Max: int64(u.quota.MaxFiles), Name: name}
+		}
+	}
+	u.bytes += size
+	if u.quota.MaxBytes > 0 && u.bytes > u.quota.MaxBytes {
+		return &QuotaError{Limit: QuotaBytes, Max: u.quota.MaxBytes, Name: name}
+	}
+	return nil
+}
+
+// addDir checks the depth of the directory or file name.
+func (u *quotaUsage) addDir(name string) error {
+	if depth := strings.Count(name, "/") + 1; u.quota.MaxDepth > 0 && depth > u.quota.MaxDepth {
+		return &QuotaError{Limit: QuotaDepth, Max: int64(u.quota.MaxDepth), Name: name}
+	}
+	return nil
+}
+
+// quotaExporter writes nothing, counting what an exported tree creates instead.
+type quotaExporter struct {
+	usage quotaUsage
+}
+
+func (q *quotaExporter) dir(name string, mode os.FileMode) error {
+	return q.usage.addDir(name)
+}
+
+func (q *quotaExporter) file(name string, content string, mode os.FileMode) error {
+	return q.usage.add(name, int64(len(content)), true)
+}
+
+func (q *quotaExporter) copy(name, path string, info os.FileInfo) error {
+	return q.usage.add(name, info.Size(), true)
+}
+
+func (q *quotaExporter) symlink(name, target string) error {
+	return q.usage.add(name, 0, true)
+}
+
+// ErrQuotaExceeded indicates that writing a tree would exceed a limit of its Quota.
+var ErrQuotaExceeded = errors.New("quota exceeded")
@@ -0,0 +1,103 @@
+package patchutils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const quotaPatch = `--- a.txt
++++ a.txt
+@@ -1 +1,2 @@
+ a
++more
+--- /dev/null
++++ new/deep/b.txt
+@@ -0,0 +1 @@
++b
+`
+
+var quotaTests = []struct {
+	name    string
+	quota   Quota
+	wantErr *QuotaError
+}{
+	{
+		name:  "within quota",
+		quota: Quota{MaxFiles: 1, MaxBytes: 9, MaxDepth: 3},
+	},
+	{
+		name:    "bytes",
+		quota:   Quota{MaxBytes: 8},
+		wantErr: &QuotaError{Limit: QuotaBytes, Max: 8, Name: "new/deep/b.txt"},
+	},
+	{
+		name:    "depth",
+		quota:   Quota{MaxDepth: 2},
+		wantErr: &QuotaError{Limit: QuotaDepth, Max: 2, Name: "new/deep/b.txt"},
+	},
+}
+
+func TestApplyPathQuota(t *testing.T) {
+	files := map[string]string{"a.txt": "a\n", "c.txt": "c\n"}
+	for _, tt := range quotaTests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeTestTree(t, files)
+			defer os.RemoveAll(root)
+
+			err := ApplyPathWithOptions(root, strings.NewReader(quotaPatch), ApplyOptions{Quota: tt.quota})
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Errorf("ApplyPath: got error %v; want error nil", err)
+				}
+				return
+			}
+			var quotaErr *QuotaError
+			if !errors.As(err, &quotaErr) || !reflect.DeepEqual(quotaErr, tt.wantErr) || !errors.Is(err, ErrQuotaExceeded) {
+				t.Errorf("ApplyPath: got error %v; want error %v", err, tt.wantErr)
+			}
+			if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, files) {
+				t.Errorf("Tree changed after error.\nGot:\n%v\nWant:\n%v\n", currentFiles, files)
+			}
+		})
+	}
+}
+
+func TestApplyPathQuotaFiles(t *testing.T) {
+	root := writeTestTree(t, map[string]string{"a.txt": "a\n"})
+	defer os.RemoveAll(root)
+
+	patch := quotaPatch + "--- /dev/null\n+++ c.txt\n@@ -0,0 +1 @@\n+c\n"
+	err := ApplyPathWithOptions(root, strings.NewReader(patch), ApplyOptions{Quota: Quota{MaxFiles: 1}})
+	want := &QuotaError{Limit: QuotaFiles, Max: 1, Name: "c.txt"}
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || !reflect.DeepEqual(quotaErr, want) {
+		t.Errorf("ApplyPath: got error %v; want error %v", err, want)
+	}
+}
+
+func TestExportTreeQuota(t *testing.T) {
+	dir := writeTestTree(t, exportSource)
+	defer os.RemoveAll(dir)
+	source, out := filepath.Join(dir, "source"), filepath.Join(dir, "out")
+
+	// The source has 3 files, of which the patch deletes one and adds one
+	opts := ExportOptions{StripLevel: 1, Apply: ApplyOptions{Quota: Quota{MaxFiles: 2}}}
+	err := ExportTree(source, strings.NewReader(exportPatch), out, opts)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("ExportTree: got error %v; want error %v", err, ErrQuotaExceeded)
+	}
+	written, err := ioutil.ReadDir(out)
+	if err != nil || len(written) != 0 {
+		t.Errorf("ExportTree wrote %d files, %v; want none", len(written), err)
+	}
+
+	opts.Apply.Quota.MaxFiles = 3
+	if err := ExportTree(source, strings.NewReader(exportPatch), filepath.Join(dir, "out2"), opts); err != nil {
+		t.Errorf("ExportTree: got error %v; want error nil", err)
+	}
+}
@@ -0,0 +1,50 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Recount returns patch with OrigLines and NewLines of every hunk recomputed
+// from its body, and NewStartLine recomputed from OrigStartLine and the lines
+// added and deleted by the previous hunks of the file, like recountdiff.
+// It makes hand-edited patches with stale hunk headers usable again.
+func Recount(patch io.Reader) (string, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	for _, fd := range fileDiffs {
+		RecountFileDiff(fd)
+	}
+
+	result, err := diff.PrintMultiFileDiff(fileDiffs)
+	if err != nil {
+		return "", fmt.Errorf("printing recounted patch: %w", err)
+	}
+	return string(result), nil
+}
+
+// RecountFileDiff recomputes the headers of all hunks of fileDiff in place, as Recount does.
+func RecountFileDiff(fileDiff *diff.FileDiff) {
+	var delta int32
+	for _, h := range fileDiff.Hunks {
+		RecountHunk(h)
+		h.NewStartLine = h.OrigStartLine + delta
+		switch {
+		case h.OrigLines == 0:
+			// Lines are added after OrigStartLine
+			h.NewStartLine++
+		case h.NewLines == 0:
+			// Lines are deleted after NewStartLine
+			h.NewStartLine--
+		}
+		delta += h.NewLines - h.OrigLines
+	}
+}
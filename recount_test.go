@@ -0,0 +1,99 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var recountTests = []struct {
+	name    string
+	patch   string
+	result  string
+	wantErr error
+}{
+	{
+		name: "stale counts and offsets",
+		patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,1 +1,1 @@
+ one
+-two
++TWO
++2
+@@ -10,1 +10,1 @@
+-ten
++TEN
+`,
+		result: `--- a/file.txt
++++ b/file.txt
+@@ -1,2 +1,3 @@
+ one
+-two
++TWO
++2
+@@ -10,1 +11,1 @@
+-ten
++TEN
+`,
+	},
+	{
+		name: "added and deleted lines only",
+		patch: `--- a/file.txt
++++ b/file.txt
+@@ -3,0 +3,0 @@
++new
++lines
+@@ -8,5 +8,5 @@
+-gone
+`,
+		result: `--- a/file.txt
++++ b/file.txt
+@@ -3,0 +4,2 @@
++new
++lines
+@@ -8,1 +9,0 @@
+-gone
+`,
+	},
+	{
+		name: "added file",
+		patch: `--- /dev/null
++++ b/file.txt
+@@ -0,0 +1,1 @@
++one
++two
+`,
+		result: `--- /dev/null
++++ b/file.txt
+@@ -0,0 +1,2 @@
++one
++two
+`,
+	},
+	{
+		name:    "empty patch",
+		patch:   "",
+		wantErr: ErrEmptyDiffFile,
+	},
+}
+
+func TestRecount(t *testing.T) {
+	for _, tt := range recountTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := Recount(strings.NewReader(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Recount: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Recount: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package patchutils
+
+import (
+	"os"
+	"syscall"
+)
+
+// ficlone is the FICLONE ioctl request of Linux.
+const ficlone = 0x40049409
+
+// reflink makes dst share the content of src with copy-on-write, on filesystems
+// supporting it such as Btrfs and XFS.
+func reflink(dst, src *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, dst.Fd(), ficlone, src.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
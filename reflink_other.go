@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package patchutils
+
+import (
+	"errors"
+	"os"
+)
+
+// reflink makes dst share the content of src with copy-on-write.
+// It is supported on Linux only.
+func reflink(dst, src *os.File) error {
+	return errors.New("reflinks aren't supported on this platform")
+}
@@ -0,0 +1,221 @@
+package patchutils
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/google/go-patchutils/textnorm"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// releaseTree is the content of a source release, keyed by file path
+// relative to the release's top-level directory.
+type releaseTree struct {
+	// root is the top-level directory all files of the release are in, or "" if there is none.
+	root  string
+	files map[string]string
+}
+
+// CompareReleases computes the diff between the source tree of the oldTar release
+// patched with the oldPatches series and the source tree of the newTar release
+// patched with the newPatches series.
+// Tarballs may be gzip-compressed. Patches of each series are applied in order and
+// should be relative to the directory containing the release's top-level directory
+// (patch -p1), as in quilt series of distribution packages.
+func CompareReleases(oldTar io.Reader, oldPatches []io.Reader, newTar io.Reader, newPatches []io.Reader) (string, error) {
+	oldTree, err := readReleaseTree(oldTar)
+	if err != nil {
+		return "", fmt.Errorf("reading oldTar: %w", err)
+	}
+	if err := oldTree.applySeries(oldPatches); err != nil {
+		return "", fmt.Errorf("applying oldPatches: %w", err)
+	}
+
+	newTree, err := readReleaseTree(newTar)
+	if err != nil {
+		return "", fmt.Errorf("reading newTar: %w", err)
+	}
+	if err := newTree.applySeries(newPatches); err != nil {
+		return "", fmt.Errorf("applying newPatches: %w", err)
+	}
+
+	return diffReleaseTrees(oldTree, newTree)
+}
+
+// readReleaseTree reads regular files of a tar archive, gzip-compressed or not.
+func readReleaseTree(archive io.Reader) (*releaseTree, error) {
+	br := bufio.NewReader(archive)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("opening gzip stream: %w", err)
+		}
+		defer zr.Close()
+		archive = zr
+	} else {
+		archive = br
+	}
+
+	files := make(map[string]string)
+	tr := tar.NewReader(archive)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading tar header: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg && hdr.Typeflag != tar.TypeRegA {
+			continue
+		}
+
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %q: %w", hdr.Name, err)
+		}
+		files[path.Clean(hdr.Name)] = string(content)
+	}
+
+	return newReleaseTree(files), nil
+}
+
+// newReleaseTree returns a releaseTree of files, with their common top-level directory stripped.
+func newReleaseTree(files map[string]string) *releaseTree {
+	root := ""
+	for name := range files {
+		k := strings.Index(name, "/")
+		if k < 0 || (root != "" && name[:k] != root) {
+			return &releaseTree{files: files}
+		}
+		root = name[:k]
+	}
+
+	stripped := make(map[string]string, len(files))
+	for name, content := range files {
+		stripped[strings.TrimPrefix(name, root+"/")] = content
+	}
+	return &releaseTree{root: root, files: stripped}
+}
+
+// applySeries applies patches to t in order.
+// Names in patches are relative to the parent of t's top-level directory.
+func (t *releaseTree) applySeries(patches []io.Reader) error {
+	pt := newPatchTree(func(name string) (string, error) {
+		content, ok := t.files[name]
+		if !ok {
+			return "", os.ErrNotExist
+		}
+		return content, nil
+	}, 1, ApplyOptions{})
+
+	for k, patch := range patches {
+		fileDiffs, err := readPatch(patch)
+		if err != nil {
+			return fmt.Errorf("parsing patch %d: %w", k+1, err)
+		}
+
+		for _, fd := range fileDiffs {
+			if err := pt.apply(fd); err != nil {
+				return fmt.Errorf("patch %d: %w", k+1, err)
+			}
+		}
+	}
+
+	for _, name := range pt.names {
+		if f := pt.files[name]; f.deleted {
+			delete(t.files, name)
+		} else {
+			t.files[name] = f.content
+		}
+	}
+	return nil
+}
+
+// diffReleaseTrees returns the diff of all files in oldTree and newTree, ordered by path.
+// Files present in only one of the trees are reported as "Only in" entries.
+func diffReleaseTrees(oldTree, newTree *releaseTree) (string, error) {
+	var paths []string
+	for p := range oldTree.files {
+		paths = append(paths, p)
+	}
+	for p := range newTree.files {
+		if _, ok := oldTree.files[p]; !ok {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	var result strings.Builder
+	for _, p := range paths {
+		oldContent, inOld := oldTree.files[p]
+		newContent, inNew := newTree.files[p]
+		oldName, newName := path.Join(oldTree.root, p), path.Join(newTree.root, p)
+
+		switch {
+		case !inNew:
+			fmt.Fprintf(&result, "Only in %s: %s\n", path.Dir(oldName), path.Base(oldName))
+		case !inOld:
+			fmt.Fprintf(&result, "Only in %s: %s\n", path.Dir(newName), path.Base(newName))
+		case oldContent != newContent:
+			fileDiffContent, err := diffContents(oldName, newName, oldContent, newContent)
+			if err != nil {
+				return "", err
+			}
+			result.WriteString(fileDiffContent)
+		}
+	}
+
+	return result.String(), nil
+}
+
+// diffContents returns the diff of oldContent of file oldName and newContent of file newName.
+func diffContents(oldName, newName, oldContent, newContent string) (string, error) {
+	resultFileDiff := &diff.FileDiff{
+		OrigName: oldName,
+		NewName:  newName,
+		Extended: []string{},
+		Hunks:    []*diff.Hunk{},
+	}
+	hunks.ChunksToFileDiff(diffLines(sourceLines(oldContent), sourceLines(newContent),
+		textnorm.Options{}, textnorm.Ignore{}, nil), resultFileDiff, 0, 0)
+
+	fileDiffContent, err := diff.PrintFileDiff(resultFileDiff)
+	if err != nil {
+		return "", fmt.Errorf("printing diff for file %q: %w", oldName, err)
+	}
+	return string(fileDiffContent), nil
+}
+
+// stripPath removes n leading components from name, leaving /dev/null untouched.
+func stripPath(name string, n int) string {
+	if isDevNull(name) {
+		return name
+	}
+	for ; n > 0; n-- {
+		k := strings.Index(name, "/")
+		if k < 0 {
+			return name
+		}
+		name = name[k+1:]
+	}
+	return name
+}
+
+// isDevNull reports whether name stands for a missing file in a diff header.
+func isDevNull(name string) bool {
+	return name == "/dev/null"
+}
+
+// ErrFileNotFound indicates that a file a diff refers to doesn't exist.
+var ErrFileNotFound = errors.New("file not found")
@@ -0,0 +1,162 @@
+package patchutils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newTestTar returns a tar archive with files, gzip-compressed if compress is set.
+func newTestTar(t *testing.T, files map[string]string, compress bool) io.Reader {
+	t.Helper()
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(&buf)
+		w = zw
+	}
+	tw := tar.NewWriter(w)
+	for _, name := range names {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+var compareReleasesTests = []struct {
+	name       string
+	oldFiles   map[string]string
+	oldPatches []string
+	newFiles   map[string]string
+	newPatches []string
+	result     string
+	wantErr    error
+}{
+	{
+		name: "patch upstreamed",
+		oldFiles: map[string]string{
+			"pkg-1.0/a.txt": "one\ntwo\nthree\n",
+			"pkg-1.0/b.txt": "b\n",
+		},
+		oldPatches: []string{`--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+`},
+		newFiles: map[string]string{
+			"pkg-1.1/a.txt": "one\nTWO\nthree\n",
+			"pkg-1.1/b.txt": "b\n",
+		},
+		result: "",
+	},
+	{
+		name: "patch series against changed release",
+		oldFiles: map[string]string{
+			"pkg-1.0/a.txt": "one\ntwo\nthree\n",
+			"pkg-1.0/b.txt": "b\n",
+		},
+		oldPatches: []string{`--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ one
+-two
++TWO
+ three
+`, `--- /dev/null
++++ b/c.txt
+@@ -0,0 +1 @@
++c
+`},
+		newFiles: map[string]string{
+			"pkg-1.1/a.txt": "one\ntwo\nthree\nfour\n",
+			"pkg-1.1/b.txt": "b\n",
+		},
+		newPatches: []string{`--- a/b.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-b
+`},
+		result: `--- pkg-1.0/a.txt
++++ pkg-1.1/a.txt
+@@ -1,3 +1,4 @@
+ one
+-TWO
++two
+ three
++four
+Only in pkg-1.0: b.txt
+Only in pkg-1.0: c.txt
+`,
+	},
+	{
+		name:       "patch doesn't apply",
+		oldFiles:   map[string]string{"pkg-1.0/a.txt": "one\n"},
+		oldPatches: []string{"--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-two\n+TWO\n"},
+		newFiles:   map[string]string{"pkg-1.1/a.txt": "one\n"},
+		wantErr:    ErrContentMismatch,
+	},
+	{
+		name:       "patched file is missing",
+		oldFiles:   map[string]string{"pkg-1.0/a.txt": "one\n"},
+		oldPatches: []string{"--- a/x.txt\n+++ b/x.txt\n@@ -1 +1 @@\n-one\n+ONE\n"},
+		newFiles:   map[string]string{"pkg-1.1/a.txt": "one\n"},
+		wantErr:    ErrFileNotFound,
+	},
+}
+
+func TestCompareReleases(t *testing.T) {
+	readers := func(patches []string) []io.Reader {
+		var result []io.Reader
+		for _, p := range patches {
+			result = append(result, strings.NewReader(p))
+		}
+		return result
+	}
+
+	for _, tt := range compareReleasesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := CompareReleases(newTestTar(t, tt.oldFiles, false), readers(tt.oldPatches),
+				newTestTar(t, tt.newFiles, true), readers(tt.newPatches))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("CompareReleases: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompareReleases: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
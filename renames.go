@@ -0,0 +1,166 @@
+package patchutils
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/google/go-patchutils/textnorm"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// followRenames prepares FileDiffs of two diffs of the same files for pairing
+// by their original names, when files are renamed by git.
+//
+// Git lists renamed files under their new names, so both diffs are sorted by
+// original names with less, or new names for added files. And a file renamed in
+// one diff, but deleted and added under its new name in the other one (git diff
+// --no-renames), is turned into a rename in the other diff as well, so that the
+// two are compared.
+func followRenames(oldFileDiffs, newFileDiffs []*diff.FileDiff, less func(a, b string) bool) ([]*diff.FileDiff, []*diff.FileDiff, error) {
+	oldRenames, newRenames := gitRenames(oldFileDiffs), gitRenames(newFileDiffs)
+
+	oldFileDiffs, err := joinRenames(oldFileDiffs, newRenames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("oldDiff: %w", err)
+	}
+	newFileDiffs, err = joinRenames(newFileDiffs, oldRenames)
+	if err != nil {
+		return nil, nil, fmt.Errorf("newDiff: %w", err)
+	}
+
+	for _, fileDiffs := range [][]*diff.FileDiff{oldFileDiffs, newFileDiffs} {
+		fileDiffs := fileDiffs
+		sort.SliceStable(fileDiffs, func(i, j int) bool {
+			return less(pairName(fileDiffs[i]), pairName(fileDiffs[j]))
+		})
+	}
+	return oldFileDiffs, newFileDiffs, nil
+}
+
+// gitRenames returns new names of files renamed in fileDiffs by their old names.
+func gitRenames(fileDiffs []*diff.FileDiff) map[string]string {
+	renames := make(map[string]string)
+	for _, fd := range fileDiffs {
+		h, ok := parseGitHeader(fd.Extended)
+		if ok && h.oldName != h.newName && !isDevNull(fd.OrigName) && !isDevNull(fd.NewName) {
+			renames[h.oldName] = h.newName
+		}
+	}
+	return renames
+}
+
+// joinRenames returns fileDiffs with every deleted file, which is renamed
+// according to renames, and the file added under its new name replaced by one
+// FileDiff of the rename, with hunks computed from the deleted and added lines.
+func joinRenames(fileDiffs []*diff.FileDiff, renames map[string]string) ([]*diff.FileDiff, error) {
+	if len(renames) == 0 {
+		return fileDiffs, nil
+	}
+
+	added := make(map[string]int)
+	for k, fd := range fileDiffs {
+		if h, ok := parseGitHeader(fd.Extended); ok && isDevNull(fd.OrigName) {
+			added[h.newName] = k
+		}
+	}
+
+	joined := make(map[int]*diff.FileDiff)
+	for k, fd := range fileDiffs {
+		h, ok := parseGitHeader(fd.Extended)
+		if !ok || !isDevNull(fd.NewName) {
+			continue
+		}
+		newName, ok := renames[h.oldName]
+		if !ok {
+			continue
+		}
+		a, ok := added[newName]
+		if !ok {
+			continue
+		}
+		rename, err := renameFileDiff(fd, fileDiffs[a])
+		if err != nil {
+			return nil, fmt.Errorf("joining %q and %q: %w", fd.OrigName, fileDiffs[a].NewName, err)
+		}
+		joined[k] = rename
+		joined[a] = nil
+	}
+	if len(joined) == 0 {
+		return fileDiffs, nil
+	}
+
+	var result []*diff.FileDiff
+	for k, fd := range fileDiffs {
+		if rename, ok := joined[k]; ok {
+			if rename != nil {
+				result = append(result, rename)
+			}
+			continue
+		}
+		result = append(result, fd)
+	}
+	return result, nil
+}
+
+// renameFileDiff returns a FileDiff renaming the file deleted by deleted
+// to the file added by added, with git extended headers of a rename.
+func renameFileDiff(deleted, added *diff.FileDiff) (*diff.FileDiff, error) {
+	deletedHeader, _ := parseGitHeader(deleted.Extended)
+	addedHeader, _ := parseGitHeader(added.Extended)
+
+	oldLines, err := fileDiffLines(deleted, OpDelete)
+	if err != nil {
+		return nil, err
+	}
+	newLines, err := fileDiffLines(added, OpAdd)
+	if err != nil {
+		return nil, err
+	}
+
+	rename := &diff.FileDiff{
+		OrigName: deleted.OrigName,
+		OrigTime: deleted.OrigTime,
+		NewName:  added.NewName,
+		NewTime:  added.NewTime,
+		Hunks:    []*diff.Hunk{},
+	}
+	hunks.ChunksToFileDiff(diffLines(oldLines, newLines, textnorm.Options{}, textnorm.Ignore{}, nil), rename, 0, 0)
+
+	rename.Extended = []string{fmt.Sprintf("diff --git a/%s b/%s", deletedHeader.oldName, addedHeader.newName)}
+	if deletedHeader.oldMode != "" && addedHeader.newMode != "" && deletedHeader.oldMode != addedHeader.newMode {
+		rename.Extended = append(rename.Extended,
+			"old mode "+deletedHeader.oldMode, "new mode "+addedHeader.newMode)
+	}
+	if len(rename.Hunks) == 0 {
+		rename.Hunks = nil
+		rename.Extended = append(rename.Extended, "similarity index 100%")
+	}
+	rename.Extended = append(rename.Extended,
+		"rename from "+deletedHeader.oldName, "rename to "+addedHeader.newName)
+	if len(rename.Hunks) > 0 && deletedHeader.oldHash != "" && addedHeader.newHash != "" {
+		index := "index " + deletedHeader.oldHash + ".." + addedHeader.newHash
+		if deletedHeader.oldMode != "" && deletedHeader.oldMode == addedHeader.newMode {
+			index += " " + deletedHeader.oldMode
+		}
+		rename.Extended = append(rename.Extended, index)
+	}
+	return rename, nil
+}
+
+// fileDiffLines returns text of lines of fd's hunks with operation op.
+func fileDiffLines(fd *diff.FileDiff, op LineOp) ([]string, error) {
+	var result []string
+	for _, h := range fd.Hunks {
+		lines, err := HunkLines(h)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range lines {
+			if line.Op == op {
+				result = append(result, line.Text)
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,50 @@
+package patchutils
+
+import (
+	"strings"
+	"testing"
+)
+
+var followRenamesTests = []struct {
+	name    string
+	oldDiff string
+	newDiff string
+	result  string
+}{
+	{
+		name: "rename against delete and add",
+		oldDiff: "diff --git a/foo.c b/foo.c\ndeleted file mode 100644\nindex 1111111..0000000\n" +
+			"--- a/foo.c\n+++ /dev/null\n@@ -1,3 +0,0 @@\n-a\n-b\n-c\n" +
+			"diff --git a/bar.c b/bar.c\nnew file mode 100644\nindex 0000000..2222222\n" +
+			"--- /dev/null\n+++ b/bar.c\n@@ -0,0 +1,3 @@\n+a\n+B\n+c\n",
+		newDiff: "diff --git a/foo.c b/bar.c\nsimilarity index 66%\nrename from foo.c\nrename to bar.c\nindex 1111111..3333333 100644\n" +
+			"--- a/foo.c\n+++ b/bar.c\n@@ -1,3 +1,3 @@\n a\n-b\n+X\n c\n",
+		result: "diff --git a/bar.c b/bar.c\nindex 2222222..3333333 100644\n" +
+			"--- a/bar.c\n+++ b/bar.c\n@@ -1,3 +1,3 @@\n a\n-B\n+X\n c\n",
+	},
+	{
+		name: "renames listed by new names",
+		oldDiff: "diff --git a/z.c b/a.c\nsimilarity index 66%\nrename from z.c\nrename to a.c\n" +
+			"--- a/z.c\n+++ b/a.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n" +
+			"diff --git a/m.c b/m.c\n--- a/m.c\n+++ b/m.c\n@@ -1 +1 @@\n-m\n+M\n",
+		newDiff: "diff --git a/m.c b/m.c\n--- a/m.c\n+++ b/m.c\n@@ -1 +1 @@\n-m\n+N\n" +
+			"diff --git a/z.c b/a.c\nsimilarity index 66%\nrename from z.c\nrename to a.c\n" +
+			"--- a/z.c\n+++ b/a.c\n@@ -1,3 +1,3 @@\n a\n-b\n+X\n c\n",
+		result: "diff --git a/m.c b/m.c\n--- a/m.c\n+++ b/m.c\n@@ -1,1 +1,1 @@\n-M\n+N\n" +
+			"diff --git a/a.c b/a.c\n--- a/a.c\n+++ b/a.c\n@@ -1,3 +1,3 @@\n a\n-B\n+X\n c\n",
+	},
+}
+
+func TestFollowRenames(t *testing.T) {
+	for _, tt := range followRenamesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := InterDiff(strings.NewReader(tt.oldDiff), strings.NewReader(tt.newDiff))
+			if err != nil {
+				t.Fatalf("InterDiff: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
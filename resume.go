@@ -0,0 +1,85 @@
+package patchutils
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ResumeState records entries of the result of MixedModePathToWithOptions as they are
+// written, so that an interrupted run over directories can continue where it left off,
+// computing and writing only the entries of the remaining files.
+// A run is only resumed correctly with the same sources, diffs and options.
+// It is safe for concurrent use.
+type ResumeState struct {
+	mu   sync.Mutex
+	done map[resumeEntry]bool
+	log  io.Writer
+}
+
+// resumeEntry identifies an entry of the result: a pair of files, or a file
+// present in one side only, with the other name empty.
+type resumeEntry struct {
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// NewResumeState returns a ResumeState with the entries recorded in log by an earlier
+// run, which appends entries written from now on to log, one JSON object per line.
+// log is read to its end first, so that writes go after the recorded entries.
+// A record cut short by a crash is ignored, and its entry written again.
+func NewResumeState(log io.ReadWriter) (*ResumeState, error) {
+	s := &ResumeState{done: make(map[resumeEntry]bool), log: log}
+	r := bufio.NewReader(log)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("reading resume state: %w", err)
+		}
+		if errors.Is(err, io.EOF) {
+			if line != "" {
+				// Terminate the record cut short, so that it doesn't run into the next one
+				if _, err := io.WriteString(log, "\n"); err != nil {
+					return nil, fmt.Errorf("writing resume state: %w", err)
+				}
+			}
+			return s, nil
+		}
+		var e resumeEntry
+		if json.Unmarshal([]byte(line), &e) == nil {
+			s.done[e] = true
+		}
+	}
+}
+
+// isDone reports whether e was written by an earlier run. s may be nil.
+func (s *ResumeState) isDone(e resumeEntry) bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done[e]
+}
+
+// record appends e to the log of s. s may be nil.
+func (s *ResumeState) record(e resumeEntry) error {
+	if s == nil {
+		return nil
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("encoding resume state: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done[e] = true
+	if _, err := s.log.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing resume state: %w", err)
+	}
+	return nil
+}
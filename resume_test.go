@@ -0,0 +1,92 @@
+package patchutils
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// stoppingWriter fails all writes after the first n ones with errWrite.
+type stoppingWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (w *stoppingWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errWrite
+	}
+	w.n--
+	return w.buf.Write(p)
+}
+
+// mixedModeResumed computes mixed mode of the source_1 test directories into w,
+// resuming with the state in file log.
+func mixedModeResumed(t *testing.T, w *stoppingWriter, log *os.File) error {
+	t.Helper()
+
+	oldDiff, err := os.Open(testFile("s1_a.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldDiff.Close()
+	newDiff, err := os.Open(testFile("s1_c_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newDiff.Close()
+	if _, err := log.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := NewResumeState(log)
+	if err != nil {
+		t.Fatalf("NewResumeState: got error %v; want error nil", err)
+	}
+	return MixedModePathToWithOptions(w, "source_1", "source_1_c", oldDiff, newDiff, MixedModeOptions{Resume: state, Dir: testFilesDir})
+}
+
+func TestResumeState(t *testing.T) {
+	correctResult, err := ioutil.ReadFile(testFile("s1_a_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log, err := ioutil.TempFile("", "resume")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(log.Name())
+	defer log.Close()
+
+	// The first run is interrupted after writing one entry,
+	// the second one after writing a record cut short by a crash
+	first := &stoppingWriter{n: 1}
+	if err := mixedModeResumed(t, first, log); !errors.Is(err, errWrite) {
+		t.Fatalf("Interrupted run: got error %v; want error %v", err, errWrite)
+	}
+	if _, err := log.WriteString(`{"old":"sour`); err != nil {
+		t.Fatal(err)
+	}
+
+	second := &stoppingWriter{n: -1}
+	if err := mixedModeResumed(t, second, log); err != nil {
+		t.Fatalf("Resumed run: got error %v; want error nil", err)
+	}
+	if result := first.buf.String() + second.buf.String(); result != string(correctResult) {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, correctResult)
+	}
+	if strings.Contains(second.buf.String(), first.buf.String()) {
+		t.Errorf("Resumed run wrote entries of the interrupted one again:\n%s", second.buf.String())
+	}
+
+	third := &stoppingWriter{n: -1}
+	if err := mixedModeResumed(t, third, log); err != nil {
+		t.Fatalf("Run after completion: got error %v; want error nil", err)
+	}
+	if third.buf.Len() != 0 {
+		t.Errorf("Run after completion wrote:\n%s\nWant nothing", third.buf.String())
+	}
+}
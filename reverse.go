@@ -0,0 +1,158 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// Reverse returns patch reversed, so that it undoes the changes of patch.
+// patch should be in unified format and may contain multiple files.
+func Reverse(patch io.Reader) (string, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", ErrEmptyDiffFile
+	}
+
+	var result strings.Builder
+	for _, fd := range fileDiffs {
+		content, err := diff.PrintFileDiff(ReverseFileDiff(fd))
+		if err != nil {
+			return "", fmt.Errorf("printing reversed diff for file %q: %w", fd.OrigName, err)
+		}
+		result.Write(content)
+	}
+	return result.String(), nil
+}
+
+// ReverseFileDiff returns a copy of fileDiff that undoes its changes:
+// file headers, line ranges and git extended headers are swapped,
+// and added lines become deleted lines and vice versa.
+// "Only in" entries are returned unchanged, since they don't tell which version
+// the file is in.
+func ReverseFileDiff(fileDiff *diff.FileDiff) *diff.FileDiff {
+	if fileDiff.NewName == "" {
+		return &diff.FileDiff{OrigName: fileDiff.OrigName}
+	}
+
+	reversed := &diff.FileDiff{
+		OrigName: fileDiff.NewName,
+		OrigTime: fileDiff.NewTime,
+		NewName:  fileDiff.OrigName,
+		NewTime:  fileDiff.OrigTime,
+		Extended: reversedExtended(fileDiff.Extended),
+	}
+	if fileDiff.Hunks != nil {
+		reversed.Hunks = make([]*diff.Hunk, 0, len(fileDiff.Hunks))
+	}
+	for _, h := range fileDiff.Hunks {
+		reversed.Hunks = append(reversed.Hunks, reversedHunk(h))
+	}
+	return reversed
+}
+
+// reversedHunk returns a copy of hunk with swapped line ranges and lines.
+func reversedHunk(hunk *diff.Hunk) *diff.Hunk {
+	reversed := &diff.Hunk{
+		OrigStartLine: hunk.NewStartLine,
+		OrigLines:     hunk.NewLines,
+		NewStartLine:  hunk.OrigStartLine,
+		NewLines:      hunk.OrigLines,
+		Section:       hunk.Section,
+		StartPosition: hunk.StartPosition,
+	}
+
+	lines, err := HunkLines(hunk)
+	if err != nil {
+		// Not a well-formed body, swap line prefixes only
+		reversed.Body = hunks.RevertedHunk(hunk).Body
+		return reversed
+	}
+
+	// Within every block of changed lines, deleted lines go first
+	var result, added []Line
+	for _, line := range lines {
+		switch line.Op {
+		case OpAdd:
+			line.Op = OpDelete
+			result = append(result, line)
+		case OpDelete:
+			line.Op = OpAdd
+			added = append(added, line)
+		default:
+			result = append(append(result, added...), line)
+			added = nil
+		}
+	}
+	result = append(result, added...)
+
+	if err := SetHunkLines(reversed, result); err != nil {
+		reversed.Body = hunks.RevertedHunk(hunk).Body
+	}
+	return reversed
+}
+
+// reversedExtended returns git extended header lines describing the reverse change.
+func reversedExtended(extended []string) []string {
+	if extended == nil {
+		return nil
+	}
+
+	swaps := [][2]string{
+		{"new file mode ", "deleted file mode "},
+		{"old mode ", "new mode "},
+		{"rename from ", "rename to "},
+		{"copy from ", "copy to "},
+	}
+
+	reversed := make([]string, len(extended))
+	for k, line := range extended {
+		reversed[k] = line
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			fields := strings.Fields(line)
+			if len(fields) == 4 {
+				from, to := fields[2], fields[3]
+				if strings.HasPrefix(from, "a/") && strings.HasPrefix(to, "b/") {
+					from, to = "a/"+to[2:], "b/"+from[2:]
+				} else {
+					from, to = to, from
+				}
+				reversed[k] = fmt.Sprintf("diff --git %s %s", from, to)
+			}
+		case strings.HasPrefix(line, "index "):
+			fields := strings.Fields(line)
+			if len(fields) < 2 {
+				break
+			}
+			if hashes := strings.Split(fields[1], ".."); len(hashes) == 2 {
+				fields[1] = hashes[1] + ".." + hashes[0]
+				reversed[k] = strings.Join(fields, " ")
+			}
+		default:
+			for _, swap := range swaps {
+				if strings.HasPrefix(line, swap[0]) {
+					reversed[k] = swap[1] + strings.TrimPrefix(line, swap[0])
+				} else if strings.HasPrefix(line, swap[1]) {
+					reversed[k] = swap[0] + strings.TrimPrefix(line, swap[1])
+				}
+			}
+		}
+	}
+
+	// Git lists the "from" side first
+	for k := 0; k+1 < len(reversed); k++ {
+		for _, swap := range swaps[1:] {
+			if strings.HasPrefix(reversed[k], swap[1]) && strings.HasPrefix(reversed[k+1], swap[0]) {
+				reversed[k], reversed[k+1] = reversed[k+1], reversed[k]
+			}
+		}
+	}
+	return reversedBinaryExtended(reversed)
+}
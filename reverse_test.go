@@ -0,0 +1,148 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var reverseTests = []struct {
+	name    string
+	patch   string
+	result  string
+	wantErr error
+}{
+	{
+		name: "changed lines",
+		patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,4 +1,5 @@
+ one
+-two
++TWO
++2
+ three
+ four
+@@ -10,2 +11,2 @@
+ ten
+-eleven
++ELEVEN
+`,
+		result: `--- b/file.txt
++++ a/file.txt
+@@ -1,5 +1,4 @@
+ one
+-TWO
+-2
++two
+ three
+ four
+@@ -11,2 +10,2 @@
+ ten
+-ELEVEN
++eleven
+`,
+	},
+	{
+		name: "added file",
+		patch: `--- /dev/null
++++ b/file.txt
+@@ -0,0 +1,2 @@
++one
++two
+`,
+		result: `--- b/file.txt
++++ /dev/null
+@@ -1,2 +0,0 @@
+-one
+-two
+`,
+	},
+	{
+		name: "no newline at end of file",
+		patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,2 +1,2 @@
+ one
+-two
+\ No newline at end of file
++TWO
+`,
+		result: `--- b/file.txt
++++ a/file.txt
+@@ -1,2 +1,2 @@
+ one
+-TWO
++two
+\ No newline at end of file
+`,
+	},
+	{
+		name: "git extended headers",
+		patch: `diff --git a/old.sh b/new.sh
+old mode 100644
+new mode 100755
+similarity index 90%
+rename from old.sh
+rename to new.sh
+index 1234567..89abcde
+--- a/old.sh
++++ b/new.sh
+@@ -1 +1 @@
+-echo old
++echo new
+`,
+		result: `diff --git a/new.sh b/old.sh
+old mode 100755
+new mode 100644
+similarity index 90%
+rename from new.sh
+rename to old.sh
+index 89abcde..1234567
+--- b/new.sh
++++ a/old.sh
+@@ -1,1 +1,1 @@
+-echo new
++echo old
+`,
+	},
+	{
+		name:   "only in",
+		patch:  "Only in dir: file.txt\n",
+		result: "Only in dir: file.txt\n",
+	},
+	{
+		name:    "empty patch",
+		patch:   "",
+		wantErr: ErrEmptyDiffFile,
+	},
+}
+
+func TestReverse(t *testing.T) {
+	for _, tt := range reverseTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := Reverse(strings.NewReader(tt.patch))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Reverse: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Reverse: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+
+			// Reversing twice gives back the same changes
+			twice, err := Reverse(strings.NewReader(currentResult))
+			if err != nil {
+				t.Fatalf("Reverse of reversed patch: got error %v; want error nil", err)
+			}
+			if again, _ := Reverse(strings.NewReader(twice)); again != currentResult {
+				t.Errorf("Reversing twice changed the result.\nGot:\n%s\nWant:\n%s\n", again, currentResult)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// RewriteRule is a regexp replacement applied to a patch by RewritePatch.
+type RewriteRule struct {
+	// Pattern selects the text to replace.
+	Pattern *regexp.Regexp
+	// Replacement is expanded as in regexp.Regexp.ReplaceAllString.
+	// A replacement containing newlines splits an added line into several lines.
+	Replacement string
+	// AddedLines enables the rule for lines added by the patch.
+	AddedLines bool
+	// Paths enables the rule for file names in headers.
+	Paths bool
+}
+
+// pathHeaderPrefixes are extended header lines which end with a file path.
+var pathHeaderPrefixes = []string{"rename from ", "rename to ", "copy from ", "copy to "}
+
+// RewritePatch applies rules to the added lines and file paths of patch
+// and returns the rewritten patch with recounted hunk headers.
+// Context and deleted lines are never rewritten, so the result still applies
+// to the same source as patch.
+func RewritePatch(patch io.Reader, rules []RewriteRule) (string, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	for _, fd := range fileDiffs {
+		if err := rewriteFileDiff(fd, rules); err != nil {
+			return "", fmt.Errorf("rewriting %q: %w", fd.OrigName, err)
+		}
+	}
+
+	result, err := diff.PrintMultiFileDiff(fileDiffs)
+	if err != nil {
+		return "", fmt.Errorf("printing rewritten patch: %w", err)
+	}
+	return string(result), nil
+}
+
+// rewriteFileDiff applies rules to fileDiff in place.
+func rewriteFileDiff(fileDiff *diff.FileDiff, rules []RewriteRule) error {
+	for _, rule := range rules {
+		if rule.Paths {
+			fileDiff.OrigName = rewritePath(fileDiff.OrigName, rule)
+			fileDiff.NewName = rewritePath(fileDiff.NewName, rule)
+			for k, header := range fileDiff.Extended {
+				fileDiff.Extended[k] = rewriteHeader(header, rule)
+			}
+		}
+
+		if !rule.AddedLines {
+			continue
+		}
+		rule := rule
+		for i := range fileDiff.Hunks {
+			if err := EditHunk(fileDiff, i, func(lines []Line) []Line {
+				return rewriteAddedLines(lines, rule)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewritePath applies rule to path, leaving /dev/null and empty names untouched.
+func rewritePath(path string, rule RewriteRule) string {
+	if path == "" || path == "/dev/null" {
+		return path
+	}
+	return rule.Pattern.ReplaceAllString(path, rule.Replacement)
+}
+
+// rewriteHeader applies rule to the paths mentioned in an extended header line.
+func rewriteHeader(header string, rule RewriteRule) string {
+	if strings.HasPrefix(header, "diff --git ") {
+		names := strings.SplitN(strings.TrimPrefix(header, "diff --git "), " ", 2)
+		if len(names) != 2 {
+			return header
+		}
+		return "diff --git " + rewritePath(names[0], rule) + " " + rewritePath(names[1], rule)
+	}
+	for _, prefix := range pathHeaderPrefixes {
+		if strings.HasPrefix(header, prefix) {
+			return prefix + rewritePath(strings.TrimPrefix(header, prefix), rule)
+		}
+	}
+	return header
+}
+
+// rewriteAddedLines returns lines with rule applied to added lines.
+func rewriteAddedLines(lines []Line, rule RewriteRule) []Line {
+	var result []Line
+	for _, line := range lines {
+		if line.Op != OpAdd {
+			result = append(result, line)
+			continue
+		}
+		rewritten := strings.Split(rule.Pattern.ReplaceAllString(line.Text, rule.Replacement), "\n")
+		for k, text := range rewritten {
+			result = append(result, Line{
+				Op:   OpAdd,
+				Text: text,
+				// Only the last of split lines inherits missing newline
+				NoNewline: line.NoNewline && k == len(rewritten)-1,
+			})
+		}
+	}
+	return result
+}
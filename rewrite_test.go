@@ -0,0 +1,113 @@
+package patchutils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+const rewriteTestDiff = `diff --git a/old/foo.go b/old/foo.go
+--- a/old/foo.go
++++ b/old/foo.go
+@@ -1,2 +1,3 @@
+ package foo
++var x = OldName()
+ func f() {}
+`
+
+var rewritePatchTests = []struct {
+	name    string
+	patch   string
+	rules   []RewriteRule
+	result  string
+	wantErr error
+}{
+	{
+		name:  "added lines",
+		patch: rewriteTestDiff,
+		rules: []RewriteRule{{
+			Pattern:     regexp.MustCompile(`OldName`),
+			Replacement: "NewName",
+			AddedLines:  true,
+		}},
+		result: `diff --git a/old/foo.go b/old/foo.go
+--- a/old/foo.go
++++ b/old/foo.go
+@@ -1,2 +1,3 @@
+ package foo
++var x = NewName()
+ func f() {}
+`,
+	},
+	{
+		name:  "paths",
+		patch: rewriteTestDiff,
+		rules: []RewriteRule{{
+			Pattern:     regexp.MustCompile(`/old/`),
+			Replacement: "/new/",
+			Paths:       true,
+		}},
+		result: `diff --git a/new/foo.go b/new/foo.go
+--- a/new/foo.go
++++ b/new/foo.go
+@@ -1,2 +1,3 @@
+ package foo
++var x = OldName()
+ func f() {}
+`,
+	},
+	{
+		name:  "split added line",
+		patch: rewriteTestDiff,
+		rules: []RewriteRule{{
+			Pattern:     regexp.MustCompile(`var x = (\w+)\(\)`),
+			Replacement: "var x = ${1}()\nvar y = ${1}()",
+			AddedLines:  true,
+		}},
+		result: `diff --git a/old/foo.go b/old/foo.go
+--- a/old/foo.go
++++ b/old/foo.go
+@@ -1,2 +1,4 @@
+ package foo
++var x = OldName()
++var y = OldName()
+ func f() {}
+`,
+	},
+	{
+		name:  "context lines untouched",
+		patch: rewriteTestDiff,
+		rules: []RewriteRule{{
+			Pattern:     regexp.MustCompile(`func`),
+			Replacement: "fn",
+			AddedLines:  true,
+		}},
+		result: rewriteTestDiff,
+	},
+	{
+		name:    "empty patch",
+		patch:   "",
+		wantErr: ErrEmptyDiffFile,
+	},
+}
+
+func TestRewritePatch(t *testing.T) {
+	for _, tt := range rewritePatchTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RewritePatch(strings.NewReader(tt.patch), tt.rules)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("RewritePatch: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("RewritePatch: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Patch mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+// Package schema holds the JSON schemas of the structured outputs of patchutils
+// and of its cli tool, so that consumers can validate them.
+//
+// Schemas are versioned together. Within a Version, fields are only added, never
+// removed, renamed or given another meaning, and consumers should ignore fields
+// they don't know. Any other change increases Version. Objects written at the top
+// level of outputs carry the version they follow in their "schema_version" field.
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Version is the version of the schemas, which outputs follow.
+const Version = 1
+
+// Names of schemas.
+const (
+	// Diff is the schema of file diffs written by patchutils.WriteJSON, the output
+	// of -format=json. Being an array, it carries no version.
+	Diff = "diff"
+	// ImpactReport is the schema of reports written by impact.Report.Write.
+	ImpactReport = "impact-report"
+	// HeatMap is the schema of heat maps written by patchutils.HeatMap.WriteJSON.
+	HeatMap = "heatmap"
+	// Error is the schema of errors the cli tool writes instead of JSON output.
+	Error = "error"
+)
+
+var schemas = map[string]string{
+	Diff: `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/google/go-patchutils/schema/v1/diff.json",
+  "title": "File diffs",
+  "type": "array",
+  "items": {
+    "type": "object",
+    "required": ["orig_name", "status"],
+    "properties": {
+      "orig_name": {"type": "string"},
+      "new_name": {"type": "string", "description": "Empty for files present in one version only."},
+      "status": {"enum": ["modified", "added", "deleted", "renamed", "binary", "only_in"]},
+      "extended": {"type": "array", "items": {"type": "string"}},
+      "hunks": {
+        "type": "array",
+        "items": {
+          "type": "object",
+          "required": ["orig_start", "orig_lines", "new_start", "new_lines", "lines"],
+          "properties": {
+            "orig_start": {"type": "integer"},
+            "orig_lines": {"type": "integer"},
+            "new_start": {"type": "integer"},
+            "new_lines": {"type": "integer"},
+            "section": {"type": "string"},
+            "lines": {
+              "type": "array",
+              "items": {
+                "type": "object",
+                "required": ["op", "text"],
+                "properties": {
+                  "op": {"enum": ["context", "add", "delete"]},
+                  "text": {"type": "string"},
+                  "no_newline": {"type": "boolean"}
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  }
+}
+`,
+	ImpactReport: `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/google/go-patchutils/schema/v1/impact-report.json",
+  "title": "Impact report",
+  "type": "object",
+  "required": ["schema_version", "files", "targets"],
+  "properties": {
+    "schema_version": {"const": 1},
+    "files": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["name", "added", "deleted"],
+        "properties": {
+          "name": {"type": "string"},
+          "added": {"type": "integer"},
+          "deleted": {"type": "integer"},
+          "only": {"type": "boolean"},
+          "targets": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    },
+    "targets": {"type": "array", "items": {"type": "string"}},
+    "unmapped": {"type": "array", "items": {"type": "string"}}
+  }
+}
+`,
+	HeatMap: `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/google/go-patchutils/schema/v1/heatmap.json",
+  "title": "Conflict heat map",
+  "type": "object",
+  "required": ["schema_version", "files", "regions"],
+  "definitions": {
+    "counts": {
+      "type": "object",
+      "required": ["hunks", "conflicts", "fuzzed", "moved"],
+      "properties": {
+        "hunks": {"type": "integer"},
+        "conflicts": {"type": "integer"},
+        "fuzzed": {"type": "integer"},
+        "moved": {"type": "integer"}
+      }
+    }
+  },
+  "properties": {
+    "schema_version": {"const": 1},
+    "files": {
+      "type": "array",
+      "items": {
+        "allOf": [{"$ref": "#/definitions/counts"}],
+        "required": ["file"],
+        "properties": {
+          "file": {"type": "string"}
+        }
+      }
+    },
+    "regions": {
+      "type": "array",
+      "items": {
+        "allOf": [{"$ref": "#/definitions/counts"}],
+        "required": ["file", "start_line", "end_line"],
+        "properties": {
+          "file": {"type": "string"},
+          "start_line": {"type": "integer"},
+          "end_line": {"type": "integer"},
+          "patches": {"type": "array", "items": {"type": "string"}}
+        }
+      }
+    }
+  }
+}
+`,
+	Error: `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "$id": "https://github.com/google/go-patchutils/schema/v1/error.json",
+  "title": "Error",
+  "type": "object",
+  "required": ["schema_version", "error"],
+  "properties": {
+    "schema_version": {"const": 1},
+    "error": {"type": "string"}
+  }
+}
+`,
+}
+
+// Names returns the sorted names of all schemas.
+func Names() []string {
+	var names []string
+	for name := range schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the schema called name, in JSON.
+func Get(name string) (string, error) {
+	s, ok := schemas[name]
+	if !ok {
+		return "", fmt.Errorf("%q: %w", name, ErrUnknownSchema)
+	}
+	return s, nil
+}
+
+// ErrUnknownSchema indicates that no schema has the requested name.
+var ErrUnknownSchema = errors.New("unknown schema")
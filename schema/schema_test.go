@@ -0,0 +1,107 @@
+// Tests are in package schema_test, since they check schemas against types of
+// packages importing schema.
+package schema_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-patchutils"
+	"github.com/google/go-patchutils/impact"
+	"github.com/google/go-patchutils/schema"
+)
+
+// schemaTypes are the types written as the outputs described by schemas.
+var schemaTypes = map[string]reflect.Type{
+	schema.Diff:         reflect.TypeOf([]patchutils.JSONFile{}),
+	schema.ImpactReport: reflect.TypeOf(impact.Report{}),
+	schema.HeatMap:      reflect.TypeOf(patchutils.HeatMap{}),
+}
+
+func TestSchemas(t *testing.T) {
+	for _, name := range schema.Names() {
+		s, err := schema.Get(name)
+		if err != nil {
+			t.Fatalf("Get(%q): got error %v; want error nil", name, err)
+		}
+		var root map[string]interface{}
+		if err := json.Unmarshal([]byte(s), &root); err != nil {
+			t.Errorf("Schema %q isn't valid JSON: %v", name, err)
+			continue
+		}
+		wantID := fmt.Sprintf("/schema/v%d/%s.json", schema.Version, name)
+		if id, _ := root["$id"].(string); !strings.HasSuffix(id, wantID) {
+			t.Errorf("Schema %q: $id %q doesn't end in %q", name, id, wantID)
+		}
+		if typ, ok := schemaTypes[name]; ok {
+			checkFields(t, name, typ, root, root)
+		}
+	}
+}
+
+// checkFields reports fields of typ written to JSON which schema s, part of
+// schema root, doesn't describe.
+func checkFields(t *testing.T, path string, typ reflect.Type, s, root map[string]interface{}) {
+	t.Helper()
+	switch typ.Kind() {
+	case reflect.Ptr:
+		checkFields(t, path, typ.Elem(), s, root)
+	case reflect.Slice:
+		items, ok := s["items"].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: schema has no items", path)
+			return
+		}
+		checkFields(t, path+"[]", typ.Elem(), items, root)
+	case reflect.Struct:
+		properties := schemaProperties(s, root)
+		for k := 0; k < typ.NumField(); k++ {
+			f := typ.Field(k)
+			if f.Anonymous {
+				checkFields(t, path, f.Type, s, root)
+				continue
+			}
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if name == "-" || f.PkgPath != "" {
+				continue
+			}
+			p, ok := properties[name].(map[string]interface{})
+			if !ok {
+				t.Errorf("%s: schema has no property %q", path, name)
+				continue
+			}
+			checkFields(t, path+"."+name, f.Type, p, root)
+		}
+	}
+}
+
+// schemaProperties returns the properties of s, including those of the
+// definitions of root it refers to with allOf.
+func schemaProperties(s, root map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	all, _ := s["allOf"].([]interface{})
+	for _, a := range all {
+		ref, _ := a.(map[string]interface{})["$ref"].(string)
+		definitions, _ := root["definitions"].(map[string]interface{})
+		if d, ok := definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{}); ok {
+			for name, p := range schemaProperties(d, root) {
+				properties[name] = p
+			}
+		}
+	}
+	own, _ := s["properties"].(map[string]interface{})
+	for name, p := range own {
+		properties[name] = p
+	}
+	return properties
+}
+
+func TestGetUnknown(t *testing.T) {
+	if _, err := schema.Get("nonexistent"); !errors.Is(err, schema.ErrUnknownSchema) {
+		t.Errorf("Get: got error %v; want error %v", err, schema.ErrUnknownSchema)
+	}
+}
@@ -0,0 +1,138 @@
+package patchutils
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// SectionPatterns map file extensions, like ".go", to regular expressions matching
+// lines starting sections of files with them, such as declarations of functions.
+// The last matching line before a hunk is written after the ranges of its header,
+// like diff -p does. The pattern of the empty extension is used for files with
+// other extensions; files without a pattern get no sections.
+type SectionPatterns map[string]*regexp.Regexp
+
+// DefaultSectionPatterns match declarations of functions and types in Go, Python
+// and JavaScript files, headings of Markdown files, and, like diff -p, lines
+// starting with a letter, '_' or '$' in other files.
+var DefaultSectionPatterns = SectionPatterns{
+	"":    regexp.MustCompile(`^[[:alpha:]_$]`),
+	".go": regexp.MustCompile(`^(func|type)[ \t]`),
+	".py": regexp.MustCompile(`^[ \t]*(class|def|async[ \t]+def)[ \t]`),
+	".js": regexp.MustCompile(`^[ \t]*((export[ \t]+)?(async[ \t]+)?function|class)[ \t]`),
+	".md": regexp.MustCompile(`^#{1,6}[ \t]`),
+}
+
+// sectionMaxLength is the maximum number of bytes of a section, like git uses.
+const sectionMaxLength = 80
+
+// String returns the patterns sorted by extension, so that they print the same
+// way for equal patterns, e.g. in keys of ResultCache.
+func (p SectionPatterns) String() string {
+	exts := make([]string, 0, len(p))
+	for ext := range p {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	parts := make([]string, len(exts))
+	for k, ext := range exts {
+		parts[k] = fmt.Sprintf("%q:%q", ext, p[ext])
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// pattern returns the pattern of the file at name, or nil if it has none.
+func (p SectionPatterns) pattern(name string) *regexp.Regexp {
+	if re, ok := p[path.Ext(name)]; ok {
+		return re
+	}
+	return p[""]
+}
+
+// setSections sets the sections of hunks of fd, which are ordered by their
+// original lines, to the last lines of origLines before them matched by the
+// pattern of fd.
+func (p SectionPatterns) setSections(fd *diff.FileDiff, origLines []string) {
+	re := p.pattern(fd.NewName)
+	if re == nil {
+		return
+	}
+	section, k := "", 0
+	for _, hunk := range fd.Hunks {
+		for ; k < len(origLines) && int32(k) < linesBeforeHunk(hunk); k++ {
+			if re.MatchString(origLines[k]) {
+				section = origLines[k]
+			}
+		}
+		hunk.Section = sectionText(section)
+	}
+}
+
+// setSectionsFromHunks sets the sections of hunks of fd without one to the last
+// lines before them matched by the pattern of fd, of those known from the new
+// lines of hunks of oldFileDiff. The original lines of fd are the new lines of
+// oldFileDiff.
+func (p SectionPatterns) setSectionsFromHunks(fd, oldFileDiff *diff.FileDiff) {
+	re := p.pattern(fd.NewName)
+	if re == nil {
+		return
+	}
+	type knownLine struct {
+		n    int32
+		text string
+	}
+	var known []knownLine
+	for _, hunk := range oldFileDiff.Hunks {
+		n := hunk.NewStartLine
+		for _, line := range hunks.Lines(hunk) {
+			if strings.HasPrefix(line, "-") {
+				continue
+			}
+			if len(line) > 0 && re.MatchString(line[1:]) {
+				known = append(known, knownLine{n, line[1:]})
+			}
+			n++
+		}
+	}
+	for _, hunk := range fd.Hunks {
+		if hunk.Section != "" {
+			continue
+		}
+		before := linesBeforeHunk(hunk)
+		for k := len(known) - 1; k >= 0; k-- {
+			if known[k].n <= before {
+				hunk.Section = sectionText(known[k].text)
+				break
+			}
+		}
+	}
+}
+
+// linesBeforeHunk returns the number of original lines before hunk. Hunks without
+// original lines start after the line they are numbered with.
+func linesBeforeHunk(hunk *diff.Hunk) int32 {
+	if hunk.OrigLines == 0 {
+		return hunk.OrigStartLine
+	}
+	return hunk.OrigStartLine - 1
+}
+
+// sectionText returns line as a section, without trailing whitespace and cut to
+// sectionMaxLength bytes, but not within a UTF-8 encoded character.
+func sectionText(line string) string {
+	line = strings.TrimRight(strings.TrimSuffix(line, hunks.NoNewlineSuffix), " \t\r")
+	if len(line) <= sectionMaxLength {
+		return line
+	}
+	cut := sectionMaxLength
+	for cut > 0 && line[cut]&0xC0 == 0x80 {
+		cut--
+	}
+	return strings.TrimRight(line[:cut], " \t")
+}
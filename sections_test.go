@@ -0,0 +1,105 @@
+package patchutils
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+var sectionTextTests = []struct {
+	line string
+	want string
+}{
+	{line: "func a() {", want: "func a() {"},
+	{line: "func a() {  \r", want: "func a() {"},
+	{line: "func a()" + hunks.NoNewlineSuffix, want: "func a()"},
+	{line: strings.Repeat("a", 100), want: strings.Repeat("a", sectionMaxLength)},
+	// Characters aren't cut
+	{line: strings.Repeat("a", sectionMaxLength-1) + "é", want: strings.Repeat("a", sectionMaxLength-1)},
+}
+
+func TestSectionText(t *testing.T) {
+	for _, tt := range sectionTextTests {
+		if got := sectionText(tt.line); got != tt.want {
+			t.Errorf("sectionText(%q) = %q; want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestSectionPatternsString(t *testing.T) {
+	p := SectionPatterns{".go": regexp.MustCompile(`^func`), "": regexp.MustCompile(`^\w`)}
+	want := `{"":"^\\w" ".go":"^func"}`
+	if got := p.String(); got != want {
+		t.Errorf("String() = %s; want %s", got, want)
+	}
+}
+
+func TestMixedModeSections(t *testing.T) {
+	oldSource := "package p\n\nfunc a() {\n\tx := 1\n\ty := 2\n\tz := 3\n\treturn x + y + z\n}\n" +
+		"\nfunc b() {\n\treturn 2\n}\n"
+	newSource := strings.Replace(oldSource, "return 2", "return 3", 1)
+	newSource = strings.Replace(newSource, "z := 3", "z := 4", 1)
+	noDiff := "--- f.go\n+++ f.go\n@@ -1 +1 @@\n-package p\n+package p\n"
+	want := "--- f.go\n+++ f.go\n@@ -5,3 +5,3 @@ func a() {\n \ty := 2\n-\tz := 3\n+\tz := 4\n \treturn x + y + z\n" +
+		"@@ -10,3 +10,3 @@ func a() {\n func b() {\n-\treturn 2\n+\treturn 3\n }\n"
+	result, err := MixedModeFileWithOptions(strings.NewReader(oldSource), strings.NewReader(newSource),
+		strings.NewReader(noDiff), strings.NewReader(noDiff),
+		MixedModeOptions{ContextLines: 1, Sections: DefaultSectionPatterns})
+	if err != nil {
+		t.Fatalf("MixedModeFile: got error %v; want error nil", err)
+	}
+	if result != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, want)
+	}
+}
+
+func TestInterDiffSections(t *testing.T) {
+	oldDiff := "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n package p\n-func a() {\n+func b() {\n \treturn 1\n"
+	newDiff := "--- f.go\n+++ f.go\n@@ -10,2 +10,2 @@\n-\tx := 1\n+\tx := 2\n \treturn x\n" +
+		"@@ -20,2 +20,2 @@ func c() {\n-\ty := 1\n+\ty := 2\n \treturn y\n"
+	for _, tt := range []struct {
+		name     string
+		sections SectionPatterns
+		want     string
+	}{
+		{name: "none", want: "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n package p\n-func b() {\n+func a() {\n \treturn 1\n" +
+			"@@ -10,2 +10,2 @@\n-\tx := 1\n+\tx := 2\n \treturn x\n" +
+			"@@ -20,2 +20,2 @@ func c() {\n-\ty := 1\n+\ty := 2\n \treturn y\n"},
+		// Hunks of the diffs keep their sections
+		{name: "default", sections: DefaultSectionPatterns,
+			want: "--- f.go\n+++ f.go\n@@ -1,3 +1,3 @@\n package p\n-func b() {\n+func a() {\n \treturn 1\n" +
+				"@@ -10,2 +10,2 @@ func b() {\n-\tx := 1\n+\tx := 2\n \treturn x\n" +
+				"@@ -20,2 +20,2 @@ func c() {\n-\ty := 1\n+\ty := 2\n \treturn y\n"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := InterDiffWithOptions(strings.NewReader(oldDiff), strings.NewReader(newDiff),
+				InterDiffOptions{Sections: tt.sections})
+			if err != nil {
+				t.Fatalf("InterDiff: got error %v; want error nil", err)
+			}
+			if result != tt.want {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetSectionsFromHunks(t *testing.T) {
+	oldFileDiff := &diff.FileDiff{NewName: "f.go", Hunks: []*diff.Hunk{
+		{OrigStartLine: 1, OrigLines: 2, NewStartLine: 1, NewLines: 2, Body: []byte("-func a() {\n+func b() {\n \treturn 1\n")},
+	}}
+	fd := &diff.FileDiff{NewName: "f.go", Hunks: []*diff.Hunk{
+		{OrigStartLine: 1, OrigLines: 1},
+		{OrigStartLine: 5, OrigLines: 1},
+		{OrigStartLine: 8, OrigLines: 1, Section: "func c() {"},
+	}}
+	DefaultSectionPatterns.setSectionsFromHunks(fd, oldFileDiff)
+	for k, want := range []string{"", "func b() {", "func c() {"} {
+		if got := fd.Hunks[k].Section; got != want {
+			t.Errorf("Section of hunk %d = %q; want %q", k, got, want)
+		}
+	}
+}
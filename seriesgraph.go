@@ -0,0 +1,120 @@
+package patchutils
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// SeriesGraphOptions configures PatchSeriesGraph.
+type SeriesGraphOptions struct {
+	// StripLevel is the number of leading path components removed from file names
+	// in the patches before they are compared, like patch -p.
+	StripLevel int
+}
+
+// SeriesGraph tells which patches of a series change the same files. Patches
+// linked by edges, directly or through others, can't be reordered or dropped
+// without looking at each other.
+type SeriesGraph struct {
+	// Patches are the names of the patches, in the order of the series.
+	Patches []string
+	// Edges link every pair of patches changing a common file, in the order of
+	// the series.
+	Edges []SeriesEdge
+}
+
+// SeriesEdge links two patches of a series changing the same files.
+type SeriesEdge struct {
+	// From and To are positions of the patches in the series, counted from 0,
+	// with From before To.
+	From, To int
+	// Files are the names of the files changed by both patches, sorted.
+	Files []string
+}
+
+// PatchSeriesGraph returns the graph of the patches of series linked by the files
+// they change. Renamed files count with both their old and new names.
+func PatchSeriesGraph(series []SeriesPatch, opts SeriesGraphOptions) (*SeriesGraph, error) {
+	g := &SeriesGraph{}
+	files := make([]map[string]bool, len(series))
+	for i, p := range series {
+		fileDiffs, err := readPatch(p.Patch)
+		if err != nil {
+			return nil, fmt.Errorf("parsing patch %q: %w", p.Name, err)
+		}
+		files[i] = make(map[string]bool)
+		for _, fd := range fileDiffs {
+			for _, name := range []string{fd.OrigName, fd.NewName} {
+				if name != "" && !isDevNull(name) {
+					files[i][stripPath(name, opts.StripLevel)] = true
+				}
+			}
+		}
+		g.Patches = append(g.Patches, p.Name)
+	}
+
+	for i := range series {
+		for j := i + 1; j < len(series); j++ {
+			var common []string
+			for name := range files[i] {
+				if files[j][name] {
+					common = append(common, name)
+				}
+			}
+			if len(common) == 0 {
+				continue
+			}
+			sort.Strings(common)
+			g.Edges = append(g.Edges, SeriesEdge{From: i, To: j, Files: common})
+		}
+	}
+	return g, nil
+}
+
+// WriteDOT writes g to w as an undirected graph in the DOT language of Graphviz,
+// with edges labeled by the names of the files.
+func (g *SeriesGraph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("graph series {\n")
+	for i, name := range g.Patches {
+		fmt.Fprintf(bw, "\tp%d [label=%s];\n", i, dotQuote(name))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "\tp%d -- p%d [label=%s];\n", e.From, e.To, dotQuote(strings.Join(e.Files, "\n")))
+	}
+	bw.WriteString("}\n")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing DOT: %w", err)
+	}
+	return nil
+}
+
+// WriteMermaid writes g to w as a Mermaid flowchart, with edges labeled by the
+// names of the files.
+func (g *SeriesGraph) WriteMermaid(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("graph LR\n")
+	for i, name := range g.Patches {
+		fmt.Fprintf(bw, "    p%d[\"%s\"]\n", i, mermaidEscape(name))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "    p%d ---|\"%s\"| p%d\n", e.From, mermaidEscape(strings.Join(e.Files, "<br>")), e.To)
+	}
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("writing Mermaid: %w", err)
+	}
+	return nil
+}
+
+// dotQuote returns s as a quoted DOT string, with newlines kept as line breaks of labels.
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+// mermaidEscape returns s with the characters ending Mermaid labels escaped as entities.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "|", "#124;").Replace(s)
+}
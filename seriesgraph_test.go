@@ -0,0 +1,111 @@
+package patchutils
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// seriesGraphPatches are a series of three patches: the first and the third
+// change b.txt, the second and the third change c.txt, renamed by the second.
+var seriesGraphPatches = []struct{ name, patch string }{
+	{
+		name: "1.patch",
+		patch: `--- a/a.txt
++++ b/a.txt
+@@ -1,1 +1,1 @@
+-a
++A
+--- a/b.txt
++++ b/b.txt
+@@ -1,1 +1,1 @@
+-b
++B
+`,
+	},
+	{
+		name: "2.patch",
+		patch: `diff --git a/c.txt b/d.txt
+similarity index 100%
+rename from c.txt
+rename to d.txt
+`,
+	},
+	{
+		name: "3 \"final\".patch",
+		patch: `--- a/b.txt
++++ b/b.txt
+@@ -1,1 +1,1 @@
+-B
++b
+--- /dev/null
++++ b/c.txt
+@@ -0,0 +1,1 @@
++c
+`,
+	},
+}
+
+func seriesGraph(t *testing.T) *SeriesGraph {
+	t.Helper()
+	var series []SeriesPatch
+	for _, p := range seriesGraphPatches {
+		series = append(series, SeriesPatch{Name: p.name, Patch: strings.NewReader(p.patch)})
+	}
+	g, err := PatchSeriesGraph(series, SeriesGraphOptions{StripLevel: 1})
+	if err != nil {
+		t.Fatalf("PatchSeriesGraph: got error %v; want error nil", err)
+	}
+	return g
+}
+
+func TestPatchSeriesGraph(t *testing.T) {
+	g := seriesGraph(t)
+	want := &SeriesGraph{
+		Patches: []string{"1.patch", "2.patch", "3 \"final\".patch"},
+		Edges: []SeriesEdge{
+			{From: 0, To: 2, Files: []string{"b.txt"}},
+			{From: 1, To: 2, Files: []string{"c.txt"}},
+		},
+	}
+	if !reflect.DeepEqual(g, want) {
+		t.Errorf("Graph mismatch.\nGot:\n%+v\nWant:\n%+v\n", g, want)
+	}
+}
+
+func TestSeriesGraphWrite(t *testing.T) {
+	g := seriesGraph(t)
+	g.Edges[0].Files = append(g.Edges[0].Files, "b|2.txt")
+
+	var dot bytes.Buffer
+	if err := g.WriteDOT(&dot); err != nil {
+		t.Fatalf("WriteDOT: got error %v; want error nil", err)
+	}
+	wantDOT := `graph series {
+	p0 [label="1.patch"];
+	p1 [label="2.patch"];
+	p2 [label="3 \"final\".patch"];
+	p0 -- p2 [label="b.txt\nb|2.txt"];
+	p1 -- p2 [label="c.txt"];
+}
+`
+	if dot.String() != wantDOT {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", dot.String(), wantDOT)
+	}
+
+	var mermaid bytes.Buffer
+	if err := g.WriteMermaid(&mermaid); err != nil {
+		t.Fatalf("WriteMermaid: got error %v; want error nil", err)
+	}
+	wantMermaid := `graph LR
+    p0["1.patch"]
+    p1["2.patch"]
+    p2["3 #quot;final#quot;.patch"]
+    p0 ---|"b.txt<br>b#124;2.txt"| p2
+    p1 ---|"c.txt"| p2
+`
+	if mermaid.String() != wantMermaid {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", mermaid.String(), wantMermaid)
+	}
+}
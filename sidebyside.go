@@ -0,0 +1,111 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-patchutils/textnorm"
+)
+
+// DefaultSideBySideWidth is the default width of side by side output, the one of diff -y.
+const DefaultSideBySideWidth = 130
+
+// SideBySide returns patch rendered in two columns like diff -y does: old lines
+// on the left and new lines on the right of a gutter marking changed lines with
+// "|", deleted lines with "<" and added lines with ">". Lines of both columns are
+// cut to fit into width characters, with tabs expanded. File headers, hunk headers
+// and other text outside of hunks are kept as they are. A width of 0 stands for
+// DefaultSideBySideWidth.
+func SideBySide(patch io.Reader, width int) (string, error) {
+	if width <= 0 {
+		width = DefaultSideBySideWidth
+	}
+	content, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return "", fmt.Errorf("reading patch: %w", err)
+	}
+
+	preamble, sections := splitPatch(string(content))
+	r := &sideBySideRenderer{column: (width - 3) / 2}
+	r.b.WriteString(preamble)
+	for _, section := range sections {
+		r.renderSection(section)
+	}
+	return r.b.String(), nil
+}
+
+// sideBySideRenderer renders file diffs in two columns.
+type sideBySideRenderer struct {
+	b strings.Builder
+	// column is the width of each of the columns
+	column int
+	// deleted and added are lines of the current change not rendered yet
+	deleted, added []string
+}
+
+// renderSection renders the text of a single file diff.
+func (r *sideBySideRenderer) renderSection(section string) {
+	inHunk := false
+	for _, line := range strings.Split(strings.TrimSuffix(section, "\n"), "\n") {
+		switch {
+		case hunkHeaderRegexp.MatchString(line):
+			r.flush()
+			inHunk = true
+			r.b.WriteString(line + "\n")
+		case !inHunk:
+			r.b.WriteString(line + "\n")
+		case strings.HasPrefix(line, "-"):
+			if len(r.added) > 0 {
+				// Deleted lines after added ones start a new change
+				r.flush()
+			}
+			r.deleted = append(r.deleted, line[1:])
+		case strings.HasPrefix(line, "+"):
+			r.added = append(r.added, line[1:])
+		case strings.HasPrefix(line, `\`):
+		default:
+			r.flush()
+			text := strings.TrimPrefix(line, " ")
+			r.row(text, " ", text)
+		}
+	}
+	r.flush()
+}
+
+// flush renders the lines of the current change, pairing deleted and added lines.
+func (r *sideBySideRenderer) flush() {
+	for k := 0; k < len(r.deleted) || k < len(r.added); k++ {
+		switch {
+		case k >= len(r.added):
+			r.row(r.deleted[k], "<", "")
+		case k >= len(r.deleted):
+			r.row("", ">", r.added[k])
+		default:
+			r.row(r.deleted[k], "|", r.added[k])
+		}
+	}
+	r.deleted, r.added = nil, nil
+}
+
+// row renders a line with left and right text separated by gutter.
+func (r *sideBySideRenderer) row(left, gutter, right string) {
+	left = fitColumn(left, r.column)
+	line := left + strings.Repeat(" ", r.column-utf8.RuneCountInString(left)) + " " + gutter
+	if right != "" {
+		line += " " + fitColumn(right, r.column)
+	}
+	// No trailing white space after lines of the left column only
+	r.b.WriteString(strings.TrimRight(line, " ") + "\n")
+}
+
+// fitColumn returns text with tabs expanded, cut to width characters.
+func fitColumn(text string, width int) string {
+	text = textnorm.ExpandTabs(text, 8)
+	if utf8.RuneCountInString(text) <= width {
+		return text
+	}
+	return string([]rune(text)[:width])
+}
@@ -0,0 +1,48 @@
+package patchutils
+
+import (
+	"strings"
+	"testing"
+)
+
+var sideBySideTests = []struct {
+	name   string
+	patch  string
+	width  int
+	result string
+}{
+	{
+		name:  "changes",
+		patch: "Only in dir: f\n--- a/x\n+++ b/x\n@@ -1,5 +1,5 @@\n one\n-two\n-three\n+TWO\n four\n+4.5\n five\n-six\n\\ No newline at end of file\n",
+		width: 23,
+		result: "Only in dir: f\n--- a/x\n+++ b/x\n@@ -1,5 +1,5 @@\n" +
+			"one          one\n" +
+			"two        | TWO\n" +
+			"three      <\n" +
+			"four         four\n" +
+			"           > 4.5\n" +
+			"five         five\n" +
+			"six        <\n",
+	},
+	{
+		name:  "long lines and tabs",
+		patch: "--- a/x\n+++ b/x\n@@ -1,1 +1,1 @@\n-\tabcdef\n+0123456789abc\n",
+		width: 23,
+		result: "--- a/x\n+++ b/x\n@@ -1,1 +1,1 @@\n" +
+			"        ab | 0123456789\n",
+	},
+}
+
+func TestSideBySide(t *testing.T) {
+	for _, tt := range sideBySideTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := SideBySide(strings.NewReader(tt.patch), tt.width)
+			if err != nil {
+				t.Fatalf("SideBySide: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
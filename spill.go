@@ -0,0 +1,92 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// spillStore keeps parts of a result until they are written: in memory while they
+// take at most limit bytes in total, and in temporary files beyond that, so that
+// huge results don't have to fit in memory. A limit of 0 keeps all parts in memory.
+// It is safe for concurrent use.
+type spillStore struct {
+	limit int64
+
+	mu       sync.Mutex
+	inMemory int64
+	// dir holds temporary files of spilled parts, it is created for the first one.
+	dir string
+}
+
+// spilledPart is a part of a result kept by a spillStore.
+type spilledPart struct {
+	content string
+	// file is the temporary file holding the part if it is spilled, or empty.
+	file string
+}
+
+// keep returns content kept until it is written by writeTo.
+func (s *spillStore) keep(content string) (spilledPart, error) {
+	s.mu.Lock()
+	if s.limit <= 0 || s.inMemory+int64(len(content)) <= s.limit {
+		s.inMemory += int64(len(content))
+		s.mu.Unlock()
+		return spilledPart{content: content}, nil
+	}
+	if s.dir == "" {
+		dir, err := ioutil.TempDir("", "patchutils-spill")
+		if err != nil {
+			s.mu.Unlock()
+			return spilledPart{}, fmt.Errorf("creating spill directory: %w", err)
+		}
+		s.dir = dir
+	}
+	dir := s.dir
+	s.mu.Unlock()
+
+	f, err := ioutil.TempFile(dir, "part")
+	if err != nil {
+		return spilledPart{}, fmt.Errorf("creating spill file: %w", err)
+	}
+	if _, err := io.WriteString(f, content); err != nil {
+		f.Close()
+		return spilledPart{}, fmt.Errorf("writing spill file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return spilledPart{}, fmt.Errorf("writing spill file: %w", err)
+	}
+	return spilledPart{file: f.Name()}, nil
+}
+
+// writeTo writes p to w and releases it.
+func (s *spillStore) writeTo(w io.Writer, p spilledPart) error {
+	if p.file == "" {
+		s.mu.Lock()
+		s.inMemory -= int64(len(p.content))
+		s.mu.Unlock()
+		_, err := io.WriteString(w, p.content)
+		return err
+	}
+
+	f, err := os.Open(p.file)
+	if err != nil {
+		return fmt.Errorf("opening spill file: %w", err)
+	}
+	defer os.Remove(p.file)
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// close removes temporary files of parts which weren't written.
+func (s *spillStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(s.dir)
+}
@@ -0,0 +1,64 @@
+package patchutils
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSpillStore(t *testing.T) {
+	store := &spillStore{limit: 4}
+	var parts []spilledPart
+	for _, content := range []string{"abc", "d", "efgh", "ij"} {
+		p, err := store.keep(content)
+		if err != nil {
+			t.Fatalf("keep(%q): got error %v; want error nil", content, err)
+		}
+		parts = append(parts, p)
+	}
+	if parts[0].file != "" || parts[1].file != "" {
+		t.Errorf("Parts within the limit were spilled: %+v", parts[:2])
+	}
+	if parts[2].file == "" || parts[3].file == "" {
+		t.Errorf("Parts beyond the limit weren't spilled: %+v", parts[2:])
+	}
+
+	var result strings.Builder
+	for _, p := range parts[:3] {
+		if err := store.writeTo(&result, p); err != nil {
+			t.Fatalf("writeTo: got error %v; want error nil", err)
+		}
+	}
+	if want := "abcdefgh"; result.String() != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result.String(), want)
+	}
+	if _, err := os.Stat(parts[2].file); !os.IsNotExist(err) {
+		t.Errorf("Spill file %q of a written part wasn't removed: %v", parts[2].file, err)
+	}
+
+	dir := store.dir
+	if err := store.close(); err != nil {
+		t.Fatalf("close: got error %v; want error nil", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Spill directory %q wasn't removed: %v", dir, err)
+	}
+}
+
+func TestSpillStoreInMemory(t *testing.T) {
+	store := &spillStore{}
+	p, err := store.keep(strings.Repeat("x", 1<<20))
+	if err != nil {
+		t.Fatalf("keep: got error %v; want error nil", err)
+	}
+	if p.file != "" {
+		t.Errorf("Part was spilled without a limit: %q", p.file)
+	}
+	if err := store.writeTo(ioutil.Discard, p); err != nil {
+		t.Fatalf("writeTo: got error %v; want error nil", err)
+	}
+	if err := store.close(); err != nil {
+		t.Fatalf("close: got error %v; want error nil", err)
+	}
+}
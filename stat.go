@@ -0,0 +1,135 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-patchutils/hunks"
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// FileStat is the number of lines added and deleted in a file by a diff.
+type FileStat struct {
+	Name    string
+	Added   int
+	Deleted int
+	// Only is set for files which are present in one version only,
+	// printed as "Only in" entries by InterDiff.
+	Only bool
+}
+
+// Stat returns the number of lines added and deleted in every file of patch,
+// in the order the files appear in patch.
+func Stat(patch io.Reader) ([]FileStat, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return nil, fmt.Errorf("parsing patch: %w", err)
+	}
+	return fileStats(fileDiffs), nil
+}
+
+// fileStats returns the number of lines added and deleted in every file of
+// fileDiffs, in order.
+func fileStats(fileDiffs []*diff.FileDiff) []FileStat {
+	stats := make([]FileStat, 0, len(fileDiffs))
+	for _, fd := range fileDiffs {
+		if fd.NewName == "" {
+			stats = append(stats, FileStat{Name: fd.OrigName, Only: true})
+			continue
+		}
+		stat := FileStat{Name: fd.NewName}
+		if isDevNull(fd.NewName) {
+			stat.Name = fd.OrigName
+		}
+		for _, h := range fd.Hunks {
+			added, deleted := hunks.CountLines(h)
+			stat.Added += added
+			stat.Deleted += deleted
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// InterDiffStat returns the number of lines added and deleted in every file of
+// the diff InterDiff returns for oldDiff and newDiff, in the same order.
+// Files are paired and merged the way InterDiff does, but lines are counted
+// as overlapping hunks are merged, without building the hunks of the result.
+func InterDiffStat(oldDiff, newDiff io.Reader) ([]FileStat, error) {
+	files, err := readInterDiffFiles(oldDiff, newDiff, 0, false)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := make([]FileStat, 0, len(files))
+	for _, f := range files {
+		if fd, _, ok := f.single(); ok {
+			stat := fileStats([]*diff.FileDiff{fd})[0]
+			if stat.Only {
+				stat.Name = onlyInName(stat.Name)
+			}
+			stats = append(stats, stat)
+			continue
+		}
+		if isBinaryFileDiff(f.oldFD) || isBinaryFileDiff(f.newFD) {
+			// Binary diffs have no lines
+			stats = append(stats, fileStats([]*diff.FileDiff{binaryInterFileDiff(f.oldFD, f.newFD)})...)
+			continue
+		}
+
+		stat := FileStat{Name: f.newFD.NewName}
+		if isDevNull(stat.Name) {
+			stat.Name = f.oldFD.NewName
+		}
+		stat.Added, stat.Deleted, err = hunks.InterFileStat(f.oldFD, f.newFD, nil)
+		if err != nil {
+			return nil, fmt.Errorf("merging diffs for file %q: %w", f.name, err)
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// onlyInName returns the name of file as printed in "Only in" entries.
+func onlyInName(name string) string {
+	return filepath.ToSlash(filepath.Join(filepath.Dir(name), filepath.Base(name)))
+}
+
+// FormatStat returns stats formatted like the output of diffstat: a line with the
+// number of changed lines of every file, followed by a summary line.
+func FormatStat(stats []FileStat) string {
+	width := 0
+	for _, s := range stats {
+		if !s.Only && len(s.Name) > width {
+			width = len(s.Name)
+		}
+	}
+
+	var b strings.Builder
+	var added, deleted int
+	for _, s := range stats {
+		if s.Only {
+			fmt.Fprintf(&b, " Only in %s: %s\n", filepath.ToSlash(filepath.Dir(s.Name)), filepath.Base(s.Name))
+			continue
+		}
+		fmt.Fprintf(&b, " %-*s | %d %s%s\n", width, s.Name, s.Added+s.Deleted,
+			strings.Repeat("+", s.Added), strings.Repeat("-", s.Deleted))
+		added += s.Added
+		deleted += s.Deleted
+	}
+	fmt.Fprintf(&b, " %d %s changed, %d %s(+), %d %s(-)\n",
+		len(stats), plural(len(stats), "file", "files"),
+		added, plural(added, "insertion", "insertions"),
+		deleted, plural(deleted, "deletion", "deletions"))
+	return b.String()
+}
+
+// plural returns one if n is 1, and other otherwise.
+func plural(n int, one, other string) string {
+	if n == 1 {
+		return one
+	}
+	return other
+}
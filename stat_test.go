@@ -0,0 +1,193 @@
+package patchutils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	patch := "--- a/foo.c\n+++ b/foo.c\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n+C\n c\n" +
+		"--- a/bar.c\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-x\n-y\n" +
+		"Only in dir: baz.c\n"
+	want := []FileStat{
+		{Name: "b/foo.c", Added: 2, Deleted: 1},
+		{Name: "a/bar.c", Deleted: 2},
+		{Name: "dir/baz.c", Only: true},
+	}
+
+	got, err := Stat(strings.NewReader(patch))
+	if err != nil {
+		t.Fatalf("Stat: got error %v; want error nil", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stat: got %+v; want %+v", got, want)
+	}
+}
+
+func TestInterDiffStat(t *testing.T) {
+	for _, tt := range interDiffFileTests {
+		t.Run(tt.resultFile, func(t *testing.T) {
+			oldDiff, err := os.Open(testFile(tt.diffAFile))
+			if err != nil {
+				t.Fatalf("Error opening %q: %v", tt.diffAFile, err)
+			}
+			defer oldDiff.Close()
+			newDiff, err := os.Open(testFile(tt.diffBFile))
+			if err != nil {
+				t.Fatalf("Error opening %q: %v", tt.diffBFile, err)
+			}
+			defer newDiff.Close()
+
+			got, err := InterDiffStat(oldDiff, newDiff)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("InterDiffStat: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InterDiffStat: got error %v; want error nil", err)
+			}
+
+			// Stats must agree with the printed result
+			result, err := ioutil.ReadFile(testFile(tt.resultFile))
+			if err != nil {
+				t.Fatalf("Error reading %q: %v", tt.resultFile, err)
+			}
+			want := resultStats(t, string(result))
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("InterDiffStat: got %+v; want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestInterDiffStatAddedDeleted(t *testing.T) {
+	oldDiff := "--- /dev/null\n+++ b/x.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n" +
+		"--- /dev/null\n+++ b/y.txt\n@@ -0,0 +1 @@\n+y\n" +
+		"--- a/v.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-v\n" +
+		"--- a/z.txt\n+++ b/z.txt\n@@ -1,2 +1,2 @@\n z\n-1\n+2\n"
+	newDiff := "--- /dev/null\n+++ b/w.txt\n@@ -0,0 +1 @@\n+w\n" +
+		"--- /dev/null\n+++ b/x.txt\n@@ -0,0 +1,2 @@\n+a\n+c\n" +
+		"--- a/u.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-u\n" +
+		"--- a/z.txt\n+++ b/z.txt\n@@ -1,2 +1,2 @@\n z\n-1\n+3\n"
+	want := []FileStat{
+		{Name: "a/u.txt", Deleted: 1},
+		{Name: "a/v.txt", Added: 1},
+		{Name: "b/z.txt", Added: 1, Deleted: 1},
+		{Name: "b/w.txt", Added: 1},
+		{Name: "b/x.txt", Added: 1, Deleted: 1},
+		{Name: "b/y.txt", Deleted: 1},
+	}
+
+	got, err := InterDiffStat(strings.NewReader(oldDiff), strings.NewReader(newDiff))
+	if err != nil {
+		t.Fatalf("InterDiffStat: got error %v; want error nil", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InterDiffStat: got %+v; want %+v", got, want)
+	}
+
+	// Stats must agree with the printed result
+	result, err := InterDiff(strings.NewReader(oldDiff), strings.NewReader(newDiff))
+	if err != nil {
+		t.Fatalf("InterDiff: got error %v; want error nil", err)
+	}
+	if resultStats := resultStats(t, result); !reflect.DeepEqual(got, resultStats) {
+		t.Errorf("InterDiffStat: got %+v; InterDiff result has %+v", got, resultStats)
+	}
+}
+
+var interDiffStatMixedTests = []struct {
+	name             string
+	oldDiff, newDiff string
+}{
+	{
+		name: "renamed in both",
+		oldDiff: "diff --git a/r.txt b/s.txt\nsimilarity index 80%\nrename from r.txt\nrename to s.txt\n" +
+			"--- a/r.txt\n+++ b/s.txt\n@@ -1,3 +1,3 @@\n r\n-1\n+2\n r\n" +
+			"diff --git a/m.txt b/m.txt\n--- a/m.txt\n+++ b/m.txt\n@@ -1,2 +1,2 @@\n m\n-1\n+2\n",
+		newDiff: "diff --git a/r.txt b/s.txt\nsimilarity index 80%\nrename from r.txt\nrename to s.txt\n" +
+			"--- a/r.txt\n+++ b/s.txt\n@@ -1,3 +1,4 @@\n r\n-1\n+3\n+4\n r\n" +
+			"diff --git a/a.txt b/a.txt\nnew file mode 100644\n--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+a\n" +
+			"diff --git a/m.txt b/m.txt\n--- a/m.txt\n+++ b/m.txt\n@@ -1,2 +1,2 @@\n m\n-1\n+3\n",
+	},
+	{
+		name: "renamed in one, deleted and added in the other",
+		oldDiff: "diff --git a/r.txt b/s.txt\nsimilarity index 80%\nrename from r.txt\nrename to s.txt\n" +
+			"--- a/r.txt\n+++ b/s.txt\n@@ -1,3 +1,3 @@\n r\n-1\n+2\n r\n" +
+			"diff --git a/d.txt b/d.txt\ndeleted file mode 100644\n--- a/d.txt\n+++ /dev/null\n@@ -1,2 +0,0 @@\n-d\n-e\n",
+		newDiff: "diff --git a/a.txt b/a.txt\nnew file mode 100644\n--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+a\n" +
+			"diff --git a/r.txt b/r.txt\ndeleted file mode 100644\n--- a/r.txt\n+++ /dev/null\n@@ -1,3 +0,0 @@\n-r\n-1\n-r\n" +
+			"diff --git a/s.txt b/s.txt\nnew file mode 100644\n--- /dev/null\n+++ b/s.txt\n@@ -0,0 +1,3 @@\n+r\n+3\n+r\n",
+	},
+}
+
+func TestInterDiffStatMixed(t *testing.T) {
+	for _, tt := range interDiffStatMixedTests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InterDiffStat(strings.NewReader(tt.oldDiff), strings.NewReader(tt.newDiff))
+			if err != nil {
+				t.Fatalf("InterDiffStat: got error %v; want error nil", err)
+			}
+			result, err := InterDiff(strings.NewReader(tt.oldDiff), strings.NewReader(tt.newDiff))
+			if err != nil {
+				t.Fatalf("InterDiff: got error %v; want error nil", err)
+			}
+			if want := resultStats(t, result); !reflect.DeepEqual(got, want) {
+				t.Errorf("InterDiffStat: got %+v; want %+v\nInterDiff result:\n%s", got, want, result)
+			}
+		})
+	}
+}
+
+// resultStats returns stats of a printed diff with lines counted in its text,
+// since go-diff joins lines followed by a "\ No newline at end of file" marker.
+func resultStats(t *testing.T, result string) []FileStat {
+	stats, err := Stat(strings.NewReader(result))
+	if err != nil {
+		t.Fatalf("Stat: got error %v; want error nil", err)
+	}
+
+	var counts [][2]int
+	for _, line := range strings.Split(result, "\n") {
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			counts = append(counts, [2]int{})
+		case strings.HasPrefix(line, "+++ "):
+		case strings.HasPrefix(line, "+"):
+			counts[len(counts)-1][0]++
+		case strings.HasPrefix(line, "-"):
+			counts[len(counts)-1][1]++
+		}
+	}
+
+	for k := range stats {
+		if stats[k].Only {
+			continue
+		}
+		stats[k].Added, stats[k].Deleted = counts[0][0], counts[0][1]
+		counts = counts[1:]
+	}
+	return stats
+}
+
+func TestFormatStat(t *testing.T) {
+	stats := []FileStat{
+		{Name: "foo.c", Added: 2, Deleted: 1},
+		{Name: "dir/bar.c", Deleted: 1},
+		{Name: "dir/baz.c", Only: true},
+	}
+	want := "" +
+		" foo.c     | 3 ++-\n" +
+		" dir/bar.c | 1 -\n" +
+		" Only in dir: baz.c\n" +
+		" 3 files changed, 2 insertions(+), 2 deletions(-)\n"
+	if got := FormatStat(stats); got != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+}
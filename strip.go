@@ -0,0 +1,50 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// StripDiff returns patch with n leading path components removed from its file
+// names, like patch -p does, so that the result applies with -p0. The names of git
+// "diff --git" headers are stripped too; /dev/null is left untouched.
+func StripDiff(patch io.Reader, n int) (string, error) {
+	fileDiffs, err := readPatch(patch)
+	if err != nil {
+		return "", fmt.Errorf("parsing patch: %w", err)
+	}
+	if len(fileDiffs) == 0 {
+		return "", fmt.Errorf("patch: %w", ErrEmptyDiffFile)
+	}
+
+	for _, fd := range fileDiffs {
+		stripFileDiff(fd, n)
+	}
+
+	result, err := diff.PrintMultiFileDiff(fileDiffs)
+	if err != nil {
+		return "", fmt.Errorf("printing stripped patch: %w", err)
+	}
+	return string(result), nil
+}
+
+// stripFileDiff removes n leading path components from the names of fd and of
+// its "diff --git" header, in place.
+func stripFileDiff(fd *diff.FileDiff, n int) {
+	stripFileDiffNames(fd, "", n, nil)
+	if n <= 0 || len(fd.Extended) == 0 || !strings.HasPrefix(fd.Extended[0], "diff --git ") {
+		return
+	}
+	// Both names of the git header are set, also for added and deleted files
+	origName, newName := fd.OrigName, fd.NewName
+	if isDevNull(origName) {
+		origName = newName
+	}
+	if isDevNull(newName) {
+		newName = origName
+	}
+	fd.Extended[0] = "diff --git " + origName + " " + newName
+}
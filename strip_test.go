@@ -0,0 +1,91 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+var stripDiffTests = []struct {
+	name    string
+	patch   string
+	n       int
+	result  string
+	wantErr error
+}{
+	{
+		name: "unified diff",
+		patch: `--- a/dir/file.txt
++++ b/dir/file.txt
+@@ -1,1 +1,1 @@
+-one
++ONE
+`,
+		n: 1,
+		result: `--- dir/file.txt
++++ dir/file.txt
+@@ -1,1 +1,1 @@
+-one
++ONE
+`,
+	},
+	{
+		name: "git diff adding a file",
+		patch: `diff --git a/src/new.go b/src/new.go
+new file mode 100644
+--- /dev/null
++++ b/src/new.go
+@@ -0,0 +1,1 @@
++package src
+`,
+		n: 2,
+		result: `diff --git new.go new.go
+new file mode 100644
+--- /dev/null
++++ new.go
+@@ -0,0 +1,1 @@
++package src
+`,
+	},
+	{
+		name: "no levels",
+		patch: `--- a/file.txt
++++ b/file.txt
+@@ -1,1 +1,1 @@
+-one
++ONE
+`,
+		result: `--- a/file.txt
++++ b/file.txt
+@@ -1,1 +1,1 @@
+-one
++ONE
+`,
+	},
+	{
+		name:    "empty patch",
+		patch:   "",
+		n:       1,
+		wantErr: ErrEmptyDiffFile,
+	},
+}
+
+func TestStripDiff(t *testing.T) {
+	for _, tt := range stripDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			currentResult, err := StripDiff(strings.NewReader(tt.patch), tt.n)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("StripDiff: got error %v; want error %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StripDiff: got error %v; want error nil", err)
+			}
+			if currentResult != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", currentResult, tt.result)
+			}
+		})
+	}
+}
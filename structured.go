@@ -0,0 +1,164 @@
+package patchutils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// InterDiffStructured is like InterDiff, returning the file diffs of the result
+// instead of their text. "Only in" entries have an empty NewName.
+func InterDiffStructured(oldDiff, newDiff io.Reader) ([]*diff.FileDiff, error) {
+	result, err := InterDiff(oldDiff, newDiff)
+	if err != nil {
+		return nil, err
+	}
+	fileDiffs, err := diff.NewMultiFileDiffReader(strings.NewReader(result)).ReadAllFiles()
+	if err != nil {
+		return nil, fmt.Errorf("parsing result: %w", err)
+	}
+	return fileDiffs, nil
+}
+
+// FileNote is an entry of the result of InterDiff which isn't a file diff:
+// a file present in one version only, printed as an "Only in" line.
+type FileNote struct {
+	// Path is the name of the file in the diff of Side.
+	Path string
+	Side Side
+}
+
+// String returns the note as InterDiff prints it, without line ending.
+func (n FileNote) String() string {
+	return strings.TrimSuffix(onlyIn(nil, n.Path, n.Side), "\n")
+}
+
+// InterDiffFiles is like InterDiff, returning the file diffs of the result and
+// the files present in one version only separately, each in the order of the result.
+func InterDiffFiles(oldDiff, newDiff io.Reader) ([]*diff.FileDiff, []FileNote, error) {
+	var notes []FileNote
+	opts := InterDiffOptions{OnlyInFormatter: func(dir, name string, side Side) string {
+		notes = append(notes, FileNote{Path: path.Join(dir, name), Side: side})
+		return ""
+	}}
+	result, err := InterDiffWithOptions(oldDiff, newDiff, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileDiffs, err := diff.NewMultiFileDiffReader(strings.NewReader(result)).ReadAllFiles()
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing result: %w", err)
+	}
+	return fileDiffs, notes, nil
+}
+
+// Statuses of files in JSON output.
+const (
+	FileModified = "modified"
+	FileAdded    = "added"
+	FileDeleted  = "deleted"
+	FileRenamed  = "renamed"
+	FileBinary   = "binary"
+	// FileOnlyIn is the status of "Only in" entries, files present in one version only.
+	FileOnlyIn = "only_in"
+)
+
+// JSONFile is the JSON form of a file diff.
+type JSONFile struct {
+	OrigName string `json:"orig_name"`
+	NewName  string `json:"new_name,omitempty"`
+	// Status is one of FileModified, FileAdded, FileDeleted, FileRenamed, FileBinary
+	// and FileOnlyIn.
+	Status   string     `json:"status"`
+	Extended []string   `json:"extended,omitempty"`
+	Hunks    []JSONHunk `json:"hunks,omitempty"`
+}
+
+// JSONHunk is the JSON form of a hunk.
+type JSONHunk struct {
+	OrigStart int32 `json:"orig_start"`
+	OrigLines int32 `json:"orig_lines"`
+	NewStart  int32 `json:"new_start"`
+	NewLines  int32 `json:"new_lines"`
+	// Section is the text after the ranges of the hunk header, such as a function name.
+	Section string     `json:"section,omitempty"`
+	Lines   []JSONLine `json:"lines"`
+}
+
+// JSONLine is the JSON form of a line of a hunk.
+type JSONLine struct {
+	// Op is "context", "add" or "delete".
+	Op        string `json:"op"`
+	Text      string `json:"text"`
+	NoNewline bool   `json:"no_newline,omitempty"`
+}
+
+// jsonOps are the names of LineOps in JSON output.
+var jsonOps = map[LineOp]string{OpContext: "context", OpAdd: "add", OpDelete: "delete"}
+
+// NewJSONFile returns the JSON form of fd.
+func NewJSONFile(fd *diff.FileDiff) (JSONFile, error) {
+	f := JSONFile{OrigName: fd.OrigName, NewName: fd.NewName, Extended: fd.Extended, Status: FileStatus(fd)}
+	for _, h := range fd.Hunks {
+		lines, err := HunkLines(h)
+		if err != nil {
+			return JSONFile{}, fmt.Errorf("hunk %s of %q: %w", hunkHeader(h), fd.OrigName, err)
+		}
+		jh := JSONHunk{
+			OrigStart: h.OrigStartLine,
+			OrigLines: h.OrigLines,
+			NewStart:  h.NewStartLine,
+			NewLines:  h.NewLines,
+			Section:   h.Section,
+			Lines:     make([]JSONLine, 0, len(lines)),
+		}
+		for _, l := range lines {
+			jh.Lines = append(jh.Lines, JSONLine{Op: jsonOps[l.Op], Text: l.Text, NoNewline: l.NoNewline})
+		}
+		f.Hunks = append(f.Hunks, jh)
+	}
+	return f, nil
+}
+
+// FileStatus returns the status of the file fd changes, one of FileModified,
+// FileAdded, FileDeleted, FileRenamed, FileBinary and FileOnlyIn.
+func FileStatus(fd *diff.FileDiff) string {
+	switch {
+	case fd.NewName == "":
+		return FileOnlyIn
+	case isDevNull(fd.OrigName):
+		return FileAdded
+	case isDevNull(fd.NewName):
+		return FileDeleted
+	case isBinaryFileDiff(fd):
+		return FileBinary
+	}
+	for _, line := range fd.Extended {
+		if strings.HasPrefix(line, "rename from ") {
+			return FileRenamed
+		}
+	}
+	return FileModified
+}
+
+// WriteJSON writes fileDiffs to w as a JSON array of JSONFile.
+func WriteJSON(w io.Writer, fileDiffs []*diff.FileDiff) error {
+	files := make([]JSONFile, 0, len(fileDiffs))
+	for _, fd := range fileDiffs {
+		f, err := NewJSONFile(fd)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(files); err != nil {
+		return fmt.Errorf("writing JSON: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package patchutils
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+func TestInterDiffStructured(t *testing.T) {
+	oldD, err := os.Open(testFile("s1_a_c.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldD.Close()
+	newD, err := os.Open(testFile("s1_a_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newD.Close()
+
+	fileDiffs, err := InterDiffStructured(oldD, newD)
+	if err != nil {
+		t.Fatalf("InterDiffStructured: got error %v; want error nil", err)
+	}
+
+	content, err := ioutil.ReadFile(testFile("s1_c_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := diff.ParseMultiFileDiff(content)
+	if err != nil {
+		t.Fatalf("Error parsing s1_c_d.diff: %v", err)
+	}
+	if !reflect.DeepEqual(fileDiffs, want) {
+		t.Errorf("File diffs mismatch.\nGot:\n%+v\nWant:\n%+v\n", fileDiffs, want)
+	}
+}
+
+func TestInterDiffFiles(t *testing.T) {
+	oldD, err := os.Open(testFile("s1_a_c.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer oldD.Close()
+	newD, err := os.Open(testFile("s1_a_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newD.Close()
+
+	fileDiffs, notes, err := InterDiffFiles(oldD, newD)
+	if err != nil {
+		t.Fatalf("InterDiffFiles: got error %v; want error nil", err)
+	}
+
+	wantNotes := []FileNote{
+		{Path: "source_1_c/file_1.txt", Side: OldSide},
+		{Path: "source_1_d/file_3.txt", Side: NewSide},
+	}
+	if !reflect.DeepEqual(notes, wantNotes) {
+		t.Errorf("Notes mismatch.\nGot:\n%+v\nWant:\n%+v\n", notes, wantNotes)
+	}
+	if got, want := notes[0].String(), "Only in source_1_c: file_1.txt"; got != want {
+		t.Errorf("FileNote.String() = %q; want %q", got, want)
+	}
+
+	content, err := ioutil.ReadFile(testFile("s1_c_d.diff"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := diff.ParseMultiFileDiff(content)
+	if err != nil {
+		t.Fatalf("Error parsing s1_c_d.diff: %v", err)
+	}
+	var wantFileDiffs []*diff.FileDiff
+	for _, fd := range want {
+		if fd.NewName != "" {
+			// "Only in" entries have no NewName
+			wantFileDiffs = append(wantFileDiffs, fd)
+		}
+	}
+	if len(fileDiffs) != len(wantFileDiffs) {
+		t.Fatalf("Got %d file diffs; want %d", len(fileDiffs), len(wantFileDiffs))
+	}
+	for k := range fileDiffs {
+		if fileDiffs[k].OrigName != wantFileDiffs[k].OrigName || !reflect.DeepEqual(fileDiffs[k].Hunks, wantFileDiffs[k].Hunks) {
+			t.Errorf("File diff %d mismatch.\nGot:\n%+v\nWant:\n%+v\n", k, fileDiffs[k], wantFileDiffs[k])
+		}
+	}
+}
+
+const structuredPatch = `Only in dir: f
+--- /dev/null
++++ b/new
+@@ -0,0 +1 @@
++x
+\ No newline at end of file
+diff --git a/old b/renamed
+similarity index 90%
+rename from old
+rename to renamed
+--- a/old
++++ b/renamed
+@@ -1,2 +1,2 @@ func f() {
+ a
+-b
++c
+`
+
+const structuredJSON = `[
+  {
+    "orig_name": "dir/f",
+    "status": "only_in"
+  },
+  {
+    "orig_name": "/dev/null",
+    "new_name": "b/new",
+    "status": "added",
+    "hunks": [
+      {
+        "orig_start": 0,
+        "orig_lines": 0,
+        "new_start": 1,
+        "new_lines": 1,
+        "lines": [
+          {
+            "op": "add",
+            "text": "x",
+            "no_newline": true
+          }
+        ]
+      }
+    ]
+  },
+  {
+    "orig_name": "a/old",
+    "new_name": "b/renamed",
+    "status": "renamed",
+    "extended": [
+      "diff --git a/old b/renamed",
+      "similarity index 90%",
+      "rename from old",
+      "rename to renamed"
+    ],
+    "hunks": [
+      {
+        "orig_start": 1,
+        "orig_lines": 2,
+        "new_start": 1,
+        "new_lines": 2,
+        "section": "func f() {",
+        "lines": [
+          {
+            "op": "context",
+            "text": "a"
+          },
+          {
+            "op": "delete",
+            "text": "b"
+          },
+          {
+            "op": "add",
+            "text": "c"
+          }
+        ]
+      }
+    ]
+  }
+]
+`
+
+func TestWriteJSON(t *testing.T) {
+	fileDiffs, err := diff.ParseMultiFileDiff([]byte(structuredPatch))
+	if err != nil {
+		t.Fatalf("Error parsing diff: %v", err)
+	}
+	var b bytes.Buffer
+	if err := WriteJSON(&b, fileDiffs); err != nil {
+		t.Fatalf("WriteJSON: got error %v; want error nil", err)
+	}
+	if b.String() != structuredJSON {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", b.String(), structuredJSON)
+	}
+}
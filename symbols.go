@@ -0,0 +1,215 @@
+package patchutils
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SymbolChangeKind tells how a top-level declaration changed.
+type SymbolChangeKind int
+
+const (
+	// SymbolAdded is a declaration present in the new version only.
+	SymbolAdded SymbolChangeKind = iota
+	// SymbolRemoved is a declaration present in the old version only.
+	SymbolRemoved
+	// SymbolModified is a declaration whose source text changed.
+	SymbolModified
+)
+
+// String returns "added", "removed" or "modified".
+func (k SymbolChangeKind) String() string {
+	switch k {
+	case SymbolAdded:
+		return "added"
+	case SymbolRemoved:
+		return "removed"
+	}
+	return "modified"
+}
+
+// SymbolChange is a change of a top-level declaration of a Go file.
+type SymbolChange struct {
+	File string
+	// Kind is the kind of the declaration: "func", "method", "type", "var" or "const".
+	Kind string
+	// Name is the name of the declaration, prefixed with the receiver type for methods,
+	// such as "T.String".
+	Name   string
+	Change SymbolChangeKind
+}
+
+// String returns c as "file: change kind name", such as "a.go: added func F".
+func (c SymbolChange) String() string {
+	return fmt.Sprintf("%s: %s %s %s", c.File, c.Change, c.Kind, c.Name)
+}
+
+// GoSymbolChanges returns the top-level declarations of Go file name added, removed
+// or modified between oldContent and newContent, sorted by name. Declarations are
+// modified if their source text changed, not counting their doc comments.
+func GoSymbolChanges(name, oldContent, newContent string) ([]SymbolChange, error) {
+	oldSymbols, err := goSymbols(name, oldContent)
+	if err != nil {
+		return nil, fmt.Errorf("parsing old version: %w", err)
+	}
+	newSymbols, err := goSymbols(name, newContent)
+	if err != nil {
+		return nil, fmt.Errorf("parsing new version: %w", err)
+	}
+
+	var changes []SymbolChange
+	for key, s := range oldSymbols {
+		n, ok := newSymbols[key]
+		switch {
+		case !ok:
+			changes = append(changes, SymbolChange{File: name, Kind: key.kind, Name: key.name, Change: SymbolRemoved})
+		case n != s:
+			changes = append(changes, SymbolChange{File: name, Kind: key.kind, Name: key.name, Change: SymbolModified})
+		}
+	}
+	for key := range newSymbols {
+		if _, ok := oldSymbols[key]; !ok {
+			changes = append(changes, SymbolChange{File: name, Kind: key.kind, Name: key.name, Change: SymbolAdded})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Name != changes[j].Name {
+			return changes[i].Name < changes[j].Name
+		}
+		return changes[i].Kind < changes[j].Kind
+	})
+	return changes, nil
+}
+
+// symbolKey identifies a top-level declaration of a Go file.
+type symbolKey struct {
+	kind, name string
+}
+
+// goSymbols returns the source text of every top-level declaration of Go file content.
+// Repeated names, such as of init functions, get their occurrence number appended.
+func goSymbols(name, content string) (map[symbolKey]string, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, content, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := make(map[symbolKey]string)
+	add := func(kind, name string, node ast.Node) {
+		key := symbolKey{kind, name}
+		for k := 2; ; k++ {
+			if _, ok := symbols[key]; !ok {
+				break
+			}
+			key.name = fmt.Sprintf("%s#%d", name, k)
+		}
+		symbols[key] = content[fset.Position(node.Pos()).Offset:fset.Position(node.End()).Offset]
+	}
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil || len(d.Recv.List) == 0 {
+				add("func", d.Name.Name, d)
+				continue
+			}
+			add("method", receiverTypeName(d.Recv.List[0].Type)+"."+d.Name.Name, d)
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					add("type", s.Name.Name, s)
+				case *ast.ValueSpec:
+					for _, n := range s.Names {
+						add(d.Tok.String(), n.Name, s)
+					}
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// receiverTypeName returns the name of the type of a method receiver, without
+// pointer and type parameters.
+func receiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return receiverTypeName(t.X)
+	case *ast.ParenExpr:
+		return receiverTypeName(t.X)
+	case *ast.IndexExpr:
+		return receiverTypeName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return "?"
+}
+
+// SymbolSummary collects changes of top-level declarations of Go files compared
+// in mixed mode. It is safe for concurrent use.
+type SymbolSummary struct {
+	mu      sync.Mutex
+	changes []SymbolChange
+	// errs holds errors parsing files, by file name.
+	errs map[string]error
+}
+
+// NewSymbolSummary returns an empty SymbolSummary.
+func NewSymbolSummary() *SymbolSummary {
+	return &SymbolSummary{errs: make(map[string]error)}
+}
+
+// add adds the changes of Go file name between oldContent and newContent.
+// Files which aren't Go files are skipped.
+func (s *SymbolSummary) add(name, oldContent, newContent string) {
+	if s == nil || !strings.HasSuffix(name, ".go") {
+		return
+	}
+	changes, err := GoSymbolChanges(name, oldContent, newContent)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.errs[name] = err
+		return
+	}
+	s.changes = append(s.changes, changes...)
+}
+
+// Changes returns the changes collected, sorted by file.
+func (s *SymbolSummary) Changes() []SymbolChange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes := append([]SymbolChange(nil), s.changes...)
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].File < changes[j].File
+	})
+	return changes
+}
+
+// String returns the changes collected, a line per change, followed by a line
+// per file which couldn't be parsed.
+func (s *SymbolSummary) String() string {
+	var b strings.Builder
+	for _, c := range s.Changes() {
+		fmt.Fprintln(&b, c)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.errs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s: not parsed: %v\n", name, s.errs[name])
+	}
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package patchutils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const symbolsOld = `package p
+
+// A is a constant.
+const A = 1
+
+var x, y int
+
+type T struct{}
+
+func (t *T) Get() int { return 1 }
+
+func init() {}
+
+func init() { x = 1 }
+
+func Removed() {}
+`
+
+const symbolsNew = `package p
+
+// A is an important constant.
+const A = 1
+
+var x, y int = 0, 1
+
+type T struct{ n int }
+
+func (t *T) Get() int { return 1 }
+
+func (t T) Put(n int) {}
+
+func init() {}
+
+func init() { x = 2 }
+`
+
+func TestGoSymbolChanges(t *testing.T) {
+	changes, err := GoSymbolChanges("p.go", symbolsOld, symbolsNew)
+	if err != nil {
+		t.Fatalf("GoSymbolChanges: got error %v; want error nil", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"p.go: removed func Removed",
+		"p.go: modified type T",
+		"p.go: added method T.Put",
+		"p.go: modified func init#2",
+		"p.go: modified var x",
+		"p.go: modified var y",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestMixedModeSymbols(t *testing.T) {
+	summary := NewSymbolSummary()
+	oldDiff := "--- a/p.go\n+++ b/p.go\n@@ -1,3 +1,3 @@\n package p\n \n-func F() {}\n+func F() { g() }\n"
+	newDiff := "--- a/p.go\n+++ b/p.go\n@@ -3,1 +3,2 @@\n func F() {}\n+func G() {}\n"
+	source := "package p\n\nfunc F() {}\n"
+	_, err := MixedModeFileWithOptions(strings.NewReader(source), strings.NewReader(source),
+		strings.NewReader(oldDiff), strings.NewReader(newDiff), MixedModeOptions{Symbols: summary})
+	if err != nil {
+		t.Fatalf("MixedModeFileWithOptions: got error %v; want error nil", err)
+	}
+	want := "b/p.go: modified func F\nb/p.go: added func G\n"
+	if got := summary.String(); got != want {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", got, want)
+	}
+}
+
+func TestSymbolSummaryNotParsed(t *testing.T) {
+	summary := NewSymbolSummary()
+	summary.add("broken.go", "package p\n", "package p\nfunc {\n")
+	summary.add("notes.txt", "a\n", "b\n")
+	if got := summary.String(); !strings.HasPrefix(got, "broken.go: not parsed: ") || strings.Count(got, "\n") != 1 {
+		t.Errorf("String: got %q; want a line for broken.go only", got)
+	}
+}
@@ -0,0 +1,131 @@
+// Package textnorm normalizes line endings and whitespace of text,
+// so content produced by different editors and platforms can be compared.
+package textnorm
+
+import (
+	"bytes"
+	"strings"
+)
+
+// Options configures which normalizations are applied.
+// The zero value leaves text unchanged.
+type Options struct {
+	// Newlines converts "\r\n" (windows) and "\r" (mac) line endings into "\n" (unix).
+	Newlines bool
+	// TrailingSpace removes spaces and tabs at the end of every line.
+	TrailingSpace bool
+	// TabWidth, if positive, expands tabs into spaces up to the next multiple of TabWidth.
+	TabWidth int
+}
+
+// IsZero reports whether opts leaves text unchanged.
+func (opts Options) IsZero() bool {
+	return opts == Options{}
+}
+
+// Newlines normalizes "\r\n" and "\r" line endings in d into "\n".
+func Newlines(d []byte) []byte {
+	// replace CR LF \r\n (windows) with LF \n (unix)
+	d = bytes.Replace(d, []byte{13, 10}, []byte{10}, -1)
+	// replace CF \r (mac) with LF \n (unix)
+	d = bytes.Replace(d, []byte{13}, []byte{10}, -1)
+	return d
+}
+
+// Bytes returns d normalized according to opts.
+func Bytes(d []byte, opts Options) []byte {
+	if opts.IsZero() {
+		return d
+	}
+	return []byte(String(string(d), opts))
+}
+
+// String returns s normalized according to opts.
+func String(s string, opts Options) string {
+	if opts.Newlines {
+		s = string(Newlines([]byte(s)))
+	}
+	if !opts.TrailingSpace && opts.TabWidth <= 0 {
+		return s
+	}
+
+	lines := strings.Split(s, "\n")
+	for k := range lines {
+		lines[k] = Line(lines[k], opts)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Line returns a single line, without line ending, normalized according to opts.
+// Newlines option removes a "\r" left at its end by splitting "\r\n" line endings
+// on "\n".
+func Line(line string, opts Options) string {
+	if opts.Newlines {
+		line = strings.TrimSuffix(line, "\r")
+	}
+	if opts.TabWidth > 0 {
+		line = ExpandTabs(line, opts.TabWidth)
+	}
+	if opts.TrailingSpace {
+		line = strings.TrimRight(line, " \t")
+	}
+	return line
+}
+
+// ExpandTabs replaces tabs in line with spaces up to the next multiple of width.
+func ExpandTabs(line string, width int) string {
+	if width <= 0 || !strings.Contains(line, "\t") {
+		return line
+	}
+
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := width - column%width
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+// Ignore configures which differences of lines are ignored when lines are compared,
+// like the options of diff(1) with the same meaning. Unlike Options it never
+// changes text, lines which compare equal keep their original content.
+// The zero value ignores nothing.
+type Ignore struct {
+	// SpaceChange ignores changes in the amount of whitespace and whitespace at the
+	// end of lines, like diff -b.
+	SpaceChange bool
+	// AllSpace ignores all whitespace, like diff -w.
+	AllSpace bool
+	// BlankLines ignores changes which only insert or delete blank lines, like diff -B.
+	// It applies to groups of changed lines, not to single lines compared by Key.
+	BlankLines bool
+}
+
+// Key returns the form of line compared under ig: lines with the same key are
+// equal for it.
+func (ig Ignore) Key(line string) string {
+	switch {
+	case ig.AllSpace:
+		return strings.Join(strings.Fields(line), "")
+	case ig.SpaceChange:
+		// Leading whitespace still differs from none
+		key := strings.Join(strings.Fields(line), " ")
+		if key != "" && strings.TrimLeft(line, " \t\v\f\r") != line {
+			key = " " + key
+		}
+		return key
+	}
+	return line
+}
+
+// IsBlank reports whether line is empty or consists of whitespace only.
+func IsBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
@@ -0,0 +1,114 @@
+package textnorm
+
+import "testing"
+
+var stringTests = []struct {
+	name   string
+	input  string
+	opts   Options
+	result string
+}{
+	{
+		name:   "zero options",
+		input:  "a \r\nb\t\r\n",
+		result: "a \r\nb\t\r\n",
+	},
+	{
+		name:   "newlines",
+		input:  "a\r\nb\rc\n",
+		opts:   Options{Newlines: true},
+		result: "a\nb\nc\n",
+	},
+	{
+		name:   "trailing space",
+		input:  "a \t\nb\n  \n",
+		opts:   Options{TrailingSpace: true},
+		result: "a\nb\n\n",
+	},
+	{
+		name:   "trailing space with windows newlines",
+		input:  "a \r\nb\t\r\n",
+		opts:   Options{Newlines: true, TrailingSpace: true},
+		result: "a\nb\n",
+	},
+	{
+		name:   "tabs",
+		input:  "\ta\n12\tb\n1234\tc\n",
+		opts:   Options{TabWidth: 4},
+		result: "    a\n12  b\n1234    c\n",
+	},
+}
+
+func TestString(t *testing.T) {
+	for _, tt := range stringTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := String(tt.input, tt.opts); got != tt.result {
+				t.Errorf("String(%q): got %q; want %q", tt.input, got, tt.result)
+			}
+			if got := string(Bytes([]byte(tt.input), tt.opts)); got != tt.result {
+				t.Errorf("Bytes(%q): got %q; want %q", tt.input, got, tt.result)
+			}
+		})
+	}
+}
+
+func TestLineNewlines(t *testing.T) {
+	if got := Line("a \r", Options{Newlines: true}); got != "a " {
+		t.Errorf("Line: got %q; want %q", got, "a ")
+	}
+	if got := Line("a \r", Options{}); got != "a \r" {
+		t.Errorf("Line with zero options: got %q; want %q", got, "a \r")
+	}
+}
+
+var ignoreKeyTests = []struct {
+	name  string
+	a, b  string
+	ig    Ignore
+	equal bool
+}{
+	{
+		name:  "nothing ignored",
+		a:     "a b",
+		b:     "a  b",
+		equal: false,
+	},
+	{
+		name:  "space change",
+		a:     "\ta  b \t",
+		b:     " a\tb",
+		ig:    Ignore{SpaceChange: true},
+		equal: true,
+	},
+	{
+		name:  "space change keeps leading space",
+		a:     " a",
+		b:     "a",
+		ig:    Ignore{SpaceChange: true},
+		equal: false,
+	},
+	{
+		name:  "space change keeps spaces within words",
+		a:     "a b",
+		b:     "ab",
+		ig:    Ignore{SpaceChange: true},
+		equal: false,
+	},
+	{
+		name:  "all space",
+		a:     " a b\t",
+		b:     "ab",
+		ig:    Ignore{AllSpace: true},
+		equal: true,
+	},
+}
+
+func TestIgnoreKey(t *testing.T) {
+	for _, tt := range ignoreKeyTests {
+		t.Run(tt.name, func(t *testing.T) {
+			if equal := tt.ig.Key(tt.a) == tt.ig.Key(tt.b); equal != tt.equal {
+				t.Errorf("Key(%q) == Key(%q): got %v; want %v", tt.a, tt.b, equal, tt.equal)
+			}
+		})
+	}
+}
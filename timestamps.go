@@ -0,0 +1,55 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// TimestampMode tells how timestamps of file headers of results, which are taken
+// from the diffs compared, are written.
+type TimestampMode int
+
+const (
+	// TimestampsKeep writes timestamps as they are in the diffs.
+	TimestampsKeep TimestampMode = iota
+	// TimestampsOmit writes file headers without timestamps.
+	TimestampsOmit
+	// TimestampsEpoch writes timestamps as the Unix epoch in UTC, so that results
+	// don't depend on when the diffs were made, but keep their format.
+	TimestampsEpoch
+)
+
+// ParseTimestampMode returns the TimestampMode named name, "keep", "omit" or "epoch".
+func ParseTimestampMode(name string) (TimestampMode, error) {
+	switch name {
+	case "keep":
+		return TimestampsKeep, nil
+	case "omit":
+		return TimestampsOmit, nil
+	case "epoch":
+		return TimestampsEpoch, nil
+	}
+	return 0, fmt.Errorf("%q: %w", name, ErrUnknownTimestampMode)
+}
+
+// apply sets the timestamps of fd as configured by m.
+func (m TimestampMode) apply(fd *diff.FileDiff) {
+	switch m {
+	case TimestampsOmit:
+		fd.OrigTime, fd.NewTime = nil, nil
+	case TimestampsEpoch:
+		epoch := time.Unix(0, 0).UTC()
+		if fd.OrigTime != nil {
+			fd.OrigTime = &epoch
+		}
+		if fd.NewTime != nil {
+			fd.NewTime = &epoch
+		}
+	}
+}
+
+// ErrUnknownTimestampMode indicates that a name of TimestampMode isn't known.
+var ErrUnknownTimestampMode = errors.New("unknown timestamp mode")
@@ -0,0 +1,71 @@
+package patchutils
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	timestampsOldDiff = "--- f\t2021-03-04 05:06:07.000000000 +0100\n+++ f\t2021-03-04 05:06:08.000000000 +0100\n" +
+		"@@ -1,1 +1,1 @@\n-a\n+b\n"
+	timestampsNewDiff = "--- f\t2022-03-04 05:06:07.000000000 +0100\n+++ f\t2022-03-04 05:06:09.000000000 +0100\n" +
+		"@@ -1,1 +1,1 @@\n-a\n+c\n"
+)
+
+var timestampModeTests = []struct {
+	mode   TimestampMode
+	result string
+}{
+	{
+		mode: TimestampsKeep,
+		result: "--- f\t2021-03-04 05:06:08.000000000 +0100\n+++ f\t2022-03-04 05:06:09.000000000 +0100\n" +
+			"@@ -1,1 +1,1 @@\n-b\n+c\n",
+	},
+	{
+		mode:   TimestampsOmit,
+		result: "--- f\n+++ f\n@@ -1,1 +1,1 @@\n-b\n+c\n",
+	},
+	{
+		mode: TimestampsEpoch,
+		result: "--- f\t1970-01-01 00:00:00.000000000 +0000\n+++ f\t1970-01-01 00:00:00.000000000 +0000\n" +
+			"@@ -1,1 +1,1 @@\n-b\n+c\n",
+	},
+}
+
+func TestInterDiffTimestamps(t *testing.T) {
+	for _, tt := range timestampModeTests {
+		result, err := InterDiffWithOptions(strings.NewReader(timestampsOldDiff), strings.NewReader(timestampsNewDiff),
+			InterDiffOptions{Timestamps: tt.mode})
+		if err != nil {
+			t.Fatalf("InterDiffWithOptions: got error %v; want error nil", err)
+		}
+		if result != tt.result {
+			t.Errorf("Result mismatch for mode %d.\nGot:\n%s\nWant:\n%s\n", tt.mode, result, tt.result)
+		}
+	}
+}
+
+func TestMixedModeTimestamps(t *testing.T) {
+	for _, tt := range timestampModeTests {
+		result, err := MixedModeFileWithOptions(strings.NewReader("a\n"), strings.NewReader("a\n"),
+			strings.NewReader(timestampsOldDiff), strings.NewReader(timestampsNewDiff), MixedModeOptions{Timestamps: tt.mode})
+		if err != nil {
+			t.Fatalf("MixedModeFile: got error %v; want error nil", err)
+		}
+		if result != tt.result {
+			t.Errorf("Result mismatch for mode %d.\nGot:\n%s\nWant:\n%s\n", tt.mode, result, tt.result)
+		}
+	}
+}
+
+func TestParseTimestampMode(t *testing.T) {
+	for name, want := range map[string]TimestampMode{"keep": TimestampsKeep, "omit": TimestampsOmit, "epoch": TimestampsEpoch} {
+		if mode, err := ParseTimestampMode(name); err != nil || mode != want {
+			t.Errorf("ParseTimestampMode(%q) = %d, %v; want %d, nil", name, mode, err, want)
+		}
+	}
+	if _, err := ParseTimestampMode("now"); !errors.Is(err, ErrUnknownTimestampMode) {
+		t.Errorf("ParseTimestampMode: got error %v; want error %v", err, ErrUnknownTimestampMode)
+	}
+}
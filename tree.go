@@ -0,0 +1,223 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// treeFile is the patched state of a file in a patchTree.
+type treeFile struct {
+	content string
+	// mode holds permission bits to set, 0 keeps the current ones.
+	mode    os.FileMode
+	deleted bool
+}
+
+// patchTree applies FileDiffs to a tree of files, keeping the results in memory,
+// so nothing is changed in the underlying tree unless all FileDiffs apply.
+type patchTree struct {
+	// read returns the content of a file of the underlying tree,
+	// or an error satisfying os.IsNotExist if there is no such file.
+	read func(name string) (string, error)
+	// strip is the number of leading path components removed from names in FileDiffs.
+	strip int
+	opts  ApplyOptions
+
+	files map[string]*treeFile
+	// names lists files in the order they were first changed in.
+	names []string
+}
+
+// newPatchTree returns a patchTree on top of a tree, accessed with read.
+func newPatchTree(read func(name string) (string, error), strip int, opts ApplyOptions) *patchTree {
+	return &patchTree{
+		read:  read,
+		strip: strip,
+		opts:  opts,
+		files: make(map[string]*treeFile),
+	}
+}
+
+// lookup returns the current state of file name, or nil if it doesn't exist.
+func (t *patchTree) lookup(name string) (*treeFile, error) {
+	if f, ok := t.files[name]; ok {
+		if f.deleted {
+			return nil, nil
+		}
+		return f, nil
+	}
+
+	content, err := t.read(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading %q: %w", name, err)
+	}
+	return &treeFile{content: content}, nil
+}
+
+// set records the new state of file name.
+func (t *patchTree) set(name string, f *treeFile) {
+	if _, ok := t.files[name]; !ok {
+		t.names = append(t.names, name)
+	}
+	t.files[name] = f
+}
+
+// apply applies fd to the tree.
+func (t *patchTree) apply(fd *diff.FileDiff) error {
+	if fd.NewName == "" {
+		return fmt.Errorf("%q: 'Only in' entries can't be applied", fd.OrigName)
+	}
+
+	origName, err := t.name(fd.OrigName)
+	if err != nil {
+		return err
+	}
+	newName, err := t.name(fd.NewName)
+	if err != nil {
+		return err
+	}
+	mode := extendedMode(fd.Extended)
+
+	switch {
+	case isDevNull(origName):
+		// File is added
+		current, err := t.lookup(newName)
+		if err != nil {
+			return err
+		}
+		if current != nil {
+			return fmt.Errorf("adding %q: %w", newName, ErrFileExists)
+		}
+		if err := t.checkCaseCollision(newName); err != nil {
+			return fmt.Errorf("adding %q: %w", newName, err)
+		}
+		content, err := applyToSource("", fd, t.opts)
+		if err != nil {
+			return fmt.Errorf("adding %q: %w", newName, err)
+		}
+		t.set(newName, &treeFile{content: content, mode: mode})
+
+	case isDevNull(newName):
+		// File is deleted
+		current, err := t.lookup(origName)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("deleting %q: %w", origName, ErrFileNotFound)
+		}
+		if len(fd.Hunks) > 0 {
+			// Deleted content must match the file
+			content, err := applyToSource(current.content, fd, t.opts)
+			if err != nil {
+				return fmt.Errorf("deleting %q: %w", origName, err)
+			}
+			if content != "" {
+				return fmt.Errorf("deleting %q: file has more content than the diff deletes: %w",
+					origName, ErrContentMismatch)
+			}
+		}
+		t.set(origName, &treeFile{deleted: true})
+
+	default:
+		current, err := t.lookup(origName)
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return fmt.Errorf("patching %q: %w", origName, ErrFileNotFound)
+		}
+		content, err := applyToSource(current.content, fd, t.opts)
+		if err != nil {
+			return fmt.Errorf("patching %q: %w", origName, err)
+		}
+		if mode == 0 {
+			mode = current.mode
+		}
+		if newName != origName {
+			// File is renamed
+			t.set(origName, &treeFile{deleted: true})
+			if err := t.checkCaseCollision(newName); err != nil {
+				return fmt.Errorf("renaming %q: %w", origName, err)
+			}
+		}
+		t.set(newName, &treeFile{content: content, mode: mode})
+	}
+	return nil
+}
+
+// checkQuota returns a *QuotaError if writing the changed files of the tree
+// exceeds quota.
+func (t *patchTree) checkQuota(quota Quota) error {
+	usage := quotaUsage{quota: quota}
+	for _, name := range t.names {
+		f := t.files[name]
+		if f.deleted {
+			continue
+		}
+		_, err := t.read(name)
+		if err := usage.add(name, int64(len(f.content)), os.IsNotExist(err)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// name returns the cleaned name of a file in the tree for a name from a FileDiff.
+func (t *patchTree) name(diffName string) (string, error) {
+	if isDevNull(diffName) {
+		return diffName, nil
+	}
+	name := path.Clean(stripPath(diffName, t.strip))
+	if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("%q: %w", diffName, ErrUnsafePath)
+	}
+	if err := checkPortableName(name, t.opts); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// checkCaseCollision returns an error wrapping ErrCaseCollision if names are
+// checked and another file of the tree has name in another case.
+func (t *patchTree) checkCaseCollision(name string) error {
+	if !portableNames(t.opts) {
+		return nil
+	}
+	for _, other := range t.names {
+		if other != name && !t.files[other].deleted && strings.EqualFold(other, name) {
+			return fmt.Errorf("%q and %q: %w", other, name, ErrCaseCollision)
+		}
+	}
+	return nil
+}
+
+// extendedMode returns permission bits set by git extended headers, or 0 if there are none.
+func extendedMode(extended []string) os.FileMode {
+	for _, header := range extended {
+		for _, prefix := range []string{"new file mode ", "new mode "} {
+			if strings.HasPrefix(header, prefix) {
+				mode, err := strconv.ParseUint(strings.TrimPrefix(header, prefix), 8, 32)
+				if err == nil {
+					return os.FileMode(mode).Perm()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// ErrFileExists indicates that a diff adds a file which already exists.
+var ErrFileExists = errors.New("file already exists")
+
+// ErrUnsafePath indicates that a diff refers to a file outside of the tree it is applied to.
+var ErrUnsafePath = errors.New("path outside of tree")
@@ -0,0 +1,24 @@
+package patchutils
+
+import (
+	"os"
+	"testing"
+)
+
+var extendedModeTests = []struct {
+	extended []string
+	mode     os.FileMode
+}{
+	{extended: nil, mode: 0},
+	{extended: []string{"new file mode 100755", "index 0000000..e69de29"}, mode: 0755},
+	{extended: []string{"old mode 100644", "new mode 100600"}, mode: 0600},
+	{extended: []string{"new file mode bogus"}, mode: 0},
+}
+
+func TestExtendedMode(t *testing.T) {
+	for _, tt := range extendedModeTests {
+		if got := extendedMode(tt.extended); got != tt.mode {
+			t.Errorf("extendedMode(%q): got %v; want %v", tt.extended, got, tt.mode)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package patchutils
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// UnwrapDiff returns patch with the damage done by mail clients repaired as far as
+// possible, like unwrapdiff: lines of hunks wrapped at 72 or 80 columns are joined
+// again, and empty lines within hunks, context lines whose trailing space was
+// stripped, get it back. The numbers of lines of hunk headers tell which lines are
+// part of a hunk, so a line is joined to the one before it if it isn't a valid hunk
+// line or if the hunk has no room left for it. Joined lines are separated by a
+// space unless the first one ends with one, as mail clients wrap at whitespace.
+// Lines outside hunks are left as they are.
+func UnwrapDiff(patch io.Reader) (string, error) {
+	content, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return "", err
+	}
+	text := string(content)
+	trailingNewline := strings.HasSuffix(text, "\n")
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+
+	var result []string
+	// origLeft and newLeft are the numbers of lines of the current hunk not seen yet
+	var origLeft, newLeft int
+	inHunk := false
+	for k := 0; k < len(lines); k++ {
+		line := strings.TrimSuffix(lines[k], "\r")
+		if !inHunk {
+			m := hunkRangesRegexp.FindStringSubmatch(line)
+			if m == nil {
+				result = append(result, lines[k])
+				continue
+			}
+			origLeft, newLeft = hunkRangeLines(m[2]), hunkRangeLines(m[4])
+			inHunk = origLeft > 0 || newLeft > 0
+			// Long sections after the ranges are wrapped too
+			for k+1 < len(lines) && wrappedLine(lines[k+1], -1, -1) {
+				k++
+				line = joinWrapped(line, lines[k])
+			}
+			result = append(result, line)
+			continue
+		}
+
+		if line == "" {
+			// Context line with its trailing space stripped
+			line = " "
+		}
+		switch line[0] {
+		case ' ':
+			origLeft--
+			newLeft--
+		case '-':
+			origLeft--
+		case '+':
+			newLeft--
+		case '\\':
+		default:
+			// The hunk is cut short: the line is read again as one outside hunks
+			inHunk = false
+			k--
+			continue
+		}
+		for k+1 < len(lines) && wrappedLine(lines[k+1], origLeft, newLeft) {
+			k++
+			line = joinWrapped(line, lines[k])
+		}
+		result = append(result, line)
+		inHunk = origLeft > 0 || newLeft > 0 || k+1 < len(lines) && strings.HasPrefix(lines[k+1], `\`)
+	}
+
+	unwrapped := strings.Join(result, "\n")
+	if trailingNewline {
+		unwrapped += "\n"
+	}
+	return unwrapped, nil
+}
+
+// unwrapHeaderPrefixes start lines which are never wrapped parts of hunk lines.
+var unwrapHeaderPrefixes = []string{"@@ ", "diff ", "Index: ", "Only in ", "Binary files ", "index ",
+	"new file mode ", "deleted file mode ", "old mode ", "new mode ", "similarity index ",
+	"rename from ", "rename to ", "copy from ", "copy to ", "GIT binary patch", "==="}
+
+// wrappedLine reports whether line is the wrapped rest of the hunk line before it,
+// after which the hunk has origLeft original and newLeft new lines left, or -1 for
+// lines which are no hunk lines. It is if it starts like no hunk line does, or if
+// the hunk has no room for it, unless the hunk is complete and it starts another
+// part of the patch.
+func wrappedLine(line string, origLeft, newLeft int) bool {
+	line = strings.TrimSuffix(line, "\r")
+	if line == "" {
+		return false
+	}
+	for _, prefix := range unwrapHeaderPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return false
+		}
+	}
+	switch line[0] {
+	case ' ':
+		return (origLeft == 0) != (newLeft == 0)
+	case '-':
+		return origLeft == 0 && newLeft > 0
+	case '+':
+		return newLeft == 0 && origLeft > 0
+	case '\\':
+		return false
+	}
+	return true
+}
+
+// joinWrapped joins line with rest, the part wrapped after it by a mail client at
+// whitespace.
+func joinWrapped(line, rest string) string {
+	rest = strings.TrimSuffix(rest, "\r")
+	if strings.HasSuffix(line, " ") || strings.HasSuffix(line, "\t") {
+		return line + rest
+	}
+	return line + " " + rest
+}
@@ -0,0 +1,54 @@
+package patchutils
+
+import (
+	"strings"
+	"testing"
+)
+
+var unwrapDiffTests = []struct {
+	name   string
+	patch  string
+	result string
+}{
+	{
+		name:   "intact",
+		patch:  "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		result: "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+	},
+	{
+		name: "wrapped added line",
+		patch: "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+if err := run(ctx, opts); err != nil {\n" +
+			"return fmt.Errorf(\"running: %w\", err)\n c\n",
+		result: "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n" +
+			"+if err := run(ctx, opts); err != nil { return fmt.Errorf(\"running: %w\", err)\n c\n",
+	},
+	{
+		name:   "wrapped line starting like a deleted line",
+		patch:  "--- a/f\n+++ b/f\n@@ -1,2 +1,3 @@\n a\n-b\n+x = y \n-1\n+z\n",
+		result: "--- a/f\n+++ b/f\n@@ -1,2 +1,3 @@\n a\n-b\n+x = y -1\n+z\n",
+	},
+	{
+		name:   "stripped context line",
+		patch:  "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n\n-b\n+B\n--- a/g\n+++ b/g\n@@ -1 +1 @@\n-g\n+G\n",
+		result: "--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n \n-b\n+B\n--- a/g\n+++ b/g\n@@ -1 +1 @@\n-g\n+G\n",
+	},
+	{
+		name:   "wrapped section",
+		patch:  "--- a/f\n+++ b/f\n@@ -1 +1 @@ func long(\nargs)\n-b\n+B\n",
+		result: "--- a/f\n+++ b/f\n@@ -1 +1 @@ func long( args)\n-b\n+B\n",
+	},
+}
+
+func TestUnwrapDiff(t *testing.T) {
+	for _, tt := range unwrapDiffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := UnwrapDiff(strings.NewReader(tt.patch))
+			if err != nil {
+				t.Fatalf("UnwrapDiff: got error %v; want error nil", err)
+			}
+			if result != tt.result {
+				t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, tt.result)
+			}
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package patchutils
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProblemKind tells what is wrong with a patch.
+type ProblemKind int
+
+const (
+	// ProblemBadHunkHeader is a hunk header without valid ranges.
+	ProblemBadHunkHeader ProblemKind = iota
+	// ProblemBadHunkCount is a hunk with more lines than its header counts,
+	// or with other numbers of original and new lines.
+	ProblemBadHunkCount
+	// ProblemTruncatedHunk is a hunk with fewer lines than its header counts,
+	// e.g. of a patch cut short.
+	ProblemTruncatedHunk
+	// ProblemMissingHeader is a hunk without ---/+++ file headers before it, or
+	// a --- line without a +++ line after it.
+	ProblemMissingHeader
+	// ProblemMixedPrefixes is a file diff with names prefixed by a/ and b/ like
+	// in diffs made by git and names without them in the same patch.
+	ProblemMixedPrefixes
+	// ProblemOverlappingHunks is a hunk starting before the end of the previous
+	// hunk of the same file diff.
+	ProblemOverlappingHunks
+)
+
+var problemKindNames = []string{"bad hunk header", "bad hunk count", "truncated hunk", "missing header",
+	"mixed path prefixes", "overlapping hunks"}
+
+func (k ProblemKind) String() string {
+	if k < 0 || int(k) >= len(problemKindNames) {
+		return fmt.Sprintf("ProblemKind(%d)", int(k))
+	}
+	return problemKindNames[k]
+}
+
+// Problem is a defect of a patch found by Validate.
+type Problem struct {
+	// Line is the line of the patch the problem is found at, counted from 1.
+	Line int
+	// File is the name of the file of the file diff with the problem, as given
+	// in its +++ line, or in its --- line for deleted files, if it is known.
+	File string
+	// Kind tells what is wrong.
+	Kind ProblemKind
+	// Message describes the problem.
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", p.Line, p.File, p.Message)
+}
+
+// hunkRangesRegexp matches the ranges of a hunk header, with the start lines and
+// the optional numbers of lines.
+var hunkRangesRegexp = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Validate returns the problems of patch, a unified diff of one or more files,
+// which would make functions of this package fail or give unexpected results,
+// in the order of their lines, or none for a valid patch. Unlike the parser of
+// diffs, it goes on after problems, and tells the lines they are at. Text
+// outside of file diffs, such as commit messages, is ignored.
+func Validate(patch io.Reader) []Problem {
+	content, err := ioutil.ReadAll(patch)
+	if err != nil {
+		return []Problem{{Kind: ProblemTruncatedHunk, Message: fmt.Sprintf("reading patch: %v", err)}}
+	}
+	v := &validator{lines: strings.SplitAfter(string(content), "\n")}
+	if v.lines[len(v.lines)-1] == "" {
+		v.lines = v.lines[:len(v.lines)-1]
+	}
+	v.run()
+	if !v.seenFile && len(v.problems) == 0 {
+		v.problems = append(v.problems, Problem{Line: 1, Kind: ProblemMissingHeader, Message: "patch has no file diffs"})
+	}
+	return v.problems
+}
+
+// validator keeps the state of Validate while going through the lines of a patch.
+type validator struct {
+	lines    []string
+	problems []Problem
+	seenFile bool
+
+	// file is the name of the current file diff, and headers whether it has
+	// ---/+++ lines.
+	file    string
+	headers bool
+	// git tells whether the names of the first file diff have a/ and b/ prefixes,
+	// gitSet whether it is known.
+	git, gitSet bool
+	// prevEnd is the line after the original lines of the previous hunk of the
+	// file, or 0 before its first hunk.
+	prevEnd int
+	// origLeft and newLeft are the numbers of lines the current hunk still
+	// counts, and hunkLine is the line of its header.
+	origLeft, newLeft, hunkLine int
+	// skipping is set after a bad hunk count, until the next header, so that it
+	// is reported once.
+	skipping bool
+}
+
+func (v *validator) report(k int, kind ProblemKind, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{Line: k + 1, File: v.file, Kind: kind, Message: fmt.Sprintf(format, args...)})
+}
+
+// endHunk reports the current hunk as truncated at line k if it counts more lines.
+func (v *validator) endHunk(k int) {
+	if v.origLeft > 0 || v.newLeft > 0 {
+		v.report(k, ProblemTruncatedHunk, "hunk at line %d ends %d original and %d new lines early",
+			v.hunkLine+1, v.origLeft, v.newLeft)
+	}
+	v.origLeft, v.newLeft = 0, 0
+}
+
+func (v *validator) run() {
+	for k := 0; k < len(v.lines); k++ {
+		line := v.lines[k]
+		inHunk := v.origLeft > 0 || v.newLeft > 0
+		isFileHeader := strings.HasPrefix(line, "--- ") && k+1 < len(v.lines) && strings.HasPrefix(v.lines[k+1], "+++ ")
+		// Deleted lines may look like file headers, unless the hunk counts no more
+		// of them or a hunk header follows
+		startsFile := isFileHeader && (v.origLeft == 0 || k+2 < len(v.lines) && strings.HasPrefix(v.lines[k+2], "@@ "))
+		switch {
+		case inHunk && isHunkBodyLine(line) && !startsFile:
+			v.hunkBodyLine(k, line)
+		case strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "Only in "):
+			v.endHunk(k)
+			v.skipping = false
+			v.file, v.headers, v.prevEnd = "", false, 0
+			v.seenFile = true
+		case isFileHeader:
+			v.endHunk(k)
+			v.skipping = false
+			v.fileHeaders(k)
+			k++
+		case strings.HasPrefix(line, "--- ") && !inHunk:
+			v.endHunk(k)
+			v.skipping = false
+			v.file, v.headers, v.prevEnd = "", false, 0
+			v.report(k, ProblemMissingHeader, "--- line isn't followed by a +++ line")
+		case strings.HasPrefix(line, "@@ "):
+			v.endHunk(k)
+			v.skipping = false
+			v.hunkHeader(k, line)
+		case inHunk:
+			v.endHunk(k)
+		case v.skipping:
+		case v.headers && (strings.HasPrefix(line, "+") || strings.HasPrefix(line, " ") ||
+			strings.HasPrefix(line, "-") && line != "-- \n" && line != "--\n"):
+			// Lines right after a hunk, unlike a signature of git format-patch
+			v.report(k, ProblemBadHunkCount, "hunk at line %d has more lines than its header counts", v.hunkLine+1)
+			v.skipping = true
+		}
+	}
+	v.endHunk(len(v.lines))
+}
+
+// isHunkBodyLine reports whether line may be a line of a hunk body.
+func isHunkBodyLine(line string) bool {
+	return line == "\n" || strings.HasPrefix(line, " ") || strings.HasPrefix(line, "+") ||
+		strings.HasPrefix(line, "-") || strings.HasPrefix(line, `\`)
+}
+
+// hunkBodyLine counts line k, a line of the body of the current hunk.
+func (v *validator) hunkBodyLine(k int, line string) {
+	switch {
+	case strings.HasPrefix(line, `\`):
+		return
+	case strings.HasPrefix(line, "+"):
+		v.newLeft--
+	case strings.HasPrefix(line, "-"):
+		v.origLeft--
+	default:
+		v.origLeft--
+		v.newLeft--
+	}
+	switch {
+	case v.origLeft < 0:
+		v.report(k, ProblemBadHunkCount, "hunk at line %d has more original lines than its header counts", v.hunkLine+1)
+	case v.newLeft < 0:
+		v.report(k, ProblemBadHunkCount, "hunk at line %d has more new lines than its header counts", v.hunkLine+1)
+	default:
+		return
+	}
+	v.origLeft, v.newLeft = 0, 0
+	v.skipping = true
+}
+
+// fileHeaders checks the ---/+++ lines at k.
+func (v *validator) fileHeaders(k int) {
+	origName := headerName(strings.TrimPrefix(v.lines[k], "--- "))
+	newName := headerName(strings.TrimPrefix(v.lines[k+1], "+++ "))
+	v.file, v.headers, v.prevEnd, v.seenFile = newName, true, 0, true
+	if isDevNull(newName) {
+		v.file = origName
+	}
+
+	origGit, newGit := strings.HasPrefix(origName, "a/"), strings.HasPrefix(newName, "b/")
+	switch {
+	case isDevNull(origName) && isDevNull(newName):
+		return
+	case isDevNull(origName):
+		origGit = newGit
+	case isDevNull(newName):
+		newGit = origGit
+	}
+	if origGit != newGit {
+		v.report(k, ProblemMixedPrefixes, "names %q and %q differ in a/ and b/ prefixes", origName, newName)
+		return
+	}
+	if !v.gitSet {
+		v.git, v.gitSet = origGit, true
+		return
+	}
+	switch {
+	case origGit && !v.git:
+		v.report(k, ProblemMixedPrefixes, "names have a/ and b/ prefixes, unlike those of the first file diff")
+	case !origGit && v.git:
+		v.report(k, ProblemMixedPrefixes, "names lack a/ and b/ prefixes, unlike those of the first file diff")
+	}
+}
+
+// headerName returns the name of a ---/+++ line without its prefix, dropping the
+// timestamp after a tab.
+func headerName(s string) string {
+	s = strings.TrimRight(s, "\r\n")
+	if i := strings.Index(s, "\t"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+// hunkHeader checks the hunk header at k and starts its hunk.
+func (v *validator) hunkHeader(k int, line string) {
+	if !v.headers {
+		v.report(k, ProblemMissingHeader, "hunk has no ---/+++ file headers before it")
+	}
+	m := hunkRangesRegexp.FindStringSubmatch(line)
+	if m == nil {
+		v.report(k, ProblemBadHunkHeader, "malformed hunk header %q", strings.TrimRight(line, "\n"))
+		v.skipping = true
+		return
+	}
+	origStart, _ := strconv.Atoi(m[1])
+	v.hunkLine = k
+	v.origLeft, v.newLeft = hunkRangeLines(m[2]), hunkRangeLines(m[4])
+	start := origStart
+	if v.origLeft == 0 {
+		// Lines are added after origStart
+		start++
+	}
+	if start < v.prevEnd {
+		v.report(k, ProblemOverlappingHunks, "hunk starts at original line %d, before the end of the previous hunk at line %d",
+			start, v.prevEnd)
+	}
+	if end := start + v.origLeft; end > v.prevEnd {
+		v.prevEnd = end
+	}
+}
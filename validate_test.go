@@ -0,0 +1,95 @@
+package patchutils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var validateTests = []struct {
+	name  string
+	patch string
+	// want are the problems as "line kind"
+	want []string
+}{
+	{
+		name:  "valid",
+		patch: "From: someone\n\n--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n-a\n+b\n c\n@@ -5 +5,0 @@\n-e\n-- \n2.30.0\n",
+	},
+	{
+		name:  "deleted line looking like a header",
+		patch: "--- a.txt\n+++ a.txt\n@@ -1,2 +1 @@\n--- x\n++++ y\n-z\n",
+	},
+	{
+		name:  "added and deleted files",
+		patch: "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+a\n--- a/b.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-b\n",
+	},
+	{
+		name:  "no file diffs",
+		patch: "just text\n",
+		want:  []string{"1 missing header"},
+	},
+	{
+		name:  "too many lines",
+		patch: "--- a.txt\n+++ a.txt\n@@ -1 +1 @@\n-a\n+b\n+c\n c\n",
+		want:  []string{"6 bad hunk count"},
+	},
+	{
+		name:  "more deleted lines than counted",
+		patch: "--- a.txt\n+++ a.txt\n@@ -1,2 +1,3 @@\n-a\n-b\n-c\n+d\n",
+		want:  []string{"6 bad hunk count"},
+	},
+	{
+		name:  "truncated",
+		patch: "--- a.txt\n+++ a.txt\n@@ -1,3 +1,3 @@\n a\n-b\n+c\n--- b.txt\n+++ b.txt\n@@ -1 +1 @@\n-a\n+b\n",
+		want:  []string{"7 truncated hunk"},
+	},
+	{
+		name:  "truncated at the end",
+		patch: "--- a.txt\n+++ a.txt\n@@ -1,3 +1,3 @@\n a\n",
+		want:  []string{"5 truncated hunk"},
+	},
+	{
+		name:  "missing headers",
+		patch: "diff --git a/a.txt b/a.txt\n@@ -1 +1 @@\n-a\n+b\n--- a.txt\nfoo\n",
+		want:  []string{"2 missing header", "5 missing header"},
+	},
+	{
+		name:  "bad hunk header",
+		patch: "--- a.txt\n+++ a.txt\n@@ -x +1 @@\n-a\n",
+		want:  []string{"3 bad hunk header"},
+	},
+	{
+		name:  "mixed prefixes",
+		patch: "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-a\n+b\n--- b.txt\n+++ b.txt\n@@ -1 +1 @@\n-a\n+b\n--- a/c.txt\n+++ c.txt\n",
+		want:  []string{"6 mixed path prefixes", "11 mixed path prefixes"},
+	},
+	{
+		name:  "overlapping hunks",
+		patch: "--- a.txt\n+++ a.txt\n@@ -3,3 +3,3 @@\n a\n-b\n+c\n d\n@@ -4 +4 @@\n-d\n+e\n@@ -1 +1 @@\n-x\n+y\n",
+		want:  []string{"8 overlapping hunks", "11 overlapping hunks"},
+	},
+}
+
+func TestValidate(t *testing.T) {
+	for _, tt := range validateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, p := range Validate(strings.NewReader(tt.patch)) {
+				got = append(got, fmt.Sprintf("%d %v", p.Line, p.Kind))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate: got problems %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProblemString(t *testing.T) {
+	problems := Validate(strings.NewReader("--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n-a\n"))
+	want := "line 5: b/a.txt: hunk at line 3 ends 1 original and 2 new lines early"
+	if len(problems) != 1 || problems[0].String() != want {
+		t.Errorf("Validate: got problems %v; want %s", problems, want)
+	}
+}
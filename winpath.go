@@ -0,0 +1,90 @@
+package patchutils
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/sourcegraph/go-diff/diff"
+)
+
+// portableNames reports whether names of files written to trees are checked for
+// names Windows reserves or can't store, and for names which differ only in case,
+// which Windows can't tell apart: always on Windows, where such files would silently
+// overwrite each other or end up as devices or alternate data streams, and elsewhere
+// if opts.PortableNames is set.
+func portableNames(opts ApplyOptions) bool {
+	return opts.PortableNames || runtime.GOOS == "windows"
+}
+
+// backslashRule rewrites the backslashes of names of diffs made on Windows to slashes.
+var backslashRule = RewriteRule{Pattern: regexp.MustCompile(`\\`), Replacement: "/", Paths: true}
+
+// slashFileDiffNames replaces backslashes in the names of fd, and in the paths of
+// its extended headers, with slashes, so that diffs made on Windows name files
+// like other ones. Names are slash-separated on all systems from then on.
+func slashFileDiffNames(fd *diff.FileDiff) {
+	// Rules of paths only never fail
+	_ = rewriteFileDiff(fd, []RewriteRule{backslashRule})
+}
+
+// windowsReservedNames are the device names Windows reserves, with or without extension.
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// windowsUnsafeName reports why Windows can't store a file under the slash-separated
+// name, or returns "" if it can: a component is a reserved device name, such as
+// "CON" or "nul.txt", contains a character Windows forbids, or ends in a dot or
+// a space, which Windows strips.
+func windowsUnsafeName(name string) string {
+	for _, component := range strings.Split(name, "/") {
+		if component == "." || component == ".." {
+			continue
+		}
+		base := component
+		if k := strings.Index(base, "."); k >= 0 {
+			base = base[:k]
+		}
+		if windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))] {
+			return fmt.Sprintf("%q is a reserved name", component)
+		}
+		if k := strings.IndexAny(component, `<>:"\|?*`); k >= 0 {
+			return fmt.Sprintf("%q contains %q", component, component[k])
+		}
+		for _, r := range component {
+			if r < 0x20 {
+				return fmt.Sprintf("%q contains a control character", component)
+			}
+		}
+		if strings.HasSuffix(component, ".") || strings.HasSuffix(component, " ") {
+			return fmt.Sprintf("%q ends in a dot or a space", component)
+		}
+	}
+	return ""
+}
+
+// checkPortableName returns an error wrapping ErrReservedName if names are checked
+// with opts and Windows can't store a file under the slash-separated name.
+func checkPortableName(name string, opts ApplyOptions) error {
+	if !portableNames(opts) {
+		return nil
+	}
+	if reason := windowsUnsafeName(name); reason != "" {
+		return fmt.Errorf("%q: %s: %w", name, reason, ErrReservedName)
+	}
+	return nil
+}
+
+// ErrReservedName indicates that a file name can't be used on Windows.
+var ErrReservedName = errors.New("name not allowed on Windows")
+
+// ErrCaseCollision indicates that two files have names which differ only in case,
+// which case-insensitive filesystems can't tell apart.
+var ErrCaseCollision = errors.New("file names differ only in case")
@@ -0,0 +1,143 @@
+package patchutils
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var windowsUnsafeNameTests = []struct {
+	name   string
+	unsafe bool
+}{
+	{name: "dir/file.txt"},
+	{name: "console/CONSOLE.txt"},
+	{name: "a/../b"},
+	{name: ".gitignore"},
+	{name: "CON", unsafe: true},
+	{name: "dir/nul.txt", unsafe: true},
+	{name: "Com1.tar.gz", unsafe: true},
+	{name: "lpt9/file", unsafe: true},
+	{name: "aux /file", unsafe: true},
+	{name: "a:b", unsafe: true},
+	{name: "what?", unsafe: true},
+	{name: "dir./file", unsafe: true},
+	{name: "file ", unsafe: true},
+	{name: "tab\tname", unsafe: true},
+}
+
+func TestWindowsUnsafeName(t *testing.T) {
+	for _, tt := range windowsUnsafeNameTests {
+		if reason := windowsUnsafeName(tt.name); (reason != "") != tt.unsafe {
+			t.Errorf("windowsUnsafeName(%q) = %q; want unsafe %v", tt.name, reason, tt.unsafe)
+		}
+	}
+}
+
+func TestSlashFileDiffNames(t *testing.T) {
+	patch := "diff --git a\\dir\\old.txt b\\dir\\new.txt\n" +
+		"similarity index 100%\n" +
+		"rename from dir\\old.txt\n" +
+		"rename to dir\\new.txt\n" +
+		"--- a\\dir\\old.txt\n" +
+		"+++ b\\dir\\new.txt\n" +
+		"@@ -1,1 +1,1 @@\n" +
+		"-a\\b\n" +
+		"+a\\c\n"
+	fileDiffs, err := readPatch(strings.NewReader(patch))
+	if err != nil {
+		t.Fatalf("readPatch: %v", err)
+	}
+	fd := fileDiffs[0]
+	if fd.OrigName != "a/dir/old.txt" || fd.NewName != "b/dir/new.txt" {
+		t.Errorf("Names: got %q and %q; want \"a/dir/old.txt\" and \"b/dir/new.txt\"", fd.OrigName, fd.NewName)
+	}
+	wantExtended := []string{"diff --git a/dir/old.txt b/dir/new.txt", "similarity index 100%",
+		"rename from dir/old.txt", "rename to dir/new.txt"}
+	if !reflect.DeepEqual(fd.Extended, wantExtended) {
+		t.Errorf("Extended headers: got %q; want %q", fd.Extended, wantExtended)
+	}
+	// Lines of files keep their backslashes
+	if want := "-a\\b\n+a\\c\n"; string(fd.Hunks[0].Body) != want {
+		t.Errorf("Hunk body: got %q; want %q", fd.Hunks[0].Body, want)
+	}
+}
+
+var portableNamesTests = []struct {
+	name    string
+	files   map[string]string
+	patch   string
+	wantErr error
+}{
+	{
+		name:  "reserved name",
+		files: map[string]string{},
+		patch: `--- /dev/null
++++ aux.c
+@@ -0,0 +1 @@
++x
+`,
+		wantErr: ErrReservedName,
+	},
+	{
+		name:  "added files differing in case",
+		files: map[string]string{},
+		patch: `--- /dev/null
++++ Makefile
+@@ -0,0 +1 @@
++x
+--- /dev/null
++++ makefile
+@@ -0,0 +1 @@
++y
+`,
+		wantErr: ErrCaseCollision,
+	},
+	{
+		name:  "renamed to a file differing in case",
+		files: map[string]string{"a.txt": "a\n", "b.txt": "b\n"},
+		patch: `--- a.txt
++++ a.txt
+@@ -1 +1 @@
+-a
++A
+--- b.txt
++++ A.TXT
+@@ -1 +1 @@
+-b
++B
+`,
+		wantErr: ErrCaseCollision,
+	},
+	{
+		name:  "file renamed to another case",
+		files: map[string]string{"a.txt": "a\n"},
+		patch: `--- a.txt
++++ A.txt
+@@ -1 +1 @@
+-a
++A
+`,
+	},
+}
+
+func TestApplyPathPortableNames(t *testing.T) {
+	for _, tt := range portableNamesTests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := writeTestTree(t, tt.files)
+			defer os.RemoveAll(root)
+
+			err := ApplyPathWithOptions(root, strings.NewReader(tt.patch), ApplyOptions{PortableNames: true})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ApplyPath: got error %v; want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				if currentFiles := readTestTree(t, root); !reflect.DeepEqual(currentFiles, tt.files) {
+					t.Errorf("Tree changed after error.\nGot:\n%v\nWant:\n%v\n", currentFiles, tt.files)
+				}
+			}
+		})
+	}
+}
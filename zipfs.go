@@ -0,0 +1,197 @@
+//go:build go1.16
+// +build go1.16
+
+package patchutils
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ZipFS returns the tree of the zip archive r as a filesystem for MixedModeFS, so
+// that release archives can be compared without extracting them.
+//
+// Names of entries are normalized: backslashes, which some Windows tools write
+// instead of forward slashes, separate components, and leading "/" and "./" are
+// removed. If all entries are in a single top-level directory, as in most release
+// archives, that directory is the root of the tree, so that archives of different
+// versions have the same names. Entries outside of the archive fail with
+// ErrUnsafePath and entries of the same normalized name with ErrDuplicateZipEntry.
+func ZipFS(r *zip.Reader) (fs.FS, error) {
+	t := &zipTree{files: map[string]*zip.File{}, dirs: map[string][]*zipInfo{}}
+	var names []string
+	for _, f := range r.File {
+		name, isDir := zipName(f.Name)
+		if name == "." {
+			continue
+		}
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("zip entry %q: %w", f.Name, ErrUnsafePath)
+		}
+		if isDir || f.FileInfo().IsDir() {
+			continue
+		}
+		if _, ok := t.files[name]; ok {
+			return nil, fmt.Errorf("zip entry %q: %w", f.Name, ErrDuplicateZipEntry)
+		}
+		t.files[name] = f
+		names = append(names, name)
+	}
+
+	if top := zipTopDir(names); top != "" {
+		files := make(map[string]*zip.File, len(t.files))
+		for i, name := range names {
+			names[i] = strings.TrimPrefix(name, top+"/")
+			files[names[i]] = t.files[name]
+		}
+		t.files = files
+	}
+
+	t.dirs["."] = nil
+	for _, name := range names {
+		info := &zipInfo{name: path.Base(name), f: t.files[name]}
+		for dir := path.Dir(name); ; dir = path.Dir(dir) {
+			_, seen := t.dirs[dir]
+			t.dirs[dir] = append(t.dirs[dir], info)
+			if seen {
+				break
+			}
+			info = &zipInfo{name: path.Base(dir)}
+		}
+	}
+	for _, entries := range t.dirs {
+		sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	}
+	return t, nil
+}
+
+// zipName returns the normalized name of the zip entry called name and whether it
+// is a directory.
+func zipName(name string) (string, bool) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	isDir := strings.HasSuffix(name, "/")
+	name = strings.TrimLeft(name, "/")
+	if name == "" {
+		return ".", isDir
+	}
+	return path.Clean(name), isDir
+}
+
+// zipTopDir returns the top-level directory all names are in, or "" if there is
+// none.
+func zipTopDir(names []string) string {
+	var top string
+	for _, name := range names {
+		i := strings.Index(name, "/")
+		if i < 0 || (top != "" && name[:i] != top) {
+			return ""
+		}
+		top = name[:i]
+	}
+	return top
+}
+
+// zipTree is the normalized tree of a zip archive, with the files and the sorted
+// entries of directories by their slash-separated names.
+type zipTree struct {
+	files map[string]*zip.File
+	dirs  map[string][]*zipInfo
+}
+
+func (t *zipTree) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if f, ok := t.files[name]; ok {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+		return &zipFile{ReadCloser: rc, info: &zipInfo{name: path.Base(name), f: f}}, nil
+	}
+	if entries, ok := t.dirs[name]; ok {
+		return &zipDir{info: &zipInfo{name: path.Base(name)}, entries: entries}, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// zipInfo describes a file of a zipTree, or a directory if f is nil. It is both
+// its fs.FileInfo and its fs.DirEntry.
+type zipInfo struct {
+	name string
+	f    *zip.File
+}
+
+func (i *zipInfo) Name() string               { return i.name }
+func (i *zipInfo) IsDir() bool                { return i.f == nil }
+func (i *zipInfo) Sys() interface{}           { return nil }
+func (i *zipInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *zipInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+func (i *zipInfo) Size() int64 {
+	if i.f == nil {
+		return 0
+	}
+	return int64(i.f.UncompressedSize64)
+}
+
+func (i *zipInfo) Mode() fs.FileMode {
+	if i.f == nil {
+		return fs.ModeDir | 0555
+	}
+	return i.f.Mode() &^ fs.ModeDir
+}
+
+func (i *zipInfo) ModTime() time.Time {
+	if i.f == nil {
+		return time.Time{}
+	}
+	return i.f.Modified
+}
+
+type zipFile struct {
+	io.ReadCloser
+	info *zipInfo
+}
+
+func (f *zipFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+type zipDir struct {
+	info    *zipInfo
+	entries []*zipInfo
+	offset  int
+}
+
+func (d *zipDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *zipDir) Close() error               { return nil }
+
+func (d *zipDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *zipDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	d.offset += len(rest)
+	entries := make([]fs.DirEntry, len(rest))
+	for i, e := range rest {
+		entries[i] = e
+	}
+	return entries, nil
+}
+
+// ErrDuplicateZipEntry indicates that a zip archive has several files of the same
+// normalized name.
+var ErrDuplicateZipEntry = errors.New("duplicate zip entry")
@@ -0,0 +1,115 @@
+//go:build go1.16
+// +build go1.16
+
+package patchutils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// newTestZip returns a zip archive of files by their entry names.
+func newTestZip(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestMixedModeZip(t *testing.T) {
+	oldFS, err := ZipFS(newTestZip(t, map[string]string{
+		`proj-1.0\`:          "",
+		`proj-1.0\a.txt`:     "one\ntwo\nthree\n",
+		`proj-1.0\sub\b.txt`: "x\ny\n",
+		`proj-1.0\gone.txt`:  "gone\n",
+	}))
+	if err != nil {
+		t.Fatalf("ZipFS: got error %v; want error nil", err)
+	}
+	newFS, err := ZipFS(newTestZip(t, map[string]string{
+		"./proj-1.1/a.txt":     "zero\none\ntwo\nthree\n",
+		"./proj-1.1/sub/b.txt": "x\ny\n",
+		"./proj-1.1/sub/c.txt": "c\n",
+	}))
+	if err != nil {
+		t.Fatalf("ZipFS: got error %v; want error nil", err)
+	}
+
+	result, err := MixedModeFSWithOptions(oldFS, newFS,
+		strings.NewReader(mixedModeFSOldDiff), strings.NewReader(mixedModeFSNewDiff), MixedModeOptions{StripLevel: 1})
+	if err != nil {
+		t.Fatalf("MixedModeFS: got error %v; want error nil", err)
+	}
+	if result != mixedModeFSResult {
+		t.Errorf("Result mismatch.\nGot:\n%s\nWant:\n%s\n", result, mixedModeFSResult)
+	}
+}
+
+func TestZipFS(t *testing.T) {
+	fsys, err := ZipFS(newTestZip(t, map[string]string{
+		`a.txt`:         "a\n",
+		`dir\b.txt`:     "b\n",
+		`/dir/sub/c.go`: "package c\n",
+	}))
+	if err != nil {
+		t.Fatalf("ZipFS: got error %v; want error nil", err)
+	}
+	if err := fstest.TestFS(fsys, "a.txt", "dir/b.txt", "dir/sub/c.go"); err != nil {
+		t.Error(err)
+	}
+}
+
+var zipFSErrorTests = []struct {
+	name    string
+	files   map[string]string
+	wantErr error
+}{
+	{
+		name:    "outside of archive",
+		files:   map[string]string{`dir\..\..\evil`: "x\n"},
+		wantErr: ErrUnsafePath,
+	},
+	{
+		name:    "same normalized name",
+		files:   map[string]string{`dir\a.txt`: "1\n", "dir/a.txt": "2\n"},
+		wantErr: ErrDuplicateZipEntry,
+	},
+}
+
+func TestZipFSErrors(t *testing.T) {
+	for _, tt := range zipFSErrorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ZipFS(newTestZip(t, tt.files))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ZipFS: got error %v; want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}